@@ -0,0 +1,376 @@
+/*
+Package backup takes consistent backups of an index while it is
+being written to.
+
+A backup holds the files of a single commit, snapshotted so the
+IndexWriter doesn't delete them while they are copied, plus a
+manifest listing the length and checksum of each file. The files are
+either copied, or hard-linked when the index and the backup are on
+the same file system, which is cheap and safe as index files are
+never modified once written. Every copied file is checksummed on
+both sides.
+
+A backup is itself a complete index, which can be restored by simply
+copying it back, or opened as is.
+
+Incremental backups reuse the segment files already present in a
+previous backup: they are hard-linked from it rather than copied from
+the index, so only the segments written since cost time and space.
+A file is only reused if its checksum in the index matches the one
+recorded by the previous backup, so a previous backup of another
+index, holding different files of the same names, is harmless.
+*/
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/balzaczyy/golucene/core/index"
+	"github.com/balzaczyy/golucene/core/store"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Name of the manifest, written last to complete the backup.
+	MANIFEST_FILE_NAME = "backup.json"
+
+	MANIFEST_VERSION_START   = 1
+	MANIFEST_VERSION_CURRENT = MANIFEST_VERSION_START
+)
+
+/* Describes a file of a backup. */
+type FileEntry struct {
+	Name   string
+	Length int64
+	// CRC32 of the whole file.
+	Checksum int64
+	// Whether the file was reused from the previous backup.
+	Reused bool `json:",omitempty"`
+}
+
+/* Describes a backup, and the commit it holds. */
+type Manifest struct {
+	Version          int
+	Time             time.Time
+	Generation       int64
+	SegmentsFileName string
+	UserData         map[string]string `json:",omitempty"`
+	// Path of the previous backup, for incremental backups.
+	Previous string `json:",omitempty"`
+	// Files of the commit, with segments_N last.
+	Files []FileEntry
+}
+
+/* Returns the total length of the files, and of those reused. */
+func (m *Manifest) Size() (total, reused int64) {
+	for _, file := range m.Files {
+		total += file.Length
+		if file.Reused {
+			reused += file.Length
+		}
+	}
+	return
+}
+
+/* Reads the manifest of the backup at path. */
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(filepath.Join(path, MANIFEST_FILE_NAME))
+	if err != nil {
+		return nil, err
+	}
+	m := new(Manifest)
+	if err = json.Unmarshal(data, m); err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid manifest in %v: %v", path, err))
+	}
+	if m.Version < MANIFEST_VERSION_START || m.Version > MANIFEST_VERSION_CURRENT {
+		return nil, errors.New(fmt.Sprintf(
+			"unsupported manifest version %v in %v", m.Version, path))
+	}
+	return m, nil
+}
+
+/* Options of a backup; the zero value copies every file. */
+type Options struct {
+	// Hard-link the files of the index into the backup instead of
+	// copying them, if both are on the same file system. Falls back to
+	// copying otherwise.
+	Link bool
+	// Path of a previous backup of the same index. Files of the commit
+	// it holds already, with the same length and checksum, are
+	// hard-linked from it instead of copied from the index.
+	Previous string
+}
+
+/*
+Backs up the last commit of the writer into target, which must not
+exist or be empty. The writer must be configured with a
+SnapshotDeletionPolicy or a PersistentSnapshotDeletionPolicy: the
+commit is snapshotted for the time of the backup, so indexing can
+continue meanwhile.
+*/
+func Backup(w *index.IndexWriter, target string, opts *Options) (m *Manifest, err error) {
+	snapshotter, ok := w.Config().IndexDeletionPolicy().(index.Snapshotter)
+	if !ok {
+		return nil, errors.New(
+			"IndexWriter must be created with a SnapshotDeletionPolicy")
+	}
+	commit, err := snapshotter.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err2 := snapshotter.Release(commit); err == nil {
+			err = err2
+		}
+		if err2 := w.DeleteUnusedFiles(); err == nil {
+			err = err2
+		}
+	}()
+	return BackupCommit(commit, target, opts)
+}
+
+/*
+Backs up the given commit into target, which must not exist or be
+empty. The caller must ensure the files of the commit aren't deleted
+meanwhile, e.g. by holding a snapshot of it.
+*/
+func BackupCommit(commit index.IndexCommit, target string, opts *Options) (m *Manifest, err error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	var previous map[string]FileEntry
+	if opts.Previous != "" {
+		prev, err := ReadManifest(opts.Previous)
+		if err != nil {
+			return nil, err
+		}
+		previous = make(map[string]FileEntry)
+		for _, file := range prev.Files {
+			previous[file.Name] = file
+		}
+	}
+	if err = createEmptyDir(target); err != nil {
+		return nil, err
+	}
+	dest, err := store.NewSimpleFSDirectory(target)
+	if err != nil {
+		return nil, err
+	}
+	defer dest.Close()
+
+	m = &Manifest{
+		Version:          MANIFEST_VERSION_CURRENT,
+		Time:             time.Now(),
+		Generation:       commit.Generation(),
+		SegmentsFileName: commit.SegmentsFileName(),
+		UserData:         commit.UserData(),
+		Previous:         opts.Previous,
+	}
+	b := &backup{commit.Directory(), dest, target, opts, previous}
+	var copied []string
+	for _, name := range commitFiles(commit) {
+		file, wasCopied, err := b.backupFile(name)
+		if err != nil {
+			return nil, err
+		}
+		m.Files = append(m.Files, file)
+		if wasCopied {
+			copied = append(copied, name)
+		}
+	}
+	if err = dest.Sync(copied); err != nil {
+		return nil, err
+	}
+	if err = writeManifest(target, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+/* Returns the files of the commit, sorted, with segments_N last. */
+func commitFiles(commit index.IndexCommit) []string {
+	segmentsFile := commit.SegmentsFileName()
+	var names []string
+	for _, name := range commit.FileNames() {
+		if name != segmentsFile {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append(names, segmentsFile)
+}
+
+func createEmptyDir(path string) error {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return err
+	}
+	names, err := store.FSDirectoryListAll(path)
+	if err != nil {
+		return err
+	}
+	if len(names) > 0 {
+		return errors.New(fmt.Sprintf("backup target %v is not empty", path))
+	}
+	return nil
+}
+
+// Implemented by FSDirectory and its subclasses.
+type fsDirectory interface {
+	Path() string
+}
+
+type backup struct {
+	src      store.Directory
+	dest     store.Directory
+	target   string
+	opts     *Options
+	previous map[string]FileEntry
+}
+
+/*
+Reuses, links or copies the file into the backup; returns its entry
+and whether it was copied, i.e. whether it needs to be synced.
+*/
+func (b *backup) backupFile(name string) (file FileEntry, copied bool, err error) {
+	targetPath := filepath.Join(b.target, name)
+	length, err := b.src.FileLength(name)
+	if err != nil {
+		return
+	}
+	var expected FileEntry
+	if prev, ok := b.previous[name]; ok && prev.Length == length &&
+		!strings.HasPrefix(name, index.INDEX_FILENAME_SEGMENTS) {
+		// the name and length don't identify the file, e.g. if the
+		// previous backup is of another index
+		if expected, err = checksum(b.src, name); err != nil {
+			return
+		}
+		if expected.Checksum == prev.Checksum &&
+			os.Link(filepath.Join(b.opts.Previous, name), targetPath) == nil {
+			prev.Reused = true
+			return prev, false, nil
+		}
+	}
+	if fsd, ok := b.src.(fsDirectory); ok && b.opts.Link {
+		if os.Link(filepath.Join(fsd.Path(), name), targetPath) == nil {
+			file, err = checksum(b.dest, name)
+			return file, false, err
+		}
+	}
+
+	if expected.Name == "" {
+		if expected, err = checksum(b.src, name); err != nil {
+			return
+		}
+	}
+	if err = b.src.Copy(b.dest, name, name, store.IO_CONTEXT_DEFAULT); err != nil {
+		return
+	}
+	if file, err = checksum(b.dest, name); err != nil {
+		return
+	}
+	if file != expected {
+		return file, false, errors.New(fmt.Sprintf(
+			"checksum mismatch copying %v: expected length=%v checksum=%v, got length=%v checksum=%v",
+			name, expected.Length, expected.Checksum, file.Length, file.Checksum))
+	}
+	return file, true, nil
+}
+
+/* Computes the entry of the named file of dir. */
+func checksum(dir store.Directory, name string) (file FileEntry, err error) {
+	in, err := dir.OpenInput(name, store.IO_CONTEXT_READONCE)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+	h := crc32.NewIEEE()
+	buf := make([]byte, 16*1024)
+	for remaining := in.Length(); remaining > 0; {
+		n := len(buf)
+		if int64(n) > remaining {
+			n = int(remaining)
+		}
+		if err = in.ReadBytes(buf[:n]); err != nil {
+			return
+		}
+		h.Write(buf[:n])
+		remaining -= int64(n)
+	}
+	return FileEntry{Name: name, Length: in.Length(), Checksum: int64(h.Sum32())}, nil
+}
+
+/* Writes the manifest atomically, completing the backup. */
+func writeManifest(path string, m *Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(path, MANIFEST_FILE_NAME+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = os.Rename(tmp, filepath.Join(path, MANIFEST_FILE_NAME))
+	}
+	if err != nil {
+		os.Remove(tmp) // ignore error
+		return err
+	}
+	syncDir(path)
+	return nil
+}
+
+/*
+Makes the entries of the directory durable, i.e. the links and the
+manifest. Best effort: not supported on all platforms.
+*/
+func syncDir(path string) {
+	if f, err := os.Open(path); err == nil {
+		f.Sync() // ignore error
+		f.Close()
+	}
+}
+
+/*
+Checks that the backup at path is complete and intact: every file of
+its manifest must be present, with the recorded length and checksum.
+*/
+func Verify(path string) (*Manifest, error) {
+	m, err := ReadManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := store.NewSimpleFSDirectory(path)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+	for _, expected := range m.Files {
+		file, err := checksum(dir, expected.Name)
+		if err != nil {
+			return m, err
+		}
+		if file.Length != expected.Length || file.Checksum != expected.Checksum {
+			return m, errors.New(fmt.Sprintf(
+				"%v is corrupted: expected length=%v checksum=%v, got length=%v checksum=%v",
+				expected.Name, expected.Length, expected.Checksum, file.Length, file.Checksum))
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,196 @@
+package backup
+
+import (
+	"fmt"
+	"github.com/balzaczyy/golucene/core/index"
+	"github.com/balzaczyy/golucene/core/search"
+	"github.com/balzaczyy/golucene/core/store"
+	"github.com/balzaczyy/golucene/core/util"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func init() {
+	index.DefaultSimilarity = func() index.Similarity {
+		return search.NewDefaultSimilarity()
+	}
+}
+
+var samples = []string{
+	"../core/search/testdata/belfrysample",
+	"../core/search/testdata/osx/belfrysample",
+}
+
+func addAndCommit(t *testing.T, w *index.IndexWriter, path string) {
+	src, err := store.OpenFSDirectory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if err = w.AddIndexes(src); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkBackup(t *testing.T, path string, numDocs int) *Manifest {
+	m, err := Verify(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := store.OpenFSDirectory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dir.Close()
+	reader, err := index.OpenDirectoryReader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if reader.NumDocs() != numDocs {
+		t.Errorf("expected %v docs in %v, got %v", numDocs, path, reader.NumDocs())
+	}
+	return m
+}
+
+func testBackup(t *testing.T, dir store.Directory, link bool) {
+	tmp, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	w, err := index.NewIndexWriter(dir, index.NewIndexWriterConfig(util.VERSION_45, nil).
+		SetIndexDeletionPolicy(index.NewSnapshotDeletionPolicy(index.DEFAULT_DELETION_POLICY)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	addAndCommit(t, w, samples[0])
+	full := filepath.Join(tmp, "full")
+	m, err := Backup(w, full, &Options{Link: link})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Files[len(m.Files)-1].Name != m.SegmentsFileName {
+		t.Errorf("expected %v last, got %v", m.SegmentsFileName, m.Files)
+	}
+	checkBackup(t, full, 8)
+	if _, err = Backup(w, full, nil); err == nil {
+		t.Error("expected error backing up into a non-empty directory")
+	}
+
+	// only the new segment is taken from the index
+	addAndCommit(t, w, samples[1])
+	incremental := filepath.Join(tmp, "incremental")
+	if m, err = Backup(w, incremental, &Options{Previous: full}); err != nil {
+		t.Fatal(err)
+	}
+	checkBackup(t, incremental, 16)
+	previous, err := ReadManifest(full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range m.Files {
+		if file.Reused != (file.Name[:2] == "_0") {
+			t.Errorf("unexpected reuse of %v", file.Name)
+		}
+	}
+	if total, reused := m.Size(); reused == 0 || reused == total {
+		t.Errorf("expected part of the %v bytes to be reused, got %v", total, reused)
+	}
+	if _, err = os.Stat(filepath.Join(full, previous.SegmentsFileName)); err != nil {
+		t.Errorf("previous backup should be left intact: %v", err)
+	}
+
+	// the snapshots are released: the first commit is gone
+	if dir.FileExists(previous.SegmentsFileName) {
+		t.Errorf("%v should be deleted once backed up", previous.SegmentsFileName)
+	}
+
+	// corrupt the incremental backup
+	name := filepath.Join(incremental, m.Files[len(m.Files)-2].Name)
+	if err = ioutil.WriteFile(name+".tmp", []byte("corrupted"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Rename(name+".tmp", name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Verify(incremental); err == nil {
+		t.Error("expected the corruption to be detected")
+	}
+}
+
+func TestBackup(t *testing.T) {
+	testBackup(t, store.NewRAMDirectory(), false)
+}
+
+func TestBackupLinks(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	dir, err := store.OpenFSDirectory(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dir.Close()
+	testBackup(t, dir, true)
+}
+
+func TestBackupPreviousOfOtherIndex(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var dirs []store.Directory
+	var backups []string
+	// both samples hold _0.cfs of the same length, but not the same
+	for i, path := range []string{
+		"../core/search/testdata/osx/belfrysample",
+		"../core/search/testdata/win8/belfrysample",
+	} {
+		dir := store.NewRAMDirectory()
+		w, err := index.NewIndexWriter(dir, index.NewIndexWriterConfig(util.VERSION_45, nil).
+			SetIndexDeletionPolicy(index.NewSnapshotDeletionPolicy(index.DEFAULT_DELETION_POLICY)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		addAndCommit(t, w, path)
+		opts := &Options{}
+		if i > 0 {
+			opts.Previous = backups[0]
+		}
+		backups = append(backups, filepath.Join(tmp, fmt.Sprintf("backup%v", i)))
+		if _, err = Backup(w, backups[i], opts); err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		dirs = append(dirs, dir)
+	}
+
+	m := checkBackup(t, backups[1], 8)
+	for _, file := range m.Files {
+		expected, err := checksum(dirs[1], file.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file.Checksum != expected.Checksum {
+			t.Errorf("%v was reused from the backup of another index", file.Name)
+		}
+		if file.Name == "_0.cfs" && file.Reused {
+			t.Error("expected _0.cfs to be copied")
+		}
+	}
+}
@@ -0,0 +1,125 @@
+/*
+Command backup copies the last commit of an index into a backup
+directory, verifies the checksums of the copied files and writes a
+manifest describing the backup. It can also verify an existing backup.
+
+Usage:
+
+	backup [-link] [-previous path] [-dirImpl X] pathToIndex pathToBackup
+	backup -verify pathToBackup
+
+Flags:
+
+	-link: hard-link the index files into the backup rather than copying
+	       them, if both are on the same file system
+	-previous path: take an incremental backup, reusing the segment files
+	       present in the previous backup at path
+	-verify: check the files of an existing backup against its manifest
+	-dirImpl X: use the specified FSDirectory implementation: auto (the
+	            default), mmap, niofs or simple
+
+The tool obtains the write lock of the index for the time of the
+backup, so it fails if an IndexWriter is open on it. To back up an
+index while it is being written to, take the backup from the indexing
+process with backup.Backup(), which snapshots the commit instead.
+
+This tool exits with exit code 1 if the backup failed, or is corrupted.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/balzaczyy/golucene/backup"
+	"github.com/balzaczyy/golucene/core/index"
+	"github.com/balzaczyy/golucene/core/search"
+	"github.com/balzaczyy/golucene/core/store"
+	"github.com/balzaczyy/golucene/core/util"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+func main() {
+	link := flag.Bool("link", false,
+		"hard-link the index files into the backup rather than copying them")
+	previous := flag.String("previous", "",
+		"take an incremental backup, reusing the files of the previous backup at this path")
+	verify := flag.Bool("verify", false,
+		"check the files of an existing backup against its manifest")
+	dirImpl := flag.String("dirImpl", "auto",
+		"the FSDirectory implementation to use: auto, mmap, niofs or simple")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: backup [-link] [-previous path] [-dirImpl X] pathToIndex pathToBackup")
+		fmt.Fprintln(os.Stderr, "       backup -verify pathToBackup")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	// the readers and writer trace a lot; keep the report readable
+	log.SetOutput(ioutil.Discard)
+
+	if *verify {
+		if flag.NArg() != 1 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		m, err := backup.Verify(flag.Arg(0))
+		if err != nil {
+			fmt.Printf("ERROR: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Backup of %v (%v files) is intact\n", m.SegmentsFileName, len(m.Files))
+		return
+	}
+
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	indexPath, backupPath := flag.Arg(0), flag.Arg(1)
+
+	dirType, err := store.ParseFSDirectoryType(*dirImpl)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	m, err := backupIndex(indexPath, backupPath, dirType,
+		&backup.Options{Link: *link, Previous: *previous})
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	total, reused := m.Size()
+	fmt.Printf("Backed up %v (%v files, %v bytes) to %v\n",
+		m.SegmentsFileName, len(m.Files), total, backupPath)
+	if m.Previous != "" {
+		fmt.Printf("Reused %v bytes from %v\n", reused, m.Previous)
+	}
+}
+
+func backupIndex(indexPath, backupPath string, dirType store.FSDirectoryType,
+	opts *backup.Options) (*backup.Manifest, error) {
+
+	dir, err := store.OpenFSDirectoryOfType(indexPath, dirType)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	index.DefaultSimilarity = func() index.Similarity {
+		return search.NewDefaultSimilarity()
+	}
+	// never delete anything from the index
+	conf := index.NewIndexWriterConfig(util.VERSION_45, nil).
+		SetOpenMode(index.OPEN_MODE_APPEND).
+		SetIndexDeletionPolicy(index.NewSnapshotDeletionPolicy(index.NO_DELETION_POLICY))
+	w, err := index.NewIndexWriter(dir, conf)
+	if err != nil {
+		return nil, err
+	}
+	// nothing changed, so nothing is committed
+	defer w.Close()
+
+	return backup.Backup(w, backupPath, opts)
+}
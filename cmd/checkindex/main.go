@@ -0,0 +1,146 @@
+/*
+Command checkindex checks the health of an index and, optionally,
+repairs it by writing a new segments file that drops every broken
+segment.
+
+Usage:
+
+	checkindex [-fix] [-crossCheckTermVectors] [-verbose] [-segment X] [-segment Y] [-dirImpl X] pathToIndex
+
+Flags:
+
+	-fix: actually write a new segments_N file, removing any problematic segments
+	-crossCheckTermVectors: verifies that term vectors match postings; THIS IS VERY SLOW!
+	-verbose: print additional details
+	-segment X: only check the specified segments. This can be specified multiple
+	            times, to check more than one segment, eg '-segment _2 -segment _a'.
+	            You can't use this with the -fix option
+	-dirImpl X: use the specified FSDirectory implementation: auto (the
+	            default), mmap, niofs or simple
+
+**WARNING**: -fix should only be used on an emergency basis as it will
+cause documents (perhaps many) to be permanently removed from the
+index. Always make a backup copy of your index before running this!
+Do not run this tool on an index that is actively being written to.
+You have been warned!
+
+Run without -fix, this tool will open the index, report version
+information and report any errors it hits and what action it would
+take if -fix were specified. With -fix, this tool will remove any
+segments that have issues and write a new segments_N file. This means
+all documents contained in the affected segments will be removed.
+
+This tool exits with exit code 1 if the index cannot be opened or has
+any corruption, else 0.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/balzaczyy/golucene/core/index"
+	"github.com/balzaczyy/golucene/core/store"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// util/CheckIndex.java#main
+
+// Names of the segments given with -segment, in order.
+type segmentList []string
+
+func (l *segmentList) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *segmentList) Set(name string) error {
+	*l = append(*l, name)
+	return nil
+}
+
+func main() {
+	var onlySegments segmentList
+	doFix := flag.Bool("fix", false,
+		"actually write a new segments_N file, removing any problematic segments")
+	doCrossCheckTermVectors := flag.Bool("crossCheckTermVectors", false,
+		"verifies that term vectors match postings; THIS IS VERY SLOW!")
+	verbose := flag.Bool("verbose", false, "print additional details")
+	dirImpl := flag.String("dirImpl", "auto",
+		"the FSDirectory implementation to use: auto, mmap, niofs or simple")
+	flag.Var(&onlySegments, "segment",
+		"only check the specified segment; can be specified multiple times")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: checkindex [-fix] [-crossCheckTermVectors] [-verbose] [-segment X] [-segment Y] [-dirImpl X] pathToIndex")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	indexPath := flag.Arg(0)
+
+	dirType, err := store.ParseFSDirectoryType(*dirImpl)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(onlySegments) == 0 {
+		onlySegments = nil
+	} else if *doFix {
+		fmt.Println("ERROR: cannot specify both -fix and -segment")
+		os.Exit(1)
+	}
+
+	// the readers trace a lot; keep the report readable
+	log.SetOutput(ioutil.Discard)
+
+	fmt.Printf("\nOpening index @ %v\n\n", indexPath)
+	dir, err := store.OpenFSDirectoryOfType(indexPath, dirType)
+	if err != nil {
+		fmt.Printf("ERROR: could not open directory \"%v\"; exiting\n", indexPath)
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer dir.Close()
+
+	checker := index.NewCheckIndex(dir, *doCrossCheckTermVectors, os.Stdout)
+	checker.SetVerbose(*verbose)
+
+	result := checker.CheckIndex(onlySegments)
+	if result.MissingSegments {
+		os.Exit(1)
+	}
+
+	if !result.Clean {
+		if !*doFix {
+			fmt.Printf("WARNING: would write new segments file, and %v documents would be lost, if -fix were specified\n\n",
+				result.TotLoseDocCount)
+		} else {
+			fmt.Printf("WARNING: %v documents will be lost\n\n", result.TotLoseDocCount)
+			fmt.Printf("NOTE: will write new segments file in 5 seconds; this will remove %v docs from the index. THIS IS YOUR LAST CHANCE TO CTRL+C!\n",
+				result.TotLoseDocCount)
+			for s := 0; s < 5; s++ {
+				time.Sleep(time.Second)
+				fmt.Printf("  %v...\n", 5-s)
+			}
+			fmt.Println("Writing...")
+			if err = checker.FixIndex(result); err != nil {
+				fmt.Printf("ERROR: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println("OK")
+			fmt.Printf("Wrote new segments file \"%v\"\n", result.NewSegments.SegmentsFileName())
+		}
+	}
+	fmt.Println()
+
+	if !result.Clean {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Command indexupgrader upgrades all segments of an index written by
+previous Lucene versions, e.g. archives written by Lucene 4.0 to 4.4,
+to the current segment format. Segments already in the current format
+are kept as is.
+
+Usage:
+
+	indexupgrader [-deletePriorCommits] [-dryRun] [-verbose] [-dirImpl X] pathToIndex
+
+Flags:
+
+	-deletePriorCommits: delete all commits but the last one; without it
+	                     the tool refuses to upgrade an index with more
+	                     than one commit
+	-dryRun: only list the segments which would be rewritten, without
+	         changing the index
+	-verbose: print the details of the upgrade
+	-dirImpl X: use the specified FSDirectory implementation: auto (the
+	            default), mmap, niofs or simple
+
+This tool keeps only the last commit in an index. Always make a backup
+copy of your index before running this! Do not run this tool on an
+index that is actively being written to.
+
+This tool exits with exit code 1 if the upgrade failed, else 0.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/balzaczyy/golucene/core/index"
+	"github.com/balzaczyy/golucene/core/search"
+	"github.com/balzaczyy/golucene/core/store"
+	"github.com/balzaczyy/golucene/core/util"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+// index/IndexUpgrader.java#main
+
+func main() {
+	deletePriorCommits := flag.Bool("deletePriorCommits", false,
+		"delete all commits but the last one")
+	dryRun := flag.Bool("dryRun", false,
+		"only list the segments which would be rewritten")
+	verbose := flag.Bool("verbose", false, "print the details of the upgrade")
+	dirImpl := flag.String("dirImpl", "auto",
+		"the FSDirectory implementation to use: auto, mmap, niofs or simple")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: indexupgrader [-deletePriorCommits] [-dryRun] [-verbose] [-dirImpl X] pathToIndex")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	indexPath := flag.Arg(0)
+
+	dirType, err := store.ParseFSDirectoryType(*dirImpl)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+
+	// the readers and writer trace a lot; keep the report readable
+	log.SetOutput(ioutil.Discard)
+
+	dir, err := store.OpenFSDirectoryOfType(indexPath, dirType)
+	if err != nil {
+		fmt.Printf("ERROR: could not open directory \"%v\"; exiting\n", indexPath)
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer dir.Close()
+
+	index.DefaultSimilarity = func() index.Similarity {
+		return search.NewDefaultSimilarity()
+	}
+	conf := index.NewIndexWriterConfig(util.VERSION_45, nil)
+	if *verbose {
+		conf.SetInfoStream(util.NewPrintStreamInfoStream(os.Stdout))
+	}
+	upgrader := index.NewIndexUpgrader(dir, conf, *deletePriorCommits)
+
+	segments, err := upgrader.SegmentsToUpgrade()
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	if len(segments) == 0 {
+		fmt.Printf("All segments of %v are at version %v; nothing to upgrade\n",
+			indexPath, util.LUCENE_MAIN_VERSION)
+		return
+	}
+	var docCount int
+	var size int64
+	for _, si := range segments {
+		fmt.Printf("  %v: version=%v codec=%v docCount=%v delCount=%v size (MB)=%.3f\n",
+			si.Name, si.Version, si.Codec, si.DocCount, si.DelCount,
+			float64(si.SizeInBytes)/(1024*1024))
+		docCount += si.DocCount - si.DelCount
+		size += si.SizeInBytes
+	}
+	if *dryRun {
+		fmt.Printf("Would rewrite %v segments (%v docs, %.3f MB) to version %v\n",
+			len(segments), docCount, float64(size)/(1024*1024), util.LUCENE_MAIN_VERSION)
+		return
+	}
+
+	fmt.Printf("Rewriting %v segments (%v docs, %.3f MB) to version %v...\n",
+		len(segments), docCount, float64(size)/(1024*1024), util.LUCENE_MAIN_VERSION)
+	if err = upgrader.Upgrade(); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("OK")
+}
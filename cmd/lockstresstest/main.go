@@ -0,0 +1,70 @@
+/*
+Command lockstresstest repeatedly obtains and releases a lock using a
+specific LockFactory, reporting each step to a lockverifyserver. Run
+it in several processes at once, each with a unique id and all
+pointing to the same lock directory and server, to verify that the
+LockFactory really gives mutual exclusion.
+
+Usage:
+
+	lockstresstest [-lockFactory native|simple] [-sleep 50ms] [-count 1000] id verifierAddr lockDir
+
+The id must be unique for each process, between 0 and 255.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/balzaczyy/golucene/core/store"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// store/LockStressTest.java#main
+
+func main() {
+	lockFactory := flag.String("lockFactory", "native",
+		"the LockFactory to test: native or simple")
+	sleepTime := flag.Duration("sleep", 50*time.Millisecond,
+		"the maximum time to hold the lock, and to wait between attempts")
+	count := flag.Int("count", 1000, "the number of times to try obtaining the lock")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: lockstresstest [-lockFactory native|simple] [-sleep 50ms] [-count 1000] id verifierAddr lockDir")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 3 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	id, err := strconv.Atoi(flag.Arg(0))
+	if err != nil || id < 0 || id > 255 {
+		fmt.Println("ERROR: id must be between 0 and 255")
+		os.Exit(1)
+	}
+	verifierAddr, lockDir := flag.Arg(1), flag.Arg(2)
+
+	var lf store.LockFactory
+	switch *lockFactory {
+	case "native":
+		lf = store.NewNativeFSLockFactory(lockDir)
+	case "simple":
+		lf = store.NewSimpleFSLockFactory(lockDir)
+	default:
+		fmt.Printf("ERROR: unknown LockFactory: %v\n", *lockFactory)
+		os.Exit(1)
+	}
+
+	// the lock factories trace a lot
+	log.SetOutput(ioutil.Discard)
+
+	if err = store.LockStressTest(byte(id), verifierAddr, lf, *sleepTime, *count); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Finished", *count, "tries.")
+}
@@ -0,0 +1,47 @@
+/*
+Command lockverifyserver is the server side of the lock stress test:
+lockstresstest clients connect to it and report every lock obtain and
+release, and the server verifies that the lock is never held by two
+clients at the same time.
+
+Usage:
+
+	lockverifyserver [-addr host:port]
+
+The server runs until interrupted, or until it detects a locking
+error, in which case it exits with a non-zero status.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/balzaczyy/golucene/core/store"
+	"os"
+)
+
+// store/LockVerifyServer.java#main
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:0", "the address to listen on")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: lockverifyserver [-addr host:port]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	server, err := store.NewLockVerifyServer(*addr)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Listening on %v...\n", server.Addr())
+	if err = server.Serve(); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -1,6 +1,8 @@
 package analysis
 
-import ()
+import (
+	"io"
+)
 
 // analysis/Analyzer.java
 
@@ -13,6 +15,14 @@ TokenStreamConents in CreateComponents(string, Reader). The components are
 then reused in each call to TokenStream(string, Reader).
 */
 type Analyzer interface {
+	// Returns a TokenStream suitable for fieldName, tokenizing the
+	// contents of reader.
+	TokenStream(fieldName string, reader io.Reader) (TokenStream, error)
+	// Invoked before indexing an instance of the field after the first
+	// one of a document, to add a gap to the token positions.
+	PositionIncrementGap(fieldName string) int
+	// Like PositionIncrementGap(), except for token offsets instead.
+	OffsetGap(fieldName string) int
 }
 
 type AnalyzerImpl struct {
@@ -0,0 +1,39 @@
+package analysis
+
+// analysis/Token.java
+
+/*
+A Token is an occurrence of a term from the text of a field. It
+consists of a term's text, the start and end offset of the term in
+the text of the field, the increment of its position relative to the
+previous token, and an optional payload.
+
+The start and end offsets permit applications to re-associate a token
+with its source text, e.g., to display highlighted query terms in a
+document browser, or to show matching text fragments in a KWIC
+display, etc.
+
+A position increment of 1 (the default) means the token directly
+follows the previous one; 0 means it is at the same position, e.g.
+for a synonym; values greater than 1 leave a gap, e.g. for removed
+stop words.
+*/
+type Token struct {
+	// The term text, in UTF-8
+	Term []byte
+	// The increment of the position of this token relative to the
+	// previous token
+	PositionIncrement int
+	// Start and end offsets of the token in the source text
+	StartOffset, EndOffset int
+	// The payload of the token, or nil
+	Payload []byte
+}
+
+// Resets all attributes to their defaults.
+func (t *Token) Clear() {
+	t.Term = t.Term[:0]
+	t.PositionIncrement = 1
+	t.StartOffset, t.EndOffset = 0, 0
+	t.Payload = nil
+}
@@ -58,6 +58,19 @@ import (
  * implementation of {@link #incrementToken}! This is checked when Java
  * assertions are enabled.
  */
-type TokenStream struct {
+type TokenStream interface {
 	io.Closer
+	// Resets this stream to a clean state. Consumers call Reset()
+	// before the first call to IncrementToken().
+	Reset() error
+	// Advances the stream to the next token, whose attributes are then
+	// available through Token(). Returns false at the end of the
+	// stream.
+	IncrementToken() (bool, error)
+	// Called by the consumer after the last token has been consumed,
+	// to perform end-of-stream operations, e.g. set the final offset.
+	End() error
+	// Returns the attributes of the current token. The same instance
+	// is updated for every token, so consumers may keep a reference.
+	Token() *Token
 }
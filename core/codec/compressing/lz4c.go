@@ -2,10 +2,13 @@ package compressing
 
 import (
 	"github.com/balzaczyy/golucene/core/util/packed"
+	"math/bits"
 )
 
 // codecs/compressing/LZ4.java#compress
 
+const MEMORY_USAGE = 14
+
 type DataOutput interface {
 	WriteByte(b byte) error
 	WriteBytes(buf []byte) error
@@ -15,7 +18,7 @@ type DataOutput interface {
 
 func hash(i, hashBits int) int {
 	assert(hashBits >= 0 && hashBits <= 32)
-	return int(uint(i*-1640531535) >> uint(32-hashBits))
+	return int(uint32(int32(i)*-1640531535) >> uint(32-hashBits))
 }
 
 func readInt(buf []byte, i int) int {
@@ -103,11 +106,20 @@ func min(a, b int) int {
 
 type LZ4HashTable struct {
 	hashLog   int
-	hashTable packed.Mutable
+	hashTable []int
 }
 
-func (h *LZ4HashTable) reset(len int) {
-	panic("not implemented yet")
+func (h *LZ4HashTable) reset(length int) {
+	bitsPerOffset := packed.BitsRequired(int64(length - LAST_LITERALS))
+	bitsPerOffsetLog := bits.Len(uint(bitsPerOffset - 1))
+	h.hashLog = MEMORY_USAGE + 3 - bitsPerOffsetLog
+	if size := 1 << uint(h.hashLog); len(h.hashTable) < size {
+		h.hashTable = make([]int, size)
+	} else {
+		for i, _ := range h.hashTable {
+			h.hashTable[i] = 0
+		}
+	}
 }
 
 /*
@@ -128,22 +140,22 @@ func LZ4Compress(bytes []byte, out DataOutput, ht *LZ4HashTable) error {
 		hashLog := ht.hashLog
 		hashTable := ht.hashTable
 
-		for offset <= limit {
+	main:
+		for offset < limit {
 			// find a match
 			var ref int
-			var hasMore bool
-			for hasMore = offset < matchLimit; hasMore; offset++ {
+			for {
+				if offset >= matchLimit {
+					break main
+				}
 				v := readInt(bytes, offset)
 				h := hash(v, hashLog)
-				ref = base + int(hashTable.Get(h))
-				assert(packed.BitsRequired(int64(offset-base)) <= hashTable.BitsPerValue())
-				hashTable.Set(h, int64(offset-base))
+				ref = base + hashTable[h]
+				hashTable[h] = offset - base
 				if offset-ref < MAX_DISTANCE && readInt(bytes, ref) == v {
 					break
 				}
-			}
-			if !hasMore {
-				break
+				offset++
 			}
 
 			// compute match length
@@ -1,8 +1,8 @@
 package compressing
 
 import (
-	"errors"
 	"fmt"
+	"github.com/balzaczyy/golucene/core/codec"
 )
 
 type CompressionMode interface {
@@ -71,7 +71,7 @@ func LZ4Decompressor(in DataInput, originalLength, offset, length int, bytes []b
 		return nil, err
 	}
 	if decompressedLength > originalLength {
-		return nil, errors.New(fmt.Sprintf("Corrupted: lengths mismatch: %v > %v (resource=%v)", decompressedLength, originalLength, in))
+		return nil, codec.NewCorruptIndexErrorAt(in, fmt.Sprintf("Corrupted: lengths mismatch: %v > %v", decompressedLength, originalLength))
 	}
 	return res[offset : offset+length], nil
 }
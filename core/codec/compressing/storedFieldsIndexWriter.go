@@ -1,6 +1,7 @@
 package compressing
 
 import (
+	"github.com/balzaczyy/golucene/core/codec"
 	"github.com/balzaczyy/golucene/core/store"
 	"github.com/balzaczyy/golucene/core/util/packed"
 	"math"
@@ -212,7 +213,7 @@ func (w *StoredFieldsIndexWriter) writeIndex(numDocs int, startPointer int64) er
 	return nil
 }
 
-func (w *StoredFieldsIndexWriter) finish(numDocs int) error {
+func (w *StoredFieldsIndexWriter) finish(numDocs int, maxPointer int64) error {
 	assert2(numDocs == w.totalDocs, "Expected %v docs, but got %v", numDocs, w.totalDocs)
 	if w.blockChunks > 0 {
 		err := w.writeBlock()
@@ -220,7 +221,13 @@ func (w *StoredFieldsIndexWriter) finish(numDocs int) error {
 			return err
 		}
 	}
-	return w.fieldsIndexOut.WriteVInt(0) // end marker
+	err := w.fieldsIndexOut.WriteVInt(0) // end marker
+	if err == nil {
+		if err = w.fieldsIndexOut.WriteVLong(maxPointer); err == nil {
+			err = codec.WriteFooter(w.fieldsIndexOut)
+		}
+	}
+	return err
 }
 
 func (w *StoredFieldsIndexWriter) Close() error {
@@ -1,6 +1,7 @@
 package compressing
 
 import (
+	"errors"
 	"fmt"
 	"github.com/balzaczyy/golucene/core/codec"
 	"github.com/balzaczyy/golucene/core/codec/lucene40"
@@ -8,15 +9,32 @@ import (
 	"github.com/balzaczyy/golucene/core/store"
 	"github.com/balzaczyy/golucene/core/util"
 	"github.com/balzaczyy/golucene/core/util/packed"
+	"math"
 )
 
 /* hard limit on the maximum number of documents per chunk */
 const MAX_DOCUMENTS_PER_CHUNK = 128
 
+const (
+	STRING         = 0x00
+	BYTE_ARR       = 0x01
+	NUMERIC_INT    = 0x02
+	NUMERIC_FLOAT  = 0x03
+	NUMERIC_LONG   = 0x04
+	NUMERIC_DOUBLE = 0x05
+)
+
+var (
+	TYPE_BITS = packed.BitsRequired(NUMERIC_DOUBLE)
+	TYPE_MASK = int(packed.MaxValue(TYPE_BITS))
+)
+
 const CODEC_SFX_IDX = "Index"
 const CODEC_SFX_DAT = "Data"
+const CP_VERSION_START = 0
 const CP_VERSION_BIG_CHUNKS = 1
-const CP_VERSION_CURRENT = CP_VERSION_BIG_CHUNKS
+const CP_VERSION_CHECKSUM = 2
+const CP_VERSION_CURRENT = CP_VERSION_CHECKSUM
 
 /* StoredFieldsWriter impl for CompressingStoredFieldsFormat */
 type CompressingStoredFieldsWriter struct {
@@ -30,11 +48,12 @@ type CompressingStoredFieldsWriter struct {
 	compressor      Compressor
 	chunkSize       int
 
-	bufferedDocs    *GrowableByteArrayDataOutput
-	numStoredFields []int // number of stored fields
-	endOffsets      []int // ned offsets in bufferedDocs
-	docBase         int   // doc ID at the beginning of the chunk
-	numBufferedDocs int   // docBase + numBufferedDocs == current doc ID
+	bufferedDocs         *GrowableByteArrayDataOutput
+	numStoredFields      []int // number of stored fields
+	endOffsets           []int // ned offsets in bufferedDocs
+	docBase              int   // doc ID at the beginning of the chunk
+	numBufferedDocs      int   // docBase + numBufferedDocs == current doc ID
+	numStoredFieldsInDoc int
 }
 
 func NewCompressingStoredFieldsWriter(dir store.Directory, si *model.SegmentInfo,
@@ -129,18 +148,22 @@ func (w *CompressingStoredFieldsWriter) Close() error {
 func (w *CompressingStoredFieldsWriter) StartDocument(numStoredFields int) error {
 	if w.numBufferedDocs == len(w.numStoredFields) {
 		newLength := util.Oversize(w.numBufferedDocs+1, 4)
-		oldArray := w.endOffsets
+		oldNumStoredFields, oldEndOffsets := w.numStoredFields, w.endOffsets
 		w.numStoredFields = make([]int, newLength)
 		w.endOffsets = make([]int, newLength)
-		copy(w.numStoredFields, oldArray)
-		copy(w.endOffsets, oldArray)
+		copy(w.numStoredFields, oldNumStoredFields)
+		copy(w.endOffsets, oldEndOffsets)
 	}
 	w.numStoredFields[w.numBufferedDocs] = numStoredFields
 	w.numBufferedDocs++
+	w.numStoredFieldsInDoc = 0
 	return nil
 }
 
 func (w *CompressingStoredFieldsWriter) FinishDocument() error {
+	assert2(w.numStoredFieldsInDoc == 0 || w.numStoredFieldsInDoc == w.numStoredFields[w.numBufferedDocs-1],
+		"wrote %v fields, but StartDocument was called with numStoredFields=%v",
+		w.numStoredFieldsInDoc, w.numStoredFields[w.numBufferedDocs-1])
 	w.endOffsets[w.numBufferedDocs-1] = w.bufferedDocs.length
 	if w.triggerFlush() {
 		return w.flush()
@@ -148,22 +171,131 @@ func (w *CompressingStoredFieldsWriter) FinishDocument() error {
 	return nil
 }
 
+/*
+Writes a single stored field of the current document. value must be
+one of string, []byte, int32, int64, float32 or float64; the type is
+recorded alongside the field number so that it can be restored on
+read.
+*/
+func (w *CompressingStoredFieldsWriter) WriteField(info model.FieldInfo, value interface{}) (err error) {
+	w.numStoredFieldsInDoc++
+
+	var bits int
+	switch value.(type) {
+	case string:
+		bits = STRING
+	case []byte:
+		bits = BYTE_ARR
+	case int32, int:
+		bits = NUMERIC_INT
+	case int64:
+		bits = NUMERIC_LONG
+	case float32:
+		bits = NUMERIC_FLOAT
+	case float64:
+		bits = NUMERIC_DOUBLE
+	default:
+		return errors.New(fmt.Sprintf(
+			"field %v is stored but does not have binaryValue, stringValue nor numericValue",
+			info.Name))
+	}
+
+	infoAndBits := (int64(info.Number) << uint(TYPE_BITS)) | int64(bits)
+	if err = w.bufferedDocs.WriteVLong(infoAndBits); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case string:
+		return w.bufferedDocs.WriteString(v)
+	case []byte:
+		if err = w.bufferedDocs.WriteVInt(int32(len(v))); err == nil {
+			err = w.bufferedDocs.WriteBytes(v)
+		}
+		return err
+	case int32:
+		return w.bufferedDocs.WriteInt(v)
+	case int:
+		return w.bufferedDocs.WriteInt(int32(v))
+	case int64:
+		return w.bufferedDocs.WriteLong(v)
+	case float32:
+		return w.bufferedDocs.WriteInt(int32(math.Float32bits(v)))
+	default:
+		return w.bufferedDocs.WriteLong(int64(math.Float64bits(value.(float64))))
+	}
+}
+
+// Returns the compression mode of this writer.
+func (w *CompressingStoredFieldsWriter) CompressionMode() CompressionMode {
+	return w.compressionMode
+}
+
+// Returns the minimum byte size of a chunk of this writer.
+func (w *CompressingStoredFieldsWriter) ChunkSize() int {
+	return w.chunkSize
+}
+
+// Returns the number of documents buffered in the current chunk.
+func (w *CompressingStoredFieldsWriter) NumBufferedDocs() int {
+	return w.numBufferedDocs
+}
+
+/*
+Adds a document whose stored fields are already serialized, as found
+in the decompressed chunk of another CompressingStoredFieldsWriter.
+Used when merging.
+*/
+func (w *CompressingStoredFieldsWriter) AddRawDocument(numStoredFields int, data []byte) error {
+	err := w.StartDocument(numStoredFields)
+	if err == nil {
+		if err = w.bufferedDocs.WriteBytes(data); err == nil {
+			err = w.FinishDocument()
+		}
+	}
+	return err
+}
+
+/*
+Copies an already compressed chunk of chunkDocs documents as is,
+reading length bytes of compressed data from in. The chunk must have
+been written by a writer with the same compression mode, and there
+must be no buffered documents. Used when merging.
+*/
+func (w *CompressingStoredFieldsWriter) CopyCompressedChunk(chunkDocs int,
+	numStoredFields, lengths []int, in util.DataInput, length int64) error {
+
+	assert(w.numBufferedDocs == 0)
+	err := w.indexWriter.writeIndex(chunkDocs, w.fieldsStream.FilePointer())
+	if err == nil {
+		if err = w.writeHeader(w.docBase, chunkDocs, numStoredFields, lengths); err == nil {
+			err = w.fieldsStream.CopyBytes(in, length)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	w.docBase += chunkDocs
+	return nil
+}
+
 func saveInts(values []int, length int, out DataOutput) error {
 	assert(length > 0)
 	if length == 1 {
 		return out.WriteVInt(int32(values[0]))
 	}
 
+	values = values[:length]
 	var allEqual = true
 	var sentinel = values[0]
-	for _, v := range values {
+	for _, v := range values[1:] {
 		if v != sentinel {
 			allEqual = false
 			break
 		}
 	}
 	if allEqual {
-		err := out.WriteInt(0)
+		err := out.WriteVInt(0)
 		if err == nil {
 			err = out.WriteVInt(int32(values[0]))
 		}
@@ -278,10 +410,13 @@ func (w *CompressingStoredFieldsWriter) Finish(fis model.FieldInfos, numDocs int
 	}
 	assert2(w.docBase == numDocs,
 		"Wrote %v docs, finish called with numDocs=%v", w.docBase, numDocs)
-	err := w.indexWriter.finish(numDocs)
+	err := w.indexWriter.finish(numDocs, w.fieldsStream.FilePointer())
 	if err != nil {
 		return err
 	}
+	if err = codec.WriteFooter(w.fieldsStream); err != nil {
+		return err
+	}
 	assert(w.bufferedDocs.length == 0)
 	return nil
 }
@@ -290,10 +425,35 @@ func (w *CompressingStoredFieldsWriter) Finish(fis model.FieldInfos, numDocs int
 
 /* A DataOutput that can be used to build a []byte */
 type GrowableByteArrayDataOutput struct {
+	*util.DataOutputImpl
 	bytes  []byte
 	length int
 }
 
 func newGrowableByteArrayDataOutput(cp int) *GrowableByteArrayDataOutput {
-	return &GrowableByteArrayDataOutput{make([]byte, 0, util.Oversize(cp, 1)), 0}
+	ans := &GrowableByteArrayDataOutput{bytes: make([]byte, util.Oversize(cp, 1))}
+	ans.DataOutputImpl = util.NewDataOutput(ans)
+	return ans
+}
+
+func (out *GrowableByteArrayDataOutput) grow(minSize int) {
+	if len(out.bytes) < minSize {
+		bytes := make([]byte, util.Oversize(minSize, 1))
+		copy(bytes, out.bytes[:out.length])
+		out.bytes = bytes
+	}
+}
+
+func (out *GrowableByteArrayDataOutput) WriteByte(b byte) error {
+	out.grow(out.length + 1)
+	out.bytes[out.length] = b
+	out.length++
+	return nil
+}
+
+func (out *GrowableByteArrayDataOutput) WriteBytes(buf []byte) error {
+	out.grow(out.length + len(buf))
+	copy(out.bytes[out.length:], buf)
+	out.length += len(buf)
+	return nil
 }
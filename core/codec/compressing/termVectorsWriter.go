@@ -0,0 +1,791 @@
+package compressing
+
+import (
+	"errors"
+	"fmt"
+	"github.com/balzaczyy/golucene/core/codec"
+	"github.com/balzaczyy/golucene/core/index/model"
+	"github.com/balzaczyy/golucene/core/store"
+	"github.com/balzaczyy/golucene/core/util"
+	"github.com/balzaczyy/golucene/core/util/packed"
+	"math"
+	"sort"
+)
+
+// codec/compressing/CompressingTermVectorsWriter.java
+
+const (
+	VECTORS_EXTENSION       = "tvd"
+	VECTORS_INDEX_EXTENSION = "tvx"
+
+	VECTORS_VERSION_START    = 0
+	VECTORS_VERSION_CHECKSUM = 1 // adds the codec footers
+	VECTORS_VERSION_CURRENT  = VECTORS_VERSION_CHECKSUM
+
+	VECTORS_BLOCK_SIZE = 64
+
+	VECTORS_POSITIONS = 0x01
+	VECTORS_OFFSETS   = 0x02
+	VECTORS_PAYLOADS  = 0x04
+)
+
+var VECTORS_FLAGS_BITS = packed.BitsRequired(VECTORS_POSITIONS | VECTORS_OFFSETS | VECTORS_PAYLOADS)
+
+/* a pending doc */
+type tvDocData struct {
+	numFields                    int
+	fields                       []*tvFieldData
+	posStart, offStart, payStart int
+}
+
+func (w *CompressingTermVectorsWriter) addField(doc *tvDocData, fieldNum, numTerms int,
+	positions, offsets, payloads bool) *tvFieldData {
+
+	posStart, offStart, payStart := doc.posStart, doc.offStart, doc.payStart
+	if n := len(doc.fields); n > 0 {
+		posStart, offStart, payStart = doc.fields[n-1].nextStarts()
+	}
+	field := w.newFieldData(fieldNum, numTerms, positions, offsets, payloads,
+		posStart, offStart, payStart)
+	doc.fields = append(doc.fields, field)
+	return field
+}
+
+func (w *CompressingTermVectorsWriter) addDocData(numVectorFields int) *tvDocData {
+	var last *tvFieldData
+	for i := len(w.pendingDocs) - 1; i >= 0; i-- {
+		if fields := w.pendingDocs[i].fields; len(fields) > 0 {
+			last = fields[len(fields)-1]
+			break
+		}
+	}
+	doc := &tvDocData{numFields: numVectorFields}
+	if last != nil {
+		doc.posStart, doc.offStart, doc.payStart = last.nextStarts()
+	}
+	w.pendingDocs = append(w.pendingDocs, doc)
+	return doc
+}
+
+/* a pending field */
+type tvFieldData struct {
+	owner                                 *CompressingTermVectorsWriter
+	hasPositions, hasOffsets, hasPayloads bool
+	fieldNum, flags, numTerms             int
+	freqs, prefixLengths, suffixLengths   []int
+	posStart, offStart, payStart          int
+	totalPositions                        int
+	ord                                   int
+}
+
+func (w *CompressingTermVectorsWriter) newFieldData(fieldNum, numTerms int,
+	positions, offsets, payloads bool, posStart, offStart, payStart int) *tvFieldData {
+
+	fd := &tvFieldData{
+		owner:         w,
+		fieldNum:      fieldNum,
+		numTerms:      numTerms,
+		hasPositions:  positions,
+		hasOffsets:    offsets,
+		hasPayloads:   payloads,
+		freqs:         make([]int, numTerms),
+		prefixLengths: make([]int, numTerms),
+		suffixLengths: make([]int, numTerms),
+		posStart:      posStart,
+		offStart:      offStart,
+		payStart:      payStart,
+	}
+	if positions {
+		fd.flags |= VECTORS_POSITIONS
+	}
+	if offsets {
+		fd.flags |= VECTORS_OFFSETS
+	}
+	if payloads {
+		fd.flags |= VECTORS_PAYLOADS
+	}
+	return fd
+}
+
+// Returns where the positions, offsets and payloads of the next field start.
+func (fd *tvFieldData) nextStarts() (posStart, offStart, payStart int) {
+	posStart, offStart, payStart = fd.posStart, fd.offStart, fd.payStart
+	if fd.hasPositions {
+		posStart += fd.totalPositions
+	}
+	if fd.hasOffsets {
+		offStart += fd.totalPositions
+	}
+	if fd.hasPayloads {
+		payStart += fd.totalPositions
+	}
+	return
+}
+
+func (fd *tvFieldData) addTerm(freq, prefixLength, suffixLength int) {
+	fd.freqs[fd.ord] = freq
+	fd.prefixLengths[fd.ord] = prefixLength
+	fd.suffixLengths[fd.ord] = suffixLength
+	fd.ord++
+}
+
+func (fd *tvFieldData) addPosition(position, startOffset, length, payloadLength int) {
+	w := fd.owner
+	if fd.hasPositions {
+		w.positionsBuf = growInts(w.positionsBuf, fd.posStart+fd.totalPositions+1)
+		w.positionsBuf[fd.posStart+fd.totalPositions] = position
+	}
+	if fd.hasOffsets {
+		w.startOffsetsBuf = growInts(w.startOffsetsBuf, fd.offStart+fd.totalPositions+1)
+		w.lengthsBuf = growInts(w.lengthsBuf, fd.offStart+fd.totalPositions+1)
+		w.startOffsetsBuf[fd.offStart+fd.totalPositions] = startOffset
+		w.lengthsBuf[fd.offStart+fd.totalPositions] = length
+	}
+	if fd.hasPayloads {
+		w.payloadLengthsBuf = growInts(w.payloadLengthsBuf, fd.payStart+fd.totalPositions+1)
+		w.payloadLengthsBuf[fd.payStart+fd.totalPositions] = payloadLength
+	}
+	fd.totalPositions++
+}
+
+func growInts(values []int, minSize int) []int {
+	if len(values) < minSize {
+		grown := make([]int, util.Oversize(minSize, 4))
+		copy(grown, values)
+		return grown
+	}
+	return values
+}
+
+/* TermVectorsWriter for CompressingTermVectorsFormat */
+type CompressingTermVectorsWriter struct {
+	directory     store.Directory
+	segment       string
+	segmentSuffix string
+	indexWriter   *StoredFieldsIndexWriter
+	vectorsStream store.IndexOutput
+
+	compressionMode CompressionMode
+	compressor      Compressor
+	chunkSize       int
+
+	numDocs     int          // total number of docs seen
+	pendingDocs []*tvDocData // pending docs
+	curDoc      *tvDocData   // current document
+	curField    *tvFieldData // current field
+	lastTerm    []byte
+
+	positionsBuf, startOffsetsBuf, lengthsBuf, payloadLengthsBuf []int
+
+	termSuffixes *GrowableByteArrayDataOutput // buffered term suffixes
+	payloadBytes *GrowableByteArrayDataOutput // buffered term payloads
+	writer       *packed.BlockPackedWriter
+}
+
+func NewCompressingTermVectorsWriter(dir store.Directory, si *model.SegmentInfo,
+	segmentSuffix string, ctx store.IOContext, formatName string,
+	compressionMode CompressionMode, chunkSize int) (*CompressingTermVectorsWriter, error) {
+
+	assert(dir != nil)
+	ans := &CompressingTermVectorsWriter{
+		directory:         dir,
+		segment:           si.Name,
+		segmentSuffix:     segmentSuffix,
+		compressionMode:   compressionMode,
+		compressor:        compressionMode.NewCompressor(),
+		chunkSize:         chunkSize,
+		termSuffixes:      newGrowableByteArrayDataOutput(chunkSize),
+		payloadBytes:      newGrowableByteArrayDataOutput(1),
+		lastTerm:          make([]byte, 0, util.Oversize(30, 1)),
+		positionsBuf:      make([]int, 1024),
+		startOffsetsBuf:   make([]int, 1024),
+		lengthsBuf:        make([]int, 1024),
+		payloadLengthsBuf: make([]int, 1024),
+	}
+
+	var success = false
+	indexStream, err := dir.CreateOutput(util.SegmentFileName(si.Name, segmentSuffix,
+		VECTORS_INDEX_EXTENSION), ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if !success {
+			util.CloseWhileSuppressingError(indexStream)
+			ans.Abort()
+		}
+	}()
+
+	ans.vectorsStream, err = dir.CreateOutput(util.SegmentFileName(si.Name, segmentSuffix,
+		VECTORS_EXTENSION), ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	codecNameIdx := formatName + CODEC_SFX_IDX
+	codecNameDat := formatName + CODEC_SFX_DAT
+	if err = codec.WriteHeader(indexStream, codecNameIdx, VECTORS_VERSION_CURRENT); err != nil {
+		return nil, err
+	}
+	if err = codec.WriteHeader(ans.vectorsStream, codecNameDat, VECTORS_VERSION_CURRENT); err != nil {
+		return nil, err
+	}
+	assert(int64(codec.HeaderLength(codecNameDat)) == ans.vectorsStream.FilePointer())
+	assert(int64(codec.HeaderLength(codecNameIdx)) == indexStream.FilePointer())
+
+	if ans.indexWriter, err = NewStoredFieldsIndexWriter(indexStream); err != nil {
+		return nil, err
+	}
+	indexStream = nil
+
+	if err = ans.vectorsStream.WriteVInt(packed.VERSION_CURRENT); err != nil {
+		return nil, err
+	}
+	if err = ans.vectorsStream.WriteVInt(int32(chunkSize)); err != nil {
+		return nil, err
+	}
+	ans.writer = packed.NewBlockPackedWriter(ans.vectorsStream, VECTORS_BLOCK_SIZE)
+
+	success = true
+	return ans, nil
+}
+
+func (w *CompressingTermVectorsWriter) Close() error {
+	defer func() {
+		w.vectorsStream = nil
+		w.indexWriter = nil
+	}()
+	return util.Close(w.vectorsStream, w.indexWriter)
+}
+
+func (w *CompressingTermVectorsWriter) Abort() {
+	util.CloseWhileSuppressingError(w)
+	util.DeleteFilesIgnoringErrors(w.directory,
+		util.SegmentFileName(w.segment, w.segmentSuffix, VECTORS_EXTENSION),
+		util.SegmentFileName(w.segment, w.segmentSuffix, VECTORS_INDEX_EXTENSION))
+}
+
+func (w *CompressingTermVectorsWriter) StartDocument(numVectorFields int) error {
+	w.curDoc = w.addDocData(numVectorFields)
+	return nil
+}
+
+func (w *CompressingTermVectorsWriter) FinishDocument() error {
+	// append the payload bytes of the doc after its terms
+	w.termSuffixes.WriteBytes(w.payloadBytes.bytes[:w.payloadBytes.length])
+	w.payloadBytes.length = 0
+	w.numDocs++
+	if w.triggerFlush() {
+		if err := w.flush(); err != nil {
+			return err
+		}
+	}
+	w.curDoc = nil
+	return nil
+}
+
+func (w *CompressingTermVectorsWriter) StartField(info model.FieldInfo, numTerms int,
+	positions, offsets, payloads bool) error {
+
+	w.curField = w.addField(w.curDoc, int(info.Number), numTerms, positions, offsets, payloads)
+	w.lastTerm = w.lastTerm[:0]
+	return nil
+}
+
+func (w *CompressingTermVectorsWriter) FinishField() error {
+	w.curField = nil
+	return nil
+}
+
+func (w *CompressingTermVectorsWriter) StartTerm(term []byte, freq int) error {
+	assert(freq >= 1)
+	prefix := bytesDifference(w.lastTerm, term)
+	w.curField.addTerm(freq, prefix, len(term)-prefix)
+	w.termSuffixes.WriteBytes(term[prefix:])
+	// copy last term
+	w.lastTerm = append(w.lastTerm[:0], term...)
+	return nil
+}
+
+func (w *CompressingTermVectorsWriter) FinishTerm() error {
+	return nil
+}
+
+func (w *CompressingTermVectorsWriter) AddPosition(position, startOffset, endOffset int,
+	payload []byte) error {
+
+	assert(w.curField.flags != 0)
+	w.curField.addPosition(position, startOffset, endOffset-startOffset, len(payload))
+	if w.curField.hasPayloads && len(payload) > 0 {
+		w.payloadBytes.WriteBytes(payload)
+	}
+	return nil
+}
+
+// Returns the length of the common prefix of two terms.
+func bytesDifference(left, right []byte) int {
+	n := len(left)
+	if len(right) < n {
+		n = len(right)
+	}
+	for i := 0; i < n; i++ {
+		if left[i] != right[i] {
+			return i
+		}
+	}
+	return n
+}
+
+func (w *CompressingTermVectorsWriter) triggerFlush() bool {
+	return w.termSuffixes.length >= w.chunkSize ||
+		len(w.pendingDocs) >= MAX_DOCUMENTS_PER_CHUNK
+}
+
+func (w *CompressingTermVectorsWriter) flush() error {
+	chunkDocs := len(w.pendingDocs)
+	assert2(chunkDocs > 0, "%v", chunkDocs)
+
+	// write the index file
+	err := w.indexWriter.writeIndex(chunkDocs, w.vectorsStream.FilePointer())
+	if err != nil {
+		return err
+	}
+
+	docBase := w.numDocs - chunkDocs
+	if err = w.vectorsStream.WriteVInt(int32(docBase)); err != nil {
+		return err
+	}
+	if err = w.vectorsStream.WriteVInt(int32(chunkDocs)); err != nil {
+		return err
+	}
+
+	// total number of fields of the chunk
+	totalFields, err := w.flushNumFields(chunkDocs)
+	if err != nil {
+		return err
+	}
+
+	if totalFields > 0 {
+		// unique field numbers (sorted)
+		fieldNums, err := w.flushFieldNums()
+		if err != nil {
+			return err
+		}
+		// offsets in the array of unique field numbers
+		if err = w.flushFields(totalFields, fieldNums); err != nil {
+			return err
+		}
+		// flags (does the field have positions, offsets, payloads?)
+		if err = w.flushFlags(totalFields, fieldNums); err != nil {
+			return err
+		}
+		// number of terms of each field
+		if err = w.flushNumTerms(totalFields); err != nil {
+			return err
+		}
+		// prefix and suffix lengths for each field
+		if err = w.flushTermLengths(); err != nil {
+			return err
+		}
+		// term freqs - 1 (because termFreq is always >=1) for each term
+		if err = w.flushTermFreqs(); err != nil {
+			return err
+		}
+		// positions for all terms, when enabled
+		if err = w.flushPositions(); err != nil {
+			return err
+		}
+		// offsets for all terms, when enabled
+		if err = w.flushOffsets(fieldNums); err != nil {
+			return err
+		}
+		// payload lengths for all terms, when enabled
+		if err = w.flushPayloadLengths(); err != nil {
+			return err
+		}
+
+		// compress terms and payloads and write them to the output
+		if err = w.compressor(w.termSuffixes.bytes[:w.termSuffixes.length], w.vectorsStream); err != nil {
+			return err
+		}
+	}
+
+	// reset
+	w.pendingDocs = w.pendingDocs[:0]
+	w.curDoc = nil
+	w.curField = nil
+	w.termSuffixes.length = 0
+	return nil
+}
+
+func (w *CompressingTermVectorsWriter) flushNumFields(chunkDocs int) (int, error) {
+	if chunkDocs == 1 {
+		numFields := w.pendingDocs[0].numFields
+		return numFields, w.vectorsStream.WriteVInt(int32(numFields))
+	}
+	w.writer.Reset(w.vectorsStream)
+	totalFields := 0
+	for _, dd := range w.pendingDocs {
+		if err := w.writer.Add(int64(dd.numFields)); err != nil {
+			return 0, err
+		}
+		totalFields += dd.numFields
+	}
+	return totalFields, w.writer.Finish()
+}
+
+// Returns a sorted array containing unique field numbers
+func (w *CompressingTermVectorsWriter) flushFieldNums() ([]int, error) {
+	seen := make(map[int]bool)
+	var fieldNums []int
+	for _, dd := range w.pendingDocs {
+		for _, fd := range dd.fields {
+			if !seen[fd.fieldNum] {
+				seen[fd.fieldNum] = true
+				fieldNums = append(fieldNums, fd.fieldNum)
+			}
+		}
+	}
+	sort.Ints(fieldNums)
+
+	numDistinctFields := len(fieldNums)
+	assert(numDistinctFields > 0)
+	bitsRequired := packed.BitsRequired(int64(fieldNums[numDistinctFields-1]))
+	token := (minInt(numDistinctFields-1, 0x07) << 5) | bitsRequired
+	err := w.vectorsStream.WriteByte(byte(token))
+	if err != nil {
+		return nil, err
+	}
+	if numDistinctFields-1 >= 0x07 {
+		if err = w.vectorsStream.WriteVInt(int32(numDistinctFields - 1 - 0x07)); err != nil {
+			return nil, err
+		}
+	}
+	writer := packed.WriterNoHeader(w.vectorsStream, packed.PackedFormat(packed.PACKED),
+		numDistinctFields, bitsRequired, 1)
+	for _, fieldNum := range fieldNums {
+		if err = writer.Add(int64(fieldNum)); err != nil {
+			return nil, err
+		}
+	}
+	return fieldNums, writer.Finish()
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func (w *CompressingTermVectorsWriter) flushFields(totalFields int, fieldNums []int) error {
+	writer := packed.WriterNoHeader(w.vectorsStream, packed.PackedFormat(packed.PACKED),
+		totalFields, packed.BitsRequired(int64(len(fieldNums)-1)), 1)
+	for _, dd := range w.pendingDocs {
+		for _, fd := range dd.fields {
+			fieldNumIndex := sort.SearchInts(fieldNums, fd.fieldNum)
+			assert(fieldNumIndex < len(fieldNums) && fieldNums[fieldNumIndex] == fd.fieldNum)
+			if err := writer.Add(int64(fieldNumIndex)); err != nil {
+				return err
+			}
+		}
+	}
+	return writer.Finish()
+}
+
+func (w *CompressingTermVectorsWriter) flushFlags(totalFields int, fieldNums []int) error {
+	// check if fields always have the same flags
+	nonChangingFlags := true
+	fieldFlags := make([]int, len(fieldNums))
+	for i, _ := range fieldFlags {
+		fieldFlags[i] = -1
+	}
+outer:
+	for _, dd := range w.pendingDocs {
+		for _, fd := range dd.fields {
+			fieldNumOff := sort.SearchInts(fieldNums, fd.fieldNum)
+			if fieldFlags[fieldNumOff] == -1 {
+				fieldFlags[fieldNumOff] = fd.flags
+			} else if fieldFlags[fieldNumOff] != fd.flags {
+				nonChangingFlags = false
+				break outer
+			}
+		}
+	}
+
+	if nonChangingFlags {
+		// write one flag per field num
+		err := w.vectorsStream.WriteVInt(0)
+		if err != nil {
+			return err
+		}
+		writer := packed.WriterNoHeader(w.vectorsStream, packed.PackedFormat(packed.PACKED),
+			len(fieldFlags), VECTORS_FLAGS_BITS, 1)
+		for _, flags := range fieldFlags {
+			assert(flags >= 0)
+			if err = writer.Add(int64(flags)); err != nil {
+				return err
+			}
+		}
+		return writer.Finish()
+	}
+
+	// write one flag for every field instance
+	err := w.vectorsStream.WriteVInt(1)
+	if err != nil {
+		return err
+	}
+	writer := packed.WriterNoHeader(w.vectorsStream, packed.PackedFormat(packed.PACKED),
+		totalFields, VECTORS_FLAGS_BITS, 1)
+	for _, dd := range w.pendingDocs {
+		for _, fd := range dd.fields {
+			if err = writer.Add(int64(fd.flags)); err != nil {
+				return err
+			}
+		}
+	}
+	return writer.Finish()
+}
+
+func (w *CompressingTermVectorsWriter) flushNumTerms(totalFields int) error {
+	maxNumTerms := 0
+	for _, dd := range w.pendingDocs {
+		for _, fd := range dd.fields {
+			maxNumTerms |= fd.numTerms
+		}
+	}
+	bitsRequired := packed.BitsRequired(int64(maxNumTerms))
+	err := w.vectorsStream.WriteVInt(int32(bitsRequired))
+	if err != nil {
+		return err
+	}
+	writer := packed.WriterNoHeader(w.vectorsStream, packed.PackedFormat(packed.PACKED),
+		totalFields, bitsRequired, 1)
+	for _, dd := range w.pendingDocs {
+		for _, fd := range dd.fields {
+			if err = writer.Add(int64(fd.numTerms)); err != nil {
+				return err
+			}
+		}
+	}
+	return writer.Finish()
+}
+
+// Writes the values returned by f for every term of every pending
+// field, using blocks of packed ints.
+func (w *CompressingTermVectorsWriter) flushPerTerm(f func(fd *tvFieldData, i int) int) error {
+	w.writer.Reset(w.vectorsStream)
+	for _, dd := range w.pendingDocs {
+		for _, fd := range dd.fields {
+			for i := 0; i < fd.numTerms; i++ {
+				if err := w.writer.Add(int64(f(fd, i))); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return w.writer.Finish()
+}
+
+func (w *CompressingTermVectorsWriter) flushTermLengths() error {
+	err := w.flushPerTerm(func(fd *tvFieldData, i int) int { return fd.prefixLengths[i] })
+	if err == nil {
+		err = w.flushPerTerm(func(fd *tvFieldData, i int) int { return fd.suffixLengths[i] })
+	}
+	return err
+}
+
+func (w *CompressingTermVectorsWriter) flushTermFreqs() error {
+	return w.flushPerTerm(func(fd *tvFieldData, i int) int { return fd.freqs[i] - 1 })
+}
+
+func (w *CompressingTermVectorsWriter) flushPositions() error {
+	w.writer.Reset(w.vectorsStream)
+	for _, dd := range w.pendingDocs {
+		for _, fd := range dd.fields {
+			if fd.hasPositions {
+				pos := 0
+				for i := 0; i < fd.numTerms; i++ {
+					previousPosition := 0
+					for j := 0; j < fd.freqs[i]; j++ {
+						position := w.positionsBuf[fd.posStart+pos]
+						pos++
+						if err := w.writer.Add(int64(position - previousPosition)); err != nil {
+							return err
+						}
+						previousPosition = position
+					}
+				}
+				assert(pos == fd.totalPositions)
+			}
+		}
+	}
+	return w.writer.Finish()
+}
+
+func (w *CompressingTermVectorsWriter) flushOffsets(fieldNums []int) error {
+	hasOffsets := false
+	sumPos := make([]int64, len(fieldNums))
+	sumOffsets := make([]int64, len(fieldNums))
+	for _, dd := range w.pendingDocs {
+		for _, fd := range dd.fields {
+			hasOffsets = hasOffsets || fd.hasOffsets
+			if fd.hasOffsets && fd.hasPositions {
+				fieldNumOff := sort.SearchInts(fieldNums, fd.fieldNum)
+				pos := 0
+				for i := 0; i < fd.numTerms; i++ {
+					previousPos, previousOff := 0, 0
+					for j := 0; j < fd.freqs[i]; j++ {
+						position := w.positionsBuf[fd.posStart+pos]
+						startOffset := w.startOffsetsBuf[fd.offStart+pos]
+						sumPos[fieldNumOff] += int64(position - previousPos)
+						sumOffsets[fieldNumOff] += int64(startOffset - previousOff)
+						previousPos, previousOff = position, startOffset
+						pos++
+					}
+				}
+				assert(pos == fd.totalPositions)
+			}
+		}
+	}
+
+	if !hasOffsets {
+		// nothing to do
+		return nil
+	}
+
+	charsPerTerm := make([]float32, len(fieldNums))
+	for i, _ := range fieldNums {
+		if sumPos[i] > 0 && sumOffsets[i] > 0 {
+			charsPerTerm[i] = float32(float64(sumOffsets[i]) / float64(sumPos[i]))
+		}
+	}
+
+	// start offsets
+	for _, cpt := range charsPerTerm {
+		if err := w.vectorsStream.WriteInt(int32(math.Float32bits(cpt))); err != nil {
+			return err
+		}
+	}
+
+	w.writer.Reset(w.vectorsStream)
+	for _, dd := range w.pendingDocs {
+		for _, fd := range dd.fields {
+			if (fd.flags & VECTORS_OFFSETS) != 0 {
+				cpt := charsPerTerm[sort.SearchInts(fieldNums, fd.fieldNum)]
+				pos := 0
+				for i := 0; i < fd.numTerms; i++ {
+					previousPos, previousOff := 0, 0
+					for j := 0; j < fd.freqs[i]; j++ {
+						position := 0
+						if fd.hasPositions {
+							position = w.positionsBuf[fd.posStart+pos]
+						}
+						startOffset := w.startOffsetsBuf[fd.offStart+pos]
+						if err := w.writer.Add(int64(startOffset - previousOff -
+							int(cpt*float32(position-previousPos)))); err != nil {
+							return err
+						}
+						previousPos, previousOff = position, startOffset
+						pos++
+					}
+				}
+			}
+		}
+	}
+	if err := w.writer.Finish(); err != nil {
+		return err
+	}
+
+	// lengths
+	w.writer.Reset(w.vectorsStream)
+	for _, dd := range w.pendingDocs {
+		for _, fd := range dd.fields {
+			if (fd.flags & VECTORS_OFFSETS) != 0 {
+				pos := 0
+				for i := 0; i < fd.numTerms; i++ {
+					for j := 0; j < fd.freqs[i]; j++ {
+						if err := w.writer.Add(int64(w.lengthsBuf[fd.offStart+pos] -
+							fd.prefixLengths[i] - fd.suffixLengths[i])); err != nil {
+							return err
+						}
+						pos++
+					}
+				}
+				assert(pos == fd.totalPositions)
+			}
+		}
+	}
+	return w.writer.Finish()
+}
+
+func (w *CompressingTermVectorsWriter) flushPayloadLengths() error {
+	w.writer.Reset(w.vectorsStream)
+	for _, dd := range w.pendingDocs {
+		for _, fd := range dd.fields {
+			if fd.hasPayloads {
+				for i := 0; i < fd.totalPositions; i++ {
+					if err := w.writer.Add(int64(w.payloadLengthsBuf[fd.payStart+i])); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return w.writer.Finish()
+}
+
+func (w *CompressingTermVectorsWriter) Finish(fis model.FieldInfos, numDocs int) error {
+	if len(w.pendingDocs) > 0 {
+		if err := w.flush(); err != nil {
+			return err
+		}
+	}
+	if numDocs != w.numDocs {
+		return errors.New(fmt.Sprintf(
+			"Wrote %v docs, finish called with numDocs=%v", w.numDocs, numDocs))
+	}
+	if err := w.indexWriter.finish(numDocs, w.vectorsStream.FilePointer()); err != nil {
+		return err
+	}
+	return codec.WriteFooter(w.vectorsStream)
+}
+
+// Returns the compression mode of this writer.
+func (w *CompressingTermVectorsWriter) CompressionMode() CompressionMode {
+	return w.compressionMode
+}
+
+// Returns the minimum byte size of a chunk of this writer.
+func (w *CompressingTermVectorsWriter) ChunkSize() int {
+	return w.chunkSize
+}
+
+// Returns the number of documents buffered in the current chunk.
+func (w *CompressingTermVectorsWriter) NumBufferedDocs() int {
+	return len(w.pendingDocs)
+}
+
+/*
+Copies a chunk of chunkDocs documents as is, reading length bytes
+from in, which must be positioned right after the doc base and the
+number of documents of the chunk. The chunk must have been written
+with the same compression mode, chunk size and packed ints version,
+and there must be no buffered documents. Used when merging.
+*/
+func (w *CompressingTermVectorsWriter) CopyChunk(chunkDocs int, in util.DataInput, length int64) error {
+	assert(len(w.pendingDocs) == 0)
+	err := w.indexWriter.writeIndex(chunkDocs, w.vectorsStream.FilePointer())
+	if err == nil {
+		if err = w.vectorsStream.WriteVInt(int32(w.numDocs)); err == nil {
+			if err = w.vectorsStream.WriteVInt(int32(chunkDocs)); err == nil {
+				err = w.vectorsStream.CopyBytes(in, length)
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	w.numDocs += chunkDocs
+	return nil
+}
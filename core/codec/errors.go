@@ -0,0 +1,115 @@
+package codec
+
+import (
+	"fmt"
+)
+
+/*
+Returns the description of the resource being read, and the current
+position in it, or -1 if the resource has no notion of position.
+*/
+func describe(in interface{}) (resource string, fp int64) {
+	if in == nil {
+		return "", -1
+	}
+	if input, ok := in.(interface {
+		FilePointer() int64
+	}); ok {
+		return fmt.Sprintf("%v", in), input.FilePointer()
+	}
+	return fmt.Sprintf("%v", in), -1
+}
+
+func formatResource(resource string, fp int64) string {
+	if fp >= 0 {
+		return fmt.Sprintf("(resource=%v, fp=%v)", resource, fp)
+	}
+	return fmt.Sprintf("(resource=%v)", resource)
+}
+
+// index/CorruptIndexException.java
+
+/*
+This error is returned when an inconsistency in the index is
+detected, e.g. a checksum mismatch or a header that doesn't belong to
+the file being read. Callers can detect it with errors.As() and
+decide whether to re-sync the index from a good copy.
+*/
+type CorruptIndexError struct {
+	Msg string
+	// Description of the input being read, if known.
+	Resource string
+	// Position in the input where the corruption was detected, or -1
+	// if unknown.
+	FilePointer int64
+}
+
+func NewCorruptIndexError(msg string) *CorruptIndexError {
+	return &CorruptIndexError{Msg: msg, FilePointer: -1}
+}
+
+/* Creates a CorruptIndexError describing the current state of in. */
+func NewCorruptIndexErrorAt(in interface{}, msg string) *CorruptIndexError {
+	resource, fp := describe(in)
+	return &CorruptIndexError{msg, resource, fp}
+}
+
+func (err *CorruptIndexError) Error() string {
+	if err.Resource == "" {
+		return err.Msg
+	}
+	return fmt.Sprintf("%v %v", err.Msg, formatResource(err.Resource, err.FilePointer))
+}
+
+// index/IndexFormatTooOldException.java
+
+/*
+This error is returned when this version of Lucene cannot read an
+index written by an older version. The index needs to be upgraded
+before it can be opened.
+*/
+type IndexFormatTooOldError struct {
+	// Description of the input being read.
+	Resource string
+	// Position in the input right after the version, or -1 if unknown.
+	FilePointer int64
+	// The version found in the index, and the range supported.
+	Version, MinVersion, MaxVersion int32
+}
+
+func NewIndexFormatTooOldError(in DataInput, version, minVersion, maxVersion int32) *IndexFormatTooOldError {
+	resource, fp := describe(in)
+	return &IndexFormatTooOldError{resource, fp, version, minVersion, maxVersion}
+}
+
+func (err *IndexFormatTooOldError) Error() string {
+	return fmt.Sprintf(
+		"Format version is not supported %v: %v (needs to be between %v and %v). This version of Lucene only supports indexes created with release 4.0 and later.",
+		formatResource(err.Resource, err.FilePointer), err.Version, err.MinVersion, err.MaxVersion)
+}
+
+// index/IndexFormatTooNewException.java
+
+/*
+This error is returned when this version of Lucene cannot read an
+index written by a newer version.
+*/
+type IndexFormatTooNewError struct {
+	// Description of the input being read.
+	Resource string
+	// Position in the input right after the version, or -1 if unknown.
+	FilePointer int64
+	// The version found in the index, and the range supported.
+	Version, MinVersion, MaxVersion int32
+}
+
+func NewIndexFormatTooNewError(in DataInput, version, minVersion, maxVersion int32) *IndexFormatTooNewError {
+	resource, fp := describe(in)
+	return &IndexFormatTooNewError{resource, fp, version, minVersion, maxVersion}
+}
+
+func (err *IndexFormatTooNewError) Error() string {
+	return fmt.Sprintf(
+		"Format version is not supported %v: %v (needs to be between %v and %v)",
+		formatResource(err.Resource, err.FilePointer), err.Version, err.MinVersion, err.MaxVersion)
+}
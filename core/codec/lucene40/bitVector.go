@@ -2,12 +2,43 @@ package lucene40
 
 import (
 	"fmt"
+	"github.com/balzaczyy/golucene/core/codec"
+	"github.com/balzaczyy/golucene/core/store"
+	"github.com/balzaczyy/golucene/core/util"
+	"math/bits"
 )
 
+// codecs/lucene40/BitVector.java
+
+const (
+	BIT_VECTOR_CODEC = "BitVector"
+
+	// Version before version tracking was added:
+	BIT_VECTOR_VERSION_PRE = -1
+	// First version:
+	BIT_VECTOR_VERSION_START = 0
+	// Changed DGaps to encode gaps between cleared bits, not set:
+	BIT_VECTOR_VERSION_DGAPS_CLEARED = 1
+	// Added the codec footer
+	BIT_VECTOR_VERSION_CHECKSUM = 2
+	// Current version
+	BIT_VECTOR_VERSION_CURRENT = BIT_VECTOR_VERSION_CHECKSUM
+)
+
+/*
+Optimized implementation of a vector of bits. This is more-or-less
+like java.util.BitSet, but also includes the following:
+
+- a count() method, which efficiently computes the number of one bits;
+- optimized read from and write to disk;
+- inlinable get() method;
+- store and load, as bit set or d-gaps, depending on sparseness;
+*/
 type BitVector struct {
-	bits  []byte
-	size  int
-	count int
+	bits    []byte
+	size    int
+	count   int
+	version int
 }
 
 func NewBitVector(n int) *BitVector {
@@ -25,6 +56,17 @@ func numBytes(size int) int {
 	return bytesLength
 }
 
+func (bv *BitVector) Clone() *BitVector {
+	copyBits := make([]byte, len(bv.bits))
+	copy(copyBits, bv.bits)
+	return &BitVector{
+		bits:    copyBits,
+		size:    bv.size,
+		count:   bv.count,
+		version: bv.version,
+	}
+}
+
 func (bv *BitVector) Clear(bit int) {
 	assert2(bit >= 0 && bit < bv.size, "bit %v is out of bounds 0..%v", bit, bv.size-1)
 	bv.bits[bit>>3] &= ^(1 << (uint(bit) & 7))
@@ -46,6 +88,33 @@ func (bv *BitVector) Length() int {
 	return bv.size
 }
 
+/*
+Returns the total number of one bits in this vector. This is
+efficiently computed and cached, so that, if the vector is not
+changed, no recomputation is done for repeated calls.
+*/
+func (bv *BitVector) Count() int {
+	// if the vector has been modified
+	if bv.count == -1 {
+		c := 0
+		for _, b := range bv.bits {
+			c += bits.OnesCount8(b) // sum bits per byte
+		}
+		bv.count = c
+	}
+	assert2(bv.count <= bv.size, "count=%v size=%v", bv.count, bv.size)
+	return bv.count
+}
+
+/* For testing */
+func (bv *BitVector) RecomputedCount() int {
+	c := 0
+	for _, b := range bv.bits {
+		c += bits.OnesCount8(b)
+	}
+	return c
+}
+
 /* Invert all bits */
 func (bv *BitVector) InvertAll() {
 	if bv.count != -1 {
@@ -55,5 +124,290 @@ func (bv *BitVector) InvertAll() {
 		for idx, v := range bv.bits {
 			bv.bits[idx] = byte(^v)
 		}
+		bv.clearUnusedBits()
+	}
+}
+
+func (bv *BitVector) clearUnusedBits() {
+	// Take care not to invert the "unused" bits in the last byte:
+	if len(bv.bits) > 0 {
+		if lastNBits := uint(bv.size) & 7; lastNBits != 0 {
+			mask := byte((1 << lastNBits) - 1)
+			bv.bits[len(bv.bits)-1] &= mask
+		}
+	}
+}
+
+/*
+Writes this vector to the file name in Directory d, in a format that
+can be read by the constructor NewBitVectorFrom().
+*/
+func (bv *BitVector) Write(d store.Directory, name string, ctx store.IOContext) (err error) {
+	output, err := d.CreateOutput(name, ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := output.Close()
+		if err == nil {
+			err = err2
+		}
+	}()
+
+	if err = output.WriteInt(-2); err != nil {
+		return err
+	}
+	if err = codec.WriteHeader(output, BIT_VECTOR_CODEC, BIT_VECTOR_VERSION_CURRENT); err != nil {
+		return err
+	}
+	if bv.isSparse() {
+		// sparse bit-set more efficiently saved as d-gaps.
+		err = bv.writeClearedDgaps(output)
+	} else {
+		err = bv.writeBits(output)
+	}
+	if err == nil {
+		err = codec.WriteFooter(output)
+	}
+	if err != nil {
+		return err
+	}
+	assert2(bv.verifyCount(), "count is inconsistent")
+	return nil
+}
+
+/* Write as a bit set */
+func (bv *BitVector) writeBits(output store.IndexOutput) (err error) {
+	if err = output.WriteInt(int32(bv.size)); err == nil {
+		if err = output.WriteInt(int32(bv.Count())); err == nil {
+			err = output.WriteBytes(bv.bits)
+		}
+	}
+	return
+}
+
+/* Write as a d-gaps list */
+func (bv *BitVector) writeClearedDgaps(output store.IndexOutput) error {
+	// mark using d-gaps
+	if err := output.WriteInt(-1); err != nil {
+		return err
+	}
+	if err := output.WriteInt(int32(bv.size)); err != nil {
+		return err
+	}
+	if err := output.WriteInt(int32(bv.Count())); err != nil {
+		return err
+	}
+	last := 0
+	numCleared := bv.size - bv.Count()
+	for i, b := range bv.bits {
+		if numCleared <= 0 {
+			break
+		}
+		if b != 0xff {
+			if err := output.WriteVInt(int32(i - last)); err != nil {
+				return err
+			}
+			if err := output.WriteByte(b); err != nil {
+				return err
+			}
+			last = i
+			numCleared -= (8 - bits.OnesCount8(b))
+			assert2(numCleared >= 0 ||
+				(i == len(bv.bits)-1 && numCleared == -(8-(bv.size&7))),
+				"numCleared=%v", numCleared)
+		}
+	}
+	return nil
+}
+
+/*
+Indicates if the bit vector is sparse and should be saved as a d-gaps
+list, or dense, and should be saved as a bit set.
+*/
+func (bv *BitVector) isSparse() bool {
+	clearedCount := bv.size - bv.Count()
+	if clearedCount == 0 {
+		return true
+	}
+
+	avgGapLength := len(bv.bits) / clearedCount
+
+	// expected number of bytes for vInt encoding of each gap
+	var expectedDGapBytes int
+	switch {
+	case avgGapLength <= (1 << 7):
+		expectedDGapBytes = 1
+	case avgGapLength <= (1 << 14):
+		expectedDGapBytes = 2
+	case avgGapLength <= (1 << 21):
+		expectedDGapBytes = 3
+	case avgGapLength <= (1 << 28):
+		expectedDGapBytes = 4
+	default:
+		expectedDGapBytes = 5
+	}
+
+	// +1 because we write the byte itself that contains the set bit
+	bytesPerSetBit := expectedDGapBytes + 1
+
+	// note: adding 32 because we start with ((int) -1) to indicate d-gaps format.
+	expectedBits := int64(32 + 8*bytesPerSetBit*clearedCount)
+
+	// note: factor is for read/write of byte-arrays being faster than vints.
+	const factor = 10
+	return factor*expectedBits < int64(bv.size)
+}
+
+/*
+Constructs a bit vector from the file name in Directory d, as written
+by the Write() method.
+*/
+func NewBitVectorFrom(d store.Directory, name string, ctx store.IOContext) (bv *BitVector, err error) {
+	main, err := d.OpenInput(name, ctx)
+	if err != nil {
+		return nil, err
+	}
+	input := store.NewChecksumIndexInput(main)
+	defer func() {
+		err2 := input.Close()
+		if err == nil {
+			err = err2
+		}
+	}()
+
+	bv = new(BitVector)
+	firstInt, err := input.ReadInt()
+	if err != nil {
+		return nil, err
+	}
+	if firstInt == -2 {
+		// New format, with full header & version:
+		version, err := codec.CheckHeader(input, BIT_VECTOR_CODEC,
+			BIT_VECTOR_VERSION_START, BIT_VECTOR_VERSION_CURRENT)
+		if err != nil {
+			return nil, err
+		}
+		bv.version = int(version)
+		size, err := input.ReadInt()
+		if err != nil {
+			return nil, err
+		}
+		bv.size = int(size)
+	} else {
+		bv.version = BIT_VECTOR_VERSION_PRE
+		bv.size = int(firstInt)
+	}
+	if bv.size == -1 {
+		if bv.version >= BIT_VECTOR_VERSION_DGAPS_CLEARED {
+			err = bv.readClearedDgaps(input)
+		} else {
+			err = bv.readSetDgaps(input)
+		}
+	} else {
+		err = bv.readBits(input)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if bv.version >= BIT_VECTOR_VERSION_CHECKSUM {
+		if _, err = codec.CheckFooter(input); err != nil {
+			return nil, err
+		}
+	}
+
+	if bv.version < BIT_VECTOR_VERSION_DGAPS_CLEARED {
+		bv.InvertAll()
+	}
+
+	if !bv.verifyCount() {
+		return nil, codec.NewCorruptIndexErrorAt(input, fmt.Sprintf(
+			"BitVector count is inconsistent: %v vs recomputed %v",
+			bv.count, bv.RecomputedCount()))
+	}
+	return bv, nil
+}
+
+func (bv *BitVector) verifyCount() bool {
+	assert2(bv.count != -1, "count must be computed")
+	countSav := bv.count
+	bv.count = -1
+	ok := countSav == bv.Count()
+	bv.count = countSav
+	return ok
+}
+
+/* Read as a bit set */
+func (bv *BitVector) readBits(input util.DataInput) error {
+	count, err := input.ReadInt()
+	if err != nil {
+		return err
+	}
+	bv.count = int(count)
+	bv.bits = make([]byte, numBytes(bv.size))
+	return input.ReadBytes(bv.bits)
+}
+
+/* Read as a d-gaps list */
+func (bv *BitVector) readSetDgaps(input util.DataInput) error {
+	if err := bv.readSizeAndCount(input); err != nil {
+		return err
+	}
+	bv.bits = make([]byte, numBytes(bv.size))
+	last := 0
+	for n := bv.Count(); n > 0; {
+		gap, err := input.ReadVInt()
+		if err != nil {
+			return err
+		}
+		last += int(gap)
+		if bv.bits[last], err = input.ReadByte(); err != nil {
+			return err
+		}
+		n -= bits.OnesCount8(bv.bits[last])
+		assert2(n >= 0, "n=%v", n)
+	}
+	return nil
+}
+
+/* Read as a d-gaps cleared bits list */
+func (bv *BitVector) readClearedDgaps(input util.DataInput) error {
+	if err := bv.readSizeAndCount(input); err != nil {
+		return err
+	}
+	bv.bits = make([]byte, numBytes(bv.size))
+	for i, _ := range bv.bits {
+		bv.bits[i] = 0xff
+	}
+	bv.clearUnusedBits()
+	last := 0
+	for numCleared := bv.size - bv.Count(); numCleared > 0; {
+		gap, err := input.ReadVInt()
+		if err != nil {
+			return err
+		}
+		last += int(gap)
+		if bv.bits[last], err = input.ReadByte(); err != nil {
+			return err
+		}
+		numCleared -= 8 - bits.OnesCount8(bv.bits[last])
+		assert2(numCleared >= 0 ||
+			(last == len(bv.bits)-1 && numCleared == -(8-(bv.size&7))),
+			"numCleared=%v", numCleared)
+	}
+	return nil
+}
+
+func (bv *BitVector) readSizeAndCount(input util.DataInput) error {
+	size, err := input.ReadInt() // (re)read size
+	if err != nil {
+		return err
+	}
+	count, err := input.ReadInt() // read count
+	if err != nil {
+		return err
 	}
+	bv.size, bv.count = int(size), int(count)
+	return nil
 }
@@ -0,0 +1,36 @@
+package lucene40
+
+import (
+	"github.com/balzaczyy/golucene/core/store"
+	"testing"
+)
+
+func TestBitVectorWriteRead(t *testing.T) {
+	for _, size := range []int{8, 31, 1000, 10000} {
+		d := store.NewRAMDirectory()
+		bv := NewBitVector(size)
+		bv.InvertAll()
+		// delete a few docs so that sparse vectors are written as dgaps
+		for i := 0; i < size; i += 97 {
+			bv.Clear(i)
+		}
+		if err := bv.Write(d, "_0_1.del", store.IO_CONTEXT_DEFAULT); err != nil {
+			t.Fatal(err)
+		}
+		bv2, err := NewBitVectorFrom(d, "_0_1.del", store.IO_CONTEXT_READONCE)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bv2.Length() != size {
+			t.Errorf("size=%v: length mismatch %v", size, bv2.Length())
+		}
+		if bv2.Count() != bv.Count() {
+			t.Errorf("size=%v: count %v, expected %v", size, bv2.Count(), bv.Count())
+		}
+		for i := 0; i < size; i++ {
+			if bv.At(i) != bv2.At(i) {
+				t.Fatalf("size=%v: bit %v mismatch", size, i)
+			}
+		}
+	}
+}
@@ -1,14 +1,18 @@
 package codec
 
 import (
-	"errors"
 	"fmt"
+	"hash/crc32"
 )
 
 // codecs/CodecUtil.java
 
-/* Constant to identify the start of a codec header */
-const CODEC_MAGIC = 0x3fd76c17
+const (
+	/* Constant to identify the start of a codec header */
+	CODEC_MAGIC = 0x3fd76c17
+	/* Constant to identify the start of a codec footer */
+	FOOTER_MAGIC = ^CODEC_MAGIC
+)
 
 type DataOutput interface {
 	WriteInt(n int32) error
@@ -72,9 +76,9 @@ func CheckHeader(in DataInput, codec string, minVersion, maxVersion int32) (v in
 		return 0, err
 	}
 	if actualHeader != CODEC_MAGIC {
-		return 0, errors.New(fmt.Sprintf(
-			"codec header mismatch: actual header=%v vs expected header=%v (resource: %v)",
-			actualHeader, CODEC_MAGIC, in))
+		return 0, NewCorruptIndexErrorAt(in, fmt.Sprintf(
+			"codec header mismatch: actual header=%v vs expected header=%v",
+			actualHeader, CODEC_MAGIC))
 	}
 	return CheckHeaderNoMagic(in, codec, minVersion, maxVersion)
 }
@@ -85,8 +89,8 @@ func CheckHeaderNoMagic(in DataInput, codec string, minVersion, maxVersion int32
 		return 0, err
 	}
 	if actualCodec != codec {
-		return 0, errors.New(fmt.Sprintf(
-			"codec mismatch: actual codec=%v vs expected codec=%v (resource: %v)", actualCodec, codec, in))
+		return 0, NewCorruptIndexErrorAt(in, fmt.Sprintf(
+			"codec mismatch: actual codec=%v vs expected codec=%v", actualCodec, codec))
 	}
 
 	actualVersion, err := in.ReadInt()
@@ -103,14 +107,192 @@ func CheckHeaderNoMagic(in DataInput, codec string, minVersion, maxVersion int32
 	return actualVersion, nil
 }
 
-func NewIndexFormatTooNewError(in DataInput, version, minVersion, maxVersion int32) error {
-	return errors.New(fmt.Sprintf(
-		"Format version is not supported (resource: %v): %v (needs to be between %v and %v)",
-		in, version, minVersion, maxVersion))
+/* Output that keeps a checksum of the bytes written so far. */
+type ChecksumOutput interface {
+	DataOutput
+	WriteLong(n int64) error
+	Checksum() int64
+}
+
+/*
+Writes a codec footer, which records both a checksum algorithm ID and
+a checksum. This footer can be parsed and validated with
+CheckFooter().
+
+CodecFooter --> Magic,AlgorithmID,Checksum
+	Magic --> uint32. This identifies the start of the footer. It is
+	always FOOTER_MAGIC.
+	AlgorithmID --> uint32. This indicates the checksum algorithm
+	used. Currently this is always 0, for zlib-crc32.
+	Checksum --> uint64. The actual checksum value for all previous
+	bytes in the stream, including the bytes from Magic and
+	AlgorithmID.
+*/
+func WriteFooter(out ChecksumOutput) error {
+	err := out.WriteInt(FOOTER_MAGIC)
+	if err == nil {
+		if err = out.WriteInt(0); err == nil {
+			err = out.WriteLong(out.Checksum())
+		}
+	}
+	return err
+}
+
+/* Computes the length of a codec footer. */
+func FooterLength() int {
+	return 16
+}
+
+/* Input that keeps a checksum of the bytes read so far. */
+type ChecksumInput interface {
+	DataInput
+	ReadLong() (int64, error)
+	FilePointer() int64
+	Length() int64
+	Checksum() int64
+}
+
+/*
+Validates the codec footer previously written by WriteFooter().
+Returns the actual checksum value.
+*/
+func CheckFooter(in ChecksumInput) (int64, error) {
+	if err := validateFooter(in); err != nil {
+		return 0, err
+	}
+	actualChecksum := in.Checksum()
+	expectedChecksum, err := in.ReadLong()
+	if err != nil {
+		return 0, err
+	}
+	if expectedChecksum != actualChecksum {
+		return 0, NewCorruptIndexErrorAt(in, fmt.Sprintf(
+			"checksum failed (hardware problem?) : expected=%x actual=%x",
+			expectedChecksum, actualChecksum))
+	}
+	if fp, length := in.FilePointer(), in.Length(); fp != length {
+		return 0, NewCorruptIndexErrorAt(in, fmt.Sprintf(
+			"did not read all bytes from file: read %v vs size %v", fp, length))
+	}
+	return actualChecksum, nil
+}
+
+/* Input which can be positioned anywhere. */
+type IndexInput interface {
+	DataInput
+	ReadBytes(buf []byte) error
+	ReadLong() (int64, error)
+	FilePointer() int64
+	Seek(pos int64) error
+	Length() int64
+}
+
+/*
+Returns (but does not validate) the checksum previously written by
+CheckFooter. The input is left positioned at its end.
+*/
+func RetrieveChecksum(in IndexInput) (int64, error) {
+	if err := in.Seek(in.Length() - int64(FooterLength())); err != nil {
+		return 0, err
+	}
+	if err := validateFooter(in); err != nil {
+		return 0, err
+	}
+	return in.ReadLong()
+}
+
+func validateFooter(in DataInput) error {
+	magic, err := in.ReadInt()
+	if err != nil {
+		return err
+	}
+	if magic != FOOTER_MAGIC {
+		return NewCorruptIndexErrorAt(in, fmt.Sprintf(
+			"codec footer mismatch: actual footer=%v vs expected footer=%v",
+			magic, FOOTER_MAGIC))
+	}
+
+	algorithmId, err := in.ReadInt()
+	if err != nil {
+		return err
+	}
+	if algorithmId != 0 {
+		return NewCorruptIndexErrorAt(in, fmt.Sprintf(
+			"codec footer mismatch: unknown algorithmID: %v", algorithmId))
+	}
+	return nil
+}
+
+/*
+Clones the provided input, reads all bytes from the file, and calls
+CheckFooter().
+
+Note that this method may be slow, as it must process the entire
+file. If you just need to extract the checksum value, call
+RetrieveChecksum().
+
+Unlike Lucene Java, the input itself is read from the start; its
+position is restored afterwards.
+*/
+func ChecksumEntireFile(input IndexInput) (checksum int64, err error) {
+	pos := input.FilePointer()
+	defer func() {
+		if err2 := input.Seek(pos); err == nil {
+			err = err2
+		}
+	}()
+
+	length := input.Length()
+	footerStart := length - int64(FooterLength())
+	if footerStart < 0 {
+		return 0, NewCorruptIndexErrorAt(input, fmt.Sprintf(
+			"misplaced codec footer (file truncated?): length=%v but footerLength==%v",
+			length, FooterLength()))
+	}
+	if err = input.Seek(0); err != nil {
+		return 0, err
+	}
+	in := &checksumInput{IndexInput: input}
+	buf := make([]byte, 4096)
+	for remaining := footerStart; remaining > 0; {
+		n := len(buf)
+		if int64(n) > remaining {
+			n = int(remaining)
+		}
+		if err = in.ReadBytes(buf[:n]); err != nil {
+			return 0, err
+		}
+		remaining -= int64(n)
+	}
+	return CheckFooter(in)
+}
+
+// Updates the CRC32 of the bytes read through the wrapped input.
+type checksumInput struct {
+	IndexInput
+	crc uint32
+}
+
+func (in *checksumInput) ReadBytes(buf []byte) error {
+	err := in.IndexInput.ReadBytes(buf)
+	if err == nil {
+		in.crc = crc32.Update(in.crc, crc32.IEEETable, buf)
+	}
+	return err
+}
+
+func (in *checksumInput) ReadInt() (int32, error) {
+	var buf [4]byte
+	if err := in.ReadBytes(buf[:]); err != nil {
+		return 0, err
+	}
+	return int32(buf[0])<<24 | int32(buf[1])<<16 | int32(buf[2])<<8 | int32(buf[3]), nil
+}
+
+func (in *checksumInput) Checksum() int64 {
+	return int64(in.crc)
 }
 
-func NewIndexFormatTooOldError(in DataInput, version, minVersion, maxVersion int32) error {
-	return errors.New(fmt.Sprintf(
-		"Format version is not supported (resource: %v): %v (needs to be between %v and %v). This version of Lucene only supports indexes created with release 3.0 and later.",
-		in, version, minVersion, maxVersion))
+func (in *checksumInput) String() string {
+	return fmt.Sprintf("%v", in.IndexInput)
 }
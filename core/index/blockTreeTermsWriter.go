@@ -0,0 +1,695 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"github.com/balzaczyy/golucene/core/codec"
+	"github.com/balzaczyy/golucene/core/index/model"
+	"github.com/balzaczyy/golucene/core/store"
+	"github.com/balzaczyy/golucene/core/util"
+	"github.com/balzaczyy/golucene/core/util/fst"
+	"math"
+)
+
+// codecs/BlockTreeTermsWriter.java
+
+const (
+	// Suggested default value for the minItemsInBlock parameter to
+	// newBlockTreeTermsWriter().
+	BTT_DEFAULT_MIN_BLOCK_SIZE = 25
+
+	// Suggested default value for the maxItemsInBlock parameter to
+	// newBlockTreeTermsWriter().
+	BTT_DEFAULT_MAX_BLOCK_SIZE = 48
+)
+
+/*
+Block-based terms index and dictionary writer.
+
+Writes terms dict and index, block-encoding (column stride) each
+term's metadata for each set of terms between two index terms.
+
+Files:
+
+- .tim: Term Dictionary
+- .tip: Term Index
+
+The terms dictionary is split into blocks of terms sharing a common
+prefix; each block holds between minItemsInBlock and maxItemsInBlock
+entries (terms or pointers to sub-blocks). If a prefix has too many
+entries, its block is split into "floor" blocks, keyed by the leading
+label of the suffix of their first entry. The terms index is an FST
+mapping each block's prefix to the file pointer of the block.
+
+See BlockTreeTermsReader for the file format details.
+*/
+type BlockTreeTermsWriter struct {
+	out      store.IndexOutput
+	indexOut store.IndexOutput
+
+	minItemsInBlock int
+	maxItemsInBlock int
+
+	postingsWriter PostingsWriterBase
+	fieldInfos     model.FieldInfos
+	currentField   *model.FieldInfo
+
+	fields []*btFieldMetaData
+}
+
+type btFieldMetaData struct {
+	fieldInfo        model.FieldInfo
+	rootCode         []byte
+	numTerms         int64
+	indexStartFP     int64
+	sumTotalTermFreq int64
+	sumDocFreq       int64
+	docCount         int
+}
+
+/*
+Create a new writer. The number of items (terms or sub-blocks) per
+block will aim to be between minItemsInBlock and maxItemsInBlock,
+though in some cases the blocks may be smaller than the min.
+*/
+func newBlockTreeTermsWriter(state SegmentWriteState,
+	postingsWriter PostingsWriterBase,
+	minItemsInBlock, maxItemsInBlock int) (*BlockTreeTermsWriter, error) {
+
+	if minItemsInBlock <= 1 {
+		return nil, errors.New(fmt.Sprintf("minItemsInBlock must be >= 2; got %v", minItemsInBlock))
+	}
+	if maxItemsInBlock <= 0 {
+		return nil, errors.New(fmt.Sprintf("maxItemsInBlock must be >= 1; got %v", maxItemsInBlock))
+	}
+	if minItemsInBlock > maxItemsInBlock {
+		return nil, errors.New(fmt.Sprintf(
+			"maxItemsInBlock must be >= minItemsInBlock; got maxItemsInBlock=%v minItemsInBlock=%v",
+			maxItemsInBlock, minItemsInBlock))
+	}
+	if 2*(minItemsInBlock-1) > maxItemsInBlock {
+		return nil, errors.New(fmt.Sprintf(
+			"maxItemsInBlock must be at least 2*(minItemsInBlock-1); got maxItemsInBlock=%v minItemsInBlock=%v",
+			maxItemsInBlock, minItemsInBlock))
+	}
+
+	termsFileName := util.SegmentFileName(state.segmentInfo.Name, state.segmentSuffix, BTT_EXTENSION)
+	out, err := state.directory.CreateOutput(termsFileName, state.context)
+	if err != nil {
+		return nil, err
+	}
+	var indexOut store.IndexOutput
+	success := false
+	defer func() {
+		if !success {
+			util.CloseWhileSuppressingError(out, indexOut)
+		}
+	}()
+
+	if err = codec.WriteHeader(out, BTT_CODEC_NAME, BTT_VERSION_CURRENT); err != nil {
+		return nil, err
+	}
+
+	termsIndexFileName := util.SegmentFileName(state.segmentInfo.Name, state.segmentSuffix, BTT_INDEX_EXTENSION)
+	if indexOut, err = state.directory.CreateOutput(termsIndexFileName, state.context); err != nil {
+		return nil, err
+	}
+	if err = codec.WriteHeader(indexOut, BTT_INDEX_CODEC_NAME, BTT_INDEX_VERSION_CURRENT); err != nil {
+		return nil, err
+	}
+
+	// have consumer write its format/header
+	if err = postingsWriter.Init(out); err != nil {
+		return nil, err
+	}
+	success = true
+	return &BlockTreeTermsWriter{
+		out:             out,
+		indexOut:        indexOut,
+		minItemsInBlock: minItemsInBlock,
+		maxItemsInBlock: maxItemsInBlock,
+		postingsWriter:  postingsWriter,
+		fieldInfos:      state.fieldInfos,
+	}, nil
+}
+
+func (w *BlockTreeTermsWriter) AddField(field model.FieldInfo) (TermsConsumer, error) {
+	assert(w.currentField == nil || w.currentField.Name < field.Name)
+	w.currentField = &field
+	return newBTTermsWriter(w, field), nil
+}
+
+func encodeBlockOutput(fp int64, hasTerms, isFloor bool) int64 {
+	assert(fp < (1 << 62))
+	code := fp << BTT_OUTPUT_FLAGS_NUM_BITS
+	if hasTerms {
+		code |= BTT_OUTPUT_FLAG_HAS_TERMS
+	}
+	if isFloor {
+		code |= BTT_OUTPUT_FLAG_IS_FLOOR
+	}
+	return code
+}
+
+func (w *BlockTreeTermsWriter) Close() (err error) {
+	defer func() {
+		if err == nil {
+			err = util.Close(w.out, w.indexOut, w.postingsWriter)
+		} else {
+			util.CloseWhileSuppressingError(w.out, w.indexOut, w.postingsWriter)
+		}
+	}()
+
+	dirStart := w.out.FilePointer()
+	indexDirStart := w.indexOut.FilePointer()
+
+	if err = w.out.WriteVInt(int32(len(w.fields))); err != nil {
+		return err
+	}
+
+	for _, field := range w.fields {
+		err = w.out.WriteVInt(field.fieldInfo.Number)
+		if err == nil {
+			err = w.out.WriteVLong(field.numTerms)
+		}
+		if err == nil {
+			err = w.out.WriteVInt(int32(len(field.rootCode)))
+		}
+		if err == nil {
+			err = w.out.WriteBytes(field.rootCode)
+		}
+		if err == nil && field.fieldInfo.IndexOptions() != model.INDEX_OPT_DOCS_ONLY {
+			err = w.out.WriteVLong(field.sumTotalTermFreq)
+		}
+		if err == nil {
+			err = w.out.WriteVLong(field.sumDocFreq)
+		}
+		if err == nil {
+			err = w.out.WriteVInt(int32(field.docCount))
+		}
+		if err == nil {
+			err = w.indexOut.WriteVLong(field.indexStartFP)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err = w.out.WriteLong(dirStart); err != nil {
+		return err
+	}
+	if err = codec.WriteFooter(w.out); err != nil {
+		return err
+	}
+	if err = w.indexOut.WriteLong(indexDirStart); err != nil {
+		return err
+	}
+	return codec.WriteFooter(w.indexOut)
+}
+
+// An entry of the pending stack: either a term or a sub-block.
+type btPendingEntry interface {
+	isTerm() bool
+}
+
+type btPendingTerm struct {
+	termBytes []byte
+	stats     *TermStats
+}
+
+func (t *btPendingTerm) isTerm() bool { return true }
+
+func (t *btPendingTerm) String() string { return brToString(t.termBytes) }
+
+// An (input, output) pair of the terms index, kept sorted by input
+// until the root block compiles them into the FST.
+type btIndexEntry struct {
+	input  []byte
+	output []byte
+}
+
+type btPendingBlock struct {
+	prefix        []byte
+	fp            int64
+	index         []*btIndexEntry
+	subIndices    [][]*btIndexEntry
+	hasTerms      bool
+	isFloor       bool
+	floorLeadByte int
+}
+
+func (b *btPendingBlock) isTerm() bool { return false }
+
+func (b *btPendingBlock) String() string { return fmt.Sprintf("BLOCK: %v", brToString(b.prefix)) }
+
+/*
+Collects the terms index entries of this block and all its floor
+blocks: the prefix of this block, mapped to the encoded pointers of
+the (floor) blocks, followed by the entries of all sub-blocks.
+*/
+func (b *btPendingBlock) compileIndex(floorBlocks []*btPendingBlock, scratchBytes *store.RAMOutputStream) error {
+	assert((b.isFloor && len(floorBlocks) > 1) || (!b.isFloor && len(floorBlocks) == 1))
+	assert(b == floorBlocks[0])
+	assert(scratchBytes.FilePointer() == 0)
+
+	// TODO: try writing the leading vLong in MSB order (opposite of
+	// what Lucene does today), for better outputs sharing in the FST
+	err := scratchBytes.WriteVLong(encodeBlockOutput(b.fp, b.hasTerms, b.isFloor))
+	if err == nil && b.isFloor {
+		err = scratchBytes.WriteVInt(int32(len(floorBlocks) - 1))
+		for _, sub := range floorBlocks[1:] {
+			assert(sub.floorLeadByte != -1)
+			assert(sub.fp > b.fp)
+			if err == nil {
+				err = scratchBytes.WriteByte(byte(sub.floorLeadByte))
+			}
+			if err == nil {
+				code := (sub.fp - b.fp) << 1
+				if sub.hasTerms {
+					code |= 1
+				}
+				err = scratchBytes.WriteVLong(code)
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	output := make([]byte, scratchBytes.FilePointer())
+	if err = scratchBytes.WriteToBytes(output); err != nil {
+		return err
+	}
+	scratchBytes.Reset()
+
+	b.index = []*btIndexEntry{&btIndexEntry{b.prefix, output}}
+	// Copy over index for all sub-blocks
+	for _, block := range floorBlocks {
+		for _, subIndex := range block.subIndices {
+			b.index = append(b.index, subIndex...)
+		}
+		block.subIndices = nil
+	}
+	return nil
+}
+
+/* Builds the terms index FST from the collected index entries. */
+func (b *btPendingBlock) buildIndex() (*fst.FST, error) {
+	outputs := fst.ByteSequenceOutputsSingleton()
+	indexBuilder := fst.NewBuilder(fst.INPUT_TYPE_BYTE1, 0, 0, true, false,
+		math.MaxInt32, outputs, true, 15)
+	var scratchInts []int
+	for _, entry := range b.index {
+		scratchInts = scratchInts[:0]
+		for _, v := range entry.input {
+			scratchInts = append(scratchInts, int(v))
+		}
+		if err := indexBuilder.Add(scratchInts, entry.output); err != nil {
+			return nil, err
+		}
+	}
+	return indexBuilder.Finish()
+}
+
+type btTermsWriter struct {
+	owner     *BlockTreeTermsWriter
+	fieldInfo model.FieldInfo
+	numTerms  int64
+
+	indexStartFP int64
+
+	// Records index into pending where the current prefix at that
+	// length "started"; for example, if current term starts with 't',
+	// prefixStarts[0] is the index into pending for the first
+	// term/sub-block starting with 't'. We use this to figure out when
+	// to write a new block:
+	lastTerm     []byte
+	prefixStarts []int
+
+	pending   []btPendingEntry
+	newBlocks []*btPendingBlock
+
+	suffixWriter *store.RAMOutputStream
+	statsWriter  *store.RAMOutputStream
+	scratchBytes *store.RAMOutputStream
+}
+
+func newBTTermsWriter(owner *BlockTreeTermsWriter, fieldInfo model.FieldInfo) *btTermsWriter {
+	owner.postingsWriter.SetField(fieldInfo)
+	return &btTermsWriter{
+		owner:        owner,
+		fieldInfo:    fieldInfo,
+		prefixStarts: make([]int, 8),
+		suffixWriter: store.NewRAMOutputStreamBuffer(),
+		statsWriter:  store.NewRAMOutputStreamBuffer(),
+		scratchBytes: store.NewRAMOutputStreamBuffer(),
+	}
+}
+
+/*
+Writes the top count entries in pending, using lastTerm to compute
+the prefix.
+*/
+func (w *btTermsWriter) writeBlocks(prefixLength, count int) error {
+	assert(count > 0)
+	assert(prefixLength > 0 || count == len(w.pending))
+
+	lastSuffixLeadLabel := -1
+
+	// True if we saw at least one term in this block (we record if a
+	// block only points to sub-blocks in the terms index so we can
+	// avoid seeking to it when we are looking for a term):
+	hasTerms := false
+	hasSubBlocks := false
+
+	start := len(w.pending) - count
+	end := len(w.pending)
+	nextBlockStart := start
+	nextFloorLeadLabel := -1
+
+	for i := start; i < end; i++ {
+		var suffixLeadLabel int
+		switch ent := w.pending[i].(type) {
+		case *btPendingTerm:
+			if len(ent.termBytes) == prefixLength {
+				// Suffix is 0, i.e. prefix 'foo' and term is 'foo' so the
+				// term has empty string suffix in this block
+				assert(lastSuffixLeadLabel == -1)
+				suffixLeadLabel = -1
+			} else {
+				suffixLeadLabel = int(ent.termBytes[prefixLength])
+			}
+		case *btPendingBlock:
+			assert(len(ent.prefix) > prefixLength)
+			suffixLeadLabel = int(ent.prefix[prefixLength])
+		}
+
+		if suffixLeadLabel != lastSuffixLeadLabel {
+			itemsInBlock := i - nextBlockStart
+			if itemsInBlock >= w.owner.minItemsInBlock && end-nextBlockStart > w.owner.maxItemsInBlock {
+				// The count is too large for one block, so we must break it
+				// into "floor" blocks, where we record the leading label of
+				// the suffix of the first term in each floor block, so at
+				// search time we can jump to the right floor block. We just
+				// use a naive greedy segmenter here: make a new floor block
+				// as soon as we have at least minItemsInBlock. This is not
+				// always best: it often produces a too-small block as the
+				// final block:
+				isFloor := itemsInBlock < count
+				block, err := w.writeBlock(prefixLength, isFloor, nextFloorLeadLabel,
+					nextBlockStart, i, hasTerms, hasSubBlocks)
+				if err != nil {
+					return err
+				}
+				w.newBlocks = append(w.newBlocks, block)
+
+				hasTerms = false
+				hasSubBlocks = false
+				nextFloorLeadLabel = suffixLeadLabel
+				nextBlockStart = i
+			}
+
+			lastSuffixLeadLabel = suffixLeadLabel
+		}
+
+		if w.pending[i].isTerm() {
+			hasTerms = true
+		} else {
+			hasSubBlocks = true
+		}
+	}
+
+	// Write last block, if any:
+	if nextBlockStart < end {
+		itemsInBlock := end - nextBlockStart
+		isFloor := itemsInBlock < count
+		block, err := w.writeBlock(prefixLength, isFloor, nextFloorLeadLabel,
+			nextBlockStart, end, hasTerms, hasSubBlocks)
+		if err != nil {
+			return err
+		}
+		w.newBlocks = append(w.newBlocks, block)
+	}
+
+	assert(len(w.newBlocks) > 0)
+
+	firstBlock := w.newBlocks[0]
+
+	assert(firstBlock.isFloor || len(w.newBlocks) == 1)
+
+	if err := firstBlock.compileIndex(w.newBlocks, w.scratchBytes); err != nil {
+		return err
+	}
+
+	// Remove slice from the top of the pending stack, that we just
+	// wrote, and append the new block:
+	w.pending = append(w.pending[:start], firstBlock)
+
+	w.newBlocks = w.newBlocks[:0]
+	return nil
+}
+
+/*
+Writes the specified slice (start is inclusive, end is exclusive)
+from pending stack as a new block. If isFloor is true, there were too
+many (more than maxItemsInBlock) entries sharing the same prefix, and
+so we broke it into multiple floor blocks where we record the starting
+label of the suffix of each floor block.
+*/
+func (w *btTermsWriter) writeBlock(prefixLength int, isFloor bool,
+	floorLeadLabel, start, end int, hasTerms, hasSubBlocks bool) (*btPendingBlock, error) {
+
+	assert(end > start)
+
+	out := w.owner.out
+	startFP := out.FilePointer()
+
+	hasFloorLeadLabel := isFloor && floorLeadLabel != -1
+
+	prefix := make([]byte, prefixLength, prefixLength+1)
+	copy(prefix, w.lastTerm[:prefixLength])
+
+	// Write block header:
+	numEntries := end - start
+	code := numEntries << 1
+	if end == len(w.pending) {
+		// Last block:
+		code |= 1
+	}
+	if err := out.WriteVInt(int32(code)); err != nil {
+		return nil, err
+	}
+
+	// 1st pass: pack term suffix bytes into []byte blob
+	// TODO: cutover to bulk int codec... simple64?
+
+	// We optimize the leaf block case (block has only terms), writing
+	// a more compact format in this case:
+	isLeafBlock := !hasSubBlocks
+
+	var subIndices [][]*btIndexEntry
+	termCount := 0
+	var err error
+	for _, ent := range w.pending[start:end] {
+		switch ent := ent.(type) {
+		case *btPendingTerm:
+			suffix := len(ent.termBytes) - prefixLength
+			assert(floorLeadLabel == -1 || suffix > 0 && int(ent.termBytes[prefixLength]) >= floorLeadLabel)
+			// Write term suffix bytes. For non-leaf block we borrow 1 bit
+			// to record if entry is term or sub-block
+			if isLeafBlock {
+				err = w.suffixWriter.WriteVInt(int32(suffix))
+			} else {
+				err = w.suffixWriter.WriteVInt(int32(suffix << 1))
+			}
+			if err == nil {
+				err = w.suffixWriter.WriteBytes(ent.termBytes[prefixLength:])
+			}
+
+			// Write term stats, to separate []byte blob:
+			if err == nil {
+				err = w.statsWriter.WriteVInt(int32(ent.stats.DocFreq))
+			}
+			if err == nil && w.fieldInfo.IndexOptions() != model.INDEX_OPT_DOCS_ONLY {
+				assertn(ent.stats.TotalTermFreq >= int64(ent.stats.DocFreq),
+					"%v vs %v", ent.stats.TotalTermFreq, ent.stats.DocFreq)
+				err = w.statsWriter.WriteVLong(ent.stats.TotalTermFreq - int64(ent.stats.DocFreq))
+			}
+			termCount++
+
+		case *btPendingBlock:
+			assert(!isLeafBlock)
+			suffix := len(ent.prefix) - prefixLength
+			assert(suffix > 0)
+			assert(floorLeadLabel == -1 || int(ent.prefix[prefixLength]) >= floorLeadLabel)
+			assert(ent.fp < startFP)
+
+			// For non-leaf block we borrow 1 bit to record if entry is
+			// term or sub-block
+			err = w.suffixWriter.WriteVInt(int32(suffix<<1 | 1))
+			if err == nil {
+				err = w.suffixWriter.WriteBytes(ent.prefix[prefixLength:])
+			}
+			if err == nil {
+				err = w.suffixWriter.WriteVLong(startFP - ent.fp)
+			}
+			subIndices = append(subIndices, ent.index)
+			ent.index = nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// TODO: we could block-write the term suffix pointers; this would
+	// take more space but would enable binary search on lookup
+
+	// Write suffixes []byte blob to terms dict output:
+	suffixCode := int32(w.suffixWriter.FilePointer() << 1)
+	if isLeafBlock {
+		suffixCode |= 1
+	}
+	err = out.WriteVInt(suffixCode)
+	if err == nil {
+		err = w.suffixWriter.WriteTo(out)
+	}
+	w.suffixWriter.Reset()
+
+	// Write term stats []byte blob
+	if err == nil {
+		err = out.WriteVInt(int32(w.statsWriter.FilePointer()))
+	}
+	if err == nil {
+		err = w.statsWriter.WriteTo(out)
+	}
+	w.statsWriter.Reset()
+	if err != nil {
+		return nil, err
+	}
+
+	// Have postings writer write block, counting the terms still
+	// pending after this block:
+	futureTermCount := 0
+	for _, ent := range w.pending[end:] {
+		if ent.isTerm() {
+			futureTermCount++
+		}
+	}
+	if err = w.owner.postingsWriter.FlushTermsBlock(futureTermCount+termCount, termCount); err != nil {
+		return nil, err
+	}
+
+	if hasFloorLeadLabel {
+		// We already allocated to length+1 above:
+		prefix = append(prefix, byte(floorLeadLabel))
+	}
+
+	return &btPendingBlock{prefix, startFP, nil, subIndices, hasTerms, isFloor, floorLeadLabel}, nil
+}
+
+func (w *btTermsWriter) StartTerm(text []byte) (PostingsConsumer, error) {
+	if err := w.owner.postingsWriter.StartTerm(); err != nil {
+		return nil, err
+	}
+	return w.owner.postingsWriter, nil
+}
+
+func (w *btTermsWriter) FinishTerm(text []byte, stats *TermStats) error {
+	assert(stats.DocFreq > 0)
+
+	if err := w.pushTerm(text); err != nil {
+		return err
+	}
+	termBytes := make([]byte, len(text))
+	copy(termBytes, text)
+	w.pending = append(w.pending, &btPendingTerm{termBytes, stats})
+	w.numTerms++
+	return w.owner.postingsWriter.FinishTerm(stats)
+}
+
+/* Pushes the new term to the top of the stack, and writes new blocks. */
+func (w *btTermsWriter) pushTerm(text []byte) error {
+	limit := len(w.lastTerm)
+	if len(text) < limit {
+		limit = len(text)
+	}
+
+	// Find common prefix between last term and current term:
+	pos := 0
+	for pos < limit && w.lastTerm[pos] == text[pos] {
+		pos++
+	}
+
+	// Close the "abandoned" suffix now:
+	for i := len(w.lastTerm) - 1; i >= pos; i-- {
+		// How many items on top of the stack share the current suffix
+		// we are closing:
+		prefixTopSize := len(w.pending) - w.prefixStarts[i]
+		if prefixTopSize >= w.owner.minItemsInBlock {
+			if err := w.writeBlocks(i+1, prefixTopSize); err != nil {
+				return err
+			}
+			w.prefixStarts[i] -= prefixTopSize - 1
+		}
+	}
+
+	if len(w.prefixStarts) < len(text) {
+		next := make([]int, util.Oversize(len(text), 4))
+		copy(next, w.prefixStarts)
+		w.prefixStarts = next
+	}
+
+	// Init new tail:
+	for i := pos; i < len(text); i++ {
+		w.prefixStarts[i] = len(w.pending)
+	}
+
+	w.lastTerm = append(w.lastTerm[:0], text...)
+	return nil
+}
+
+func (w *btTermsWriter) Finish(sumTotalTermFreq, sumDocFreq int64, docCount int) error {
+	if w.numTerms == 0 {
+		assert(sumTotalTermFreq == 0 || w.fieldInfo.IndexOptions() == model.INDEX_OPT_DOCS_ONLY && sumTotalTermFreq == -1)
+		assert(sumDocFreq == 0)
+		assert(docCount == 0)
+		return nil
+	}
+
+	// Add empty term to force closing of all final blocks:
+	if err := w.pushTerm(nil); err != nil {
+		return err
+	}
+
+	// TODO: if len(pending) is already 1 with a non-zero prefix length
+	// we can save writing a "degenerate" root block, but we have to
+	// fix all the places that assume the root block's prefix is the
+	// empty string:
+	if err := w.writeBlocks(0, len(w.pending)); err != nil {
+		return err
+	}
+
+	// We better have one final "root" block:
+	assertn(len(w.pending) == 1 && !w.pending[0].isTerm(),
+		"len(pending)=%v pending=%v", len(w.pending), w.pending)
+	root := w.pending[0].(*btPendingBlock)
+	assert(len(root.prefix) == 0)
+	assert(len(root.index) > 0 && len(root.index[0].input) == 0)
+	rootCode := root.index[0].output
+
+	index, err := root.buildIndex()
+	if err != nil {
+		return err
+	}
+
+	// Write FST to index
+	w.indexStartFP = w.owner.indexOut.FilePointer()
+	if err = index.Save(w.owner.indexOut); err != nil {
+		return err
+	}
+
+	w.owner.fields = append(w.owner.fields, &btFieldMetaData{
+		w.fieldInfo, rootCode, w.numTerms, w.indexStartFP,
+		sumTotalTermFreq, sumDocFreq, docCount,
+	})
+	return nil
+}
@@ -16,6 +16,13 @@ const BYTES_PER_DEL_DOCID = 2 * util.NUM_BYTES_INT
 /* Go map (amd64) consumes about 40 bytes for an extra entry. */
 const BYTES_PER_DEL_QUERY = 40 + util.NUM_BYTES_OBJECT_REF + util.NUM_BYTES_INT
 
+/*
+Besides the map entry, a deleted term holds a Term struct (a string
+and a slice header) plus its docIDUpto; the term's own bytes are
+accounted separately.
+*/
+const BYTES_PER_DEL_TERM = 40 + 6*util.NUM_BYTES_OBJECT_REF + util.NUM_BYTES_INT
+
 const MAX_INT = int(math.MaxInt32)
 
 const VERBOSE = true
@@ -71,6 +78,38 @@ func (bd *BufferedDeletes) String() string {
 	}
 }
 
+func (bd *BufferedDeletes) addQuery(query Query, docIDUpto int) {
+	_, ok := bd.queries[query]
+	bd.queries[query] = docIDUpto
+	// increment bytes used only if the query wasn't added so far.
+	if !ok {
+		atomic.AddInt64(&bd.bytesUsed, BYTES_PER_DEL_QUERY)
+	}
+}
+
+func (bd *BufferedDeletes) addTerm(term *Term, docIDUpto int) {
+	current, ok := bd.terms[term]
+	if ok && docIDUpto < current {
+		// Only record the new number if it's greater than the current
+		// one. This is important because if multiple goroutines are
+		// replacing the same doc at nearly the same time, it's possible
+		// that one goroutine that got a higher docID is scheduled before
+		// the other goroutines. If we blindly replace then we can
+		// incorrectly get both docs indexed.
+		return
+	}
+
+	bd.terms[term] = docIDUpto
+	// note that if current != nil then it means there's already a
+	// buffered delete on that term, therefore we seem to over-count.
+	// this over-counting is done to respect IndexWriterConfig.
+	// SetMaxBufferedDeleteTerms().
+	atomic.AddInt32(&bd.numTermDeletes, 1)
+	if !ok {
+		atomic.AddInt64(&bd.bytesUsed, int64(BYTES_PER_DEL_TERM+len(term.Bytes)+len(term.Field)))
+	}
+}
+
 func (bd *BufferedDeletes) addDocID(docID int) {
 	bd.docIDs = append(bd.docIDs, docID)
 	atomic.AddInt64(&bd.bytesUsed, BYTES_PER_DEL_DOCID)
@@ -120,8 +159,14 @@ func freezeBufferedDeletes(deletes *BufferedDeletes, isPrivate bool) *FrozenBuff
 	}
 	util.TimSort(TermSorter(termsArray))
 	builder := newPrefixCodedTermsBuilder()
-	for _, term := range termsArray {
+	var termCount int
+	for i, term := range termsArray {
+		// distinct pointers may still refer to equal terms
+		if i > 0 && termsArray[i-1].equals(term) {
+			continue
+		}
 		builder.add(term)
+		termCount++
 	}
 	terms := builder.finish()
 
@@ -137,7 +182,7 @@ func freezeBufferedDeletes(deletes *BufferedDeletes, isPrivate bool) *FrozenBuff
 	return &FrozenBufferedDeletes{
 		gen:              -1,
 		isSegmentPrivate: isPrivate,
-		termCount:        len(termsArray),
+		termCount:        termCount,
 		terms:            terms,
 		_queries:         queries,
 		queryLimits:      queryLimits,
@@ -147,9 +192,27 @@ func freezeBufferedDeletes(deletes *BufferedDeletes, isPrivate bool) *FrozenBuff
 }
 
 func (bd *FrozenBufferedDeletes) queries() []*QueryAndLimit {
-	panic("not implemented yet")
+	ans := make([]*QueryAndLimit, len(bd._queries))
+	for i, query := range bd._queries {
+		ans[i] = &QueryAndLimit{query, bd.queryLimits[i]}
+	}
+	return ans
 }
 
 func (bd *FrozenBufferedDeletes) String() string {
-	panic("not implemented yet")
+	var buf bytes.Buffer
+	if bd.numTermDeletes != 0 {
+		fmt.Fprintf(&buf, " %v deleted terms (unique count=%v)", bd.numTermDeletes, bd.termCount)
+	}
+	if len(bd._queries) != 0 {
+		fmt.Fprintf(&buf, " %v deleted queries", len(bd._queries))
+	}
+	if bd.bytesUsed != 0 {
+		fmt.Fprintf(&buf, " bytesUsed=%v", bd.bytesUsed)
+	}
+	return buf.String()
+}
+
+func (bd *FrozenBufferedDeletes) any() bool {
+	return bd.termCount > 0 || len(bd._queries) > 0
 }
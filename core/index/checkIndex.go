@@ -1,10 +1,12 @@
 package index
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
-	// "github.com/balzaczyy/golucene/core/index/model"
+	"github.com/balzaczyy/golucene/core/index/model"
 	"github.com/balzaczyy/golucene/core/store"
+	"github.com/balzaczyy/golucene/core/util"
 	"io"
 	"math"
 	"runtime/debug"
@@ -33,6 +35,10 @@ type CheckIndexStatus struct {
 	// Number of segments in the index
 	numSegments int
 
+	// Empty unless you passed specific segments list to check as
+	// optional 3rd argument.
+	segmentsChecked []string
+
 	// True if the index was created with a newer version of Lucene than the CheckIndex tool.
 	toolOutOfDate bool
 
@@ -43,12 +49,12 @@ type CheckIndexStatus struct {
 	dir store.Directory
 
 	// SegmentInfos instance containing only segments that had no
-	// problems (this is used with the fixIndex() method to repare the
+	// problems (this is used with the FixIndex() method to repare the
 	// index)
-	newSegments *SegmentInfos
+	NewSegments *SegmentInfos
 
 	// How many documents will be lost to bad segments.
-	totLoseDocCount int
+	TotLoseDocCount int
 
 	// How many bad segments were found.
 	numBadSegments int
@@ -56,6 +62,10 @@ type CheckIndexStatus struct {
 	// Whether the SegmentInfos.counter is greater than any of the segments' names.
 	validCounter bool
 
+	// True if we checked only specific segments (CheckIndex() was
+	// called with non-nil onlySegments)
+	Partial bool
+
 	// The greatest segment name.
 	maxSegmentName int
 
@@ -117,23 +127,75 @@ type SegmentInfoStatus struct {
 	docValuesStatus *DocValuesStatus
 }
 
+/* Status from testing field norms. */
 type FieldNormStatus struct {
+	// Number of fields successfully tested
+	totFields int64
+
+	// Error thrown during term index test (nil on success)
 	err error
 }
 
+/* Status from testing term index. */
 type TermIndexStatus struct {
+	// Number of terms with at least one live doc.
+	termCount int64
+
+	// Number of terms with zero live docs docs.
+	delTermCount int64
+
+	// Total frequency across all terms.
+	totFreq int64
+
+	// Total number of positions.
+	totPos int64
+
+	// Error thrown during term index test (nil on success)
 	err error
 }
 
+/* Status from testing stored fields. */
 type StoredFieldStatus struct {
+	// Number of documents tested.
+	docCount int
+
+	// Total number of stored fields tested.
+	totFields int64
+
+	// Error thrown during stored fields test (nil on success)
 	err error
 }
 
+/* Status from testing term vectors. */
 type TermVectorStatus struct {
+	// Number of documents tested.
+	docCount int
+
+	// Total number of term vectors tested.
+	totVectors int64
+
+	// Error thrown during term vector test (nil on success)
 	err error
 }
 
+/* Status from testing DocValues */
 type DocValuesStatus struct {
+	// Total number of docValues tested.
+	totalValueFields int64
+
+	// Total number of numeric fields
+	totalNumericFields int64
+
+	// Total number of binary fields
+	totalBinaryFields int64
+
+	// Total number of sorted fields
+	totalSortedFields int64
+
+	// Total number of sortedset fields
+	totalSortedSetFields int64
+
+	// Error thrown during doc values test (nil on success)
 	err error
 }
 
@@ -146,12 +208,21 @@ take a long time to run.
 */
 type CheckIndex struct {
 	infoStream            io.Writer
+	verbose               bool
 	dir                   store.Directory
 	crossCheckTermVectors bool
 }
 
 func NewCheckIndex(dir store.Directory, crossCheckTermVectors bool, infoStream io.Writer) *CheckIndex {
-	return &CheckIndex{infoStream, dir, crossCheckTermVectors}
+	return &CheckIndex{infoStream, false, dir, crossCheckTermVectors}
+}
+
+/*
+If verbose is true, the stack trace of any unexpected failure found
+while checking a segment is printed to the info stream as well.
+*/
+func (ch *CheckIndex) SetVerbose(verbose bool) {
+	ch.verbose = verbose
 }
 
 func (ch *CheckIndex) msg(msg string, args ...interface{}) {
@@ -176,8 +247,14 @@ func (ch *CheckIndex) CheckIndex(onlySegments []string) *CheckIndexStatus {
 	err := sis.ReadAll(ch.dir)
 	if err != nil {
 		fmt.Fprintln(ch.infoStream, "ERROR: could not read any segments file in directory")
-		debug.PrintStack()
+		fmt.Fprintln(ch.infoStream, err)
 		result.MissingSegments = true
+		var tooNew *IndexFormatTooNewError
+		if errors.As(err, &tooNew) {
+			ch.msg(
+				"\nERROR: this index appears to be created by a newer version of Lucene than this tool was compiled on; please re-compile this tool on the matching version of Lucene; exiting")
+			result.toolOutOfDate = true
+		}
 		return result
 	}
 
@@ -250,10 +327,14 @@ func (ch *CheckIndex) CheckIndex(onlySegments []string) *CheckIndexStatus {
 
 	names := make(map[string]bool)
 	if onlySegments != nil {
+		result.Partial = true
+		fmt.Fprint(ch.infoStream, "\nChecking only these segments:")
 		for _, name := range onlySegments {
+			fmt.Fprintf(ch.infoStream, " %v", name)
 			names[name] = true
 		}
-		panic("not implemented yet")
+		result.segmentsChecked = append(result.segmentsChecked, onlySegments...)
+		ch.msg(":")
 	}
 
 	if skip {
@@ -263,8 +344,8 @@ func (ch *CheckIndex) CheckIndex(onlySegments []string) *CheckIndexStatus {
 		return result
 	}
 
-	result.newSegments = sis.Clone()
-	result.newSegments.Clear()
+	result.NewSegments = sis.Clone()
+	result.NewSegments.Clear()
 	result.maxSegmentName = -1
 
 	for i, info := range sis.Segments {
@@ -275,7 +356,7 @@ func (ch *CheckIndex) CheckIndex(onlySegments []string) *CheckIndexStatus {
 		if int(segmentName) > result.maxSegmentName {
 			result.maxSegmentName = int(segmentName)
 		}
-		if _, ok := names[info.info.Name]; !ok {
+		if onlySegments != nil && !names[info.info.Name] {
 			continue
 		}
 		segInfoStat := new(SegmentInfoStatus)
@@ -292,7 +373,16 @@ func (ch *CheckIndex) CheckIndex(onlySegments []string) *CheckIndexStatus {
 		}
 
 		toLoseDocCount := infoDocCount
-		err = func() error {
+		var stack []byte
+		err = func() (err error) {
+			defer func() {
+				// a corrupt segment may well make the readers panic
+				if r := recover(); r != nil {
+					stack = debug.Stack()
+					err = errors.New(fmt.Sprintf("%v", r))
+				}
+			}()
+
 			codec := info.info.Codec().(Codec)
 			ch.msg("    codec = %v", codec)
 			segInfoStat.codec = codec
@@ -433,13 +523,16 @@ func (ch *CheckIndex) CheckIndex(onlySegments []string) *CheckIndexStatus {
 			ch.msg("FAILED")
 			comment := "fixIndex() would remove reference to this segment"
 			ch.msg("    WARNING: %v; full error:", comment)
-			ch.msg(string(debug.Stack()))
+			ch.msg("%v", err)
+			if ch.verbose && stack != nil {
+				ch.msg("%s", stack)
+			}
 			ch.msg("")
-			result.totLoseDocCount += toLoseDocCount
+			result.TotLoseDocCount += toLoseDocCount
 			result.numBadSegments++
 		} else {
 			// Keeper
-			result.newSegments.Segments = append(result.newSegments.Segments, info.Clone())
+			result.NewSegments.Segments = append(result.NewSegments.Segments, info.Clone())
 		}
 	}
 
@@ -448,13 +541,13 @@ func (ch *CheckIndex) CheckIndex(onlySegments []string) *CheckIndexStatus {
 	} else {
 		ch.msg(
 			"WARNING: %v broken segments (containing %v documents) detected",
-			result.numBadSegments, result.totLoseDocCount)
+			result.numBadSegments, result.TotLoseDocCount)
 	}
 
 	result.validCounter = result.maxSegmentName < sis.counter
 	if !result.validCounter {
 		result.Clean = false
-		result.newSegments.counter = result.maxSegmentName + 1
+		result.NewSegments.counter = result.maxSegmentName + 1
 		ch.msg(
 			"ERROR: Next segment name counter %v is not greater than max segment name %v",
 			sis.counter, result.maxSegmentName)
@@ -467,22 +560,939 @@ func (ch *CheckIndex) CheckIndex(onlySegments []string) *CheckIndexStatus {
 	return result
 }
 
+/*
+Repairs the index using previously returned result from CheckIndex.
+Note that this does not remove any of the unreferenced files after
+it's done; you must separately open an IndexWriter, which deletes
+unreferenced files when it's created.
+
+WARNING: this writes a new segments file into the index, effectively
+removing all documents in broken segments from the index. BE CAREFUL.
+
+WARNING: Make sure you only call this when the index is not opened
+by any writer.
+*/
+func (ch *CheckIndex) FixIndex(result *CheckIndexStatus) error {
+	if result.Partial {
+		return errors.New("can only fix an index that was fully checked (this status checked a subset of segments)")
+	}
+	result.NewSegments.changed()
+	return result.NewSegments.commit(result.dir)
+}
+
+/* Test field norms. */
 func (ch *CheckIndex) testFieldNorms(reader AtomicReader) *FieldNormStatus {
-	panic("not implemented yet")
+	status := new(FieldNormStatus)
+	ch.msg("    test: field norms.........")
+	status.err = func() error {
+		for _, info := range reader.FieldInfos().Values {
+			norms, err := reader.NormValues(info.Name)
+			if err != nil {
+				return err
+			}
+			if info.HasNorms() {
+				if err = ch.checkNorms(info, reader, norms); err != nil {
+					return err
+				}
+				status.totFields++
+			} else if norms != nil {
+				return errors.New(fmt.Sprintf(
+					"field: %v should omit norms but has them!", info.Name))
+			}
+		}
+		return nil
+	}()
+	if status.err != nil {
+		ch.msg("ERROR [%v]", status.err)
+	} else {
+		ch.msg("OK [%v fields]", status.totFields)
+	}
+	return status
+}
+
+func (ch *CheckIndex) checkNorms(fi model.FieldInfo, reader AtomicReader, norms NumericDocValues) error {
+	switch fi.NormType() {
+	case model.DOC_VALUES_TYPE_NUMERIC:
+		if norms == nil {
+			return errors.New(fmt.Sprintf("field: %v has norms but reader returns none", fi.Name))
+		}
+		checkNumericDocValues(fi.Name, reader, norms)
+		return nil
+	default:
+		panic(fmt.Sprintf("wtf: %v", fi.NormType()))
+	}
 }
 
+/* Test the term index. */
 func (ch *CheckIndex) testPostings(reader AtomicReader) *TermIndexStatus {
-	panic("not implemented yet")
+	// TODO: we should go and verify term vectors match, if crossCheckTermVectors is on...
+	maxDoc := reader.MaxDoc()
+	liveDocs := reader.LiveDocs()
+
+	ch.msg("    test: terms, freq, prox...")
+	fields := reader.Fields()
+	status, err := ch.checkFields(fields, liveDocs, maxDoc, reader.FieldInfos(), true, false)
+	if err == nil && liveDocs != nil {
+		ch.msg("    test (ignoring deletes): terms, freq, prox...")
+		_, err = ch.checkFields(fields, nil, maxDoc, reader.FieldInfos(), true, false)
+	}
+	if err != nil {
+		ch.msg("ERROR: %v", err)
+		status = &TermIndexStatus{err: err}
+	}
+	return status
+}
+
+/*
+Checks the Fields api is consistent with itself. Unlike Lucene Java,
+fields can't be enumerated, so the indexed fields are visited in
+FieldInfos order instead.
+*/
+func (ch *CheckIndex) checkFields(fields Fields, liveDocs util.Bits,
+	maxDoc int, fieldInfos model.FieldInfos, doPrint, isVectors bool) (*TermIndexStatus, error) {
+
+	status := new(TermIndexStatus)
+	if fields == nil {
+		ch.msg("OK [no fields/terms]")
+		return status, nil
+	}
+
+	var docs DocsEnum
+	var postings DocsAndPositionsEnum
+
+	for _, fieldInfo := range fieldInfos.Values {
+		field := fieldInfo.Name
+		terms := fields.Terms(field)
+		if terms == nil {
+			continue
+		}
+		// check that the field is in fieldinfos, and is indexed.
+		if !fieldInfo.IsIndexed() {
+			return nil, errors.New(fmt.Sprintf(
+				"fieldsEnum inconsistent with fieldInfos, isIndexed == false for: %v", field))
+		}
+
+		hasPositions := terms.HasPositions()
+		hasOffsets := terms.HasOffsets()
+		// term vectors cannot omit TF
+		hasFreqs := isVectors || fieldInfo.IndexOptions() >= model.INDEX_OPT_DOCS_AND_FREQS
+
+		termsEnum := terms.Iterator(nil)
+		termCountStart := status.delTermCount + status.termCount
+
+		var lastTerm []byte
+		var sumTotalTermFreq, sumDocFreq int64
+		visitedDocs := util.NewFixedBitSet(maxDoc)
+		for {
+			term, err := termsEnum.Next()
+			if err != nil {
+				return nil, err
+			}
+			if term == nil {
+				break
+			}
+
+			// make sure terms arrive in order according to the comp
+			if lastTerm != nil && bytes.Compare(lastTerm, term) >= 0 {
+				return nil, errors.New(fmt.Sprintf(
+					"terms out of order: lastTerm=%v term=%v", lastTerm, term))
+			}
+			lastTerm = append(lastTerm[:0], term...)
+
+			docFreq, err := termsEnum.DocFreq()
+			if err != nil {
+				return nil, err
+			}
+			if docFreq <= 0 {
+				return nil, errors.New(fmt.Sprintf("docfreq: %v is out of bounds", docFreq))
+			}
+			sumDocFreq += int64(docFreq)
+
+			if docs, err = termsEnum.Docs(liveDocs, docs); err != nil {
+				return nil, err
+			}
+			postings = termsEnum.DocsAndPositions(liveDocs, postings)
+
+			// TODO check ord once a codec supports it
+
+			var docs2 DocsEnum = docs
+			if postings != nil {
+				docs2 = postings
+			}
+
+			lastDoc, docCount := -1, 0
+			var totalTermFreq int64
+			for {
+				doc, err := docs2.NextDoc()
+				if err != nil {
+					return nil, err
+				}
+				if doc == NO_MORE_DOCS {
+					break
+				}
+				status.totFreq++
+				visitedDocs.Set(doc)
+				freq := -1
+				if hasFreqs {
+					if freq, err = docs2.Freq(); err != nil {
+						return nil, err
+					}
+					if freq <= 0 {
+						return nil, errors.New(fmt.Sprintf(
+							"term %v: doc %v: freq %v is out of bounds", term, doc, freq))
+					}
+					status.totPos += int64(freq)
+					totalTermFreq += int64(freq)
+				}
+				docCount++
+
+				if doc <= lastDoc {
+					return nil, errors.New(fmt.Sprintf(
+						"term %v: doc %v <= lastDoc %v", term, doc, lastDoc))
+				}
+				if doc >= maxDoc {
+					return nil, errors.New(fmt.Sprintf(
+						"term %v: doc %v >= maxDoc %v", term, doc, maxDoc))
+				}
+
+				lastDoc = doc
+
+				lastPos, lastOffset := -1, 0
+				if hasPositions {
+					for j := 0; j < freq; j++ {
+						pos, err := postings.NextPosition()
+						if err != nil {
+							return nil, err
+						}
+						if pos < 0 {
+							return nil, errors.New(fmt.Sprintf(
+								"term %v: doc %v: pos %v is out of bounds", term, doc, pos))
+						}
+						if pos < lastPos {
+							return nil, errors.New(fmt.Sprintf(
+								"term %v: doc %v: pos %v < lastPos %v", term, doc, pos, lastPos))
+						}
+						lastPos = pos
+						payload, err := postings.Payload()
+						if err != nil {
+							return nil, err
+						}
+						if payload != nil && len(payload) < 1 {
+							return nil, errors.New(fmt.Sprintf(
+								"term %v: doc %v: pos %v payload length is out of bounds %v",
+								term, doc, pos, len(payload)))
+						}
+						if hasOffsets {
+							startOffset, err := postings.StartOffset()
+							if err != nil {
+								return nil, err
+							}
+							endOffset, err := postings.EndOffset()
+							if err != nil {
+								return nil, err
+							}
+							// NOTE: we cannot enforce any bounds whatsoever on
+							// vectors... they were a free-for-all before? but
+							// for offsets in the postings lists these checks
+							// are fine: they were always enforced by IndexWriter
+							if !isVectors {
+								if err = checkOffsets(term, doc, pos, startOffset, endOffset, lastOffset); err != nil {
+									return nil, err
+								}
+							}
+							lastOffset = startOffset
+						}
+					}
+				}
+			}
+
+			if docCount != 0 {
+				status.termCount++
+			} else {
+				status.delTermCount++
+			}
+
+			totalTermFreq2, err := termsEnum.TotalTermFreq()
+			if err != nil {
+				return nil, err
+			}
+			hasTotalTermFreq := hasFreqs && totalTermFreq2 != -1
+
+			// Re-count if there are deleted docs:
+			if liveDocs != nil {
+				flags := DOCS_ENUM_FLAG_NONE
+				if hasFreqs {
+					flags = DOCS_ENUM_FLAG_FREQS
+				}
+				docsNoDel, err := termsEnum.DocsByFlags(nil, docs, flags)
+				if err != nil {
+					return nil, err
+				}
+				docCount, totalTermFreq = 0, 0
+				for {
+					doc, err := docsNoDel.NextDoc()
+					if err != nil {
+						return nil, err
+					}
+					if doc == NO_MORE_DOCS {
+						break
+					}
+					visitedDocs.Set(doc)
+					docCount++
+					if hasFreqs {
+						freq, err := docsNoDel.Freq()
+						if err != nil {
+							return nil, err
+						}
+						totalTermFreq += int64(freq)
+					}
+				}
+			}
+
+			if docCount != docFreq {
+				return nil, errors.New(fmt.Sprintf(
+					"term %v docFreq=%v != tot docs w/o deletions %v", term, docFreq, docCount))
+			}
+			if hasTotalTermFreq {
+				if totalTermFreq2 <= 0 {
+					return nil, errors.New(fmt.Sprintf(
+						"totalTermFreq: %v is out of bounds", totalTermFreq2))
+				}
+				sumTotalTermFreq += totalTermFreq
+				if totalTermFreq != totalTermFreq2 {
+					return nil, errors.New(fmt.Sprintf(
+						"term %v totalTermFreq=%v != recomputed totalTermFreq=%v",
+						term, totalTermFreq2, totalTermFreq))
+				}
+			}
+
+			// TODO test skipping once DocIdSetIterator supports advance
+		}
+
+		if sumTotalTermFreq != 0 {
+			if v := terms.SumTotalTermFreq(); v != -1 && sumTotalTermFreq != v {
+				return nil, errors.New(fmt.Sprintf(
+					"sumTotalTermFreq for field %v=%v != recomputed sumTotalTermFreq=%v",
+					field, v, sumTotalTermFreq))
+			}
+		}
+
+		if sumDocFreq != 0 {
+			if v := terms.SumDocFreq(); v != -1 && sumDocFreq != v {
+				return nil, errors.New(fmt.Sprintf(
+					"sumDocFreq for field %v=%v != recomputed sumDocFreq=%v",
+					field, v, sumDocFreq))
+			}
+		}
+
+		if v := terms.DocCount(); v != -1 && visitedDocs.Cardinality() != v {
+			return nil, errors.New(fmt.Sprintf(
+				"docCount for field %v=%v != recomputed docCount=%v",
+				field, v, visitedDocs.Cardinality()))
+		}
+
+		// Test seek to last term:
+		if lastTerm != nil {
+			found, err := termsEnum.SeekExact(lastTerm)
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				return nil, errors.New(fmt.Sprintf("seek to last term %v failed", lastTerm))
+			}
+
+			expectedDocFreq, err := termsEnum.DocFreq()
+			if err != nil {
+				return nil, err
+			}
+			d, err := termsEnum.DocsByFlags(nil, nil, DOCS_ENUM_FLAG_NONE)
+			if err != nil {
+				return nil, err
+			}
+			docFreq := 0
+			for {
+				doc, err := d.NextDoc()
+				if err != nil {
+					return nil, err
+				}
+				if doc == NO_MORE_DOCS {
+					break
+				}
+				docFreq++
+			}
+			if docFreq != expectedDocFreq {
+				return nil, errors.New(fmt.Sprintf(
+					"docFreq for last term %v=%v != recomputed docFreq=%v",
+					lastTerm, expectedDocFreq, docFreq))
+			}
+		}
+
+		// check unique term count
+		if n := status.delTermCount + status.termCount - termCountStart; n > 0 {
+			if termCount := terms.Size(); termCount != -1 && termCount != n {
+				return nil, errors.New(fmt.Sprintf(
+					"termCount mismatch %v vs %v", termCount, n))
+			}
+		}
+
+		// TODO test seeking by ord once a codec supports it
+	}
+
+	if doPrint {
+		ch.msg("OK [%v terms; %v terms/docs pairs; %v tokens]",
+			status.termCount, status.totFreq, status.totPos)
+	}
+	return status, nil
 }
 
+func checkOffsets(term []byte, doc, pos, startOffset, endOffset, lastOffset int) error {
+	if startOffset < 0 {
+		return errors.New(fmt.Sprintf(
+			"term %v: doc %v: pos %v: startOffset %v is out of bounds",
+			term, doc, pos, startOffset))
+	}
+	if startOffset < lastOffset {
+		return errors.New(fmt.Sprintf(
+			"term %v: doc %v: pos %v: startOffset %v < lastStartOffset %v",
+			term, doc, pos, startOffset, lastOffset))
+	}
+	if endOffset < 0 {
+		return errors.New(fmt.Sprintf(
+			"term %v: doc %v: pos %v: endOffset %v is out of bounds",
+			term, doc, pos, endOffset))
+	}
+	if endOffset < startOffset {
+		return errors.New(fmt.Sprintf(
+			"term %v: doc %v: pos %v: endOffset %v < startOffset %v",
+			term, doc, pos, endOffset, startOffset))
+	}
+	return nil
+}
+
+/* Test stored fields. */
 func (ch *CheckIndex) testStoredFields(reader AtomicReader) *StoredFieldStatus {
-	panic("not implemented yet")
+	status := new(StoredFieldStatus)
+	ch.msg("    test: stored fields.......")
+	status.err = func() error {
+		// Scan stored fields for all documents
+		liveDocs := reader.LiveDocs()
+		for j := 0; j < reader.MaxDoc(); j++ {
+			// Intentionally pull even deleted documents to make sure they
+			// too are not corrupt:
+			doc, err := reader.Document(j)
+			if err != nil {
+				return err
+			}
+			if liveDocs == nil || liveDocs.At(j) {
+				status.docCount++
+				status.totFields += int64(len(doc.Fields()))
+			}
+		}
+
+		// Validate docCount
+		if status.docCount != reader.NumDocs() {
+			return errors.New(fmt.Sprintf(
+				"docCount=%v but saw %v undeleted docs",
+				reader.NumDocs(), status.docCount))
+		}
+		return nil
+	}()
+	if status.err != nil {
+		ch.msg("ERROR [%v]", status.err)
+	} else {
+		var avg float64
+		if status.docCount > 0 {
+			avg = float64(status.totFields) / float64(status.docCount)
+		}
+		ch.msg("OK [%v total field count; avg %.3g fields per doc]", status.totFields, avg)
+	}
+	return status
 }
 
+/* Test docvalues. */
 func (ch *CheckIndex) testDocValues(reader AtomicReader) *DocValuesStatus {
-	panic("not implemented yet")
+	status := new(DocValuesStatus)
+	ch.msg("    test: docvalues...........")
+	status.err = func() error {
+		for _, fieldInfo := range reader.FieldInfos().Values {
+			if fieldInfo.HasDocValues() {
+				status.totalValueFields++
+				if err := checkDocValues(fieldInfo, reader, status); err != nil {
+					return err
+				}
+			} else if fieldInfo.Name != "" {
+				n, err := numDocValuesTypes(fieldInfo.Name, reader)
+				if err != nil {
+					return err
+				}
+				if n > 0 {
+					return errors.New(fmt.Sprintf(
+						"field: %v has docvalues but should omit them!", fieldInfo.Name))
+				}
+			}
+		}
+		return nil
+	}()
+	if status.err != nil {
+		ch.msg("ERROR [%v]", status.err)
+	} else {
+		ch.msg("OK [%v docvalues fields; %v BINARY; %v NUMERIC; %v SORTED; %v SORTED_SET]",
+			status.totalValueFields, status.totalBinaryFields, status.totalNumericFields,
+			status.totalSortedFields, status.totalSortedSetFields)
+	}
+	return status
+}
+
+// Returns how many types of doc values the reader returns for field.
+func numDocValuesTypes(field string, reader AtomicReader) (n int, err error) {
+	var binary BinaryDocValues
+	var numeric NumericDocValues
+	var sorted SortedDocValues
+	var sortedSet SortedSetDocValues
+	if binary, err = reader.BinaryDocValues(field); err != nil {
+		return 0, err
+	}
+	if numeric, err = reader.NumericDocValues(field); err != nil {
+		return 0, err
+	}
+	if sorted, err = reader.SortedDocValues(field); err != nil {
+		return 0, err
+	}
+	if sortedSet, err = reader.SortedSetDocValues(field); err != nil {
+		return 0, err
+	}
+	for _, ok := range []bool{binary != nil, numeric != nil, sorted != nil, sortedSet != nil} {
+		if ok {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func checkBinaryDocValues(fieldName string, reader AtomicReader, dv BinaryDocValues) {
+	for i := 0; i < reader.MaxDoc(); i++ {
+		dv.value(i)
+	}
+}
+
+func checkSortedDocValues(fieldName string, reader AtomicReader, dv SortedDocValues) error {
+	checkBinaryDocValues(fieldName, reader, dv)
+	maxOrd := dv.valueCount() - 1
+	seenOrds := util.NewFixedBitSet(dv.valueCount())
+	maxOrd2 := -1
+	for i := 0; i < reader.MaxDoc(); i++ {
+		ord := dv.ord(i)
+		if ord == -1 {
+			continue // missing value
+		}
+		if ord < -1 || ord > maxOrd {
+			return errors.New(fmt.Sprintf("ord out of bounds: %v", ord))
+		}
+		if ord > maxOrd2 {
+			maxOrd2 = ord
+		}
+		seenOrds.Set(ord)
+	}
+	if maxOrd != maxOrd2 {
+		return errors.New(fmt.Sprintf(
+			"dv for field: %v reports wrong maxOrd=%v but this is not the case: %v",
+			fieldName, maxOrd, maxOrd2))
+	}
+	if n := seenOrds.Cardinality(); n != dv.valueCount() {
+		return errors.New(fmt.Sprintf(
+			"dv for field: %v has holes in its ords, valueCount=%v but only used: %v",
+			fieldName, dv.valueCount(), n))
+	}
+	var lastValue []byte
+	for i := 0; i <= maxOrd; i++ {
+		term := dv.lookupOrd(i)
+		if lastValue != nil && bytes.Compare(term, lastValue) <= 0 {
+			return errors.New(fmt.Sprintf(
+				"dv for field: %v has ords out of order: %v >=%v",
+				fieldName, lastValue, term))
+		}
+		lastValue = append([]byte{}, term...)
+	}
+	return nil
 }
 
+func checkSortedSetDocValues(fieldName string, reader AtomicReader, dv SortedSetDocValues) error {
+	maxOrd := dv.valueCount() - 1
+	seenOrds := make(map[int64]bool)
+	maxOrd2 := int64(-1)
+	for i := 0; i < reader.MaxDoc(); i++ {
+		dv.setDocument(i)
+		lastOrd := int64(-1)
+		for ord := dv.nextOrd(); ord != NO_MORE_ORDS; ord = dv.nextOrd() {
+			if ord <= lastOrd {
+				return errors.New(fmt.Sprintf(
+					"ords out of order: %v <= %v for doc: %v", ord, lastOrd, i))
+			}
+			if ord < 0 || ord > maxOrd {
+				return errors.New(fmt.Sprintf("ord out of bounds: %v", ord))
+			}
+			lastOrd = ord
+			if ord > maxOrd2 {
+				maxOrd2 = ord
+			}
+			seenOrds[ord] = true
+		}
+	}
+	if maxOrd != maxOrd2 {
+		return errors.New(fmt.Sprintf(
+			"dv for field: %v reports wrong maxOrd=%v but this is not the case: %v",
+			fieldName, maxOrd, maxOrd2))
+	}
+	if n := int64(len(seenOrds)); n != dv.valueCount() {
+		return errors.New(fmt.Sprintf(
+			"dv for field: %v has holes in its ords, valueCount=%v but only used: %v",
+			fieldName, dv.valueCount(), n))
+	}
+	var lastValue []byte
+	for i := int64(0); i <= maxOrd; i++ {
+		term := dv.lookupOrd(i)
+		if lastValue != nil && bytes.Compare(term, lastValue) <= 0 {
+			return errors.New(fmt.Sprintf(
+				"dv for field: %v has ords out of order: %v >=%v",
+				fieldName, lastValue, term))
+		}
+		lastValue = append([]byte{}, term...)
+	}
+	return nil
+}
+
+func checkNumericDocValues(fieldName string, reader AtomicReader, ndv NumericDocValues) {
+	for i := 0; i < reader.MaxDoc(); i++ {
+		ndv(i)
+	}
+}
+
+func checkDocValues(fi model.FieldInfo, reader AtomicReader, status *DocValuesStatus) error {
+	var err error
+	switch fi.DocValuesType() {
+	case model.DOC_VALUES_TYPE_SORTED:
+		status.totalSortedFields++
+		var dv SortedDocValues
+		if dv, err = reader.SortedDocValues(fi.Name); err == nil {
+			err = checkSortedDocValues(fi.Name, reader, dv)
+		}
+	case model.DOC_VALUES_TYPE_SORTED_SET:
+		status.totalSortedSetFields++
+		var dv SortedSetDocValues
+		if dv, err = reader.SortedSetDocValues(fi.Name); err == nil {
+			err = checkSortedSetDocValues(fi.Name, reader, dv)
+		}
+	case model.DOC_VALUES_TYPE_BINARY:
+		status.totalBinaryFields++
+		var dv BinaryDocValues
+		if dv, err = reader.BinaryDocValues(fi.Name); err == nil {
+			checkBinaryDocValues(fi.Name, reader, dv)
+		}
+	case model.DOC_VALUES_TYPE_NUMERIC:
+		status.totalNumericFields++
+		var dv NumericDocValues
+		if dv, err = reader.NumericDocValues(fi.Name); err == nil {
+			checkNumericDocValues(fi.Name, reader, dv)
+		}
+	default:
+		panic("assert fail")
+	}
+	if err != nil {
+		return err
+	}
+
+	n, err := numDocValuesTypes(fi.Name, reader)
+	if err != nil {
+		return err
+	}
+	if n != 1 {
+		return errors.New(fmt.Sprintf("%v returns %v docvalues types!", fi.Name, n))
+	}
+	return nil
+}
+
+/* Test term vectors. */
 func (ch *CheckIndex) testTermVectors(reader AtomicReader) *TermVectorStatus {
-	panic("not implemented yet")
+	status := new(TermVectorStatus)
+	ch.msg("    test: term vectors........")
+	status.err = ch.checkTermVectors(reader, status)
+	if status.err != nil {
+		ch.msg("ERROR [%v]", status.err)
+	} else {
+		var vectorAvg float64
+		if status.docCount > 0 {
+			vectorAvg = float64(status.totVectors) / float64(status.docCount)
+		}
+		ch.msg("OK [%v total vector count; avg %.3g term/freq vector fields per doc]",
+			status.totVectors, vectorAvg)
+	}
+	return status
+}
+
+func (ch *CheckIndex) checkTermVectors(reader AtomicReader, status *TermVectorStatus) error {
+	fieldInfos := reader.FieldInfos()
+	onlyDocIsDeleted := util.NewFixedBitSet(1)
+
+	var docs DocsEnum
+	var postings DocsAndPositionsEnum
+
+	// Only used if crossCheckTermVectors is true:
+	var postingsDocs DocsEnum
+	var postingsPostings DocsAndPositionsEnum
+
+	liveDocs := reader.LiveDocs()
+	var postingsFields Fields
+	// TODO: testTermsIndex
+	if ch.crossCheckTermVectors {
+		postingsFields = reader.Fields()
+	}
+
+	for j := 0; j < reader.MaxDoc(); j++ {
+		// Intentionally pull/visit (but don't count in stats) deleted
+		// documents to make sure they too are not corrupt:
+		tfv, err := reader.TermVectors(j)
+		if err != nil {
+			return err
+		}
+		if tfv == nil {
+			continue
+		}
+
+		// First run with no deletions:
+		if _, err = ch.checkFields(tfv, nil, 1, fieldInfos, false, true); err != nil {
+			return err
+		}
+		// Again, with the one doc deleted:
+		if _, err = ch.checkFields(tfv, onlyDocIsDeleted, 1, fieldInfos, false, true); err != nil {
+			return err
+		}
+
+		// Only agg stats if the doc is live:
+		doStats := liveDocs == nil || liveDocs.At(j)
+		if doStats {
+			status.docCount++
+		}
+
+		for _, fieldInfo := range fieldInfos.Values {
+			field := fieldInfo.Name
+			terms := tfv.Terms(field)
+			if terms == nil {
+				continue
+			}
+			if doStats {
+				status.totVectors++
+			}
+
+			// Make sure FieldInfo thinks this field is vector'd:
+			if !fieldInfo.HasVectors() {
+				return errors.New(fmt.Sprintf(
+					"docID=%v has term vectors for field=%v but FieldInfo has storeTermVector=false",
+					j, field))
+			}
+
+			if !ch.crossCheckTermVectors {
+				continue
+			}
+
+			termsEnum := terms.Iterator(nil)
+			postingsHasFreq := fieldInfo.IndexOptions() >= model.INDEX_OPT_DOCS_AND_FREQS
+			postingsHasPayload := fieldInfo.HasPayloads()
+			vectorsHasPayload := terms.HasPayloads()
+
+			var postingsTerms Terms
+			if postingsFields != nil {
+				postingsTerms = postingsFields.Terms(field)
+			}
+			if postingsTerms == nil {
+				return errors.New(fmt.Sprintf(
+					"vector field=%v does not exist in postings; doc=%v", field, j))
+			}
+			postingsTermsEnum := postingsTerms.Iterator(nil)
+
+			hasProx := terms.HasOffsets() || terms.HasPositions()
+			for {
+				term, err := termsEnum.Next()
+				if err != nil {
+					return err
+				}
+				if term == nil {
+					break
+				}
+
+				var docs2 DocsEnum
+				if hasProx {
+					postings = termsEnum.DocsAndPositions(nil, postings)
+					assert(postings != nil)
+					docs2 = postings
+				} else {
+					if docs, err = termsEnum.Docs(nil, docs); err != nil {
+						return err
+					}
+					assert(docs != nil)
+					docs2 = docs
+				}
+
+				found, err := postingsTermsEnum.SeekExact(term)
+				if err != nil {
+					return err
+				}
+				if !found {
+					return errors.New(fmt.Sprintf(
+						"vector term=%v field=%v does not exist in postings; doc=%v",
+						term, field, j))
+				}
+
+				var postingsDocs2 DocsEnum
+				postingsPostings = postingsTermsEnum.DocsAndPositions(nil, postingsPostings)
+				if postingsPostings != nil {
+					postingsDocs2 = postingsPostings
+				} else {
+					// Term vectors were indexed w/ pos but postings were not
+					if postingsDocs, err = postingsTermsEnum.Docs(nil, postingsDocs); err != nil {
+						return err
+					}
+					postingsDocs2 = postingsDocs
+				}
+
+				advanceDoc, err := advance(postingsDocs2, j)
+				if err != nil {
+					return err
+				}
+				if advanceDoc != j {
+					return errors.New(fmt.Sprintf(
+						"vector term=%v field=%v: doc=%v was not found in postings (got: %v)",
+						term, field, j, advanceDoc))
+				}
+
+				doc, err := docs2.NextDoc()
+				if err != nil {
+					return err
+				}
+				if doc != 0 {
+					return errors.New(fmt.Sprintf(
+						"vector for doc %v didn't return docID=0: got docID=%v", j, doc))
+				}
+
+				if !postingsHasFreq {
+					continue
+				}
+				tf, err := docs2.Freq()
+				if err != nil {
+					return err
+				}
+				if postingsFreq, err := postingsDocs2.Freq(); err != nil {
+					return err
+				} else if postingsFreq != tf {
+					return errors.New(fmt.Sprintf(
+						"vector term=%v field=%v doc=%v: freq=%v differs from postings freq=%v",
+						term, field, j, tf, postingsFreq))
+				}
+
+				if !hasProx {
+					continue
+				}
+				for i := 0; i < tf; i++ {
+					pos, err := postings.NextPosition()
+					if err != nil {
+						return err
+					}
+					if postingsPostings != nil {
+						postingsPos, err := postingsPostings.NextPosition()
+						if err != nil {
+							return err
+						}
+						if terms.HasPositions() && pos != postingsPos {
+							return errors.New(fmt.Sprintf(
+								"vector term=%v field=%v doc=%v: pos=%v differs from postings pos=%v",
+								term, field, j, pos, postingsPos))
+						}
+					}
+
+					// Call the methods to at least make sure they don't
+					// return errors:
+					startOffset, err := postings.StartOffset()
+					if err != nil {
+						return err
+					}
+					endOffset, err := postings.EndOffset()
+					if err != nil {
+						return err
+					}
+					if startOffset != -1 && endOffset != -1 && postingsTerms.HasOffsets() {
+						postingsStartOffset, err := postingsPostings.StartOffset()
+						if err != nil {
+							return err
+						}
+						postingsEndOffset, err := postingsPostings.EndOffset()
+						if err != nil {
+							return err
+						}
+						if startOffset != postingsStartOffset {
+							return errors.New(fmt.Sprintf(
+								"vector term=%v field=%v doc=%v: startOffset=%v differs from postings startOffset=%v",
+								term, field, j, startOffset, postingsStartOffset))
+						}
+						if endOffset != postingsEndOffset {
+							return errors.New(fmt.Sprintf(
+								"vector term=%v field=%v doc=%v: endOffset=%v differs from postings endOffset=%v",
+								term, field, j, endOffset, postingsEndOffset))
+						}
+					}
+
+					payload, err := postings.Payload()
+					if err != nil {
+						return err
+					}
+					assert(payload == nil || vectorsHasPayload)
+
+					if postingsHasPayload && vectorsHasPayload {
+						assert(postingsPostings != nil)
+						postingsPayload, err := postingsPostings.Payload()
+						if err != nil {
+							return err
+						}
+						if payload == nil {
+							// we have payloads, but not at this position.
+							// postings has payloads too, it should not have
+							// one at this position
+							if postingsPayload != nil {
+								return errors.New(fmt.Sprintf(
+									"vector term=%v field=%v doc=%v has no payload but postings does: %v",
+									term, field, j, postingsPayload))
+							}
+						} else {
+							// we have payloads, and one at this position
+							// postings should also have one at this position,
+							// with the same bytes.
+							if postingsPayload == nil {
+								return errors.New(fmt.Sprintf(
+									"vector term=%v field=%v doc=%v has payload=%v but postings does not.",
+									term, field, j, payload))
+							}
+							if !bytes.Equal(payload, postingsPayload) {
+								return errors.New(fmt.Sprintf(
+									"vector term=%v field=%v doc=%v has payload=%v but differs from postings payload=%v",
+									term, field, j, payload, postingsPayload))
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+/*
+Advances to the first doc beyond the current one whose number is
+greater than or equal to target, the slow way, since
+DocIdSetIterator doesn't support advancing yet.
+*/
+func advance(it DocIdSetIterator, target int) (doc int, err error) {
+	for doc = it.DocId(); doc < target; {
+		if doc, err = it.NextDoc(); err != nil {
+			return 0, err
+		}
+	}
+	return doc, nil
 }
@@ -0,0 +1,257 @@
+package index
+
+import (
+	"bytes"
+	"github.com/balzaczyy/golucene/core/codec"
+	"github.com/balzaczyy/golucene/core/index/model"
+	"github.com/balzaczyy/golucene/core/store"
+	"github.com/balzaczyy/golucene/core/util"
+	"strings"
+	"testing"
+)
+
+func TestCheckIndex(t *testing.T) {
+	for _, path := range []string{
+		"../search/testdata/belfrysample",     // plain segment
+		"../search/testdata/osx/belfrysample", // compound file segment
+	} {
+		d, err := store.OpenFSDirectory(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		status := NewCheckIndex(d, true, &buf).CheckIndex(nil)
+		if !status.Clean {
+			t.Fatalf("%v: index is not clean:\n%v", path, buf.String())
+		}
+		for _, seg := range status.segmentInfos {
+			if seg.termIndexStatus.termCount == 0 {
+				t.Errorf("%v: segment %v has no terms", path, seg.name)
+			}
+			if seg.storedFieldStatus.docCount != seg.docCount {
+				t.Errorf("%v: segment %v: %v stored docs, expected %v",
+					path, seg.name, seg.storedFieldStatus.docCount, seg.docCount)
+			}
+		}
+		d.Close()
+	}
+}
+
+// Same as above, but reads through memory-mapped files with chunks
+// small enough to make term dictionary and doc values reads span them.
+func TestCheckIndexMMap(t *testing.T) {
+	for _, path := range []string{
+		"../search/testdata/belfrysample",
+		"../search/testdata/osx/belfrysample",
+	} {
+		d, err := store.NewMMapDirectoryWithChunkSize(path, 256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if status := NewCheckIndex(d, true, &buf).CheckIndex(nil); !status.Clean {
+			t.Fatalf("%v: index is not clean:\n%v", path, buf.String())
+		}
+		d.Close()
+	}
+}
+
+func TestCheckIndexBlockCache(t *testing.T) {
+	for _, path := range []string{
+		"../search/testdata/belfrysample",
+		"../search/testdata/osx/belfrysample",
+	} {
+		fsDir, err := store.OpenFSDirectory(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := store.NewBlockCacheDirectory(fsDir, 256, 1)
+		for i := 0; i < 2; i++ {
+			var buf bytes.Buffer
+			if status := NewCheckIndex(d, true, &buf).CheckIndex(nil); !status.Clean {
+				t.Fatalf("%v: index is not clean:\n%v", path, buf.String())
+			}
+		}
+		if stats := d.Stats(); stats.Hits == 0 {
+			t.Errorf("%v: expected the second check to hit the cache: %v", path, stats)
+		}
+		d.Close()
+	}
+}
+
+func TestFixIndex(t *testing.T) {
+	src, err := store.OpenFSDirectory("../search/testdata/belfrysample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	// two copies of the sample, so that fixing keeps one segment
+	d := store.NewRAMDirectory()
+	w, err := NewIndexWriter(d, NewIndexWriterConfig(util.VERSION_45, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err = w.AddIndexes(src); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var sis SegmentInfos
+	if err = sis.ReadAll(d); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(sis.Segments); n != 2 {
+		t.Fatalf("Expected 2 segments, got %v", n)
+	}
+	broken, kept := sis.Segments[0].info, sis.Segments[1].info
+	for file := range broken.Files() {
+		if strings.HasSuffix(file, ".fdt") {
+			if err = d.DeleteFile(file); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	checker := NewCheckIndex(d, false, &buf)
+	status := checker.CheckIndex([]string{kept.Name})
+	if !status.Clean {
+		t.Fatalf("Segment %v should be clean:\n%v", kept.Name, buf.String())
+	}
+	if err = checker.FixIndex(status); err == nil {
+		t.Error("Should not fix a partially checked index.")
+	}
+
+	status = checker.CheckIndex(nil)
+	if status.Clean {
+		t.Fatalf("Index should be broken:\n%v", buf.String())
+	}
+	if status.numBadSegments != 1 || status.TotLoseDocCount != broken.DocCount() {
+		t.Fatalf("Expected 1 bad segment with %v docs, got %v with %v docs",
+			broken.DocCount(), status.numBadSegments, status.TotLoseDocCount)
+	}
+	if err = checker.FixIndex(status); err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+	if status = checker.CheckIndex(nil); !status.Clean {
+		t.Fatalf("Index should be clean after fix:\n%v", buf.String())
+	}
+	if n := len(status.segmentInfos); n != 1 || status.segmentInfos[0].name != kept.Name {
+		t.Errorf("Expected only segment %v to be left, got %v segments", kept.Name, n)
+	}
+}
+
+func corruptRAMFile(t *testing.T, dir *store.RAMDirectory, name string, pos int64) {
+	f := dir.GetRAMFile(name)
+	if f == nil {
+		t.Fatalf("File %v not found", name)
+	}
+	f.Buffer(int(pos / store.BUFFER_SIZE))[pos%store.BUFFER_SIZE] ^= 0xFF
+}
+
+func assertCorrupt(t *testing.T, err error, what string) {
+	if _, ok := err.(*codec.CorruptIndexError); !ok {
+		t.Errorf("%v: expected CorruptIndexError, but found %v", what, err)
+	}
+}
+
+func TestCheckIntegrity(t *testing.T) {
+	dir := store.NewRAMDirectory()
+	lucene42 := LoadCodec("Lucene42")
+
+	// term vectors: .tvx is verified at open, .tvd on demand
+	info := model.NewSegmentInfo(dir, util.LUCENE_MAIN_VERSION, "_0", vectorsTestNumDocs, false, lucene42, nil, nil)
+	fieldInfos := writeVectorsTestSegment(t, dir, info)
+	vectors, err := lucene42.TermVectorsFormat().VectorsReader(dir, info, fieldInfos, store.IO_CONTEXT_READ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = vectors.CheckIntegrity(); err != nil {
+		t.Errorf("Term vectors should pass the integrity check: %v", err)
+	}
+	tvd, _ := dir.FileLength("_0.tvd")
+	corruptRAMFile(t, dir, "_0.tvd", tvd/2)
+	assertCorrupt(t, vectors.CheckIntegrity(), "_0.tvd")
+	vectors.Close()
+
+	tvx, _ := dir.FileLength("_0.tvx")
+	corruptRAMFile(t, dir, "_0.tvx", tvx-1)
+	_, err = lucene42.TermVectorsFormat().VectorsReader(dir, info, fieldInfos, store.IO_CONTEXT_READ)
+	assertCorrupt(t, err, "_0.tvx")
+
+	// postings
+	info = model.NewSegmentInfo(dir, util.LUCENE_MAIN_VERSION, "_1", flushTestNumDocs, false, lucene42, nil, nil)
+	fieldInfos = flushTestPostings(t, dir, info)
+	fields, err := lucene42.PostingsFormat().FieldsProducer(newSegmentReadState(
+		dir, info, fieldInfos, store.IO_CONTEXT_READ, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fields.Close()
+	if err = fields.CheckIntegrity(); err != nil {
+		t.Errorf("Postings should pass the integrity check: %v", err)
+	}
+	names, _ := dir.ListAll()
+	for _, name := range names {
+		if strings.HasPrefix(name, "_1") && strings.HasSuffix(name, ".doc") {
+			n, _ := dir.FileLength(name)
+			corruptRAMFile(t, dir, name, n/2)
+			assertCorrupt(t, fields.CheckIntegrity(), name)
+			return
+		}
+	}
+	t.Errorf("No .doc file found in %v", names)
+}
+
+func TestCheckIntegrityUnchecksummed(t *testing.T) {
+	for _, path := range []string{
+		"../search/testdata/belfrysample",     // plain segment
+		"../search/testdata/osx/belfrysample", // compound file segment
+	} {
+		src, err := store.OpenFSDirectory(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := store.NewRAMDirectory()
+		names, err := src.ListAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var largest string
+		var largestLength int64
+		for _, name := range names {
+			if !strings.HasPrefix(name, "_") && !strings.HasPrefix(name, "segments") {
+				continue // not an index file
+			}
+			if err = src.Copy(d, name, name, store.IO_CONTEXT_DEFAULT); err != nil {
+				t.Fatal(err)
+			}
+			if n, _ := src.FileLength(name); n > largestLength {
+				largest, largestLength = name, n
+			}
+		}
+		src.Close()
+
+		r, err := OpenDirectoryReader(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = r.CheckIntegrity(); err != nil {
+			t.Errorf("%v: 4.5 index should pass the integrity check: %v", path, err)
+		}
+		// version 0 files have no footer, so they are skipped rather
+		// than verified
+		corruptRAMFile(t, d, largest, largestLength/2)
+		if err = r.CheckIntegrity(); err != nil {
+			t.Errorf("%v: %v has no checksum but was verified: %v", path, largest, err)
+		}
+		r.Close()
+	}
+}
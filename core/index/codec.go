@@ -1,11 +1,13 @@
 package index
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/balzaczyy/golucene/core/index/model"
 	"github.com/balzaczyy/golucene/core/store"
 	"github.com/balzaczyy/golucene/core/util"
 	"io"
+	"sort"
 )
 
 // codecs/Codec.java
@@ -124,7 +126,18 @@ func AvailableCodecs() []string {
 	return ans
 }
 
-// Expert: returns the default codec used for newly created IndexWriterConfig(s).
+/*
+Expert: returns the default codec used for newly created
+IndexWriterConfig(s).
+
+NOTE: segments are still written under the codec name "Lucene45",
+but their files now carry checksum footers with bumped format
+versions (e.g. CP_VERSION_CHECKSUM, CFD_VERSION_CHECKSUM), as in
+Lucene 4.8. Indexes written by this package can therefore no longer
+be read by Lucene 4.5, which rejects these versions as too new.
+Existing 4.5 indexes can still be read; their files have no footer
+and are skipped by CheckIntegrity().
+*/
 var DefaultCodec = func() Codec { return LoadCodec("Lucene45") }
 
 // codecs/PostingsFormat.java
@@ -210,8 +223,287 @@ The lifecycle is:
 1. FieldsConsumer is created by PostingsFormat.FieldsConsumer().
 2. For each field, AddField() is called, returning a TermsConsumer
 for the field.
+3. After all fields are added, the consumer is closed.
 */
 type FieldsConsumer interface {
+	io.Closer
+	// Add a new field
+	AddField(field model.FieldInfo) (TermsConsumer, error)
+}
+
+// codecs/TermsConsumer.java
+
+/*
+Abstract API that consumes terms for an individual field.
+
+The lifecycle is:
+
+1. TermsConsumer is returned for each field by FieldsConsumer.AddField().
+2. TermsConsumer returns a PostingsConsumer for each term in
+StartTerm().
+3. When the producer (e.g. IndexWriter) is done adding documents for
+the term, it calls FinishTerm(), passing in the accumulated term
+statistics.
+4. Producer calls Finish() with the accumulated collection
+statistics when it is finished adding terms to the field.
+*/
+type TermsConsumer interface {
+	// Starts a new term in this field; this may be called with no
+	// corresponding call to finish if the term had no docs.
+	StartTerm(text []byte) (PostingsConsumer, error)
+	// Finishes the current term; numDocs must be > 0. stats.TotalTermFreq
+	// will be -1 when term frequencies are omitted for the field.
+	FinishTerm(text []byte, stats *TermStats) error
+	// Called when we are done adding terms to this field.
+	// sumTotalTermFreq will be -1 when term frequencies are omitted
+	// for the field.
+	Finish(sumTotalTermFreq, sumDocFreq int64, docCount int) error
+}
+
+// codecs/TermStats.java
+
+// Holder for per-term statistics.
+type TermStats struct {
+	// How many documents have at least one occurrence of this term.
+	DocFreq int
+	// Total number of times this term occurs across all documents in
+	// the field.
+	TotalTermFreq int64
+}
+
+// codecs/PostingsConsumer.java
+
+/*
+Abstract API that consumes postings for an individual term.
+
+The lifecycle is:
+
+1. PostingsConsumer is returned for each term by
+TermsConsumer.StartTerm().
+2. StartDoc() is called for each document where the term occurs,
+specifying id and term frequency for that document.
+3. If positions are enabled for the field, then AddPosition() will be
+called for each occurrence in the document.
+4. FinishDoc() is called when the producer is done adding positions
+to the document.
+*/
+type PostingsConsumer interface {
+	// Adds a new doc in this term. freq will be -1 when term
+	// frequencies are omitted for the field.
+	StartDoc(docId, freq int) error
+	// Add a new position & payload, and start/end offset. A nil payload
+	// means no payload; a non-nil payload with zero length also means
+	// no payload. Caller may reuse the payload slice between calls
+	// (method must fully consume the payload). startOffset and
+	// endOffset will be -1 when offsets are not indexed.
+	AddPosition(position int, payload []byte, startOffset, endOffset int) error
+	// Called when we are done adding positions & payloads for each doc.
+	FinishDoc() error
+}
+
+/*
+Default merge implementation of FieldsConsumer: merges in the fields
+from the readers in mergeState. fields is the merged view over all
+readers, e.g. a MultiFields.
+*/
+func mergeFieldsConsumer(consumer FieldsConsumer, mergeState *MergeState, fields Fields) error {
+	// Fields can not be iterated, so walk the merged field infos in
+	// field name order instead.
+	var names []string
+	for _, info := range mergeState.fieldInfos.Values {
+		if info.IsIndexed() {
+			names = append(names, info.Name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, field := range names {
+		info := mergeState.fieldInfos.FieldInfoByName(field)
+		if terms := fields.Terms(field); terms != nil {
+			termsConsumer, err := consumer.AddField(info)
+			if err != nil {
+				return err
+			}
+			if err = mergeTermsConsumer(termsConsumer, mergeState,
+				info.IndexOptions(), terms.Iterator(nil)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+/*
+Default merge implementation of TermsConsumer: merges all terms of
+termsEnum, which must iterate over a MultiTermsEnum, remapping doc IDs
+around deletions.
+*/
+func mergeTermsConsumer(consumer TermsConsumer, mergeState *MergeState,
+	indexOptions model.IndexOptions, termsEnum TermsEnum) error {
+
+	assert(termsEnum != nil)
+	var sumTotalTermFreq, sumDocFreq, sumDFsinceLastAbortCheck int64
+	visitedDocs := util.NewFixedBitSet(mergeState.segmentInfo.DocCount())
+
+	mergeTerm := func(term []byte, postings DocsEnum) error {
+		postingsConsumer, err := consumer.StartTerm(term)
+		if err != nil {
+			return err
+		}
+		stats, err := mergePostingsConsumer(postingsConsumer, mergeState,
+			indexOptions, postings, visitedDocs)
+		if err != nil {
+			return err
+		}
+		if stats.DocFreq > 0 {
+			if err = consumer.FinishTerm(term, stats); err != nil {
+				return err
+			}
+			if indexOptions == model.INDEX_OPT_DOCS_ONLY {
+				sumTotalTermFreq += int64(stats.DocFreq)
+			} else {
+				sumTotalTermFreq += stats.TotalTermFreq
+			}
+			sumDFsinceLastAbortCheck += int64(stats.DocFreq)
+			sumDocFreq += int64(stats.DocFreq)
+			if sumDFsinceLastAbortCheck > 60000 {
+				if err = mergeState.checkAbort.work(float64(sumDFsinceLastAbortCheck) / 5); err != nil {
+					return err
+				}
+				sumDFsinceLastAbortCheck = 0
+			}
+		}
+		return nil
+	}
+
+	if indexOptions <= model.INDEX_OPT_DOCS_AND_FREQS {
+		flags := DOCS_ENUM_FLAG_FREQS
+		if indexOptions == model.INDEX_OPT_DOCS_ONLY {
+			flags = DOCS_ENUM_FLAG_NONE
+		}
+		docsEnum := newMappingMultiDocsEnum(mergeState)
+		var docsEnumIn DocsEnum
+		for {
+			term, err := termsEnum.Next()
+			if err != nil {
+				return err
+			}
+			if term == nil {
+				break
+			}
+			// We can pass nil for liveDocs, because the mapping enum will
+			// skip the non-live docs:
+			if docsEnumIn, err = termsEnum.DocsByFlags(nil, docsEnumIn, flags); err != nil {
+				return err
+			}
+			if docsEnumIn != nil {
+				docsEnum.reset(docsEnumIn.(*MultiDocsEnum))
+				if err = mergeTerm(term, docsEnum); err != nil {
+					return err
+				}
+			}
+		}
+	} else {
+		flags := DOCS_POSITIONS_ENUM_FLAG_PAYLOADS
+		if indexOptions == model.INDEX_OPT_DOCS_AND_FREQS_AND_POSITIONS_AND_OFFSETS {
+			flags |= DOCS_POSITIONS_ENUM_FLAG_OFF_SETS
+		}
+		postingsEnum := newMappingMultiDocsAndPositionsEnum(mergeState)
+		var postingsEnumIn DocsAndPositionsEnum
+		for {
+			term, err := termsEnum.Next()
+			if err != nil {
+				return err
+			}
+			if term == nil {
+				break
+			}
+			// We can pass nil for liveDocs, because the mapping enum will
+			// skip the non-live docs:
+			postingsEnumIn = termsEnum.DocsAndPositionsByFlags(nil, postingsEnumIn, flags)
+			assert(postingsEnumIn != nil)
+			postingsEnum.reset(postingsEnumIn.(*MultiDocsAndPositionsEnum))
+			if err = mergeTerm(term, postingsEnum); err != nil {
+				return err
+			}
+		}
+	}
+
+	if indexOptions == model.INDEX_OPT_DOCS_ONLY {
+		sumTotalTermFreq = -1
+	}
+	return consumer.Finish(sumTotalTermFreq, sumDocFreq, visitedDocs.Cardinality())
+}
+
+/*
+Default merge implementation of PostingsConsumer: merges in the
+postings from the mapped postings, marking each visited doc in
+visitedDocs. Returns the statistics of the merged term.
+*/
+func mergePostingsConsumer(consumer PostingsConsumer, mergeState *MergeState,
+	indexOptions model.IndexOptions, postings DocsEnum,
+	visitedDocs *util.FixedBitSet) (*TermStats, error) {
+
+	var df int
+	var totTF int64
+	for {
+		doc, err := postings.NextDoc()
+		if err != nil {
+			return nil, err
+		}
+		if doc == NO_MORE_DOCS {
+			break
+		}
+		visitedDocs.Set(doc)
+
+		freq := -1
+		if indexOptions != model.INDEX_OPT_DOCS_ONLY {
+			if freq, err = postings.Freq(); err != nil {
+				return nil, err
+			}
+			totTF += int64(freq)
+		}
+		if err = consumer.StartDoc(doc, freq); err != nil {
+			return nil, err
+		}
+
+		if indexOptions >= model.INDEX_OPT_DOCS_AND_FREQS_AND_POSITIONS {
+			postingsEnum := postings.(DocsAndPositionsEnum)
+			hasOffsets := indexOptions == model.INDEX_OPT_DOCS_AND_FREQS_AND_POSITIONS_AND_OFFSETS
+			for i := 0; i < freq; i++ {
+				position, err := postingsEnum.NextPosition()
+				if err != nil {
+					return nil, err
+				}
+				payload, err := postingsEnum.Payload()
+				if err != nil {
+					return nil, err
+				}
+				startOffset, endOffset := -1, -1
+				if hasOffsets {
+					if startOffset, err = postingsEnum.StartOffset(); err != nil {
+						return nil, err
+					}
+					if endOffset, err = postingsEnum.EndOffset(); err != nil {
+						return nil, err
+					}
+				}
+				if err = consumer.AddPosition(position, payload, startOffset, endOffset); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if err = consumer.FinishDoc(); err != nil {
+			return nil, err
+		}
+		df++
+	}
+
+	if indexOptions == model.INDEX_OPT_DOCS_ONLY {
+		totTF = -1
+	}
+	return &TermStats{df, totTF}, nil
 }
 
 // codecs/DocValuesFormat.java
@@ -273,7 +565,296 @@ rather than "push", and the implementation is free to iterate over
 the values multiple times.
 3. After all fields are added, the consumer is closed.
 */
-type DocValuesConsumer interface{}
+type DocValuesConsumer interface {
+	io.Closer
+	// Writes numeric docvalues for a field.
+	AddNumericField(field model.FieldInfo, values NumericIterable) error
+	// Writes binary docvalues for a field.
+	AddBinaryField(field model.FieldInfo, values BinaryIterable) error
+	// Writes pre-sorted binary docvalues for a field. values holds the
+	// unique sorted values, docToOrd the ordinal of each document.
+	AddSortedField(field model.FieldInfo, values BinaryIterable, docToOrd NumericIterable) error
+	// Writes pre-sorted set docvalues for a field. values holds the
+	// unique sorted values, docToOrdCount the number of ordinals of
+	// each document, and ords all ordinals, document by document.
+	AddSortedSetField(field model.FieldInfo, values BinaryIterable,
+		docToOrdCount, ords NumericIterable) error
+}
+
+/*
+Returns a fresh iterator over numeric values each time it is called,
+so that a DocValuesConsumer is free to iterate the values multiple
+times. The returned iterator reports false once exhausted.
+*/
+type NumericIterable func() func() (value int64, ok bool)
+
+/*
+Returns a fresh iterator over binary values each time it is called.
+The returned slices may be reused by the iterator between calls.
+*/
+type BinaryIterable func() func() (value []byte, ok bool)
+
+/*
+Returns an iterator over the (reader index, doc ID) of all live
+documents of the readers being merged, in merged doc ID order.
+*/
+func newLiveDocsIterator(mergeState *MergeState) func() (readerUpto, docID int, ok bool) {
+	readerUpto, docIDUpto := 0, 0
+	var liveDocs util.Bits
+	if len(mergeState.readers) > 0 {
+		liveDocs = mergeState.readers[0].LiveDocs()
+	}
+	return func() (int, int, bool) {
+		for readerUpto < len(mergeState.readers) {
+			if docIDUpto == mergeState.readers[readerUpto].MaxDoc() {
+				if readerUpto++; readerUpto < len(mergeState.readers) {
+					liveDocs = mergeState.readers[readerUpto].LiveDocs()
+				}
+				docIDUpto = 0
+				continue
+			}
+			docID := docIDUpto
+			docIDUpto++
+			if liveDocs == nil || liveDocs.At(docID) {
+				return readerUpto, docID, true
+			}
+		}
+		return 0, 0, false
+	}
+}
+
+/*
+Merges the numeric docvalues from toMerge. The default implementation
+calls AddNumericField(), passing an iterator that merges and filters
+deleted documents on the fly.
+*/
+func mergeNumericField(consumer DocValuesConsumer, fieldInfo model.FieldInfo,
+	mergeState *MergeState, toMerge []NumericDocValues) error {
+
+	return consumer.AddNumericField(fieldInfo, func() func() (int64, bool) {
+		next := newLiveDocsIterator(mergeState)
+		return func() (int64, bool) {
+			readerUpto, docID, ok := next()
+			if !ok {
+				return 0, false
+			}
+			return toMerge[readerUpto](docID), true
+		}
+	})
+}
+
+/*
+Merges the binary docvalues from toMerge. The default implementation
+calls AddBinaryField(), passing an iterator that merges and filters
+deleted documents on the fly.
+*/
+func mergeBinaryField(consumer DocValuesConsumer, fieldInfo model.FieldInfo,
+	mergeState *MergeState, toMerge []BinaryDocValues) error {
+
+	return consumer.AddBinaryField(fieldInfo, func() func() ([]byte, bool) {
+		next := newLiveDocsIterator(mergeState)
+		return func() ([]byte, bool) {
+			readerUpto, docID, ok := next()
+			if !ok {
+				return nil, false
+			}
+			return toMerge[readerUpto].value(docID), true
+		}
+	})
+}
+
+/*
+Maps per-segment ordinals to/from global ordinal space. Only the
+ordinals marked as live in each segment take part in the mapping.
+*/
+type ordinalMap struct {
+	// global ord -> value
+	values [][]byte
+	// segment -> segment ord -> global ord (-1 if the ord is unused)
+	segmentToGlobalOrds [][]int64
+}
+
+func newOrdinalMap(valueCounts []int64, liveOrds []*util.FixedBitSet,
+	lookupOrd func(segment int, ord int64) []byte) *ordinalMap {
+
+	type segmentOrd struct {
+		value   []byte
+		segment int
+		ord     int64
+	}
+	var all []segmentOrd
+	m := &ordinalMap{segmentToGlobalOrds: make([][]int64, len(valueCounts))}
+	for segment, valueCount := range valueCounts {
+		m.segmentToGlobalOrds[segment] = make([]int64, valueCount)
+		for ord := int64(0); ord < valueCount; ord++ {
+			m.segmentToGlobalOrds[segment][ord] = -1
+			if liveOrds[segment] == nil || liveOrds[segment].At(int(ord)) {
+				// lookupOrd may reuse its result
+				value := append([]byte(nil), lookupOrd(segment, ord)...)
+				all = append(all, segmentOrd{value, segment, ord})
+			}
+		}
+	}
+	// values within a segment are already sorted, so a stable sort
+	// keeps the first segment of each unique value in front
+	sort.SliceStable(all, func(i, j int) bool {
+		return bytes.Compare(all[i].value, all[j].value) < 0
+	})
+	for _, v := range all {
+		if n := len(m.values); n == 0 || !bytes.Equal(m.values[n-1], v.value) {
+			m.values = append(m.values, v.value)
+		}
+		m.segmentToGlobalOrds[v.segment][v.ord] = int64(len(m.values) - 1)
+	}
+	return m
+}
+
+// Given a segment number and segment ordinal, returns the
+// corresponding global ordinal.
+func (m *ordinalMap) globalOrd(segment int, segmentOrd int64) int64 {
+	return m.segmentToGlobalOrds[segment][segmentOrd]
+}
+
+// Returns an iterator over the unique merged values, in order.
+func (m *ordinalMap) iterable() BinaryIterable {
+	return func() func() ([]byte, bool) {
+		currentOrd := 0
+		return func() ([]byte, bool) {
+			if currentOrd == len(m.values) {
+				return nil, false
+			}
+			currentOrd++
+			return m.values[currentOrd-1], true
+		}
+	}
+}
+
+/*
+Merges the sorted docvalues from toMerge. The default implementation
+calls AddSortedField(), passing iterators that filter deleted
+documents and unused ordinals on the fly.
+*/
+func mergeSortedField(consumer DocValuesConsumer, fieldInfo model.FieldInfo,
+	mergeState *MergeState, toMerge []SortedDocValues) error {
+
+	// step 1: iterate thru each sub and mark terms still in use
+	valueCounts := make([]int64, len(toMerge))
+	liveOrds := make([]*util.FixedBitSet, len(toMerge))
+	for sub, dv := range toMerge {
+		reader := mergeState.readers[sub]
+		valueCounts[sub] = int64(dv.valueCount())
+		if liveDocs := reader.LiveDocs(); liveDocs != nil {
+			bitset := util.NewFixedBitSet(dv.valueCount())
+			for i := 0; i < reader.MaxDoc(); i++ {
+				if liveDocs.At(i) {
+					if ord := dv.ord(i); ord >= 0 {
+						bitset.Set(ord)
+					}
+				}
+			}
+			liveOrds[sub] = bitset
+		}
+	}
+
+	// step 2: create ordinal map (this conceptually does the "merging")
+	m := newOrdinalMap(valueCounts, liveOrds, func(segment int, ord int64) []byte {
+		return toMerge[segment].lookupOrd(int(ord))
+	})
+
+	// step 3: add field
+	return consumer.AddSortedField(fieldInfo, m.iterable(),
+		// doc -> ord
+		func() func() (int64, bool) {
+			next := newLiveDocsIterator(mergeState)
+			return func() (int64, bool) {
+				readerUpto, docID, ok := next()
+				if !ok {
+					return 0, false
+				}
+				if segOrd := toMerge[readerUpto].ord(docID); segOrd != -1 {
+					return m.globalOrd(readerUpto, int64(segOrd)), true
+				}
+				return -1, true
+			}
+		})
+}
+
+/*
+Merges the sortedset docvalues from toMerge. The default
+implementation calls AddSortedSetField(), passing iterators that
+filter deleted documents and unused ordinals on the fly.
+*/
+func mergeSortedSetField(consumer DocValuesConsumer, fieldInfo model.FieldInfo,
+	mergeState *MergeState, toMerge []SortedSetDocValues) error {
+
+	// step 1: iterate thru each sub and mark terms still in use
+	valueCounts := make([]int64, len(toMerge))
+	liveOrds := make([]*util.FixedBitSet, len(toMerge))
+	for sub, dv := range toMerge {
+		reader := mergeState.readers[sub]
+		valueCounts[sub] = dv.valueCount()
+		if liveDocs := reader.LiveDocs(); liveDocs != nil {
+			bitset := util.NewFixedBitSet(int(dv.valueCount()))
+			for i := 0; i < reader.MaxDoc(); i++ {
+				if liveDocs.At(i) {
+					dv.setDocument(i)
+					for ord := dv.nextOrd(); ord != NO_MORE_ORDS; ord = dv.nextOrd() {
+						bitset.Set(int(ord))
+					}
+				}
+			}
+			liveOrds[sub] = bitset
+		}
+	}
+
+	// step 2: create ordinal map (this conceptually does the "merging")
+	m := newOrdinalMap(valueCounts, liveOrds, func(segment int, ord int64) []byte {
+		return toMerge[segment].lookupOrd(ord)
+	})
+
+	// step 3: add field
+	return consumer.AddSortedSetField(fieldInfo, m.iterable(),
+		// doc -> ord count
+		func() func() (int64, bool) {
+			next := newLiveDocsIterator(mergeState)
+			return func() (int64, bool) {
+				readerUpto, docID, ok := next()
+				if !ok {
+					return 0, false
+				}
+				dv := toMerge[readerUpto]
+				dv.setDocument(docID)
+				var count int64
+				for dv.nextOrd() != NO_MORE_ORDS {
+					count++
+				}
+				return count, true
+			}
+		},
+		// ords
+		func() func() (int64, bool) {
+			next := newLiveDocsIterator(mergeState)
+			var ords []int64
+			ordUpto := 0
+			return func() (int64, bool) {
+				for ordUpto == len(ords) {
+					readerUpto, docID, ok := next()
+					if !ok {
+						return 0, false
+					}
+					dv := toMerge[readerUpto]
+					dv.setDocument(docID)
+					ords, ordUpto = ords[:0], 0
+					for ord := dv.nextOrd(); ord != NO_MORE_ORDS; ord = dv.nextOrd() {
+						ords = append(ords, m.globalOrd(readerUpto, ord))
+					}
+					sort.Slice(ords, func(i, j int) bool { return ords[i] < ords[j] })
+				}
+				ordUpto++
+				return ords[ordUpto-1], true
+			}
+		})
+}
 
 // codecs/StoredFieldsFormat.java
 
@@ -291,6 +872,8 @@ type StoredFieldsReader interface {
 	io.Closer
 	visitDocument(n int, visitor StoredFieldVisitor) error
 	Clone() StoredFieldsReader
+	// Checks consistency of this reader.
+	CheckIntegrity() error
 }
 
 // codecs/StoredFieldsWriter.java
@@ -317,6 +900,9 @@ type StoredFieldsWriter interface {
 	// Aborts writing entirely, implementation should remove any
 	// partially-written files, etc.
 	Abort()
+	// Writes a single stored field. value is one of string, []byte,
+	// int32, int64, float32 or float64.
+	WriteField(info model.FieldInfo, value interface{}) error
 	// Called before Close(), passing in the number of documents that
 	// were written. Note that this is intentionally redundant
 	// (equivalent to the number of calls to startDocument(int)), but a
@@ -325,6 +911,102 @@ type StoredFieldsWriter interface {
 	Finish(fis model.FieldInfos, numDocs int) error
 }
 
+/*
+A StoredFieldVisitor that collects all stored fields of a document,
+in order, so that they can be rewritten by a StoredFieldsWriter.
+*/
+type storedFieldsCollector struct {
+	infos  []model.FieldInfo
+	values []interface{}
+}
+
+func (c *storedFieldsCollector) reset() {
+	c.infos, c.values = c.infos[:0], c.values[:0]
+}
+
+func (c *storedFieldsCollector) add(fi model.FieldInfo, value interface{}) error {
+	c.infos = append(c.infos, fi)
+	c.values = append(c.values, value)
+	return nil
+}
+
+func (c *storedFieldsCollector) binaryField(fi model.FieldInfo, value []byte) error {
+	// value may be reused by the reader
+	return c.add(fi, append([]byte(nil), value...))
+}
+
+func (c *storedFieldsCollector) stringField(fi model.FieldInfo, value string) error {
+	return c.add(fi, value)
+}
+
+func (c *storedFieldsCollector) intField(fi model.FieldInfo, value int) error {
+	return c.add(fi, int32(value))
+}
+
+func (c *storedFieldsCollector) longField(fi model.FieldInfo, value int64) error {
+	return c.add(fi, value)
+}
+
+func (c *storedFieldsCollector) floatField(fi model.FieldInfo, value float32) error {
+	return c.add(fi, value)
+}
+
+func (c *storedFieldsCollector) doubleField(fi model.FieldInfo, value float64) error {
+	return c.add(fi, value)
+}
+
+func (c *storedFieldsCollector) needsField(fi model.FieldInfo) (StoredFieldVisitorStatus, error) {
+	return STORED_FIELD_VISITOR_STATUS_YES, nil
+}
+
+/*
+Default merge implementation of StoredFieldsWriter: iterates over
+each document, rewriting its stored fields with the merged field
+numbers, and calls Finish(). Returns the number of documents merged.
+*/
+func mergeStoredFields(writer StoredFieldsWriter, mergeState *MergeState) (int, error) {
+	docCount := 0
+	doc := new(storedFieldsCollector)
+	for _, reader := range mergeState.readers {
+		maxDoc := reader.MaxDoc()
+		liveDocs := reader.LiveDocs()
+		for i := 0; i < maxDoc; i++ {
+			if liveDocs != nil && !liveDocs.At(i) {
+				// skip deleted docs
+				continue
+			}
+			doc.reset()
+			if err := reader.VisitDocument(i, doc); err != nil {
+				return 0, err
+			}
+			if err := addStoredDocument(writer, doc, mergeState.fieldInfos); err != nil {
+				return 0, err
+			}
+			docCount++
+			if err := mergeState.checkAbort.work(300); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return docCount, writer.Finish(mergeState.fieldInfos, docCount)
+}
+
+// Writes all stored fields of doc as a single document.
+func addStoredDocument(writer StoredFieldsWriter, doc *storedFieldsCollector,
+	fieldInfos model.FieldInfos) error {
+
+	err := writer.StartDocument(len(doc.values))
+	if err != nil {
+		return err
+	}
+	for i, value := range doc.values {
+		if err = writer.WriteField(fieldInfos.FieldInfoByName(doc.infos[i].Name), value); err != nil {
+			return err
+		}
+	}
+	return writer.FinishDocument()
+}
+
 // codecs/TermVectorsFormat.java
 
 // Controls the format of term vectors
@@ -339,8 +1021,10 @@ type TermVectorsFormat interface {
 
 type TermVectorsReader interface {
 	io.Closer
-	get(doc int) Fields
+	get(doc int) (Fields, error)
 	clone() TermVectorsReader
+	// Checks consistency of this reader.
+	CheckIntegrity() error
 }
 
 // codecs/TermVectorsWriter.java
@@ -361,9 +1045,190 @@ verification/sanity-checks.
 6. Finally the writer is closed.
 */
 type TermVectorsWriter interface {
+	io.Closer
+	// Called before writing the term vectors of the document.
+	// StartField() will be called numVectorFields times. Note that if
+	// term vectors are enabled, this is called even if the document
+	// has no vector fields, in this case numVectorFields will be zero.
+	StartDocument(numVectorFields int) error
+	// Called after a doc and all its fields have been added.
+	FinishDocument() error
+	// Called before writing the terms of the field. StartTerm() will
+	// be called numTerms times.
+	StartField(info model.FieldInfo, numTerms int, positions, offsets, payloads bool) error
+	// Called after a field and all its terms have been added.
+	FinishField() error
+	// Adds a term and its term frequency freq. If this field has
+	// positions and/or offsets enabled, then AddPosition() will be
+	// called freq times respectively.
+	StartTerm(term []byte, freq int) error
+	// Called after a term and all its positions have been added.
+	FinishTerm() error
+	// Adds a term position and offsets
+	AddPosition(position, startOffset, endOffset int, payload []byte) error
 	// Aborts writing entirely, implementation should remove any
 	// partially-written files, etc.
-	abort()
+	Abort()
+	// Called before Close(), passing in the number of documents that
+	// were written. Note that this is intentionally redundant
+	// (equivalent to the number of calls to StartDocument()), but a
+	// Codec should check that this is the case to detect the JRE bug
+	// described in LUCENE-1282.
+	Finish(fis model.FieldInfos, numDocs int) error
+}
+
+/*
+Default merge implementation of TermVectorsWriter: iterates over each
+document, calling addAllDocVectors() for its term vectors, and calls
+Finish(). Returns the number of documents merged.
+*/
+func mergeTermVectors(writer TermVectorsWriter, mergeState *MergeState) (int, error) {
+	docCount := 0
+	for _, reader := range mergeState.readers {
+		maxDoc := reader.MaxDoc()
+		liveDocs := reader.LiveDocs()
+		for docID := 0; docID < maxDoc; docID++ {
+			if liveDocs != nil && !liveDocs.At(docID) {
+				// skip deleted docs
+				continue
+			}
+			vectors, err := reader.TermVectors(docID)
+			if err != nil {
+				return 0, err
+			}
+			if err = addAllDocVectors(writer, vectors, mergeState); err != nil {
+				return 0, err
+			}
+			docCount++
+			if err = mergeState.checkAbort.work(300); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return docCount, writer.Finish(mergeState.fieldInfos, docCount)
+}
+
+// Safe (but, slowish) default method to write every vector field in
+// the document.
+func addAllDocVectors(writer TermVectorsWriter, vectors Fields, mergeState *MergeState) error {
+	if vectors == nil {
+		if err := writer.StartDocument(0); err != nil {
+			return err
+		}
+		return writer.FinishDocument()
+	}
+
+	// Fields can not be iterated, so look up the vector fields of the
+	// merged field infos in field name order instead.
+	var names []string
+	for _, info := range mergeState.fieldInfos.Values {
+		if info.HasVectors() && vectors.Terms(info.Name) != nil {
+			names = append(names, info.Name)
+		}
+	}
+	sort.Strings(names)
+
+	err := writer.StartDocument(len(names))
+	if err != nil {
+		return err
+	}
+	var termsEnum TermsEnum
+	var docsAndPositionsEnum DocsAndPositionsEnum
+	for _, fieldName := range names {
+		fieldInfo := mergeState.fieldInfos.FieldInfoByName(fieldName)
+		terms := vectors.Terms(fieldName)
+
+		hasPositions := terms.HasPositions()
+		hasOffsets := terms.HasOffsets()
+		hasPayloads := terms.HasPayloads()
+		assert(!hasPayloads || hasPositions)
+
+		numTerms := int(terms.Size())
+		if numTerms == -1 {
+			// count manually. It is stupid, but needed, as Terms.Size() is
+			// not a mandatory statistics function
+			numTerms = 0
+			termsEnum = terms.Iterator(termsEnum)
+			for {
+				term, err := termsEnum.Next()
+				if err != nil {
+					return err
+				}
+				if term == nil {
+					break
+				}
+				numTerms++
+			}
+		}
+
+		if err = writer.StartField(fieldInfo, numTerms, hasPositions, hasOffsets, hasPayloads); err != nil {
+			return err
+		}
+		termsEnum = terms.Iterator(termsEnum)
+
+		termCount := 0
+		for {
+			term, err := termsEnum.Next()
+			if err != nil {
+				return err
+			}
+			if term == nil {
+				break
+			}
+			termCount++
+
+			freq64, err := termsEnum.TotalTermFreq()
+			if err != nil {
+				return err
+			}
+			freq := int(freq64)
+			if err = writer.StartTerm(term, freq); err != nil {
+				return err
+			}
+
+			if hasPositions || hasOffsets {
+				docsAndPositionsEnum = termsEnum.DocsAndPositions(nil, docsAndPositionsEnum)
+				assert(docsAndPositionsEnum != nil)
+
+				docID, err := docsAndPositionsEnum.NextDoc()
+				if err != nil {
+					return err
+				}
+				assert(docID != NO_MORE_DOCS)
+
+				for posUpto := 0; posUpto < freq; posUpto++ {
+					pos, err := docsAndPositionsEnum.NextPosition()
+					if err != nil {
+						return err
+					}
+					startOffset, err := docsAndPositionsEnum.StartOffset()
+					if err != nil {
+						return err
+					}
+					endOffset, err := docsAndPositionsEnum.EndOffset()
+					if err != nil {
+						return err
+					}
+					payload, err := docsAndPositionsEnum.Payload()
+					if err != nil {
+						return err
+					}
+					assert(!hasPositions || pos >= 0)
+					if err = writer.AddPosition(pos, startOffset, endOffset, payload); err != nil {
+						return err
+					}
+				}
+			}
+			if err = writer.FinishTerm(); err != nil {
+				return err
+			}
+		}
+		assert(termCount == numTerms)
+		if err = writer.FinishField(); err != nil {
+			return err
+		}
+	}
+	return writer.FinishDocument()
 }
 
 // codecs/FieldInfosFormat.java
@@ -432,6 +1297,8 @@ type DocValuesProducer interface {
 	Binary(field model.FieldInfo) (v BinaryDocValues, err error)
 	Sorted(field model.FieldInfo) (v SortedDocValues, err error)
 	SortedSet(field model.FieldInfo) (v SortedSetDocValues, err error)
+	// Checks consistency of this producer.
+	CheckIntegrity() error
 }
 
 // codecs/LiveDocsFormat.java
@@ -441,9 +1308,15 @@ type LiveDocsFormat interface {
 	// Creates a new MutableBits, with all bits set, for the specified size.
 	NewLiveDocs(size int) util.MutableBits
 	// Creates a new MutableBits of the same bits set and size of existing.
-	// NewLiveDocs(existing util.Bits) (util.MutableBits, error)
+	CopyLiveDocs(existing util.Bits) util.MutableBits
+	// Read live docs bits.
+	ReadLiveDocs(dir store.Directory, info *SegmentInfoPerCommit,
+		ctx store.IOContext) (util.Bits, error)
 	// Persist live docs bits. Use SegmentInfoPerCommit.nextDelGen() to
 	// determine the generation of the deletes file you should write to.
 	WriteLiveDocs(bits util.MutableBits, dir store.Directory,
 		info *SegmentInfoPerCommit, newDelCount int, ctx store.IOContext) error
+	// Records all files in use by this SegmentInfoPerCommit into the
+	// files argument.
+	Files(info *SegmentInfoPerCommit, files map[string]bool)
 }
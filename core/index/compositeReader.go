@@ -128,15 +128,15 @@ type CompositeReaderContextBuilder struct {
 	leafDocBase int
 }
 
-func newCompositeReaderContextBuilder(r CompositeReader) CompositeReaderContextBuilder {
-	return CompositeReaderContextBuilder{reader: r, leaves: list.New()}
+func newCompositeReaderContextBuilder(r CompositeReader) *CompositeReaderContextBuilder {
+	return &CompositeReaderContextBuilder{reader: r, leaves: list.New()}
 }
 
-func (b CompositeReaderContextBuilder) build() *CompositeReaderContext {
+func (b *CompositeReaderContextBuilder) build() *CompositeReaderContext {
 	return b.build4(nil, b.reader, 0, 0).(*CompositeReaderContext)
 }
 
-func (b CompositeReaderContextBuilder) build4(parent *CompositeReaderContext,
+func (b *CompositeReaderContextBuilder) build4(parent *CompositeReaderContext,
 	reader IndexReader, ord, docBase int) IndexReaderContext {
 	log.Printf("Building context from %v(parent: %v, %v-%v)", reader, parent, ord, docBase)
 	if ar, ok := reader.(AtomicReader); ok {
@@ -159,8 +159,8 @@ func (b CompositeReaderContextBuilder) build4(parent *CompositeReaderContext,
 	}
 	newDocBase := 0
 	for i, r := range sequentialSubReaders {
-		children[i] = b.build4(parent, r, i, newDocBase)
-		newDocBase = r.MaxDoc()
+		children[i] = b.build4(newParent, r, i, newDocBase)
+		newDocBase += r.MaxDoc()
 	}
 	// assert newDocBase == cr.maxDoc()
 	return newParent
@@ -205,7 +205,7 @@ func newBaseCompositeReader(self IndexReader, readers []IndexReader) *BaseCompos
 		}
 		numDocs += r.NumDocs() // compute numDocs
 		log.Printf("Obtained %v docs (max %v)", numDocs, maxDoc)
-		r.registerParentReader(ans)
+		r.registerParentReader(ans.IndexReaderImpl)
 	}
 	ans.starts[len(readers)] = maxDoc
 	ans.maxDoc = maxDoc
@@ -214,11 +214,10 @@ func newBaseCompositeReader(self IndexReader, readers []IndexReader) *BaseCompos
 	return ans
 }
 
-func (r *BaseCompositeReader) TermVectors(docID int) error {
-	panic("not implemented yet")
-	// r.ensureOpen()
-	// i := readerIndex(docID)
-	// return r.subReaders[i].TermVectors(docID - starts[i])
+func (r *BaseCompositeReader) TermVectors(docID int) (fs Fields, err error) {
+	r.ensureOpen()
+	i := r.readerIndex(docID)                               // find subreader num
+	return r.subReaders[i].TermVectors(docID - r.starts[i]) // dispatch to subreader
 }
 
 func (r *BaseCompositeReader) NumDocs() int {
@@ -237,6 +236,16 @@ func (r *BaseCompositeReader) VisitDocument(docID int, visitor StoredFieldVisito
 	return r.subReaders[i].VisitDocument(docID-r.starts[i], visitor)
 }
 
+func (r *BaseCompositeReader) CheckIntegrity() error {
+	r.ensureOpen()
+	for _, sub := range r.subReaders {
+		if err := sub.CheckIntegrity(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (r *BaseCompositeReader) DocFreq(term Term) int {
 	panic("not implemented yet")
 }
@@ -2,9 +2,12 @@ package index
 
 import (
 	"fmt"
+	"github.com/balzaczyy/golucene/core/codec"
 	"github.com/balzaczyy/golucene/core/codec/compressing"
 	"github.com/balzaczyy/golucene/core/index/model"
 	"github.com/balzaczyy/golucene/core/store"
+	"github.com/balzaczyy/golucene/core/util"
+	"github.com/balzaczyy/golucene/core/util/packed"
 )
 
 // compressing/CompressingStoredFieldsFormat.java
@@ -127,12 +130,255 @@ func (vf *CompressingTermVectorsFormat) VectorsReader(d store.Directory,
 	segmentInfo *model.SegmentInfo, fieldsInfos model.FieldInfos,
 	context store.IOContext) (r TermVectorsReader, err error) {
 
-	panic("not implemented yet")
+	return newCompressingTermVectorsReader(d, segmentInfo, vf.segmentSuffix,
+		fieldsInfos, context, vf.formatName, vf.compressionMode)
 }
 
 func (vf *CompressingTermVectorsFormat) VectorsWriter(d store.Directory,
 	segmentInfo *model.SegmentInfo,
 	context store.IOContext) (w TermVectorsWriter, err error) {
 
-	panic("not implemented yet")
+	return compressing.NewCompressingTermVectorsWriter(d, segmentInfo, vf.segmentSuffix,
+		context, vf.formatName, vf.compressionMode, vf.chunkSize)
+}
+
+// compressing/CompressingStoredFieldsWriter.java merge()
+
+/*
+Merges stored fields into a CompressingStoredFieldsWriter. Chunks of
+matching segments written with the same version, compression mode
+and chunk size are copied as is when they are free of deletions and
+the writer has no buffered documents; otherwise documents are copied
+from the decompressed chunks. Other segments fall back to the naive
+merge, document by document. Returns the number of documents merged.
+*/
+func mergeCompressingStoredFields(w *compressing.CompressingStoredFieldsWriter,
+	mergeState *MergeState) (int, error) {
+
+	docCount := 0
+	doc := new(storedFieldsCollector)
+	for idx, reader := range mergeState.readers {
+		var matchingFieldsReader *CompressingStoredFieldsReader
+		if matchingSegmentReader := mergeState.matchingSegmentReaders[idx]; matchingSegmentReader != nil {
+			// we can only bulk-copy if the matching reader is also a
+			// CompressingStoredFieldsReader
+			switch fieldsReader := matchingSegmentReader.FieldsReader().(type) {
+			case *CompressingStoredFieldsReader:
+				matchingFieldsReader = fieldsReader
+			case *Lucene41StoredFieldsReader:
+				matchingFieldsReader = fieldsReader.CompressingStoredFieldsReader
+			}
+		}
+
+		maxDoc := reader.MaxDoc()
+		liveDocs := reader.LiveDocs()
+
+		if matchingFieldsReader == nil ||
+			matchingFieldsReader.version != CODEC_SFX_VERSION_CURRENT || // means reader version is not the same as the writer version
+			matchingFieldsReader.compressionMode != w.CompressionMode() ||
+			matchingFieldsReader.chunkSize != w.ChunkSize() { // the way data is decompressed depends on the chunk size
+			// naive merge...
+			for i := nextLiveDoc(0, liveDocs, maxDoc); i < maxDoc; i = nextLiveDoc(i+1, liveDocs, maxDoc) {
+				doc.reset()
+				if err := reader.VisitDocument(i, doc); err != nil {
+					return 0, err
+				}
+				if err := addStoredDocument(w, doc, mergeState.fieldInfos); err != nil {
+					return 0, err
+				}
+				docCount++
+				if err := mergeState.checkAbort.work(300); err != nil {
+					return 0, err
+				}
+			}
+			continue
+		}
+
+		docID := nextLiveDoc(0, liveDocs, maxDoc)
+		if docID >= maxDoc {
+			continue // all docs were deleted
+		}
+		it := matchingFieldsReader.chunkIterator()
+		var startOffsets []int
+		for docID < maxDoc {
+			// go to the next chunk that contains docID
+			if err := it.next(docID); err != nil {
+				return 0, err
+			}
+			// transform lengths into offsets
+			if len(startOffsets) < it.chunkDocs {
+				startOffsets = make([]int, util.Oversize(it.chunkDocs, 4))
+			}
+			for i := 1; i < it.chunkDocs; i++ {
+				startOffsets[i] = startOffsets[i-1] + it.lengths[i-1]
+			}
+			chunkSize := startOffsets[it.chunkDocs-1] + it.lengths[it.chunkDocs-1]
+
+			if w.NumBufferedDocs() == 0 && // starting a new chunk
+				startOffsets[it.chunkDocs-1] < w.ChunkSize() && // chunk is small enough
+				chunkSize >= w.ChunkSize() && // chunk is large enough
+				nextDeletedDoc(it.docBase, liveDocs, it.docBase+it.chunkDocs) == it.docBase+it.chunkDocs { // no deletion in the chunk
+				assert(docID == it.docBase)
+
+				// no need to decompress, just copy data
+				if err := w.CopyCompressedChunk(it.chunkDocs, it.numStoredFields, it.lengths,
+					matchingFieldsReader.fieldsStream, it.compressedLength()); err != nil {
+					return 0, err
+				}
+				docID = nextLiveDoc(it.docBase+it.chunkDocs, liveDocs, maxDoc)
+				docCount += it.chunkDocs
+				if err := mergeState.checkAbort.work(float64(300 * it.chunkDocs)); err != nil {
+					return 0, err
+				}
+			} else {
+				// decompress
+				if err := it.decompress(); err != nil {
+					return 0, err
+				}
+				if chunkSize != len(it.bytes) {
+					return 0, codec.NewCorruptIndexErrorAt(it.owner.fieldsStream, fmt.Sprintf(
+						"Corrupted: expected chunk size=%v, got %v",
+						chunkSize, len(it.bytes)))
+				}
+				// copy non-deleted docs
+				for ; docID < it.docBase+it.chunkDocs; docID = nextLiveDoc(docID+1, liveDocs, maxDoc) {
+					diff := docID - it.docBase
+					if err := w.AddRawDocument(it.numStoredFields[diff],
+						it.bytes[startOffsets[diff]:startOffsets[diff]+it.lengths[diff]]); err != nil {
+						return 0, err
+					}
+					docCount++
+					if err := mergeState.checkAbort.work(300); err != nil {
+						return 0, err
+					}
+				}
+			}
+		}
+	}
+	return docCount, w.Finish(mergeState.fieldInfos, docCount)
+}
+
+// compressing/CompressingTermVectorsWriter.java merge()
+
+/*
+Merges term vectors into a CompressingTermVectorsWriter. Chunks of
+matching segments written with the same version, compression mode,
+chunk size and packed ints version are copied as is when they are
+free of deletions and the writer has no buffered documents; other
+documents are added one by one. Returns the number of documents
+merged.
+*/
+func mergeCompressingTermVectors(w *compressing.CompressingTermVectorsWriter,
+	mergeState *MergeState) (int, error) {
+
+	docCount := 0
+	for idx, reader := range mergeState.readers {
+		var matchingVectorsReader *CompressingTermVectorsReader
+		if matchingSegmentReader := mergeState.matchingSegmentReaders[idx]; matchingSegmentReader != nil {
+			// we can only bulk-copy if the matching reader is also a
+			// CompressingTermVectorsReader
+			switch vectorsReader := matchingSegmentReader.TermVectorsReader().(type) {
+			case *CompressingTermVectorsReader:
+				matchingVectorsReader = vectorsReader
+			case *Lucene42TermVectorsReader:
+				matchingVectorsReader = vectorsReader.CompressingTermVectorsReader
+			}
+		}
+
+		maxDoc := reader.MaxDoc()
+		liveDocs := reader.LiveDocs()
+
+		addDocVectors := func(docID int) error {
+			vectors, err := reader.TermVectors(docID)
+			if err != nil {
+				return err
+			}
+			if err = addAllDocVectors(w, vectors, mergeState); err != nil {
+				return err
+			}
+			docCount++
+			return mergeState.checkAbort.work(300)
+		}
+
+		if matchingVectorsReader == nil ||
+			matchingVectorsReader.version != compressing.VECTORS_VERSION_CURRENT ||
+			matchingVectorsReader.compressionMode != w.CompressionMode() ||
+			matchingVectorsReader.chunkSize != w.ChunkSize() ||
+			matchingVectorsReader.packedIntsVersion != packed.VERSION_CURRENT {
+			// naive merge...
+			for i := nextLiveDoc(0, liveDocs, maxDoc); i < maxDoc; i = nextLiveDoc(i+1, liveDocs, maxDoc) {
+				if err := addDocVectors(i); err != nil {
+					return 0, err
+				}
+			}
+			continue
+		}
+
+		index := matchingVectorsReader.indexReader
+		vectorsStream := matchingVectorsReader.vectorsStream.Clone()
+		for i := nextLiveDoc(0, liveDocs, maxDoc); i < maxDoc; {
+			if w.NumBufferedDocs() > 0 ||
+				(i > 0 && index.startPointer(i-1) == index.startPointer(i)) { // not the start of a chunk
+				if err := addDocVectors(i); err != nil {
+					return 0, err
+				}
+				i = nextLiveDoc(i+1, liveDocs, maxDoc)
+				continue
+			}
+
+			if err := vectorsStream.Seek(index.startPointer(i)); err != nil {
+				return 0, err
+			}
+			docBase, err := asInt(vectorsStream.ReadVInt())
+			if err != nil {
+				return 0, err
+			}
+			chunkDocs, err := asInt(vectorsStream.ReadVInt())
+			if err != nil {
+				return 0, err
+			}
+			assert(docBase+chunkDocs <= maxDoc)
+			if docBase+chunkDocs < maxDoc &&
+				nextDeletedDoc(docBase, liveDocs, docBase+chunkDocs) == docBase+chunkDocs {
+				// no deletion in the chunk, and it is not the last one: copy
+				// it as is
+				chunkLength := index.startPointer(docBase+chunkDocs) - vectorsStream.FilePointer()
+				if err = w.CopyChunk(chunkDocs, vectorsStream, chunkLength); err != nil {
+					return 0, err
+				}
+				docCount += chunkDocs
+				if err = mergeState.checkAbort.work(float64(300 * chunkDocs)); err != nil {
+					return 0, err
+				}
+				i = nextLiveDoc(docBase+chunkDocs, liveDocs, maxDoc)
+			} else {
+				for ; i < docBase+chunkDocs; i = nextLiveDoc(i+1, liveDocs, maxDoc) {
+					if err = addDocVectors(i); err != nil {
+						return 0, err
+					}
+				}
+			}
+		}
+	}
+	return docCount, w.Finish(mergeState.fieldInfos, docCount)
+}
+
+func nextLiveDoc(doc int, liveDocs util.Bits, maxDoc int) int {
+	if liveDocs == nil {
+		return doc
+	}
+	for doc < maxDoc && !liveDocs.At(doc) {
+		doc++
+	}
+	return doc
+}
+
+func nextDeletedDoc(doc int, liveDocs util.Bits, maxDoc int) int {
+	if liveDocs == nil {
+		return maxDoc
+	}
+	for doc < maxDoc && liveDocs.At(doc) {
+		doc++
+	}
+	return doc
 }
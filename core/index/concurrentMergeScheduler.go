@@ -63,6 +63,9 @@ type ConcurrentMergeScheduler struct {
 
 	chRequest            chan *MergeJob
 	concurrentMergeCount int32 // atomic
+
+	// Tracks merge jobs handed to workers but not yet finished.
+	running sync.WaitGroup
 }
 
 func NewConcurrentMergeScheduler() *ConcurrentMergeScheduler {
@@ -98,18 +101,36 @@ func (cms *ConcurrentMergeScheduler) process(job *MergeJob) {
 	atomic.AddInt32(&cms.concurrentMergeCount, 1)
 	defer func() {
 		atomic.AddInt32(&cms.concurrentMergeCount, -1)
+		cms.running.Done()
 	}()
 
+	cms.doMerge(job, job.merge)
+
+	// Subsequent merges are pulled from the writer directly, as the one
+	// just finished may have enabled new ones:
+	for merge := job.writer.nextMerge(); merge != nil; merge = job.writer.nextMerge() {
+		if cms.verbose() {
+			cms.message("  merge thread: do another merge %v",
+				job.writer.readerPool.segmentsToString(merge.segments))
+		}
+		cms.doMerge(job, merge)
+	}
+	if cms.verbose() {
+		cms.message("  merge thread: done")
+	}
+}
+
+func (cms *ConcurrentMergeScheduler) doMerge(job *MergeJob, merge *OneMerge) {
 	if cms.verbose() {
 		elapsed := time.Now().Sub(job.start)
 		cms.message("  stalled for %v", elapsed)
-		cms.message("  consider merge %v", job.writer.readerPool.segmentsToString(job.merge.segments))
+		cms.message("  consider merge %v", job.writer.readerPool.segmentsToString(merge.segments))
 		// OK to spawn a new merge routine to handle this merge
 		cms.message("    launch new thread [%v]", atomic.AddInt32(&cms.mergeThreadCount, 1))
 		cms.message("  merge thread: start")
 	}
 
-	err := job.writer.merge(job.merge)
+	err := job.writer.merge(merge)
 	if err != nil {
 		// Ignore the error if it was due to abort:
 		if _, ok := err.(MergeAbortedError); !ok && !cms.suppressErrors {
@@ -166,7 +187,9 @@ Wait for any running merge threads to finish. This call is not
 Interruptible as used by Close()
 */
 func (cms *ConcurrentMergeScheduler) sync() {
-	panic("not implemented yet")
+	cms.Lock() // synchronized
+	defer cms.Unlock()
+	cms.running.Wait()
 }
 
 func (cms *ConcurrentMergeScheduler) Merge(writer *IndexWriter) error {
@@ -204,6 +227,7 @@ func (cms *ConcurrentMergeScheduler) Merge(writer *IndexWriter) error {
 				cms.message("    too many merges; stalling...")
 			}
 		}
+		cms.running.Add(1)
 		cms.chRequest <- &MergeJob{time.Now(), writer, merge}
 	}
 	if cms.verbose() {
@@ -229,9 +253,13 @@ func (cms *ConcurrentMergeScheduler) handleMergeError(err error) {
 }
 
 func (cms *ConcurrentMergeScheduler) String() string {
-	panic("not implemented yet")
+	return fmt.Sprintf("ConcurrentMergeScheduler: maxRoutineCount=%v, maxMergeCount=%v",
+		cms.maxRoutineCount, cms.maxMergeCount)
 }
 
 func (cms *ConcurrentMergeScheduler) Clone() MergeScheduler {
-	panic("not implemented yet")
+	clone := NewConcurrentMergeScheduler()
+	clone.SetMaxMergesAndRoutines(cms.maxMergeCount, cms.maxRoutineCount)
+	clone.suppressErrors = cms.suppressErrors
+	return clone
 }
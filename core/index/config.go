@@ -114,6 +114,12 @@ func (conf *IndexWriterConfig) Clone() *IndexWriterConfig {
 	panic("not implemented yet")
 }
 
+/* Specifies OpenMode of the index. Only takes effect when IndexWriter is first created. */
+func (conf *IndexWriterConfig) SetOpenMode(openMode OpenMode) *IndexWriterConfig {
+	conf.openMode = openMode
+	return conf
+}
+
 /*
 Expert: allows an optional IndexDeletionPolicy implementation to be
 specified. You can use this to control when prior commits are deleted
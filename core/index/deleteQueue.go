@@ -3,6 +3,7 @@ package index
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 )
 
 // index/DocumentsWriterDeleteQueue.java
@@ -47,6 +48,7 @@ neither to the global deletes.
 */
 type DocumentsWriterDeleteQueue struct {
 	tail                  *Node // volatile
+	tailLock              sync.Locker
 	globalSlice           *DeleteSlice
 	globalBufferedDeletes *BufferedDeletes
 	globalBufferLock      sync.Locker
@@ -67,6 +69,7 @@ func newDocumentsWriterDeleteQueueWith(globalBufferedDeletes *BufferedDeletes, g
 	return &DocumentsWriterDeleteQueue{
 		globalBufferedDeletes: globalBufferedDeletes,
 		globalBufferLock:      &sync.Mutex{},
+		tailLock:              &sync.Mutex{},
 		generation:            generation,
 		// we use a sentinel instance as our initial tail. No slice will
 		// ever try to apply this tail since the head is always omitted.
@@ -75,6 +78,46 @@ func newDocumentsWriterDeleteQueueWith(globalBufferedDeletes *BufferedDeletes, g
 	}
 }
 
+func (dq *DocumentsWriterDeleteQueue) addDeleteQueries(queries ...Query) {
+	dq.add(newNode(queries))
+	dq.tryApplyGlobalSlice()
+}
+
+func (dq *DocumentsWriterDeleteQueue) addDeleteTerms(terms ...*Term) {
+	dq.add(newNode(terms))
+	dq.tryApplyGlobalSlice()
+}
+
+/* invariant for document update */
+func (dq *DocumentsWriterDeleteQueue) addTermToSlice(term *Term, slice *DeleteSlice) {
+	termNode := newNode(term)
+	dq.add(termNode)
+	/*
+		This is an update request where the term is the updated documents
+		delTerm. In that case we need to guarantee that this insert is
+		atomic with regards to the given delete slice. This means if two
+		threads try to update the same document with in turn the same
+		delTerm one of them must win. By taking the node we have created
+		for our del term as the new tail it is guaranteed that if another
+		thread adds the same right after us we will apply this delete
+		next time we update our slice and one of the two competing
+		updates wins!
+	*/
+	slice.tail = termNode
+	assert2(slice.head != slice.tail, "slice head and tail must differ after add")
+	dq.tryApplyGlobalSlice() // TODO doing this each time is not necessary maybe
+	// we can do it just every n times or so?
+}
+
+func (dq *DocumentsWriterDeleteQueue) add(item *Node) {
+	// Java version uses a lock-free CAS loop on the tail; a lock keeps
+	// the same ordering guarantee here.
+	dq.tailLock.Lock()
+	defer dq.tailLock.Unlock()
+	dq.tail.next = item
+	dq.tail = item
+}
+
 func (dq *DocumentsWriterDeleteQueue) freezeGlobalBuffer(callerSlice *DeleteSlice) *FrozenBufferedDeletes {
 	dq.globalBufferLock.Lock()
 	defer dq.globalBufferLock.Unlock()
@@ -82,7 +125,7 @@ func (dq *DocumentsWriterDeleteQueue) freezeGlobalBuffer(callerSlice *DeleteSlic
 	// Here we freeze the global buffer so we need to lock it, apply
 	// all deletes in the queue and reset the global slice to let the
 	// GC prune the queue.
-	currentTail := dq.tail
+	currentTail := dq.currentTail()
 	// take the current tail and make this local. Any changes after
 	// this call are applied later and not relevant here
 	if callerSlice != nil {
@@ -107,23 +150,57 @@ func (dq *DocumentsWriterDeleteQueue) anyChanges() bool {
 	// and if globalBufferedDeletes has changes
 	return dq.globalBufferedDeletes.any() ||
 		!dq.globalSlice.isEmpty() ||
-		dq.globalSlice.tail != dq.tail ||
-		dq.tail.next != nil
+		dq.globalSlice.tail != dq.currentTail() ||
+		dq.currentTail().next != nil
+}
+
+func (dq *DocumentsWriterDeleteQueue) tryApplyGlobalSlice() {
+	// The global buffer must be locked but we don't need to update
+	// them if there is an update going on right now. It is sufficient
+	// to apply the deletes that have been added after the current in
+	// progress global slice is applied.
+	dq.globalBufferLock.Lock()
+	defer dq.globalBufferLock.Unlock()
+	if dq.updateSlice(dq.globalSlice) {
+		dq.globalSlice.apply(dq.globalBufferedDeletes, MAX_INT)
+	}
 }
 
 func (dq *DocumentsWriterDeleteQueue) newSlice() *DeleteSlice {
-	return newDeleteSlice(dq.tail)
+	return newDeleteSlice(dq.currentTail())
+}
+
+func (dq *DocumentsWriterDeleteQueue) updateSlice(slice *DeleteSlice) bool {
+	if tail := dq.currentTail(); slice.tail != tail {
+		slice.tail = tail
+		return true
+	}
+	return false
+}
+
+func (dq *DocumentsWriterDeleteQueue) currentTail() *Node {
+	dq.tailLock.Lock()
+	defer dq.tailLock.Unlock()
+	return dq.tail
+}
+
+func (dq *DocumentsWriterDeleteQueue) numGlobalTermDeletes() int {
+	return int(atomic.LoadInt32(&dq.globalBufferedDeletes.numTermDeletes))
 }
 
 func (dq *DocumentsWriterDeleteQueue) clear() {
 	dq.globalBufferLock.Lock()
 	defer dq.globalBufferLock.Unlock()
 
-	currentTail := dq.tail
+	currentTail := dq.currentTail()
 	dq.globalSlice.head, dq.globalSlice.tail = currentTail, currentTail
 	dq.globalBufferedDeletes.clear()
 }
 
+func (dq *DocumentsWriterDeleteQueue) bytesUsed() int64 {
+	return atomic.LoadInt64(&dq.globalBufferedDeletes.bytesUsed)
+}
+
 func (dq *DocumentsWriterDeleteQueue) String() string {
 	return fmt.Sprintf("DWDQ: [ generation: %v ]", dq.generation)
 }
@@ -168,6 +245,14 @@ func (ds *DeleteSlice) isEmpty() bool {
 	return ds.head == ds.tail
 }
 
+/*
+Returns true iff the given item is identical to the item hold by the
+slices tail, otherwise false.
+*/
+func (ds *DeleteSlice) isTailItem(item interface{}) bool {
+	return ds.tail.item == item
+}
+
 type Node struct {
 	next *Node // volatile
 	item interface{}
@@ -178,5 +263,18 @@ func newNode(item interface{}) *Node {
 }
 
 func (node *Node) apply(bufferedDeletes *BufferedDeletes, docIDUpto int) {
-	panic("sentinel item must never be applied")
+	switch item := node.item.(type) {
+	case *Term:
+		bufferedDeletes.addTerm(item, docIDUpto)
+	case []*Term:
+		for _, term := range item {
+			bufferedDeletes.addTerm(term, docIDUpto)
+		}
+	case []Query:
+		for _, query := range item {
+			bufferedDeletes.addQuery(query, MAX_INT)
+		}
+	default:
+		panic("sentinel item must never be applied")
+	}
 }
@@ -34,11 +34,28 @@ func (a SegInfoByDelGen) Less(i, j int) bool { return a[i].bufferedDeletesGen <
 
 type Query interface{}
 
+/*
+Resolves a delete-by-query against a single segment: returns an
+iterator over the docs matched by query in the given leaf context,
+excluding those not in acceptDocs. It may return nil if nothing
+matches.
+
+Queries are defined by the search package, which depends on this
+package, so it assigns this function when imported.
+*/
+var QueryDocIdSetIterator func(query Query, ctx *AtomicReaderContext,
+	acceptDocs util.Bits) (DocIdSetIterator, error)
+
 type QueryAndLimit struct {
+	query Query
+	limit int
 }
 
+// index/CoalescedDeletes.java
+
 type CoalescedDeletes struct {
-	_queries map[Query]int
+	_queries  map[Query]int
+	iterables []*PrefixCodedTerms
 }
 
 func newCoalescedDeletes() *CoalescedDeletes {
@@ -48,19 +65,41 @@ func newCoalescedDeletes() *CoalescedDeletes {
 }
 
 func (cd *CoalescedDeletes) String() string {
-	panic("not implemented yet")
+	// note: we could add/collect more debugging information
+	return fmt.Sprintf("CoalescedDeletes(termSets=%v,queries=%v)", len(cd.iterables), len(cd._queries))
 }
 
 func (cd *CoalescedDeletes) update(in *FrozenBufferedDeletes) {
-	panic("not implemented yet")
+	cd.iterables = append(cd.iterables, in.terms)
+	for _, query := range in._queries {
+		cd._queries[query] = MAX_INT
+	}
 }
 
+/* Returns the union of all coalesced terms, sorted and deduplicated. */
 func (cd *CoalescedDeletes) terms() []*Term {
-	panic("not implemented yet")
+	var terms []*Term
+	for _, it := range cd.iterables {
+		it.each(func(term *Term) {
+			terms = append(terms, term)
+		})
+	}
+	util.TimSort(TermSorter(terms))
+	var ans []*Term
+	for i, term := range terms {
+		if i == 0 || !terms[i-1].equals(term) {
+			ans = append(ans, term)
+		}
+	}
+	return ans
 }
 
 func (cd *CoalescedDeletes) queries() []*QueryAndLimit {
-	panic("not implemented yet")
+	ans := make([]*QueryAndLimit, 0, len(cd._queries))
+	for query, limit := range cd._queries {
+		ans = append(ans, &QueryAndLimit{query, limit})
+	}
+	return ans
 }
 
 /*
@@ -102,6 +141,54 @@ func newBufferedDeletesStream(infoStream util.InfoStream) *BufferedDeletesStream
 	}
 }
 
+/*
+Appends a new packet of buffered deletes to the stream, setting its
+generation:
+*/
+func (ds *BufferedDeletesStream) push(packet *FrozenBufferedDeletes) int64 {
+	ds.Lock()
+	defer ds.Unlock()
+
+	// The insert operation must be atomic. If we let threads increment
+	// the gen and push the packet afterwards we risk that packets are
+	// out of order. With DWPT this is possible if two or more flushes
+	// are racing for pushing updates. If the pushed packets get our of
+	// order would loose documents since deletes are applied to the
+	// wrong segments.
+	packet.gen = ds.nextGen
+	ds.nextGen++
+	assert(packet.any())
+	ds.assertDeleteStats()
+	assert(packet.gen < ds.nextGen)
+	assert2(len(ds.deletes) == 0 || ds.deletes[len(ds.deletes)-1].gen < packet.gen,
+		"Delete packets must be in order")
+	ds.deletes = append(ds.deletes, packet)
+	atomic.AddInt32(&ds.numTerms, int32(packet.numTermDeletes))
+	atomic.AddInt64(&ds.bytesUsed, packet.bytesUsed)
+	if ds.infoStream.IsEnabled("BD") {
+		ds.infoStream.Message("BD", "push deletes %v delGen=%v packetCount=%v totBytesUsed=%v",
+			packet, packet.gen, len(ds.deletes), atomic.LoadInt64(&ds.bytesUsed))
+	}
+	ds.assertDeleteStats()
+	return packet.gen
+}
+
+func (ds *BufferedDeletesStream) getNextGen() int64 {
+	ds.Lock()
+	defer ds.Unlock()
+	ds.nextGen++
+	return ds.nextGen - 1
+}
+
+func (ds *BufferedDeletesStream) clear() {
+	ds.Lock()
+	defer ds.Unlock()
+	ds.deletes = nil
+	ds.nextGen = 1
+	atomic.StoreInt32(&ds.numTerms, 0)
+	atomic.StoreInt64(&ds.bytesUsed, 0)
+}
+
 func (ds *BufferedDeletesStream) any() bool {
 	return atomic.LoadInt64(&ds.bytesUsed) != 0
 }
@@ -369,13 +456,128 @@ func (ds *BufferedDeletesStream) pruneDeletes(count int) {
 /* Delete by term */
 func (ds *BufferedDeletesStream) _applyTermDeletes(terms []*Term,
 	rld *ReadersAndLiveDocs, reader *SegmentReader) (int64, error) {
-	panic("not implemented yet")
+
+	var delCount int64
+	fields := reader.Fields()
+	if fields == nil {
+		// This reader has no postings
+		return 0, nil
+	}
+
+	var termsEnum TermsEnum
+	var currentField string
+	var docs DocsEnum
+	var any bool
+
+	ds.lastDeleteTerm = nil
+
+	for i, term := range terms {
+		// Since we visit terms sorted, we gain performance by re-using
+		// the same TermsEnum and seeking only forwards
+		if i == 0 || term.Field != currentField {
+			assert(i == 0 || currentField < term.Field)
+			currentField = term.Field
+			if t := fields.Terms(currentField); t != nil {
+				termsEnum = t.Iterator(nil)
+			} else {
+				termsEnum = nil
+			}
+		}
+
+		if termsEnum == nil {
+			continue
+		}
+		ds.assertDeleteTerm(term)
+
+		ok, err := termsEnum.SeekExact(term.Bytes)
+		if err != nil {
+			return delCount, err
+		}
+		if !ok {
+			continue
+		}
+		// we don't need term frequencies for this
+		docsEnum, err := termsEnum.DocsByFlags(rld.liveDocs(), docs, DOCS_ENUM_FLAG_NONE)
+		if err != nil {
+			return delCount, err
+		}
+		if docsEnum == nil {
+			continue
+		}
+		for {
+			docID, err := docsEnum.NextDoc()
+			if err != nil {
+				return delCount, err
+			}
+			if docID == NO_MORE_DOCS {
+				break
+			}
+			if !any {
+				rld.initWritableLiveDocs()
+				any = true
+			}
+			// NOTE: there is no limit check on the docID when deleting by
+			// Term (unlike by Query) because on flush we apply all Term
+			// deletes to each segment. So all Term deleting here is
+			// against prior segments:
+			if rld.delete(docID) {
+				delCount++
+			}
+		}
+	}
+	return delCount, nil
+}
+
+// used only by assert
+func (ds *BufferedDeletesStream) assertDeleteTerm(term *Term) {
+	assertn(ds.lastDeleteTerm == nil || !TermSorter([]*Term{term, ds.lastDeleteTerm}).Less(0, 1),
+		"lastTerm=%v vs term=%v", ds.lastDeleteTerm, term)
+	// TODO: we re-use term now in our merged iterable, but we shouldn't
+	// clone, instead copy for this assert
+	ds.lastDeleteTerm = term
 }
 
 /* Delete by query */
 func applyQueryDeletes(queries []*QueryAndLimit,
 	rld *ReadersAndLiveDocs, reader *SegmentReader) (int64, error) {
-	panic("not implemented yet")
+
+	if len(queries) == 0 {
+		return 0, nil
+	}
+	assert2(QueryDocIdSetIterator != nil,
+		"deleting by query requires the search package to be linked")
+
+	var delCount int64
+	readerContext := reader.Context().(*AtomicReaderContext)
+	var any bool
+	for _, ent := range queries {
+		it, err := QueryDocIdSetIterator(ent.query, readerContext, reader.LiveDocs())
+		if err != nil {
+			return delCount, err
+		}
+		if it == nil {
+			continue
+		}
+		for {
+			doc, err := it.NextDoc()
+			if err != nil {
+				return delCount, err
+			}
+			if doc >= ent.limit {
+				break
+			}
+
+			if !any {
+				rld.initWritableLiveDocs()
+				any = true
+			}
+
+			if rld.delete(doc) {
+				delCount++
+			}
+		}
+	}
+	return delCount, nil
 }
 
 func (ds *BufferedDeletesStream) assertDeleteStats() {
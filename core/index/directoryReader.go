@@ -2,11 +2,14 @@ package index
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"github.com/balzaczyy/golucene/core/store"
 	"github.com/balzaczyy/golucene/core/util"
 	"io"
 	"log"
+	"os"
+	"sort"
 	"strings"
 )
 
@@ -14,9 +17,9 @@ const DEFAULT_TERMS_INDEX_DIVISOR = 1
 
 type DirectoryReader interface {
 	IndexReader
-	// doOpenIfChanged() error
-	// doOpenIfChanged(c IndexCommit) error
-	// doOpenIfChanged(w IndexWriter, c IndexCommit) error
+	doOpenIfChanged() (DirectoryReader, error)
+	doOpenIfChangedAtCommit(c IndexCommit) (DirectoryReader, error)
+	doOpenIfChangedWithWriter(w *IndexWriter, applyAllDeletes bool) (DirectoryReader, error)
 	Version() int64
 	IsCurrent() bool
 }
@@ -38,7 +41,132 @@ func newDirectoryReader(self IndexReader, directory store.Directory, segmentRead
 }
 
 func OpenDirectoryReader(directory store.Directory) (r DirectoryReader, err error) {
-	return openStandardDirectoryReader(directory, DEFAULT_TERMS_INDEX_DIVISOR)
+	return openStandardDirectoryReader(directory, nil, DEFAULT_TERMS_INDEX_DIVISOR)
+}
+
+/*
+Expert: returns an IndexReader reading the index in the given
+IndexCommit, e.g. one returned by ListCommits().
+*/
+func OpenDirectoryReaderAtCommit(commit IndexCommit) (r DirectoryReader, err error) {
+	return openStandardDirectoryReader(commit.Directory(), commit, DEFAULT_TERMS_INDEX_DIVISOR)
+}
+
+/*
+Open a near real time IndexReader from the IndexWriter.
+
+If applyAllDeletes is true, all buffered deletes will be applied
+(made visible) in the returned reader. If false, the deletes are not
+applied but remain buffered (in IndexWriter) so that they will be
+applied in the future. Applying deletes can be costly, so if your app
+can tolerate deleted documents being returned you might gain some
+performance by passing false.
+*/
+func OpenDirectoryReaderFromWriter(w *IndexWriter, applyAllDeletes bool) (r DirectoryReader, err error) {
+	return w.getReader(applyAllDeletes)
+}
+
+/*
+If the index has changed since the provided reader was opened, open
+and return a new reader; else, return nil. The new reader, if not
+nil, will be the same type of reader as the previous one, i.e. a
+near real-time reader will open a new near real-time reader.
+
+This method is typically far less costly than opening a fully new
+DirectoryReader as it shares resources (for example sub-readers) with
+the provided DirectoryReader, when possible.
+
+The provided reader is not closed (you are responsible for doing so);
+if a new reader is returned you also must eventually close it. Be
+sure to never close a reader while other goroutines are still using
+it.
+*/
+func OpenIfChanged(oldReader DirectoryReader) (DirectoryReader, error) {
+	newReader, err := oldReader.doOpenIfChanged()
+	assert(newReader != oldReader)
+	return newReader, err
+}
+
+/*
+If the IndexCommit differs from what the provided reader is
+searching, open and return a new reader; else, return nil.
+*/
+func OpenIfChangedAtCommit(oldReader DirectoryReader, commit IndexCommit) (DirectoryReader, error) {
+	newReader, err := oldReader.doOpenIfChangedAtCommit(commit)
+	assert(newReader != oldReader)
+	return newReader, err
+}
+
+/*
+Expert: if there changes (committed or not) in the IndexWriter
+versus what the provided reader is searching, then open and return a
+new IndexReader searching both committed and uncommitted changes from
+the writer; else, return nil (though, the current implementation
+never returns nil).
+
+This provides "near real-time" searching, in that changes made during
+an IndexWriter session can be quickly made available for searching
+without closing the writer nor calling Commit().
+
+If applyAllDeletes is true, all buffered deletes will be applied
+(made visible) in the returned reader. If false, the deletes are not
+applied but remain buffered (in IndexWriter) so that they will be
+applied in the future.
+*/
+func OpenIfChangedWithWriter(oldReader DirectoryReader, w *IndexWriter,
+	applyAllDeletes bool) (DirectoryReader, error) {
+	newReader, err := oldReader.doOpenIfChangedWithWriter(w, applyAllDeletes)
+	assert(newReader != oldReader)
+	return newReader, err
+}
+
+/*
+Returns all commit points that exist in the Directory, sorted by
+generation, oldest first. Normally, because the default is
+KeepOnlyLastCommitDeletionPolicy, there would be only one commit
+point. But if you're using a custom IndexDeletionPolicy then there
+could be many commits. Once you have a given commit, you can open a
+reader on it by calling OpenDirectoryReaderAtCommit(). There must be
+at least one commit in the Directory, else this method returns an
+error.
+*/
+func ListCommits(dir store.Directory) ([]IndexCommit, error) {
+	files, err := dir.ListAll()
+	if err != nil {
+		return nil, err
+	}
+
+	latest := &SegmentInfos{}
+	if err = latest.ReadAll(dir); err != nil {
+		return nil, err
+	}
+	currentGen := latest.generation
+
+	commits := []IndexCommit{newReaderCommit(latest, dir)}
+	for _, fileName := range files {
+		if strings.HasPrefix(fileName, INDEX_FILENAME_SEGMENTS) &&
+			fileName != INDEX_FILENAME_SEGMENTS_GEN &&
+			GenerationFromSegmentsFileName(fileName) < currentGen {
+
+			sis := &SegmentInfos{}
+			if err = sis.Read(dir, fileName); err != nil {
+				if os.IsNotExist(err) {
+					// LUCENE-948: on NFS (and maybe others), if you have
+					// writers switching back and forth between machines,
+					// it's very likely that the dir listing will be stale
+					// and will claim a file segments_X exists when in fact
+					// it doesn't. So, we catch this and handle it as if
+					// the file does not exist
+					continue
+				}
+				return nil, err
+			}
+			commits = append(commits, newReaderCommit(sis, dir))
+		}
+	}
+
+	sort.Sort(IndexCommits(commits))
+	return commits, nil
 }
 
 /*
@@ -85,23 +213,32 @@ func IsIndexFileExists(files []string) bool {
 	return false
 }
 
+// index/StandardDirectoryReader.java
+
 type StandardDirectoryReader struct {
 	*DirectoryReaderImpl
-	segmentInfos *SegmentInfos
+	writer                *IndexWriter
+	segmentInfos          *SegmentInfos
+	termInfosIndexDivisor int
+	applyAllDeletes       bool
 }
 
-// TODO support IndexWriter
 func newStandardDirectoryReader(directory store.Directory, readers []AtomicReader,
-	sis *SegmentInfos, termInfosIndexDivisor int, applyAllDeletes bool) *StandardDirectoryReader {
+	writer *IndexWriter, sis *SegmentInfos, termInfosIndexDivisor int,
+	applyAllDeletes bool) *StandardDirectoryReader {
 	log.Printf("Initializing StandardDirectoryReader with %v sub readers...", len(readers))
-	ans := &StandardDirectoryReader{segmentInfos: sis}
+	ans := &StandardDirectoryReader{
+		writer:                writer,
+		segmentInfos:          sis,
+		termInfosIndexDivisor: termInfosIndexDivisor,
+		applyAllDeletes:       applyAllDeletes,
+	}
 	ans.DirectoryReaderImpl = newDirectoryReader(ans, directory, readers)
 	return ans
 }
 
-// TODO support IndexCommit
 func openStandardDirectoryReader(directory store.Directory,
-	termInfosIndexDivisor int) (r DirectoryReader, err error) {
+	commit IndexCommit, termInfosIndexDivisor int) (r DirectoryReader, err error) {
 	log.Print("Initializing SegmentsFile...")
 	obj, err := NewFindSegmentsFile(directory, func(segmentFileName string) (obj interface{}, err error) {
 		sis := &SegmentInfos{}
@@ -123,14 +260,145 @@ func openStandardDirectoryReader(directory store.Directory,
 			}
 		}
 		log.Printf("Obtained %v SegmentReaders.", len(readers))
-		return newStandardDirectoryReader(directory, readers, sis, termInfosIndexDivisor, false), nil
-	}).run()
+		return newStandardDirectoryReader(directory, readers, nil, sis, termInfosIndexDivisor, false), nil
+	}).run(commit)
 	if err != nil {
 		return nil, err
 	}
 	return obj.(*StandardDirectoryReader), err
 }
 
+// Used by near real-time search
+func openStandardDirectoryReaderFromWriter(writer *IndexWriter,
+	infos *SegmentInfos, applyAllDeletes bool) (r DirectoryReader, err error) {
+	// IndexWriter synchronizes externally before calling us, which
+	// ensures infos will not change; so there's no need to process
+	// segments in reverse order
+	numSegments := len(infos.Segments)
+
+	var readers []AtomicReader
+	dir := writer.Directory()
+
+	segmentInfos := infos.Clone()
+	infosUpto := 0
+	var success = false
+	defer func() {
+		if !success {
+			for _, r := range readers {
+				r.decRef() // ignore any error to not mask the original one
+			}
+		}
+	}()
+
+	for i := 0; i < numSegments; i++ {
+		// NOTE: important that we use infos not segmentInfos here, so
+		// that we are passing the actual instance of
+		// SegmentInfoPerCommit in IndexWriter's segmentInfos:
+		info := infos.Segments[i]
+		assert(info.info.Dir == dir)
+		rld := writer.readerPool.get(info, true)
+		reader, err := rld.readOnlyClone(store.IO_CONTEXT_READ)
+		if err == nil {
+			if reader.NumDocs() > 0 || writer.keepFullyDeletedSegments {
+				// Steal the ref:
+				readers = append(readers, reader)
+				infosUpto++
+			} else {
+				err = reader.decRef()
+				segmentInfos.remove(segmentInfos.Segments[infosUpto])
+			}
+		}
+		err = mergeError(err, writer.readerPool.release(rld))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	writer._incRefDeleter(segmentInfos)
+
+	r = newStandardDirectoryReader(dir, readers, writer, segmentInfos,
+		writer.config.readerTermsIndexDivisor, applyAllDeletes)
+	success = true
+	return r, nil
+}
+
+/*
+This constructor is only used for doOpenIfChanged(SegmentInfos); it
+reuses the SegmentReaders of the old reader whose segments are
+unchanged.
+*/
+func openStandardDirectoryReaderReusing(directory store.Directory, infos *SegmentInfos,
+	oldReaders []IndexReader, termInfosIndexDivisor int) (r DirectoryReader, err error) {
+
+	// we put the old SegmentReaders in a map, that allows us to lookup
+	// a reader using its segment name
+	segmentReaders := make(map[string]int)
+	for i, r := range oldReaders {
+		segmentReaders[r.(*SegmentReader).SegmentName()] = i
+	}
+
+	newReaders := make([]AtomicReader, len(infos.Segments))
+
+	// remember which readers are shared between the old and the
+	// re-opened DirectoryReader - we have to incRef those readers
+	readerShared := make([]bool, len(infos.Segments))
+
+	for i := len(infos.Segments) - 1; i >= 0; i-- {
+		info := infos.Segments[i]
+		// find SegmentReader for this segment
+		var oldReader *SegmentReader
+		if oldReaderIndex, ok := segmentReaders[info.info.Name]; ok {
+			// there is an old reader for this segment - we'll try to
+			// reopen it
+			oldReader = oldReaders[oldReaderIndex].(*SegmentReader)
+		}
+
+		var newReader *SegmentReader
+		if oldReader == nil || info.info.IsCompoundFile() != oldReader.si.info.IsCompoundFile() {
+			// this is a new reader; in case we hit an error we can close
+			// it safely
+			newReader, err = NewSegmentReader(info, termInfosIndexDivisor, store.IO_CONTEXT_READ)
+			readerShared[i] = false
+		} else if oldReader.isNRT {
+			// the live docs of an NRT reader may hold uncommitted
+			// deletes, so load the committed ones
+			readerShared[i] = false
+			assert(info.info.Dir == oldReader.si.info.Dir)
+			newReader, err = newSegmentReaderFromCore(info, oldReader.core, store.IO_CONTEXT_READ)
+		} else if oldReader.si.delGen == info.delGen {
+			// No change; this reader will be shared between the old and
+			// the new one, so we must incRef it:
+			readerShared[i] = true
+			oldReader.incRef()
+			newReader = oldReader
+		} else {
+			readerShared[i] = false
+			// Steal the ref returned by SegmentReader ctor:
+			assert(info.info.Dir == oldReader.si.info.Dir)
+			assert(info.HasDeletions())
+			newReader, err = newSegmentReaderFromCore(info, oldReader.core, store.IO_CONTEXT_READ)
+		}
+		if err != nil {
+			for i++; i < len(infos.Segments); i++ {
+				if newReaders[i] != nil {
+					if !readerShared[i] {
+						// this is a new subReader that is not used by the old
+						// one, we can close it
+						newReaders[i].Close()
+					} else {
+						// this subReader is also used by the old reader, so
+						// instead closing we must decRef it
+						newReaders[i].decRef()
+					}
+				}
+			}
+			return nil, err
+		}
+		newReaders[i] = newReader
+	}
+	return newStandardDirectoryReader(directory, newReaders, nil, infos, termInfosIndexDivisor, false), nil
+}
+
 func (r *StandardDirectoryReader) String() string {
 	var buf bytes.Buffer
 	buf.WriteString("StandardDirectoryReader(")
@@ -138,9 +406,9 @@ func (r *StandardDirectoryReader) String() string {
 	if segmentsFile != "" {
 		fmt.Fprintf(&buf, "%v:%v", segmentsFile, r.segmentInfos.version)
 	}
-	// if r.writer != nil {
-	// fmt.Fprintf(w, "%v", r.writer)
-	// }
+	if r.writer != nil {
+		fmt.Fprintf(&buf, ":nrt")
+	}
 	for _, v := range r.getSequentialSubReaders() {
 		fmt.Fprintf(&buf, " %v", v)
 	}
@@ -148,6 +416,86 @@ func (r *StandardDirectoryReader) String() string {
 	return buf.String()
 }
 
+func (r *StandardDirectoryReader) doOpenIfChanged() (DirectoryReader, error) {
+	return r.doOpenIfChangedAtCommit(nil)
+}
+
+func (r *StandardDirectoryReader) doOpenIfChangedAtCommit(commit IndexCommit) (DirectoryReader, error) {
+	r.ensureOpen()
+
+	// If we were obtained by writer.getReader(), re-ask the writer to
+	// get a new reader.
+	if r.writer != nil {
+		return r.doOpenFromWriter(commit)
+	}
+	return r.doOpenNoWriter(commit)
+}
+
+func (r *StandardDirectoryReader) doOpenIfChangedWithWriter(w *IndexWriter,
+	applyAllDeletes bool) (DirectoryReader, error) {
+	r.ensureOpen()
+	if w == r.writer && applyAllDeletes == r.applyAllDeletes {
+		return r.doOpenFromWriter(nil)
+	}
+	return w.getReader(applyAllDeletes)
+}
+
+func (r *StandardDirectoryReader) doOpenFromWriter(commit IndexCommit) (DirectoryReader, error) {
+	if commit != nil {
+		return r.doOpenFromCommit(commit)
+	}
+
+	if r.writer.nrtIsCurrent(r.segmentInfos) {
+		return nil, nil
+	}
+
+	reader, err := r.writer.getReader(r.applyAllDeletes)
+	if err != nil {
+		return nil, err
+	}
+
+	// If in fact no changes took place, return nil:
+	if reader.Version() == r.segmentInfos.version {
+		return nil, reader.decRef()
+	}
+	return reader, nil
+}
+
+func (r *StandardDirectoryReader) doOpenNoWriter(commit IndexCommit) (DirectoryReader, error) {
+	if commit == nil {
+		if r.IsCurrent() {
+			return nil, nil
+		}
+	} else {
+		if r.directory != commit.Directory() {
+			return nil, errors.New("the specified commit does not match the specified Directory")
+		}
+		if r.segmentInfos != nil && commit.SegmentsFileName() == r.segmentInfos.SegmentsFileName() {
+			return nil, nil
+		}
+	}
+	return r.doOpenFromCommit(commit)
+}
+
+func (r *StandardDirectoryReader) doOpenFromCommit(commit IndexCommit) (DirectoryReader, error) {
+	obj, err := NewFindSegmentsFile(r.directory, func(segmentFileName string) (interface{}, error) {
+		infos := &SegmentInfos{}
+		if err := infos.Read(r.directory, segmentFileName); err != nil {
+			return nil, err
+		}
+		return r.doOpenIfChangedFromInfos(infos)
+	}).run(commit)
+	if err != nil {
+		return nil, err
+	}
+	return obj.(DirectoryReader), nil
+}
+
+func (r *StandardDirectoryReader) doOpenIfChangedFromInfos(infos *SegmentInfos) (DirectoryReader, error) {
+	return openStandardDirectoryReaderReusing(r.directory, infos,
+		r.getSequentialSubReaders(), r.termInfosIndexDivisor)
+}
+
 func (r *StandardDirectoryReader) Version() int64 {
 	r.ensureOpen()
 	return r.segmentInfos.version
@@ -155,22 +503,89 @@ func (r *StandardDirectoryReader) Version() int64 {
 
 func (r *StandardDirectoryReader) IsCurrent() bool {
 	r.ensureOpen()
-	// if writer == nill || writer.IsClosed() {
-	// Fully read the segments file: this ensures that it's
-	// completely written so that if
-	// IndexWriter.prepareCommit has been called (but not
-	// yet commit), then the reader will still see itself as
-	// current:
-	sis := SegmentInfos{}
-	sis.ReadAll(r.directory)
-
-	// we loaded SegmentInfos from the directory
-	return sis.version == r.segmentInfos.version
-	// } else {
-	// return writer.nrtIsCurrent(r.segmentInfos)
-	// }
-}
-
-func (r *StandardDirectoryReader) doClose() error {
-	panic("not implemented yet")
+	if r.writer == nil || r.writer.isClosed() {
+		// Fully read the segments file: this ensures that it's
+		// completely written so that if IndexWriter.prepareCommit has
+		// been called (but not yet commit), then the reader will still
+		// see itself as current:
+		sis := SegmentInfos{}
+		sis.ReadAll(r.directory)
+
+		// we loaded SegmentInfos from the directory
+		return sis.version == r.segmentInfos.version
+	}
+	return r.writer.nrtIsCurrent(r.segmentInfos)
+}
+
+/* An IndexCommit read back from the Directory, which can't be deleted. */
+type readerCommit struct {
+	segmentsFileName string
+	files            []string
+	dir              store.Directory
+	generation       int64
+	userData         map[string]string
+	segmentCount     int
+}
+
+func newReaderCommit(infos *SegmentInfos, dir store.Directory) *readerCommit {
+	return &readerCommit{
+		segmentsFileName: infos.SegmentsFileName(),
+		files:            infos.files(dir, true),
+		dir:              dir,
+		generation:       infos.generation,
+		userData:         infos.userData,
+		segmentCount:     len(infos.Segments),
+	}
+}
+
+func (rc *readerCommit) String() string {
+	return fmt.Sprintf("DirectoryReader.ReaderCommit(%v)", rc.segmentsFileName)
+}
+
+func (rc *readerCommit) SegmentCount() int {
+	return rc.segmentCount
+}
+
+func (rc *readerCommit) SegmentsFileName() string {
+	return rc.segmentsFileName
+}
+
+func (rc *readerCommit) FileNames() []string {
+	return rc.files
+}
+
+func (rc *readerCommit) Directory() store.Directory {
+	return rc.dir
+}
+
+func (rc *readerCommit) Generation() int64 {
+	return rc.generation
+}
+
+func (rc *readerCommit) IsDeleted() bool {
+	return false
+}
+
+func (rc *readerCommit) UserData() map[string]string {
+	return rc.userData
+}
+
+func (rc *readerCommit) Delete() {
+	panic("This IndexCommit does not support deletions")
+}
+
+func (r *StandardDirectoryReader) doClose() (err error) {
+	for _, sub := range r.getSequentialSubReaders() {
+		// try to close each reader, even if an error is returned
+		err = mergeError(err, sub.decRef())
+	}
+
+	if r.writer != nil && !r.writer.isClosed() {
+		// If our original writer was closed before we were, this may
+		// leave some un-referenced files in the index, which is
+		// harmless. The next time IW is opened on the index, it will
+		// delete them.
+		r.writer.decRefDeleter(r.segmentInfos)
+	}
+	return
 }
@@ -3,6 +3,7 @@ package index
 import (
 	"fmt"
 	"github.com/balzaczyy/golucene/core/store"
+	"github.com/balzaczyy/golucene/core/util"
 	"testing"
 )
 
@@ -26,3 +27,216 @@ func TestLeaves(t *testing.T) {
 		t.Error("Should have one sub reader.")
 	}
 }
+
+func TestOpenIfChangedUnchanged(t *testing.T) {
+	path := "../search/testdata/win8/belfrysample"
+	d, err := store.OpenFSDirectory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := OpenDirectoryReader(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := OpenIfChanged(r)
+	if err != nil {
+		t.Error(err)
+	}
+	if r2 != nil {
+		t.Error("Should return nil when the index is unchanged.")
+	}
+	if err = r.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func checkReader(t *testing.T, r DirectoryReader, numDocs, maxDoc int) {
+	if r == nil {
+		t.Fatal("expected a new reader")
+	}
+	if r.NumDocs() != numDocs || r.MaxDoc() != maxDoc {
+		t.Errorf("expected %v of %v docs, got %v of %v", numDocs, maxDoc, r.NumDocs(), r.MaxDoc())
+	}
+}
+
+func TestNRTReader(t *testing.T) {
+	d := store.NewRAMDirectory()
+	w, err := NewIndexWriter(d, NewIndexWriterConfig(util.VERSION_45, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	addSample(t, w, "../search/testdata/belfrysample")
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	committed, err := OpenDirectoryReader(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer committed.Close()
+
+	// uncommitted adds are visible
+	addSample(t, w, "../search/testdata/osx/belfrysample")
+	r1, err := OpenDirectoryReaderFromWriter(w, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r1.Close()
+	checkReader(t, r1, 16, 16)
+	checkReader(t, committed, 8, 8)
+	if r, err := OpenIfChangedWithWriter(r1, w, true); err != nil || r != nil {
+		t.Fatalf("expected no new reader without changes: %v", err)
+	}
+
+	// unchanged segments are shared
+	addSample(t, w, "../search/testdata/win8/belfrysample")
+	r2, err := OpenIfChangedWithWriter(r1, w, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReader(t, r2, 24, 24)
+	defer r2.Close()
+	if len(r2.Leaves()) != 3 {
+		t.Fatalf("expected 3 leaves, got %v", len(r2.Leaves()))
+	}
+	for i, leaf := range r1.Leaves() {
+		if r2.Leaves()[i].reader != leaf.reader {
+			t.Errorf("expected reader of leaf %v to be shared", i)
+		}
+	}
+
+	// uncommitted deletes are visible
+	your := NewTerm("title", "your")
+	if err = w.DeleteDocuments(&your); err != nil {
+		t.Fatal(err)
+	}
+	r3, err := OpenIfChangedWithWriter(r2, w, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r3.Close()
+	checkReader(t, r3, 15, 24)
+	checkReader(t, r2, 24, 24)
+
+	// back to the last commit, and forward again
+	commits, err := ListCommits(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r4, err := OpenIfChangedAtCommit(r3, commits[len(commits)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r4.Close()
+	checkReader(t, r4, 8, 8)
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if commits, err = ListCommits(d); err != nil {
+		t.Fatal(err)
+	}
+	r5, err := OpenIfChangedAtCommit(committed, commits[len(commits)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r5.Close()
+	checkReader(t, r5, 15, 24)
+	if r, err := OpenIfChangedAtCommit(r5, commits[len(commits)-1]); err != nil || r != nil {
+		t.Errorf("expected no new reader at the same commit: %v", err)
+	}
+}
+
+func TestOpenIfChangedSharesSegments(t *testing.T) {
+	d := store.NewRAMDirectory()
+	w, err := NewIndexWriter(d, NewIndexWriterConfig(util.VERSION_45, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	addSample(t, w, "../search/testdata/belfrysample")
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	r1, err := OpenDirectoryReader(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r1.Close()
+
+	addSample(t, w, "../search/testdata/osx/belfrysample")
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	r2, err := OpenIfChanged(r1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r2.Close()
+	checkReader(t, r2, 16, 16)
+	if len(r2.Leaves()) != 2 || r2.Leaves()[0].reader != r1.Leaves()[0].reader {
+		t.Error("expected the reader of the unchanged segment to be shared")
+	}
+}
+
+func TestNRTReaderAddDocument(t *testing.T) {
+	for _, applyAllDeletes := range []bool{true, false} {
+		d := store.NewRAMDirectory()
+		w, err := NewIndexWriter(d, NewIndexWriterConfig(util.VERSION_45, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		addDoc := func(id string) {
+			if err := w.AddDocument([]IndexableField{
+				NewStringField("id", id, STRING_FIELD_TYPE_NOT_STORED),
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		addDoc("doc0")
+		r1, err := OpenDirectoryReaderFromWriter(w, applyAllDeletes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkReader(t, r1, 1, 1)
+
+		// buffered documents are flushed on reopen
+		addDoc("doc1")
+		addDoc("doc2")
+		r2, err := OpenIfChangedWithWriter(r1, w, applyAllDeletes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkReader(t, r2, 3, 3)
+		checkReader(t, r1, 1, 1)
+
+		doc1 := NewTerm("id", "doc1")
+		if err = w.DeleteDocuments(&doc1); err != nil {
+			t.Fatal(err)
+		}
+		r3, err := OpenIfChangedWithWriter(r2, w, applyAllDeletes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !applyAllDeletes {
+			// the delete is only buffered, so nothing visible changed
+			if r3 != nil {
+				t.Fatalf("expected no new reader for unapplied deletes, got %v of %v docs",
+					r3.NumDocs(), r3.MaxDoc())
+			}
+			if r3, err = OpenIfChangedWithWriter(r2, w, true); err != nil {
+				t.Fatal(err)
+			}
+		}
+		checkReader(t, r3, 2, 3)
+		checkReader(t, r2, 3, 3)
+
+		r1.Close()
+		r2.Close()
+		r3.Close()
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"github.com/balzaczyy/golucene/core/index/model"
 	"github.com/balzaczyy/golucene/core/store"
 	"github.com/balzaczyy/golucene/core/util"
+	"hash/fnv"
+	"sort"
 )
 
 // index/DocConsumer.java
@@ -11,7 +13,7 @@ import (
 type DocConsumer interface {
 	processDocument(fieldInfos *model.FieldInfosBuilder) error
 	finishDocument() error
-	flush(state SegmentWriteState) error
+	flush(state *SegmentWriteState) error
 	abort()
 }
 
@@ -34,6 +36,7 @@ type DocFieldProcessor struct {
 
 	// Hash table for all fields ever seen
 	fieldHash       []*DocFieldProcessorPerField
+	hashMask        uint32
 	totalFieldCount int
 
 	fieldGen int
@@ -48,6 +51,7 @@ func newDocFieldProcessor(docWriter *DocumentsWriterPerThread,
 
 	return &DocFieldProcessor{
 		fieldHash:      make([]*DocFieldProcessorPerField, 2),
+		hashMask:       1,
 		docState:       docWriter.docState,
 		codec:          docWriter.codec,
 		bytesUsed:      docWriter._bytesUsed,
@@ -56,7 +60,7 @@ func newDocFieldProcessor(docWriter *DocumentsWriterPerThread,
 	}
 }
 
-func (p *DocFieldProcessor) flush(state SegmentWriteState) error {
+func (p *DocFieldProcessor) flush(state *SegmentWriteState) error {
 	childFields := make(map[string]DocFieldConsumerPerField)
 	for _, f := range p.fields() {
 		childFields[f.fieldInfo().Name] = f
@@ -104,6 +108,34 @@ func (p *DocFieldProcessor) fields() []DocFieldConsumerPerField {
 	return fields
 }
 
+func fieldNameHash(name string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return h.Sum32()
+}
+
+func (p *DocFieldProcessor) rehash() {
+	newHashSize := len(p.fieldHash) * 2
+	assert(newHashSize > len(p.fieldHash))
+
+	newHashArray := make([]*DocFieldProcessorPerField, newHashSize)
+
+	// Rehash
+	newHashMask := uint32(newHashSize - 1)
+	for _, fp0 := range p.fieldHash {
+		for fp0 != nil {
+			hashPos2 := fieldNameHash(fp0.fieldInfo.Name) & newHashMask
+			nextFP0 := fp0.next
+			fp0.next = newHashArray[hashPos2]
+			newHashArray[hashPos2] = fp0
+			fp0 = nextFP0
+		}
+	}
+
+	p.fieldHash = newHashArray
+	p.hashMask = newHashMask
+}
+
 func (p *DocFieldProcessor) processDocument(fieldInfos *model.FieldInfosBuilder) error {
 	p.consumer.startDocument()
 	p.storedConsumer.startDocument()
@@ -119,31 +151,72 @@ func (p *DocFieldProcessor) processDocument(fieldInfos *model.FieldInfosBuilder)
 
 	for _, field := range p.docState.doc {
 		fieldName := field.name()
+		ft := field.fieldType()
 
 		// Make sure we have a PerField allocated
-		// TODO need a better hash code algorithm here
-		hashPos := len(fieldName) / 2
+		hashPos := fieldNameHash(fieldName) & p.hashMask
 		fp := p.fieldHash[hashPos]
 		for fp != nil && fp.fieldInfo.Name != fieldName {
 			fp = fp.next
 		}
 
 		if fp == nil {
-			panic("not implemented yet")
+			// TODO FI: we need to genericize the "flags" that a field
+			// holds, and, how these flags are merged; it needs to be more
+			// "pluggable" such that if I want to have a new "thing" my
+			// Fields can do, I can easily add it
+			fi := fieldInfos.AddOrUpdate(fieldName, ft.Indexed(), ft.StoreTermVectors(),
+				ft.omitNorms(), ft.indexOptions(), ft.docValueType())
+
+			fp = newDocFieldProcessorPerField(p, fi)
+			fp.next = p.fieldHash[hashPos]
+			p.fieldHash[hashPos] = fp
+			p.totalFieldCount++
+
+			if p.totalFieldCount >= len(p.fieldHash)/2 {
+				p.rehash()
+			}
 		} else {
-			panic("not implemented yet")
+			fp.fieldInfo = fieldInfos.AddOrUpdate(fp.fieldInfo.Name, ft.Indexed(),
+				ft.StoreTermVectors(), ft.omitNorms(), ft.indexOptions(), ft.docValueType())
 		}
 
 		if thisFieldGen != fp.lastGen {
-			panic("not implemented yet")
+			// First time we're seeing this field for this doc
+			fp.fields = fp.fields[:0]
+			if p.fieldCount == len(p._fields) {
+				p._fields = append(p._fields, fp)
+			} else {
+				p._fields[p.fieldCount] = fp
+			}
+			p.fieldCount++
+			fp.lastGen = thisFieldGen
 		}
 
 		fp.addField(field)
 		p.storedConsumer.addField(p.docState.docID, field, fp.fieldInfo)
 	}
+
+	// If we are writing vectors then we must visit fields in sorted
+	// order so they are written in sorted order. TODO: we actually
+	// only need to sort the subset of fields that have vectors enabled;
+	// we could save [small amount of] CPU here.
+	fields := p._fields[:p.fieldCount]
+	sort.Sort(byFieldName(fields))
+	for _, perField := range fields {
+		if err := perField.consumer.processFields(perField.fields); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+type byFieldName []*DocFieldProcessorPerField
+
+func (a byFieldName) Len() int           { return len(a) }
+func (a byFieldName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byFieldName) Less(i, j int) bool { return a[i].fieldInfo.Name < a[j].fieldInfo.Name }
+
 func (p *DocFieldProcessor) finishDocument() (err error) {
 	defer func() {
 		err = mergeError(err, p.consumer.finishDocument())
@@ -160,17 +233,21 @@ type DocFieldProcessorPerField struct {
 
 	next    *DocFieldProcessorPerField
 	lastGen int // -1
+
+	fields []IndexableField
 }
 
-// func newDocFieldProcessorPerField(docFieldProcessor *DocFieldProcessor,
-// 	fieldInfo model.FieldInfo) *DocFieldProcessorPerField {
-// 	return &DocFieldProcessorPerField{
-// 		consumer: docFieldProcessor.consumer.addField()
-// 	}
-// }
+func newDocFieldProcessorPerField(docFieldProcessor *DocFieldProcessor,
+	fieldInfo model.FieldInfo) *DocFieldProcessorPerField {
+	return &DocFieldProcessorPerField{
+		consumer:  docFieldProcessor.consumer.addField(fieldInfo),
+		fieldInfo: fieldInfo,
+		lastGen:   -1,
+	}
+}
 
 func (f *DocFieldProcessorPerField) addField(field IndexableField) {
-	panic("not implemented yet")
+	f.fields = append(f.fields, field)
 }
 
 func (f *DocFieldProcessorPerField) abort() {
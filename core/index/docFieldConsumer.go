@@ -1,12 +1,16 @@
 package index
 
+import (
+	"github.com/balzaczyy/golucene/core/index/model"
+)
+
 type DocFieldConsumer interface {
 	// Called when DWPT decides to create a new segment
-	flush(fieldsToFlush map[string]DocFieldConsumerPerField, state SegmentWriteState) error
+	flush(fieldsToFlush map[string]DocFieldConsumerPerField, state *SegmentWriteState) error
 	// Called when an aborting error is hit
 	abort()
 	startDocument()
-	// addField(fi FieldInfo) DocFieldConsumerPerField
+	addField(fi model.FieldInfo) DocFieldConsumerPerField
 	finishDocument() error
 }
 
@@ -26,18 +30,33 @@ func newDocInverter(docState *docState, consumer InvertedDocConsumer,
 	return &DocInverter{consumer, endConsumer, docState}
 }
 
-func (di *DocInverter) flush(fieldsToFlush map[string]DocFieldConsumerPerField, state SegmentWriteState) error {
-	panic("not implemented yet")
+func (di *DocInverter) flush(fieldsToFlush map[string]DocFieldConsumerPerField, state *SegmentWriteState) error {
+	childFieldsToFlush := make(map[string]InvertedDocConsumerPerField)
+	endChildFieldsToFlush := make(map[string]InvertedDocEndConsumerPerField)
+
+	for name, field := range fieldsToFlush {
+		perField := field.(*DocInverterPerField)
+		childFieldsToFlush[name] = perField.consumer
+		endChildFieldsToFlush[name] = perField.endConsumer
+	}
+
+	if err := di.consumer.flush(childFieldsToFlush, state); err != nil {
+		return err
+	}
+	return di.endConsumer.flush(endChildFieldsToFlush, state)
 }
 
 func (di *DocInverter) startDocument() {
-	// di.consumer.startDocument()
-	// di.endConsumer.startDocument()
-	panic("not implemented yet")
+	di.consumer.startDocument()
+	di.endConsumer.startDocument()
 }
 
 func (di *DocInverter) finishDocument() error {
-	panic("not implemented yet")
+	// TODO: allow endConsumer.finishDocument to also return a DocWriter
+	if err := di.endConsumer.finishDocument(); err != nil {
+		return err
+	}
+	return di.consumer.finishDocument()
 }
 
 func (di *DocInverter) abort() {
@@ -45,3 +64,7 @@ func (di *DocInverter) abort() {
 	di.consumer.abort()
 
 }
+
+func (di *DocInverter) addField(fi model.FieldInfo) DocFieldConsumerPerField {
+	return newDocInverterPerField(di, fi)
+}
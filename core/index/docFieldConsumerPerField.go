@@ -1,10 +1,205 @@
 package index
 
 import (
+	"errors"
+	"fmt"
 	"github.com/balzaczyy/golucene/core/index/model"
+	"github.com/balzaczyy/golucene/core/util"
 )
 
 type DocFieldConsumerPerField interface {
+	// Processes all occurrences of a single field
+	processFields(fields []IndexableField) error
 	abort()
 	fieldInfo() model.FieldInfo
 }
+
+// index/DocInverterPerField.java
+
+/*
+Holds state for inverting all occurrences of a single field in the
+document. This class doesn't do anything itself; instead, it forwards
+the tokens produced by analysis to its own consumer
+(InvertedDocConsumerPerField). It also interacts with an endConsumer
+(InvertedDocEndConsumerPerField).
+*/
+type DocInverterPerField struct {
+	_fieldInfo  model.FieldInfo
+	consumer    InvertedDocConsumerPerField
+	endConsumer InvertedDocEndConsumerPerField
+	docState    *docState
+	fieldState  *FieldInvertState
+}
+
+func newDocInverterPerField(parent *DocInverter, fieldInfo model.FieldInfo) *DocInverterPerField {
+	ans := &DocInverterPerField{
+		_fieldInfo: fieldInfo,
+		docState:   parent.docState,
+		fieldState: newFieldInvertState(fieldInfo.Name),
+	}
+	ans.consumer = parent.consumer.addField(ans, fieldInfo)
+	ans.endConsumer = parent.endConsumer.addField(ans, fieldInfo)
+	return ans
+}
+
+func (f *DocInverterPerField) abort() {
+	defer f.endConsumer.abort()
+	f.consumer.abort()
+}
+
+func (f *DocInverterPerField) fieldInfo() model.FieldInfo {
+	return f._fieldInfo
+}
+
+func (f *DocInverterPerField) processFields(fields []IndexableField) error {
+	// the field may have been updated by this document, e.g. turning
+	// on indexing
+	if fi, ok := f.docState.docWriter.fieldInfos.FieldInfo(f._fieldInfo.Name); ok {
+		f._fieldInfo = fi
+	}
+
+	f.fieldState.reset()
+
+	doInvert, err := f.consumer.start(fields)
+	if err != nil {
+		return err
+	}
+
+	for i, field := range fields {
+		fieldType := field.fieldType()
+
+		// TODO FI: this should be "genericized" to querying consumer if
+		// it wants to see this particular field tokenized.
+		if !fieldType.Indexed() || !doInvert {
+			continue
+		}
+		analyzed := fieldType.tokenized() && f.docState.analyzer != nil
+
+		// if the field omits norms, the boost cannot be indexed.
+		if fieldType.omitNorms() && field.boost() != 1.0 {
+			return errors.New(fmt.Sprintf(
+				"You cannot set an index-time boost: norms are omitted for field '%v'",
+				field.name()))
+		}
+
+		// only bother checking offsets if something will consume them.
+		// TODO: after we fix analyzers, also check if termVectorOffsets will be indexed.
+		checkOffsets := fieldType.indexOptions() == model.INDEX_OPT_DOCS_AND_FREQS_AND_POSITIONS_AND_OFFSETS
+		lastStartOffset := 0
+
+		if i > 0 && analyzed {
+			f.fieldState.position += f.docState.analyzer.PositionIncrementGap(f._fieldInfo.Name)
+		}
+
+		stream, err := field.tokenStream(f.docState.analyzer)
+		if err != nil {
+			return err
+		}
+		err = func() (err error) {
+			var success = false
+			defer func() {
+				if success {
+					err = stream.Close()
+				} else {
+					util.CloseWhileSuppressingError(stream)
+				}
+			}()
+
+			// reset the TokenStream to the first token
+			if err = stream.Reset(); err != nil {
+				return err
+			}
+			token := stream.Token()
+			for {
+				hasMoreTokens, err := stream.IncrementToken()
+				if err != nil {
+					return err
+				}
+				if !hasMoreTokens {
+					break
+				}
+
+				// If we hit an error in here, we abort all buffered
+				// documents since the last flush, on the likelihood that
+				// the internal state of the consumer is now corrupt and
+				// should not be flushed to a new segment:
+				posIncr := token.PositionIncrement
+				if posIncr < 0 {
+					return errors.New(fmt.Sprintf(
+						"position increment must be >=0 (got %v)", posIncr))
+				}
+				if f.fieldState.position == 0 && posIncr == 0 {
+					return errors.New("first position increment must be > 0 (got 0)")
+				}
+				position := f.fieldState.position + posIncr
+				if position > 0 {
+					// NOTE: confusing: this "mirrors" the position++ we do below
+					position--
+				} else if position < 0 {
+					return errors.New(fmt.Sprintf(
+						"position overflow for field '%v'", field.name()))
+				}
+
+				// position is legal, we can safely place it in fieldState
+				// now. not sure if anything will use fieldState after
+				// non-aborting error...
+				f.fieldState.position = position
+
+				if posIncr == 0 {
+					f.fieldState.numOverlap++
+				}
+
+				startOffset := f.fieldState.offset + token.StartOffset
+				endOffset := f.fieldState.offset + token.EndOffset
+				if checkOffsets {
+					if startOffset < 0 || endOffset < startOffset {
+						return errors.New(fmt.Sprintf(
+							"startOffset must be non-negative, and endOffset must be >= startOffset, startOffset=%v,endOffset=%v",
+							startOffset, endOffset))
+					}
+					if startOffset < lastStartOffset {
+						return errors.New(fmt.Sprintf(
+							"offsets must not go backwards startOffset=%v is < lastStartOffset=%v",
+							startOffset, lastStartOffset))
+					}
+					lastStartOffset = startOffset
+				}
+
+				if len(token.Term) > MAX_TERM_LENGTH_UTF8 {
+					// Just skip this term, to remain as robust as possible
+					if f.docState.infoStream.IsEnabled("IW") {
+						f.docState.infoStream.Message("IW",
+							"WARNING: document contains at least one immense term in field=\"%v\" (whose UTF8 encoding is longer than the max length %v); it will be skipped",
+							f._fieldInfo.Name, MAX_TERM_LENGTH_UTF8)
+					}
+				} else {
+					f.consumer.add(token.Term, position, token.Payload, startOffset, endOffset)
+				}
+				f.fieldState.length++
+				f.fieldState.position++
+			}
+
+			// trigger stream to perform end-of-stream operations
+			if err = stream.End(); err != nil {
+				return err
+			}
+			// TODO: maybe add some safety? then again, it's already
+			// checked when we come back around to the field...
+			f.fieldState.offset += token.EndOffset
+			success = true
+			return nil
+		}()
+		if err != nil {
+			return err
+		}
+
+		if analyzed {
+			f.fieldState.offset += f.docState.analyzer.OffsetGap(f._fieldInfo.Name)
+		}
+		f.fieldState.boost *= field.boost()
+	}
+
+	f.consumer.finish()
+	f.endConsumer.finish()
+	return nil
+}
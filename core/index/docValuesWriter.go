@@ -1,5 +1,77 @@
 package index
 
+import (
+	"github.com/balzaczyy/golucene/core/index/model"
+	"github.com/balzaczyy/golucene/core/util"
+)
+
 type DocValuesWriter interface {
 	abort()
+	finish(numDoc int)
+	flush(state *SegmentWriteState, consumer DocValuesConsumer) error
+}
+
+// index/NumericDocValuesWriter.java
+
+const MISSING int64 = 0
+
+/*
+Buffers up pending long per doc, then flushes when segment flushes.
+*/
+type NumericDocValuesWriter struct {
+	pending     []int64
+	iwBytesUsed util.Counter
+	bytesUsed   int64
+	fieldInfo   model.FieldInfo
 }
+
+func newNumericDocValuesWriter(fieldInfo model.FieldInfo,
+	iwBytesUsed util.Counter) *NumericDocValuesWriter {
+	return &NumericDocValuesWriter{
+		fieldInfo:   fieldInfo,
+		iwBytesUsed: iwBytesUsed,
+	}
+}
+
+func (w *NumericDocValuesWriter) addValue(docID int, value int64) {
+	assertn(docID >= len(w.pending),
+		"DocValuesField \"%v\" appears more than once in this document (only one value is allowed per field)",
+		w.fieldInfo.Name)
+
+	// Fill in any holes:
+	for len(w.pending) < docID {
+		w.pending = append(w.pending, MISSING)
+	}
+	w.pending = append(w.pending, value)
+	w.updateBytesUsed()
+}
+
+func (w *NumericDocValuesWriter) updateBytesUsed() {
+	newBytesUsed := int64(cap(w.pending)) * 8 // int64
+	w.iwBytesUsed.AddAndGet(newBytesUsed - w.bytesUsed)
+	w.bytesUsed = newBytesUsed
+}
+
+func (w *NumericDocValuesWriter) finish(maxDoc int) {
+	for len(w.pending) < maxDoc {
+		w.pending = append(w.pending, MISSING)
+	}
+	w.updateBytesUsed()
+}
+
+func (w *NumericDocValuesWriter) flush(state *SegmentWriteState, dvConsumer DocValuesConsumer) error {
+	maxDoc := state.segmentInfo.DocCount()
+	assert(len(w.pending) == maxDoc)
+	return dvConsumer.AddNumericField(w.fieldInfo, func() func() (int64, bool) {
+		upto := 0
+		return func() (int64, bool) {
+			if upto >= maxDoc {
+				return 0, false
+			}
+			upto++
+			return w.pending[upto-1], true
+		}
+	})
+}
+
+func (w *NumericDocValuesWriter) abort() {}
@@ -2,6 +2,7 @@ package index
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"github.com/balzaczyy/golucene/core/analysis"
 	"github.com/balzaczyy/golucene/core/index/model"
@@ -9,6 +10,7 @@ import (
 	"io"
 	"log"
 	"strconv"
+	"strings"
 )
 
 // document/Document.java
@@ -296,7 +298,7 @@ func NewStringField(name, value string, ft *FieldType) *Field {
 		"it doesn't make sense to have a field that is neither indexed nor stored")
 	assert2(ft.indexed || !ft.storeTermVectors,
 		"can not store term vector information for a field that is not indexed")
-	return &Field{_type: ft, _name: name, _data: value}
+	return &Field{_type: ft, _name: name, _data: value, _boost: 1.0}
 }
 
 func (f *Field) stringValue() string {
@@ -354,9 +356,109 @@ func (f *Field) fieldType() IndexableFieldType {
 }
 
 func (f *Field) tokenStream(analyzer analysis.Analyzer) (ts analysis.TokenStream, err error) {
-	panic("not implemented yet")
+	if !f.fieldType().Indexed() {
+		return nil, nil
+	}
+
+	if !f.fieldType().tokenized() {
+		value, ok := f._data.(string)
+		if !ok {
+			return nil, errors.New("Non-Tokenized Fields must have a String value")
+		}
+		if _, ok = f.internalTokenStream.(*StringTokenStream); !ok {
+			f.internalTokenStream = new(StringTokenStream)
+		}
+		f.internalTokenStream.(*StringTokenStream).setValue(value)
+		return f.internalTokenStream, nil
+	}
+
+	if f._tokenStream != nil {
+		return f._tokenStream, nil
+	}
+	if analyzer == nil {
+		return nil, errors.New(fmt.Sprintf(
+			"an analyzer is required to index the tokenized field '%v'", f._name))
+	}
+	switch v := f._data.(type) {
+	case io.Reader:
+		return analyzer.TokenStream(f._name, v)
+	case string:
+		return analyzer.TokenStream(f._name, strings.NewReader(v))
+	}
+	return nil, errors.New("Field must have either TokenStream, String or Reader value")
 }
 
+/* A TokenStream returning the whole value of a field as a single token. */
+type StringTokenStream struct {
+	token *analysis.Token
+	value string
+	used  bool
+}
+
+/* Sets the string value. */
+func (ts *StringTokenStream) setValue(value string) {
+	ts.value = value
+}
+
+func (ts *StringTokenStream) Reset() error {
+	if ts.token == nil {
+		ts.token = new(analysis.Token)
+	}
+	ts.used = false
+	return nil
+}
+
+func (ts *StringTokenStream) IncrementToken() (bool, error) {
+	if ts.used {
+		return false, nil
+	}
+	ts.token.Clear()
+	ts.token.Term = append(ts.token.Term, ts.value...)
+	ts.token.StartOffset, ts.token.EndOffset = 0, len(ts.value)
+	ts.used = true
+	return true, nil
+}
+
+func (ts *StringTokenStream) End() error {
+	ts.token.StartOffset, ts.token.EndOffset = len(ts.value), len(ts.value)
+	return nil
+}
+
+func (ts *StringTokenStream) Close() error {
+	ts.value = ""
+	return nil
+}
+
+func (ts *StringTokenStream) Token() *analysis.Token {
+	return ts.token
+}
+
+// document/StringField.java
+
+var (
+	// Indexed, not tokenized, omits norms, indexes DOCS_ONLY, not stored.
+	STRING_FIELD_TYPE_NOT_STORED = func() *FieldType {
+		ft := newFieldType()
+		ft.indexed = true
+		ft._omitNorms = true
+		ft._indexOptions = model.INDEX_OPT_DOCS_ONLY
+		ft._tokenized = false
+		ft.frozen = true
+		return ft
+	}()
+	// Indexed, not tokenized, omits norms, indexes DOCS_ONLY, stored
+	STRING_FIELD_TYPE_STORED = func() *FieldType {
+		ft := newFieldType()
+		ft.indexed = true
+		ft._omitNorms = true
+		ft._indexOptions = model.INDEX_OPT_DOCS_ONLY
+		ft.stored = true
+		ft._tokenized = false
+		ft.frozen = true
+		return ft
+	}()
+)
+
 // document/TextField.java
 
 var (
@@ -113,8 +113,49 @@ func newDocumentsWriter(writer *IndexWriter, config *LiveIndexWriterConfig, dire
 	return ans
 }
 
+func (dw *DocumentsWriter) deleteQueries(queries ...Query) (bool, error) {
+	dw.Lock() // synchronized
+	defer dw.Unlock()
+	// TODO why is this synchronized?
+	deleteQueue := dw.deleteQueue
+	deleteQueue.addDeleteQueries(queries...)
+	dw.flushControl.doOnDelete()
+	return dw.applyAllDeletes(deleteQueue)
+}
+
+/*
+NOTE: we now apply deletes against the ticket queue instead of using
+the IndexWriter lock, so deletes from different goroutines can be
+buffered concurrently.
+*/
+func (dw *DocumentsWriter) deleteTerms(terms ...*Term) (bool, error) {
+	dw.Lock() // synchronized
+	defer dw.Unlock()
+	// TODO why is this synchronized?
+	deleteQueue := dw.deleteQueue
+	deleteQueue.addDeleteTerms(terms...)
+	dw.flushControl.doOnDelete()
+	return dw.applyAllDeletes(deleteQueue)
+}
+
 func (dw *DocumentsWriter) applyAllDeletes(deleteQueue *DocumentsWriterDeleteQueue) (bool, error) {
-	panic("not implemented yet")
+	if dw.flushControl.getAndResetApplyAllDeletes() {
+		if deleteQueue != nil && !dw.flushControl.isFullFlush() {
+			if err := dw.ticketQueue.addDeletes(deleteQueue); err != nil {
+				return false, err
+			}
+		}
+		dw.putEvent(applyDeletesEvent) // apply deletes event forces a purge
+		return true, nil
+	}
+	return false, nil
+}
+
+func (dw *DocumentsWriter) purgeBuffer(writer *IndexWriter, forced bool) (int, error) {
+	if forced {
+		return dw.ticketQueue.forcePurge(writer)
+	}
+	return dw.ticketQueue.tryPurge(writer)
 }
 
 func (dw *DocumentsWriter) ensureOpen() {
@@ -199,7 +240,7 @@ func (dw *DocumentsWriter) preUpdate() (bool, error) {
 		}
 		for {
 			// Try pick up pending threads here if possible
-			for flushingDWPT := dw.flushControl.nextPendingFlush(); flushingDWPT != nil; {
+			for flushingDWPT := dw.flushControl.nextPendingFlush(); flushingDWPT != nil; flushingDWPT = dw.flushControl.nextPendingFlush() {
 				// Don't push the delete here since the update could fail!
 				ok, err := dw.doFlush(flushingDWPT)
 				if err != nil {
@@ -225,8 +266,23 @@ func (dw *DocumentsWriter) preUpdate() (bool, error) {
 	return hasEvents, nil
 }
 
-func (dw *DocumentsWriter) postUpdate(flusingDWPT *DocumentsWriterPerThread, hasEvents bool) (bool, error) {
-	panic("not implemented yet")
+func (dw *DocumentsWriter) postUpdate(flushingDWPT *DocumentsWriterPerThread, hasEvents bool) (bool, error) {
+	ok, err := dw.applyAllDeletes(dw.deleteQueue)
+	if err != nil {
+		return false, err
+	}
+	hasEvents = hasEvents || ok
+	if flushingDWPT == nil {
+		flushingDWPT = dw.flushControl.nextPendingFlush()
+	}
+	if flushingDWPT != nil {
+		ok, err = dw.doFlush(flushingDWPT)
+		if err != nil {
+			return false, err
+		}
+		hasEvents = hasEvents || ok
+	}
+	return hasEvents, nil
 }
 
 func (dw *DocumentsWriter) ensureInitialized(state *ThreadState) {
@@ -237,6 +293,59 @@ func (dw *DocumentsWriter) ensureInitialized(state *ThreadState) {
 	}
 }
 
+func (dw *DocumentsWriter) updateDocuments(docs [][]IndexableField,
+	analyzer analysis.Analyzer, delTerm *Term) (bool, error) {
+
+	hasEvents, err := dw.preUpdate()
+	if err != nil {
+		return false, err
+	}
+
+	flushingDWPT, err := func() (*DocumentsWriterPerThread, error) {
+		perThread := dw.flushControl.obtainAndLock()
+		defer dw.flushControl.perThreadPool.release(perThread)
+
+		if !perThread.isActive {
+			dw.ensureOpen()
+			panic("perThread is not active but we are still open")
+		}
+		dw.ensureInitialized(perThread)
+		assert(perThread.dwpt != nil)
+		dwpt := perThread.dwpt
+		dwptNumDocs := dwpt.numDocsInRAM
+
+		err := func() error {
+			defer func() {
+				if dwpt.checkAndResetHasAborted() {
+					if len(dwpt.filesToDelete) > 0 {
+						dw.putEvent(newDeleteNewFilesEvent(dwpt.filesToDelete))
+					}
+					dw.subtractFlushedNumDocs(dwptNumDocs)
+					dw.flushControl.doOnAbort(perThread)
+				}
+			}()
+
+			docCount, err := dwpt.updateDocuments(docs, analyzer, delTerm)
+			if err != nil {
+				return err
+			}
+			atomic.AddInt32(&dw.numDocsInRAM, int32(docCount))
+			return nil
+		}()
+		if err != nil {
+			return nil, err
+		}
+
+		isUpdate := delTerm != nil
+		return dw.flushControl.doAfterDocument(perThread, isUpdate), nil
+	}()
+	if err != nil {
+		return false, err
+	}
+
+	return dw.postUpdate(flushingDWPT, hasEvents)
+}
+
 // L428
 func (dw *DocumentsWriter) updateDocument(doc []IndexableField,
 	analyzer analysis.Analyzer, delTerm *Term) (bool, error) {
@@ -514,14 +623,20 @@ func (dw *DocumentsWriter) putEvent(event Event) {
 	dw.events.PushBack(event)
 }
 
-func (dw *DocumentsWriter) processEvents(writer *IndexWriter, triggerMerge, forcePurge bool) bool {
-	dw.eventsLock.RLock()
-	defer dw.eventsLock.RUnlock()
+func (dw *DocumentsWriter) pollEvent() Event {
+	dw.eventsLock.Lock()
+	defer dw.eventsLock.Unlock()
+	if e := dw.events.Front(); e != nil {
+		return dw.events.Remove(e).(Event)
+	}
+	return nil
+}
 
+func (dw *DocumentsWriter) processEvents(writer *IndexWriter, triggerMerge, forcePurge bool) bool {
 	processed := false
-	for e := dw.events.Front(); e != nil; e = e.Next() {
+	for event := dw.pollEvent(); event != nil; event = dw.pollEvent() {
 		processed = true
-		e.Value.(Event)(writer, triggerMerge, forcePurge)
+		event(writer, triggerMerge, forcePurge)
 	}
 	return processed
 }
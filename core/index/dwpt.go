@@ -244,15 +244,97 @@ func (dwpt *DocumentsWriterPerThread) updateDocument(doc []IndexableField,
 	return nil
 }
 
-func (dwpt *DocumentsWriterPerThread) updateDocuments(doc []IndexableField,
-	analyzer analysis.Analyzer, delTerm *Term) error {
+func (dwpt *DocumentsWriterPerThread) updateDocuments(docs [][]IndexableField,
+	analyzer analysis.Analyzer, delTerm *Term) (docCount int, err error) {
 
-	dwpt.testPoint("DocumentsWriterPerThread addDocument start")
-	panic("not implemented yet")
+	dwpt.testPoint("DocumentsWriterPerThread addDocuments start")
+	assert(dwpt.deleteQueue != nil)
+	dwpt.docState.analyzer = analyzer
+	if DWPT_VERBOSE && dwpt.infoStream.IsEnabled("DWPT") {
+		dwpt.infoStream.Message("DWPT", "update delTerm=%v docID=%v seg=%v ",
+			delTerm, dwpt.docState.docID, dwpt.segmentInfo.Name)
+	}
+	var allDocsIndexed = false
+	defer func() {
+		if !allDocsIndexed && !dwpt.aborting {
+			// the iterator threw an error that is not aborting go and
+			// mark all docs from this block as deleted
+			docID := dwpt.numDocsInRAM - 1
+			for endDocID := docID - docCount; docID > endDocID; docID-- {
+				dwpt.deleteDocID(docID)
+			}
+		}
+		dwpt.docState.clear()
+	}()
+
+	for _, doc := range docs {
+		dwpt.docState.doc = doc
+		dwpt.docState.docID = dwpt.numDocsInRAM
+		docCount++
+
+		if err = func() error {
+			var success = false
+			defer func() {
+				if !success {
+					// An error is being returned...
+					if !dwpt.aborting {
+						// Incr here because finishDocument will not be
+						// called (because an error is being returned):
+						dwpt.numDocsInRAM++
+					} else {
+						dwpt.abort(dwpt.filesToDelete)
+					}
+				}
+			}()
+			err := dwpt.consumer.processDocument(dwpt.fieldInfos)
+			success = err == nil
+			return err
+		}(); err != nil {
+			return
+		}
+		if err = func() error {
+			var success = false
+			defer func() {
+				if !success {
+					dwpt.abort(dwpt.filesToDelete)
+				}
+			}()
+			err := dwpt.consumer.finishDocument()
+			success = err == nil
+			return err
+		}(); err != nil {
+			return
+		}
+
+		dwpt.finishDocument(nil)
+	}
+	allDocsIndexed = true
+
+	// Apply delTerm only after all indexing has succeeded, but apply
+	// it only to docs prior to when this batch started:
+	if delTerm != nil {
+		dwpt.deleteQueue.addTermToSlice(delTerm, dwpt.deleteSlice)
+		assert2(dwpt.deleteSlice.isTailItem(delTerm), "expected the delete term as the tail item")
+		dwpt.deleteSlice.apply(dwpt.pendingDeletes, dwpt.numDocsInRAM-docCount)
+	}
+	return docCount, nil
 }
 
 func (dwpt *DocumentsWriterPerThread) finishDocument(delTerm *Term) {
-	panic("not implemented yet")
+	// here we actually finish the document in two steps:
+	// 1. push the delete into the queue and update our slice.
+	// 2. increment the DWPT private document id.
+	//
+	// the updated slice we get from 1. holds all the deletes that have
+	// occurred since we updated the slice the last time.
+	if delTerm != nil {
+		dwpt.deleteQueue.addTermToSlice(delTerm, dwpt.deleteSlice)
+		assert2(dwpt.deleteSlice.isTailItem(delTerm), "expected the delete term as the tail item")
+		dwpt.deleteSlice.apply(dwpt.pendingDeletes, dwpt.numDocsInRAM)
+	} else if dwpt.deleteQueue.updateSlice(dwpt.deleteSlice) {
+		dwpt.deleteSlice.apply(dwpt.pendingDeletes, dwpt.numDocsInRAM)
+	}
+	dwpt.numDocsInRAM++
 }
 
 /*
@@ -334,15 +416,12 @@ func (dwpt *DocumentsWriterPerThread) flush() (fs *FlushedSegment, err error) {
 		}
 	}()
 
-	err = dwpt.consumer.flush(flushState)
+	err = dwpt.consumer.flush(&flushState)
 	if err != nil {
 		return nil, err
 	}
 	dwpt.pendingDeletes.terms = make(map[*Term]int)
-	files := make(map[string]bool)
-	dwpt.directory.EachCreatedFiles(func(name string) {
-		files[name] = true
-	})
+	files := dwpt.directory.CreatedFiles()
 	dwpt.segmentInfo.SetFiles(files)
 
 	info := NewSegmentInfoPerCommit(dwpt.segmentInfo, 0, -1)
@@ -400,8 +479,80 @@ func check(ok bool, v1, v2 interface{}) interface{} {
 Seals the SegmentInfo for the new flushed segment and persists the
 deleted documents MutableBits
 */
-func (dwpt *DocumentsWriterPerThread) sealFlushedSegment(flushedSegment *FlushedSegment) error {
-	panic("not implemented yet")
+func (dwpt *DocumentsWriterPerThread) sealFlushedSegment(flushedSegment *FlushedSegment) (err error) {
+	assert(flushedSegment != nil)
+
+	newSegment := flushedSegment.segmentInfo
+
+	setDiagnostics(newSegment.info, SOURCE_FLUSH)
+
+	segSize, err := newSegment.SizeInBytes()
+	if err != nil {
+		return err
+	}
+	context := store.NewIOContextForFlush(&store.FlushInfo{newSegment.info.DocCount(), segSize})
+
+	defer func() {
+		if err != nil {
+			if dwpt.infoStream.IsEnabled("DWPT") {
+				dwpt.infoStream.Message("DWPT",
+					"hit error relating compound file for newly flushed segment %v",
+					newSegment.info.Name)
+			}
+		}
+	}()
+
+	if dwpt.indexWriterConfig.useCompoundFile {
+		files, err := createCompoundFile(dwpt.infoStream, dwpt.directory,
+			CHECK_ABORT_NONE, newSegment.info, context)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			dwpt.filesToDelete[file] = true
+		}
+		newSegment.info.SetUseCompoundFile(true)
+	}
+
+	// Have codec write SegmentInfo. Must do this after creating CFS so
+	// that 1) .si isn't slurped into CFS, and 2) .si reflects
+	// useCompoundFile=true change above:
+	if err = dwpt.codec.SegmentInfoFormat().SegmentInfoWriter()(dwpt.directory,
+		newSegment.info, flushedSegment.fieldInfos, context); err != nil {
+		return err
+	}
+
+	// TODO: ideally we would freeze newSegment here!! because any
+	// changes after writing the .si will be lost...
+
+	// Must write deleted docs after the CFS so we don't slurp the del
+	// file into CFS:
+	if flushedSegment.liveDocs != nil {
+		delCount := flushedSegment.delCount
+		assert(delCount > 0)
+		if dwpt.infoStream.IsEnabled("DWPT") {
+			dwpt.infoStream.Message("DWPT", "flush: write %v deletes gen=%v",
+				delCount, flushedSegment.segmentInfo.delGen)
+		}
+
+		// TODO: we should prune the segment if it's 100% deleted... but
+		// merge will also catch it.
+
+		// TODO: in the NRT case it'd be better to hand this del vector
+		// over to the shortly-to-be-opened SegmentReader and let it
+		// carry the changes; there's no reason to use filesystem as
+		// intermediary here.
+
+		info := flushedSegment.segmentInfo
+		codec := info.info.Codec().(Codec)
+		if err = codec.LiveDocsFormat().WriteLiveDocs(flushedSegment.liveDocs,
+			dwpt.directory, info, delCount, context); err != nil {
+			return err
+		}
+		newSegment.delCount = delCount
+		newSegment.advanceDelGen()
+	}
+	return nil
 }
 
 func (dwpt *DocumentsWriterPerThread) bytesUsed() int64 {
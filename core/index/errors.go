@@ -0,0 +1,21 @@
+package index
+
+import (
+	"github.com/balzaczyy/golucene/core/codec"
+)
+
+/*
+The typed errors are defined in package codec, which reads the file
+headers and footers but can't depend on this package. They are
+re-exported here so callers can write, e.g.
+
+	var corrupt *index.CorruptIndexError
+	if errors.As(err, &corrupt) {
+		...
+	}
+*/
+type (
+	CorruptIndexError      = codec.CorruptIndexError
+	IndexFormatTooOldError = codec.IndexFormatTooOldError
+	IndexFormatTooNewError = codec.IndexFormatTooNewError
+)
@@ -14,15 +14,16 @@ must be encoded inside the process() method.
 type Event func(writer *IndexWriter, triggerMerge, clearBuffers bool) error
 
 var applyDeletesEvent = Event(func(writer *IndexWriter, triggerMerge, forcePurge bool) error {
-	panic("not implemented yet")
+	return writer.applyDeletesAndPurge(true) // we always purge!
 })
 
 var mergePendingEvent = Event(func(writer *IndexWriter, triggerMerge, forcePurge bool) error {
-	panic("not implemented yet")
+	return writer.doAfterSegmentFlushed(triggerMerge, forcePurge)
 })
 
 var forcedPurgeEvent = Event(func(writer *IndexWriter, triggerMerge, forcePurge bool) error {
-	panic("not implemented yet")
+	_, err := writer.purge(true)
+	return err
 })
 
 func newFlushFailedEvent(info *model.SegmentInfo) Event {
@@ -31,8 +31,7 @@ func (mf MultiFields) Terms(field string) Terms {
 
 	// Gather all sub-readers that share this field
 	for i, v := range mf.subs {
-		terms := v.Terms(field)
-		if terms.Iterator != nil {
+		if terms := v.Terms(field); terms != nil {
 			subs2 = append(subs2, terms)
 			slices2 = append(slices2, mf.subSlices[i])
 		}
@@ -67,7 +66,7 @@ func GetMultiFields(r IndexReader) Fields {
 				continue
 			}
 			fields = append(fields, f)
-			slices = append(slices, ReaderSlice{ctx.DocBase, r.MaxDoc(), len(fields)})
+			slices = append(slices, ReaderSlice{ctx.DocBase, ctx.Reader().MaxDoc(), len(fields) - 1})
 		}
 		log.Printf("Found %v fields in %v slices.", len(fields), len(slices))
 		switch len(fields) {
@@ -31,7 +31,21 @@ type FlushPolicy interface {
 	// Note: this method is called synchronized on the given
 	// DocumentsWriterFlushControl and it is guaranteed that the
 	// calling goroutine holds the lock on the given ThreadState
-	// OnDelete(control *DocumentsWriterFlushControl, state *ThreadState)
+	onDelete(control *DocumentsWriterFlushControl, state *ThreadState)
+	// Called for each document update on the given ThreadState's
+	// DocumentsWriterPerThread.
+	//
+	// Note: this method is called synchronized on the given
+	// DocumentsWriterFlushControl and it is guaranteed that the
+	// calling goroutine holds the lock on the given ThreadState
+	onUpdate(control *DocumentsWriterFlushControl, state *ThreadState)
+	// Called for each document addition on the given ThreadState's
+	// DocumentsWriterPerThread.
+	//
+	// Note: this method is synchronized by the given
+	// DocumentsWriterFlushControl and it is guaranteed that the
+	// calling goroutine holds the lock on the given ThreadState
+	onInsert(control *DocumentsWriterFlushControl, state *ThreadState)
 	// Called by DocumentsWriter to initialize the FlushPolicy
 	init(indexWriterConfig *LiveIndexWriterConfig)
 }
@@ -55,6 +69,35 @@ func (fp *FlushPolicyImpl) init(indexWriterConfig *LiveIndexWriterConfig) {
 	fp.infoStream = indexWriterConfig.infoStream
 }
 
+/*
+Returns the current most RAM consuming non-pending ThreadState with
+at least one indexed document.
+
+This method will never return nil
+*/
+func (fp *FlushPolicyImpl) findLargestNonPendingWriter(control *DocumentsWriterFlushControl,
+	perThreadState *ThreadState) *ThreadState {
+
+	assert(perThreadState.dwpt.numDocsInRAM > 0)
+	maxRamSoFar := perThreadState.bytesUsed
+	// the dwpt which needs to be flushed eventually
+	maxRamUsingThreadState := perThreadState
+	assert2(!perThreadState.flushPending, "DWPT should have flushed")
+	for _, next := range control.perThreadPool.activeThreadStates() {
+		if !next.flushPending {
+			if nextRam := next.bytesUsed; nextRam > maxRamSoFar &&
+				next.dwpt != nil && next.dwpt.numDocsInRAM > 0 {
+				maxRamSoFar = nextRam
+				maxRamUsingThreadState = next
+			}
+		}
+	}
+	if fp.infoStream.IsEnabled("FP") {
+		fp.infoStream.Message("FP", "set largest ram consuming thread pending on lower watermark")
+	}
+	return maxRamUsingThreadState
+}
+
 // index/FlushByRamOrCountsPolicy.java
 
 /*
@@ -88,3 +131,75 @@ func newFlushByRamOrCountsPolicy() *FlushByRamOrCountsPolicy {
 		FlushPolicyImpl: newFlushPolicyImpl(),
 	}
 }
+
+func (p *FlushByRamOrCountsPolicy) onDelete(control *DocumentsWriterFlushControl, state *ThreadState) {
+	if p.flushOnDeleteTerms() {
+		// Flush this state by num del terms
+		if control.numGlobalTermDeletes() >= p.indexWriterConfig.maxBufferedDeleteTerms {
+			control.setApplyAllDeletes()
+		}
+	}
+	if ramBufferSizeMB := p.indexWriterConfig.ramBufferSizeMB; p.flushOnRAM() &&
+		control.deleteBytesUsed() > int64(1024*1024*ramBufferSizeMB) {
+		control.setApplyAllDeletes()
+		if p.infoStream.IsEnabled("FP") {
+			p.infoStream.Message("FP", "force apply deletes bytesUsed=%v vs ramBuffer=%v",
+				control.deleteBytesUsed(), 1024*1024*ramBufferSizeMB)
+		}
+	}
+}
+
+func (p *FlushByRamOrCountsPolicy) onUpdate(control *DocumentsWriterFlushControl, state *ThreadState) {
+	p.onInsert(control, state)
+	p.onDelete(control, state)
+}
+
+func (p *FlushByRamOrCountsPolicy) onInsert(control *DocumentsWriterFlushControl, state *ThreadState) {
+	if p.flushOnDocCount() && state.dwpt.numDocsInRAM >= p.indexWriterConfig.maxBufferedDocs {
+		// Flush this state by num docs
+		control._setFlushPending(state)
+	} else if p.flushOnRAM() { // flush by RAM
+		limit := int64(p.indexWriterConfig.ramBufferSizeMB * 1024 * 1024)
+		totalRam := control._activeBytes + control.deleteBytesUsed()
+		if totalRam >= limit {
+			if p.infoStream.IsEnabled("FP") {
+				p.infoStream.Message("FP", "flush: activeBytes=%v deleteBytes=%v vs limit=%v",
+					control._activeBytes, control.deleteBytesUsed(), limit)
+			}
+			p.markLargestWriterPending(control, state, totalRam)
+		}
+	}
+}
+
+/*
+Marks the most ram consuming active DocumentsWriterPerThread flush
+pending
+*/
+func (p *FlushByRamOrCountsPolicy) markLargestWriterPending(control *DocumentsWriterFlushControl,
+	perThreadState *ThreadState, currentBytesPerThread int64) {
+	control._setFlushPending(p.findLargestNonPendingWriter(control, perThreadState))
+}
+
+/*
+Returns true if this FlushPolicy flushes on
+IndexWriterConfig.MaxBufferedDocs(), otherwise false.
+*/
+func (p *FlushByRamOrCountsPolicy) flushOnDocCount() bool {
+	return p.indexWriterConfig.maxBufferedDocs != DISABLE_AUTO_FLUSH
+}
+
+/*
+Returns true if this FlushPolicy flushes on
+IndexWriterConfig.MaxBufferedDeleteTerms(), otherwise false.
+*/
+func (p *FlushByRamOrCountsPolicy) flushOnDeleteTerms() bool {
+	return p.indexWriterConfig.maxBufferedDeleteTerms != DISABLE_AUTO_FLUSH
+}
+
+/*
+Returns true if this FlushPolicy flushes on
+IndexWriterConfig.RAMBufferSizeMB(), otherwise false.
+*/
+func (p *FlushByRamOrCountsPolicy) flushOnRAM() bool {
+	return p.indexWriterConfig.ramBufferSizeMB != DISABLE_AUTO_FLUSH
+}
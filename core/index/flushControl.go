@@ -6,6 +6,7 @@ import (
 	"github.com/balzaczyy/golucene/core/util"
 	"math"
 	"sync"
+	"sync/atomic"
 )
 
 // index/DocumentsWriterFlushControl.java
@@ -29,6 +30,7 @@ type DocumentsWriterFlushControl struct {
 	numPending          int // volatile
 	numDocsSinceStalled int
 	fullFlush           bool
+	flushDeletes        int32 // atomic
 	flushQueue          *list.List
 	// only for safety reasons if a DWPT is close to the RAM limit
 	blockedFlushes  *list.List
@@ -143,8 +145,81 @@ func (fc *DocumentsWriterFlushControl) assertMemory() {
 	}
 }
 
+func (fc *DocumentsWriterFlushControl) commitPerThreadBytes(perThread *ThreadState) {
+	delta := perThread.dwpt.bytesUsed() - perThread.bytesUsed
+	perThread.bytesUsed += delta
+	// We need to differentiate here if we are pending since
+	// setFlushPending moves the perThread memory to the flushBytes and
+	// we could be set to pending during a delete
+	if perThread.flushPending {
+		fc._flushBytes += delta
+	} else {
+		fc._activeBytes += delta
+	}
+	if delta > fc.peakDelta {
+		fc.peakDelta = delta
+	}
+}
+
 func (fc *DocumentsWriterFlushControl) doAfterDocument(perThread *ThreadState, isUpdate bool) *DocumentsWriterPerThread {
-	panic("not implemented yet")
+	flushingDWPT, blocked := func() (*DocumentsWriterPerThread, bool) {
+		fc.Lock()
+		defer fc.Unlock()
+
+		defer func() {
+			if fc.updateStallState() {
+				fc.numDocsSinceStalled++
+			} else {
+				fc.numDocsSinceStalled = 0
+			}
+			fc.assertMemory()
+		}()
+
+		fc.commitPerThreadBytes(perThread)
+		if !perThread.flushPending {
+			if isUpdate {
+				fc.flushPolicy.onUpdate(fc, perThread)
+			} else {
+				fc.flushPolicy.onInsert(fc, perThread)
+			}
+			if !perThread.flushPending && perThread.bytesUsed > fc.hardMaxBytesPerDWPT {
+				// Safety check to prevent a single DWPT exceeding its RAM
+				// limit. This is super important since we can not address
+				// more than 2048 MB per DWPT
+				fc._setFlushPending(perThread)
+			}
+		}
+
+		if fc.fullFlush {
+			if perThread.flushPending {
+				fc.checkoutAndBlock(perThread)
+				return nil, true
+			}
+			return nil, false
+		}
+		if perThread.flushPending {
+			return fc._tryCheckOutForFlush(perThread), false
+		}
+		return nil, false
+	}()
+	if blocked {
+		// nextPendingFlush() takes fc's lock itself
+		return fc.nextPendingFlush()
+	}
+	return flushingDWPT
+}
+
+/*
+The caller must hold both fc's lock and the lock on the given
+ThreadState.
+*/
+func (fc *DocumentsWriterFlushControl) checkoutAndBlock(perThread *ThreadState) {
+	assert2(perThread.flushPending, "can not block non-pending threadstate")
+	assert2(fc.fullFlush, "can not block if fullFlush == false")
+	bytes := perThread.bytesUsed
+	dwpt := fc.perThreadPool.reset(perThread, fc.closed)
+	fc.numPending--
+	fc.blockedFlushes.PushBack(&BlockedFlush{dwpt, bytes})
 }
 
 func (fc *DocumentsWriterFlushControl) doAfterFlush(dwpt *DocumentsWriterPerThread) {
@@ -265,10 +340,37 @@ func (fc *DocumentsWriterFlushControl) close() {
 	}
 }
 
+func (fc *DocumentsWriterFlushControl) doOnDelete() {
+	fc.Lock() // synchronized
+	defer fc.Unlock()
+	// pass nil this is a global delete no update
+	fc.flushPolicy.onDelete(fc, nil)
+}
+
 /* Various statistics */
 
+func (fc *DocumentsWriterFlushControl) numGlobalTermDeletes() int {
+	return fc.documentsWriter.deleteQueue.numGlobalTermDeletes() +
+		int(atomic.LoadInt32(&fc.bufferedDeletesStream.numTerms))
+}
+
 func (fc *DocumentsWriterFlushControl) deleteBytesUsed() int64 {
-	panic("not implemented yet")
+	return fc.documentsWriter.deleteQueue.bytesUsed() +
+		atomic.LoadInt64(&fc.bufferedDeletesStream.bytesUsed)
+}
+
+func (fc *DocumentsWriterFlushControl) getAndResetApplyAllDeletes() bool {
+	return atomic.SwapInt32(&fc.flushDeletes, 0) != 0
+}
+
+func (fc *DocumentsWriterFlushControl) setApplyAllDeletes() {
+	atomic.StoreInt32(&fc.flushDeletes, 1)
+}
+
+func (fc *DocumentsWriterFlushControl) isFullFlush() bool {
+	fc.Lock() // synchronized
+	defer fc.Unlock()
+	return fc.fullFlush
 }
 
 // L444
@@ -367,9 +469,9 @@ func (fc *DocumentsWriterFlushControl) nextPendingFlush() *DocumentsWriterPerThr
 		defer fc.Unlock()
 
 		if e := fc.flushQueue.Front(); e != nil {
-			pool := e.Value.(*DocumentsWriterPerThread)
+			fc.flushQueue.Remove(e)
 			fc.updateStallState()
-			return 0, false, pool
+			return 0, false, e.Value.(*DocumentsWriterPerThread)
 		}
 		return fc.numPending, fc.fullFlush, nil
 	}()
@@ -379,14 +481,16 @@ func (fc *DocumentsWriterFlushControl) nextPendingFlush() *DocumentsWriterPerThr
 
 	if numPending > 0 && !fullFlush {
 		// don't check if we are doing a full flush
-		dwpt = fc.perThreadPool.find(func(next *ThreadState) interface{} {
+		if res := fc.perThreadPool.find(func(next *ThreadState) interface{} {
 			if numPending > 0 && next.flushPending {
 				if dwpt := fc.tryCheckoutForFlush(next); dwpt != nil {
 					return dwpt
 				}
 			}
 			return nil
-		}).(*DocumentsWriterPerThread)
+		}); res != nil {
+			dwpt = res.(*DocumentsWriterPerThread)
+		}
 	}
 	return dwpt
 }
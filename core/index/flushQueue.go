@@ -28,7 +28,21 @@ func newDocumentsWriterFlushQueue() *DocumentsWriterFlushQueue {
 }
 
 func (fq *DocumentsWriterFlushQueue) addDeletes(deleteQueue *DocumentsWriterDeleteQueue) error {
-	panic("not implemented yet")
+	fq.Lock()
+	defer fq.Unlock()
+	// first inc the ticket count - freeze opens a window for
+	// anyChanges() to fail
+	fq.incTickets()
+	var success = false
+	defer func() {
+		if !success {
+			fq.decTickets()
+		}
+	}()
+
+	fq.queue.PushBack(newGlobalDeletesTicket(deleteQueue.freezeGlobalBuffer(nil)))
+	success = true
+	return nil
 }
 
 func (fq *DocumentsWriterFlushQueue) incTickets() {
@@ -60,7 +74,11 @@ func (fq *DocumentsWriterFlushQueue) addFlushTicket(dwpt *DocumentsWriterPerThre
 }
 
 func (fq *DocumentsWriterFlushQueue) addSegment(ticket *SegmentFlushTicket, segment *FlushedSegment) {
-	panic("not implemented yet")
+	fq.Lock()
+	defer fq.Unlock()
+	// the actual flush is done asynchronously and once done the
+	// FlushedSegment is passed to the flush ticket
+	ticket.segment = segment
 }
 
 func (fq *DocumentsWriterFlushQueue) markTicketFailed(ticket *SegmentFlushTicket) {
@@ -126,6 +144,14 @@ func (fq *DocumentsWriterFlushQueue) forcePurge(writer *IndexWriter) (int, error
 	return fq._purge(writer)
 }
 
+func (fq *DocumentsWriterFlushQueue) tryPurge(writer *IndexWriter) (int, error) {
+	if fq.purgeLock.(*sync.Mutex).TryLock() {
+		defer fq.purgeLock.Unlock()
+		return fq._purge(writer)
+	}
+	return 0, nil
+}
+
 func (fq *DocumentsWriterFlushQueue) ticketCount() int {
 	return int(atomic.LoadInt32(&fq._ticketCount))
 }
@@ -145,6 +171,56 @@ func newFlushTicket(frozenDeletes *FrozenBufferedDeletes) *FlushTicketImpl {
 	return &FlushTicketImpl{frozenDeletes: frozenDeletes}
 }
 
+func (t *FlushTicketImpl) finishFlush(writer *IndexWriter,
+	newSegment *FlushedSegment, bufferedDeletes *FrozenBufferedDeletes) error {
+	// Finish the flushed segment and publish it to IndexWriter
+	if newSegment == nil {
+		assert(bufferedDeletes != nil)
+		if bufferedDeletes != nil && bufferedDeletes.any() {
+			writer.publishFrozenDeletes(bufferedDeletes)
+			if writer.infoStream.IsEnabled("DW") {
+				writer.infoStream.Message("DW", "flush: push buffered deletes: %v", bufferedDeletes)
+			}
+		}
+		return nil
+	}
+	return t.publishFlushedSegment(writer, newSegment, bufferedDeletes)
+}
+
+func (t *FlushTicketImpl) publishFlushedSegment(writer *IndexWriter,
+	newSegment *FlushedSegment, globalPacket *FrozenBufferedDeletes) error {
+	assert(newSegment != nil)
+	assert(newSegment.segmentInfo != nil)
+	segmentDeletes := newSegment.segmentDeletes
+	if writer.infoStream.IsEnabled("DW") {
+		writer.infoStream.Message("DW", "publishFlushedSegment seg-private deletes=%v", segmentDeletes)
+		if segmentDeletes != nil {
+			writer.infoStream.Message("DW", "flush: push buffered seg private deletes: %v", segmentDeletes)
+		}
+	}
+	// now publish!
+	return writer.publishFlushedSegment(newSegment.segmentInfo, segmentDeletes, globalPacket)
+}
+
+type GlobalDeletesTicket struct {
+	*FlushTicketImpl
+}
+
+func newGlobalDeletesTicket(frozenDeletes *FrozenBufferedDeletes) *GlobalDeletesTicket {
+	return &GlobalDeletesTicket{newFlushTicket(frozenDeletes)}
+}
+
+func (ticket *GlobalDeletesTicket) publish(writer *IndexWriter) error {
+	assert2(!ticket.published, "ticket was already published - can not publish twice")
+	ticket.published = true
+	// it's a global ticket - no segment to publish
+	return ticket.finishFlush(writer, nil, ticket.frozenDeletes)
+}
+
+func (ticket *GlobalDeletesTicket) canPublish() bool {
+	return true
+}
+
 type SegmentFlushTicket struct {
 	*FlushTicketImpl
 	segment *FlushedSegment
@@ -161,3 +237,13 @@ func (ticket *SegmentFlushTicket) fail() {
 	assert(ticket.segment == nil)
 	ticket.failed = true
 }
+
+func (ticket *SegmentFlushTicket) publish(writer *IndexWriter) error {
+	assert2(!ticket.published, "ticket was already published - can not publish twice")
+	ticket.published = true
+	return ticket.finishFlush(writer, ticket.segment, ticket.frozenDeletes)
+}
+
+func (ticket *SegmentFlushTicket) canPublish() bool {
+	return ticket.segment != nil || ticket.failed
+}
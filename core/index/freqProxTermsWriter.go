@@ -0,0 +1,542 @@
+package index
+
+import (
+	"fmt"
+	"github.com/balzaczyy/golucene/core/index/model"
+	"github.com/balzaczyy/golucene/core/store"
+	"github.com/balzaczyy/golucene/core/util"
+	"sort"
+)
+
+// index/FreqProxTermsWriter.java
+
+type FreqProxTermsWriter struct {
+}
+
+func (w *FreqProxTermsWriter) abort() {}
+
+func (w *FreqProxTermsWriter) startDocument() {}
+
+func (w *FreqProxTermsWriter) finishDocument() error { return nil }
+
+func (w *FreqProxTermsWriter) addField(termsHashPerField *TermsHashPerField,
+	fieldInfo model.FieldInfo) TermsHashConsumerPerField {
+	return newFreqProxTermsWriterPerField(termsHashPerField, w, fieldInfo)
+}
+
+/*
+Flushes the buffered postings of all given fields, sorted by field
+name, to the postings format of the segment's codec. Documents hit by
+buffered delete-by-term are marked deleted in state.liveDocs.
+*/
+func (w *FreqProxTermsWriter) flush(fieldsToFlush map[string]TermsHashConsumerPerField,
+	state *SegmentWriteState) (err error) {
+
+	// Gather all FieldData's that have postings, across all ThreadStates
+	var allFields []*FreqProxTermsWriterPerField
+	for name, field := range fieldsToFlush {
+		if f := field.(*FreqProxTermsWriterPerField); f.numTerms() > 0 {
+			// the FieldInfo may have changed since the field was first
+			// seen, e.g. downgraded index options
+			f.fieldInfo = state.fieldInfos.FieldInfoByName(name)
+			allFields = append(allFields, f)
+		}
+	}
+
+	// Sort by field name
+	sort.Sort(freqProxFieldsByName(allFields))
+
+	consumer, err := state.segmentInfo.Codec().(Codec).PostingsFormat().FieldsConsumer(*state)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err == nil {
+			err = consumer.Close()
+		} else {
+			util.CloseWhileSuppressingError(consumer)
+		}
+	}()
+
+	for _, fieldWriter := range allFields {
+		// If this field has postings then add them to the segment
+		if err = fieldWriter.flush(fieldWriter.fieldInfo.Name, consumer, state); err != nil {
+			return err
+		}
+		fieldWriter.reset()
+	}
+	return nil
+}
+
+type freqProxFieldsByName []*FreqProxTermsWriterPerField
+
+func (a freqProxFieldsByName) Len() int           { return len(a) }
+func (a freqProxFieldsByName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a freqProxFieldsByName) Less(i, j int) bool { return a[i].fieldInfo.Name < a[j].fieldInfo.Name }
+
+// index/FreqProxTermsWriterPerField.java
+
+/*
+Buffers the postings of a single field in RAM. For each term, the doc
+deltas and freqs are written as vInts to a freq stream, and the
+position deltas, payloads and offsets to a prox stream, in the same
+encoding Lucene uses for its in-RAM byte slices. The last document of
+each term is kept aside until the term is seen in another document
+(or flushed), since its freq is not known before.
+*/
+type FreqProxTermsWriterPerField struct {
+	parent            *FreqProxTermsWriter
+	termsHashPerField *TermsHashPerField
+	fieldInfo         model.FieldInfo
+	docState          *docState
+	fieldState        *FieldInvertState
+
+	hasFreq     bool
+	hasProx     bool
+	hasOffsets  bool
+	hasPayloads bool
+
+	termIDs  map[string]int
+	postings []*freqProxPostings
+}
+
+/* Per-term in-RAM postings. */
+type freqProxPostings struct {
+	text []byte
+	freq []byte // doc deltas & freqs
+	prox []byte // positions, payloads & offsets
+
+	lastDocID    int // Last docID where this term occurred
+	lastDocCode  int // Code for prior doc
+	termFreq     int // # times this term occurs in the current doc
+	lastPosition int // Last position where this term occurred
+	lastOffset   int // Last endOffset where this term occurred
+}
+
+func newFreqProxTermsWriterPerField(termsHashPerField *TermsHashPerField,
+	parent *FreqProxTermsWriter, fieldInfo model.FieldInfo) *FreqProxTermsWriterPerField {
+
+	ans := &FreqProxTermsWriterPerField{
+		parent:            parent,
+		termsHashPerField: termsHashPerField,
+		fieldInfo:         fieldInfo,
+		docState:          termsHashPerField.docState,
+		fieldState:        termsHashPerField.fieldState,
+	}
+	ans.reset()
+	return ans
+}
+
+func (f *FreqProxTermsWriterPerField) reset() {
+	// Record, up front, whether our in-RAM format will be with or
+	// without term freqs:
+	f.setIndexOptions(f.fieldInfo.IndexOptions())
+	f.hasPayloads = f.fieldInfo.HasPayloads()
+	f.termIDs = make(map[string]int)
+	f.postings = nil
+}
+
+func (f *FreqProxTermsWriterPerField) setIndexOptions(indexOptions model.IndexOptions) {
+	if indexOptions == 0 {
+		// field could later be updated with indexed=true, so set everything on
+		f.hasFreq, f.hasProx, f.hasOffsets = true, true, true
+	} else {
+		f.hasFreq = indexOptions >= model.INDEX_OPT_DOCS_AND_FREQS
+		f.hasProx = indexOptions >= model.INDEX_OPT_DOCS_AND_FREQS_AND_POSITIONS
+		f.hasOffsets = indexOptions >= model.INDEX_OPT_DOCS_AND_FREQS_AND_POSITIONS_AND_OFFSETS
+	}
+}
+
+func (f *FreqProxTermsWriterPerField) numTerms() int {
+	return len(f.postings)
+}
+
+func (f *FreqProxTermsWriterPerField) abort() {}
+
+func (f *FreqProxTermsWriterPerField) start(fields []IndexableField) (bool, error) {
+	for _, field := range fields {
+		if field.fieldType().Indexed() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *FreqProxTermsWriterPerField) finish() {
+	if f.hasPayloads && !f.fieldInfo.HasPayloads() {
+		f.fieldInfo = f.docState.docWriter.fieldInfos.SetStorePayloads(f.fieldInfo.Name)
+	}
+}
+
+/*
+Records one occurrence of the term text in the current document, at
+the given position. A nil or empty payload means no payload.
+startOffset and endOffset are ignored unless the field indexes
+offsets. Documents must be added in increasing docID order, and
+positions of the same document in increasing order.
+*/
+func (f *FreqProxTermsWriterPerField) addTerm(text []byte, position int,
+	payload []byte, startOffset, endOffset int) {
+
+	docID := f.docState.docID
+	termID, ok := f.termIDs[string(text)]
+	if !ok {
+		termID = len(f.postings)
+		f.termIDs[string(text)] = termID
+		f.postings = append(f.postings, &freqProxPostings{text: append([]byte(nil), text...)})
+		f.newTerm(f.postings[termID], docID, position, payload, startOffset, endOffset)
+		return
+	}
+
+	p := f.postings[termID]
+	if !f.hasFreq {
+		if docID != p.lastDocID {
+			assert(docID > p.lastDocID)
+			p.freq = appendVInt(p.freq, p.lastDocCode)
+			p.lastDocCode = docID - p.lastDocID
+			p.lastDocID = docID
+			f.fieldState.uniqueTermCount++
+		}
+	} else if docID != p.lastDocID {
+		assertn(docID > p.lastDocID, "id: %v postings ID: %v termID: %v", docID, p.lastDocID, termID)
+		// Term not yet seen in the current doc but previously seen in
+		// other doc(s) since the last flush
+
+		// Now that we know doc freq for previous doc, write it &
+		// lastDocCode
+		if p.termFreq == 1 {
+			p.freq = appendVInt(p.freq, p.lastDocCode|1)
+		} else {
+			p.freq = appendVInt(p.freq, p.lastDocCode)
+			p.freq = appendVInt(p.freq, p.termFreq)
+		}
+		p.termFreq = 1
+		if f.fieldState.maxTermFrequency < 1 {
+			f.fieldState.maxTermFrequency = 1
+		}
+		p.lastDocCode = (docID - p.lastDocID) << 1
+		p.lastDocID = docID
+		if f.hasProx {
+			f.writeProx(p, position, position, payload)
+			if f.hasOffsets {
+				p.lastOffset = 0
+				f.writeOffsets(p, startOffset, endOffset)
+			}
+		}
+		f.fieldState.uniqueTermCount++
+	} else {
+		p.termFreq++
+		if p.termFreq > f.fieldState.maxTermFrequency {
+			f.fieldState.maxTermFrequency = p.termFreq
+		}
+		if f.hasProx {
+			f.writeProx(p, position-p.lastPosition, position, payload)
+			if f.hasOffsets {
+				f.writeOffsets(p, startOffset, endOffset)
+			}
+		}
+	}
+}
+
+/* First time this term is seen since the last flush */
+func (f *FreqProxTermsWriterPerField) newTerm(p *freqProxPostings,
+	docID, position int, payload []byte, startOffset, endOffset int) {
+
+	p.lastDocID = docID
+	if !f.hasFreq {
+		p.lastDocCode = docID
+	} else {
+		p.lastDocCode = docID << 1
+		p.termFreq = 1
+		if f.fieldState.maxTermFrequency < 1 {
+			f.fieldState.maxTermFrequency = 1
+		}
+		if f.hasProx {
+			f.writeProx(p, position, position, payload)
+			if f.hasOffsets {
+				f.writeOffsets(p, startOffset, endOffset)
+			}
+		}
+	}
+}
+
+func (f *FreqProxTermsWriterPerField) writeProx(p *freqProxPostings,
+	proxCode, position int, payload []byte) {
+
+	if len(payload) > 0 {
+		p.prox = appendVInt(p.prox, (proxCode<<1)|1)
+		p.prox = appendVInt(p.prox, len(payload))
+		p.prox = append(p.prox, payload...)
+		f.hasPayloads = true
+	} else {
+		p.prox = appendVInt(p.prox, proxCode<<1)
+	}
+	p.lastPosition = position
+}
+
+func (f *FreqProxTermsWriterPerField) writeOffsets(p *freqProxPostings, startOffset, endOffset int) {
+	assert(startOffset-p.lastOffset >= 0)
+	p.prox = appendVInt(p.prox, startOffset-p.lastOffset)
+	p.prox = appendVInt(p.prox, endOffset-startOffset)
+	p.lastOffset = startOffset
+}
+
+/* Appends i to buf in Lucene's variable-length format. */
+func appendVInt(buf []byte, i int) []byte {
+	for (i & ^0x7F) != 0 {
+		buf = append(buf, byte((i&0x7F)|0x80))
+		i = int(uint32(i) >> 7)
+	}
+	return append(buf, byte(i))
+}
+
+/*
+Walk through all unique text tokens (Posting instances) found in this
+field and serialize them into a single RAM segment.
+*/
+func (f *FreqProxTermsWriterPerField) flush(fieldName string,
+	consumer FieldsConsumer, state *SegmentWriteState) error {
+
+	if !f.fieldInfo.IsIndexed() {
+		return nil // nothing to flush, don't bother the codec with the unindexed field
+	}
+
+	termsConsumer, err := consumer.AddField(f.fieldInfo)
+	if err != nil {
+		return err
+	}
+
+	// CONFUSING: this.indexOptions holds the index options that were
+	// current when we first saw this field. But it's possible this has
+	// changed, e.g. when other documents are indexed that cause a
+	// "downgrade" of the IndexOptions. So we must decode the in-RAM
+	// buffer according to this.indexOptions, but then write the new
+	// segment to the directory according to currentFieldIndexOptions:
+	currentFieldIndexOptions := f.fieldInfo.IndexOptions()
+	assert(currentFieldIndexOptions != 0)
+
+	writeTermFreq := currentFieldIndexOptions >= model.INDEX_OPT_DOCS_AND_FREQS
+	writePositions := currentFieldIndexOptions >= model.INDEX_OPT_DOCS_AND_FREQS_AND_POSITIONS
+	writeOffsets := currentFieldIndexOptions >= model.INDEX_OPT_DOCS_AND_FREQS_AND_POSITIONS_AND_OFFSETS
+
+	readTermFreq := f.hasFreq
+	readPositions := f.hasProx
+	readOffsets := f.hasOffsets
+
+	// Make sure FieldInfo.update is working correctly!:
+	assert(!writeTermFreq || readTermFreq)
+	assert(!writePositions || readPositions)
+	assert(!writeOffsets || readOffsets)
+	assert(!writeOffsets || writePositions)
+
+	var segDeletes map[string]int
+	if state.segDeletes != nil {
+		for term, docIDUpto := range state.segDeletes.terms {
+			if term.Field == fieldName {
+				if segDeletes == nil {
+					segDeletes = make(map[string]int)
+				}
+				segDeletes[string(term.Bytes)] = docIDUpto
+			}
+		}
+	}
+
+	sorted := make([]*freqProxPostings, len(f.postings))
+	copy(sorted, f.postings)
+	sort.Sort(freqProxPostingsByText(sorted))
+
+	maxDoc := state.segmentInfo.DocCount()
+	visitedDocs := util.NewFixedBitSet(maxDoc)
+	var sumTotalTermFreq, sumDocFreq int64
+
+	freq := store.NewEmptyByteArrayDataInput()
+	prox := store.NewEmptyByteArrayDataInput()
+	var payload []byte
+
+	for _, p := range sorted {
+		freq.Reset(p.freq)
+		prox.Reset(p.prox)
+
+		postingsConsumer, err := termsConsumer.StartTerm(p.text)
+		if err != nil {
+			return err
+		}
+
+		delDocLimit := segDeletes[string(p.text)]
+
+		// Now termStates has numToMerge FieldMergeStates which all share
+		// the same term. Now we must interleave the docID streams.
+		docFreq := 0
+		var totalTermFreq int64
+		docID := 0
+		lastDocDone := false
+
+		for {
+			var termFreq int
+			if freq.Pos >= freq.Length() {
+				if lastDocDone {
+					break
+				}
+				// Return last doc
+				docID = p.lastDocID
+				if readTermFreq {
+					termFreq = p.termFreq
+				} else {
+					termFreq = -1
+				}
+				lastDocDone = true
+			} else {
+				code, err := freq.ReadVInt()
+				if err != nil {
+					return err
+				}
+				if !readTermFreq {
+					docID += int(code)
+					termFreq = -1
+				} else {
+					docID += int(uint32(code) >> 1)
+					if (code & 1) != 0 {
+						termFreq = 1
+					} else {
+						n, err := freq.ReadVInt()
+						if err != nil {
+							return err
+						}
+						termFreq = int(n)
+					}
+				}
+				assert(docID != p.lastDocID)
+			}
+
+			docFreq++
+			assertn(docID < maxDoc, "doc=%v maxDoc=%v", docID, maxDoc)
+
+			// NOTE: we could check here if the docID was deleted, and skip
+			// it. However, this is somewhat dangerous because it can yield
+			// non-deterministic behavior since we may see the docID before
+			// we see the term that caused it to be deleted. This would mean
+			// some (but not all) of its postings may make it into the
+			// index, which'd alter the docFreq for those terms. We could
+			// fix this by doing two passes, i.e. first sweep marks all del
+			// docs, and 2nd sweep does the real flush, but I suspect that'd
+			// add too much time to flush.
+			visitedDocs.Set(docID)
+			startFreq := -1
+			if writeTermFreq {
+				startFreq = termFreq
+			}
+			if err = postingsConsumer.StartDoc(docID, startFreq); err != nil {
+				return err
+			}
+			if docID < delDocLimit {
+				// Mark it deleted. TODO: we could also skip writing its
+				// postings; this would be deterministic (just for this
+				// Term's docs).
+				if state.liveDocs == nil {
+					state.liveDocs = state.segmentInfo.Codec().(Codec).LiveDocsFormat().NewLiveDocs(maxDoc)
+				}
+				if state.liveDocs.At(docID) {
+					state.delCountOnFlush++
+					state.liveDocs.Clear(docID)
+				}
+			}
+
+			totalTermFreq += int64(termFreq)
+
+			// Carefully copy over the prox + payload info, changing the
+			// format to match Lucene's segment format.
+			if readPositions || readOffsets {
+				// we did record positions (& maybe payload) and/or offsets
+				position, offset := 0, 0
+				for j := 0; j < termFreq; j++ {
+					var thisPayload []byte
+
+					if readPositions {
+						code, err := prox.ReadVInt()
+						if err != nil {
+							return err
+						}
+						position += int(uint32(code) >> 1)
+
+						if (code & 1) != 0 {
+							// This position has a payload
+							payloadLength, err := prox.ReadVInt()
+							if err != nil {
+								return err
+							}
+							if cap(payload) < int(payloadLength) {
+								payload = make([]byte, payloadLength)
+							}
+							payload = payload[:payloadLength]
+							if err = prox.ReadBytes(payload); err != nil {
+								return err
+							}
+							thisPayload = payload
+						}
+
+						if readOffsets {
+							n, err := prox.ReadVInt()
+							if err != nil {
+								return err
+							}
+							startOffset := offset + int(n)
+							if n, err = prox.ReadVInt(); err != nil {
+								return err
+							}
+							endOffset := startOffset + int(n)
+							if writePositions {
+								if writeOffsets {
+									assertn(startOffset >= 0 && endOffset >= startOffset,
+										"startOffset=%v,endOffset=%v,offset=%v", startOffset, endOffset, offset)
+									err = postingsConsumer.AddPosition(position, thisPayload, startOffset, endOffset)
+								} else {
+									err = postingsConsumer.AddPosition(position, thisPayload, -1, -1)
+								}
+								if err != nil {
+									return err
+								}
+							}
+							offset = startOffset
+						} else if writePositions {
+							if err = postingsConsumer.AddPosition(position, thisPayload, -1, -1); err != nil {
+								return err
+							}
+						}
+					}
+				}
+			}
+			if err = postingsConsumer.FinishDoc(); err != nil {
+				return err
+			}
+		}
+
+		stats := &TermStats{docFreq, -1}
+		if writeTermFreq {
+			stats.TotalTermFreq = totalTermFreq
+		}
+		if err = termsConsumer.FinishTerm(p.text, stats); err != nil {
+			return err
+		}
+		sumTotalTermFreq += totalTermFreq
+		sumDocFreq += int64(docFreq)
+	}
+
+	if !writeTermFreq {
+		sumTotalTermFreq = -1
+	}
+	return termsConsumer.Finish(sumTotalTermFreq, sumDocFreq, visitedDocs.Cardinality())
+}
+
+func (f *FreqProxTermsWriterPerField) String() string {
+	return fmt.Sprintf("FreqProxTermsWriterPerField(field=%v, terms=%v)",
+		f.fieldInfo.Name, len(f.postings))
+}
+
+// Sorts postings by term text, in unicode order
+type freqProxPostingsByText []*freqProxPostings
+
+func (a freqProxPostingsByText) Len() int      { return len(a) }
+func (a freqProxPostingsByText) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a freqProxPostingsByText) Less(i, j int) bool {
+	return string(a[i].text) < string(a[j].text)
+}
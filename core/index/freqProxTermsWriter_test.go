@@ -0,0 +1,125 @@
+package index
+
+import (
+	"fmt"
+	"github.com/balzaczyy/golucene/core/index/model"
+	"github.com/balzaczyy/golucene/core/store"
+	"github.com/balzaczyy/golucene/core/util"
+	"testing"
+)
+
+const flushTestNumDocs = 300
+
+/*
+Buffers and flushes the postings of a "body" field, with more than a
+FOR block of docs for "common" and enough distinct terms to require
+non-leaf and floor blocks, and of a DOCS_ONLY "id" field.
+*/
+func flushTestPostings(t *testing.T, dir store.Directory, info *model.SegmentInfo) model.FieldInfos {
+	bodyInfo := model.NewFieldInfo("body", true, 0, false, false, false,
+		model.INDEX_OPT_DOCS_AND_FREQS_AND_POSITIONS, 0, 0, nil)
+	idInfo := model.NewFieldInfo("id", true, 1, false, true, false,
+		model.INDEX_OPT_DOCS_ONLY, 0, 0, nil)
+	fieldInfos := model.NewFieldInfos([]model.FieldInfo{bodyInfo, idInfo})
+
+	docState := new(docState)
+	perField := func(fi model.FieldInfo) *TermsHashPerField {
+		return &TermsHashPerField{docState: docState, fieldState: newFieldInvertState(fi.Name)}
+	}
+	writer := new(FreqProxTermsWriter)
+	body := newFreqProxTermsWriterPerField(perField(bodyInfo), writer, bodyInfo)
+	id := newFreqProxTermsWriterPerField(perField(idInfo), writer, idInfo)
+	for docID := 0; docID < flushTestNumDocs; docID++ {
+		docState.docID = docID
+		pos := 0
+		for i := 0; i <= docID%3; i++ {
+			body.addTerm([]byte("common"), pos, nil, -1, -1)
+			pos++
+		}
+		body.addTerm([]byte(fmt.Sprintf("t%03d", docID%100)), pos, nil, -1, -1)
+		id.addTerm([]byte(fmt.Sprintf("id%v", docID)), 0, nil, -1, -1)
+	}
+
+	state := newSegmentWriteState(util.NO_OUTPUT, dir, info, fieldInfos,
+		DEFAULT_TERM_INDEX_INTERVAL, nil, store.IO_CONTEXT_DEFAULT)
+	err := writer.flush(map[string]TermsHashConsumerPerField{
+		"body": body, "id": id}, &state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fieldInfos
+}
+
+func TestFlushPostings(t *testing.T) {
+	const numDocs = flushTestNumDocs
+
+	dir := store.NewRAMDirectory()
+	codec := LoadCodec("Lucene42")
+	info := model.NewSegmentInfo(dir, util.LUCENE_MAIN_VERSION, "_0", numDocs, false, codec, nil, nil)
+	fieldInfos := flushTestPostings(t, dir, info)
+
+	fields, err := codec.PostingsFormat().FieldsProducer(newSegmentReadState(
+		dir, info, fieldInfos, store.IO_CONTEXT_READ, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fields.Close()
+
+	terms := fields.Terms("body")
+	if n := terms.Size(); n != 101 {
+		t.Errorf("Expected 101 terms, but found %v", n)
+	}
+	if n := terms.DocCount(); n != numDocs {
+		t.Errorf("Expected %v docs, but found %v", numDocs, n)
+	}
+
+	assertPostings := func(termsEnum TermsEnum, text string, docs, freqs []int) {
+		ok, err := termsEnum.SeekExact([]byte(text))
+		if err != nil || !ok {
+			t.Fatalf("Term '%v' should be found: %v", text, err)
+		}
+		if df, _ := termsEnum.DocFreq(); df != len(docs) {
+			t.Errorf("Term '%v' should have docFreq %v, but found %v", text, len(docs), df)
+		}
+		docsEnum, err := termsEnum.DocsByFlags(nil, nil, DOCS_ENUM_FLAG_FREQS)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, expected := range docs {
+			docID, err := docsEnum.NextDoc()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if docID != expected {
+				t.Fatalf("Term '%v' should match doc %v, but found %v", text, expected, docID)
+			}
+			if freqs != nil {
+				if freq, _ := docsEnum.Freq(); freq != freqs[i] {
+					t.Errorf("Term '%v' should have freq %v in doc %v, but found %v",
+						text, freqs[i], docID, freq)
+				}
+			}
+		}
+		if docID, _ := docsEnum.NextDoc(); docID != NO_MORE_DOCS {
+			t.Errorf("Term '%v' should be exhausted, but found doc %v", text, docID)
+		}
+	}
+
+	termsEnum := terms.Iterator(nil)
+	var docs, freqs []int
+	for docID := 0; docID < numDocs; docID++ {
+		docs = append(docs, docID)
+		freqs = append(freqs, docID%3+1)
+	}
+	assertPostings(termsEnum, "common", docs, freqs)
+	assertPostings(termsEnum, "t042", []int{42, 142, 242}, []int{1, 1, 1})
+	assertPostings(termsEnum, "t099", []int{99, 199, 299}, []int{1, 1, 1})
+	if ok, _ := termsEnum.SeekExact([]byte("t100")); ok {
+		t.Error("Term 't100' should not be found.")
+	}
+
+	termsEnum = fields.Terms("id").Iterator(nil)
+	for _, docID := range []int{0, 7, 123, 299} {
+		assertPostings(termsEnum, fmt.Sprintf("id%v", docID), []int{docID}, nil)
+	}
+}
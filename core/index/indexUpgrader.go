@@ -0,0 +1,142 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"github.com/balzaczyy/golucene/core/store"
+	"github.com/balzaczyy/golucene/core/util"
+)
+
+// index/IndexUpgrader.java
+
+/*
+This is an easy-to-use tool that upgrades all segments of an index
+from previous Lucene versions to the current segment file format. It
+can be used from command line (see cmd/indexupgrader), or used from
+code:
+
+	err := NewIndexUpgrader(dir, conf, false).Upgrade()
+
+This tool keeps only the last commit in an index; for this reason, if
+the incoming index has more than one commit, the tool refuses to run
+by default. Specify deletePriorCommits to override this, allowing the
+tool to delete all but the last commit.
+
+Segments already written in the current format are kept as is; only
+the older ones are rewritten, see UpgradeIndexMergePolicy.
+SegmentsToUpgrade() lists them without changing the index.
+
+WARNING: This tool may reorder documents if the index was partially
+upgraded before execution (e.g., documents were added). If your
+application relies on "monotonicity" of doc IDs (which means that the
+order in which the documents were added to the index is preserved),
+do a full ForceMerge instead. The MergePolicy set by IndexWriterConfig
+may also reorder documents.
+*/
+type IndexUpgrader struct {
+	dir                store.Directory
+	conf               *IndexWriterConfig
+	deletePriorCommits bool
+}
+
+/*
+Creates index upgrader on the given directory, using an IndexWriter
+using the given config. You have the possibility to upgrade indexes
+with multiple commit points by removing all older ones.
+
+NOTE: the merge policy and the deletion policy of the config are
+replaced when upgrading, so the config can't be reused afterwards.
+*/
+func NewIndexUpgrader(dir store.Directory, conf *IndexWriterConfig, deletePriorCommits bool) *IndexUpgrader {
+	return &IndexUpgrader{dir, conf, deletePriorCommits}
+}
+
+/* Describes a segment written by a previous Lucene version. */
+type SegmentToUpgrade struct {
+	Name     string
+	Version  string
+	Codec    string
+	DocCount int
+	DelCount int
+	// Total size of the files of the segment.
+	SizeInBytes int64
+}
+
+/*
+Returns the segments of the last commit which Upgrade() would
+rewrite, without changing the index.
+*/
+func (u *IndexUpgrader) SegmentsToUpgrade() ([]*SegmentToUpgrade, error) {
+	infos := &SegmentInfos{}
+	if err := infos.ReadAll(u.dir); err != nil {
+		return nil, err
+	}
+	var ans []*SegmentToUpgrade
+	for _, si := range infos.Segments {
+		if !shouldUpgradeSegment(si) {
+			continue
+		}
+		size, err := si.SizeInBytes()
+		if err != nil {
+			return nil, err
+		}
+		ans = append(ans, &SegmentToUpgrade{
+			Name:        si.info.Name,
+			Version:     si.info.Version(),
+			Codec:       fmt.Sprintf("%v", si.info.Codec()),
+			DocCount:    si.info.DocCount(),
+			DelCount:    si.delCount,
+			SizeInBytes: size,
+		})
+	}
+	return ans, nil
+}
+
+/* Performs the upgrade. */
+func (u *IndexUpgrader) Upgrade() (err error) {
+	ok, err := IsIndexExists(u.dir)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New(fmt.Sprintf("no index found in %v", u.dir))
+	}
+
+	if !u.deletePriorCommits {
+		commits, err := ListCommits(u.dir)
+		if err != nil {
+			return err
+		}
+		if len(commits) > 1 {
+			return errors.New(fmt.Sprintf(
+				"This tool was invoked to not delete prior commit points, but the following commits were found: %v",
+				commits))
+		}
+	}
+
+	u.conf.SetMergePolicy(NewUpgradeIndexMergePolicy(u.conf.MergePolicy()))
+	u.conf.SetIndexDeletionPolicy(DEFAULT_DELETION_POLICY)
+
+	w, err := NewIndexWriter(u.dir, u.conf)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err2 := w.Close(); err == nil {
+			err = err2
+		}
+	}()
+
+	infoStream := u.conf.InfoStream()
+	if infoStream.IsEnabled("IndexUpgrader") {
+		infoStream.Message("IndexUpgrader", "Upgrading all pre-%v segments of index directory '%v' to version %v...",
+			util.LUCENE_MAIN_VERSION, u.dir, util.LUCENE_MAIN_VERSION)
+	}
+	if err = w.ForceMerge(1); err != nil {
+		return err
+	}
+	if infoStream.IsEnabled("IndexUpgrader") {
+		infoStream.Message("IndexUpgrader", "All segments upgraded to version %v", util.LUCENE_MAIN_VERSION)
+	}
+	return nil
+}
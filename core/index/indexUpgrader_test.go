@@ -0,0 +1,122 @@
+package index
+
+import (
+	"bytes"
+	"github.com/balzaczyy/golucene/core/store"
+	"github.com/balzaczyy/golucene/core/util"
+	"testing"
+)
+
+func TestIndexUpgrader(t *testing.T) {
+	d := store.NewRAMDirectory()
+	w, err := NewIndexWriter(d, NewIndexWriterConfig(util.VERSION_45, nil).
+		SetIndexDeletionPolicy(NO_DELETION_POLICY))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{
+		"../search/testdata/belfrysample",
+		"../search/testdata/osx/belfrysample",
+	} {
+		addSample(t, w, path)
+		if err = w.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	u := NewIndexUpgrader(d, NewIndexWriterConfig(util.VERSION_45, nil), false)
+	segments, err := u.SegmentsToUpgrade()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 2 {
+		t.Fatalf("expected 2 segments to upgrade, got %v", len(segments))
+	}
+	for _, si := range segments {
+		if si.Version == util.LUCENE_MAIN_VERSION || si.DocCount != 8 {
+			t.Errorf("unexpected segment to upgrade: %v", si)
+		}
+	}
+	if err = u.Upgrade(); err == nil {
+		t.Fatal("expected error upgrading an index with prior commits")
+	}
+
+	u = NewIndexUpgrader(d, NewIndexWriterConfig(util.VERSION_45, nil), true)
+	if err = u.Upgrade(); err != nil {
+		t.Fatal(err)
+	}
+	infos := &SegmentInfos{}
+	if err = infos.ReadAll(d); err != nil {
+		t.Fatal(err)
+	}
+	if len(infos.Segments) != 1 {
+		t.Fatalf("expected old segments merged into 1, got %v", len(infos.Segments))
+	}
+	if si := infos.Segments[0].info; si.Version() != util.LUCENE_MAIN_VERSION || si.DocCount() != 16 {
+		t.Errorf("expected 16 docs at version %v, got %v", util.LUCENE_MAIN_VERSION, si)
+	}
+	if commits, err := ListCommits(d); err != nil || len(commits) != 1 {
+		t.Errorf("expected prior commits deleted, got %v (%v)", commits, err)
+	}
+
+	// the upgraded segment is kept as is
+	if segments, err = u.SegmentsToUpgrade(); err != nil || len(segments) != 0 {
+		t.Fatalf("expected nothing left to upgrade, got %v (%v)", segments, err)
+	}
+	gen := infos.generation
+	u = NewIndexUpgrader(d, NewIndexWriterConfig(util.VERSION_45, nil), false)
+	if err = u.Upgrade(); err != nil {
+		t.Fatal(err)
+	}
+	if err = infos.ReadAll(d); err != nil {
+		t.Fatal(err)
+	}
+	if infos.generation != gen {
+		t.Errorf("expected no new commit, got generation %v after %v", infos.generation, gen)
+	}
+
+	// only the new old segment is rewritten
+	upgraded := infos.Segments[0].info.Name
+	if w, err = NewIndexWriter(d, NewIndexWriterConfig(util.VERSION_45, nil)); err != nil {
+		t.Fatal(err)
+	}
+	addSample(t, w, "../search/testdata/win8/belfrysample")
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if segments, err = u.SegmentsToUpgrade(); err != nil || len(segments) != 1 {
+		t.Fatalf("expected 1 segment to upgrade, got %v (%v)", segments, err)
+	}
+	u = NewIndexUpgrader(d, NewIndexWriterConfig(util.VERSION_45, nil), false)
+	if err = u.Upgrade(); err != nil {
+		t.Fatal(err)
+	}
+	if err = infos.ReadAll(d); err != nil {
+		t.Fatal(err)
+	}
+	if len(infos.Segments) != 2 || infos.Segments[0].info.Name != upgraded {
+		t.Fatalf("expected %v kept and 1 upgraded segment, got %v", upgraded, infos.Segments)
+	}
+	for _, si := range infos.Segments {
+		if si.info.Version() != util.LUCENE_MAIN_VERSION {
+			t.Errorf("expected %v at version %v", si, util.LUCENE_MAIN_VERSION)
+		}
+	}
+
+	var buf bytes.Buffer
+	if status := NewCheckIndex(d, true, &buf).CheckIndex(nil); !status.Clean {
+		t.Errorf("upgraded index is not clean:\n%v", buf.String())
+	}
+
+	r, err := OpenDirectoryReader(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if r.NumDocs() != 24 {
+		t.Errorf("expected 24 docs, got %v", r.NumDocs())
+	}
+}
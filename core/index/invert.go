@@ -7,8 +7,62 @@ Tracks the number and position / offset parameters of terms being
 added to the index. The information collected in this class is also
 used to calculate the normalization factor for a field
 */
-type FieldInvertState struct{}
+type FieldInvertState struct {
+	name             string
+	position         int
+	length           int
+	numOverlap       int
+	offset           int
+	maxTermFrequency int
+	uniqueTermCount  int
+	boost            float32
+}
+
+/* Creates FieldInvertState for the specified field name. */
+func newFieldInvertState(name string) *FieldInvertState {
+	return &FieldInvertState{name: name}
+}
 
-func (st *FieldInvertState) Name() string {
-	panic("not implemented yet")
+/* Re-initialize the state */
+func (st *FieldInvertState) reset() {
+	st.position = 0
+	st.length = 0
+	st.numOverlap = 0
+	st.offset = 0
+	st.maxTermFrequency = 0
+	st.uniqueTermCount = 0
+	st.boost = 1.0
 }
+
+/* Get the last processed term position. */
+func (st *FieldInvertState) Position() int { return st.position }
+
+/*
+Get total number of terms in this field.
+*/
+func (st *FieldInvertState) Length() int { return st.length }
+
+/* Get the number of terms with positionIncrement == 0. */
+func (st *FieldInvertState) NumOverlap() int { return st.numOverlap }
+
+/* Get end offset of the last processed term. */
+func (st *FieldInvertState) Offset() int { return st.offset }
+
+/*
+Get boost value. This is the cumulative product of document boost
+and field boost for all field instances sharing the same field name.
+*/
+func (st *FieldInvertState) Boost() float32 { return st.boost }
+
+/*
+Get the maximum term-frequency encountered for any term in the field.
+A field containing "the quick brown fox jumps over the lazy dog"
+would have a value of 2, because "the" appears twice.
+*/
+func (st *FieldInvertState) MaxTermFrequency() int { return st.maxTermFrequency }
+
+/* Return the number of unique terms encountered in this field. */
+func (st *FieldInvertState) UniqueTermCount() int { return st.uniqueTermCount }
+
+/* Return the field's name */
+func (st *FieldInvertState) Name() string { return st.name }
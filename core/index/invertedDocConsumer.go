@@ -1,12 +1,33 @@
 package index
 
 import (
+	"github.com/balzaczyy/golucene/core/index/model"
 	"github.com/balzaczyy/golucene/core/util"
 )
 
 type InvertedDocConsumer interface {
 	// Abort (called after hitting abort error)
 	abort()
+	// Flush a new segment
+	flush(fieldsToFlush map[string]InvertedDocConsumerPerField, state *SegmentWriteState) error
+	// Add a new field
+	addField(docInverterPerField *DocInverterPerField, fieldInfo model.FieldInfo) InvertedDocConsumerPerField
+	startDocument()
+	finishDocument() error
+}
+
+type InvertedDocConsumerPerField interface {
+	// Called once per field, and is given all IndexableField
+	// occurrences for this field in the document. Return true if you
+	// wish to see inverted tokens for these fields:
+	start(fields []IndexableField) (bool, error)
+	// Called once per inverted token
+	add(text []byte, position int, payload []byte, startOffset, endOffset int)
+	// Called once per field per document, after all IndexableFields
+	// are inverted
+	finish()
+	// Called on hitting an aborting error
+	abort()
 }
 
 /*
@@ -72,3 +93,127 @@ func (hash *TermsHash) reset() {
 	hash.intPool.Reset(false, false)
 	hash.bytePool.Reset(false, false)
 }
+
+func (hash *TermsHash) flush(fieldsToFlush map[string]InvertedDocConsumerPerField,
+	state *SegmentWriteState) error {
+
+	childFields := make(map[string]TermsHashConsumerPerField)
+	var nextChildFields map[string]InvertedDocConsumerPerField
+	if hash.nextTermsHash != nil {
+		nextChildFields = make(map[string]InvertedDocConsumerPerField)
+	}
+
+	for name, field := range fieldsToFlush {
+		perField := field.(*TermsHashPerField)
+		childFields[name] = perField.consumer
+		if hash.nextTermsHash != nil {
+			nextChildFields[name] = perField.nextPerField
+		}
+	}
+
+	if err := hash.consumer.flush(childFields, state); err != nil {
+		return err
+	}
+	if hash.nextTermsHash != nil {
+		return hash.nextTermsHash.flush(nextChildFields, state)
+	}
+	return nil
+}
+
+func (hash *TermsHash) addField(docInverterPerField *DocInverterPerField,
+	fieldInfo model.FieldInfo) InvertedDocConsumerPerField {
+	return newTermsHashPerField(docInverterPerField, hash, hash.nextTermsHash, fieldInfo)
+}
+
+func (hash *TermsHash) finishDocument() error {
+	if err := hash.consumer.finishDocument(); err != nil {
+		return err
+	}
+	if hash.nextTermsHash != nil {
+		return hash.nextTermsHash.consumer.finishDocument()
+	}
+	return nil
+}
+
+func (hash *TermsHash) startDocument() {
+	hash.consumer.startDocument()
+	if hash.nextTermsHash != nil {
+		hash.nextTermsHash.consumer.startDocument()
+	}
+}
+
+// index/TermsHashPerField.java
+
+/*
+Forwards the tokens of a single field to the per-field consumer of
+its TermsHash, and to the one of the next TermsHash in the chain.
+*/
+type TermsHashPerField struct {
+	consumer TermsHashConsumerPerField
+
+	termsHash *TermsHash
+
+	nextPerField *TermsHashPerField
+	docState     *docState
+	fieldState   *FieldInvertState
+
+	fieldInfo model.FieldInfo
+
+	doCall     bool
+	doNextCall bool
+}
+
+func newTermsHashPerField(docInverterPerField *DocInverterPerField,
+	termsHash, nextTermsHash *TermsHash, fieldInfo model.FieldInfo) *TermsHashPerField {
+
+	ans := &TermsHashPerField{
+		termsHash:  termsHash,
+		docState:   termsHash.docState,
+		fieldState: docInverterPerField.fieldState,
+		fieldInfo:  fieldInfo,
+	}
+	ans.consumer = termsHash.consumer.addField(ans, fieldInfo)
+	if nextTermsHash != nil {
+		ans.nextPerField = nextTermsHash.addField(docInverterPerField, fieldInfo).(*TermsHashPerField)
+	}
+	return ans
+}
+
+func (f *TermsHashPerField) abort() {
+	defer func() {
+		if f.nextPerField != nil {
+			f.nextPerField.abort()
+		}
+	}()
+	f.consumer.abort()
+}
+
+func (f *TermsHashPerField) start(fields []IndexableField) (ok bool, err error) {
+	if f.doCall, err = f.consumer.start(fields); err != nil {
+		return false, err
+	}
+	if f.nextPerField != nil {
+		if f.doNextCall, err = f.nextPerField.start(fields); err != nil {
+			return false, err
+		}
+	}
+	return f.doCall || f.doNextCall, nil
+}
+
+func (f *TermsHashPerField) add(text []byte, position int, payload []byte,
+	startOffset, endOffset int) {
+
+	if f.doCall {
+		f.consumer.addTerm(text, position, payload, startOffset, endOffset)
+	}
+	if f.doNextCall {
+		f.nextPerField.add(text, position, payload, startOffset, endOffset)
+	}
+}
+
+func (f *TermsHashPerField) finish() {
+	f.consumer.finish()
+	if f.nextPerField != nil {
+		f.nextPerField.finish()
+	}
+}
@@ -1,15 +1,124 @@
 package index
 
+import (
+	"github.com/balzaczyy/golucene/core/index/model"
+	"github.com/balzaczyy/golucene/core/util"
+)
+
 type InvertedDocEndConsumer interface {
+	flush(fieldsToFlush map[string]InvertedDocEndConsumerPerField, state *SegmentWriteState) error
+	abort()
+	addField(docInverterPerField *DocInverterPerField, fieldInfo model.FieldInfo) InvertedDocEndConsumerPerField
+	startDocument()
+	finishDocument() error
+}
+
+type InvertedDocEndConsumerPerField interface {
+	finish()
 	abort()
 }
 
+// index/NormsConsumer.java
+
 /*
 Writes norms. Each thread X field accumlates the norms for the
 doc/fields it saw, then the flush method below merges all of these
- together into a single _X.nrm file.
+together into a single _X.nrm file.
 */
 type NormsConsumer struct {
 }
 
 func (nc *NormsConsumer) abort() {}
+
+/* Produce _X.nrm if any document had a field with norms not disabled */
+func (nc *NormsConsumer) flush(fieldsToFlush map[string]InvertedDocEndConsumerPerField,
+	state *SegmentWriteState) (err error) {
+
+	if !state.fieldInfos.HasNorms {
+		return nil
+	}
+
+	normsFormat := state.segmentInfo.Codec().(Codec).NormsFormat()
+	normsConsumer, err := normsFormat.NormsConsumer(*state)
+	if err != nil {
+		return err
+	}
+	var success = false
+	defer func() {
+		if success {
+			err = util.CloseWhileHandlingError(err, normsConsumer)
+		} else {
+			util.CloseWhileSuppressingError(normsConsumer)
+		}
+	}()
+
+	for _, fi := range state.fieldInfos.Values {
+		if fi.OmitsNorms() {
+			continue
+		}
+		if toWrite, ok := fieldsToFlush[fi.Name].(*NormsConsumerPerField); ok && !toWrite.isEmpty() {
+			if err = toWrite.flush(state, normsConsumer); err != nil {
+				return err
+			}
+			assert(fi.NormType() == model.DOC_VALUES_TYPE_NUMERIC)
+		} else if fi.IsIndexed() {
+			assertn(fi.NormType() == 0, "got %v; field=%v", fi.NormType(), fi.Name)
+		}
+	}
+	success = true
+	return nil
+}
+
+func (nc *NormsConsumer) finishDocument() error { return nil }
+
+func (nc *NormsConsumer) startDocument() {}
+
+func (nc *NormsConsumer) addField(docInverterPerField *DocInverterPerField,
+	fieldInfo model.FieldInfo) InvertedDocEndConsumerPerField {
+	return newNormsConsumerPerField(docInverterPerField, fieldInfo, nc)
+}
+
+// index/NormsConsumerPerField.java
+
+type NormsConsumerPerField struct {
+	docInverterPerField *DocInverterPerField
+	docState            *docState
+	fieldState          *FieldInvertState
+	consumer            *NumericDocValuesWriter
+}
+
+func newNormsConsumerPerField(docInverterPerField *DocInverterPerField,
+	fieldInfo model.FieldInfo, parent *NormsConsumer) *NormsConsumerPerField {
+	return &NormsConsumerPerField{
+		docInverterPerField: docInverterPerField,
+		docState:            docInverterPerField.docState,
+		fieldState:          docInverterPerField.fieldState,
+	}
+}
+
+func (nc *NormsConsumerPerField) finish() {
+	fieldInfo := nc.docInverterPerField.fieldInfo()
+	if fieldInfo.IsIndexed() && !fieldInfo.OmitsNorms() {
+		if nc.consumer == nil {
+			fieldInfo = nc.docState.docWriter.fieldInfos.SetNormValueType(
+				fieldInfo.Name, model.DOC_VALUES_TYPE_NUMERIC)
+			nc.consumer = newNumericDocValuesWriter(fieldInfo, nc.docState.docWriter._bytesUsed)
+		}
+		nc.consumer.addValue(nc.docState.docID, nc.docState.similarity.ComputeNorm(nc.fieldState))
+	}
+}
+
+func (nc *NormsConsumerPerField) flush(state *SegmentWriteState, normsWriter DocValuesConsumer) error {
+	docCount := state.segmentInfo.DocCount()
+	if nc.consumer == nil {
+		return nil // null type - not omitted but not written
+	}
+	nc.consumer.finish(docCount)
+	return nc.consumer.flush(state, normsWriter)
+}
+
+func (nc *NormsConsumerPerField) isEmpty() bool {
+	return nc.consumer == nil
+}
+
+func (nc *NormsConsumerPerField) abort() {}
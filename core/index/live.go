@@ -209,6 +209,16 @@ func (conf *LiveIndexWriterConfig) SetUseCompoundFile(useCompoundFile bool) *Liv
 	return conf
 }
 
+/* Returns the IndexDeletionPolicy specified in IndexWriterConfig.SetIndexDeletionPolicy(). */
+func (conf *LiveIndexWriterConfig) IndexDeletionPolicy() IndexDeletionPolicy {
+	return conf.delPolicy
+}
+
+/* Returns the current MergePolicy in use by this writer. */
+func (conf *LiveIndexWriterConfig) MergePolicy() MergePolicy {
+	return conf.mergePolicy
+}
+
 func (conf *LiveIndexWriterConfig) String() string {
 	return fmt.Sprintf(`matchVersion=%v
 analyzer=%v
@@ -1,7 +1,6 @@
 package index
 
 import (
-	"errors"
 	"fmt"
 	"github.com/balzaczyy/golucene/core/codec"
 	. "github.com/balzaczyy/golucene/core/codec/lucene40"
@@ -65,10 +64,12 @@ func (f *Lucene40SegmentInfoFormat) SegmentInfoWriter() SegmentInfoWriter {
 const (
 	LUCENE40_SI_EXTENSION    = "si"
 	LUCENE40_CODEC_NAME      = "Lucene40SegmentInfo"
-	LUCENE40_VERSION_START   = 0
-	LUCENE40_VERSION_CURRENT = LUCENE40_VERSION_START
+	LUCENE40_VERSION_START    = 0
+	LUCENE40_VERSION_CHECKSUM = 1 // adds the codec footer
+	LUCENE40_VERSION_CURRENT  = LUCENE40_VERSION_CHECKSUM
 
 	SEGMENT_INFO_YES = 1
+	SEGMENT_INFO_NO  = -1
 )
 
 // lucene40/Lucene40SegmentInfoReader.java
@@ -78,10 +79,11 @@ var Lucene40SegmentInfoReader = func(dir store.Directory,
 
 	si = new(model.SegmentInfo)
 	fileName := util.SegmentFileName(segment, "", LUCENE40_SI_EXTENSION)
-	input, err := dir.OpenInput(fileName, context)
+	main, err := dir.OpenInput(fileName, context)
 	if err != nil {
 		return si, err
 	}
+	input := store.NewChecksumIndexInput(main)
 
 	success := false
 	defer func() {
@@ -92,7 +94,7 @@ var Lucene40SegmentInfoReader = func(dir store.Directory,
 		}
 	}()
 
-	_, err = codec.CheckHeader(input, LUCENE40_CODEC_NAME, LUCENE40_VERSION_START, LUCENE40_VERSION_CURRENT)
+	codecVersion, err := codec.CheckHeader(input, LUCENE40_CODEC_NAME, LUCENE40_VERSION_START, LUCENE40_VERSION_CURRENT)
 	if err != nil {
 		return si, err
 	}
@@ -105,7 +107,7 @@ var Lucene40SegmentInfoReader = func(dir store.Directory,
 		return si, err
 	}
 	if docCount < 0 {
-		return si, errors.New(fmt.Sprintf("invalid docCount: %v (resource=%v)", docCount, input))
+		return si, codec.NewCorruptIndexErrorAt(input, fmt.Sprintf("invalid docCount: %v", docCount))
 	}
 	sicf, err := input.ReadByte()
 	if err != nil {
@@ -125,10 +127,14 @@ var Lucene40SegmentInfoReader = func(dir store.Directory,
 		return si, err
 	}
 
-	if input.FilePointer() != input.Length() {
-		return si, errors.New(fmt.Sprintf(
-			"did not read all bytes from file '%v': read %v vs size %v (resource: %v)",
-			fileName, input.FilePointer(), input.Length(), input))
+	if codecVersion >= LUCENE40_VERSION_CHECKSUM {
+		if _, err = codec.CheckFooter(input); err != nil {
+			return si, err
+		}
+	} else if input.FilePointer() != input.Length() {
+		return si, codec.NewCorruptIndexErrorAt(input, fmt.Sprintf(
+			"did not read all bytes from file '%v': read %v vs size %v",
+			fileName, input.FilePointer(), input.Length()))
 	}
 
 	si = model.NewSegmentInfo(dir, version, segment, int(docCount), isCompoundFile,
@@ -143,9 +149,61 @@ var Lucene40SegmentInfoReader = func(dir store.Directory,
 
 // Lucene 4.0 implementation of SegmentInfoWriter
 var Lucene40SegmentInfoWriter = func(dir store.Directory,
-	si *model.SegmentInfo, fis model.FieldInfos, ctx store.IOContext) error {
+	si *model.SegmentInfo, fis model.FieldInfos, ctx store.IOContext) (err error) {
+
+	filename := util.SegmentFileName(si.Name, "", LUCENE40_SI_EXTENSION)
+	si.AddFile(filename)
+
+	var output store.IndexOutput
+	output, err = dir.CreateOutput(filename, ctx)
+	if err != nil {
+		return err
+	}
+
+	var success = false
+	defer func() {
+		if !success {
+			util.CloseWhileSuppressingError(output)
+			si.Dir.DeleteFile(filename) // ignore error
+		} else {
+			err = mergeError(err, output.Close())
+		}
+	}()
 
-	panic("not implemented yet")
+	err = codec.WriteHeader(output, LUCENE40_CODEC_NAME, LUCENE40_VERSION_CURRENT)
+	if err != nil {
+		return err
+	}
+	// Write the Lucene version that created this segment, since 3.1
+	err = output.WriteString(si.Version())
+	if err == nil {
+		err = output.WriteInt(int32(si.DocCount()))
+	}
+	if err == nil {
+		var sicf int8 = SEGMENT_INFO_NO
+		if si.IsCompoundFile() {
+			sicf = SEGMENT_INFO_YES
+		}
+		err = output.WriteByte(byte(sicf))
+	}
+	if err == nil {
+		err = output.WriteStringStringMap(si.Diagnostics())
+	}
+	if err == nil {
+		err = output.WriteStringStringMap(si.Attributes())
+	}
+	if err == nil {
+		err = output.WriteStringSet(si.Files())
+	}
+	if err == nil {
+		err = codec.WriteFooter(output)
+	}
+	if err != nil {
+		return err
+	}
+
+	success = true
+	return nil
 }
 
 // codecs/lucene40/Lucene40LiveDocsFormat.java
@@ -194,15 +252,49 @@ cleared, DGaps would be used:
 type Lucene40LiveDocsFormat struct {
 }
 
+/* Extension of deletes */
+const DELETES_EXTENSION = "del"
+
 func (format *Lucene40LiveDocsFormat) NewLiveDocs(size int) util.MutableBits {
 	ans := NewBitVector(size)
 	ans.InvertAll()
 	return ans
 }
 
+func (format *Lucene40LiveDocsFormat) CopyLiveDocs(existing util.Bits) util.MutableBits {
+	return existing.(*BitVector).Clone()
+}
+
+func (format *Lucene40LiveDocsFormat) ReadLiveDocs(dir store.Directory,
+	info *SegmentInfoPerCommit, ctx store.IOContext) (util.Bits, error) {
+
+	filename := util.FileNameFromGeneration(info.info.Name, DELETES_EXTENSION, info.delGen)
+	liveDocs, err := NewBitVectorFrom(dir, filename, ctx)
+	if err != nil {
+		return nil, err
+	}
+	assertn(liveDocs.Count() == info.info.DocCount()-info.delCount,
+		"liveDocs.count()=%v info.docCount=%v info.getDelCount()=%v",
+		liveDocs.Count(), info.info.DocCount(), info.delCount)
+	assert(liveDocs.Length() == info.info.DocCount())
+	return liveDocs, nil
+}
+
 func (format *Lucene40LiveDocsFormat) WriteLiveDocs(bits util.MutableBits,
 	dir store.Directory, info *SegmentInfoPerCommit, newDelCount int,
 	ctx store.IOContext) error {
 
-	panic("not implemented yet")
+	filename := util.FileNameFromGeneration(info.info.Name, DELETES_EXTENSION, info.nextWriteDelGen)
+	liveDocs := bits.(*BitVector)
+	assertn(liveDocs.Count() == info.info.DocCount()-info.delCount-newDelCount,
+		"liveDocs.count()=%v info.docCount=%v info.delCount=%v newDelCount=%v",
+		liveDocs.Count(), info.info.DocCount(), info.delCount, newDelCount)
+	assert(liveDocs.Length() == info.info.DocCount())
+	return liveDocs.Write(dir, filename, ctx)
+}
+
+func (format *Lucene40LiveDocsFormat) Files(info *SegmentInfoPerCommit, files map[string]bool) {
+	if info.HasDeletions() {
+		files[util.FileNameFromGeneration(info.info.Name, DELETES_EXTENSION, info.delGen)] = true
+	}
 }
@@ -1,7 +1,6 @@
 package index
 
 import (
-	"errors"
 	"fmt"
 	"github.com/balzaczyy/golucene/core/codec"
 	"github.com/balzaczyy/golucene/core/codec/compressing"
@@ -11,6 +10,7 @@ import (
 	"github.com/balzaczyy/golucene/core/util"
 	"github.com/balzaczyy/golucene/core/util/packed"
 	"log"
+	"math"
 	"reflect"
 )
 
@@ -28,7 +28,17 @@ func (f *Lucene41PostingsFormat) String() {
 }
 
 func (f *Lucene41PostingsFormat) FieldsConsumer(state SegmentWriteState) (FieldsConsumer, error) {
-	panic("not implemented yet")
+	postingsWriter, err := newLucene41PostingsWriter(state, packed.PackedInts.COMPACT)
+	if err != nil {
+		return nil, err
+	}
+	ret, err := newBlockTreeTermsWriter(state, postingsWriter,
+		BTT_DEFAULT_MIN_BLOCK_SIZE, BTT_DEFAULT_MAX_BLOCK_SIZE)
+	if err != nil {
+		util.CloseWhileSuppressingError(postingsWriter)
+		return nil, err
+	}
+	return ret, nil
 }
 
 func (f *Lucene41PostingsFormat) FieldsProducer(state SegmentReadState) (FieldsProducer, error) {
@@ -80,8 +90,9 @@ const (
 	LUCENE41_POS_CODEC   = "Lucene41PostingsWriterPos"
 	LUCENE41_PAY_CODEC   = "Lucene41PostingsWriterPay"
 
-	LUCENE41_VERSION_START   = 0
-	LUCENE41_VERSION_CURRENT = LUCENE41_VERSION_START
+	LUCENE41_VERSION_START    = 0
+	LUCENE41_VERSION_CHECKSUM = 1
+	LUCENE41_VERSION_CURRENT  = LUCENE41_VERSION_CHECKSUM
 )
 
 /*
@@ -93,6 +104,7 @@ type Lucene41PostingsReader struct {
 	posIn   store.IndexInput
 	payIn   store.IndexInput
 	forUtil ForUtil
+	version int
 }
 
 func NewLucene41PostingsReader(dir store.Directory,
@@ -116,7 +128,7 @@ func NewLucene41PostingsReader(dir store.Directory,
 	if err != nil {
 		return r, err
 	}
-	_, err = codec.CheckHeader(docIn, LUCENE41_DOC_CODEC, LUCENE41_VERSION_CURRENT, LUCENE41_VERSION_CURRENT)
+	version, err := asInt(codec.CheckHeader(docIn, LUCENE41_DOC_CODEC, LUCENE41_VERSION_START, LUCENE41_VERSION_CURRENT))
 	if err != nil {
 		return r, err
 	}
@@ -130,7 +142,7 @@ func NewLucene41PostingsReader(dir store.Directory,
 		if err != nil {
 			return r, err
 		}
-		_, err = codec.CheckHeader(posIn, LUCENE41_POS_CODEC, LUCENE41_VERSION_CURRENT, LUCENE41_VERSION_CURRENT)
+		_, err = codec.CheckHeader(posIn, LUCENE41_POS_CODEC, int32(version), int32(version))
 		if err != nil {
 			return r, err
 		}
@@ -140,7 +152,7 @@ func NewLucene41PostingsReader(dir store.Directory,
 			if err != nil {
 				return r, err
 			}
-			_, err = codec.CheckHeader(payIn, LUCENE41_PAY_CODEC, LUCENE41_VERSION_CURRENT, LUCENE41_VERSION_CURRENT)
+			_, err = codec.CheckHeader(payIn, LUCENE41_PAY_CODEC, int32(version), int32(version))
 			if err != nil {
 				return r, err
 			}
@@ -148,7 +160,7 @@ func NewLucene41PostingsReader(dir store.Directory,
 	}
 
 	success = true
-	return &Lucene41PostingsReader{docIn, posIn, payIn, forUtil}, nil
+	return &Lucene41PostingsReader{docIn, posIn, payIn, forUtil, version}, nil
 }
 
 func (r *Lucene41PostingsReader) Init(termsIn store.IndexInput) error {
@@ -209,6 +221,21 @@ func (r *Lucene41PostingsReader) Close() error {
 	return util.Close(r.docIn, r.posIn, r.payIn)
 }
 
+func (r *Lucene41PostingsReader) CheckIntegrity() error {
+	if r.version < LUCENE41_VERSION_CHECKSUM {
+		return nil
+	}
+	for _, in := range []store.IndexInput{r.docIn, r.posIn, r.payIn} {
+		if in == nil {
+			continue
+		}
+		if _, err := codec.ChecksumEntireFile(in.Clone()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 /* Reads but does not decode the byte[] blob holding
    metadata for the current terms block */
 func (r *Lucene41PostingsReader) ReadTermsBlock(termsIn store.IndexInput,
@@ -229,11 +256,11 @@ func (r *Lucene41PostingsReader) ReadTermsBlock(termsIn store.IndexInput,
 		termState.bytes = make([]byte, numBytes)
 	}
 
-	err = termsIn.ReadBytes(termState.bytes)
+	err = termsIn.ReadBytes(termState.bytes[:numBytes])
 	if err != nil {
 		return err
 	}
-	termState.bytesReader.Reset(termState.bytes)
+	termState.bytesReader.Reset(termState.bytes[:numBytes])
 	return nil
 }
 
@@ -475,7 +502,19 @@ func (de *blockDocsEnum) refillDocs() (err error) {
 
 	if left >= LUCENE41_BLOCK_SIZE {
 		log.Printf("    fill doc block from fp=%v", de.docIn.FilePointer())
-		panic("not implemented yet")
+		if err = de.forUtil.readBlock(de.docIn, de.encoded, de.docDeltaBuffer); err != nil {
+			return err
+		}
+		if de.indexHasFreq {
+			if de.needsFreq {
+				err = de.forUtil.readBlock(de.docIn, de.encoded, de.freqBuffer)
+			} else {
+				err = de.forUtil.skipBlock(de.docIn) // skip over freqs
+			}
+			if err != nil {
+				return err
+			}
+		}
 	} else if de.docFreq == 1 {
 		de.docDeltaBuffer[0] = de.singletonDocID
 		de.freqBuffer[0] = int(de.totalTermFreq)
@@ -522,6 +561,446 @@ func (de *blockDocsEnum) NextDoc() (n int, err error) {
 	}
 }
 
+func (r *Lucene41PostingsReader) docsAndPositions(fieldInfo model.FieldInfo,
+	termState *BlockTermState, liveDocs util.Bits,
+	reuse DocsAndPositionsEnum, flags int) (de DocsAndPositionsEnum, err error) {
+
+	var everything *everythingEnum
+	if v, ok := reuse.(*everythingEnum); ok {
+		everything = v
+		if !everything.canReuse(r.docIn, fieldInfo) {
+			everything = newEverythingEnum(r, fieldInfo)
+		}
+	} else {
+		everything = newEverythingEnum(r, fieldInfo)
+	}
+	return everything.reset(liveDocs, termState.Self.(*intBlockTermState), flags), nil
+}
+
+/*
+Also handles payloads and offsets. Unlike Lucene Java, the same enum
+is used whether offsets and payloads are requested or not. Skip data
+is not used yet, as advancing is not supported.
+*/
+type everythingEnum struct {
+	*Lucene41PostingsReader // embedded struct
+
+	encoded []byte
+
+	docDeltaBuffer []int
+	freqBuffer     []int
+	posDeltaBuffer []int
+
+	payloadLengthBuffer    []int
+	offsetStartDeltaBuffer []int
+	offsetLengthBuffer     []int
+
+	payloadBytes    []byte
+	payloadByteUpto int
+	payloadLength   int
+
+	lastStartOffset int
+	startOffset     int
+	endOffset       int
+
+	docBufferUpto int
+	posBufferUpto int
+
+	startDocIn store.IndexInput
+
+	docIn store.IndexInput
+	posIn store.IndexInput
+	payIn store.IndexInput
+
+	indexHasOffsets  bool
+	indexHasPayloads bool
+
+	docFreq       int
+	totalTermFreq int64
+	docUpto       int
+	doc           int
+	accum         int
+	freq          int
+	position      int
+
+	// how many positions "behind" we are; nextPosition must skip
+	// these to "catch up":
+	posPendingCount int
+
+	// Lazy pos seek: if != -1 then we must seek to this FP before
+	// reading positions:
+	posPendingFP int64
+
+	// Lazy pay seek: if != -1 then we must seek to this FP before
+	// reading payloads/offsets:
+	payPendingFP int64
+
+	// Where this term's postings start in the .doc file:
+	docTermStartFP int64
+
+	// File pointer where the last (vInt encoded) pos delta block is.
+	// We need this to know whether to bulk decode vs vInt decode the
+	// block:
+	lastPosBlockFP int64
+
+	liveDocs util.Bits
+
+	needsOffsets   bool // true if we actually need offsets
+	needsPayloads  bool // true if we actually need payloads
+	singletonDocID int  // docid when there is a single pulsed posting, otherwise -1
+}
+
+func newEverythingEnum(owner *Lucene41PostingsReader,
+	fieldInfo model.FieldInfo) *everythingEnum {
+
+	de := &everythingEnum{
+		Lucene41PostingsReader: owner,
+		encoded:                make([]byte, MAX_ENCODED_SIZE),
+		docDeltaBuffer:         make([]int, MAX_DATA_SIZE),
+		freqBuffer:             make([]int, MAX_DATA_SIZE),
+		posDeltaBuffer:         make([]int, MAX_DATA_SIZE),
+		startDocIn:             owner.docIn,
+		posIn:                  owner.posIn.Clone(),
+		indexHasOffsets:        fieldInfo.IndexOptions() >= model.INDEX_OPT_DOCS_AND_FREQS_AND_POSITIONS_AND_OFFSETS,
+		indexHasPayloads:       fieldInfo.HasPayloads(),
+		startOffset:            -1,
+		endOffset:              -1,
+	}
+	if owner.payIn != nil {
+		de.payIn = owner.payIn.Clone()
+	}
+	if de.indexHasOffsets {
+		de.offsetStartDeltaBuffer = make([]int, MAX_DATA_SIZE)
+		de.offsetLengthBuffer = make([]int, MAX_DATA_SIZE)
+	}
+	if de.indexHasPayloads {
+		de.payloadLengthBuffer = make([]int, MAX_DATA_SIZE)
+		de.payloadBytes = make([]byte, 128)
+	}
+	return de
+}
+
+func (de *everythingEnum) canReuse(docIn store.IndexInput, fieldInfo model.FieldInfo) bool {
+	return docIn == de.startDocIn &&
+		de.indexHasOffsets == (fieldInfo.IndexOptions() >= model.INDEX_OPT_DOCS_AND_FREQS_AND_POSITIONS_AND_OFFSETS) &&
+		de.indexHasPayloads == fieldInfo.HasPayloads()
+}
+
+func (de *everythingEnum) reset(liveDocs util.Bits, termState *intBlockTermState, flags int) DocsAndPositionsEnum {
+	de.liveDocs = liveDocs
+	de.docFreq = termState.docFreq
+	de.docTermStartFP = termState.docStartFP
+	de.totalTermFreq = termState.totalTermFreq
+	de.singletonDocID = termState.singletonDocID
+	if de.docFreq > 1 && de.docIn == nil {
+		// lazy init
+		de.docIn = de.startDocIn.Clone()
+	}
+	de.posPendingFP = termState.posStartFP
+	de.payPendingFP = termState.payStartFP
+	de.posPendingCount = 0
+	switch {
+	case termState.totalTermFreq < LUCENE41_BLOCK_SIZE:
+		de.lastPosBlockFP = termState.posStartFP
+	case termState.totalTermFreq == LUCENE41_BLOCK_SIZE:
+		de.lastPosBlockFP = -1
+	default:
+		de.lastPosBlockFP = termState.posStartFP + termState.lastPosBlockOffset
+	}
+
+	de.needsOffsets = (flags & DOCS_POSITIONS_ENUM_FLAG_OFF_SETS) != 0
+	de.needsPayloads = (flags & DOCS_POSITIONS_ENUM_FLAG_PAYLOADS) != 0
+
+	de.doc = -1
+	de.accum = 0
+	de.docUpto = 0
+	de.docBufferUpto = LUCENE41_BLOCK_SIZE
+	de.payloadLength = 0
+	return de
+}
+
+func (de *everythingEnum) Freq() (n int, err error) {
+	return de.freq, nil
+}
+
+func (de *everythingEnum) DocId() int {
+	return de.doc
+}
+
+func (de *everythingEnum) refillDocs() (err error) {
+	left := de.docFreq - de.docUpto
+	assert(left > 0)
+
+	if left >= LUCENE41_BLOCK_SIZE {
+		if err = de.forUtil.readBlock(de.docIn, de.encoded, de.docDeltaBuffer); err == nil {
+			err = de.forUtil.readBlock(de.docIn, de.encoded, de.freqBuffer)
+		}
+	} else if de.docFreq == 1 {
+		de.docDeltaBuffer[0] = de.singletonDocID
+		de.freqBuffer[0] = int(de.totalTermFreq)
+	} else {
+		err = readVIntBlock(de.docIn, de.docDeltaBuffer, de.freqBuffer, left, true)
+	}
+	de.docBufferUpto = 0
+	return
+}
+
+func (de *everythingEnum) refillPositions() (err error) {
+	if de.posIn.FilePointer() == de.lastPosBlockFP {
+		count := int(de.totalTermFreq % LUCENE41_BLOCK_SIZE)
+		payloadLength, offsetLength := 0, 0
+		de.payloadByteUpto = 0
+		for i := 0; i < count; i++ {
+			code, err := asInt(de.posIn.ReadVInt())
+			if err != nil {
+				return err
+			}
+			if de.indexHasPayloads {
+				if (code & 1) != 0 {
+					if payloadLength, err = asInt(de.posIn.ReadVInt()); err != nil {
+						return err
+					}
+				}
+				de.payloadLengthBuffer[i] = payloadLength
+				de.posDeltaBuffer[i] = int(uint(code) >> 1)
+				if payloadLength != 0 {
+					if de.payloadByteUpto+payloadLength > len(de.payloadBytes) {
+						next := make([]byte, util.Oversize(de.payloadByteUpto+payloadLength, 1))
+						copy(next, de.payloadBytes[:de.payloadByteUpto])
+						de.payloadBytes = next
+					}
+					err = de.posIn.ReadBytes(de.payloadBytes[de.payloadByteUpto : de.payloadByteUpto+payloadLength])
+					if err != nil {
+						return err
+					}
+					de.payloadByteUpto += payloadLength
+				}
+			} else {
+				de.posDeltaBuffer[i] = code
+			}
+
+			if de.indexHasOffsets {
+				deltaCode, err := asInt(de.posIn.ReadVInt())
+				if err != nil {
+					return err
+				}
+				if (deltaCode & 1) != 0 {
+					if offsetLength, err = asInt(de.posIn.ReadVInt()); err != nil {
+						return err
+					}
+				}
+				de.offsetStartDeltaBuffer[i] = int(uint(deltaCode) >> 1)
+				de.offsetLengthBuffer[i] = offsetLength
+			}
+		}
+		de.payloadByteUpto = 0
+		return nil
+	}
+
+	if err = de.forUtil.readBlock(de.posIn, de.encoded, de.posDeltaBuffer); err != nil {
+		return err
+	}
+	if de.indexHasPayloads {
+		if de.needsPayloads {
+			err = de.forUtil.readBlock(de.payIn, de.encoded, de.payloadLengthBuffer)
+		} else {
+			// this works, because when writing a vint block we always
+			// force the first length to be written
+			err = de.forUtil.skipBlock(de.payIn) // skip over lengths
+		}
+		if err != nil {
+			return err
+		}
+		numBytes, err := asInt(de.payIn.ReadVInt()) // read length of payloadBytes
+		if err != nil {
+			return err
+		}
+		if de.needsPayloads {
+			if numBytes > len(de.payloadBytes) {
+				de.payloadBytes = make([]byte, util.Oversize(numBytes, 1))
+			}
+			err = de.payIn.ReadBytes(de.payloadBytes[:numBytes])
+		} else {
+			err = de.payIn.Seek(de.payIn.FilePointer() + int64(numBytes)) // skip over payloadBytes
+		}
+		if err != nil {
+			return err
+		}
+		de.payloadByteUpto = 0
+	}
+	if de.indexHasOffsets {
+		if de.needsOffsets {
+			if err = de.forUtil.readBlock(de.payIn, de.encoded, de.offsetStartDeltaBuffer); err == nil {
+				err = de.forUtil.readBlock(de.payIn, de.encoded, de.offsetLengthBuffer)
+			}
+		} else {
+			// skip over starts and lengths
+			if err = de.forUtil.skipBlock(de.payIn); err == nil {
+				err = de.forUtil.skipBlock(de.payIn)
+			}
+		}
+	}
+	return err
+}
+
+func (de *everythingEnum) NextDoc() (n int, err error) {
+	if de.doc == -1 && de.docFreq > 1 {
+		// lazy seek, on first call
+		if err = de.docIn.Seek(de.docTermStartFP); err != nil {
+			return 0, err
+		}
+	}
+	for {
+		if de.docUpto == de.docFreq {
+			de.doc = NO_MORE_DOCS
+			return de.doc, nil
+		}
+		if de.docBufferUpto == LUCENE41_BLOCK_SIZE {
+			if err = de.refillDocs(); err != nil {
+				return 0, err
+			}
+		}
+
+		de.accum += de.docDeltaBuffer[de.docBufferUpto]
+		de.freq = de.freqBuffer[de.docBufferUpto]
+		de.posPendingCount += de.freq
+		de.docBufferUpto++
+		de.docUpto++
+
+		if de.liveDocs == nil || de.liveDocs.At(de.accum) {
+			de.doc = de.accum
+			de.position = 0
+			de.lastStartOffset = 0
+			return de.doc, nil
+		}
+	}
+}
+
+// TODO: in theory we could avoid loading frq block when not needed,
+// ie, use skip data to load how far to seek the pos pointer ... instead
+// of having to load frq blocks for the first time
+func (de *everythingEnum) skipPositions() error {
+	// Skip positions now:
+	toSkip := de.posPendingCount - de.freq
+
+	leftInBlock := LUCENE41_BLOCK_SIZE - de.posBufferUpto
+	if toSkip < leftInBlock {
+		end := de.posBufferUpto + toSkip
+		for ; de.posBufferUpto < end; de.posBufferUpto++ {
+			if de.indexHasPayloads {
+				de.payloadByteUpto += de.payloadLengthBuffer[de.posBufferUpto]
+			}
+		}
+	} else {
+		toSkip -= leftInBlock
+		for ; toSkip >= LUCENE41_BLOCK_SIZE; toSkip -= LUCENE41_BLOCK_SIZE {
+			assert(de.posIn.FilePointer() != de.lastPosBlockFP)
+			if err := de.forUtil.skipBlock(de.posIn); err != nil {
+				return err
+			}
+			if de.indexHasPayloads {
+				// Skip payloadLength block:
+				if err := de.forUtil.skipBlock(de.payIn); err != nil {
+					return err
+				}
+				// Skip payloadBytes block:
+				numBytes, err := asInt(de.payIn.ReadVInt())
+				if err != nil {
+					return err
+				}
+				if err = de.payIn.Seek(de.payIn.FilePointer() + int64(numBytes)); err != nil {
+					return err
+				}
+			}
+			if de.indexHasOffsets {
+				if err := de.forUtil.skipBlock(de.payIn); err != nil {
+					return err
+				}
+				if err := de.forUtil.skipBlock(de.payIn); err != nil {
+					return err
+				}
+			}
+		}
+		if err := de.refillPositions(); err != nil {
+			return err
+		}
+		de.payloadByteUpto = 0
+		for de.posBufferUpto = 0; de.posBufferUpto < toSkip; de.posBufferUpto++ {
+			if de.indexHasPayloads {
+				de.payloadByteUpto += de.payloadLengthBuffer[de.posBufferUpto]
+			}
+		}
+	}
+
+	de.position = 0
+	de.lastStartOffset = 0
+	return nil
+}
+
+func (de *everythingEnum) NextPosition() (int, error) {
+	if de.posPendingFP != -1 {
+		if err := de.posIn.Seek(de.posPendingFP); err != nil {
+			return 0, err
+		}
+		de.posPendingFP = -1
+
+		if de.payPendingFP != -1 {
+			if err := de.payIn.Seek(de.payPendingFP); err != nil {
+				return 0, err
+			}
+			de.payPendingFP = -1
+		}
+
+		// Force buffer refill:
+		de.posBufferUpto = LUCENE41_BLOCK_SIZE
+	}
+
+	if de.posPendingCount > de.freq {
+		if err := de.skipPositions(); err != nil {
+			return 0, err
+		}
+		de.posPendingCount = de.freq
+	}
+
+	if de.posBufferUpto == LUCENE41_BLOCK_SIZE {
+		if err := de.refillPositions(); err != nil {
+			return 0, err
+		}
+		de.posBufferUpto = 0
+	}
+	de.position += de.posDeltaBuffer[de.posBufferUpto]
+
+	if de.indexHasPayloads {
+		de.payloadLength = de.payloadLengthBuffer[de.posBufferUpto]
+		de.payloadByteUpto += de.payloadLength
+	}
+
+	if de.indexHasOffsets {
+		de.startOffset = de.lastStartOffset + de.offsetStartDeltaBuffer[de.posBufferUpto]
+		de.endOffset = de.startOffset + de.offsetLengthBuffer[de.posBufferUpto]
+		de.lastStartOffset = de.startOffset
+	}
+
+	de.posBufferUpto++
+	de.posPendingCount--
+	return de.position, nil
+}
+
+func (de *everythingEnum) StartOffset() (int, error) {
+	return de.startOffset, nil
+}
+
+func (de *everythingEnum) EndOffset() (int, error) {
+	return de.endOffset, nil
+}
+
+func (de *everythingEnum) Payload() ([]byte, error) {
+	if de.payloadLength == 0 {
+		return nil, nil
+	}
+	return de.payloadBytes[de.payloadByteUpto-de.payloadLength : de.payloadByteUpto], nil
+}
+
 type intBlockTermState struct {
 	*BlockTermState
 	docStartFP         int64
@@ -709,31 +1188,32 @@ func newLucene41StoredFieldsReader(d store.Directory,
 // codec/compressing/CompressingStoredFieldsReader.java
 
 const (
-	STRING         = 0
-	BYTE_ARR       = 1
-	NUMERIC_INT    = 2
-	NUMERIC_FLOAT  = 3
-	NUMERIC_LONG   = 4
-	NUMERIC_DOUBLE = 5
+	STRING         = compressing.STRING
+	BYTE_ARR       = compressing.BYTE_ARR
+	NUMERIC_INT    = compressing.NUMERIC_INT
+	NUMERIC_FLOAT  = compressing.NUMERIC_FLOAT
+	NUMERIC_LONG   = compressing.NUMERIC_LONG
+	NUMERIC_DOUBLE = compressing.NUMERIC_DOUBLE
 )
 
 var (
-	TYPE_BITS = packed.BitsRequired(NUMERIC_DOUBLE)
-	TYPE_MASK = int(packed.MaxValue(TYPE_BITS))
+	TYPE_BITS = compressing.TYPE_BITS
+	TYPE_MASK = compressing.TYPE_MASK
 )
 
 const (
-	CSFR_VERSION_BIG_CHUNKS = 1
+	CSFR_VERSION_BIG_CHUNKS = compressing.CP_VERSION_BIG_CHUNKS
+	CSFR_VERSION_CHECKSUM   = compressing.CP_VERSION_CHECKSUM
 
 	// Do not reuse the decompression buffer when there is more than 32kb to decompress
 	BUFFER_REUSE_THRESHOLD = 1 << 15
 )
 
 const (
-	CODEC_SFX_IDX             = "Index"
-	CODEC_SFX_DAT             = "Data"
-	CODEC_SFX_VERSION_START   = 0
-	CODEC_SFX_VERSION_CURRENT = CODEC_SFX_VERSION_START
+	CODEC_SFX_IDX             = compressing.CODEC_SFX_IDX
+	CODEC_SFX_DAT             = compressing.CODEC_SFX_DAT
+	CODEC_SFX_VERSION_START   = compressing.CP_VERSION_START
+	CODEC_SFX_VERSION_CURRENT = compressing.CP_VERSION_CURRENT
 )
 
 // StoredFieldsReader impl for CompressingStoredFieldsFormat
@@ -741,6 +1221,7 @@ type CompressingStoredFieldsReader struct {
 	version           int
 	fieldInfos        model.FieldInfos
 	indexReader       *CompressingStoredFieldsIndexReader
+	maxPointer        int64
 	fieldsStream      store.IndexInput
 	chunkSize         int
 	packedIntsVersion int
@@ -758,6 +1239,7 @@ func newCompressingStoredFieldsReaderFrom(reader *CompressingStoredFieldsReader)
 		fieldInfos:        reader.fieldInfos,
 		fieldsStream:      reader.fieldsStream.Clone(),
 		indexReader:       reader.indexReader.Clone(),
+		maxPointer:        reader.maxPointer,
 		chunkSize:         reader.chunkSize,
 		packedIntsVersion: reader.packedIntsVersion,
 		compressionMode:   reader.compressionMode,
@@ -780,7 +1262,7 @@ func newCompressingStoredFieldsReader(d store.Directory,
 	r.fieldInfos = fn
 	r.numDocs = si.DocCount()
 
-	var indexStream store.IndexInput
+	var indexStream *store.ChecksumIndexInput
 	success := false
 	defer func() {
 		if !success {
@@ -788,18 +1270,27 @@ func newCompressingStoredFieldsReader(d store.Directory,
 			if err != nil {
 				log.Print(err)
 			}
-			util.Close(r, indexStream)
+			if indexStream != nil {
+				util.Close(r, indexStream)
+			} else {
+				util.Close(r)
+			}
 		}
 	}()
 
 	// Load the index into memory
 	indexStreamFN := util.SegmentFileName(segment, segmentSuffix, lucene40.FIELDS_INDEX_EXTENSION)
-	indexStream, err = d.OpenInput(indexStreamFN, ctx)
+	in, err := d.OpenInput(indexStreamFN, ctx)
 	if err != nil {
 		return nil, err
 	}
+	indexStream = store.NewChecksumIndexInput(in)
 	codecNameIdx := formatName + CODEC_SFX_IDX
-	codec.CheckHeader(indexStream, codecNameIdx, CODEC_SFX_VERSION_START, CODEC_SFX_VERSION_CURRENT)
+	version, err := codec.CheckHeader(indexStream, codecNameIdx, CODEC_SFX_VERSION_START, CODEC_SFX_VERSION_CURRENT)
+	if err != nil {
+		return nil, err
+	}
+	r.version = int(version)
 	if int64(codec.HeaderLength(codecNameIdx)) != indexStream.FilePointer() {
 		panic("assert fail")
 	}
@@ -807,6 +1298,14 @@ func newCompressingStoredFieldsReader(d store.Directory,
 	if err != nil {
 		return nil, err
 	}
+	if r.version >= CSFR_VERSION_CHECKSUM {
+		if r.maxPointer, err = indexStream.ReadVLong(); err != nil {
+			return nil, err
+		}
+		if _, err = codec.CheckFooter(indexStream); err != nil {
+			return nil, err
+		}
+	}
 	err = indexStream.Close()
 	if err != nil {
 		return nil, err
@@ -820,11 +1319,36 @@ func newCompressingStoredFieldsReader(d store.Directory,
 		return nil, err
 	}
 	codecNameDat := formatName + CODEC_SFX_DAT
-	codec.CheckHeader(r.fieldsStream, codecNameDat, CODEC_SFX_VERSION_START, CODEC_SFX_VERSION_CURRENT)
+	fieldsVersion, err := codec.CheckHeader(r.fieldsStream, codecNameDat, CODEC_SFX_VERSION_START, CODEC_SFX_VERSION_CURRENT)
+	if err != nil {
+		return nil, err
+	}
+	if r.version != int(fieldsVersion) {
+		return nil, codec.NewCorruptIndexErrorAt(r.fieldsStream, fmt.Sprintf(
+			"Version mismatch between stored fields index and data: %v != %v",
+			r.version, fieldsVersion))
+	}
 	if int64(codec.HeaderLength(codecNameDat)) != r.fieldsStream.FilePointer() {
 		panic("assert fail")
 	}
 
+	if r.version >= CSFR_VERSION_CHECKSUM {
+		if r.maxPointer+int64(codec.FooterLength()) != r.fieldsStream.Length() {
+			return nil, codec.NewCorruptIndexErrorAt(r.fieldsStream, fmt.Sprintf(
+				"Invalid fieldsStream maxPointer (file truncated?): maxPointer=%v, length=%v",
+				r.maxPointer, r.fieldsStream.Length()))
+		}
+	} else {
+		r.maxPointer = r.fieldsStream.Length()
+	}
+
+	if r.version >= CSFR_VERSION_BIG_CHUNKS {
+		if r.chunkSize, err = asInt(r.fieldsStream.ReadVInt()); err != nil {
+			return nil, err
+		}
+	} else {
+		r.chunkSize = -1
+	}
 	n, err := r.fieldsStream.ReadVInt()
 	if err != nil {
 		return nil, err
@@ -851,11 +1375,27 @@ func (r *CompressingStoredFieldsReader) Close() (err error) {
 	return
 }
 
+func (r *CompressingStoredFieldsReader) CheckIntegrity() error {
+	if r.version >= CSFR_VERSION_CHECKSUM {
+		_, err := codec.ChecksumEntireFile(r.fieldsStream.Clone())
+		return err
+	}
+	return nil
+}
+
 func (r *CompressingStoredFieldsReader) readField(in util.DataInput,
 	visitor StoredFieldVisitor, info model.FieldInfo, bits int) error {
 	switch bits & TYPE_MASK {
 	case BYTE_ARR:
-		panic("not implemented yet")
+		length, err := asInt(in.ReadVInt())
+		if err != nil {
+			return err
+		}
+		data := make([]byte, length)
+		if err = in.ReadBytes(data); err != nil {
+			return err
+		}
+		return visitor.binaryField(info, data)
 	case STRING:
 		length, err := asInt(in.ReadVInt())
 		if err != nil {
@@ -866,19 +1406,51 @@ func (r *CompressingStoredFieldsReader) readField(in util.DataInput,
 		if err != nil {
 			return err
 		}
-		visitor.stringField(info, string(data))
+		return visitor.stringField(info, string(data))
 	case NUMERIC_INT:
-		panic("not implemented yet")
+		n, err := in.ReadInt()
+		if err != nil {
+			return err
+		}
+		return visitor.intField(info, int(n))
 	case NUMERIC_FLOAT:
-		panic("not implemented yet")
+		n, err := in.ReadInt()
+		if err != nil {
+			return err
+		}
+		return visitor.floatField(info, math.Float32frombits(uint32(n)))
 	case NUMERIC_LONG:
-		panic("not implemented yet")
+		n, err := in.ReadLong()
+		if err != nil {
+			return err
+		}
+		return visitor.longField(info, n)
 	case NUMERIC_DOUBLE:
-		panic("not implemented yet")
+		n, err := in.ReadLong()
+		if err != nil {
+			return err
+		}
+		return visitor.doubleField(info, math.Float64frombits(uint64(n)))
 	default:
-		panic(fmt.Sprintf("Unknown type flag: %x", bits))
+		return codec.NewCorruptIndexErrorAt(in, fmt.Sprintf("Unknown type flag: %x", bits))
 	}
-	return nil
+}
+
+func skipField(in util.DataInput, bits int) (err error) {
+	switch bits & TYPE_MASK {
+	case BYTE_ARR, STRING:
+		var length int
+		if length, err = asInt(in.ReadVInt()); err == nil {
+			err = in.ReadBytes(make([]byte, length))
+		}
+	case NUMERIC_INT, NUMERIC_FLOAT:
+		_, err = in.ReadInt()
+	case NUMERIC_LONG, NUMERIC_DOUBLE:
+		_, err = in.ReadLong()
+	default:
+		err = codec.NewCorruptIndexErrorAt(in, fmt.Sprintf("Unknown type flag: %x", bits))
+	}
+	return
 }
 
 func (r *CompressingStoredFieldsReader) visitDocument(docID int, visitor StoredFieldVisitor) error {
@@ -898,14 +1470,21 @@ func (r *CompressingStoredFieldsReader) visitDocument(docID int, visitor StoredF
 	if docID < docBase ||
 		docID >= docBase+chunkDocs ||
 		docBase+chunkDocs > r.numDocs {
-		return errors.New(fmt.Sprintf(
-			"Corrupted: docID=%v, docBase=%v, chunkDocs=%v, numDocs=%v (resource=%v)",
-			docID, docBase, chunkDocs, r.numDocs, r.fieldsStream))
+		return codec.NewCorruptIndexErrorAt(r.fieldsStream, fmt.Sprintf(
+			"Corrupted: docID=%v, docBase=%v, chunkDocs=%v, numDocs=%v",
+			docID, docBase, chunkDocs, r.numDocs))
 	}
 
 	var numStoredFields, offset, length, totalLength int
 	if chunkDocs == 1 {
-		panic("not implemented yet")
+		if numStoredFields, err = asInt(r.fieldsStream.ReadVInt()); err != nil {
+			return err
+		}
+		offset = 0
+		if length, err = asInt(r.fieldsStream.ReadVInt()); err != nil {
+			return err
+		}
+		totalLength = length
 	} else {
 		bitsPerStoredFields, err := asInt(r.fieldsStream.ReadVInt())
 		if err != nil {
@@ -917,10 +1496,22 @@ func (r *CompressingStoredFieldsReader) visitDocument(docID int, visitor StoredF
 				return err
 			}
 		} else if bitsPerStoredFields > 31 {
-			return errors.New(fmt.Sprintf("bitsPerStoredFields=%v (resource=%v)",
-				bitsPerStoredFields, r.fieldsStream))
+			return codec.NewCorruptIndexErrorAt(r.fieldsStream, fmt.Sprintf(
+				"bitsPerStoredFields=%v", bitsPerStoredFields))
 		} else {
-			panic("not implemented yet")
+			filePointer := r.fieldsStream.FilePointer()
+			reader, err := packed.NewPackedReaderNoHeader(r.fieldsStream,
+				packed.PackedFormat(packed.PACKED), int32(r.packedIntsVersion),
+				int32(chunkDocs), uint32(bitsPerStoredFields))
+			if err != nil {
+				return err
+			}
+			numStoredFields = int(reader.Get(docID - docBase))
+			err = r.fieldsStream.Seek(filePointer + packed.PackedFormat(packed.PACKED).ByteCount(
+				int32(r.packedIntsVersion), int32(chunkDocs), uint32(bitsPerStoredFields)))
+			if err != nil {
+				return err
+			}
 		}
 
 		bitsPerLength, err := asInt(r.fieldsStream.ReadVInt())
@@ -928,10 +1519,14 @@ func (r *CompressingStoredFieldsReader) visitDocument(docID int, visitor StoredF
 			return err
 		}
 		if bitsPerLength == 0 {
-			panic("not implemented yet")
+			if length, err = asInt(r.fieldsStream.ReadVInt()); err != nil {
+				return err
+			}
+			offset = (docID - docBase) * length
+			totalLength = chunkDocs * length
 		} else if bitsPerLength > 31 {
-			return errors.New(fmt.Sprintf("bitsPerLength=%v (resource=%v)",
-				bitsPerLength, r.fieldsStream))
+			return codec.NewCorruptIndexErrorAt(r.fieldsStream, fmt.Sprintf(
+				"bitsPerLength=%v", bitsPerLength))
 		} else {
 			it := packed.ReaderIteratorNoHeader(
 				r.fieldsStream, packed.PackedFormat(packed.PACKED), r.packedIntsVersion,
@@ -961,9 +1556,9 @@ func (r *CompressingStoredFieldsReader) visitDocument(docID int, visitor StoredF
 	}
 
 	if (length == 0) != (numStoredFields == 0) {
-		return errors.New(fmt.Sprintf(
-			"length=%v, numStoredFields=%v (resource=%v)",
-			length, numStoredFields, r.fieldsStream))
+		return codec.NewCorruptIndexErrorAt(r.fieldsStream, fmt.Sprintf(
+			"length=%v, numStoredFields=%v",
+			length, numStoredFields))
 	}
 	if numStoredFields == 0 {
 		// nothing to do
@@ -972,7 +1567,30 @@ func (r *CompressingStoredFieldsReader) visitDocument(docID int, visitor StoredF
 
 	var documentInput util.DataInput
 	if r.version >= CSFR_VERSION_BIG_CHUNKS && totalLength >= 2*r.chunkSize {
-		panic("not implemented yet")
+		assert(r.chunkSize > 0)
+		assert(offset < r.chunkSize)
+		// the chunk was compressed in slices of chunkSize bytes, and the
+		// document starts in the first one
+		toDecompress := length
+		if r.chunkSize-offset < toDecompress {
+			toDecompress = r.chunkSize - offset
+		}
+		bytes, err := r.decompressor(r.fieldsStream, r.chunkSize, offset, toDecompress, nil)
+		if err != nil {
+			return err
+		}
+		doc := append(make([]byte, 0, length), bytes...)
+		for len(doc) < length {
+			toDecompress = length - len(doc)
+			if r.chunkSize < toDecompress {
+				toDecompress = r.chunkSize
+			}
+			if bytes, err = r.decompressor(r.fieldsStream, r.chunkSize, 0, toDecompress, nil); err != nil {
+				return err
+			}
+			doc = append(doc, bytes...)
+		}
+		documentInput = store.NewByteArrayDataInput(doc)
 	} else {
 		var bytes []byte
 		if totalLength <= BUFFER_REUSE_THRESHOLD {
@@ -1005,12 +1623,15 @@ func (r *CompressingStoredFieldsReader) visitDocument(docID int, visitor StoredF
 		}
 		switch status {
 		case STORED_FIELD_VISITOR_STATUS_YES:
-			r.readField(documentInput, visitor, fieldInfo, bits)
+			err = r.readField(documentInput, visitor, fieldInfo, bits)
 		case STORED_FIELD_VISITOR_STATUS_NO:
-			panic("not implemented yet")
+			err = skipField(documentInput, bits)
 		case STORED_FIELD_VISITOR_STATUS_STOP:
 			return nil
 		}
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -1027,6 +1648,152 @@ func (r *CompressingStoredFieldsReader) Clone() StoredFieldsReader {
 	return newCompressingStoredFieldsReaderFrom(r)
 }
 
+/*
+Returns a chunkIterator, used by the CompressingStoredFieldsWriter to
+merge chunks without decompressing them when possible.
+*/
+func (r *CompressingStoredFieldsReader) chunkIterator() *chunkIterator {
+	r.ensureOpen()
+	return &chunkIterator{
+		owner:           r,
+		docBase:         -1,
+		numStoredFields: make([]int, 1),
+		lengths:         make([]int, 1),
+	}
+}
+
+// Iterates over the chunks of a CompressingStoredFieldsReader.
+type chunkIterator struct {
+	owner           *CompressingStoredFieldsReader
+	bytes           []byte
+	docBase         int
+	chunkDocs       int
+	numStoredFields []int
+	lengths         []int
+}
+
+// Returns the decompressed size of the chunk
+func (it *chunkIterator) chunkSize() int {
+	sum := 0
+	for _, v := range it.lengths[:it.chunkDocs] {
+		sum += v
+	}
+	return sum
+}
+
+func (it *chunkIterator) readInts(values []int) error {
+	in := it.owner.fieldsStream
+	bitsPerValue, err := asInt(in.ReadVInt())
+	if err != nil {
+		return err
+	}
+	if bitsPerValue == 0 {
+		v, err := asInt(in.ReadVInt())
+		if err != nil {
+			return err
+		}
+		for i, _ := range values {
+			values[i] = v
+		}
+		return nil
+	} else if bitsPerValue > 31 {
+		return codec.NewCorruptIndexErrorAt(in, fmt.Sprintf("bitsPerValue=%v", bitsPerValue))
+	}
+	pit := packed.ReaderIteratorNoHeader(in, packed.PackedFormat(packed.PACKED),
+		it.owner.packedIntsVersion, len(values), bitsPerValue, 1)
+	for i, _ := range values {
+		v, err := pit.Next()
+		if err != nil {
+			return err
+		}
+		values[i] = int(v)
+	}
+	return nil
+}
+
+// Go to the chunk containing the provided doc ID.
+func (it *chunkIterator) next(doc int) (err error) {
+	assert(doc >= it.docBase+it.chunkDocs)
+	in := it.owner.fieldsStream
+	if err = in.Seek(it.owner.indexReader.startPointer(doc)); err != nil {
+		return err
+	}
+
+	docBase, err := asInt(in.ReadVInt())
+	if err != nil {
+		return err
+	}
+	chunkDocs, err := asInt(in.ReadVInt())
+	if err != nil {
+		return err
+	}
+	if docBase < it.docBase+it.chunkDocs || docBase+chunkDocs > it.owner.numDocs {
+		return codec.NewCorruptIndexErrorAt(in, fmt.Sprintf(
+			"Corrupted: current docBase=%v, current numDocs=%v, new docBase=%v, new numDocs=%v",
+			it.docBase, it.chunkDocs, docBase, chunkDocs))
+	}
+	it.docBase, it.chunkDocs = docBase, chunkDocs
+
+	if chunkDocs > len(it.numStoredFields) {
+		newLength := util.Oversize(chunkDocs, 4)
+		it.numStoredFields = make([]int, newLength)
+		it.lengths = make([]int, newLength)
+	}
+
+	if chunkDocs == 1 {
+		if it.numStoredFields[0], err = asInt(in.ReadVInt()); err == nil {
+			it.lengths[0], err = asInt(in.ReadVInt())
+		}
+		return err
+	}
+	if err = it.readInts(it.numStoredFields[:chunkDocs]); err == nil {
+		err = it.readInts(it.lengths[:chunkDocs])
+	}
+	return err
+}
+
+// Decompress the chunk.
+func (it *chunkIterator) decompress() (err error) {
+	r := it.owner
+	chunkSize := it.chunkSize()
+	if r.version >= CSFR_VERSION_BIG_CHUNKS && chunkSize >= 2*r.chunkSize {
+		it.bytes = it.bytes[:0]
+		for decompressed := 0; decompressed < chunkSize; {
+			toDecompress := chunkSize - decompressed
+			if r.chunkSize < toDecompress {
+				toDecompress = r.chunkSize
+			}
+			spare, err := r.decompressor(r.fieldsStream, toDecompress, 0, toDecompress, nil)
+			if err != nil {
+				return err
+			}
+			it.bytes = append(it.bytes, spare...)
+			decompressed += toDecompress
+		}
+	} else if it.bytes, err = r.decompressor(r.fieldsStream, chunkSize, 0, chunkSize, it.bytes); err != nil {
+		return err
+	}
+	if len(it.bytes) != chunkSize {
+		return codec.NewCorruptIndexErrorAt(r.fieldsStream, fmt.Sprintf(
+			"Corrupted: expected chunk size = %v, got %v",
+			chunkSize, len(it.bytes)))
+	}
+	return nil
+}
+
+// Returns the length of the compressed data of the current chunk,
+// starting from the current position of the underlying stream.
+func (it *chunkIterator) compressedLength() int64 {
+	r := it.owner
+	var chunkEnd int64
+	if it.docBase+it.chunkDocs == r.numDocs {
+		chunkEnd = r.maxPointer
+	} else {
+		chunkEnd = r.indexReader.startPointer(it.docBase + it.chunkDocs)
+	}
+	return chunkEnd - r.fieldsStream.FilePointer()
+}
+
 // codec/compressing/CompressingStoredFieldsIndexReader.java
 
 func moveLowOrderBitsToSign(n int64) int64 {
@@ -1044,7 +1811,7 @@ type CompressingStoredFieldsIndexReader struct {
 	startPointersDeltas []packed.PackedIntsReader
 }
 
-func newCompressingStoredFieldsIndexReader(fieldsIndexIn store.IndexInput,
+func newCompressingStoredFieldsIndexReader(fieldsIndexIn util.DataInput,
 	si *model.SegmentInfo) (r *CompressingStoredFieldsIndexReader, err error) {
 
 	r = &CompressingStoredFieldsIndexReader{}
@@ -1086,7 +1853,7 @@ func newCompressingStoredFieldsIndexReader(fieldsIndexIn store.IndexInput,
 				return nil, err
 			}
 			if bitsPerDocBase > 32 {
-				return nil, errors.New(fmt.Sprintf("Corrupted bitsPerDocBase (resource=%v)", fieldsIndexIn))
+				return nil, codec.NewCorruptIndexErrorAt(fieldsIndexIn, "Corrupted bitsPerDocBase")
 			}
 			pr, err := packed.NewPackedReaderNoHeader(fieldsIndexIn, packed.PACKED, packedIntsVersion, numChunks, uint32(bitsPerDocBase))
 			if err != nil {
@@ -1111,7 +1878,7 @@ func newCompressingStoredFieldsIndexReader(fieldsIndexIn store.IndexInput,
 				return nil, err
 			}
 			if bitsPerStartPointer > 64 {
-				return nil, errors.New(fmt.Sprintf("Corrupted bitsPerStartPonter (resource=%v)", fieldsIndexIn))
+				return nil, codec.NewCorruptIndexErrorAt(fieldsIndexIn, "Corrupted bitsPerStartPonter")
 			}
 			pr, err := packed.NewPackedReaderNoHeader(fieldsIndexIn, packed.PACKED, packedIntsVersion, numChunks, uint32(bitsPerStartPointer))
 			if err != nil {
@@ -1,6 +1,8 @@
 package index
 
 import (
+	"github.com/balzaczyy/golucene/core/store"
+	"github.com/balzaczyy/golucene/core/util"
 	"github.com/balzaczyy/golucene/core/util/packed"
 	"math"
 )
@@ -94,6 +96,36 @@ func NewForUtil(in DataInput) (fu ForUtil, err error) {
 	return self, nil
 }
 
+/*
+Create a new ForUtil instance and save state into out.
+*/
+func NewForUtilInto(acceptableOverheadRatio float32, out util.DataOutput) (fu ForUtil, err error) {
+	self := ForUtil{}
+	if err = out.WriteVInt(packed.VERSION_CURRENT); err != nil {
+		return self, err
+	}
+	self.encodedSizes = make([]int32, 33)
+	self.encoders = make([]packed.PackedIntsEncoder, 33)
+	self.decoders = make([]packed.PackedIntsDecoder, 33)
+	self.iterations = make([]int32, 33)
+
+	for bpv := 1; bpv <= 32; bpv++ {
+		formatAndBits := packed.FastestFormatAndBits(LUCENE41_BLOCK_SIZE, bpv, acceptableOverheadRatio)
+		format, bitsPerValue := formatAndBits.Format, formatAndBits.BitsPerValue
+		assert(format.IsSupported(bitsPerValue))
+		assert(bitsPerValue <= 32)
+		self.encodedSizes[bpv] = encodedSize(format, packed.VERSION_CURRENT, bitsPerValue)
+		self.encoders[bpv] = packed.GetPackedIntsEncoder(format, packed.VERSION_CURRENT, bitsPerValue)
+		self.decoders[bpv] = packed.GetPackedIntsDecoder(format, packed.VERSION_CURRENT, bitsPerValue)
+		self.iterations[bpv] = computeIterations(self.decoders[bpv])
+
+		if err = out.WriteVInt(int32(format)<<5 | int32(bitsPerValue-1)); err != nil {
+			return self, err
+		}
+	}
+	return self, nil
+}
+
 func encodedSize(format packed.PackedFormat, packedIntsVersion int32, bitsPerValue uint32) int32 {
 	byteCount := format.ByteCount(packedIntsVersion, LUCENE41_BLOCK_SIZE, bitsPerValue)
 	// assert byteCount >= 0 && byteCount <= math.MaxInt32()
@@ -103,3 +135,105 @@ func encodedSize(format packed.PackedFormat, packedIntsVersion int32, bitsPerVal
 func computeIterations(decoder packed.PackedIntsDecoder) int32 {
 	return int32(math.Ceil(float64(LUCENE41_BLOCK_SIZE) / float64(decoder.ByteValueCount())))
 }
+
+/*
+Write a block of data (For format).
+*/
+func (fu ForUtil) writeBlock(data []int, encoded []byte, out store.IndexOutput) error {
+	if isAllEqual(data) {
+		err := out.WriteByte(ALL_VALUES_EQUAL)
+		if err == nil {
+			err = out.WriteVInt(int32(data[0]))
+		}
+		return err
+	}
+
+	numBits := bitsRequired(data)
+	assertn(numBits > 0 && numBits <= 32, "%v", numBits)
+	encoder := fu.encoders[numBits]
+	iters := int(fu.iterations[numBits])
+	assert(iters*encoder.ByteValueCount() >= LUCENE41_BLOCK_SIZE)
+	encodedSize := int(fu.encodedSizes[numBits])
+	assert(iters*encoder.ByteBlockCount() >= encodedSize)
+
+	if err := out.WriteByte(byte(numBits)); err != nil {
+		return err
+	}
+
+	encoder.EncodeIntToByte(data, encoded, iters)
+	return out.WriteBytes(encoded[:encodedSize])
+}
+
+/*
+Read the next block of data (For format).
+*/
+func (fu ForUtil) readBlock(in store.IndexInput, encoded []byte, decoded []int) error {
+	numBits, err := in.ReadByte()
+	if err != nil {
+		return err
+	}
+	assertn(numBits <= 32, "%v", numBits)
+
+	if numBits == ALL_VALUES_EQUAL {
+		value, err := asInt(in.ReadVInt())
+		if err != nil {
+			return err
+		}
+		for i := 0; i < LUCENE41_BLOCK_SIZE; i++ {
+			decoded[i] = value
+		}
+		return nil
+	}
+
+	encodedSize := fu.encodedSizes[numBits]
+	if err = in.ReadBytes(encoded[:encodedSize]); err != nil {
+		return err
+	}
+
+	decoder := fu.decoders[numBits]
+	iters := int(fu.iterations[numBits])
+	assert(iters*decoder.ByteValueCount() >= LUCENE41_BLOCK_SIZE)
+
+	decoder.DecodeByteToInt(encoded, decoded, iters)
+	return nil
+}
+
+/*
+Skip the next block of data.
+*/
+func (fu ForUtil) skipBlock(in store.IndexInput) error {
+	numBits, err := in.ReadByte()
+	if err != nil {
+		return err
+	}
+	if numBits == ALL_VALUES_EQUAL {
+		_, err = in.ReadVInt()
+		return err
+	}
+	assertn(numBits > 0 && numBits <= 32, "%v", numBits)
+	encodedSize := fu.encodedSizes[numBits]
+	return in.Seek(in.FilePointer() + int64(encodedSize))
+}
+
+func isAllEqual(data []int) bool {
+	v := data[0]
+	for i := 1; i < LUCENE41_BLOCK_SIZE; i++ {
+		if data[i] != v {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Compute the number of bits required to serialize any of the longs in
+data.
+*/
+func bitsRequired(data []int) int {
+	or := 0
+	for i := 0; i < LUCENE41_BLOCK_SIZE; i++ {
+		assert(data[i] >= 0)
+		or |= data[i]
+	}
+	return packed.BitsRequired(int64(or))
+}
@@ -0,0 +1,666 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"github.com/balzaczyy/golucene/core/codec"
+	"github.com/balzaczyy/golucene/core/index/model"
+	"github.com/balzaczyy/golucene/core/store"
+	"github.com/balzaczyy/golucene/core/util"
+)
+
+// codecs/lucene41/Lucene41SkipWriter.java
+
+/*
+Write skip lists with multiple levels, and support skip within block
+ints.
+
+Assume that docFreq = 28, skipInterval = blockSize = 12
+
+	|       block#0       | |      block#1        | |vInts|
+	d d d d d d d d d d d d d d d d d d d d d d d d d d d d (posting list)
+	                        ^                       ^       (level 0 skip point)
+
+Note that skipWriter will ignore first document in block#0, since it
+is useless as a skip point. Also, we'll never skip into the vInts
+block, only record skip data at the start its start point(if it
+exist).
+
+For each skip point, we will record:
+1. docID in former position, i.e. for position 12, record docID[11],
+etc.
+2. its related file points(position, payload),
+3. related numbers or uptos(position, payload).
+4. start offset.
+*/
+type Lucene41SkipWriter struct {
+	*MultiLevelSkipListWriter
+
+	lastSkipDoc         []int
+	lastSkipDocPointer  []int64
+	lastSkipPosPointer  []int64
+	lastSkipPayPointer  []int64
+	lastPayloadByteUpto []int
+
+	docOut store.IndexOutput
+	posOut store.IndexOutput
+	payOut store.IndexOutput
+
+	curDoc             int
+	curDocPointer      int64
+	curPosPointer      int64
+	curPayPointer      int64
+	curPosBufferUpto   int
+	curPayloadByteUpto int
+	fieldHasPositions  bool
+	fieldHasOffsets    bool
+	fieldHasPayloads   bool
+}
+
+func newLucene41SkipWriter(maxSkipLevels, blockSize, docCount int,
+	docOut, posOut, payOut store.IndexOutput) *Lucene41SkipWriter {
+
+	w := &Lucene41SkipWriter{
+		docOut:             docOut,
+		posOut:             posOut,
+		payOut:             payOut,
+		lastSkipDoc:        make([]int, maxSkipLevels),
+		lastSkipDocPointer: make([]int64, maxSkipLevels),
+	}
+	w.MultiLevelSkipListWriter = newMultiLevelSkipListWriter(w, blockSize, 8, maxSkipLevels, docCount)
+	if posOut != nil {
+		w.lastSkipPosPointer = make([]int64, maxSkipLevels)
+		if payOut != nil {
+			w.lastSkipPayPointer = make([]int64, maxSkipLevels)
+		}
+		w.lastPayloadByteUpto = make([]int, maxSkipLevels)
+	}
+	return w
+}
+
+func (w *Lucene41SkipWriter) setField(fieldHasPositions, fieldHasOffsets, fieldHasPayloads bool) {
+	w.fieldHasPositions = fieldHasPositions
+	w.fieldHasOffsets = fieldHasOffsets
+	w.fieldHasPayloads = fieldHasPayloads
+}
+
+func (w *Lucene41SkipWriter) resetSkip() {
+	w.MultiLevelSkipListWriter.resetSkip()
+	docFP := w.docOut.FilePointer()
+	for i, _ := range w.lastSkipDoc {
+		w.lastSkipDoc[i] = 0
+		w.lastSkipDocPointer[i] = docFP
+	}
+	if w.fieldHasPositions {
+		posFP := w.posOut.FilePointer()
+		for i, _ := range w.lastSkipPosPointer {
+			w.lastSkipPosPointer[i] = posFP
+		}
+		if w.fieldHasPayloads {
+			for i, _ := range w.lastPayloadByteUpto {
+				w.lastPayloadByteUpto[i] = 0
+			}
+		}
+		if w.fieldHasOffsets || w.fieldHasPayloads {
+			payFP := w.payOut.FilePointer()
+			for i, _ := range w.lastSkipPayPointer {
+				w.lastSkipPayPointer[i] = payFP
+			}
+		}
+	}
+}
+
+/* Sets the values for the current skip data. */
+func (w *Lucene41SkipWriter) bufferSkip(doc, numDocs int, posFP, payFP int64,
+	posBufferUpto, payloadByteUpto int) error {
+
+	w.curDoc = doc
+	w.curDocPointer = w.docOut.FilePointer()
+	w.curPosPointer = posFP
+	w.curPayPointer = payFP
+	w.curPosBufferUpto = posBufferUpto
+	w.curPayloadByteUpto = payloadByteUpto
+	return w.MultiLevelSkipListWriter.bufferSkip(numDocs)
+}
+
+func (w *Lucene41SkipWriter) writeSkipData(level int, skipBuffer store.IndexOutput) error {
+	delta := w.curDoc - w.lastSkipDoc[level]
+	err := skipBuffer.WriteVInt(int32(delta))
+	if err != nil {
+		return err
+	}
+	w.lastSkipDoc[level] = w.curDoc
+
+	err = skipBuffer.WriteVInt(int32(w.curDocPointer - w.lastSkipDocPointer[level]))
+	if err != nil {
+		return err
+	}
+	w.lastSkipDocPointer[level] = w.curDocPointer
+
+	if w.fieldHasPositions {
+		err = skipBuffer.WriteVInt(int32(w.curPosPointer - w.lastSkipPosPointer[level]))
+		if err != nil {
+			return err
+		}
+		w.lastSkipPosPointer[level] = w.curPosPointer
+		if err = skipBuffer.WriteVInt(int32(w.curPosBufferUpto)); err != nil {
+			return err
+		}
+
+		if w.fieldHasPayloads {
+			if err = skipBuffer.WriteVInt(int32(w.curPayloadByteUpto)); err != nil {
+				return err
+			}
+		}
+
+		if w.fieldHasOffsets || w.fieldHasPayloads {
+			err = skipBuffer.WriteVInt(int32(w.curPayPointer - w.lastSkipPayPointer[level]))
+			if err != nil {
+				return err
+			}
+			w.lastSkipPayPointer[level] = w.curPayPointer
+		}
+	}
+	return nil
+}
+
+// codecs/lucene41/Lucene41PostingsWriter.java
+
+/*
+Expert: the maximum number of skip levels. Smaller values result in
+slightly smaller indexes, but slower skipping in big posting lists.
+*/
+const LUCENE41_MAX_SKIP_LEVELS = 10
+
+/*
+Concrete class that writes docId (maybe frq,pos,offset,payloads) list
+with postings format.
+
+Postings list for each term will be stored separately.
+*/
+type Lucene41PostingsWriter struct {
+	termsOut store.IndexOutput
+
+	docOut store.IndexOutput
+	posOut store.IndexOutput
+	payOut store.IndexOutput
+
+	docTermStartFP int64
+	posTermStartFP int64
+	payTermStartFP int64
+
+	docDeltaBuffer []int
+	freqBuffer     []int
+	docBufferUpto  int
+
+	posDeltaBuffer         []int
+	payloadLengthBuffer    []int
+	offsetStartDeltaBuffer []int
+	offsetLengthBuffer     []int
+	posBufferUpto          int
+
+	payloadBytes    []byte
+	payloadByteUpto int
+
+	lastBlockDocID           int
+	lastBlockPosFP           int64
+	lastBlockPayFP           int64
+	lastBlockPosBufferUpto   int
+	lastBlockPayloadByteUpto int
+
+	lastDocID       int
+	lastPosition    int
+	lastStartOffset int
+	docCount        int
+
+	encoded []byte
+
+	forUtil    ForUtil
+	skipWriter *Lucene41SkipWriter
+
+	fieldHasFreqs     bool
+	fieldHasPositions bool
+	fieldHasOffsets   bool
+	fieldHasPayloads  bool
+
+	pendingTerms []*lucene41PendingTerm
+	bytesWriter  *store.RAMOutputStream
+}
+
+/*
+Creates a postings writer with the specified PackedInts overhead
+ratio.
+*/
+func newLucene41PostingsWriter(state SegmentWriteState,
+	acceptableOverheadRatio float32) (w *Lucene41PostingsWriter, err error) {
+
+	docOut, err := state.directory.CreateOutput(util.SegmentFileName(
+		state.segmentInfo.Name, state.segmentSuffix, LUCENE41_DOC_EXTENSION), state.context)
+	if err != nil {
+		return nil, err
+	}
+	var posOut, payOut store.IndexOutput
+	var success = false
+	defer func() {
+		if !success {
+			util.CloseWhileSuppressingError(docOut, posOut, payOut)
+		}
+	}()
+
+	w = &Lucene41PostingsWriter{docOut: docOut, bytesWriter: store.NewRAMOutputStreamBuffer()}
+
+	if err = codec.WriteHeader(w.docOut, LUCENE41_DOC_CODEC, LUCENE41_VERSION_CURRENT); err != nil {
+		return nil, err
+	}
+	if w.forUtil, err = NewForUtilInto(acceptableOverheadRatio, w.docOut); err != nil {
+		return nil, err
+	}
+	if state.fieldInfos.HasProx {
+		w.posDeltaBuffer = make([]int, MAX_DATA_SIZE)
+		posOut, err = state.directory.CreateOutput(util.SegmentFileName(
+			state.segmentInfo.Name, state.segmentSuffix, LUCENE41_POS_EXTENSION), state.context)
+		if err != nil {
+			return nil, err
+		}
+		if err = codec.WriteHeader(posOut, LUCENE41_POS_CODEC, LUCENE41_VERSION_CURRENT); err != nil {
+			return nil, err
+		}
+
+		if state.fieldInfos.HasPayloads {
+			w.payloadBytes = make([]byte, 128)
+			w.payloadLengthBuffer = make([]int, MAX_DATA_SIZE)
+		}
+
+		if state.fieldInfos.HasOffsets {
+			w.offsetStartDeltaBuffer = make([]int, MAX_DATA_SIZE)
+			w.offsetLengthBuffer = make([]int, MAX_DATA_SIZE)
+		}
+
+		if state.fieldInfos.HasPayloads || state.fieldInfos.HasOffsets {
+			payOut, err = state.directory.CreateOutput(util.SegmentFileName(
+				state.segmentInfo.Name, state.segmentSuffix, LUCENE41_PAY_EXTENSION), state.context)
+			if err != nil {
+				return nil, err
+			}
+			if err = codec.WriteHeader(payOut, LUCENE41_PAY_CODEC, LUCENE41_VERSION_CURRENT); err != nil {
+				return nil, err
+			}
+		}
+	}
+	w.posOut, w.payOut = posOut, payOut
+	success = true
+
+	w.docDeltaBuffer = make([]int, MAX_DATA_SIZE)
+	w.freqBuffer = make([]int, MAX_DATA_SIZE)
+
+	// TODO: should we try skipping every 2/4 blocks...?
+	w.skipWriter = newLucene41SkipWriter(LUCENE41_MAX_SKIP_LEVELS, LUCENE41_BLOCK_SIZE,
+		state.segmentInfo.DocCount(), w.docOut, w.posOut, w.payOut)
+
+	w.encoded = make([]byte, MAX_ENCODED_SIZE)
+	return w, nil
+}
+
+func (w *Lucene41PostingsWriter) Init(termsOut store.IndexOutput) error {
+	w.termsOut = termsOut
+	err := codec.WriteHeader(termsOut, LUCENE41_TERMS_CODEC, LUCENE41_VERSION_CURRENT)
+	if err == nil {
+		err = termsOut.WriteVInt(LUCENE41_BLOCK_SIZE)
+	}
+	return err
+}
+
+func (w *Lucene41PostingsWriter) SetField(fieldInfo model.FieldInfo) {
+	indexOptions := fieldInfo.IndexOptions()
+	w.fieldHasFreqs = indexOptions >= model.INDEX_OPT_DOCS_AND_FREQS
+	w.fieldHasPositions = indexOptions >= model.INDEX_OPT_DOCS_AND_FREQS_AND_POSITIONS
+	w.fieldHasOffsets = indexOptions >= model.INDEX_OPT_DOCS_AND_FREQS_AND_POSITIONS_AND_OFFSETS
+	w.fieldHasPayloads = fieldInfo.HasPayloads()
+	w.skipWriter.setField(w.fieldHasPositions, w.fieldHasOffsets, w.fieldHasPayloads)
+}
+
+func (w *Lucene41PostingsWriter) StartTerm() error {
+	w.docTermStartFP = w.docOut.FilePointer()
+	if w.fieldHasPositions {
+		w.posTermStartFP = w.posOut.FilePointer()
+		if w.fieldHasPayloads || w.fieldHasOffsets {
+			w.payTermStartFP = w.payOut.FilePointer()
+		}
+	}
+	w.lastDocID = 0
+	w.lastBlockDocID = -1
+	w.skipWriter.resetSkip()
+	return nil
+}
+
+func (w *Lucene41PostingsWriter) StartDoc(docId, termDocFreq int) error {
+	// Have collected a block of docs, and get a new doc. Should write
+	// skip data as well as postings list for current block.
+	if w.lastBlockDocID != -1 && w.docBufferUpto == 0 {
+		err := w.skipWriter.bufferSkip(w.lastBlockDocID, w.docCount,
+			w.lastBlockPosFP, w.lastBlockPayFP, w.lastBlockPosBufferUpto,
+			w.lastBlockPayloadByteUpto)
+		if err != nil {
+			return err
+		}
+	}
+
+	docDelta := docId - w.lastDocID
+
+	if docId < 0 || (w.docCount > 0 && docDelta <= 0) {
+		return errors.New(fmt.Sprintf("docs out of order (%v <= %v ) (docOut: %v)",
+			docId, w.lastDocID, w.docOut))
+	}
+
+	w.docDeltaBuffer[w.docBufferUpto] = docDelta
+	if w.fieldHasFreqs {
+		w.freqBuffer[w.docBufferUpto] = termDocFreq
+	}
+	w.docBufferUpto++
+	w.docCount++
+
+	if w.docBufferUpto == LUCENE41_BLOCK_SIZE {
+		if err := w.forUtil.writeBlock(w.docDeltaBuffer, w.encoded, w.docOut); err != nil {
+			return err
+		}
+		if w.fieldHasFreqs {
+			if err := w.forUtil.writeBlock(w.freqBuffer, w.encoded, w.docOut); err != nil {
+				return err
+			}
+		}
+		// NOTE: don't set docBufferUpto back to 0 here; finishDoc will
+		// do so (because it needs to see that the block was filled so it
+		// can save skip data)
+	}
+
+	w.lastDocID = docId
+	w.lastPosition = 0
+	w.lastStartOffset = 0
+	return nil
+}
+
+/* Add a new position & payload */
+func (w *Lucene41PostingsWriter) AddPosition(position int, payload []byte,
+	startOffset, endOffset int) error {
+
+	w.posDeltaBuffer[w.posBufferUpto] = position - w.lastPosition
+	if w.fieldHasPayloads {
+		if len(payload) == 0 {
+			// no payload
+			w.payloadLengthBuffer[w.posBufferUpto] = 0
+		} else {
+			w.payloadLengthBuffer[w.posBufferUpto] = len(payload)
+			if w.payloadByteUpto+len(payload) > len(w.payloadBytes) {
+				next := make([]byte, util.Oversize(w.payloadByteUpto+len(payload), 1))
+				copy(next, w.payloadBytes[:w.payloadByteUpto])
+				w.payloadBytes = next
+			}
+			copy(w.payloadBytes[w.payloadByteUpto:], payload)
+			w.payloadByteUpto += len(payload)
+		}
+	}
+
+	if w.fieldHasOffsets {
+		assert(startOffset >= w.lastStartOffset)
+		assert(endOffset >= startOffset)
+		w.offsetStartDeltaBuffer[w.posBufferUpto] = startOffset - w.lastStartOffset
+		w.offsetLengthBuffer[w.posBufferUpto] = endOffset - startOffset
+		w.lastStartOffset = startOffset
+	}
+
+	w.posBufferUpto++
+	w.lastPosition = position
+	if w.posBufferUpto == LUCENE41_BLOCK_SIZE {
+		if err := w.forUtil.writeBlock(w.posDeltaBuffer, w.encoded, w.posOut); err != nil {
+			return err
+		}
+
+		if w.fieldHasPayloads {
+			err := w.forUtil.writeBlock(w.payloadLengthBuffer, w.encoded, w.payOut)
+			if err == nil {
+				err = w.payOut.WriteVInt(int32(w.payloadByteUpto))
+			}
+			if err == nil {
+				err = w.payOut.WriteBytes(w.payloadBytes[:w.payloadByteUpto])
+			}
+			if err != nil {
+				return err
+			}
+			w.payloadByteUpto = 0
+		}
+		if w.fieldHasOffsets {
+			err := w.forUtil.writeBlock(w.offsetStartDeltaBuffer, w.encoded, w.payOut)
+			if err == nil {
+				err = w.forUtil.writeBlock(w.offsetLengthBuffer, w.encoded, w.payOut)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		w.posBufferUpto = 0
+	}
+	return nil
+}
+
+func (w *Lucene41PostingsWriter) FinishDoc() error {
+	// Since we don't know df for current term, we had to buffer those
+	// skip data for each block, and when a new doc comes, write them to
+	// skip file.
+	if w.docBufferUpto == LUCENE41_BLOCK_SIZE {
+		w.lastBlockDocID = w.lastDocID
+		if w.posOut != nil {
+			if w.payOut != nil {
+				w.lastBlockPayFP = w.payOut.FilePointer()
+			}
+			w.lastBlockPosFP = w.posOut.FilePointer()
+			w.lastBlockPosBufferUpto = w.posBufferUpto
+			w.lastBlockPayloadByteUpto = w.payloadByteUpto
+		}
+		w.docBufferUpto = 0
+	}
+	return nil
+}
+
+type lucene41PendingTerm struct {
+	docStartFP         int64
+	posStartFP         int64
+	payStartFP         int64
+	skipOffset         int64
+	lastPosBlockOffset int64
+	singletonDocID     int
+}
+
+/* Called when we are done adding docs to this term */
+func (w *Lucene41PostingsWriter) FinishTerm(stats *TermStats) (err error) {
+	assert(stats.DocFreq > 0)
+
+	// TODO: wasteful we are counting this (counting # docs for this
+	// term) in two places?
+	assertn(stats.DocFreq == w.docCount, "%v vs %v", stats.DocFreq, w.docCount)
+
+	// docFreq == 1, don't write the single docid/freq to a separate
+	// file along with a pointer to it.
+	var singletonDocID int
+	if stats.DocFreq == 1 {
+		// pulse the singleton docid into the term dictionary, freq is
+		// implicitly totalTermFreq
+		singletonDocID = w.docDeltaBuffer[0]
+	} else {
+		singletonDocID = -1
+		// vInt encode the remaining doc deltas and freqs:
+		for i := 0; i < w.docBufferUpto && err == nil; i++ {
+			docDelta := w.docDeltaBuffer[i]
+			freq := w.freqBuffer[i]
+			if !w.fieldHasFreqs {
+				err = w.docOut.WriteVInt(int32(docDelta))
+			} else if freq == 1 {
+				err = w.docOut.WriteVInt(int32((docDelta << 1) | 1))
+			} else {
+				if err = w.docOut.WriteVInt(int32(docDelta << 1)); err == nil {
+					err = w.docOut.WriteVInt(int32(freq))
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	var lastPosBlockOffset int64 = -1
+	if w.fieldHasPositions {
+		// totalTermFreq is just total number of positions(or payloads,
+		// or offsets) associated with current term.
+		assert(stats.TotalTermFreq != -1)
+		if stats.TotalTermFreq > LUCENE41_BLOCK_SIZE {
+			// record file offset for last pos in last block
+			lastPosBlockOffset = w.posOut.FilePointer() - w.posTermStartFP
+		}
+		if w.posBufferUpto > 0 {
+			// TODO: should we send offsets/payloads to .pay...? seems
+			// wasteful (have to store extra vLong for low (< BLOCK_SIZE)
+			// DF terms = vast vast majority)
+
+			// vInt encode the remaining positions/payloads/offsets:
+			lastPayloadLength := -1 // force first payload length to be written
+			lastOffsetLength := -1  // force first offset length to be written
+			payloadBytesReadUpto := 0
+			for i := 0; i < w.posBufferUpto; i++ {
+				posDelta := w.posDeltaBuffer[i]
+				if w.fieldHasPayloads {
+					payloadLength := w.payloadLengthBuffer[i]
+					if payloadLength != lastPayloadLength {
+						lastPayloadLength = payloadLength
+						if err = w.posOut.WriteVInt(int32((posDelta << 1) | 1)); err == nil {
+							err = w.posOut.WriteVInt(int32(payloadLength))
+						}
+					} else {
+						err = w.posOut.WriteVInt(int32(posDelta << 1))
+					}
+
+					if err == nil && payloadLength != 0 {
+						err = w.posOut.WriteBytes(w.payloadBytes[payloadBytesReadUpto : payloadBytesReadUpto+payloadLength])
+						payloadBytesReadUpto += payloadLength
+					}
+				} else {
+					err = w.posOut.WriteVInt(int32(posDelta))
+				}
+
+				if err == nil && w.fieldHasOffsets {
+					delta := w.offsetStartDeltaBuffer[i]
+					length := w.offsetLengthBuffer[i]
+					if length == lastOffsetLength {
+						err = w.posOut.WriteVInt(int32(delta << 1))
+					} else {
+						if err = w.posOut.WriteVInt(int32(delta<<1 | 1)); err == nil {
+							err = w.posOut.WriteVInt(int32(length))
+						}
+						lastOffsetLength = length
+					}
+				}
+				if err != nil {
+					return err
+				}
+			}
+
+			if w.fieldHasPayloads {
+				assert(payloadBytesReadUpto == w.payloadByteUpto)
+				w.payloadByteUpto = 0
+			}
+		}
+	}
+
+	var skipOffset int64 = -1
+	if w.docCount > LUCENE41_BLOCK_SIZE {
+		skipPointer, err := w.skipWriter.writeSkip(w.docOut)
+		if err != nil {
+			return err
+		}
+		skipOffset = skipPointer - w.docTermStartFP
+	}
+
+	var payStartFP int64 = -1
+	if stats.TotalTermFreq >= LUCENE41_BLOCK_SIZE {
+		payStartFP = w.payTermStartFP
+	}
+
+	w.pendingTerms = append(w.pendingTerms, &lucene41PendingTerm{
+		w.docTermStartFP, w.posTermStartFP, payStartFP, skipOffset,
+		lastPosBlockOffset, singletonDocID})
+	w.docBufferUpto = 0
+	w.posBufferUpto = 0
+	w.lastDocID = 0
+	w.docCount = 0
+	return nil
+}
+
+func (w *Lucene41PostingsWriter) FlushTermsBlock(start, count int) (err error) {
+	if count == 0 {
+		return w.termsOut.WriteByte(0)
+	}
+
+	assert(start <= len(w.pendingTerms))
+	assert(count <= start)
+
+	limit := len(w.pendingTerms) - start + count
+
+	var lastDocStartFP, lastPosStartFP, lastPayStartFP int64
+	for _, term := range w.pendingTerms[limit-count : limit] {
+		if term.singletonDocID == -1 {
+			err = w.bytesWriter.WriteVLong(term.docStartFP - lastDocStartFP)
+			lastDocStartFP = term.docStartFP
+		} else {
+			err = w.bytesWriter.WriteVInt(int32(term.singletonDocID))
+		}
+
+		if err == nil && w.fieldHasPositions {
+			err = w.bytesWriter.WriteVLong(term.posStartFP - lastPosStartFP)
+			lastPosStartFP = term.posStartFP
+			if err == nil && term.lastPosBlockOffset != -1 {
+				err = w.bytesWriter.WriteVLong(term.lastPosBlockOffset)
+			}
+			if err == nil && (w.fieldHasPayloads || w.fieldHasOffsets) && term.payStartFP != -1 {
+				err = w.bytesWriter.WriteVLong(term.payStartFP - lastPayStartFP)
+				lastPayStartFP = term.payStartFP
+			}
+		}
+
+		if err == nil && term.skipOffset != -1 {
+			err = w.bytesWriter.WriteVLong(term.skipOffset)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	err = w.termsOut.WriteVInt(int32(w.bytesWriter.FilePointer()))
+	if err == nil {
+		err = w.bytesWriter.WriteTo(w.termsOut)
+	}
+	if err != nil {
+		return err
+	}
+	w.bytesWriter.Reset()
+
+	// Remove the terms we just wrote:
+	w.pendingTerms = append(w.pendingTerms[:limit-count], w.pendingTerms[limit:]...)
+	return nil
+}
+
+func (w *Lucene41PostingsWriter) Close() (err error) {
+	defer func() {
+		if err == nil {
+			err = util.Close(w.docOut, w.posOut, w.payOut)
+		} else {
+			util.CloseWhileSuppressingError(w.docOut, w.posOut, w.payOut)
+		}
+	}()
+	for _, out := range []store.IndexOutput{w.docOut, w.posOut, w.payOut} {
+		if out == nil {
+			continue
+		}
+		if err = codec.WriteFooter(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
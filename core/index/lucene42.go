@@ -1,7 +1,7 @@
 package index
 
 import (
-	"errors"
+	"bytes"
 	"fmt"
 	"github.com/balzaczyy/golucene/core/codec"
 	"github.com/balzaczyy/golucene/core/codec/compressing"
@@ -10,6 +10,8 @@ import (
 	"github.com/balzaczyy/golucene/core/util"
 	"github.com/balzaczyy/golucene/core/util/packed"
 	"log"
+	"math"
+	"sort"
 )
 
 // lucene42/Lucene42Codec.java
@@ -22,18 +24,18 @@ If you want to reuse functionality of this codec, in another codec,
 extend FilterCodec.
 */
 var Lucene42Codec = &CodecImpl{
-	name:             "Lucene42Codec",
+	name:             "Lucene42",
 	fieldsFormat:     newLucene41StoredFieldsFormat(),
 	vectorsFormat:    newLucene42TermVectorsFormat(),
 	fieldInfosFormat: newLucene42FieldInfosFormat(),
 	infosFormat:      newLucene40SegmentInfoFormat(),
-	// liveDocsFormat: newLucene40LiveDocsFormat(),
+	liveDocsFormat:   new(Lucene40LiveDocsFormat),
 	// Returns the postings format that should be used for writing new
 	// segments of field.
 	//
 	// The default implemnetation always returns "Lucene41"
 	postingsFormat: newPerFieldPostingsFormat(func(field string) PostingsFormat {
-		panic("not implemented yet")
+		return LoadPostingsFormat("Lucene41")
 	}),
 	// Returns the decvalues format that should be used for writing new
 	// segments of field.
@@ -117,7 +119,7 @@ type Lucene42FieldInfosFormat struct {
 func newLucene42FieldInfosFormat() *Lucene42FieldInfosFormat {
 	return &Lucene42FieldInfosFormat{
 		reader: Lucene42FieldInfosReader,
-		writer: nil,
+		writer: Lucene42FieldInfosWriter,
 	}
 }
 
@@ -135,8 +137,9 @@ const (
 
 	// Codec header
 	LUCENE42_FI_CODEC_NAME     = "Lucene42FieldInfos"
-	LUCENE42_FI_FORMAT_START   = 0
-	LUCENE42_FI_FORMAT_CURRENT = LUCENE42_FI_FORMAT_START
+	LUCENE42_FI_FORMAT_START    = 0
+	LUCENE42_FI_FORMAT_CHECKSUM = 1 // adds the codec footer
+	LUCENE42_FI_FORMAT_CURRENT  = LUCENE42_FI_FORMAT_CHECKSUM
 
 	// Field flags
 	LUCENE42_FI_IS_INDEXED                   = 0x1
@@ -155,10 +158,11 @@ var Lucene42FieldInfosReader = func(dir store.Directory,
 	fi = model.FieldInfos{}
 	fileName := util.SegmentFileName(segment, "", LUCENE42_FI_EXTENSION)
 	log.Printf("Segment: %v", fileName)
-	input, err := dir.OpenInput(fileName, context)
+	main, err := dir.OpenInput(fileName, context)
 	if err != nil {
 		return fi, err
 	}
+	input := store.NewChecksumIndexInput(main)
 	log.Printf("Reading %v", input)
 
 	success := false
@@ -170,7 +174,7 @@ var Lucene42FieldInfosReader = func(dir store.Directory,
 		}
 	}()
 
-	_, err = codec.CheckHeader(input,
+	codecVersion, err := codec.CheckHeader(input,
 		LUCENE42_FI_CODEC_NAME,
 		LUCENE42_FI_FORMAT_START,
 		LUCENE42_FI_FORMAT_CURRENT)
@@ -237,17 +241,21 @@ var Lucene42FieldInfosReader = func(dir store.Directory,
 			omitNorms, storePayloads, indexOptions, docValuesType, normsType, attributes)
 	}
 
-	if input.FilePointer() != input.Length() {
-		return fi, errors.New(fmt.Sprintf(
-			"did not read all bytes from file '%v': read %v vs size %v (resource: %v)",
-			fileName, input.FilePointer(), input.Length(), input))
+	if codecVersion >= LUCENE42_FI_FORMAT_CHECKSUM {
+		if _, err = codec.CheckFooter(input); err != nil {
+			return fi, err
+		}
+	} else if input.FilePointer() != input.Length() {
+		return fi, codec.NewCorruptIndexErrorAt(input, fmt.Sprintf(
+			"did not read all bytes from file '%v': read %v vs size %v",
+			fileName, input.FilePointer(), input.Length()))
 	}
 	fi = model.NewFieldInfos(infos)
 	success = true
 	return fi, nil
 }
 
-func getDocValuesType(input store.IndexInput, b byte) (t model.DocValuesType, err error) {
+func getDocValuesType(input util.DataInput, b byte) (t model.DocValuesType, err error) {
 	switch b {
 	case 0:
 		return model.DocValuesType(0), nil
@@ -260,9 +268,106 @@ func getDocValuesType(input store.IndexInput, b byte) (t model.DocValuesType, er
 	case 4:
 		return model.DOC_VALUES_TYPE_SORTED_SET, nil
 	default:
-		return model.DocValuesType(0), errors.New(
-			fmt.Sprintf("invalid docvalues byte: %v (resource=%v)", b, input))
+		return model.DocValuesType(0), codec.NewCorruptIndexErrorAt(input,
+			fmt.Sprintf("invalid docvalues byte: %v", b))
+	}
+}
+
+// lucene42/Lucene42FieldInfosWriter.java
+
+var Lucene42FieldInfosWriter = func(dir store.Directory,
+	segmentName string, infos model.FieldInfos, context store.IOContext) (err error) {
+
+	fileName := util.SegmentFileName(segmentName, "", LUCENE42_FI_EXTENSION)
+	output, err := dir.CreateOutput(fileName, context)
+	if err != nil {
+		return err
+	}
+
+	success := false
+	defer func() {
+		if success {
+			err = output.Close()
+		} else {
+			util.CloseWhileSuppressingError(output)
+		}
+	}()
+
+	err = codec.WriteHeader(output, LUCENE42_FI_CODEC_NAME, LUCENE42_FI_FORMAT_CURRENT)
+	if err != nil {
+		return err
+	}
+	err = output.WriteVInt(int32(infos.Size()))
+	if err != nil {
+		return err
+	}
+	for _, fi := range infos.Values {
+		indexOptions := fi.IndexOptions()
+		var bits byte
+		if fi.HasVectors() {
+			bits |= LUCENE42_FI_STORE_TERMVECTOR
+		}
+		if fi.OmitsNorms() {
+			bits |= LUCENE42_FI_OMIT_NORMS
+		}
+		if fi.HasPayloads() {
+			bits |= LUCENE42_FI_STORE_PAYLOADS
+		}
+		if fi.IsIndexed() {
+			bits |= LUCENE42_FI_IS_INDEXED
+			assert2(indexOptions >= model.INDEX_OPT_DOCS_AND_FREQS_AND_POSITIONS || !fi.HasPayloads(),
+				"payloads require positions")
+			switch indexOptions {
+			case model.INDEX_OPT_DOCS_ONLY:
+				bits |= LUCENE42_FI_OMIT_TERM_FREQ_AND_POSITIONS
+			case model.INDEX_OPT_DOCS_AND_FREQS_AND_POSITIONS_AND_OFFSETS:
+				bits |= LUCENE42_FI_STORE_OFFSETS_IN_POSTINGS
+			case model.INDEX_OPT_DOCS_AND_FREQS:
+				bits |= LUCENE42_FI_OMIT_POSITIONS
+			}
+		}
+		if err = output.WriteString(fi.Name); err != nil {
+			return err
+		}
+		if err = output.WriteVInt(fi.Number); err != nil {
+			return err
+		}
+		if err = output.WriteByte(bits); err != nil {
+			return err
+		}
+
+		// pack the DV types in one byte
+		dv := docValuesByte(fi.DocValuesType())
+		nrm := docValuesByte(fi.NormType())
+		assert((dv&0xF0) == 0 && (nrm&0xF0) == 0)
+		if err = output.WriteByte(byte(0xff & ((nrm << 4) | dv))); err != nil {
+			return err
+		}
+		if err = output.WriteStringStringMap(fi.Attributes()); err != nil {
+			return err
+		}
+	}
+	if err = codec.WriteFooter(output); err != nil {
+		return err
+	}
+	success = true
+	return nil
+}
+
+func docValuesByte(t model.DocValuesType) byte {
+	switch t {
+	case model.DocValuesType(0):
+		return 0
+	case model.DOC_VALUES_TYPE_NUMERIC:
+		return 1
+	case model.DOC_VALUES_TYPE_BINARY:
+		return 2
+	case model.DOC_VALUES_TYPE_SORTED:
+		return 3
+	case model.DOC_VALUES_TYPE_SORTED_SET:
+		return 4
 	}
+	panic(fmt.Sprintf("unknown DocValuesType: %v", t))
 }
 
 // lucene42/Lucene42TermVectorsFormat.java
@@ -393,36 +498,880 @@ func newLucene42TermVectorsReader(d store.Directory,
 	if err == nil {
 		r = &Lucene42TermVectorsReader{p}
 	}
-	return r, nil
+	return r, err
 }
 
+// codecs/compressing/CompressingTermVectorsReader.java
+
+// TermVectorsReader for CompressingTermVectorsFormat.
 type CompressingTermVectorsReader struct {
-	vectorsStream store.IndexInput
-	closed        bool
+	fieldInfos        model.FieldInfos
+	indexReader       *CompressingStoredFieldsIndexReader
+	maxPointer        int64
+	vectorsStream     store.IndexInput
+	version           int
+	packedIntsVersion int
+	compressionMode   compressing.CompressionMode
+	decompressor      compressing.Decompressor
+	chunkSize         int
+	numDocs           int
+	closed            bool
+	reader            *packed.BlockPackedReaderIterator
 }
 
+// used by clone
+func newCompressingTermVectorsReaderFrom(reader *CompressingTermVectorsReader) *CompressingTermVectorsReader {
+	ans := &CompressingTermVectorsReader{
+		fieldInfos:        reader.fieldInfos,
+		vectorsStream:     reader.vectorsStream.Clone(),
+		indexReader:       reader.indexReader.Clone(),
+		maxPointer:        reader.maxPointer,
+		version:           reader.version,
+		packedIntsVersion: reader.packedIntsVersion,
+		compressionMode:   reader.compressionMode,
+		decompressor:      reader.compressionMode.NewDecompressor(),
+		chunkSize:         reader.chunkSize,
+		numDocs:           reader.numDocs,
+	}
+	ans.reader = packed.NewBlockPackedReaderIterator(ans.vectorsStream,
+		ans.packedIntsVersion, compressing.VECTORS_BLOCK_SIZE, 0)
+	return ans
+}
+
+// Sole constructor
 func newCompressingTermVectorsReader(d store.Directory,
 	si *model.SegmentInfo, segmentSuffix string,
 	fn model.FieldInfos, ctx store.IOContext, formatName string,
 	compressionMode compressing.CompressionMode) (r *CompressingTermVectorsReader, err error) {
 
-	panic("not implemented yet")
+	r = &CompressingTermVectorsReader{
+		fieldInfos:      fn,
+		numDocs:         si.DocCount(),
+		compressionMode: compressionMode,
+	}
+
+	var indexStream *store.ChecksumIndexInput
+	success := false
+	defer func() {
+		if !success {
+			if indexStream != nil {
+				util.CloseWhileSuppressingError(r, indexStream)
+			} else {
+				util.CloseWhileSuppressingError(r)
+			}
+		}
+	}()
+
+	// Load the index into memory
+	indexStreamFN := util.SegmentFileName(si.Name, segmentSuffix, compressing.VECTORS_INDEX_EXTENSION)
+	in, err := d.OpenInput(indexStreamFN, ctx)
+	if err != nil {
+		return nil, err
+	}
+	indexStream = store.NewChecksumIndexInput(in)
+	codecNameIdx := formatName + CODEC_SFX_IDX
+	if r.version, err = asInt(codec.CheckHeader(indexStream, codecNameIdx,
+		compressing.VECTORS_VERSION_START, compressing.VECTORS_VERSION_CURRENT)); err != nil {
+		return nil, err
+	}
+	assert(int64(codec.HeaderLength(codecNameIdx)) == indexStream.FilePointer())
+	if r.indexReader, err = newCompressingStoredFieldsIndexReader(indexStream, si); err != nil {
+		return nil, err
+	}
+	if r.version >= compressing.VECTORS_VERSION_CHECKSUM {
+		if r.maxPointer, err = indexStream.ReadVLong(); err != nil {
+			return nil, err
+		}
+		if _, err = codec.CheckFooter(indexStream); err != nil {
+			return nil, err
+		}
+	}
+	if err = indexStream.Close(); err != nil {
+		return nil, err
+	}
+	indexStream = nil
+
+	// Open the data file and read metadata
+	vectorsStreamFN := util.SegmentFileName(si.Name, segmentSuffix, compressing.VECTORS_EXTENSION)
+	if r.vectorsStream, err = d.OpenInput(vectorsStreamFN, ctx); err != nil {
+		return nil, err
+	}
+	codecNameDat := formatName + CODEC_SFX_DAT
+	version, err := asInt(codec.CheckHeader(r.vectorsStream, codecNameDat,
+		compressing.VECTORS_VERSION_START, compressing.VECTORS_VERSION_CURRENT))
+	if err != nil {
+		return nil, err
+	}
+	if r.version != version {
+		return nil, codec.NewCorruptIndexErrorAt(r.vectorsStream, fmt.Sprintf(
+			"Version mismatch between term vectors index and data: %v != %v",
+			r.version, version))
+	}
+	assert(int64(codec.HeaderLength(codecNameDat)) == r.vectorsStream.FilePointer())
+
+	if r.version >= compressing.VECTORS_VERSION_CHECKSUM {
+		if r.maxPointer+int64(codec.FooterLength()) != r.vectorsStream.Length() {
+			return nil, codec.NewCorruptIndexErrorAt(r.vectorsStream, fmt.Sprintf(
+				"Invalid vectorsStream maxPointer (file truncated?): maxPointer=%v, length=%v",
+				r.maxPointer, r.vectorsStream.Length()))
+		}
+	} else {
+		r.maxPointer = r.vectorsStream.Length()
+	}
+
+	if r.packedIntsVersion, err = asInt(r.vectorsStream.ReadVInt()); err != nil {
+		return nil, err
+	}
+	if r.chunkSize, err = asInt(r.vectorsStream.ReadVInt()); err != nil {
+		return nil, err
+	}
+	r.decompressor = compressionMode.NewDecompressor()
+	r.reader = packed.NewBlockPackedReaderIterator(r.vectorsStream,
+		r.packedIntsVersion, compressing.VECTORS_BLOCK_SIZE, 0)
+
+	success = true
+	return r, nil
+}
+
+func (r *CompressingTermVectorsReader) ensureOpen() {
+	assert2(!r.closed, "this TermVectorsReader is closed")
 }
 
 func (r *CompressingTermVectorsReader) Close() (err error) {
 	if !r.closed {
-		err = util.Close(r.vectorsStream)
-		r.closed = true
+		if err = util.Close(r.vectorsStream); err == nil {
+			r.closed = true
+		}
 	}
 	return err
 }
 
-func (r *CompressingTermVectorsReader) get(doc int) Fields {
-	panic("not implemented yet")
+func (r *CompressingTermVectorsReader) CheckIntegrity() error {
+	if r.version >= compressing.VECTORS_VERSION_CHECKSUM {
+		_, err := codec.ChecksumEntireFile(r.vectorsStream.Clone())
+		return err
+	}
+	return nil
 }
 
 func (r *CompressingTermVectorsReader) clone() TermVectorsReader {
-	panic("not implemented yet")
+	r.ensureOpen()
+	return newCompressingTermVectorsReaderFrom(r)
+}
+
+// Reads the next n values of the block packed reader.
+func (r *CompressingTermVectorsReader) nextInts(n int) ([]int, error) {
+	values := make([]int, n)
+	for i := 0; i < n; {
+		next, err := r.reader.NextN(n - i)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range next {
+			values[i] = int(v)
+			i++
+		}
+	}
+	return values, nil
+}
+
+// Reads a packed ints array of valueCount values and positions the
+// stream right after it.
+func (r *CompressingTermVectorsReader) readPackedInts(valueCount, bitsPerValue int) ([]int, error) {
+	filePointer := r.vectorsStream.FilePointer()
+	reader, err := packed.NewPackedReaderNoHeader(r.vectorsStream,
+		packed.PackedFormat(packed.PACKED), int32(r.packedIntsVersion),
+		int32(valueCount), uint32(bitsPerValue))
+	if err != nil {
+		return nil, err
+	}
+	values := make([]int, valueCount)
+	for i, _ := range values {
+		values[i] = int(reader.Get(i))
+	}
+	return values, r.vectorsStream.Seek(filePointer + packed.PackedFormat(packed.PACKED).ByteCount(
+		int32(r.packedIntsVersion), int32(valueCount), uint32(bitsPerValue)))
+}
+
+func (r *CompressingTermVectorsReader) get(doc int) (Fields, error) {
+	r.ensureOpen()
+
+	// seek to the right place
+	err := r.vectorsStream.Seek(r.indexReader.startPointer(doc))
+	if err != nil {
+		return nil, err
+	}
+
+	// decode
+	// - docBase: first doc ID of the chunk
+	// - chunkDocs: number of docs of the chunk
+	docBase, err := asInt(r.vectorsStream.ReadVInt())
+	if err != nil {
+		return nil, err
+	}
+	chunkDocs, err := asInt(r.vectorsStream.ReadVInt())
+	if err != nil {
+		return nil, err
+	}
+	if doc < docBase || doc >= docBase+chunkDocs || docBase+chunkDocs > r.numDocs {
+		return nil, codec.NewCorruptIndexErrorAt(r.vectorsStream, fmt.Sprintf(
+			"Corrupted: docBase=%v, chunkDocs=%v, doc=%v",
+			docBase, chunkDocs, doc))
+	}
+
+	var skip int        // number of fields to skip
+	var numFields int   // number of fields of the document we're looking for
+	var totalFields int // total number of fields of the chunk (sum for all docs)
+	if chunkDocs == 1 {
+		if numFields, err = asInt(r.vectorsStream.ReadVInt()); err != nil {
+			return nil, err
+		}
+		totalFields = numFields
+	} else {
+		r.reader.Reset(r.vectorsStream, int64(chunkDocs))
+		docNumFields, err := r.nextInts(chunkDocs)
+		if err != nil {
+			return nil, err
+		}
+		for i, n := range docNumFields {
+			if i < doc-docBase {
+				skip += n
+			}
+			totalFields += n
+		}
+		numFields = docNumFields[doc-docBase]
+	}
+
+	if numFields == 0 {
+		// no vectors
+		return nil, nil
+	}
+
+	// read field numbers that have term vectors
+	token, err := r.vectorsStream.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	assert(token != 0) // means no term vectors, cannot happen since we checked for numFields == 0
+	bitsPerFieldNum := int(token & 0x1F)
+	totalDistinctFields := int(token >> 5)
+	if totalDistinctFields == 0x07 {
+		n, err := asInt(r.vectorsStream.ReadVInt())
+		if err != nil {
+			return nil, err
+		}
+		totalDistinctFields += n
+	}
+	totalDistinctFields++
+	fieldNums, err := r.readPackedInts(totalDistinctFields, bitsPerFieldNum)
+	if err != nil {
+		return nil, err
+	}
+
+	// read field numbers and flags
+	allFieldNumOffs, err := r.readPackedInts(totalFields, packed.BitsRequired(int64(len(fieldNums)-1)))
+	if err != nil {
+		return nil, err
+	}
+	var flags []int
+	switch n, err := asInt(r.vectorsStream.ReadVInt()); {
+	case err != nil:
+		return nil, err
+	case n == 0:
+		fieldFlags, err := r.readPackedInts(len(fieldNums), compressing.VECTORS_FLAGS_BITS)
+		if err != nil {
+			return nil, err
+		}
+		flags = make([]int, totalFields)
+		for i, fieldNumOff := range allFieldNumOffs {
+			assert(fieldNumOff >= 0 && fieldNumOff < len(fieldNums))
+			flags[i] = fieldFlags[fieldNumOff]
+		}
+	case n == 1:
+		if flags, err = r.readPackedInts(totalFields, compressing.VECTORS_FLAGS_BITS); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, codec.NewCorruptIndexErrorAt(r.vectorsStream, fmt.Sprintf(
+			"Corrupted: unknown flags mode %v", n))
+	}
+	fieldNumOffs := allFieldNumOffs[skip : skip+numFields]
+
+	// number of terms per field for all fields
+	bitsRequired, err := asInt(r.vectorsStream.ReadVInt())
+	if err != nil {
+		return nil, err
+	}
+	numTerms, err := r.readPackedInts(totalFields, bitsRequired)
+	if err != nil {
+		return nil, err
+	}
+	totalTerms, skipTerms := 0, 0
+	for i, n := range numTerms {
+		if i < skip {
+			skipTerms += n
+		}
+		totalTerms += n
+	}
+
+	// term lengths
+	r.reader.Reset(r.vectorsStream, int64(totalTerms))
+	allPrefixLengths, err := r.nextInts(totalTerms)
+	if err != nil {
+		return nil, err
+	}
+	r.reader.Reset(r.vectorsStream, int64(totalTerms))
+	allSuffixLengths, err := r.nextInts(totalTerms)
+	if err != nil {
+		return nil, err
+	}
+	docOff, docLen, totalLen := 0, 0, 0
+	fieldLengths := make([]int, numFields)
+	prefixLengths := make([][]int, numFields)
+	suffixLengths := make([][]int, numFields)
+	for i, termIndex := 0, 0; i < totalFields; i++ {
+		termCount := numTerms[i]
+		length := 0
+		for _, l := range allSuffixLengths[termIndex : termIndex+termCount] {
+			length += l
+		}
+		if i < skip {
+			docOff += length
+		} else if i < skip+numFields {
+			prefixLengths[i-skip] = allPrefixLengths[termIndex : termIndex+termCount]
+			suffixLengths[i-skip] = allSuffixLengths[termIndex : termIndex+termCount]
+			fieldLengths[i-skip] = length
+			docLen += length
+		}
+		totalLen += length
+		termIndex += termCount
+	}
+
+	// term freqs
+	r.reader.Reset(r.vectorsStream, int64(totalTerms))
+	termFreqs, err := r.nextInts(totalTerms)
+	if err != nil {
+		return nil, err
+	}
+	for i, _ := range termFreqs {
+		termFreqs[i]++
+	}
+
+	// total number of positions, offsets and payloads
+	totalPositions, totalOffsets, totalPayloads := 0, 0, 0
+	for i, termIndex := 0, 0; i < totalFields; i++ {
+		f := flags[i]
+		for _, freq := range termFreqs[termIndex : termIndex+numTerms[i]] {
+			if (f & compressing.VECTORS_POSITIONS) != 0 {
+				totalPositions += freq
+			}
+			if (f & compressing.VECTORS_OFFSETS) != 0 {
+				totalOffsets += freq
+			}
+			if (f & compressing.VECTORS_PAYLOADS) != 0 {
+				totalPayloads += freq
+			}
+		}
+		termIndex += numTerms[i]
+	}
+
+	fieldTermFreqs := make([][]int, numFields)
+	positionIndex := make([][]int, numFields)
+	for i, termIndex := 0, skipTerms; i < numFields; i++ {
+		termCount := numTerms[skip+i]
+		fieldTermFreqs[i] = termFreqs[termIndex : termIndex+termCount]
+		positionIndex[i] = make([]int, termCount+1)
+		for j, freq := range fieldTermFreqs[i] {
+			positionIndex[i][j+1] = positionIndex[i][j] + freq
+		}
+		termIndex += termCount
+	}
+
+	positions := make([][]int, numFields)
+	startOffsets := make([][]int, numFields)
+	lengths := make([][]int, numFields)
+	if totalPositions > 0 {
+		if err = r.readPositions(skip, numFields, flags, numTerms, termFreqs,
+			compressing.VECTORS_POSITIONS, totalPositions, positions); err != nil {
+			return nil, err
+		}
+	}
+
+	if totalOffsets > 0 {
+		// average number of chars per term
+		charsPerTerm := make([]float32, len(fieldNums))
+		for i, _ := range charsPerTerm {
+			n, err := r.vectorsStream.ReadInt()
+			if err != nil {
+				return nil, err
+			}
+			charsPerTerm[i] = math.Float32frombits(uint32(n))
+		}
+		if err = r.readPositions(skip, numFields, flags, numTerms, termFreqs,
+			compressing.VECTORS_OFFSETS, totalOffsets, startOffsets); err != nil {
+			return nil, err
+		}
+		if err = r.readPositions(skip, numFields, flags, numTerms, termFreqs,
+			compressing.VECTORS_OFFSETS, totalOffsets, lengths); err != nil {
+			return nil, err
+		}
+
+		for i := 0; i < numFields; i++ {
+			fStartOffsets, fPositions, fLengths := startOffsets[i], positions[i], lengths[i]
+			// patch offsets from positions
+			if fStartOffsets != nil && fPositions != nil {
+				fieldCharsPerTerm := charsPerTerm[fieldNumOffs[i]]
+				for j, _ := range fStartOffsets {
+					fStartOffsets[j] += int(fieldCharsPerTerm * float32(fPositions[j]))
+				}
+			}
+			if fStartOffsets != nil {
+				fPositionIndex := positionIndex[i]
+				for j, end := 0, numTerms[skip+i]; j < end; j++ {
+					// delta-decode start offsets and patch lengths using term lengths
+					termLength := prefixLengths[i][j] + suffixLengths[i][j]
+					fLengths[fPositionIndex[j]] += termLength
+					for k := fPositionIndex[j] + 1; k < fPositionIndex[j+1]; k++ {
+						fStartOffsets[k] += fStartOffsets[k-1]
+						fLengths[k] += termLength
+					}
+				}
+			}
+		}
+	}
+
+	if totalPositions > 0 {
+		// delta-decode positions
+		for i, fPositions := range positions {
+			if fPositions != nil {
+				fPositionIndex := positionIndex[i]
+				for j, end := 0, numTerms[skip+i]; j < end; j++ {
+					for k := fPositionIndex[j] + 1; k < fPositionIndex[j+1]; k++ {
+						fPositions[k] += fPositions[k-1]
+					}
+				}
+			}
+		}
+	}
+
+	// payload lengths
+	payloadIndex := make([][]int, numFields)
+	payloadOff, payloadLen, totalPayloadLength := 0, 0, 0
+	if totalPayloads > 0 {
+		r.reader.Reset(r.vectorsStream, int64(totalPayloads))
+		payloadLengths, err := r.nextInts(totalPayloads)
+		if err != nil {
+			return nil, err
+		}
+		upto := 0
+		for i, termIndex := 0, 0; i < totalFields; i++ {
+			termCount := numTerms[i]
+			if (flags[i] & compressing.VECTORS_PAYLOADS) != 0 {
+				totalFreq := 0
+				for _, freq := range termFreqs[termIndex : termIndex+termCount] {
+					totalFreq += freq
+				}
+				fieldPayloadLengths := payloadLengths[upto : upto+totalFreq]
+				upto += totalFreq
+				switch {
+				case i < skip:
+					for _, l := range fieldPayloadLengths {
+						payloadOff += l
+					}
+				case i < skip+numFields:
+					index := make([]int, totalFreq+1)
+					index[0] = payloadLen
+					for k, l := range fieldPayloadLengths {
+						payloadLen += l
+						index[k+1] = payloadLen
+					}
+					payloadIndex[i-skip] = index
+				default:
+					for _, l := range fieldPayloadLengths {
+						totalPayloadLength += l
+					}
+				}
+			}
+			termIndex += termCount
+		}
+		assert(upto == totalPayloads)
+		totalPayloadLength += payloadOff + payloadLen
+	}
+
+	// decompress data
+	data, err := r.decompressor(r.vectorsStream, totalLen+totalPayloadLength,
+		docOff+payloadOff, docLen+payloadLen, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	fieldFlags := flags[skip : skip+numFields]
+	fieldNumTerms := numTerms[skip : skip+numFields]
+	return &tvFields{
+		fieldInfos:    r.fieldInfos,
+		fieldNums:     fieldNums,
+		fieldFlags:    fieldFlags,
+		fieldNumOffs:  fieldNumOffs,
+		numTerms:      fieldNumTerms,
+		fieldLengths:  fieldLengths,
+		prefixLengths: prefixLengths,
+		suffixLengths: suffixLengths,
+		termFreqs:     fieldTermFreqs,
+		positionIndex: positionIndex,
+		positions:     positions,
+		startOffsets:  startOffsets,
+		lengths:       lengths,
+		payloadIndex:  payloadIndex,
+		suffixBytes:   data[:docLen],
+		payloadBytes:  data[docLen : docLen+payloadLen],
+	}, nil
+}
+
+/*
+Reads totalPositions values which are either positions, start
+offsets or lengths, and keeps those of the fields of the current doc
+which have flag set into positions.
+*/
+func (r *CompressingTermVectorsReader) readPositions(skip, numFields int,
+	flags, numTerms, termFreqs []int, flag, totalPositions int, positions [][]int) error {
+
+	r.reader.Reset(r.vectorsStream, int64(totalPositions))
+	values, err := r.nextInts(totalPositions)
+	if err != nil {
+		return err
+	}
+	upto := 0
+	for i, termIndex := 0, 0; i < skip+numFields; i++ {
+		termCount := numTerms[i]
+		if (flags[i] & flag) != 0 {
+			totalFreq := 0
+			for _, freq := range termFreqs[termIndex : termIndex+termCount] {
+				totalFreq += freq
+			}
+			if i >= skip {
+				positions[i-skip] = values[upto : upto+totalFreq]
+			}
+			upto += totalFreq
+		}
+		termIndex += termCount
+	}
+	return nil
+}
+
+/* Term vectors of a single document. */
+type tvFields struct {
+	fieldInfos                                      model.FieldInfos
+	fieldNums, fieldFlags, fieldNumOffs, numTerms   []int
+	fieldLengths                                    []int
+	prefixLengths, suffixLengths, termFreqs         [][]int
+	positionIndex, positions, startOffsets, lengths [][]int
+	payloadIndex                                    [][]int
+	suffixBytes, payloadBytes                       []byte
+}
+
+func (f *tvFields) Terms(field string) Terms {
+	fieldInfo := f.fieldInfos.FieldInfoByName(field)
+	if fieldInfo.Name == "" {
+		return nil
+	}
+	idx := -1
+	for i, fieldNumOff := range f.fieldNumOffs {
+		if f.fieldNums[fieldNumOff] == int(fieldInfo.Number) {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 || f.numTerms[idx] == 0 {
+		// no term
+		return nil
+	}
+	fieldOff := 0
+	for _, l := range f.fieldLengths[:idx] {
+		fieldOff += l
+	}
+	return &tvTerms{
+		numTerms:      f.numTerms[idx],
+		flags:         f.fieldFlags[idx],
+		prefixLengths: f.prefixLengths[idx],
+		suffixLengths: f.suffixLengths[idx],
+		termFreqs:     f.termFreqs[idx],
+		positionIndex: f.positionIndex[idx],
+		positions:     f.positions[idx],
+		startOffsets:  f.startOffsets[idx],
+		lengths:       f.lengths[idx],
+		payloadIndex:  f.payloadIndex[idx],
+		payloadBytes:  f.payloadBytes,
+		termBytes:     f.suffixBytes[fieldOff : fieldOff+f.fieldLengths[idx]],
+	}
+}
+
+/* Term vectors of a single field of a document. */
+type tvTerms struct {
+	numTerms, flags                         int
+	prefixLengths, suffixLengths, termFreqs []int
+	positionIndex, positions, startOffsets  []int
+	lengths, payloadIndex                   []int
+	termBytes, payloadBytes                 []byte
+}
+
+func (t *tvTerms) Iterator(reuse TermsEnum) TermsEnum {
+	termsEnum, ok := reuse.(*tvTermsEnum)
+	if !ok {
+		termsEnum = newTVTermsEnum()
+	}
+	termsEnum.reset(t)
+	return termsEnum
+}
+
+func (t *tvTerms) Size() int64 {
+	return int64(t.numTerms)
+}
+
+func (t *tvTerms) SumTotalTermFreq() int64 {
+	return -1
+}
+
+func (t *tvTerms) SumDocFreq() int64 {
+	return int64(t.numTerms)
+}
+
+func (t *tvTerms) DocCount() int {
+	return 1
+}
+
+func (t *tvTerms) HasOffsets() bool {
+	return (t.flags & compressing.VECTORS_OFFSETS) != 0
+}
+
+func (t *tvTerms) HasPositions() bool {
+	return (t.flags & compressing.VECTORS_POSITIONS) != 0
+}
+
+func (t *tvTerms) HasPayloads() bool {
+	return (t.flags & compressing.VECTORS_PAYLOADS) != 0
+}
+
+type tvTermsEnum struct {
+	*TermsEnumImpl
+	terms *tvTerms
+	ord   int
+	term  []byte
+	in    *store.ByteArrayDataInput
+}
+
+func newTVTermsEnum() *tvTermsEnum {
+	ans := &tvTermsEnum{in: store.NewEmptyByteArrayDataInput()}
+	ans.TermsEnumImpl = newTermsEnumImpl(ans)
+	return ans
+}
+
+func (e *tvTermsEnum) reset(terms *tvTerms) {
+	e.terms = terms
+	e.ord = -1
+	e.term = e.term[:0]
+	e.in.Reset(terms.termBytes)
+}
+
+func (e *tvTermsEnum) Next() ([]byte, error) {
+	if e.ord == e.terms.numTerms-1 {
+		return nil, nil
+	}
+	assert(e.ord < e.terms.numTerms)
+	e.ord++
+
+	// read term
+	prefixLength := e.terms.prefixLengths[e.ord]
+	length := prefixLength + e.terms.suffixLengths[e.ord]
+	if cap(e.term) < length {
+		grown := make([]byte, length, util.Oversize(length, 1))
+		copy(grown, e.term[:prefixLength])
+		e.term = grown
+	} else {
+		e.term = e.term[:length]
+	}
+	if err := e.in.ReadBytes(e.term[prefixLength:]); err != nil {
+		return nil, err
+	}
+	return e.term, nil
+}
+
+func (e *tvTermsEnum) Comparator() sort.Interface {
+	return nil
+}
+
+func (e *tvTermsEnum) SeekCeil(text []byte) SeekStatus {
+	if e.ord >= 0 && e.ord < e.terms.numTerms {
+		cmp := bytes.Compare(e.term, text)
+		if cmp == 0 {
+			return SEEK_STATUS_FOUND
+		} else if cmp > 0 {
+			e.reset(e.terms)
+		}
+	}
+	// linear scan
+	for {
+		term, err := e.Next()
+		if err != nil || term == nil {
+			return SEEK_STATUS_END
+		}
+		if cmp := bytes.Compare(term, text); cmp > 0 {
+			return SEEK_STATUS_NOT_FOUND
+		} else if cmp == 0 {
+			return SEEK_STATUS_FOUND
+		}
+	}
+}
+
+func (e *tvTermsEnum) SeekExactByPosition(ord int64) error {
+	panic("not supported")
+}
+
+func (e *tvTermsEnum) Term() []byte {
+	return e.term
+}
+
+func (e *tvTermsEnum) Ord() int64 {
+	panic("not supported")
+}
+
+func (e *tvTermsEnum) DocFreq() (int, error) {
+	return 1, nil
+}
+
+func (e *tvTermsEnum) TotalTermFreq() (int64, error) {
+	return int64(e.terms.termFreqs[e.ord]), nil
+}
+
+func (e *tvTermsEnum) DocsByFlags(liveDocs util.Bits, reuse DocsEnum, flags int) (DocsEnum, error) {
+	return e.docsAndPositions(liveDocs, reuse), nil
+}
+
+func (e *tvTermsEnum) DocsAndPositionsByFlags(liveDocs util.Bits,
+	reuse DocsAndPositionsEnum, flags int) DocsAndPositionsEnum {
+
+	if e.terms.positions == nil && e.terms.startOffsets == nil {
+		return nil
+	}
+	// TODO: slightly sheisty
+	return e.docsAndPositions(liveDocs, reuse)
+}
+
+func (e *tvTermsEnum) docsAndPositions(liveDocs util.Bits, reuse DocsEnum) *tvDocsEnum {
+	docsEnum, ok := reuse.(*tvDocsEnum)
+	if !ok {
+		docsEnum = new(tvDocsEnum)
+	}
+	t := e.terms
+	docsEnum.reset(liveDocs, t.termFreqs[e.ord], t.positionIndex[e.ord],
+		t.positions, t.startOffsets, t.lengths, t.payloadBytes, t.payloadIndex)
+	return docsEnum
+}
+
+type tvDocsEnum struct {
+	liveDocs util.Bits
+	doc      int
+	termFreq int
+	// position index of the current position
+	i                                int
+	positionIndex                    int
+	positions, startOffsets, lengths []int
+	payloads                         []byte
+	payloadIndex                     []int
+	payload                          []byte
+}
+
+func (e *tvDocsEnum) reset(liveDocs util.Bits, freq, positionIndex int,
+	positions, startOffsets, lengths []int, payloads []byte, payloadIndex []int) {
+
+	e.liveDocs = liveDocs
+	e.termFreq = freq
+	e.positionIndex = positionIndex
+	e.positions = positions
+	e.startOffsets = startOffsets
+	e.lengths = lengths
+	e.payloads = payloads
+	e.payloadIndex = payloadIndex
+	e.payload = nil
+	e.doc, e.i = -1, -1
+}
+
+func (e *tvDocsEnum) checkDoc() {
+	if e.doc == NO_MORE_DOCS {
+		panic("DocsEnum exhausted")
+	} else if e.doc == -1 {
+		panic("DocsEnum not started")
+	}
+}
+
+func (e *tvDocsEnum) checkPosition() {
+	e.checkDoc()
+	if e.i < 0 {
+		panic("Position enum not started")
+	} else if e.i >= e.termFreq {
+		panic("Read past last position")
+	}
+}
+
+func (e *tvDocsEnum) NextPosition() (int, error) {
+	if e.doc != 0 {
+		panic("illegal state")
+	} else if e.i >= e.termFreq-1 {
+		panic("Read past last position")
+	}
+
+	e.i++
+
+	if e.payloadIndex != nil {
+		start, end := e.payloadIndex[e.positionIndex+e.i], e.payloadIndex[e.positionIndex+e.i+1]
+		e.payload = e.payloads[start:end]
+	}
+
+	if e.positions == nil {
+		return -1, nil
+	}
+	return e.positions[e.positionIndex+e.i], nil
+}
+
+func (e *tvDocsEnum) StartOffset() (int, error) {
+	e.checkPosition()
+	if e.startOffsets == nil {
+		return -1, nil
+	}
+	return e.startOffsets[e.positionIndex+e.i], nil
+}
+
+func (e *tvDocsEnum) EndOffset() (int, error) {
+	e.checkPosition()
+	if e.startOffsets == nil {
+		return -1, nil
+	}
+	return e.startOffsets[e.positionIndex+e.i] + e.lengths[e.positionIndex+e.i], nil
+}
+
+func (e *tvDocsEnum) Payload() ([]byte, error) {
+	e.checkPosition()
+	if e.payloadIndex == nil || len(e.payload) == 0 {
+		return nil, nil
+	}
+	return e.payload, nil
+}
+
+func (e *tvDocsEnum) Freq() (int, error) {
+	e.checkDoc()
+	return e.termFreq, nil
+}
+
+func (e *tvDocsEnum) DocId() int {
+	return e.doc
+}
+
+func (e *tvDocsEnum) NextDoc() (int, error) {
+	if e.doc == -1 && (e.liveDocs == nil || e.liveDocs.At(0)) {
+		e.doc = 0
+	} else {
+		e.doc = NO_MORE_DOCS
+	}
+	return e.doc, nil
 }
 
 // lucene42/Lucene42NormsFormat.java
@@ -453,7 +1402,8 @@ func newLucene42NormsFormatWithOverhead(acceptableOverheadRatio float32) *Lucene
 }
 
 func (f *Lucene42NormsFormat) NormsConsumer(state SegmentWriteState) (w DocValuesConsumer, err error) {
-	panic("not implemented yet")
+	return newLucene42DocValuesConsumer(state, "Lucene41NormsData", "nvd",
+		"Lucene41NormsMetadata", "nvm", f.acceptableOverheadRatio)
 }
 
 func (f *Lucene42NormsFormat) NormsProducer(state SegmentReadState) (r DocValuesProducer, err error) {
@@ -7,6 +7,8 @@ import (
 	"github.com/balzaczyy/golucene/core/index/model"
 	"github.com/balzaczyy/golucene/core/store"
 	"github.com/balzaczyy/golucene/core/util"
+	"github.com/balzaczyy/golucene/core/util/packed"
+	"math"
 	"sync"
 )
 
@@ -89,7 +91,7 @@ func newLucene42DocValuesProducer(state SegmentReadState,
 	}
 
 	if version != version2 {
-		return dvp, errors.New("Format versions mismatch")
+		return dvp, codec.NewCorruptIndexErrorAt(dvp.data, "Format versions mismatch")
 	}
 	return dvp, nil
 }
@@ -137,7 +139,7 @@ func (dvp *Lucene42DocValuesProducer) readFields(meta store.IndexInput) (err err
 		case LUCENE42_DV_FST:
 			panic("not implemented yet")
 		default:
-			return errors.New(fmt.Sprintf("invalid entry type: %v, input=%v", fieldType, meta))
+			return codec.NewCorruptIndexErrorAt(meta, fmt.Sprintf("invalid entry type: %v", fieldType))
 		}
 		fieldNumber, err = asInt(meta.ReadVInt())
 	}
@@ -198,6 +200,11 @@ func (dvp *Lucene42DocValuesProducer) SortedSet(field model.FieldInfo) (v Sorted
 	return nil, nil
 }
 
+// Lucene42 doc values carry no checksum footer; nothing to verify.
+func (dvp *Lucene42DocValuesProducer) CheckIntegrity() error {
+	return nil
+}
+
 func (dvp *Lucene42DocValuesProducer) Close() error {
 	return dvp.data.Close()
 }
@@ -221,3 +228,132 @@ type FSTEntry struct {
 	offset  int64
 	numOrds int64
 }
+
+// lucene42/Lucene42DocValuesConsumer.java
+
+/*
+Writer for Lucene42DocValuesFormat.
+
+Only the uncompressed encoding of numeric values is supported yet,
+which is what norms of the default similarity use.
+*/
+type Lucene42DocValuesConsumer struct {
+	data, meta              store.IndexOutput
+	maxDoc                  int
+	acceptableOverheadRatio float32
+}
+
+func newLucene42DocValuesConsumer(state SegmentWriteState,
+	dataCodec, dataExtension, metaCodec, metaExtension string,
+	acceptableOverheadRatio float32) (w *Lucene42DocValuesConsumer, err error) {
+
+	w = &Lucene42DocValuesConsumer{
+		maxDoc:                  state.segmentInfo.DocCount(),
+		acceptableOverheadRatio: acceptableOverheadRatio,
+	}
+	success := false
+	defer func() {
+		if !success {
+			util.CloseWhileSuppressingError(w)
+		}
+	}()
+
+	dataName := util.SegmentFileName(state.segmentInfo.Name, state.segmentSuffix, dataExtension)
+	if w.data, err = state.directory.CreateOutput(dataName, state.context); err != nil {
+		return nil, err
+	}
+	if err = codec.WriteHeader(w.data, dataCodec, LUCENE42_DV_VERSION_CURRENT); err != nil {
+		return nil, err
+	}
+	metaName := util.SegmentFileName(state.segmentInfo.Name, state.segmentSuffix, metaExtension)
+	if w.meta, err = state.directory.CreateOutput(metaName, state.context); err != nil {
+		return nil, err
+	}
+	if err = codec.WriteHeader(w.meta, metaCodec, LUCENE42_DV_VERSION_CURRENT); err != nil {
+		return nil, err
+	}
+	success = true
+	return w, nil
+}
+
+func (w *Lucene42DocValuesConsumer) AddNumericField(field model.FieldInfo, values NumericIterable) (err error) {
+	if err = w.meta.WriteVInt(field.Number); err != nil {
+		return err
+	}
+	if err = w.meta.WriteByte(LUCENE42_DV_NUMBER); err != nil {
+		return err
+	}
+	if err = w.meta.WriteLong(w.data.FilePointer()); err != nil {
+		return err
+	}
+
+	var minValue, maxValue int64 = math.MaxInt64, math.MinInt64
+	uniqueValues := make(map[int64]bool)
+	count := 0
+	next := values()
+	for v, ok := next(); ok; v, ok = next() {
+		if v < minValue {
+			minValue = v
+		}
+		if v > maxValue {
+			maxValue = v
+		}
+		if uniqueValues != nil {
+			if uniqueValues[v] = true; len(uniqueValues) > 256 {
+				uniqueValues = nil
+			}
+		}
+		count++
+	}
+	assert(count == w.maxDoc)
+
+	if uniqueValues != nil {
+		// small number of unique values
+		bitsPerValue := packed.BitsRequired(int64(len(uniqueValues) - 1))
+		formatAndBits := packed.FastestFormatAndBits(w.maxDoc, bitsPerValue, w.acceptableOverheadRatio)
+		if formatAndBits.BitsPerValue == 8 && minValue >= math.MinInt8 && maxValue <= math.MaxInt8 {
+			if err = w.meta.WriteByte(LUCENE42_DV_UNCOMPRESSED); err != nil {
+				return err
+			}
+			next = values()
+			for v, ok := next(); ok && err == nil; v, ok = next() {
+				err = w.data.WriteByte(byte(v))
+			}
+			return err
+		}
+	}
+	panic("not implemented yet")
+}
+
+func (w *Lucene42DocValuesConsumer) AddBinaryField(field model.FieldInfo, values BinaryIterable) error {
+	panic("not implemented yet")
+}
+
+func (w *Lucene42DocValuesConsumer) AddSortedField(field model.FieldInfo,
+	values BinaryIterable, docToOrd NumericIterable) error {
+	panic("not implemented yet")
+}
+
+func (w *Lucene42DocValuesConsumer) AddSortedSetField(field model.FieldInfo,
+	values BinaryIterable, docToOrdCount, ords NumericIterable) error {
+	panic("not implemented yet")
+}
+
+func (w *Lucene42DocValuesConsumer) Close() (err error) {
+	success := false
+	defer func() {
+		if success {
+			err = util.Close(w.data, w.meta)
+		} else {
+			util.CloseWhileSuppressingError(w.data, w.meta)
+		}
+		w.data, w.meta = nil, nil
+	}()
+	if w.meta != nil {
+		if err = w.meta.WriteVInt(-1); err != nil { // write EOF marker
+			return err
+		}
+	}
+	success = true
+	return nil
+}
@@ -10,13 +10,13 @@ var Lucene42RWCodec = &CodecImpl{
 	vectorsFormat:    newLucene42TermVectorsFormat(),
 	fieldInfosFormat: newLucene42FieldInfosFormat(),
 	infosFormat:      newLucene40SegmentInfoFormat(),
-	// liveDocsFormat: newLucene40LiveDocsFormat(),
+	liveDocsFormat:   new(Lucene40LiveDocsFormat),
 	// Returns the postings format that should be used for writing new
 	// segments of field.
 	//
 	// The default implemnetation always returns "Lucene41"
 	postingsFormat: newPerFieldPostingsFormat(func(field string) PostingsFormat {
-		panic("not implemented yet")
+		return LoadPostingsFormat("Lucene41")
 	}),
 	// Returns the decvalues format that should be used for writing new
 	// segments of field.
@@ -18,14 +18,14 @@ If you want to reuse functionality of this codec in another codec,
 extend FilterCodec.
 */
 var Lucene45Codec = &CodecImpl{
-	name:             "Lucene45Codec",
+	name:             "Lucene45",
 	fieldsFormat:     newLucene41StoredFieldsFormat(),
 	vectorsFormat:    newLucene42TermVectorsFormat(),
 	fieldInfosFormat: newLucene42FieldInfosFormat(),
 	infosFormat:      newLucene40SegmentInfoFormat(),
 	liveDocsFormat:   new(Lucene40LiveDocsFormat),
 	postingsFormat: newPerFieldPostingsFormat(func(field string) PostingsFormat {
-		panic("not implemented yet")
+		return LoadPostingsFormat("Lucene41")
 	}),
 	docValuesFormat: newPerFieldDocValuesFormat(func(field string) DocValuesFormat {
 		panic("not implemented yet")
@@ -0,0 +1,156 @@
+package index
+
+import (
+	"fmt"
+)
+
+// index/MappingMultiDocsEnum.java
+
+/*
+Exposes flex API, merged from flex API of sub-segments, remapping
+docIDs (this is used for segment merging).
+*/
+type MappingMultiDocsEnum struct {
+	subs        []docsEnumWithSlice
+	upto        int
+	current     DocsEnum
+	currentMap  *DocMap
+	currentBase int
+	doc         int
+	mergeState  *MergeState
+}
+
+func newMappingMultiDocsEnum(mergeState *MergeState) *MappingMultiDocsEnum {
+	return &MappingMultiDocsEnum{mergeState: mergeState, doc: -1}
+}
+
+func (e *MappingMultiDocsEnum) reset(docsEnum *MultiDocsEnum) *MappingMultiDocsEnum {
+	e.subs = docsEnum.subs[:docsEnum.numSubs]
+	e.upto = -1
+	e.doc = -1
+	e.current = nil
+	return e
+}
+
+func (e *MappingMultiDocsEnum) Freq() (int, error) {
+	return e.current.Freq()
+}
+
+func (e *MappingMultiDocsEnum) DocId() int {
+	return e.doc
+}
+
+func (e *MappingMultiDocsEnum) NextDoc() (int, error) {
+	for {
+		if e.current == nil {
+			if e.upto == len(e.subs)-1 {
+				e.doc = NO_MORE_DOCS
+				return e.doc, nil
+			}
+			e.upto++
+			reader := e.subs[e.upto].slice.readerIndex
+			e.current = e.subs[e.upto].docsEnum
+			e.currentBase = e.mergeState.docBase[reader]
+			e.currentMap = e.mergeState.docMaps[reader]
+			assert2(e.currentMap.maxDoc == e.subs[e.upto].slice.length, fmt.Sprintf(
+				"readerIndex=%v subs.len=%v len1=%v vs %v",
+				reader, len(e.subs), e.currentMap.maxDoc, e.subs[e.upto].slice.length))
+		}
+
+		doc, err := e.current.NextDoc()
+		if err != nil {
+			return 0, err
+		}
+		if doc != NO_MORE_DOCS {
+			// compact deletions
+			if doc = e.currentMap.get(doc); doc == -1 {
+				continue
+			}
+			e.doc = e.currentBase + doc
+			return e.doc, nil
+		}
+		e.current = nil
+	}
+}
+
+// index/MappingMultiDocsAndPositionsEnum.java
+
+/*
+Exposes flex API, merged from flex API of sub-segments, remapping
+docIDs (this is used for segment merging).
+*/
+type MappingMultiDocsAndPositionsEnum struct {
+	subs        []docsAndPositionsEnumWithSlice
+	upto        int
+	current     DocsAndPositionsEnum
+	currentMap  *DocMap
+	currentBase int
+	doc         int
+	mergeState  *MergeState
+}
+
+func newMappingMultiDocsAndPositionsEnum(mergeState *MergeState) *MappingMultiDocsAndPositionsEnum {
+	return &MappingMultiDocsAndPositionsEnum{mergeState: mergeState, doc: -1}
+}
+
+func (e *MappingMultiDocsAndPositionsEnum) reset(postingsEnum *MultiDocsAndPositionsEnum) *MappingMultiDocsAndPositionsEnum {
+	e.subs = postingsEnum.subs[:postingsEnum.numSubs]
+	e.upto = -1
+	e.doc = -1
+	e.current = nil
+	return e
+}
+
+func (e *MappingMultiDocsAndPositionsEnum) Freq() (int, error) {
+	return e.current.Freq()
+}
+
+func (e *MappingMultiDocsAndPositionsEnum) DocId() int {
+	return e.doc
+}
+
+func (e *MappingMultiDocsAndPositionsEnum) NextDoc() (int, error) {
+	for {
+		if e.current == nil {
+			if e.upto == len(e.subs)-1 {
+				e.doc = NO_MORE_DOCS
+				return e.doc, nil
+			}
+			e.upto++
+			reader := e.subs[e.upto].slice.readerIndex
+			e.current = e.subs[e.upto].docsAndPositionsEnum
+			e.currentBase = e.mergeState.docBase[reader]
+			e.currentMap = e.mergeState.docMaps[reader]
+		}
+
+		doc, err := e.current.NextDoc()
+		if err != nil {
+			return 0, err
+		}
+		if doc != NO_MORE_DOCS {
+			// compact deletions
+			if doc = e.currentMap.get(doc); doc == -1 {
+				continue
+			}
+			e.doc = e.currentBase + doc
+			return e.doc, nil
+		}
+		e.current = nil
+	}
+}
+
+func (e *MappingMultiDocsAndPositionsEnum) NextPosition() (int, error) {
+	return e.current.NextPosition()
+}
+
+func (e *MappingMultiDocsAndPositionsEnum) StartOffset() (int, error) {
+	return e.current.StartOffset()
+}
+
+func (e *MappingMultiDocsAndPositionsEnum) EndOffset() (int, error) {
+	return e.current.EndOffset()
+}
+
+func (e *MappingMultiDocsAndPositionsEnum) Payload() ([]byte, error) {
+	return e.current.Payload()
+}
@@ -1,10 +1,15 @@
 package index
 
 import (
+	"bytes"
 	"fmt"
+	"github.com/balzaczyy/golucene/core/index/model"
+	"github.com/balzaczyy/golucene/core/store"
 	"github.com/balzaczyy/golucene/core/util"
 	"io"
 	"math"
+	"sort"
+	"strings"
 	"sync"
 )
 
@@ -26,10 +31,132 @@ type MergeScheduler interface {
 
 // index/MergeState.java
 
-// Recording units of work when merging segments.
+// Holds common state used during segment merging.
+type MergeState struct {
+	// SegmentInfo of the newly merged segment.
+	segmentInfo *model.SegmentInfo
+	// FieldInfos of the newly merged segment.
+	fieldInfos model.FieldInfos
+	// Readers being merged.
+	readers []AtomicReader
+	// Holds the CheckAbort instance, which is invoked periodically to
+	// see if the merge has been aborted.
+	checkAbort *CheckAbort
+	// InfoStream for debugging messages.
+	infoStream util.InfoStream
+
+	// Maps docIDs around deletions.
+	docMaps []*DocMap
+	// New docID base per reader.
+	docBase []int
+
+	// SegmentReaders that have identical field name/number mapping, so
+	// their stored fields and term vectors may be bulk merged.
+	matchingSegmentReaders []*SegmentReader
+	// How many matchingSegmentReaders are set.
+	matchedCount int
+}
+
+func newMergeState(readers []AtomicReader, segmentInfo *model.SegmentInfo,
+	infoStream util.InfoStream, checkAbort *CheckAbort) *MergeState {
+	return &MergeState{
+		readers:     readers,
+		segmentInfo: segmentInfo,
+		infoStream:  infoStream,
+		checkAbort:  checkAbort,
+	}
+}
+
+/*
+Remaps docids around deletes during merge
+*/
+type DocMap struct {
+	maxDoc         int
+	numDeletedDocs int
+	// nil if the reader has no deletions
+	docMap []int
+}
+
+// Returns the mapped docID corresponding to the provided one, or -1
+// if the document was deleted.
+func (m *DocMap) get(docID int) int {
+	if m.docMap == nil {
+		return docID
+	}
+	return m.docMap[docID]
+}
+
+// Returns the number of not-deleted documents.
+func (m *DocMap) numDocs() int {
+	return m.maxDoc - m.numDeletedDocs
+}
+
+// Returns true if there are any deletions.
+func (m *DocMap) hasDeletions() bool {
+	return m.numDeletedDocs > 0
+}
+
+// Creates a DocMap instance appropriate for this reader.
+func buildDocMap(reader AtomicReader) *DocMap {
+	maxDoc := reader.MaxDoc()
+	liveDocs := reader.LiveDocs()
+	if liveDocs == nil {
+		return &DocMap{maxDoc: maxDoc}
+	}
+	docMap := make([]int, maxDoc)
+	del := 0
+	for i := 0; i < maxDoc; i++ {
+		if liveDocs.At(i) {
+			docMap[i] = i - del
+		} else {
+			docMap[i] = -1
+			del++
+		}
+	}
+	numDeletedDocs := maxDoc - reader.NumDocs()
+	assert2(del == numDeletedDocs, fmt.Sprintf(
+		"del=%v, numdeleted=%v", del, numDeletedDocs))
+	return &DocMap{maxDoc, del, docMap}
+}
+
+/*
+Class for recording units of work when merging segments.
+*/
 type CheckAbort struct {
+	workCount float64
+	merge     *OneMerge
+	dir       store.Directory
+}
+
+// Creates a CheckAbort instance.
+func NewCheckAbort(merge *OneMerge, dir store.Directory) *CheckAbort {
+	return &CheckAbort{merge: merge, dir: dir}
+}
+
+/*
+Records the fact that roughly units amount of work have been done
+since this method was last called. When adding time-consuming code
+into SegmentMerger, you should test different values for units to
+ensure that the time in between calls to merge.checkAborted is up to
+~ 1 second.
+*/
+func (ca *CheckAbort) work(units float64) error {
+	if ca.merge == nil {
+		return nil
+	}
+	ca.workCount += units
+	if ca.workCount >= 10000 {
+		ca.workCount = 0
+		return ca.merge.checkAborted(ca.dir)
+	}
+	return nil
 }
 
+/*
+If you use this: IW.close(false) cannot abort your merge!
+*/
+var CHECK_ABORT_NONE = NewCheckAbort(nil, nil)
+
 // index/SerialMergeScheduler.java
 
 // A MergeScheduler that simply does each merge sequentially, using
@@ -88,9 +215,12 @@ they will be run concurrently.
 The default MergePolicy is TieredMergePolicy.
 */
 type MergePolicy interface {
-	io.Closer
+	MergeSpecifier
 	// Clone() MergePolicy
 	SetIndexWriter(writer *IndexWriter)
+	// Returns true if a new segment (regardless of its origin) should
+	// use the compound file format.
+	UseCompoundFile(infos *SegmentInfos, mergedInfo *SegmentInfoPerCommit) (bool, error)
 	SetNoCFSRatio(noCFSRatio float64)
 	SetMaxCFSSegmentSizeMB(v float64)
 }
@@ -116,14 +246,18 @@ type MergeSpecifier interface {
 	// index. IndexWriter calls this whenever there is a change to the
 	// segments. This call is always synchronized on the IndexWriter
 	// instance so only one thread at a time will call this method.
-	// FindMerges(mergeTrigger MergeTrigger, segmentInfos *SegmentInfos) (spec MergeSpecification, err error)
+	FindMerges(mergeTrigger MergeTrigger, segmentInfos *SegmentInfos) (spec MergeSpecification, err error)
 	// Determine what set of merge operations is necessary in order to
 	// merge to <= the specified segment count. IndexWriter calls this
 	// when its forceMerge() method is called. This call is always
 	// synchronized on the IndexWriter instance so only one thread at a
 	// time will call this method.
-	// FindForcedMerges(segmentInfos *SegmentInfos, maxSegmentCount int,
-	// segmentsToMerge map[SegmentInfoPerCommit]bool) (spec MergeSpecification, err error)
+	//
+	// segmentsToMerge contains the segments to be merged, mapped to
+	// true if the segment was part of the index when forceMerge()
+	// was called, or false if it resulted of a merge since.
+	FindForcedMerges(segmentInfos *SegmentInfos, maxSegmentCount int,
+		segmentsToMerge map[*SegmentInfoPerCommit]bool) (spec MergeSpecification, err error)
 	// Determine what set of merge operations is necessary in order to
 	// expunge all deletes from the index.
 	// FindForcedDeletesMerges(segmentinfos *SegmentInfos) (spec MergeSpecification, err error)
@@ -183,6 +317,40 @@ func (mp *MergePolicyImpl) SetIndexWriter(writer *IndexWriter) {
 	mp.writer.Set(writer)
 }
 
+/*
+Returns true if a new segment (regardless of its origin) should use
+the compound file format. The default implementation returns true iff
+the size of the given mergedInfo is less or equal to
+MaxCFSSegmentSizeMB and the size is less or equal to the TotalIndexSize
+* NoCFSRatio, otherwise false.
+*/
+func (mp *MergePolicyImpl) UseCompoundFile(infos *SegmentInfos,
+	mergedInfo *SegmentInfoPerCommit) (bool, error) {
+
+	if mp.noCFSRatio == 0 {
+		return false, nil
+	}
+	mergedInfoSize, err := mp.Size(mergedInfo)
+	if err != nil {
+		return false, err
+	}
+	if float64(mergedInfoSize) > mp.maxCFSSegmentSize {
+		return false, nil
+	}
+	if mp.noCFSRatio >= 1 {
+		return true, nil
+	}
+	var totalSize int64
+	for _, info := range infos.Segments {
+		n, err := mp.Size(info)
+		if err != nil {
+			return false, err
+		}
+		totalSize += n
+	}
+	return float64(mergedInfoSize) <= mp.noCFSRatio*float64(totalSize), nil
+}
+
 /*
 Returns true if this single info is already fully merged (has no
 pending deletes, is in the same dir as the writer, and matches the
@@ -236,6 +404,10 @@ const (
 	// Merge was triggered by a full flush. Full flushes can be caused
 	// by a commit, NRT reader reopen or close call on the index writer
 	MERGE_TRIGGER_FULL_FLUSH = MergeTrigger(2)
+	// Merge has been triggered explicitly by the user.
+	MERGE_TRIGGER_EXPLICIT = MergeTrigger(3)
+	// Merge was triggered by a successfully finished merge.
+	MERGE_TRIGGER_MERGE_FINISHED = MergeTrigger(4)
 )
 
 /*
@@ -247,12 +419,54 @@ whether the new segment should use the compound file format.
 type OneMerge struct {
 	sync.Locker
 
-	registerDone bool // used by MergeControl
+	info                *SegmentInfoPerCommit // used by IndexWriter
+	registerDone        bool                  // used by MergeControl
+	isExternal          bool                  // used by IndexWriter
+	maxNumSegments      int                   // used by IndexWriter
+	estimatedMergeBytes int64                 // used by IndexWriter
 
 	// Segments to ber merged.
 	segments []*SegmentInfoPerCommit
 
+	readers       []*SegmentReader // used by IndexWriter
+	totalDocCount int
+
 	aborted bool
+	err     error
+}
+
+/*
+Sole constructor.
+*/
+func NewOneMerge(segments []*SegmentInfoPerCommit) *OneMerge {
+	assert2(len(segments) > 0, "segments must include at least one segment")
+	// clone the list, as the in list may be based off original SegmentInfos and may be modified
+	segments2 := make([]*SegmentInfoPerCommit, len(segments))
+	copy(segments2, segments)
+	count := 0
+	for _, info := range segments {
+		count += info.info.DocCount()
+	}
+	return &OneMerge{
+		Locker:         &sync.Mutex{},
+		maxNumSegments: -1,
+		segments:       segments2,
+		totalDocCount:  count,
+	}
+}
+
+// Record that an error occurred while executing this merge
+func (m *OneMerge) setError(err error) {
+	m.Lock() // synchronized
+	defer m.Unlock()
+	m.err = err
+}
+
+// Retrieve previous error set by setError().
+func (m *OneMerge) error() error {
+	m.Lock() // synchronized
+	defer m.Unlock()
+	return m.err
 }
 
 func (m *OneMerge) abort() {
@@ -261,12 +475,54 @@ func (m *OneMerge) abort() {
 	m.aborted = true
 }
 
+// Returns true if this merge was aborted.
+func (m *OneMerge) isAborted() bool {
+	m.Lock() // synchronized
+	defer m.Unlock()
+	return m.aborted
+}
+
+/*
+Returns MergeAbortedError if this merge was explicitly aborted.
+*/
+func (m *OneMerge) checkAborted(dir store.Directory) error {
+	m.Lock() // synchronized
+	defer m.Unlock()
+	if m.aborted {
+		return MergeAbortedError(fmt.Sprintf("merge is aborted: %v", m.segString(dir)))
+	}
+	return nil
+}
+
+// Returns a readable description of the current merge state.
+func (m *OneMerge) segString(dir store.Directory) string {
+	var parts []string
+	for _, info := range m.segments {
+		parts = append(parts, info.StringOf(dir, 0))
+	}
+	ans := strings.Join(parts, " ")
+	if m.aborted {
+		ans += " [ABORTED]"
+	}
+	return ans
+}
+
 /*
 A MergeSpecification instance provides the information necessary to
 perform multiple merges. It simply contains a list of OneMerge
 instances.
 */
-type MergeSpecification []OneMerge
+type MergeSpecification []*OneMerge
+
+// Returns a description of the merges in this specification.
+func (spec MergeSpecification) SegString(dir store.Directory) string {
+	var b bytes.Buffer
+	b.WriteString("MergeSpec:\n")
+	for i, merge := range spec {
+		fmt.Fprintf(&b, "  %v: %v", 1+i, merge.segString(dir))
+	}
+	return b.String()
+}
 
 /*
 Thrown when a merge was explicitly aborted because IndexWriter.close()
@@ -433,6 +689,322 @@ func (tmp *TieredMergePolicy) SetSegmentsPerTier(v float64) *TieredMergePolicy {
 	return tmp
 }
 
+type segmentsBySizeDescending struct {
+	infos []*SegmentInfoPerCommit
+	sizes map[*SegmentInfoPerCommit]int64
+}
+
+func (a *segmentsBySizeDescending) Len() int      { return len(a.infos) }
+func (a *segmentsBySizeDescending) Swap(i, j int) { a.infos[i], a.infos[j] = a.infos[j], a.infos[i] }
+func (a *segmentsBySizeDescending) Less(i, j int) bool {
+	sz1, sz2 := a.sizes[a.infos[i]], a.sizes[a.infos[j]]
+	if sz1 != sz2 {
+		return sz1 > sz2
+	}
+	return a.infos[i].info.Name < a.infos[j].info.Name
+}
+
+func (tmp *TieredMergePolicy) floorSize(bytes int64) int64 {
+	if bytes > tmp.floorSegmentBytes {
+		return bytes
+	}
+	return tmp.floorSegmentBytes
+}
+
+// Returns true if TMP is enabled in IndexWriter's InfoStream.
+func (tmp *TieredMergePolicy) verbose() bool {
+	w, ok := tmp.writer.Get().(*IndexWriter)
+	return ok && w != nil && w.infoStream.IsEnabled("TMP")
+}
+
+// Print a debug message to IndexWriter's infoStream.
+func (tmp *TieredMergePolicy) message(format string, args ...interface{}) {
+	if tmp.verbose() {
+		tmp.writer.Get().(*IndexWriter).infoStream.Message("TMP", format, args...)
+	}
+}
+
+func (tmp *TieredMergePolicy) FindMerges(mergeTrigger MergeTrigger, infos *SegmentInfos) (spec MergeSpecification, err error) {
+	tmp.message("findMerges: %v segments", len(infos.Segments))
+	if len(infos.Segments) == 0 {
+		return nil, nil
+	}
+	w := tmp.writer.Get().(*IndexWriter)
+	merging := w.mergingSegments
+	toBeMerged := make(map[*SegmentInfoPerCommit]bool)
+
+	sizes := make(map[*SegmentInfoPerCommit]int64)
+	infosSorted := make([]*SegmentInfoPerCommit, len(infos.Segments))
+	copy(infosSorted, infos.Segments)
+	for _, info := range infosSorted {
+		if sizes[info], err = tmp.Size(info); err != nil {
+			return nil, err
+		}
+	}
+	sort.Sort(&segmentsBySizeDescending{infosSorted, sizes})
+
+	// Compute total index bytes & print details about the index
+	var totIndexBytes int64
+	var minSegmentBytes int64 = math.MaxInt64
+	for _, info := range infosSorted {
+		segBytes := sizes[info]
+		if tmp.verbose() {
+			var extra string
+			if _, ok := merging[info]; ok {
+				extra = " [merging]"
+			}
+			if float64(segBytes) >= float64(tmp.maxMergedSegmentBytes)/2 {
+				extra += " [skip: too large]"
+			} else if segBytes < tmp.floorSegmentBytes {
+				extra += " [floored]"
+			}
+			tmp.message("  seg=%v size=%.3f MB%v",
+				w.readerPool.segmentToString(info), float64(segBytes)/1024/1024, extra)
+		}
+		if segBytes < minSegmentBytes {
+			minSegmentBytes = segBytes
+		}
+		// Accum total byte size
+		totIndexBytes += segBytes
+	}
+
+	// If we have too-large segments, grace them out of the maxSegmentCount:
+	tooBigCount := 0
+	for tooBigCount < len(infosSorted) &&
+		float64(sizes[infosSorted[tooBigCount]]) >= float64(tmp.maxMergedSegmentBytes)/2 {
+		totIndexBytes -= sizes[infosSorted[tooBigCount]]
+		tooBigCount++
+	}
+
+	minSegmentBytes = tmp.floorSize(minSegmentBytes)
+
+	// Compute max allowed segs in the index
+	levelSize := minSegmentBytes
+	bytesLeft := totIndexBytes
+	var allowedSegCount float64
+	for {
+		segCountLevel := float64(bytesLeft) / float64(levelSize)
+		if segCountLevel < tmp.segsPerTier {
+			allowedSegCount += math.Ceil(segCountLevel)
+			break
+		}
+		allowedSegCount += tmp.segsPerTier
+		bytesLeft -= int64(tmp.segsPerTier * float64(levelSize))
+		levelSize *= int64(tmp.maxMergeAtOnce)
+	}
+	allowedSegCountInt := int(allowedSegCount)
+
+	// Cycle to possibly select more than one merge:
+	for {
+		var mergingBytes int64
+
+		// Gather eligible segments for merging, ie segments not already
+		// being merged and not already picked (by prior iteration of
+		// this loop) for merging:
+		var eligible []*SegmentInfoPerCommit
+		for _, info := range infosSorted[tooBigCount:] {
+			if _, ok := merging[info]; ok {
+				n, err := info.SizeInBytes()
+				if err != nil {
+					return nil, err
+				}
+				mergingBytes += n
+			} else if _, ok := toBeMerged[info]; !ok {
+				eligible = append(eligible, info)
+			}
+		}
+
+		maxMergeIsRunning := mergingBytes >= tmp.maxMergedSegmentBytes
+
+		tmp.message("  allowedSegmentCount=%v vs count=%v (eligible count=%v) tooBigCount=%v",
+			allowedSegCountInt, len(infosSorted), len(eligible), tooBigCount)
+
+		if len(eligible) == 0 || len(eligible) < allowedSegCountInt {
+			return spec, nil
+		}
+
+		// OK we are over budget -- find best merge!
+		var best []*SegmentInfoPerCommit
+		var bestScore float64
+		var bestTooLarge bool
+		var bestMergeBytes int64
+
+		// Consider all merge starts:
+		for startIdx := 0; startIdx <= len(eligible)-tmp.maxMergeAtOnce; startIdx++ {
+			var totAfterMergeBytes int64
+			var candidate []*SegmentInfoPerCommit
+			hitTooLarge := false
+			for _, info := range eligible[startIdx:] {
+				if len(candidate) >= tmp.maxMergeAtOnce {
+					break
+				}
+				segBytes := sizes[info]
+				if totAfterMergeBytes+segBytes > tmp.maxMergedSegmentBytes {
+					hitTooLarge = true
+					// NOTE: we continue, so that we can try "packing" smaller
+					// segments into this merge to see if we can get closer to
+					// the max size; this in general is not perfect since this
+					// is really "bin packing" and we'd have to try different
+					// permutations.
+					continue
+				}
+				candidate = append(candidate, info)
+				totAfterMergeBytes += segBytes
+			}
+
+			score, err := tmp.score(candidate, hitTooLarge, sizes)
+			if err != nil {
+				return nil, err
+			}
+			tmp.message("  maybe=%v score=%v tooLarge=%v size=%.3f MB",
+				w.readerPool.segmentsToString(candidate), score, hitTooLarge,
+				float64(totAfterMergeBytes)/1024/1024)
+
+			// If we are already running a max sized merge (maxMergeIsRunning),
+			// don't allow another max sized merge to kick off:
+			if (best == nil || score < bestScore) && (!hitTooLarge || !maxMergeIsRunning) {
+				best = candidate
+				bestScore = score
+				bestTooLarge = hitTooLarge
+				bestMergeBytes = totAfterMergeBytes
+			}
+		}
+
+		if best == nil {
+			return spec, nil
+		}
+
+		merge := NewOneMerge(best)
+		spec = append(spec, merge)
+		for _, info := range merge.segments {
+			toBeMerged[info] = true
+		}
+
+		if tmp.verbose() {
+			var extra string
+			if bestTooLarge {
+				extra = " [max merge]"
+			}
+			tmp.message("  add merge=%v size=%.3f MB score=%v%v",
+				w.readerPool.segmentsToString(merge.segments),
+				float64(bestMergeBytes)/1024/1024, bestScore, extra)
+		}
+	}
+}
+
+// Expert: scores one merge; lower scores are preferred.
+func (tmp *TieredMergePolicy) FindForcedMerges(infos *SegmentInfos, maxSegmentCount int,
+	segmentsToMerge map[*SegmentInfoPerCommit]bool) (spec MergeSpecification, err error) {
+
+	w := tmp.writer.Get().(*IndexWriter)
+	if tmp.verbose() {
+		tmp.message("findForcedMerges maxSegmentCount=%v infos=%v segmentsToMerge=%v",
+			maxSegmentCount, w.readerPool.segmentsToString(infos.Segments), len(segmentsToMerge))
+	}
+
+	var eligible []*SegmentInfoPerCommit
+	forceMergeRunning := false
+	merging := w.mergingSegments
+	segmentIsOriginal := false
+	for _, info := range infos.Segments {
+		if isOriginal, ok := segmentsToMerge[info]; ok {
+			segmentIsOriginal = isOriginal
+			if _, ok := merging[info]; !ok {
+				eligible = append(eligible, info)
+			} else {
+				forceMergeRunning = true
+			}
+		}
+	}
+
+	if len(eligible) == 0 {
+		return nil, nil
+	}
+
+	if maxSegmentCount > 1 && len(eligible) <= maxSegmentCount ||
+		maxSegmentCount == 1 && len(eligible) == 1 && (!segmentIsOriginal || tmp.isMerged(eligible[0])) {
+		tmp.message("already merged")
+		return nil, nil
+	}
+
+	sizes := make(map[*SegmentInfoPerCommit]int64)
+	for _, info := range eligible {
+		if sizes[info], err = tmp.Size(info); err != nil {
+			return nil, err
+		}
+	}
+	sort.Sort(&segmentsBySizeDescending{eligible, sizes})
+
+	if tmp.verbose() {
+		tmp.message("eligible=%v", w.readerPool.segmentsToString(eligible))
+		tmp.message("forceMergeRunning=%v", forceMergeRunning)
+	}
+
+	end := len(eligible)
+
+	// Do full merges, first, backwards:
+	for end >= tmp.maxMergeAtOnceExplicit+maxSegmentCount-1 {
+		merge := NewOneMerge(eligible[end-tmp.maxMergeAtOnceExplicit : end])
+		tmp.message("add merge=%v", w.readerPool.segmentsToString(merge.segments))
+		spec = append(spec, merge)
+		end -= tmp.maxMergeAtOnceExplicit
+	}
+
+	if len(spec) == 0 && !forceMergeRunning {
+		// Do final merge
+		numToMerge := end - maxSegmentCount + 1
+		merge := NewOneMerge(eligible[end-numToMerge : end])
+		tmp.message("add final merge=%v", merge.segString(w.directory))
+		spec = append(spec, merge)
+	}
+
+	return spec, nil
+}
+
+func (tmp *TieredMergePolicy) score(candidate []*SegmentInfoPerCommit,
+	hitTooLarge bool, sizes map[*SegmentInfoPerCommit]int64) (float64, error) {
+
+	var totBeforeMergeBytes, totAfterMergeBytes, totAfterMergeBytesFloored int64
+	for _, info := range candidate {
+		segBytes := sizes[info]
+		totAfterMergeBytes += segBytes
+		totAfterMergeBytesFloored += tmp.floorSize(segBytes)
+		n, err := info.SizeInBytes()
+		if err != nil {
+			return 0, err
+		}
+		totBeforeMergeBytes += n
+	}
+
+	// Roughly measure "skew" of the merge, i.e. how "balanced" the
+	// merge is (whether it's merging 1 big segment with a bunch of
+	// small ones, or more balanced). Lower is better:
+	var skew float64
+	if hitTooLarge {
+		// Pretend the merge has perfect skew; skew doesn't matter in
+		// this case because this merge will not "cascade" and so it
+		// cannot lead to N^2 merge cost over time:
+		skew = 1.0 / float64(tmp.maxMergeAtOnce)
+	} else {
+		skew = float64(tmp.floorSize(sizes[candidate[0]])) / float64(totAfterMergeBytesFloored)
+	}
+
+	// Strongly favor merges with less skew (smaller mergeScore is
+	// better):
+	mergeScore := skew
+
+	// Gently favor smaller merges over bigger ones. We don't want to
+	// make this exponent too large else we can end up doing poor
+	// merges of small segments in order to avoid the large merges:
+	mergeScore *= math.Pow(float64(totAfterMergeBytes), 0.05)
+
+	// Strongly favor merges that reclaim deletes:
+	nonDelRatio := float64(totAfterMergeBytes) / float64(totBeforeMergeBytes)
+	mergeScore *= math.Pow(nonDelRatio, tmp.reclaimDeletesWeight)
+
+	return mergeScore, nil
+}
+
 func (tmp *TieredMergePolicy) Close() error { return nil }
 
 func (tmp *TieredMergePolicy) String() string {
@@ -571,7 +1143,198 @@ Returns true if the number of segments eligible for merging is less
 than or equal to the specified maxNumSegments.
 */
 func (mp *LogMergePolicy) isMergedBy(infos *SegmentInfos, maxNumSegments int, segmentsToMerge map[*SegmentInfoPerCommit]bool) bool {
-	panic("not implemented yet")
+	numToMerge := 0
+	var mergeInfo *SegmentInfoPerCommit
+	segmentIsOriginal := false
+	for i := 0; i < len(infos.Segments) && numToMerge <= maxNumSegments; i++ {
+		info := infos.Segments[i]
+		if isOriginal, ok := segmentsToMerge[info]; ok {
+			segmentIsOriginal = isOriginal
+			numToMerge++
+			mergeInfo = info
+		}
+	}
+	return numToMerge <= maxNumSegments &&
+		(numToMerge != 1 || !segmentIsOriginal || mp.isMerged(mergeInfo))
+}
+
+/*
+Returns the merges necessary to merge the index, taking the max merge
+size into consideration. This method attempts to respect the
+maxNumSegments parameter, however it might be, due to size
+constraints, that more than that number of segments will remain in
+the index. Also, this method does not guarantee that exactly
+maxNumSegments will remain, but <= that number.
+*/
+func (mp *LogMergePolicy) findForcedMergesSizeLimit(infos *SegmentInfos,
+	maxNumSegments, last int) (spec MergeSpecification, err error) {
+
+	segments := infos.Segments
+	start := last - 1
+	for start >= 0 {
+		info := segments[start]
+		size, err := mp.Size(info)
+		if err != nil {
+			return nil, err
+		}
+		if size > mp.maxMergeSizeForForcedMerge {
+			mp.message(fmt.Sprintf("findForcedMergesSizeLimit: skip segment=%v: size is > maxMergeSize (%v)",
+				info, mp.maxMergeSizeForForcedMerge))
+			// need to skip that segment + add a merge for the 'right'
+			// segments, unless there is only 1 which is merged.
+			if last-start-1 > 1 || start != last-1 && !mp.isMerged(segments[start+1]) {
+				// there is more than 1 segment to the right of this one,
+				// or a mergeable single segment.
+				spec = append(spec, NewOneMerge(segments[start+1:last]))
+			}
+			last = start
+		} else if last-start == mp.mergeFactor {
+			// mergeFactor eligible segments were found, add them as a merge.
+			spec = append(spec, NewOneMerge(segments[start:last]))
+			last = start
+		}
+		start--
+	}
+
+	// Add any left-over segments, unless there is just 1 already
+	// fully merged
+	if start++; last > 0 && (start+1 < last || !mp.isMerged(segments[start])) {
+		spec = append(spec, NewOneMerge(segments[start:last]))
+	}
+	return spec, nil
+}
+
+/*
+Returns the merges necessary to forceMerge the index. This method
+constraints the returned merges only by the maxNumSegments parameter,
+and guaranteed that exactly that number of segments will remain in
+the index.
+*/
+func (mp *LogMergePolicy) findForcedMergesMaxNumSegments(infos *SegmentInfos,
+	maxNumSegments, last int) (spec MergeSpecification, err error) {
+
+	segments := infos.Segments
+
+	// First, enroll all "full" merges (size mergeFactor) to
+	// potentially be run concurrently:
+	for last-maxNumSegments+1 >= mp.mergeFactor {
+		spec = append(spec, NewOneMerge(segments[last-mp.mergeFactor:last]))
+		last -= mp.mergeFactor
+	}
+
+	// Only if there are no full merges pending do we add a final
+	// partial (< mergeFactor segments) merge:
+	if len(spec) > 0 {
+		return spec, nil
+	}
+	if maxNumSegments == 1 {
+		// Since we must merge down to 1 segment, the choice is simple:
+		if last > 1 || !mp.isMerged(segments[0]) {
+			spec = append(spec, NewOneMerge(segments[:last]))
+		}
+	} else if last > maxNumSegments {
+		// Take care to pick a partial merge that is least cost, but
+		// does not make the index too lopsided. If we always just picked
+		// the partial tail then we could produce a highly lopsided index
+		// over time:
+
+		// We must merge this many segments to leave maxNumSegments in
+		// the index (from when forceMerge was first kicked off):
+		finalMergeSize := last - maxNumSegments + 1
+
+		// Consider all possible starting points:
+		var bestSize int64
+		bestStart := 0
+		for i := 0; i < last-finalMergeSize+1; i++ {
+			var sumSize int64
+			for j := 0; j < finalMergeSize; j++ {
+				size, err := mp.Size(segments[j+i])
+				if err != nil {
+					return nil, err
+				}
+				sumSize += size
+			}
+			if i == 0 {
+				bestStart, bestSize = i, sumSize
+				continue
+			}
+			prevSize, err := mp.Size(segments[i-1])
+			if err != nil {
+				return nil, err
+			}
+			if sumSize < 2*prevSize && sumSize < bestSize {
+				bestStart, bestSize = i, sumSize
+			}
+		}
+
+		spec = append(spec, NewOneMerge(segments[bestStart:bestStart+finalMergeSize]))
+	}
+	return spec, nil
+}
+
+/*
+Returns the merges necessary to merge the index down to a specified
+number of segments. This respects the maxMergeSizeForForcedMerge
+setting. By default, and assuming maxNumSegments=1, only one segment
+will be left in the index, where that segment has no deletions
+pending nor separate norms, and it is in compound file format if the
+current useCompoundFile setting is true. This method returns multiple
+merges (mergeFactor at a time) so the MergeScheduler in use may make
+use of concurrency.
+*/
+func (mp *LogMergePolicy) FindForcedMerges(infos *SegmentInfos, maxNumSegments int,
+	segmentsToMerge map[*SegmentInfoPerCommit]bool) (spec MergeSpecification, err error) {
+
+	assert(maxNumSegments > 0)
+	mp.message(fmt.Sprintf("findForcedMerges: maxNumSegs=%v segsToMerge=%v",
+		maxNumSegments, len(segmentsToMerge)))
+
+	// If the segments are already merged (e.g. there's only 1
+	// segment), or there are <maxNumSegments:
+	if mp.isMergedBy(infos, maxNumSegments, segmentsToMerge) {
+		mp.message("already merged; skip")
+		return nil, nil
+	}
+
+	// Find the newest (rightmost) segment that needs to be merged
+	// (other segments may have been flushed since merging started):
+	last := len(infos.Segments)
+	for last > 0 {
+		last--
+		if _, ok := segmentsToMerge[infos.Segments[last]]; ok {
+			last++
+			break
+		}
+	}
+
+	if last == 0 {
+		mp.message("last == 0; skip")
+		return nil, nil
+	}
+
+	// There is only one segment already, and it is merged
+	if maxNumSegments == 1 && last == 1 && mp.isMerged(infos.Segments[0]) {
+		mp.message("already 1 seg; skip")
+		return nil, nil
+	}
+
+	// Check if there are any segments above the threshold
+	anyTooLarge := false
+	for _, info := range infos.Segments[:last] {
+		size, err := mp.Size(info)
+		if err != nil {
+			return nil, err
+		}
+		if size > mp.maxMergeSizeForForcedMerge {
+			anyTooLarge = true
+			break
+		}
+	}
+
+	if anyTooLarge {
+		return mp.findForcedMergesSizeLimit(infos, maxNumSegments, last)
+	}
+	return mp.findForcedMergesMaxNumSegments(infos, maxNumSegments, last)
 }
 
 type SegmentInfoAndLevel struct {
@@ -689,7 +1452,44 @@ func (mp *LogMergePolicy) FindMerges(mergeTrigger MergeTrigger, infos *SegmentIn
 		// Finally, record all merges that are viable at this level:
 		end := start + mp.mergeFactor
 		for end <= 1+upto {
-			panic("not implemented yet")
+			anyTooLarge := false
+			anyMerging := false
+			for i := start; i < end; i++ {
+				info := levels[i].info
+				size, err := mp.Size(info)
+				if err != nil {
+					return nil, err
+				}
+				if size >= mp.maxMergeSize {
+					anyTooLarge = true
+				}
+				if _, ok := mergingSegments[info]; ok {
+					anyMerging = true
+					break
+				}
+			}
+
+			if anyMerging {
+				// skip
+			} else if !anyTooLarge {
+				mergeInfos := make([]*SegmentInfoPerCommit, 0, end-start)
+				for i := start; i < end; i++ {
+					mergeInfos = append(mergeInfos, levels[i].info)
+					assert(infos.indexOf(levels[i].info) != -1)
+				}
+				if mp.verbose() {
+					mp.message(fmt.Sprintf("  add merge=%v start=%v end=%v",
+						mp.writer.Get().(*IndexWriter).readerPool.segmentsToString(mergeInfos),
+						start, end))
+				}
+				spec = append(spec, NewOneMerge(mergeInfos))
+			} else if mp.verbose() {
+				mp.message(fmt.Sprintf("    %v to %v: contains segment over maxMergeSize or maxMergeDocs; skipping",
+					start, end))
+			}
+
+			start = end
+			end = start + mp.mergeFactor
 		}
 
 		start = 1 + upto
@@ -699,7 +1499,9 @@ func (mp *LogMergePolicy) FindMerges(mergeTrigger MergeTrigger, infos *SegmentIn
 }
 
 func (mp *LogMergePolicy) String() string {
-	panic("not implemented yet")
+	return fmt.Sprintf("[LogMergePolicy: minMergeSize=%v, mergeFactor=%v, maxMergeSize=%v, maxMergeSizeForForcedMerge=%v, calibrateSizeByDeletes=%v, maxCFSSegmentSizeMB=%v, noCFSRatio=%v]",
+		mp.minMergeSize, mp.mergeFactor, mp.maxMergeSize, mp.maxMergeSizeForForcedMerge,
+		mp.calibrateSizeByDeletes, mp.maxCFSSegmentSize/1024/1024, mp.noCFSRatio)
 }
 
 // index/LogDocMergePolicy.java
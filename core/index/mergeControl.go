@@ -23,7 +23,7 @@ type MergeControl struct {
 }
 
 func newMergeControl(infoStream util.InfoStream, readerPool *ReaderPool) *MergeControl {
-	return &MergeControl{
+	ans := &MergeControl{
 		Locker:          &sync.Mutex{},
 		infoStream:      infoStream,
 		readerPool:      readerPool,
@@ -31,6 +31,8 @@ func newMergeControl(infoStream util.InfoStream, readerPool *ReaderPool) *MergeC
 		pendingMerges:   list.New(),
 		runningMerges:   make(map[*OneMerge]bool),
 	}
+	ans.mergeSignal = sync.NewCond(ans.Locker)
+	return ans
 }
 
 // L2183
@@ -131,7 +133,5 @@ func (mc *MergeControl) mergeFinish(merge *OneMerge) {
 	}
 
 	delete(mc.runningMerges, merge)
-	if len(mc.runningMerges) == 0 {
-		mc.mergeSignal.Signal()
-	}
+	mc.mergeSignal.Broadcast()
 }
@@ -44,6 +44,12 @@ func NewFieldInfo(name string, indexed bool, number int32, storeTermVector, omit
 /* Returns IndexOptions for the field, or 0 if the field is not indexed */
 func (info FieldInfo) IndexOptions() IndexOptions { return info.indexOptions }
 
+/* Returns DocValuesType of the docValues. This may be 0 if the field has no docvalues. */
+func (info FieldInfo) DocValuesType() DocValuesType { return info.docValueType }
+
+/* Returns DocValuesType of the norm. This may be 0 if the field has no norms. */
+func (info FieldInfo) NormType() DocValuesType { return info.normType }
+
 /* Returns true if this field has any docValues. */
 func (info FieldInfo) HasDocValues() bool {
 	return int(info.docValueType) != 0
@@ -64,6 +70,44 @@ func (info FieldInfo) HasPayloads() bool { return info.storePayloads }
 /* Returns true if any term vectors exist for this field. */
 func (info FieldInfo) HasVectors() bool { return info.storeTermVector }
 
+/*
+Returns a copy of this FieldInfo, updated with the given indexing
+settings. Once indexed, a field is always indexed; vectors, payloads
+and omitted norms are sticky, while index options can only be
+downgraded.
+*/
+func (info FieldInfo) update(indexed, storeTermVector, omitNorms, storePayloads bool,
+	indexOptions IndexOptions) FieldInfo {
+	if info.indexed != indexed {
+		info.indexed = true // once indexed, always index
+	}
+	if indexed { // if updated field data is not for indexing, leave the updates out
+		if info.storeTermVector != storeTermVector {
+			info.storeTermVector = true // once vector, always vector
+		}
+		if info.storePayloads != storePayloads {
+			info.storePayloads = true
+		}
+		if info.omitNorms != omitNorms {
+			info.omitNorms = true // if one require omitNorms at least once, it remains off for life
+			info.normType = 0
+		}
+		if info.indexOptions != indexOptions {
+			if info.indexOptions == 0 {
+				info.indexOptions = indexOptions
+			} else if indexOptions < info.indexOptions {
+				// downgrade
+				info.indexOptions = indexOptions
+			}
+			if info.indexOptions < INDEX_OPT_DOCS_AND_FREQS_AND_POSITIONS {
+				// cannot store payloads if we don't store positions:
+				info.storePayloads = false
+			}
+		}
+	}
+	return info
+}
+
 func (fi FieldInfo) String() string {
 	return fmt.Sprintf("%v-%v, isIndexed=%v, docValueType=%v, hasVectors=%v, normType=%v, omitNorms=%v, indexOptions=%v, hasPayloads=%v, attributes=%v",
 		fi.Number, fi.Name, fi.indexed, fi.docValueType, fi.storeTermVector, fi.normType, fi.omitNorms, fi.indexOptions, fi.storePayloads, fi.attributes)
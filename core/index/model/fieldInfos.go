@@ -107,6 +107,15 @@ func NewFieldNumbers() *FieldNumbers {
 	}
 }
 
+/* Forgets all field numbers, e.g. after IndexWriter.DeleteAll(). */
+func (fn *FieldNumbers) Clear() {
+	fn.Lock()
+	defer fn.Unlock()
+	fn.numberToName = make(map[int]string)
+	fn.nameToNumber = make(map[string]int)
+	fn.docValuesType = make(map[string]DocValuesType)
+}
+
 func (fn *FieldNumbers) AddOrGet(info FieldInfo) int {
 	return fn.addOrGet(info.Name, int(info.Number), info.docValueType)
 }
@@ -137,7 +146,7 @@ func (fn *FieldNumbers) addOrGet(name string, preferredNumber int, dv DocValuesT
 			number = preferredNumber
 		} else {
 			// find a new FieldNumber
-			for _, ok = fn.numberToName[fn.lowestUnassignedFieldNumber]; ok; {
+			for _, ok = fn.numberToName[fn.lowestUnassignedFieldNumber]; ok; _, ok = fn.numberToName[fn.lowestUnassignedFieldNumber] {
 				// might not be up to date - lets do the work once needed
 				fn.lowestUnassignedFieldNumber++
 			}
@@ -173,6 +182,93 @@ func assert2(ok bool, msg string, args ...interface{}) {
 	}
 }
 
+/*
+Adds the given FieldInfo, or merges its settings into the FieldInfo
+with the same name already added to this builder. Returns the
+resulting FieldInfo.
+*/
+func (b *FieldInfosBuilder) Add(fi FieldInfo) FieldInfo {
+	// IMPORTANT - reuse the field number if possible for consistent field numbers across segments
+	return b.addOrUpdateInternal(fi.Name, int(fi.Number), fi.indexed,
+		fi.storeTermVector, fi.omitNorms, fi.storePayloads, fi.indexOptions,
+		fi.docValueType, fi.normType)
+}
+
+/*
+Adds a field of the given name with the given indexing settings, or
+merges them into the FieldInfo of the same name already added.
+Returns the resulting FieldInfo. Payloads and norms are turned on
+separately, once the indexing chain has seen the field actually has
+them.
+*/
+func (b *FieldInfosBuilder) AddOrUpdate(name string, indexed, storeTermVector,
+	omitNorms bool, indexOptions IndexOptions, docValues DocValuesType) FieldInfo {
+	return b.addOrUpdateInternal(name, -1, indexed, storeTermVector, omitNorms,
+		false, indexOptions, docValues, 0)
+}
+
+/* Returns the FieldInfo of the given name, if it was added. */
+func (b *FieldInfosBuilder) FieldInfo(name string) (fi FieldInfo, ok bool) {
+	fi, ok = b.byName[name]
+	return
+}
+
+/*
+Records that the given field has payloads, if it indexes positions.
+*/
+func (b *FieldInfosBuilder) SetStorePayloads(name string) FieldInfo {
+	fi, ok := b.byName[name]
+	assert2(ok, "unknown field '%v'", name)
+	if fi.indexed && fi.indexOptions >= INDEX_OPT_DOCS_AND_FREQS_AND_POSITIONS {
+		fi.storePayloads = true
+	}
+	b.byName[name] = fi
+	return fi
+}
+
+/* Sets the type of the norms of the given field. */
+func (b *FieldInfosBuilder) SetNormValueType(name string, normType DocValuesType) FieldInfo {
+	fi, ok := b.byName[name]
+	assert2(ok, "unknown field '%v'", name)
+	fi.normType = normType
+	b.byName[name] = fi
+	return fi
+}
+
+func (b *FieldInfosBuilder) addOrUpdateInternal(name string, preferredFieldNumber int,
+	isIndexed, storeTermVector, omitNorms, storePayloads bool,
+	indexOptions IndexOptions, docValues, normType DocValuesType) FieldInfo {
+
+	fi, ok := b.byName[name]
+	if !ok {
+		// This field wasn't yet added to this in-RAM segment's FieldInfo,
+		// so now we get a global number for this field. If the field was
+		// seen before then we'll get the same name and number, else we'll
+		// allocate a new one:
+		fieldNumber := b.globalFieldNumbers.addOrGet(name, preferredFieldNumber, docValues)
+		fi = NewFieldInfo(name, isIndexed, int32(fieldNumber), storeTermVector,
+			omitNorms, storePayloads, indexOptions, docValues, normType, nil)
+	} else {
+		fi = fi.update(isIndexed, storeTermVector, omitNorms, storePayloads, indexOptions)
+		if docValues != 0 {
+			if !fi.HasDocValues() {
+				// make sure the global field numbers know about the type
+				b.globalFieldNumbers.addOrGet(name, int(fi.Number), docValues)
+			} else {
+				assert2(fi.docValueType == docValues,
+					"cannot change DocValues type from %v to %v for field '%v'",
+					fi.docValueType, docValues, name)
+			}
+			fi.docValueType = docValues
+		}
+		if !fi.omitNorms && normType != 0 {
+			fi.normType = normType
+		}
+	}
+	b.byName[name] = fi
+	return fi
+}
+
 func (b *FieldInfosBuilder) Finish() FieldInfos {
 	var infos []FieldInfo
 	for _, v := range b.byName {
@@ -16,3 +16,22 @@ func (m *AttributesMixin) Attribute(key string) string {
 func (m *AttributesMixin) Attributes() map[string]string {
 	return m.attributes
 }
+
+/*
+Puts a codec attribute value.
+
+This is a key-value mapping for the field that the codec can use to
+store additional metadata, and will be available to the codec when
+reading the segment via Attribute().
+
+If a value already exists for the field, it will be replaced with the
+new value, and the old value is returned.
+*/
+func (m *AttributesMixin) PutAttribute(key, value string) string {
+	if m.attributes == nil {
+		m.attributes = make(map[string]string)
+	}
+	old := m.attributes[key]
+	m.attributes[key] = value
+	return old
+}
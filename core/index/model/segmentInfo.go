@@ -27,6 +27,11 @@ func (info *SegmentInfo) Diagnostics() map[string]string {
 	return info.diagnostics
 }
 
+/* Sets diagnostics. */
+func (info *SegmentInfo) SetDiagnostics(diagnostics map[string]string) {
+	info.diagnostics = diagnostics
+}
+
 func NewSegmentInfo(dir store.Directory, version, name string, docCount int,
 	isComoundFile bool, codec interface{}, diagnostics map[string]string, attributes map[string]string) *SegmentInfo {
 	_, ok := dir.(*store.TrackingDirectoryWrapper)
@@ -53,6 +58,15 @@ func (si *SegmentInfo) IsCompoundFile() bool {
 	return si.isCompoundFile
 }
 
+/*
+Mark whether this segment is stored as a compound file.
+
+If useCompoundFile is true, this segment is stored as a compound file
+*/
+func (si *SegmentInfo) SetUseCompoundFile(isCompoundFile bool) {
+	si.isCompoundFile = isCompoundFile
+}
+
 /* Can only be called once. */
 func (info *SegmentInfo) SetCodec(codec interface{}) {
 	assert(info.codec == nil)
@@ -125,6 +139,20 @@ func (si *SegmentInfo) SetFiles(files map[string]bool) {
 	si.files = files
 }
 
+/* Add these files to the set of files written for this segment. */
+func (si *SegmentInfo) AddFiles(files map[string]bool) {
+	si.checkFileNames(files)
+	for file, _ := range files {
+		si.files[file] = true
+	}
+}
+
+/* Add this file to the set of files written for this segment. */
+func (si *SegmentInfo) AddFile(file string) {
+	si.checkFileNames(map[string]bool{file: true})
+	si.files[file] = true
+}
+
 var CODEC_FILE_PATTERN = regexp.MustCompile("_[a-z0-9]+(_.*)?\\..*")
 
 func (si *SegmentInfo) checkFileNames(files map[string]bool) {
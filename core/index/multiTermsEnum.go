@@ -0,0 +1,576 @@
+package index
+
+import (
+	"bytes"
+	"container/heap"
+	"fmt"
+	"github.com/balzaczyy/golucene/core/util"
+	"sort"
+)
+
+// index/MultiTermsEnum.java
+
+// Holds a TermsEnum and the index of the sub-reader it belongs to.
+type termsEnumIndex struct {
+	subIndex  int
+	termsEnum TermsEnum
+}
+
+type termsEnumWithSlice struct {
+	subSlice ReaderSlice
+	terms    TermsEnum
+	current  []byte
+	index    int
+}
+
+func (e *termsEnumWithSlice) reset(terms TermsEnum, term []byte) {
+	e.terms = terms
+	e.current = term
+}
+
+func (e *termsEnumWithSlice) String() string {
+	return fmt.Sprintf("%v:%v", e.subSlice, e.terms)
+}
+
+// Priority queue of sub enums, ordered by their current term.
+type termMergeQueue []*termsEnumWithSlice
+
+func (q termMergeQueue) Len() int      { return len(q) }
+func (q termMergeQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q termMergeQueue) Less(i, j int) bool {
+	if cmp := bytes.Compare(q[i].current, q[j].current); cmp != 0 {
+		return cmp < 0
+	}
+	return q[i].subSlice.start < q[j].subSlice.start
+}
+
+func (q *termMergeQueue) Push(x interface{}) {
+	*q = append(*q, x.(*termsEnumWithSlice))
+}
+
+func (q *termMergeQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	ans := old[n-1]
+	*q = old[:n-1]
+	return ans
+}
+
+/*
+Exposes TermsEnum API, merged from TermsEnum API of sub-segments.
+This does a merge sort, by term text, of the sub-readers.
+*/
+type MultiTermsEnum struct {
+	*TermsEnumImpl
+
+	queue       *termMergeQueue
+	subs        []*termsEnumWithSlice // all of our subs (one per sub-reader)
+	currentSubs []*termsEnumWithSlice // current subs that have at least one term for this field
+	top         []*termsEnumWithSlice
+
+	numTop  int
+	numSubs int
+	current []byte
+}
+
+/*
+Sole constructor. slices specifies which sub-reader slices the
+TermsEnums passed to reset() belong to.
+*/
+func NewMultiTermsEnum(slices []ReaderSlice) *MultiTermsEnum {
+	ans := &MultiTermsEnum{
+		queue:       new(termMergeQueue),
+		subs:        make([]*termsEnumWithSlice, len(slices)),
+		currentSubs: make([]*termsEnumWithSlice, len(slices)),
+		top:         make([]*termsEnumWithSlice, len(slices)),
+	}
+	ans.TermsEnumImpl = newTermsEnumImpl(ans)
+	for i, slice := range slices {
+		ans.subs[i] = &termsEnumWithSlice{subSlice: slice, index: i}
+		assert(slice.length >= 0)
+	}
+	return ans
+}
+
+// Returns how many sub-reader slices contain the current term.
+func (e *MultiTermsEnum) MatchCount() int {
+	return e.numTop
+}
+
+/*
+The terms array must be newly created TermsEnum, ie Next() has not
+yet been called.
+*/
+func (e *MultiTermsEnum) reset(termsEnumsIndex []*termsEnumIndex) (TermsEnum, error) {
+	assert(len(termsEnumsIndex) <= len(e.top))
+	e.numSubs = 0
+	e.numTop = 0
+	*e.queue = (*e.queue)[:0]
+	for _, termsEnumIndex := range termsEnumsIndex {
+		assert(termsEnumIndex != nil)
+
+		term, err := termsEnumIndex.termsEnum.Next()
+		if err != nil {
+			return nil, err
+		}
+		if term != nil {
+			entry := e.subs[termsEnumIndex.subIndex]
+			entry.reset(termsEnumIndex.termsEnum, term)
+			heap.Push(e.queue, entry)
+			e.currentSubs[e.numSubs] = entry
+			e.numSubs++
+		} else {
+			// field has no terms
+		}
+	}
+
+	if e.queue.Len() == 0 {
+		return EMPTY_TERMS_ENUM, nil
+	}
+	return e, nil
+}
+
+func (e *MultiTermsEnum) Term() []byte {
+	return e.current
+}
+
+func (e *MultiTermsEnum) Comparator() sort.Interface {
+	if e.numSubs > 0 {
+		return e.currentSubs[0].terms.Comparator()
+	}
+	return nil
+}
+
+func (e *MultiTermsEnum) SeekExact(term []byte) (ok bool, err error) {
+	*e.queue = (*e.queue)[:0]
+	e.numTop = 0
+
+	for _, sub := range e.currentSubs[:e.numSubs] {
+		found, err := sub.terms.SeekExact(term)
+		if err != nil {
+			return false, err
+		}
+		if found {
+			e.top[e.numTop] = sub
+			e.numTop++
+			sub.current = sub.terms.Term()
+		}
+	}
+
+	// if at least one sub had exact match to the requested term then
+	// we found match
+	if e.numTop > 0 {
+		e.current = term
+		return true, nil
+	}
+	return false, nil
+}
+
+func (e *MultiTermsEnum) SeekCeil(term []byte) SeekStatus {
+	*e.queue = (*e.queue)[:0]
+	e.numTop = 0
+
+	for _, sub := range e.currentSubs[:e.numSubs] {
+		switch status := sub.terms.SeekCeil(term); status {
+		case SEEK_STATUS_FOUND:
+			e.top[e.numTop] = sub
+			e.numTop++
+			sub.current = sub.terms.Term()
+		case SEEK_STATUS_NOT_FOUND:
+			sub.current = sub.terms.Term()
+			heap.Push(e.queue, sub)
+		default:
+			// enum exhausted
+			sub.current = nil
+		}
+	}
+
+	if e.numTop > 0 {
+		// at least one sub had exact match to the requested term
+		e.current = term
+		return SEEK_STATUS_FOUND
+	} else if e.queue.Len() > 0 {
+		// no sub had exact match, but at least one sub found a term
+		// after the requested term -- advance to that next term:
+		e.pullTop()
+		return SEEK_STATUS_NOT_FOUND
+	}
+	return SEEK_STATUS_END
+}
+
+func (e *MultiTermsEnum) SeekExactByPosition(ord int64) error {
+	panic("not supported")
+}
+
+func (e *MultiTermsEnum) Ord() int64 {
+	panic("not supported")
+}
+
+func (e *MultiTermsEnum) pullTop() {
+	// extract all subs from the queue that have the same top term
+	assert(e.numTop == 0)
+	for {
+		e.top[e.numTop] = heap.Pop(e.queue).(*termsEnumWithSlice)
+		e.numTop++
+		if e.queue.Len() == 0 || !bytes.Equal((*e.queue)[0].current, e.top[0].current) {
+			break
+		}
+	}
+	e.current = e.top[0].current
+}
+
+func (e *MultiTermsEnum) pushTop() (err error) {
+	// call next() on each top, and put back into queue
+	for _, top := range e.top[:e.numTop] {
+		if top.current, err = top.terms.Next(); err != nil {
+			return err
+		}
+		if top.current != nil {
+			heap.Push(e.queue, top)
+		} else {
+			// no more fields in this reader
+		}
+	}
+	e.numTop = 0
+	return nil
+}
+
+func (e *MultiTermsEnum) Next() (term []byte, err error) {
+	// restore queue
+	if err = e.pushTop(); err != nil {
+		return nil, err
+	}
+
+	// gather equal top fields
+	if e.queue.Len() > 0 {
+		e.pullTop()
+	} else {
+		e.current = nil
+	}
+	return e.current, nil
+}
+
+func (e *MultiTermsEnum) DocFreq() (sum int, err error) {
+	for _, top := range e.top[:e.numTop] {
+		df, err := top.terms.DocFreq()
+		if err != nil {
+			return 0, err
+		}
+		sum += df
+	}
+	return sum, nil
+}
+
+func (e *MultiTermsEnum) TotalTermFreq() (sum int64, err error) {
+	for _, top := range e.top[:e.numTop] {
+		v, err := top.terms.TotalTermFreq()
+		if err != nil {
+			return 0, err
+		}
+		if v == -1 {
+			return v, nil
+		}
+		sum += v
+	}
+	return sum, nil
+}
+
+// Sorts the current top subs by their sub-reader index.
+func (e *MultiTermsEnum) sortTop() {
+	top := e.top[:e.numTop]
+	sort.Sort(topByIndex(top))
+}
+
+type topByIndex []*termsEnumWithSlice
+
+func (s topByIndex) Len() int           { return len(s) }
+func (s topByIndex) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s topByIndex) Less(i, j int) bool { return s[i].index < s[j].index }
+
+func subLiveDocs(liveDocs util.Bits, slice ReaderSlice) util.Bits {
+	if liveDocs == nil {
+		return nil
+	}
+	return newBitsSlice(liveDocs, slice)
+}
+
+func (e *MultiTermsEnum) DocsByFlags(liveDocs util.Bits, reuse DocsEnum, flags int) (DocsEnum, error) {
+	docsEnum, ok := reuse.(*MultiDocsEnum)
+	// Can only reuse if incoming enum is also a MultiDocsEnum, and it
+	// was obtained from this MultiTermsEnum
+	if !ok || !docsEnum.canReuse(e) {
+		docsEnum = newMultiDocsEnum(e, len(e.subs))
+	}
+
+	upto := 0
+	e.sortTop()
+	for _, entry := range e.top[:e.numTop] {
+		subDocsEnum, err := entry.terms.DocsByFlags(subLiveDocs(liveDocs, entry.subSlice),
+			docsEnum.subDocsEnum[entry.index], flags)
+		if err != nil {
+			return nil, err
+		}
+		if subDocsEnum != nil {
+			docsEnum.subDocsEnum[entry.index] = subDocsEnum
+			docsEnum.subs[upto] = docsEnumWithSlice{subDocsEnum, entry.subSlice}
+			upto++
+		} else {
+			// should this be an error?
+			panic("One of our subs cannot provide a docsenum")
+		}
+	}
+
+	if upto == 0 {
+		return nil, nil
+	}
+	return docsEnum.reset(docsEnum.subs[:upto]), nil
+}
+
+func (e *MultiTermsEnum) DocsAndPositionsByFlags(liveDocs util.Bits,
+	reuse DocsAndPositionsEnum, flags int) DocsAndPositionsEnum {
+
+	docsAndPositionsEnum, ok := reuse.(*MultiDocsAndPositionsEnum)
+	// Can only reuse if incoming enum is also a
+	// MultiDocsAndPositionsEnum, and it was obtained from this
+	// MultiTermsEnum
+	if !ok || !docsAndPositionsEnum.canReuse(e) {
+		docsAndPositionsEnum = newMultiDocsAndPositionsEnum(e, len(e.subs))
+	}
+
+	upto := 0
+	e.sortTop()
+	for _, entry := range e.top[:e.numTop] {
+		subPostings := entry.terms.DocsAndPositionsByFlags(
+			subLiveDocs(liveDocs, entry.subSlice),
+			docsAndPositionsEnum.subDocsAndPositionsEnum[entry.index], flags)
+
+		if subPostings == nil {
+			// At least one of our subs does not store offsets or
+			// positions -- we can't correctly produce a MultiDocsAndPositions
+			// enum
+			return nil
+		}
+		docsAndPositionsEnum.subDocsAndPositionsEnum[entry.index] = subPostings
+		docsAndPositionsEnum.subs[upto] = docsAndPositionsEnumWithSlice{subPostings, entry.subSlice}
+		upto++
+	}
+
+	if upto == 0 {
+		return nil
+	}
+	return docsAndPositionsEnum.reset(docsAndPositionsEnum.subs[:upto])
+}
+
+func (e *MultiTermsEnum) String() string {
+	return fmt.Sprintf("MultiTermsEnum(%v)", e.subs)
+}
+
+// index/BitsSlice.java
+
+// Exposes a slice of an existing Bits as a new Bits.
+type bitsSlice struct {
+	parent util.Bits
+	start  int
+	length int
+}
+
+// start is inclusive; end is exclusive (length = end-start)
+func newBitsSlice(parent util.Bits, slice ReaderSlice) *bitsSlice {
+	assert(slice.length >= 0)
+	return &bitsSlice{parent, slice.start, slice.length}
+}
+
+func (b *bitsSlice) At(doc int) bool {
+	assert2(doc < b.length, fmt.Sprintf("doc=%v length=%v", doc, b.length))
+	return b.parent.At(doc + b.start)
+}
+
+func (b *bitsSlice) Length() int {
+	return b.length
+}
+
+// index/MultiDocsEnum.java
+
+// Holds a DocsEnum along with the corresponding ReaderSlice.
+type docsEnumWithSlice struct {
+	docsEnum DocsEnum
+	slice    ReaderSlice
+}
+
+/*
+Exposes DocsEnum, merged from DocsEnum API of sub-segments.
+*/
+type MultiDocsEnum struct {
+	parent      *MultiTermsEnum
+	subDocsEnum []DocsEnum
+	subs        []docsEnumWithSlice
+	numSubs     int
+	upto        int
+	current     DocsEnum
+	currentBase int
+	doc         int
+}
+
+func newMultiDocsEnum(parent *MultiTermsEnum, subReaderCount int) *MultiDocsEnum {
+	return &MultiDocsEnum{
+		parent:      parent,
+		subDocsEnum: make([]DocsEnum, subReaderCount),
+		subs:        make([]docsEnumWithSlice, subReaderCount),
+		doc:         -1,
+	}
+}
+
+func (e *MultiDocsEnum) reset(subs []docsEnumWithSlice) *MultiDocsEnum {
+	e.numSubs = len(subs)
+	for i, sub := range subs {
+		e.subs[i] = sub
+	}
+	e.upto = -1
+	e.doc = -1
+	e.current = nil
+	return e
+}
+
+// Returns true if this instance can be reused by the provided
+// MultiTermsEnum.
+func (e *MultiDocsEnum) canReuse(parent *MultiTermsEnum) bool {
+	return e.parent == parent
+}
+
+func (e *MultiDocsEnum) Freq() (int, error) {
+	return e.current.Freq()
+}
+
+func (e *MultiDocsEnum) DocId() int {
+	return e.doc
+}
+
+func (e *MultiDocsEnum) NextDoc() (int, error) {
+	for {
+		if e.current == nil {
+			if e.upto == e.numSubs-1 {
+				e.doc = NO_MORE_DOCS
+				return e.doc, nil
+			}
+			e.upto++
+			e.current = e.subs[e.upto].docsEnum
+			e.currentBase = e.subs[e.upto].slice.start
+		}
+
+		doc, err := e.current.NextDoc()
+		if err != nil {
+			return 0, err
+		}
+		if doc != NO_MORE_DOCS {
+			e.doc = e.currentBase + doc
+			return e.doc, nil
+		}
+		e.current = nil
+	}
+}
+
+func (e *MultiDocsEnum) String() string {
+	return fmt.Sprintf("MultiDocsEnum(%v)", e.subs[:e.numSubs])
+}
+
+// index/MultiDocsAndPositionsEnum.java
+
+// Holds a DocsAndPositionsEnum along with the corresponding ReaderSlice.
+type docsAndPositionsEnumWithSlice struct {
+	docsAndPositionsEnum DocsAndPositionsEnum
+	slice                ReaderSlice
+}
+
+/*
+Exposes DocsAndPositionsEnum, merged from DocsAndPositionsEnum API of
+sub-segments.
+*/
+type MultiDocsAndPositionsEnum struct {
+	parent                  *MultiTermsEnum
+	subDocsAndPositionsEnum []DocsAndPositionsEnum
+	subs                    []docsAndPositionsEnumWithSlice
+	numSubs                 int
+	upto                    int
+	current                 DocsAndPositionsEnum
+	currentBase             int
+	doc                     int
+}
+
+func newMultiDocsAndPositionsEnum(parent *MultiTermsEnum, subReaderCount int) *MultiDocsAndPositionsEnum {
+	return &MultiDocsAndPositionsEnum{
+		parent:                  parent,
+		subDocsAndPositionsEnum: make([]DocsAndPositionsEnum, subReaderCount),
+		subs:                    make([]docsAndPositionsEnumWithSlice, subReaderCount),
+		doc:                     -1,
+	}
+}
+
+func (e *MultiDocsAndPositionsEnum) reset(subs []docsAndPositionsEnumWithSlice) *MultiDocsAndPositionsEnum {
+	e.numSubs = len(subs)
+	for i, sub := range subs {
+		e.subs[i] = sub
+	}
+	e.upto = -1
+	e.doc = -1
+	e.current = nil
+	return e
+}
+
+// Returns true if this instance can be reused by the provided
+// MultiTermsEnum.
+func (e *MultiDocsAndPositionsEnum) canReuse(parent *MultiTermsEnum) bool {
+	return e.parent == parent
+}
+
+func (e *MultiDocsAndPositionsEnum) Freq() (int, error) {
+	assert(e.current != nil)
+	return e.current.Freq()
+}
+
+func (e *MultiDocsAndPositionsEnum) DocId() int {
+	return e.doc
+}
+
+func (e *MultiDocsAndPositionsEnum) NextDoc() (int, error) {
+	for {
+		if e.current == nil {
+			if e.upto == e.numSubs-1 {
+				e.doc = NO_MORE_DOCS
+				return e.doc, nil
+			}
+			e.upto++
+			e.current = e.subs[e.upto].docsAndPositionsEnum
+			e.currentBase = e.subs[e.upto].slice.start
+		}
+
+		doc, err := e.current.NextDoc()
+		if err != nil {
+			return 0, err
+		}
+		if doc != NO_MORE_DOCS {
+			e.doc = e.currentBase + doc
+			return e.doc, nil
+		}
+		e.current = nil
+	}
+}
+
+func (e *MultiDocsAndPositionsEnum) NextPosition() (int, error) {
+	return e.current.NextPosition()
+}
+
+func (e *MultiDocsAndPositionsEnum) StartOffset() (int, error) {
+	return e.current.StartOffset()
+}
+
+func (e *MultiDocsAndPositionsEnum) EndOffset() (int, error) {
+	return e.current.EndOffset()
+}
+
+func (e *MultiDocsAndPositionsEnum) Payload() ([]byte, error) {
+	return e.current.Payload()
+}
+
+func (e *MultiDocsAndPositionsEnum) String() string {
+	return fmt.Sprintf("MultiDocsAndPositionsEnum(%v)", e.subs[:e.numSubs])
+}
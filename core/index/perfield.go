@@ -1,10 +1,13 @@
 package index
 
 import (
+	"errors"
+	"fmt"
 	"github.com/balzaczyy/golucene/core/index/model"
 	"github.com/balzaczyy/golucene/core/util"
 	"io"
 	"log"
+	"strconv"
 )
 
 // perfield/PerFieldPostingsFormat.java
@@ -22,10 +25,11 @@ the format name. For example, in a per-field configuration instead of
 _1.prx fielnames would look like _1_Lucene40_0.prx.
 */
 type PerFieldPostingsFormat struct {
+	postingsFormatForField func(field string) PostingsFormat
 }
 
 func newPerFieldPostingsFormat(f func(field string) PostingsFormat) *PerFieldPostingsFormat {
-	return &PerFieldPostingsFormat{}
+	return &PerFieldPostingsFormat{f}
 }
 
 func (pf *PerFieldPostingsFormat) Name() string {
@@ -33,7 +37,7 @@ func (pf *PerFieldPostingsFormat) Name() string {
 }
 
 func (pf *PerFieldPostingsFormat) FieldsConsumer(state SegmentWriteState) (w FieldsConsumer, err error) {
-	panic("not implemented yet")
+	return newPerFieldPostingsWriter(pf, state), nil
 }
 
 func (pf *PerFieldPostingsFormat) FieldsProducer(state SegmentReadState) (r FieldsProducer, err error) {
@@ -45,6 +49,85 @@ const (
 	PER_FIELD_SUFFIX_KEY = "PerFieldPostingsFormat.suffix"
 )
 
+type perFieldFieldsConsumerAndSuffix struct {
+	consumer FieldsConsumer
+	suffix   int
+}
+
+type PerFieldPostingsWriter struct {
+	owner             *PerFieldPostingsFormat
+	formats           map[string]*perFieldFieldsConsumerAndSuffix
+	suffixes          map[string]int
+	segmentWriteState SegmentWriteState
+}
+
+func newPerFieldPostingsWriter(owner *PerFieldPostingsFormat,
+	state SegmentWriteState) *PerFieldPostingsWriter {
+
+	return &PerFieldPostingsWriter{
+		owner:             owner,
+		formats:           make(map[string]*perFieldFieldsConsumerAndSuffix),
+		suffixes:          make(map[string]int),
+		segmentWriteState: state,
+	}
+}
+
+func (w *PerFieldPostingsWriter) AddField(field model.FieldInfo) (TermsConsumer, error) {
+	format := w.owner.postingsFormatForField(field.Name)
+	if format == nil {
+		return nil, errors.New(fmt.Sprintf(
+			"invalid nil PostingsFormat for field='%v'", field.Name))
+	}
+	formatName := format.Name()
+
+	previousValue := field.PutAttribute(PER_FIELD_FORMAT_KEY, formatName)
+	assert(previousValue == "")
+
+	consumer, ok := w.formats[formatName]
+	if !ok {
+		// First time we are seeing this format; create a new instance
+
+		// bump the suffix
+		suffix, ok := w.suffixes[formatName]
+		if ok {
+			suffix++
+		}
+		w.suffixes[formatName] = suffix
+
+		if w.segmentWriteState.segmentSuffix != "" {
+			return nil, errors.New(fmt.Sprintf(
+				"cannot embed PostingsFormat inside itself (field '%v' returned PostingsFormat '%v')",
+				field.Name, formatName))
+		}
+		newWriteState := w.segmentWriteState // clone
+		newWriteState.segmentSuffix = fmt.Sprintf("%v_%v", formatName, suffix)
+		fc, err := format.FieldsConsumer(newWriteState)
+		if err != nil {
+			return nil, err
+		}
+		consumer = &perFieldFieldsConsumerAndSuffix{fc, suffix}
+		w.formats[formatName] = consumer
+	}
+
+	previousValue = field.PutAttribute(PER_FIELD_SUFFIX_KEY, strconv.Itoa(consumer.suffix))
+	assert(previousValue == "")
+
+	// TODO: we should only provide the "slice" of FIS that this PF
+	// actually sees ... then stuff like .hasProx could work correctly?
+	// NOTE: .hasProx is already broken in the same way for the
+	// non-perfield case, if there is a fieldinfo with prox that has no
+	// postings, you get a 0 byte file.
+	return consumer.consumer.AddField(field)
+}
+
+func (w *PerFieldPostingsWriter) Close() error {
+	items := make([]io.Closer, 0, len(w.formats))
+	for _, v := range w.formats {
+		items = append(items, v.consumer)
+	}
+	return util.Close(items...)
+}
+
 type PerFieldPostingsReader struct {
 	fields  map[string]FieldsProducer
 	formats map[string]FieldsProducer
@@ -114,6 +197,15 @@ func (r *PerFieldPostingsReader) Terms(field string) Terms {
 	return nil
 }
 
+func (r *PerFieldPostingsReader) CheckIntegrity() error {
+	for _, producer := range r.formats {
+		if err := producer.CheckIntegrity(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (r *PerFieldPostingsReader) Close() error {
 	fps := make([]FieldsProducer, 0)
 	for _, v := range r.formats {
@@ -234,6 +326,15 @@ func (dvp *PerFieldDocValuesReader) SortedSet(field model.FieldInfo) (v SortedSe
 	return nil, nil
 }
 
+func (dvp *PerFieldDocValuesReader) CheckIntegrity() error {
+	for _, producer := range dvp.formats {
+		if err := producer.CheckIntegrity(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (dvp *PerFieldDocValuesReader) Close() error {
 	fps := make([]DocValuesProducer, 0)
 	for _, v := range dvp.formats {
@@ -0,0 +1,280 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"github.com/balzaczyy/golucene/core/codec"
+	"github.com/balzaczyy/golucene/core/store"
+	"github.com/balzaczyy/golucene/core/util"
+	"strconv"
+	"strings"
+)
+
+// index/PersistentSnapshotDeletionPolicy.java
+
+const (
+	// Prefix used for the save file.
+	SNAPSHOTS_PREFIX = "snapshots_"
+
+	SNAPSHOTS_VERSION_START   = 0
+	SNAPSHOTS_VERSION_CURRENT = SNAPSHOTS_VERSION_START
+
+	SNAPSHOTS_CODEC_NAME = "snapshots"
+)
+
+/*
+A SnapshotDeletionPolicy which adds a persistence layer so that
+snapshots can be maintained across the life of an application. The
+snapshots are persisted in a Directory and are committed as soon as
+Snapshot() or Release() is called.
+
+NOTE: Sharing PersistentSnapshotDeletionPolicy instances that write
+to the same directory across IndexWriters will corrupt snapshots. You
+should make sure every IndexWriter has its own
+PersistentSnapshotDeletionPolicy and that they all write to a
+different Directory. It is OK to use the same Directory that holds
+the index.
+*/
+type PersistentSnapshotDeletionPolicy struct {
+	*SnapshotDeletionPolicy
+	// The index of the next snapshots_N file to write.
+	nextWriteGen int64
+	dir          store.Directory
+}
+
+/*
+Wraps a provided IndexDeletionPolicy, persisting the snapshots in the
+given Directory. Opened with OPEN_MODE_CREATE, prior snapshots are
+discarded; with OPEN_MODE_APPEND, they must exist, which is useful
+when the application expects them; OPEN_MODE_CREATE_OR_APPEND loads
+them if any.
+
+NOTE: if the Directory holds no prior snapshots, the snapshots file
+is only written by the first call to Snapshot().
+*/
+func NewPersistentSnapshotDeletionPolicy(primary IndexDeletionPolicy,
+	dir store.Directory, mode OpenMode) (*PersistentSnapshotDeletionPolicy, error) {
+
+	ans := &PersistentSnapshotDeletionPolicy{
+		SnapshotDeletionPolicy: NewSnapshotDeletionPolicy(primary),
+		dir:                    dir,
+	}
+	if mode == OPEN_MODE_CREATE {
+		if err := ans.clearPriorSnapshots(); err != nil {
+			return nil, err
+		}
+	}
+	if err := ans.loadPriorSnapshots(); err != nil {
+		return nil, err
+	}
+	if mode == OPEN_MODE_APPEND && ans.nextWriteGen == 0 {
+		return nil, errors.New("no snapshots stored in this directory")
+	}
+	return ans, nil
+}
+
+/*
+Snapshots the last commit. Once this method returns, the snapshot
+information is persisted in the directory.
+*/
+func (p *PersistentSnapshotDeletionPolicy) Snapshot() (IndexCommit, error) {
+	p.Lock()
+	defer p.Unlock()
+	ic, err := p.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	if err = p.persist(); err != nil {
+		p.releaseGen(ic.Generation()) // ignore error
+		return nil, err
+	}
+	return ic, nil
+}
+
+/*
+Deletes a snapshotted commit. Once this method returns, the snapshot
+information is persisted in the directory.
+*/
+func (p *PersistentSnapshotDeletionPolicy) Release(commit IndexCommit) error {
+	return p.ReleaseGen(commit.Generation())
+}
+
+/*
+Deletes a snapshotted commit by generation, e.g. one held since a
+prior run of the application. Once this method returns, the snapshot
+information is persisted in the directory.
+*/
+func (p *PersistentSnapshotDeletionPolicy) ReleaseGen(gen int64) error {
+	p.Lock()
+	defer p.Unlock()
+	ic := p.indexCommits[gen]
+	if err := p.releaseGen(gen); err != nil {
+		return err
+	}
+	if err := p.persist(); err != nil {
+		// restore the snapshot, which is still on disk
+		p.refCounts[gen]++
+		if ic != nil {
+			p.indexCommits[gen] = ic
+		}
+		return err
+	}
+	return nil
+}
+
+func (p *PersistentSnapshotDeletionPolicy) persist() error {
+	fileName := SNAPSHOTS_PREFIX + strconv.FormatInt(p.nextWriteGen, 10)
+	if err := func() (err error) {
+		out, err := p.dir.CreateOutput(fileName, store.IO_CONTEXT_DEFAULT)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			err = util.CloseWhileHandlingError(err, out)
+		}()
+		if err = codec.WriteHeader(out, SNAPSHOTS_CODEC_NAME, SNAPSHOTS_VERSION_CURRENT); err != nil {
+			return err
+		}
+		if err = out.WriteVInt(int32(len(p.refCounts))); err != nil {
+			return err
+		}
+		for gen, refCount := range p.refCounts {
+			if err = out.WriteVLong(gen); err != nil {
+				return err
+			}
+			if err = out.WriteVInt(int32(refCount)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}(); err != nil {
+		p.dir.DeleteFile(fileName) // ignore error
+		return err
+	}
+
+	if err := p.dir.Sync([]string{fileName}); err != nil {
+		return err
+	}
+	if p.nextWriteGen > 0 {
+		lastSaveFile := SNAPSHOTS_PREFIX + strconv.FormatInt(p.nextWriteGen-1, 10)
+		p.dir.DeleteFile(lastSaveFile) // ignore error; loadPriorSnapshots() cleans up
+	}
+	p.nextWriteGen++
+	return nil
+}
+
+func (p *PersistentSnapshotDeletionPolicy) clearPriorSnapshots() error {
+	files, err := p.dir.ListAll()
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if strings.HasPrefix(file, SNAPSHOTS_PREFIX) {
+			if err = p.dir.DeleteFile(file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+/*
+Returns the file name the snapshots are currently saved to, or "" if
+no snapshots have been saved.
+*/
+func (p *PersistentSnapshotDeletionPolicy) LastSaveFile() string {
+	p.Lock()
+	defer p.Unlock()
+	if p.nextWriteGen == 0 {
+		return ""
+	}
+	return SNAPSHOTS_PREFIX + strconv.FormatInt(p.nextWriteGen-1, 10)
+}
+
+/*
+Reads the snapshots information from the latest snapshots_N file
+which can be read, deleting the others. The commits themselves are
+resolved by onInit(), once the IndexWriter is opened.
+*/
+func (p *PersistentSnapshotDeletionPolicy) loadPriorSnapshots() error {
+	files, err := p.dir.ListAll()
+	if err != nil {
+		return err
+	}
+	genLoaded := int64(-1)
+	var loadErr error
+	var snapshotFiles []string
+	for _, file := range files {
+		if !strings.HasPrefix(file, SNAPSHOTS_PREFIX) {
+			continue
+		}
+		gen, err := strconv.ParseInt(file[len(SNAPSHOTS_PREFIX):], 10, 64)
+		if err != nil {
+			continue // not ours
+		}
+		snapshotFiles = append(snapshotFiles, file)
+		if genLoaded != -1 && gen < genLoaded {
+			continue
+		}
+		m, err := p.readSnapshots(file)
+		if err != nil {
+			if loadErr == nil {
+				loadErr = err
+			}
+			continue
+		}
+		genLoaded = gen
+		p.refCounts = m
+	}
+
+	if genLoaded == -1 {
+		// Nothing was loaded...
+		return loadErr
+	}
+	if len(snapshotFiles) > 1 {
+		// Remove any broken / old snapshot files:
+		curFileName := SNAPSHOTS_PREFIX + strconv.FormatInt(genLoaded, 10)
+		for _, file := range snapshotFiles {
+			if file != curFileName {
+				p.dir.DeleteFile(file) // ignore error
+			}
+		}
+	}
+	p.nextWriteGen = genLoaded + 1
+	return nil
+}
+
+func (p *PersistentSnapshotDeletionPolicy) readSnapshots(file string) (m map[int64]int, err error) {
+	in, err := p.dir.OpenInput(file, store.IO_CONTEXT_DEFAULT)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = util.CloseWhileHandlingError(err, in)
+	}()
+	if _, err = codec.CheckHeader(in, SNAPSHOTS_CODEC_NAME,
+		SNAPSHOTS_VERSION_START, SNAPSHOTS_VERSION_START); err != nil {
+		return nil, err
+	}
+	count, err := in.ReadVInt()
+	if err != nil {
+		return nil, err
+	}
+	m = make(map[int64]int)
+	for i := int32(0); i < count; i++ {
+		commitGen, err := in.ReadVLong()
+		if err != nil {
+			return nil, err
+		}
+		refCount, err := in.ReadVInt()
+		if err != nil {
+			return nil, err
+		}
+		m[commitGen] = int(refCount)
+	}
+	return m, nil
+}
+
+func (p *PersistentSnapshotDeletionPolicy) String() string {
+	return fmt.Sprintf("PersistentSnapshotDeletionPolicy(%v)", p.primary)
+}
@@ -2,7 +2,6 @@ package index
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
 	"github.com/balzaczyy/golucene/core/codec"
 	"github.com/balzaczyy/golucene/core/index/model"
@@ -17,6 +16,10 @@ import (
 type FieldsProducer interface {
 	Fields
 	io.Closer
+	// Checks consistency of this reader. Note that this may be costly
+	// in terms of I/O, e.g. may involve computing a checksum value
+	// against large data files.
+	CheckIntegrity() error
 }
 
 // BlockTreeTermsReader.java
@@ -30,13 +33,15 @@ const (
 	BTT_CODEC_NAME          = "BLOCK_TREE_TERMS_DICT"
 	BTT_VERSION_START       = 0
 	BTT_VERSION_APPEND_ONLY = 1
-	BTT_VERSION_CURRENT     = BTT_VERSION_APPEND_ONLY
+	BTT_VERSION_CHECKSUM    = 2
+	BTT_VERSION_CURRENT     = BTT_VERSION_CHECKSUM
 
 	BTT_INDEX_EXTENSION           = "tip"
 	BTT_INDEX_CODEC_NAME          = "BLOCK_TREE_TERMS_INDEX"
 	BTT_INDEX_VERSION_START       = 0
 	BTT_INDEX_VERSION_APPEND_ONLY = 1
-	BTT_INDEX_VERSION_CURRENT     = BTT_INDEX_VERSION_APPEND_ONLY
+	BTT_INDEX_VERSION_CHECKSUM    = 2
+	BTT_INDEX_VERSION_CURRENT     = BTT_INDEX_VERSION_CHECKSUM
 )
 
 /* A block-based terms index and dictionary that assigns
@@ -125,7 +130,15 @@ func newBlockTreeTermsReader(dir store.Directory,
 		}
 		log.Printf("Index version: %v", indexVersion)
 		if int(indexVersion) != fp.version {
-			return fp, errors.New(fmt.Sprintf("mixmatched version files: %v=%v,%v=%v", fp.in, fp.version, indexIn, indexVersion))
+			return fp, codec.NewCorruptIndexErrorAt(indexIn, fmt.Sprintf(
+				"mixmatched version files: %v=%v,%v=%v", fp.in, fp.version, indexIn, indexVersion))
+		}
+
+		// verify the (small) terms index at open time
+		if indexVersion >= BTT_INDEX_VERSION_CHECKSUM {
+			if _, err = codec.ChecksumEntireFile(indexIn); err != nil {
+				return fp, err
+			}
 		}
 	}
 
@@ -144,7 +157,7 @@ func newBlockTreeTermsReader(dir store.Directory,
 	}
 	log.Printf("Fields number: %v", numFields)
 	if numFields < 0 {
-		return fp, errors.New(fmt.Sprintf("invalid numFields: %v (resource=%v)", numFields, fp.in))
+		return fp, codec.NewCorruptIndexErrorAt(fp.in, fmt.Sprintf("invalid numFields: %v", numFields))
 	}
 
 	for i := int32(0); i < numFields; i++ {
@@ -159,7 +172,10 @@ func newBlockTreeTermsReader(dir store.Directory,
 		if err != nil {
 			return fp, err
 		}
-		// assert numTerms >= 0
+		if numTerms <= 0 {
+			return fp, codec.NewCorruptIndexErrorAt(fp.in, fmt.Sprintf(
+				"Illegal numTerms for field number: %v", field))
+		}
 		log.Printf("Terms number: %v", numTerms)
 
 		numBytes, err := fp.in.ReadVInt()
@@ -194,19 +210,16 @@ func newBlockTreeTermsReader(dir store.Directory,
 		}
 		log.Printf("DocCount: %v", docCount)
 		if docCount < 0 || int(docCount) > info.DocCount() { // #docs with field must be <= #docs
-			return fp, errors.New(fmt.Sprintf(
-				"invalid docCount: %v maxDoc: %v (resource=%v)",
-				docCount, info.DocCount(), fp.in))
+			return fp, codec.NewCorruptIndexErrorAt(fp.in, fmt.Sprintf(
+				"invalid docCount: %v maxDoc: %v", docCount, info.DocCount()))
 		}
 		if sumDocFreq < int64(docCount) { // #postings must be >= #docs with field
-			return fp, errors.New(fmt.Sprintf(
-				"invalid sumDocFreq: %v docCount: %v (resource=%v)",
-				sumDocFreq, docCount, fp.in))
+			return fp, codec.NewCorruptIndexErrorAt(fp.in, fmt.Sprintf(
+				"invalid sumDocFreq: %v docCount: %v", sumDocFreq, docCount))
 		}
 		if sumTotalTermFreq != -1 && sumTotalTermFreq < sumDocFreq { // #positions must be >= #postings
-			return fp, errors.New(fmt.Sprintf(
-				"invalid sumTotalTermFreq: %v sumDocFreq: %v (resource=%v)",
-				sumTotalTermFreq, sumDocFreq, fp.in))
+			return fp, codec.NewCorruptIndexErrorAt(fp.in, fmt.Sprintf(
+				"invalid sumTotalTermFreq: %v sumDocFreq: %v", sumTotalTermFreq, sumDocFreq))
 		}
 
 		var indexStartFP int64
@@ -218,8 +231,8 @@ func newBlockTreeTermsReader(dir store.Directory,
 		}
 		log.Printf("indexStartFP: %v", indexStartFP)
 		if _, ok := fp.fields[fieldInfo.Name]; ok {
-			return fp, errors.New(fmt.Sprintf(
-				"duplicate field: %v (resource=%v)", fieldInfo.Name, fp.in))
+			return fp, codec.NewCorruptIndexErrorAt(fp.in, fmt.Sprintf(
+				"duplicate field: %v", fieldInfo.Name))
 		}
 		fp.fields[fieldInfo.Name], err = newFieldReader(fp,
 			fieldInfo, numTerms, rootCode, sumTotalTermFreq,
@@ -276,7 +289,12 @@ func (r *BlockTreeTermsReader) readIndexHeader(input store.IndexInput) (version
 
 func (r *BlockTreeTermsReader) seekDir(input store.IndexInput, dirOffset int64) (err error) {
 	log.Printf("Seeking to: %v", dirOffset)
-	if r.version >= BTT_INDEX_VERSION_APPEND_ONLY {
+	if r.version >= BTT_INDEX_VERSION_CHECKSUM {
+		input.Seek(input.Length() - int64(codec.FooterLength()) - 8)
+		if dirOffset, err = input.ReadLong(); err != nil {
+			return err
+		}
+	} else if r.version >= BTT_INDEX_VERSION_APPEND_ONLY {
 		input.Seek(input.Length() - 8)
 		if dirOffset, err = input.ReadLong(); err != nil {
 			return err
@@ -287,8 +305,21 @@ func (r *BlockTreeTermsReader) seekDir(input store.IndexInput, dirOffset int64)
 }
 
 func (r *BlockTreeTermsReader) Terms(field string) Terms {
-	ans := r.fields[field]
-	return &ans
+	if ans, ok := r.fields[field]; ok {
+		return &ans
+	}
+	return nil
+}
+
+func (r *BlockTreeTermsReader) CheckIntegrity() error {
+	if r.version >= BTT_VERSION_CHECKSUM {
+		// term dictionary
+		if _, err := codec.ChecksumEntireFile(r.in.Clone()); err != nil {
+			return err
+		}
+	}
+	// postings
+	return r.postingsReader.CheckIntegrity()
 }
 
 func (r *BlockTreeTermsReader) Close() error {
@@ -357,6 +388,22 @@ func (r *FieldReader) Iterator(reuse TermsEnum) TermsEnum {
 	return newSegmentTermsEnum(r)
 }
 
+func (r *FieldReader) Size() int64 {
+	return r.numTerms
+}
+
+func (r *FieldReader) HasOffsets() bool {
+	return r.fieldInfo.IndexOptions() >= model.INDEX_OPT_DOCS_AND_FREQS_AND_POSITIONS_AND_OFFSETS
+}
+
+func (r *FieldReader) HasPositions() bool {
+	return r.fieldInfo.IndexOptions() >= model.INDEX_OPT_DOCS_AND_FREQS_AND_POSITIONS
+}
+
+func (r *FieldReader) HasPayloads() bool {
+	return r.fieldInfo.HasPayloads()
+}
+
 func (r *FieldReader) SumTotalTermFreq() int64 {
 	return r.sumTotalTermFreq
 }
@@ -605,7 +652,7 @@ func (e *SegmentTermsEnum) SeekExact(target []byte) (ok bool, err error) {
 				log.Printf("FAIL: arc.label=%c targetLabel=%c", arc.Label, target[targetUpto])
 				panic("assert fail")
 			}
-			if arc.Output != noOutputs {
+			if !fst.CompareFSTValue(arc.Output, noOutputs) {
 				output = e.fstOutputs.Add(output, arc.Output).([]byte)
 			}
 			if arc.IsFinal() {
@@ -873,7 +920,102 @@ func (e *SegmentTermsEnum) printSeekState() {
 }
 
 func (e *SegmentTermsEnum) Next() (buf []byte, err error) {
-	panic("not implemented yet")
+	if e.in == nil {
+		// Fresh TermsEnum; seek to first term:
+		var arc *fst.Arc
+		if e.index != nil {
+			arc = e.index.FirstArc(e.arcs[0])
+			// Empty string prefix must have an output in the index!
+			assert(arc.IsFinal())
+		}
+		if e.currentFrame, err = e.pushFrame(arc, e.rootCode, 0); err != nil {
+			return nil, err
+		}
+		if err = e.currentFrame.loadBlock(); err != nil {
+			return nil, err
+		}
+	}
+
+	e.targetBeforeCurrentLength = e.currentFrame.ord
+
+	assert(!e.eof)
+	log.Printf("BTTR.next seg=%v term=%v termExists?=%v field=%v termBlockOrd=%v validIndexPrefix=%v",
+		e.segment, e.term, e.termExists, e.fieldInfo.Name, e.currentFrame.state.termBlockOrd, e.validIndexPrefix)
+	e.printSeekState()
+
+	if e.currentFrame == e.staticFrame {
+		// If seek was previously called and the term was
+		// cached, or seek(TermState) was called, usually
+		// caller is just going to pull a D/&PEnum or get
+		// docFreq, etc.  But, if they then call next(),
+		// this method catches up all internal state so next()
+		// works properly:
+		log.Printf("  re-seek to pending term=%v", e.term)
+		ok, err := e.SeekExact(append([]byte(nil), e.term.toBytes()...))
+		if err != nil {
+			return nil, err
+		}
+		assert(ok)
+	}
+
+	// Pop finished blocks
+	for e.currentFrame.nextEnt == e.currentFrame.entCount {
+		if !e.currentFrame.isLastInFloor {
+			if err = e.currentFrame.loadNextFloorBlock(); err != nil {
+				return nil, err
+			}
+		} else {
+			log.Printf("  pop frame")
+			if e.currentFrame.ord == 0 {
+				log.Printf("  return nil")
+				e.eof = true
+				e.term.length = 0
+				e.validIndexPrefix = 0
+				e.currentFrame.rewind()
+				e.termExists = false
+				return nil, nil
+			}
+			lastFP := e.currentFrame.fpOrig
+			e.currentFrame = e.stack[e.currentFrame.ord-1]
+
+			if e.currentFrame.nextEnt == -1 || e.currentFrame.lastSubFP != lastFP {
+				// We popped into a frame that's not loaded
+				// yet or not scan'd to the right entry
+				e.currentFrame.scanToFloorFrame(e.term.toBytes())
+				if err = e.currentFrame.loadBlock(); err != nil {
+					return nil, err
+				}
+				e.currentFrame.scanToSubBlock(lastFP)
+			}
+
+			// Note that the seek state (last seek) has been
+			// invalidated beyond this depth
+			if e.currentFrame.prefix < e.validIndexPrefix {
+				e.validIndexPrefix = e.currentFrame.prefix
+			}
+			log.Printf("    reset validIndexPrefix=%v", e.validIndexPrefix)
+		}
+	}
+
+	for {
+		if e.currentFrame.next() {
+			// Push to new block:
+			log.Printf("  push frame")
+			if e.currentFrame, err = e.pushFrameAt(nil, e.currentFrame.lastSubFP, e.term.length); err != nil {
+				return nil, err
+			}
+			// This is a "next" frame -- even if it's
+			// floor'd we must pretend it isn't so we don't
+			// try to scan to the right floor frame:
+			e.currentFrame.isFloor = false
+			if err = e.currentFrame.loadBlock(); err != nil {
+				return nil, err
+			}
+		} else {
+			log.Printf("  return term=%v currentFrame.ord=%v", e.term, e.currentFrame.ord)
+			return e.term.toBytes(), nil
+		}
+	}
 }
 
 func (e *SegmentTermsEnum) Term() []byte {
@@ -915,7 +1057,20 @@ func (e *SegmentTermsEnum) DocsByFlags(skipDocs util.Bits, reuse DocsEnum, flags
 }
 
 func (e *SegmentTermsEnum) DocsAndPositionsByFlags(skipDocs util.Bits, reuse DocsAndPositionsEnum, flags int) DocsAndPositionsEnum {
-	panic("not implemented yet")
+	if e.fieldInfo.IndexOptions() < model.INDEX_OPT_DOCS_AND_FREQS_AND_POSITIONS {
+		// Positions were not indexed:
+		return nil
+	}
+
+	assert(!e.eof)
+	err := e.currentFrame.decodeMetaData()
+	if err == nil {
+		var ans DocsAndPositionsEnum
+		if ans, err = e.postingsReader.docsAndPositions(e.fieldInfo, e.currentFrame.state, skipDocs, reuse, flags); err == nil {
+			return ans
+		}
+	}
+	panic(err)
 }
 
 func (e *SegmentTermsEnum) SeekExactFromLast(target []byte, otherState TermState) error {
@@ -1093,7 +1248,7 @@ func (f *segmentTermsEnumFrame) loadBlock() (err error) {
 		panic("assert fail")
 	}
 	f.isLastInFloor = (code & 1) != 0
-	if f.arc != nil && f.isLastInFloor && f.isFloor {
+	if f.arc != nil && !(f.isLastInFloor || f.isFloor) {
 		panic("assert fail")
 	}
 
@@ -1104,16 +1259,19 @@ func (f *segmentTermsEnumFrame) loadBlock() (err error) {
 
 	// term suffixes:
 	code, err = asInt(f.in.ReadVInt())
+	if err != nil {
+		return err
+	}
 	f.isLeafBlock = (code & 1) != 0
 	numBytes := int(uint(code) >> 1)
 	if len(f.suffixBytes) < numBytes {
 		f.suffixBytes = make([]byte, numBytes)
 	}
-	err = f.in.ReadBytes(f.suffixBytes)
+	err = f.in.ReadBytes(f.suffixBytes[:numBytes])
 	if err != nil {
 		return err
 	}
-	f.suffixesReader.Reset(f.suffixBytes)
+	f.suffixesReader.Reset(f.suffixBytes[:numBytes])
 
 	if f.arc == nil {
 		log.Printf("    loadBlock (next) fp=%v entCount=%v prefixLen=%v isLastInFloor=%v leaf?=%v",
@@ -1126,16 +1284,16 @@ func (f *segmentTermsEnumFrame) loadBlock() (err error) {
 	// stats
 	numBytes, err = asInt(f.in.ReadVInt())
 	if err != nil {
-		return nil
+		return err
 	}
 	if len(f.statBytes) < numBytes {
 		f.statBytes = make([]byte, numBytes)
 	}
-	err = f.in.ReadBytes(f.statBytes)
+	err = f.in.ReadBytes(f.statBytes[:numBytes])
 	if err != nil {
 		return err
 	}
-	f.statsReader.Reset(f.statBytes)
+	f.statsReader.Reset(f.statBytes[:numBytes])
 	f.metaDataUpto = 0
 
 	f.state.termBlockOrd = 0
@@ -1144,7 +1302,9 @@ func (f *segmentTermsEnumFrame) loadBlock() (err error) {
 
 	// TODO: we could skip this if !hasTerms; but
 	// that's rare so won't help much
-	f.postingsReader.ReadTermsBlock(f.in, f.fieldInfo, f.state)
+	if err = f.postingsReader.ReadTermsBlock(f.in, f.fieldInfo, f.state); err != nil {
+		return err
+	}
 
 	// Sub-blocks of a single floor block are always
 	// written one after another -- tail recurse:
@@ -1153,6 +1313,14 @@ func (f *segmentTermsEnumFrame) loadBlock() (err error) {
 	return nil
 }
 
+func (f *segmentTermsEnumFrame) loadNextFloorBlock() error {
+	log.Printf("    loadNextFloorBlock fp=%v fpEnd=%v", f.fp, f.fpEnd)
+	assertn(f.arc == nil || f.isFloor, "arc=%v isFloor=%v", f.arc, f.isFloor)
+	f.fp = f.fpEnd
+	f.nextEnt = -1
+	return f.loadBlock()
+}
+
 func (f *segmentTermsEnumFrame) rewind() {
 	// Force reload:
 	f.fp = f.fpOrig
@@ -1175,11 +1343,42 @@ func (f *segmentTermsEnumFrame) next() bool {
 
 // Decodes next entry; returns true if it's a sub-block
 func (f *segmentTermsEnumFrame) nextLeaf() bool {
-	panic("not implemented yet")
+	assertn(f.nextEnt != -1 && f.nextEnt < f.entCount,
+		"nextEnt=%v entCount=%v fp=%v", f.nextEnt, f.entCount, f.fp)
+	f.nextEnt++
+	f.suffix, _ = asInt(f.suffixesReader.ReadVInt())
+	f.startBytePos = f.suffixesReader.Pos
+	f.term.length = f.prefix + f.suffix
+	f.term.ensureSize(f.term.length)
+	f.suffixesReader.ReadBytes(f.term.bytes[f.prefix:f.term.length])
+	// A normal term
+	f.termExists = true
+	return false
 }
 
 func (f *segmentTermsEnumFrame) nextNonLeaf() bool {
-	panic("not implemented yet")
+	assertn(f.nextEnt != -1 && f.nextEnt < f.entCount,
+		"nextEnt=%v entCount=%v fp=%v", f.nextEnt, f.entCount, f.fp)
+	f.nextEnt++
+	code, _ := asInt(f.suffixesReader.ReadVInt())
+	f.suffix = int(uint(code) >> 1)
+	f.startBytePos = f.suffixesReader.Pos
+	f.term.length = f.prefix + f.suffix
+	f.term.ensureSize(f.term.length)
+	f.suffixesReader.ReadBytes(f.term.bytes[f.prefix:f.term.length])
+	if (code & 1) == 0 {
+		// A normal term
+		f.termExists = true
+		f.subCode = 0
+		f.state.termBlockOrd++
+		return false
+	}
+	// A sub-block; make sub-FP absolute:
+	f.termExists = false
+	subCode, _ := f.suffixesReader.ReadVLong()
+	f.subCode = int(subCode)
+	f.lastSubFP = f.fp - subCode
+	return true
 }
 
 // TODO: make this array'd so we can do bin search?
@@ -1204,48 +1403,67 @@ func (f *segmentTermsEnumFrame) scanToFloorFrame(target []byte) {
 		panic("assert fail")
 	}
 
-	panic("not implemented yet")
-	// long newFP;
-	//  while (true) {
-	//    final long code = floorDataReader.readVLong();
-	//    newFP = fpOrig + (code >>> 1);
-	//    hasTerms = (code & 1) != 0;
-	//    // if (DEBUG) {
-	//    //   System.out.println("      label=" + toHex(nextFloorLabel) + " fp=" + newFP + " hasTerms?=" + hasTerms + " numFollowFloor=" + numFollowFloorBlocks);
-	//    // }
-
-	//    isLastInFloor = numFollowFloorBlocks == 1;
-	//    numFollowFloorBlocks--;
-
-	//    if (isLastInFloor) {
-	//      nextFloorLabel = 256;
-	//      // if (DEBUG) {
-	//      //   System.out.println("        stop!  last block nextFloorLabel=" + toHex(nextFloorLabel));
-	//      // }
-	//      break;
-	//    } else {
-	//      nextFloorLabel = floorDataReader.readByte() & 0xff;
-	//      if (targetLabel < nextFloorLabel) {
-	//        // if (DEBUG) {
-	//        //   System.out.println("        stop!  nextFloorLabel=" + toHex(nextFloorLabel));
-	//        // }
-	//        break;
-	//      }
-	//    }
-	//  }
-
-	//  if (newFP != fp) {
-	//    // Force re-load of the block:
-	//    // if (DEBUG) {
-	//    //   System.out.println("      force switch to fp=" + newFP + " oldFP=" + fp);
-	//    // }
-	//    nextEnt = -1;
-	//    fp = newFP;
-	//  } else {
-	//    // if (DEBUG) {
-	//    //   System.out.println("      stay on same fp=" + newFP);
-	//    // }
-	//  }
+	var newFP int64
+	for {
+		code, _ := f.floorDataReader.ReadVLong()
+		newFP = f.fpOrig + int64(uint64(code)>>1)
+		f.hasTerms = (code & 1) != 0
+		log.Printf("      label=%x fp=%v hasTerms?=%v numFollowFloor=%v",
+			f.nextFloorLabel, newFP, f.hasTerms, f.numFollowFloorBlocks)
+
+		f.isLastInFloor = f.numFollowFloorBlocks == 1
+		f.numFollowFloorBlocks--
+
+		if f.isLastInFloor {
+			f.nextFloorLabel = 256
+			log.Printf("        stop!  last block nextFloorLabel=%x", f.nextFloorLabel)
+			break
+		}
+		b, _ := f.floorDataReader.ReadByte()
+		f.nextFloorLabel = int(b)
+		if targetLabel < f.nextFloorLabel {
+			log.Printf("        stop!  nextFloorLabel=%x", f.nextFloorLabel)
+			break
+		}
+	}
+
+	if newFP != f.fp {
+		// Force re-load of the block:
+		log.Printf("      force switch to fp=%v oldFP=%v", newFP, f.fp)
+		f.nextEnt = -1
+		f.fp = newFP
+	} else {
+		log.Printf("      stay on same fp=%v", newFP)
+	}
+}
+
+func (f *segmentTermsEnumFrame) scanToSubBlock(subFP int64) {
+	assert(!f.isLeafBlock)
+	log.Printf("  scanToSubBlock fp=%v subFP=%v entCount=%v lastSubFP=%v", f.fp, subFP, f.entCount, f.lastSubFP)
+	if f.lastSubFP == subFP {
+		log.Println("    already positioned")
+		return
+	}
+	assertn(subFP < f.fp, "fp=%v subFP=%v", f.fp, subFP)
+	targetSubCode := f.fp - subFP
+	log.Printf("    targetSubCode=%v", targetSubCode)
+	for {
+		assert(f.nextEnt < f.entCount)
+		f.nextEnt++
+		code, _ := asInt(f.suffixesReader.ReadVInt())
+		f.suffixesReader.SkipBytes(int(uint(code) >> 1))
+		if (code & 1) != 0 {
+			subCode, _ := f.suffixesReader.ReadVLong()
+			log.Printf("      subCode=%v", subCode)
+			if targetSubCode == subCode {
+				log.Println("        match!")
+				f.lastSubFP = subFP
+				return
+			}
+		} else {
+			f.state.termBlockOrd++
+		}
+	}
 }
 
 // Used only by assert
@@ -1412,7 +1630,139 @@ func (f *segmentTermsEnumFrame) scanToTermLeaf(target []byte, exactOnly bool) (s
 // Target's prefix matches this block's prefix; we
 // scan the entries check if the suffix matches.
 func (f *segmentTermsEnumFrame) scanToTermNonLeaf(target []byte, exactOnly bool) (status SeekStatus, err error) {
-	panic("not implemented yet")
+	log.Printf("    scanToTermNonLeaf: block fp=%v prefix=%v nextEnt=%v (of %v) target=%v term=%v",
+		f.fp, f.prefix, f.nextEnt, f.entCount, brToString(target), f.term)
+	assert(f.nextEnt != -1)
+
+	if f.nextEnt == f.entCount {
+		if exactOnly {
+			f.fillTerm()
+			f.termExists = f.subCode == 0
+		}
+		return SEEK_STATUS_END, nil
+	}
+
+	assert(f.prefixMatches(target))
+
+	// Loop over each entry (term or sub-block) in this block:
+nextTerm:
+	for {
+		f.nextEnt++
+
+		code, err := asInt(f.suffixesReader.ReadVInt())
+		if err != nil {
+			return 0, err
+		}
+		f.suffix = int(uint(code) >> 1)
+		f.termExists = (code & 1) == 0
+		termLen := f.prefix + f.suffix
+		f.startBytePos = f.suffixesReader.Pos
+		f.suffixesReader.SkipBytes(f.suffix)
+		if f.termExists {
+			f.state.termBlockOrd++
+			f.subCode = 0
+		} else {
+			subCode, err := f.suffixesReader.ReadVLong()
+			if err != nil {
+				return 0, err
+			}
+			f.subCode = int(subCode)
+			f.lastSubFP = f.fp - subCode
+		}
+
+		targetLimit := termLen
+		if len(target) < termLen {
+			targetLimit = len(target)
+		}
+		targetPos := f.prefix
+
+		// Loop over bytes in the suffix, comparing to
+		// the target
+		bytePos := f.startBytePos
+		for {
+			var cmp int
+			var stop bool
+			if targetPos < targetLimit {
+				cmp = int(f.suffixBytes[bytePos]) - int(target[targetPos])
+				bytePos++
+				targetPos++
+				stop = false
+			} else {
+				assert(targetPos == targetLimit)
+				cmp = termLen - len(target)
+				stop = true
+			}
+
+			if cmp < 0 {
+				// Current entry is still before the target;
+				// keep scanning
+
+				if f.nextEnt == f.entCount {
+					if exactOnly {
+						f.fillTerm()
+					}
+					// We are done scanning this block
+					break nextTerm
+				}
+				continue nextTerm
+			} else if cmp > 0 {
+				// Done!  Current entry is after target --
+				// return NOT_FOUND:
+				f.fillTerm()
+
+				if !exactOnly && !f.termExists {
+					// We are on a sub-block, and caller wants
+					// us to position to the next term after
+					// the target, so we must recurse into the
+					// sub-frame(s):
+					if f.currentFrame, err = f.pushFrameAt(nil, f.currentFrame.lastSubFP, termLen); err == nil {
+						err = f.currentFrame.loadBlock()
+					}
+					for err == nil && f.currentFrame.next() {
+						if f.currentFrame, err = f.pushFrameAt(nil, f.currentFrame.lastSubFP, f.term.length); err == nil {
+							err = f.currentFrame.loadBlock()
+						}
+					}
+					if err != nil {
+						return 0, err
+					}
+				}
+
+				log.Println("        not found")
+				return SEEK_STATUS_NOT_FOUND, nil
+			} else if stop {
+				// Exact match!
+
+				// This cannot be a sub-block because we
+				// would have followed the index to this
+				// sub-block from the start:
+
+				assert(f.termExists)
+				f.fillTerm()
+				log.Println("        found!")
+				return SEEK_STATUS_FOUND, nil
+			}
+		}
+	}
+
+	// It is possible (and OK) that terms index pointed us
+	// at this block, but, we scanned the entire block and
+	// did not find the term to position to.  This happens
+	// when the target is after the last term in the block
+	// (but, before the next term in the index).  EG
+	// target could be foozzz, and terms index pointed us
+	// to the foo* block, but the last term in this block
+	// was fooz (and, eg, first term in the next block will
+	// bee fop).
+	log.Println("      block end")
+	if exactOnly {
+		f.fillTerm()
+	}
+
+	// TODO: not consistent that in the
+	// not-exact case we don't next() into the next
+	// frame here
+	return SEEK_STATUS_END, nil
 }
 
 func (f *segmentTermsEnumFrame) fillTerm() {
@@ -1521,6 +1871,8 @@ func (br *bytesRef) ensureSize(minSize int) {
 		copy(next, br.bytes)
 		br.bytes = next
 	}
+	// expose the whole buffer; length tracks the used part
+	br.bytes = br.bytes[:cap(br.bytes)]
 }
 
 func (br *bytesRef) String() string {
@@ -32,11 +32,19 @@ type PostingsReaderBase interface {
 	/** Must fully consume state, since after this call that
 	 *  TermState may be reused. */
 	docs(fieldInfo model.FieldInfo, state *BlockTermState, skipDocs util.Bits, reuse DocsEnum, flags int) (de DocsEnum, err error)
-	// docsAndPositions(fieldInfo FieldInfo, state BlockTermState, skipDocs util.Bits)
+	/** Must fully consume state, since after this call that
+	 *  TermState may be reused. */
+	docsAndPositions(fieldInfo model.FieldInfo, state *BlockTermState, skipDocs util.Bits, reuse DocsAndPositionsEnum, flags int) (de DocsAndPositionsEnum, err error)
 	/** Returns approximate RAM bytes used */
 	// RamBytesUsed() int64
 	/** Reads data for all terms in the next block; this
 	 *  method should merely load the byte[] blob but not
 	 *  decode, which is done in {@link #nextTerm}. */
 	ReadTermsBlock(termsIn store.IndexInput, fieldInfo model.FieldInfo, termState *BlockTermState) error
+	/** Checks consistency of this reader.
+
+	Note that this may be costly in terms of I/O, e.g.
+	may involve computing a checksum value against large
+	data files. */
+	CheckIntegrity() error
 }
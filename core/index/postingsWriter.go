@@ -0,0 +1,38 @@
+package index
+
+import (
+	"github.com/balzaczyy/golucene/core/index/model"
+	"github.com/balzaczyy/golucene/core/store"
+	"io"
+)
+
+// codecs/PostingsWriterBase.java
+
+/*
+Extension of PostingsConsumer to support pluggable term dictionaries.
+
+This class contains additional hooks to interact with the provided
+term dictionaries such as BlockTreeTermsWriter. If you want to re-use
+an existing implementation and are only interested in customizing the
+format of the postings list, implement this interface instead.
+*/
+type PostingsWriterBase interface {
+	PostingsConsumer
+	io.Closer
+	// Called once after startup, before any terms have been added.
+	// Implementations typically write a header to the provided
+	// termsOut.
+	Init(termsOut store.IndexOutput) error
+	// Start a new term. Note that a matching call to FinishTerm() is
+	// done, only if the term has at least one document.
+	StartTerm() error
+	// Flush count terms starting at start "backwards", as a block.
+	// start is a negative offset from the end of the terms stack, ie
+	// bigger start means further back in the stack.
+	FlushTermsBlock(start, count int) error
+	// Finishes the current term. The provided TermStats contains the
+	// term's summary statistics.
+	FinishTerm(stats *TermStats) error
+	// Called when the writing switches to another field.
+	SetField(fieldInfo model.FieldInfo)
+}
@@ -17,22 +17,79 @@ func (terms *PrefixCodedTerms) sizeInBytes() int64 {
 	return terms.buffer.SizeInBytes()
 }
 
+/* Iterates over the terms, calling f with each one in sorted order. */
+func (terms *PrefixCodedTerms) each(f func(term *Term)) {
+	input, err := store.NewRAMInputStream("PrefixCodedTermsIterator", terms.buffer)
+	if err != nil {
+		panic(err) // should not happen for in-memory buffer
+	}
+	var field string
+	var bytes []byte
+	for input.FilePointer() < input.Length() {
+		code, err := input.ReadVInt()
+		if err != nil {
+			panic(err)
+		}
+		if (code & 1) != 0 {
+			// new field
+			if field, err = input.ReadString(); err != nil {
+				panic(err)
+			}
+		}
+		prefix := int(uint32(code) >> 1)
+		suffix, err := input.ReadVInt()
+		if err != nil {
+			panic(err)
+		}
+		next := make([]byte, prefix+int(suffix))
+		copy(next, bytes[:prefix])
+		if err = input.ReadBytes(next[prefix:]); err != nil {
+			panic(err)
+		}
+		bytes = next
+		f(&Term{field, bytes})
+	}
+}
+
 /* Builds a PrefixCodedTerms: call add repeatedly, then finish. */
 type PrefixCodedTermsBuilder struct {
-	buffer *store.RAMFile
-	output *store.RAMOutputStream
+	buffer   *store.RAMFile
+	output   *store.RAMOutputStream
+	lastTerm *Term
 }
 
 func newPrefixCodedTermsBuilder() *PrefixCodedTermsBuilder {
 	f := store.NewRAMFileBuffer()
 	return &PrefixCodedTermsBuilder{
-		buffer: f,
-		output: store.NewRAMOutputStream(f),
+		buffer:   f,
+		output:   store.NewRAMOutputStream(f),
+		lastTerm: &Term{},
 	}
 }
 
+/* add a term */
 func (b *PrefixCodedTermsBuilder) add(term *Term) {
-	panic("not implemented yet")
+	assert(b.lastTerm.Field == "" && len(b.lastTerm.Bytes) == 0 ||
+		TermSorter([]*Term{b.lastTerm, term}).Less(0, 1))
+	prefix := sharedPrefix(b.lastTerm.Bytes, term.Bytes)
+	suffix := len(term.Bytes) - prefix
+	var err error
+	if term.Field == b.lastTerm.Field {
+		err = b.output.WriteVInt(int32(prefix << 1))
+	} else {
+		if err = b.output.WriteVInt(int32(prefix<<1 | 1)); err == nil {
+			err = b.output.WriteString(term.Field)
+		}
+	}
+	if err == nil {
+		if err = b.output.WriteVInt(int32(suffix)); err == nil {
+			err = b.output.WriteBytes(term.Bytes[prefix:])
+		}
+	}
+	if err != nil {
+		panic(err)
+	}
+	b.lastTerm = term
 }
 
 func (b *PrefixCodedTermsBuilder) finish() *PrefixCodedTerms {
@@ -42,3 +99,14 @@ func (b *PrefixCodedTermsBuilder) finish() *PrefixCodedTerms {
 	}
 	return newPrefixCodedTerms(b.buffer)
 }
+
+func sharedPrefix(term1, term2 []byte) int {
+	pos1, end := 0, len(term1)
+	if len(term2) < end {
+		end = len(term2)
+	}
+	for pos1 < end && term1[pos1] == term2[pos1] {
+		pos1++
+	}
+	return pos1
+}
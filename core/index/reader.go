@@ -3,6 +3,7 @@ package index
 import (
 	"errors"
 	"fmt"
+	"github.com/balzaczyy/golucene/core/index/model"
 	"github.com/balzaczyy/golucene/core/util"
 	"io"
 	"sync"
@@ -11,11 +12,25 @@ import (
 
 type IndexReader interface {
 	io.Closer
+	incRef()
+	tryIncRef() bool
 	decRef() error
+	IncRef()
+	TryIncRef() bool
+	DecRef() error
+	RefCount() int
 	ensureOpen()
 	registerParentReader(r IndexReader)
 	NumDocs() int
 	MaxDoc() int
+	// Retrieve term vectors for this document, or nil if term vectors
+	// were not indexed. The returned Fields instance acts like a
+	// single-document inverted index (the docID will be 0).
+	TermVectors(docID int) (fs Fields, err error)
+	// Retrieve term vector for this document and field, or nil if
+	// term vectors were not indexed. The returned Terms instance acts
+	// like a single-document inverted index (the docID will be 0).
+	TermVector(docID int, field string) (t Terms, err error)
 	/** Expert: visits the fields of a stored document, for
 	 *  custom processing/loading of each field.  If you
 	 *  simply want to load all fields, use {@link
@@ -47,6 +62,12 @@ type IndexReader interface {
 	doClose() error
 	Context() IndexReaderContext
 	Leaves() []AtomicReaderContext
+	// Checks consistency of this reader, verifying the checksums of
+	// all underlying files. Small files are already verified when the
+	// reader is opened, so this mainly streams the large ones, which
+	// can be costly in terms of I/O. A *codec.CorruptIndexError is
+	// returned if any file fails verification.
+	CheckIntegrity() error
 }
 
 type IndexReaderImpl struct {
@@ -57,8 +78,16 @@ type IndexReaderImpl struct {
 	refCount          int32 // synchronized
 	parentReaders     map[IndexReader]bool
 	parentReadersLock sync.RWMutex
+
+	readerClosedListeners     []ReaderClosedListener
+	readerClosedListenersLock sync.Mutex
 }
 
+/*
+A custom listener that's invoked when the IndexReader is closed.
+*/
+type ReaderClosedListener func(r IndexReader)
+
 func newIndexReader(self IndexReader) *IndexReaderImpl {
 	return &IndexReaderImpl{
 		IndexReader:   self,
@@ -67,6 +96,44 @@ func newIndexReader(self IndexReader) *IndexReaderImpl {
 	}
 }
 
+/*
+Expert: adds a ReaderClosedListener. The provided listener will be
+invoked when this reader is closed.
+*/
+func (r *IndexReaderImpl) AddReaderClosedListener(listener ReaderClosedListener) {
+	r.ensureOpen()
+	r.readerClosedListenersLock.Lock()
+	defer r.readerClosedListenersLock.Unlock()
+	r.readerClosedListeners = append(r.readerClosedListeners, listener)
+}
+
+/*
+Expert: increments the refCount of this IndexReader instance.
+RefCounts are used to determine when a reader can be closed safely,
+i.e. as soon as there are no more references. Be sure to always call
+a corresponding decRef(), in a defer clause; otherwise the reader may
+never be closed.
+*/
+func (r *IndexReaderImpl) incRef() {
+	if !r.tryIncRef() {
+		r.ensureOpen()
+	}
+}
+
+/*
+Expert: increments the refCount of this IndexReader instance only if
+the IndexReader has not been closed yet and returns true iff the
+refCount was successfully incremented, otherwise false.
+*/
+func (r *IndexReaderImpl) tryIncRef() bool {
+	for count := atomic.LoadInt32(&r.refCount); count > 0; count = atomic.LoadInt32(&r.refCount) {
+		if atomic.CompareAndSwapInt32(&r.refCount, count, count+1) {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *IndexReaderImpl) decRef() error {
 	// only check refcount here (don't call ensureOpen()), so we can
 	// still close the reader if it was made invalid by a child:
@@ -83,7 +150,9 @@ func (r *IndexReaderImpl) decRef() error {
 				atomic.AddInt32(&r.refCount, 1)
 			}
 		}()
-		r.doClose()
+		if err := r.doClose(); err != nil {
+			return err
+		}
 		success = true
 		r.reportCloseToParentReaders()
 		r.notifyReaderClosedListeners()
@@ -94,6 +163,47 @@ func (r *IndexReaderImpl) decRef() error {
 	return nil
 }
 
+/*
+Expert: returns the current refCount for this reader.
+*/
+func (r *IndexReaderImpl) RefCount() int {
+	// NOTE: don't ensureOpen, so that callers can see refCount is 0
+	// (reader is closed)
+	return int(atomic.LoadInt32(&r.refCount))
+}
+
+/*
+Expert: increments the refCount of this IndexReader instance. Be sure
+to always call a corresponding DecRef(); otherwise the reader may
+never be closed. Note that Close() simply calls DecRef(), which means
+that the IndexReader will not really be closed until DecRef() has
+been called for all outstanding references.
+*/
+func (r *IndexReaderImpl) IncRef() {
+	r.incRef()
+}
+
+/*
+Expert: increments the refCount of this IndexReader instance only if
+the IndexReader has not been closed yet and returns true iff the
+refCount was successfully incremented, otherwise false. If this
+method returns false the reader is either already closed or is
+currently being closed. Either way this reader instance shouldn't be
+used by an application unless true is returned.
+*/
+func (r *IndexReaderImpl) TryIncRef() bool {
+	return r.tryIncRef()
+}
+
+/*
+Expert: decreases the refCount of this IndexReader instance. If the
+refCount drops to 0, then this reader is closed. If an error is hit,
+the refCount is unchanged.
+*/
+func (r *IndexReaderImpl) DecRef() error {
+	return r.decRef()
+}
+
 func (r *IndexReaderImpl) ensureOpen() {
 	if atomic.LoadInt32(&r.refCount) <= 0 {
 		panic("this IndexReader is closed")
@@ -113,7 +223,11 @@ func (r *IndexReaderImpl) registerParentReader(reader IndexReader) {
 }
 
 func (r *IndexReaderImpl) notifyReaderClosedListeners() {
-	panic("not implemented yet")
+	r.readerClosedListenersLock.Lock()
+	defer r.readerClosedListenersLock.Unlock()
+	for _, listener := range r.readerClosedListeners {
+		listener(r.IndexReader)
+	}
 }
 
 func (r *IndexReaderImpl) reportCloseToParentReaders() {
@@ -135,6 +249,14 @@ func (r *IndexReaderImpl) numDeletedDocs() int {
 	return r.MaxDoc() - r.NumDocs()
 }
 
+func (r *IndexReaderImpl) TermVector(docID int, field string) (t Terms, err error) {
+	vectors, err := r.TermVectors(docID)
+	if err != nil || vectors == nil {
+		return nil, err
+	}
+	return vectors.Terms(field), nil
+}
+
 func (r *IndexReaderImpl) Document(docID int) (doc *Document, err error) {
 	visitor := newDocumentStoredFieldVisitor()
 	if err = r.VisitDocument(docID, visitor); err != nil {
@@ -196,6 +318,20 @@ type ARFieldsReader interface {
 	 *  were indexed. The returned instance should only be
 	 *  used by a single thread. */
 	NormValues(field string) (ndv NumericDocValues, err error)
+	// Returns NumericDocValues for this field, or nil if no
+	// NumericDocValues were indexed for this field.
+	NumericDocValues(field string) (v NumericDocValues, err error)
+	// Returns BinaryDocValues for this field, or nil if no
+	// BinaryDocValues were indexed for this field.
+	BinaryDocValues(field string) (v BinaryDocValues, err error)
+	// Returns SortedDocValues for this field, or nil if no
+	// SortedDocValues were indexed for this field.
+	SortedDocValues(field string) (v SortedDocValues, err error)
+	// Returns SortedSetDocValues for this field, or nil if no
+	// SortedSetDocValues were indexed for this field.
+	SortedSetDocValues(field string) (v SortedSetDocValues, err error)
+	// Get the FieldInfos describing all fields in this reader.
+	FieldInfos() model.FieldInfos
 }
 
 type AtomicReader interface {
@@ -19,18 +19,73 @@ func newReaderPool(owner *IndexWriter) *ReaderPool {
 	}
 }
 
+// NOTE: not synchronized, since it's only called from asserts, some
+// of which already hold the pool's lock.
 func (pool *ReaderPool) infoIsLive(info *SegmentInfoPerCommit) bool {
-	panic("not implemented yet")
+	idx := pool.owner.segmentInfos.indexOf(info)
+	assertn(idx != -1, "info=%v isn't live", info)
+	return true
 }
 
 func (pool *ReaderPool) drop(info *SegmentInfoPerCommit) error {
-	pool.Lock()
+	pool.Lock() // synchronized
+	defer pool.Unlock()
+	if rld, ok := pool.readerMap[info]; ok {
+		assert(info == rld.info)
+		delete(pool.readerMap, info)
+		return rld.dropReaders()
+	}
+	return nil
+}
+
+func (pool *ReaderPool) anyPendingDeletes() bool {
+	pool.Lock() // synchronized
 	defer pool.Unlock()
-	panic("not implemented yet")
+	for _, rld := range pool.readerMap {
+		if rld.pendingDeleteCount() != 0 {
+			return true
+		}
+	}
+	return false
 }
 
 func (pool *ReaderPool) release(rld *ReadersAndLiveDocs) error {
-	panic("not implemented yet")
+	return pool.releaseAndAssert(rld, true)
+}
+
+func (pool *ReaderPool) releaseAndAssert(rld *ReadersAndLiveDocs, assertInfoLive bool) error {
+	pool.Lock() // synchronized
+	defer pool.Unlock()
+
+	// Matches incRef in get:
+	rld.decRef()
+
+	// Pool still holds a ref:
+	assert(rld.refCount() >= 1)
+
+	if !pool.owner.poolReaders && rld.refCount() == 1 {
+		// This is the last ref to this RLD, and we're not pooling, so
+		// remove it:
+		ok, err := rld.writeLiveDocs(pool.owner.directory)
+		if err != nil {
+			return err
+		}
+		if ok {
+			// Make sure we only write del docs for a live segment:
+			assert(!assertInfoLive || pool.infoIsLive(rld.info))
+			// Must checkpoint w/ deleter, because we just created new
+			// _X_N.del file.
+			if err = pool.owner.deleter.checkpoint(pool.owner.segmentInfos, false); err != nil {
+				return err
+			}
+		}
+
+		if err = rld.dropReaders(); err != nil {
+			return err
+		}
+		delete(pool.readerMap, rld.info)
+	}
+	return nil
 }
 
 // Remove all our references to readers, and commits any pending changes.
@@ -88,7 +143,10 @@ func (pool *ReaderPool) dropAll(doSave bool) error {
 	return priorE
 }
 
-/* Commit live docs changes for the segment readers for the provided infos. */
+/*
+Commit live docs changes for the segment readers for the provided
+infos. Must be called with the IndexWriter locked.
+*/
 func (pool *ReaderPool) commit(infos *SegmentInfos) error {
 	pool.Lock() // synchronized
 	defer pool.Unlock()
@@ -109,7 +167,7 @@ func (pool *ReaderPool) commit(infos *SegmentInfos) error {
 				// here: it was doen previously (after we invoked
 				// BDS.applyDeletes), whereas here all we did was move the
 				// stats to disk:
-				err = pool.owner.checkpointNoSIS()
+				err = pool.owner._checkpointNoSIS()
 				if err != nil {
 					return err
 				}
@@ -124,7 +182,29 @@ func (pool *ReaderPool) commit(infos *SegmentInfos) error {
 func (pool *ReaderPool) get(info *SegmentInfoPerCommit, create bool) *ReadersAndLiveDocs {
 	pool.Lock() // synchronized
 	defer pool.Unlock()
-	panic("not implemented yet")
+
+	assertn(info.info.Dir == pool.owner.directory,
+		"info.dir=%v vs %v", info.info.Dir, pool.owner.directory)
+
+	rld, ok := pool.readerMap[info]
+	if !ok {
+		if !create {
+			return nil
+		}
+		rld = newReadersAndLiveDocs(pool.owner, info)
+		// Steal initial reference:
+		pool.readerMap[info] = rld
+	} else {
+		// don't check whether the infos are live here: the arguments are
+		// evaluated eagerly, and merged segments are no longer live
+		assertn(rld.info == info, "rld.info=%v info=%v", rld.info, info)
+	}
+
+	if create {
+		// Return ref to caller:
+		rld.incRef()
+	}
+	return rld
 }
 
 /*
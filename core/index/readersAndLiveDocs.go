@@ -1,6 +1,7 @@
 package index
 
 import (
+	"fmt"
 	"github.com/balzaczyy/golucene/core/store"
 	"github.com/balzaczyy/golucene/core/util"
 	"log"
@@ -63,6 +64,22 @@ type ReadersAndLiveDocs struct {
 	// How many further deletions we;ve doen against
 	// liveDocs vs when we loaded it or last wrote it:
 	_pendingDeleteCount int
+
+	// True if the current liveDocs is referenced by an external NRT
+	// reader:
+	shared bool
+
+	writer *IndexWriter
+}
+
+func newReadersAndLiveDocs(writer *IndexWriter, info *SegmentInfoPerCommit) *ReadersAndLiveDocs {
+	return &ReadersAndLiveDocs{
+		Locker:        &sync.Mutex{},
+		refCountMixin: newRefCountMixin(),
+		info:          info,
+		writer:        writer,
+		shared:        true,
+	}
 }
 
 func (rld *ReadersAndLiveDocs) pendingDeleteCount() int {
@@ -75,11 +92,147 @@ func (rld *ReadersAndLiveDocs) pendingDeleteCount() int {
 Get reader for searching/deleting
 */
 func (rld *ReadersAndLiveDocs) reader(ctx store.IOContext) (*SegmentReader, error) {
-	panic("not implemented yet")
+	rld.Lock() // synchronized
+	defer rld.Unlock()
+
+	if err := rld._initReader(ctx); err != nil {
+		return nil, err
+	}
+	// Ref for caller
+	rld._reader.incRef()
+	return rld._reader, nil
+}
+
+func (rld *ReadersAndLiveDocs) _initReader(ctx store.IOContext) error {
+	if rld._reader == nil {
+		// We steal returned ref:
+		r, err := NewSegmentReader(rld.info, rld.writer.config.readerTermsIndexDivisor, ctx)
+		if err != nil {
+			return err
+		}
+		rld._reader = r
+		if rld._liveDocs == nil {
+			rld._liveDocs = r.LiveDocs()
+		}
+	}
+	return nil
+}
+
+/*
+Get reader for merging (does not load the terms index).
+*/
+func (rld *ReadersAndLiveDocs) getMergeReader(ctx store.IOContext) (*SegmentReader, error) {
+	rld.Lock() // synchronized
+	defer rld.Unlock()
+
+	if rld.mergeReader == nil {
+		if rld._reader != nil {
+			// Just use the already opened non-merge reader for merging. In
+			// the NRT case this saves us pointless double-open:
+			rld._reader.incRef()
+			rld.mergeReader = rld._reader
+		} else {
+			// We steal returned ref:
+			r, err := NewSegmentReader(rld.info, -1, ctx)
+			if err != nil {
+				return nil, err
+			}
+			rld.mergeReader = r
+			if rld._liveDocs == nil {
+				rld._liveDocs = r.LiveDocs()
+			}
+		}
+	}
+
+	// Ref for caller
+	rld.mergeReader.incRef()
+	return rld.mergeReader, nil
+}
+
+/*
+Returns a ref to a clone. NOTE: this clone is not enrolled in the
+pool, so you should simply close() it when you're done (ie, do not
+call release()).
+*/
+func (rld *ReadersAndLiveDocs) readOnlyClone(ctx store.IOContext) (*SegmentReader, error) {
+	rld.Lock() // synchronized
+	defer rld.Unlock()
+
+	if err := rld._initReader(ctx); err != nil {
+		return nil, err
+	}
+	rld.shared = true
+	if rld._liveDocs != nil {
+		r := newSegmentReaderWithLiveDocs(rld._reader.si, rld._reader.core, rld._liveDocs,
+			rld.info.info.DocCount()-rld.info.delCount-rld._pendingDeleteCount)
+		r.isNRT = true
+		return r, nil
+	}
+	assert(rld._reader.LiveDocs() == nil)
+	rld._reader.incRef()
+	return rld._reader, nil
 }
 
 func (rld *ReadersAndLiveDocs) release(sr *SegmentReader) error {
-	panic("not implemented yet")
+	rld.Lock() // synchronized
+	defer rld.Unlock()
+	assert(rld.info == sr.si)
+	return sr.decRef()
+}
+
+func (rld *ReadersAndLiveDocs) delete(docID int) bool {
+	rld.Lock() // synchronized
+	defer rld.Unlock()
+
+	assert(rld._liveDocs != nil)
+	assertn(docID >= 0 && docID < rld._liveDocs.Length(),
+		"out of bounds: docid=%v liveDocsLength=%v seg=%v docCount=%v",
+		docID, rld._liveDocs.Length(), rld.info.info.Name, rld.info.info.DocCount())
+	assert(!rld.shared)
+	didDelete := rld._liveDocs.At(docID)
+	if didDelete {
+		rld._liveDocs.(util.MutableBits).Clear(docID)
+		rld._pendingDeleteCount++
+	}
+	return didDelete
+}
+
+/*
+Makes sure liveDocs is a private copy that can be modified, cloning
+it first if it's shared with an NRT reader.
+*/
+func (rld *ReadersAndLiveDocs) initWritableLiveDocs() {
+	rld.Lock() // synchronized
+	defer rld.Unlock()
+
+	assert(rld.info.info.DocCount() > 0)
+	if rld.shared {
+		// Copy on write: this means we've cloned a SegmentReader sharing
+		// the current liveDocs instance; must now make a private clone
+		// so we can change it:
+		liveDocsFormat := rld.info.info.Codec().(Codec).LiveDocsFormat()
+		if rld._liveDocs == nil {
+			rld._liveDocs = liveDocsFormat.NewLiveDocs(rld.info.info.DocCount())
+		} else {
+			rld._liveDocs = liveDocsFormat.CopyLiveDocs(rld._liveDocs)
+		}
+		rld.shared = false
+	} else {
+		assert(rld._liveDocs != nil)
+	}
+}
+
+/*
+Discard (don't save) changes when we are dropping the reader; this is
+used only on the sub-readers after a successful merge. If deletes had
+accumulated on those sub-readers while the merge is running, by now
+we have carried forward those deletes onto the newly merged segment,
+so we can discard them on the sub-readers:
+*/
+func (rld *ReadersAndLiveDocs) dropChanges() {
+	rld.Lock() // synchronized
+	defer rld.Unlock()
+	rld._pendingDeleteCount = 0
 }
 
 // NOTE: removes callers ref
@@ -179,5 +332,6 @@ func (rld *ReadersAndLiveDocs) writeLiveDocs(dir store.Directory) (bool, error)
 }
 
 func (rld *ReadersAndLiveDocs) String() string {
-	panic("not implemented yet")
+	return fmt.Sprintf("ReadersAndLiveDocs(seg=%v pendingDeleteCount=%v liveDocsShared=%v)",
+		rld.info, rld._pendingDeleteCount, rld.shared)
 }
@@ -44,7 +44,7 @@ func NewSegmentInfoPerCommit(info *model.SegmentInfo,
 
 /* Called when we succeed in writing deletes */
 func (info *SegmentInfoPerCommit) advanceDelGen() {
-	info.delGen, info.nextWriteDelGen = info.nextWriteDelGen, info.delGen+1
+	info.delGen, info.nextWriteDelGen = info.nextWriteDelGen, info.nextWriteDelGen+1
 	info.sizeInBytes = -1
 }
 
@@ -86,8 +86,7 @@ func (si *SegmentInfoPerCommit) Files() []string {
 	}
 
 	// Must separately add any live docs files
-	// si.info.codec.LiveDocsFormat().Files(si, files)
-	panic("not implemented yet")
+	si.info.Codec().(Codec).LiveDocsFormat().Files(si, files)
 
 	ans := make([]string, 0, len(files))
 	for s, _ := range files {
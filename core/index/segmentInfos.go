@@ -22,15 +22,14 @@ func NewFindSegmentsFile(directory store.Directory,
 	return &FindSegmentsFile{directory, doBody, 10}
 }
 
-// TODO support IndexCommit
-func (fsf *FindSegmentsFile) run() (obj interface{}, err error) {
+func (fsf *FindSegmentsFile) run(commit IndexCommit) (obj interface{}, err error) {
 	log.Print("Finding segments file...")
-	// if commit != nil {
-	// 	if fsf.directory != commit.Directory {
-	// 		return nil, errors.New("the specified commit does not match the specified Directory")
-	// 	}
-	// 	return fsf.doBody(commit.SegmentsFileName)
-	// }
+	if commit != nil {
+		if fsf.directory != commit.Directory() {
+			return nil, errors.New("the specified commit does not match the specified Directory")
+		}
+		return fsf.doBody(commit.SegmentsFileName())
+	}
 
 	lastGen := int64(-1)
 	gen := int64(0)
@@ -225,7 +224,13 @@ func (fsf *FindSegmentsFile) run() (obj interface{}, err error) {
 // index/SegmentInfos.java
 
 const (
-	VERSION_40                  = 0
+	// The file format version for the segments_N codec header, up to 4.5.
+	VERSION_40 = 0
+	// The file format version for the segments_N codec header, since
+	// 4.8+: the trailing checksum is replaced by a codec footer.
+	// Version 1 (4.6, per-generation field infos) is not supported.
+	VERSION_48 = 2
+
 	FORMAT_SEGMENTS_GEN_CURRENT = -2
 )
 
@@ -253,11 +258,12 @@ Files:
 
 - segments.gen: GenHeader, Generation, Generation
 - segments_N: Header, Version, NameCounter, SegCount,
-  <SegName, SegCodec, DelGen, DeletionCount>^SegCount, CommitUserData, Checksum
+  <SegName, SegCodec, DelGen, DeletionCount>^SegCount, CommitUserData, Footer
 
 Data types:
 
 - Header --> CodecHeader
+- Footer --> CodecFooter
 - Genheader, NameCounter, SegCount, DeletionCount --> int32
 - Generation, Version, DelGen, Checksum --> int64
 - SegName, SegCodec --> string
@@ -274,9 +280,10 @@ Field Descriptions:
   there are no deletes. Anything above zero means there are deletes
   stored by LiveDocsFormat.
 - DeletionCount records the number of deleted documents in this segment.
-- Checksum contains the CRC32 checksum of all bytes in the segments_N
+- Footer contains the CRC32 checksum of all bytes in the segments_N
   file up until the checksum. This is used to verify integrity of the
-  file on opening the index.
+  file on opening the index. Before 4.8, a bare checksum was written
+  instead.
 - SegCodec is the nme of the Codec that encoded this segment.
 - CommitUserData stores an optional user-spplied opaue
   map[string]string that was passed to SetCommitData().
@@ -336,7 +343,7 @@ NOTE: this is an internal utility which is kept public so that it's
 accessible by code from other packages. You should avoid calling this
 method unless you're absolutely sure what you're doing!
 */
-func writeSegmentsGen(dir store.Directory, generation int64) {
+func WriteSegmentsGen(dir store.Directory, generation int64) {
 	if err := func() (err error) {
 		var genOutput store.IndexOutput
 		genOutput, err = dir.CreateOutput(INDEX_FILENAME_SEGMENTS_GEN, store.IO_CONTEXT_READONCE)
@@ -410,12 +417,16 @@ func (sis *SegmentInfos) Read(directory store.Directory, segmentFileName string)
 	if err != nil {
 		return err
 	}
+	var actualVersion int32
 	if format == codec.CODEC_MAGIC {
 		// 4.0+
-		_, err = codec.CheckHeaderNoMagic(input, "segments", VERSION_40, VERSION_40)
+		actualVersion, err = codec.CheckHeaderNoMagic(input, "segments", VERSION_40, VERSION_48)
 		if err != nil {
 			return err
 		}
+		if actualVersion != VERSION_40 && actualVersion != VERSION_48 {
+			return codec.NewIndexFormatTooNewError(input, actualVersion, VERSION_40, VERSION_48)
+		}
 		sis.version, err = input.ReadLong()
 		if err != nil {
 			return err
@@ -429,7 +440,7 @@ func (sis *SegmentInfos) Read(directory store.Directory, segmentFileName string)
 			return err
 		}
 		if numSegments < 0 {
-			return errors.New(fmt.Sprintf("invalid segment count: %v (resource: %v)", numSegments, input))
+			return codec.NewCorruptIndexErrorAt(input, fmt.Sprintf("invalid segment count: %v", numSegments))
 		}
 		for seg := 0; seg < numSegments; seg++ {
 			segName, err := input.ReadString()
@@ -440,10 +451,10 @@ func (sis *SegmentInfos) Read(directory store.Directory, segmentFileName string)
 			if err != nil {
 				return err
 			}
-			if codecName != "Lucene42" {
+			fCodec := LoadCodec(codecName)
+			if fCodec == nil {
 				log.Panicf("Not supported yet: %v", codecName)
 			}
-			fCodec := LoadCodec(codecName)
 			log.Printf("SIS.read seg=%v codec=%v", seg, fCodec)
 			info, err := fCodec.SegmentInfoFormat().SegmentInfoReader()(directory, segName, store.IO_CONTEXT_READ)
 			// method := NewLucene42Codec()
@@ -462,7 +473,7 @@ func (sis *SegmentInfos) Read(directory store.Directory, segmentFileName string)
 				return err
 			}
 			if delCount < 0 || delCount > info.DocCount() {
-				return errors.New(fmt.Sprintf("invalid deletion count: %v (resource: %v)", delCount, input))
+				return codec.NewCorruptIndexErrorAt(input, fmt.Sprintf("invalid deletion count: %v", delCount))
 			}
 			sis.Segments = append(sis.Segments, NewSegmentInfoPerCommit(info, delCount, delGen))
 		}
@@ -472,18 +483,24 @@ func (sis *SegmentInfos) Read(directory store.Directory, segmentFileName string)
 		}
 	} else {
 		// TODO support <4.0 index
-		panic("Index format pre-4.0 not supported yet")
+		return codec.NewIndexFormatTooOldError(input, format, VERSION_40, VERSION_48)
 	}
 
-	checksumNow := int64(input.Checksum())
-	checksumThen, err := input.ReadLong()
-	if err != nil {
-		return err
-	}
-	if checksumNow != checksumThen {
-		return errors.New(fmt.Sprintf(
-			"checksum mismatch in segments file: %v vs %v (resource: %v)",
-			checksumNow, checksumThen, input))
+	if actualVersion >= VERSION_48 {
+		if _, err = codec.CheckFooter(input); err != nil {
+			return err
+		}
+	} else {
+		checksumNow := int64(input.Checksum())
+		checksumThen, err := input.ReadLong()
+		if err != nil {
+			return err
+		}
+		if checksumNow != checksumThen {
+			return codec.NewCorruptIndexErrorAt(input, fmt.Sprintf(
+				"checksum mismatch in segments file: %v vs %v",
+				checksumNow, checksumThen))
+		}
 	}
 
 	success = true
@@ -495,7 +512,7 @@ func (sis *SegmentInfos) ReadAll(directory store.Directory) error {
 	_, err := NewFindSegmentsFile(directory, func(segmentFileName string) (obj interface{}, err error) {
 		err = sis.Read(directory, segmentFileName)
 		return nil, err
-	}).run()
+	}).run(nil)
 	return err
 }
 
@@ -533,7 +550,7 @@ func (sis *SegmentInfos) write(directory store.Directory) error {
 		return err
 	}
 	segnOutput = store.NewChecksumIndexOutput(out)
-	err = codec.WriteHeader(segnOutput, "segments", VERSION_40)
+	err = codec.WriteHeader(segnOutput, "segments", VERSION_48)
 	if err != nil {
 		return err
 	}
@@ -723,7 +740,7 @@ func (sis *SegmentInfos) finishCommit(dir store.Directory) error {
 			}
 		}()
 
-		err := sis.pendingSegnOutput.FinishCommit()
+		err := codec.WriteFooter(sis.pendingSegnOutput)
 		success = err == nil
 		return err
 	}(); err != nil {
@@ -756,10 +773,18 @@ func (sis *SegmentInfos) finishCommit(dir store.Directory) error {
 	}
 
 	sis.lastGeneration = sis.generation
-	writeSegmentsGen(dir, sis.generation)
+	WriteSegmentsGen(dir, sis.generation)
 	return nil
 }
 
+/* Writes & syncs to the Directory dir, taking care to remove the segments file on error. */
+func (sis *SegmentInfos) commit(dir store.Directory) error {
+	if err := sis.prepareCommit(dir); err != nil {
+		return err
+	}
+	return sis.finishCommit(dir)
+}
+
 // L1041
 /*
 Replaces all segments in this instance in this instance, but keeps
@@ -805,11 +830,74 @@ func (sis *SegmentInfos) Clear() {
 	sis.Segments = sis.Segments[:0] // reuse existing space
 }
 
+// L1179
+/*
+Applies the changes of a finished merge: the merged-away segments
+are replaced by the new segment at the position of the first of them
+(or removed altogether if dropSegment is true).
+*/
+func (sis *SegmentInfos) applyMergeChanges(merge *OneMerge, dropSegment bool) {
+	mergedAway := make(map[*SegmentInfoPerCommit]bool)
+	for _, info := range merge.segments {
+		mergedAway[info] = true
+	}
+	inserted := false
+	newSegIdx := 0
+	for segIdx, info := range sis.Segments {
+		assert(segIdx >= newSegIdx)
+		if _, ok := mergedAway[info]; ok {
+			if !inserted && !dropSegment {
+				sis.Segments[segIdx] = merge.info
+				inserted = true
+				newSegIdx++
+			}
+		} else {
+			sis.Segments[newSegIdx] = info
+			newSegIdx++
+		}
+	}
+
+	// the rest of the segments in list are duplicates, so don't remove
+	// from map, only list!
+	for i := newSegIdx; i < len(sis.Segments); i++ {
+		sis.Segments[i] = nil
+	}
+	sis.Segments = sis.Segments[:newSegIdx]
+
+	// Either we found place to insert segment, or, we did not, but only
+	// because all segments we merged became deleted while we are
+	// merging, in which case it should be the case that the new segment
+	// is also all deleted, we insert it at the beginning if it should
+	// not be dropped:
+	if !inserted && !dropSegment {
+		sis.Segments = append([]*SegmentInfoPerCommit{merge.info}, sis.Segments...)
+	}
+}
+
 /*
 Remove the provided SegmentInfoPerCommit.
 
 WARNING: O(N) cost
 */
 func (sis *SegmentInfos) remove(si *SegmentInfoPerCommit) {
-	panic("not implemented yet")
+	if idx := sis.indexOf(si); idx != -1 {
+		copy(sis.Segments[idx:], sis.Segments[idx+1:])
+		sis.Segments[len(sis.Segments)-1] = nil
+		sis.Segments = sis.Segments[:len(sis.Segments)-1]
+	}
+}
+
+/*
+Returns the position of the provided SegmentInfoPerCommit, or -1 if
+it's not in this instance.
+
+WARNING: O(N) cost
+*/
+func (sis *SegmentInfos) indexOf(si *SegmentInfoPerCommit) int {
+	for i, info := range sis.Segments {
+		if info == si {
+			return i
+		}
+	}
+	return -1
 }
@@ -1,7 +1,10 @@
 package index
 
 import (
+	"encoding/binary"
+	"errors"
 	"github.com/balzaczyy/golucene/core/store"
+	"github.com/balzaczyy/golucene/core/util"
 	"testing"
 )
 
@@ -26,3 +29,58 @@ func assertEquals(t *testing.T, a, b interface{}) {
 		t.Errorf("Expected '%v', but '%v'", a, b)
 	}
 }
+
+func TestReadSegmentInfosErrors(t *testing.T) {
+	d := store.NewRAMDirectory()
+	w, err := NewIndexWriter(d, NewIndexWriterConfig(util.VERSION_45, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = new(SegmentInfos).ReadAll(d); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := d.GetRAMFile("segments_1").Buffer(0)
+	length, _ := d.FileLength("segments_1")
+	original := append([]byte(nil), buf[:length]...)
+	read := func(modify func([]byte)) error {
+		copy(buf, original)
+		modify(buf)
+		return new(SegmentInfos).ReadAll(d)
+	}
+
+	var corrupt *CorruptIndexError
+	err = read(func(b []byte) { b[length-1] ^= 0xFF }) // checksum
+	if !errors.As(err, &corrupt) {
+		t.Errorf("Expected CorruptIndexError, but found %v", err)
+	} else if corrupt.Resource == "" || corrupt.FilePointer != length {
+		t.Errorf("Expected resource and file pointer %v, but found %#v", length, corrupt)
+	}
+
+	var tooNew *IndexFormatTooNewError
+	err = read(func(b []byte) {
+		// magic, then "segments" as a string, then the version
+		binary.BigEndian.PutUint32(b[13:], 99)
+	})
+	if !errors.As(err, &tooNew) {
+		t.Errorf("Expected IndexFormatTooNewError, but found %v", err)
+	} else if tooNew.Version != 99 || tooNew.MaxVersion != VERSION_48 {
+		t.Errorf("Expected version 99 > %v, but found %#v", VERSION_48, tooNew)
+	}
+
+	var tooOld *IndexFormatTooOldError
+	err = read(func(b []byte) {
+		binary.BigEndian.PutUint32(b, uint32(0xFFFFFFF5)) // 3.x format -11
+	})
+	if !errors.As(err, &tooOld) {
+		t.Errorf("Expected IndexFormatTooOldError, but found %v", err)
+	} else if tooOld.Version != -11 {
+		t.Errorf("Expected version -11, but found %#v", tooOld)
+	}
+	if errors.As(err, &corrupt) {
+		t.Error("A format error should not be reported as corruption")
+	}
+}
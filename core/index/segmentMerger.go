@@ -0,0 +1,325 @@
+package index
+
+import (
+	"fmt"
+	"github.com/balzaczyy/golucene/core/codec/compressing"
+	"github.com/balzaczyy/golucene/core/index/model"
+	"github.com/balzaczyy/golucene/core/store"
+	"github.com/balzaczyy/golucene/core/util"
+)
+
+// index/SegmentMerger.java
+
+/*
+The SegmentMerger class combines two or more Segments, represented by
+an IndexReader, into a single Segment. Call the merge method to
+combine the segments.
+*/
+type SegmentMerger struct {
+	directory         store.Directory
+	termIndexInterval int
+
+	codec Codec
+
+	context store.IOContext
+
+	mergeState        *MergeState
+	fieldInfosBuilder *model.FieldInfosBuilder
+}
+
+func newSegmentMerger(readers []AtomicReader, segmentInfo *model.SegmentInfo,
+	infoStream util.InfoStream, dir store.Directory, termIndexInterval int,
+	checkAbort *CheckAbort, fieldNumbers *model.FieldNumbers,
+	context store.IOContext) *SegmentMerger {
+
+	m := &SegmentMerger{
+		mergeState:        newMergeState(readers, segmentInfo, infoStream, checkAbort),
+		directory:         dir,
+		termIndexInterval: termIndexInterval,
+		codec:             segmentInfo.Codec().(Codec),
+		context:           context,
+		fieldInfosBuilder: model.NewFieldInfosBuilder(fieldNumbers),
+	}
+	m.mergeState.segmentInfo.SetDocCount(m.setDocMaps())
+	return m
+}
+
+// True if any merging should happen
+func (m *SegmentMerger) shouldMerge() bool {
+	return m.mergeState.segmentInfo.DocCount() > 0
+}
+
+/*
+Merges the readers into the directory passed to the constructor.
+Returns the MergeState, which includes the number of documents that
+were merged.
+*/
+func (m *SegmentMerger) merge() (*MergeState, error) {
+	assert2(m.shouldMerge(), "Merge would result in 0 document segment")
+	// NOTE: it's important to add calls to checkAbort.work(...) if you
+	// make any changes to this method that will spend a lot of time.
+	// The frequency of this check impacts how long IndexWriter.Close(false)
+	// takes to actually stop the goroutines.
+	m.mergeFieldInfos()
+	m.setMatchingSegmentReaders()
+
+	numMerged, err := m.mergeFields()
+	if err != nil {
+		return nil, err
+	}
+	assert2(numMerged == m.mergeState.segmentInfo.DocCount(), fmt.Sprintf(
+		"stored fields merged %v docs, but %v expected",
+		numMerged, m.mergeState.segmentInfo.DocCount()))
+
+	segmentWriteState := newSegmentWriteState(m.mergeState.infoStream,
+		m.directory, m.mergeState.segmentInfo, m.mergeState.fieldInfos,
+		m.termIndexInterval, nil, m.context)
+	if err = m.mergeTerms(segmentWriteState); err != nil {
+		return nil, err
+	}
+
+	if m.mergeState.fieldInfos.HasDocValues {
+		if err = m.mergeDocValues(segmentWriteState); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.mergeState.fieldInfos.HasNorms {
+		if err = m.mergeNorms(segmentWriteState); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.mergeState.fieldInfos.HasVectors {
+		if numMerged, err = m.mergeVectors(); err != nil {
+			return nil, err
+		}
+		assert2(numMerged == m.mergeState.segmentInfo.DocCount(), fmt.Sprintf(
+			"term vectors merged %v docs, but %v expected",
+			numMerged, m.mergeState.segmentInfo.DocCount()))
+	}
+
+	// write the merged infos
+	fieldInfosWriter := m.codec.FieldInfosFormat().FieldInfosWriter()
+	err = fieldInfosWriter(m.directory, m.mergeState.segmentInfo.Name,
+		m.mergeState.fieldInfos, m.context)
+	if err != nil {
+		return nil, err
+	}
+	return m.mergeState, nil
+}
+
+func (m *SegmentMerger) mergeDocValues(segmentWriteState SegmentWriteState) (err error) {
+	consumer, err := m.codec.DocValuesFormat().FieldsConsumer(segmentWriteState)
+	if err != nil {
+		return err
+	}
+	defer func() { err = mergeError(err, consumer.Close()) }()
+
+	for _, field := range m.mergeState.fieldInfos.Values {
+		switch field.DocValuesType() {
+		case model.DOC_VALUES_TYPE_NUMERIC:
+			toMerge := make([]NumericDocValues, len(m.mergeState.readers))
+			for i, reader := range m.mergeState.readers {
+				if toMerge[i], err = reader.NumericDocValues(field.Name); err != nil {
+					return err
+				}
+				if toMerge[i] == nil {
+					toMerge[i] = EMPTY_NUMERIC_DOC_VALUES
+				}
+			}
+			err = mergeNumericField(consumer, field, m.mergeState, toMerge)
+		case model.DOC_VALUES_TYPE_BINARY:
+			toMerge := make([]BinaryDocValues, len(m.mergeState.readers))
+			for i, reader := range m.mergeState.readers {
+				if toMerge[i], err = reader.BinaryDocValues(field.Name); err != nil {
+					return err
+				}
+				if toMerge[i] == nil {
+					toMerge[i] = EMPTY_BINARY_DOC_VALUES
+				}
+			}
+			err = mergeBinaryField(consumer, field, m.mergeState, toMerge)
+		case model.DOC_VALUES_TYPE_SORTED:
+			toMerge := make([]SortedDocValues, len(m.mergeState.readers))
+			for i, reader := range m.mergeState.readers {
+				if toMerge[i], err = reader.SortedDocValues(field.Name); err != nil {
+					return err
+				}
+				if toMerge[i] == nil {
+					toMerge[i] = EMPTY_SORTED_DOC_VALUES
+				}
+			}
+			err = mergeSortedField(consumer, field, m.mergeState, toMerge)
+		case model.DOC_VALUES_TYPE_SORTED_SET:
+			toMerge := make([]SortedSetDocValues, len(m.mergeState.readers))
+			for i, reader := range m.mergeState.readers {
+				if toMerge[i], err = reader.SortedSetDocValues(field.Name); err != nil {
+					return err
+				}
+				if toMerge[i] == nil {
+					toMerge[i] = EMPTY_SORTED_SET_DOC_VALUES
+				}
+			}
+			err = mergeSortedSetField(consumer, field, m.mergeState, toMerge)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *SegmentMerger) mergeNorms(segmentWriteState SegmentWriteState) (err error) {
+	consumer, err := m.codec.NormsFormat().NormsConsumer(segmentWriteState)
+	if err != nil {
+		return err
+	}
+	defer func() { err = mergeError(err, consumer.Close()) }()
+
+	for _, field := range m.mergeState.fieldInfos.Values {
+		if field.HasNorms() {
+			toMerge := make([]NumericDocValues, len(m.mergeState.readers))
+			for i, reader := range m.mergeState.readers {
+				if toMerge[i], err = reader.NormValues(field.Name); err != nil {
+					return err
+				}
+				if toMerge[i] == nil {
+					toMerge[i] = EMPTY_NUMERIC_DOC_VALUES
+				}
+			}
+			if err = mergeNumericField(consumer, field, m.mergeState, toMerge); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *SegmentMerger) setMatchingSegmentReaders() {
+	// If the i'th reader is a SegmentReader and has identical
+	// fieldName -> number mapping, then this array will be non-nil at
+	// position i:
+	numReaders := len(m.mergeState.readers)
+	m.mergeState.matchingSegmentReaders = make([]*SegmentReader, numReaders)
+
+	// If this reader is a SegmentReader, and all of its field name ->
+	// number mappings match the "merged" FieldInfos, then we can do a
+	// bulk copy of the stored fields:
+	for i, reader := range m.mergeState.readers {
+		// TODO: we may be able to broaden this to non-SegmentReaders,
+		// since FieldInfos is now required? But... this'd also require
+		// exposing bulk-copy (TVs and stored fields) API in foreign
+		// readers..
+		if segmentReader, ok := reader.(*SegmentReader); ok {
+			same := true
+			for _, fi := range segmentReader.FieldInfos().Values {
+				other := m.mergeState.fieldInfos.FieldInfoByNumber(int(fi.Number))
+				if other.Name != fi.Name {
+					same = false
+					break
+				}
+			}
+			if same {
+				m.mergeState.matchingSegmentReaders[i] = segmentReader
+				m.mergeState.matchedCount++
+			}
+		}
+	}
+
+	if m.mergeState.infoStream.IsEnabled("SM") {
+		m.mergeState.infoStream.Message("SM", "merge store matchedCount=%v vs %v",
+			m.mergeState.matchedCount, numReaders)
+		if m.mergeState.matchedCount != numReaders {
+			m.mergeState.infoStream.Message("SM", "%v non-bulk merges",
+				numReaders-m.mergeState.matchedCount)
+		}
+	}
+}
+
+func (m *SegmentMerger) mergeFieldInfos() {
+	for _, reader := range m.mergeState.readers {
+		for _, fi := range reader.FieldInfos().Values {
+			m.fieldInfosBuilder.Add(fi)
+		}
+	}
+	m.mergeState.fieldInfos = m.fieldInfosBuilder.Finish()
+}
+
+/*
+Merge stored fields from each of the segments into the new one.
+Returns the number of documents that were merged.
+*/
+func (m *SegmentMerger) mergeFields() (n int, err error) {
+	fieldsWriter, err := m.codec.StoredFieldsFormat().FieldsWriter(
+		m.directory, m.mergeState.segmentInfo, m.context)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { err = mergeError(err, fieldsWriter.Close()) }()
+
+	if w, ok := fieldsWriter.(*compressing.CompressingStoredFieldsWriter); ok {
+		return mergeCompressingStoredFields(w, m.mergeState)
+	}
+	return mergeStoredFields(fieldsWriter, m.mergeState)
+}
+
+/*
+Merge the TermVectors from each of the segments into the new one.
+Returns the number of documents that were merged.
+*/
+func (m *SegmentMerger) mergeVectors() (n int, err error) {
+	termVectorsWriter, err := m.codec.TermVectorsFormat().VectorsWriter(
+		m.directory, m.mergeState.segmentInfo, m.context)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { err = mergeError(err, termVectorsWriter.Close()) }()
+
+	if w, ok := termVectorsWriter.(*compressing.CompressingTermVectorsWriter); ok {
+		return mergeCompressingTermVectors(w, m.mergeState)
+	}
+	return mergeTermVectors(termVectorsWriter, m.mergeState)
+}
+
+// Returns the number of documents in the merged segment.
+func (m *SegmentMerger) setDocMaps() int {
+	numReaders := len(m.mergeState.readers)
+
+	// Remap docIDs
+	m.mergeState.docMaps = make([]*DocMap, numReaders)
+	m.mergeState.docBase = make([]int, numReaders)
+
+	docBase := 0
+	for i, reader := range m.mergeState.readers {
+		m.mergeState.docBase[i] = docBase
+		docMap := buildDocMap(reader)
+		m.mergeState.docMaps[i] = docMap
+		docBase += docMap.numDocs()
+	}
+	return docBase
+}
+
+func (m *SegmentMerger) mergeTerms(segmentWriteState SegmentWriteState) (err error) {
+	var fields []Fields
+	var slices []ReaderSlice
+
+	docBase := 0
+	for readerIndex, reader := range m.mergeState.readers {
+		f := reader.Fields()
+		maxDoc := reader.MaxDoc()
+		if f != nil {
+			slices = append(slices, ReaderSlice{docBase, maxDoc, readerIndex})
+			fields = append(fields, f)
+		}
+		docBase += maxDoc
+	}
+
+	consumer, err := m.codec.PostingsFormat().FieldsConsumer(segmentWriteState)
+	if err != nil {
+		return err
+	}
+	defer func() { err = mergeError(err, consumer.Close()) }()
+
+	return mergeFieldsConsumer(consumer, m.mergeState, NewMultiFields(fields, slices))
+}
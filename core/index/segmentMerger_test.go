@@ -0,0 +1,99 @@
+package index
+
+import (
+	"fmt"
+	"github.com/balzaczyy/golucene/core/index/model"
+	"github.com/balzaczyy/golucene/core/store"
+	"github.com/balzaczyy/golucene/core/util"
+	"testing"
+)
+
+type deletedDocs []bool
+
+func (d deletedDocs) At(i int) bool { return !d[i] }
+func (d deletedDocs) Length() int   { return len(d) }
+
+func TestDocMap(t *testing.T) {
+	docMap := &DocMap{maxDoc: 5, numDeletedDocs: 2, docMap: []int{0, -1, 1, -1, 2}}
+	if docMap.numDocs() != 3 || !docMap.hasDeletions() {
+		t.Errorf("Expected 3 live docs with deletions, but found %v", docMap.numDocs())
+	}
+	for docID, expected := range []int{0, -1, 1, -1, 2} {
+		if n := docMap.get(docID); n != expected {
+			t.Errorf("Doc %v should be mapped to %v, but found %v", docID, expected, n)
+		}
+	}
+
+	docMap = &DocMap{maxDoc: 3}
+	if docMap.hasDeletions() || docMap.get(2) != 2 {
+		t.Error("A DocMap without deletions should map each doc to itself.")
+	}
+}
+
+func TestMergeStoredFields(t *testing.T) {
+	d, err := store.OpenFSDirectory("../search/testdata/belfrysample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := OpenDirectoryReader(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var readers []AtomicReader
+	for _, ctx := range r.Leaves() {
+		readers = append(readers, ctx.reader)
+	}
+	// Merge the same segment twice, so that doc IDs are rebased
+	readers = append(readers, readers...)
+
+	dir := store.NewRAMDirectory()
+	codec := LoadCodec("Lucene42")
+	info := model.NewSegmentInfo(dir, util.LUCENE_MAIN_VERSION, "_0", -1, false, codec, nil, nil)
+	merger := newSegmentMerger(readers, info, util.NO_OUTPUT, dir, DEFAULT_TERM_INDEX_INTERVAL,
+		CHECK_ABORT_NONE, model.NewFieldNumbers(), store.IO_CONTEXT_DEFAULT)
+
+	expected := 2 * r.NumDocs()
+	if info.DocCount() != expected {
+		t.Fatalf("Merged segment should have %v docs, but found %v", expected, info.DocCount())
+	}
+
+	merger.mergeFieldInfos()
+	merger.setMatchingSegmentReaders()
+	if merger.mergeState.matchedCount != len(readers) {
+		t.Errorf("All %v readers should be matched, but found %v",
+			len(readers), merger.mergeState.matchedCount)
+	}
+	n, err := merger.mergeFields()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != expected {
+		t.Fatalf("Should merge %v docs, but found %v", expected, n)
+	}
+
+	fieldsReader, err := codec.StoredFieldsFormat().FieldsReader(dir, info,
+		merger.mergeState.fieldInfos, store.IO_CONTEXT_READ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fieldsReader.Close()
+
+	source := readers[0].(*SegmentReader)
+	for docID := 0; docID < expected; docID++ {
+		want, got := new(storedFieldsCollector), new(storedFieldsCollector)
+		if err = source.VisitDocument(docID%r.NumDocs(), want); err != nil {
+			t.Fatal(err)
+		}
+		if err = fieldsReader.visitDocument(docID, got); err != nil {
+			t.Fatal(err)
+		}
+		if len(want.values) == 0 {
+			t.Fatalf("Doc %v should have stored fields", docID)
+		}
+		if fmt.Sprint(want.values) != fmt.Sprint(got.values) {
+			t.Errorf("Doc %v should have %v, but found %v", docID, want.values, got.values)
+		}
+	}
+}
@@ -26,7 +26,10 @@ type SegmentReader struct {
 	// were created as an NRT reader from IW, in which case IW
 	// tells us the docCount:
 	numDocs int
-	core    SegmentCoreReaders
+	core    *SegmentCoreReaders
+	// True if the live docs were provided by IndexWriter, and may hold
+	// deletes not yet committed.
+	isNRT bool
 }
 
 /**
@@ -64,9 +67,14 @@ func NewSegmentReader(si *SegmentInfoPerCommit, termInfosIndexDivisor int, conte
 	}()
 
 	if si.HasDeletions() {
-		panic("not supported yet")
+		// NOTE: the bitvector is stored using the regular directory, not cfs
+		r.liveDocs, err = si.info.Codec().(Codec).LiveDocsFormat().ReadLiveDocs(
+			si.info.Dir, si, store.IO_CONTEXT_READONCE)
+		if err != nil {
+			return r, err
+		}
 	} else {
-		// assert si.getDelCount() == 0
+		assert(si.delCount == 0)
 		// r.liveDocs = nil
 	}
 	r.numDocs = si.info.DocCount() - si.delCount
@@ -74,6 +82,45 @@ func NewSegmentReader(si *SegmentInfoPerCommit, termInfosIndexDivisor int, conte
 	return r, nil
 }
 
+/*
+Create new SegmentReader sharing core from a previous SegmentReader
+and loading new live docs from a new deletes file. Used by
+OpenIfChanged().
+*/
+func newSegmentReaderFromCore(si *SegmentInfoPerCommit, core *SegmentCoreReaders,
+	context store.IOContext) (*SegmentReader, error) {
+	if !si.HasDeletions() {
+		// only when reopening an NRT reader at a commit
+		assert(si.delCount == 0)
+		return newSegmentReaderSharingCore(si, core, nil, si.info.DocCount()), nil
+	}
+	liveDocs, err := si.info.Codec().(Codec).LiveDocsFormat().ReadLiveDocs(si.info.Dir, si, context)
+	if err != nil {
+		return nil, err
+	}
+	return newSegmentReaderWithLiveDocs(si, core, liveDocs, si.info.DocCount()-si.delCount), nil
+}
+
+/*
+Create new SegmentReader sharing core from a previous SegmentReader
+and using the provided in-memory liveDocs. Used by IndexWriter to
+provide a new NRT reader.
+*/
+func newSegmentReaderWithLiveDocs(si *SegmentInfoPerCommit, core *SegmentCoreReaders,
+	liveDocs util.Bits, numDocs int) *SegmentReader {
+	assert(liveDocs != nil)
+	return newSegmentReaderSharingCore(si, core, liveDocs, numDocs)
+}
+
+func newSegmentReaderSharingCore(si *SegmentInfoPerCommit, core *SegmentCoreReaders,
+	liveDocs util.Bits, numDocs int) *SegmentReader {
+	r := &SegmentReader{si: si, core: core, liveDocs: liveDocs, numDocs: numDocs}
+	r.AtomicReaderImpl = newAtomicReader(r)
+	r.ARFieldsReader = r
+	core.incRef()
+	return r
+}
+
 func (r *SegmentReader) LiveDocs() util.Bits {
 	r.ensureOpen()
 	return r.liveDocs
@@ -115,12 +162,51 @@ func (r *SegmentReader) MaxDoc() int {
 	return r.si.info.DocCount()
 }
 
+// Expert: retrieve thread-private TermVectorsReader, or nil if the
+// segment has no term vectors.
 func (r *SegmentReader) TermVectorsReader() TermVectorsReader {
-	panic("not implemented yet")
+	r.ensureOpen()
+	return r.core.termVectorsLocal()
 }
 
 func (r *SegmentReader) TermVectors(docID int) (fs Fields, err error) {
-	panic("not implemented yet")
+	termVectorsReader := r.TermVectorsReader()
+	if termVectorsReader == nil {
+		return nil, nil
+	}
+	r.checkBounds(docID)
+	return termVectorsReader.get(docID)
+}
+
+func (r *SegmentReader) CheckIntegrity() error {
+	r.ensureOpen()
+	// stored fields
+	if err := r.core.fieldsReaderOrig.CheckIntegrity(); err != nil {
+		return err
+	}
+	// term vectors
+	if r.core.termVectorsReaderOrig != nil {
+		if err := r.core.termVectorsReaderOrig.CheckIntegrity(); err != nil {
+			return err
+		}
+	}
+	// terms/postings
+	if r.core.fields != nil {
+		if err := r.core.fields.CheckIntegrity(); err != nil {
+			return err
+		}
+	}
+	// norms
+	if r.core.normsProducer != nil {
+		if err := r.core.normsProducer.CheckIntegrity(); err != nil {
+			return err
+		}
+	}
+	// docvalues
+	if r.core.dvProducer != nil {
+		return r.core.dvProducer.CheckIntegrity()
+	}
+	return nil
 }
 
 func (r *SegmentReader) checkBounds(docID int) {
@@ -165,22 +251,22 @@ func (r *SegmentReader) TermInfosIndexDivisor() int {
 
 func (r *SegmentReader) NumericDocValues(field string) (v NumericDocValues, err error) {
 	r.ensureOpen()
-	panic("not implemented yet")
+	return r.core.numericDocValues(field)
 }
 
 func (r *SegmentReader) BinaryDocValues(field string) (v BinaryDocValues, err error) {
 	r.ensureOpen()
-	panic("not implemented yet")
+	return r.core.binaryDocValues(field)
 }
 
 func (r *SegmentReader) SortedDocValues(field string) (v SortedDocValues, err error) {
 	r.ensureOpen()
-	panic("not implemented yet")
+	return r.core.sortedDocValues(field)
 }
 
 func (r *SegmentReader) SortedSetDocValues(field string) (v SortedSetDocValues, err error) {
 	r.ensureOpen()
-	panic("not implemented yet")
+	return r.core.sortedSetDocValues(field)
 }
 
 func (r *SegmentReader) NormValues(field string) (v NumericDocValues, err error) {
@@ -217,6 +303,7 @@ type SegmentCoreReaders struct {
 	 TODO redesign when ported to goroutines
 	*/
 	fieldsReaderLocal func() StoredFieldsReader
+	termVectorsLocal  func() TermVectorsReader
 	normsLocal        func() map[string]interface{}
 
 	addListener    chan CoreClosedListener
@@ -225,13 +312,13 @@ type SegmentCoreReaders struct {
 }
 
 func newSegmentCoreReaders(owner *SegmentReader, dir store.Directory, si *SegmentInfoPerCommit,
-	context store.IOContext, termsIndexDivisor int) (self SegmentCoreReaders, err error) {
+	context store.IOContext, termsIndexDivisor int) (self *SegmentCoreReaders, err error) {
 	if termsIndexDivisor == 0 {
 		panic("indexDivisor must be < 0 (don't load terms index) or greater than 0 (got 0)")
 	}
 	log.Printf("Initializing SegmentCoreReaders from directory: %v", dir)
 
-	self = SegmentCoreReaders{
+	self = &SegmentCoreReaders{
 		refCount: 1,
 		normsLocal: func() map[string]interface{} {
 			return make(map[string]interface{})
@@ -240,6 +327,12 @@ func newSegmentCoreReaders(owner *SegmentReader, dir store.Directory, si *Segmen
 	self.fieldsReaderLocal = func() StoredFieldsReader {
 		return self.fieldsReaderOrig.Clone()
 	}
+	self.termVectorsLocal = func() TermVectorsReader {
+		if self.termVectorsReaderOrig == nil {
+			return nil
+		}
+		return self.termVectorsReaderOrig.clone()
+	}
 
 	log.Print("Initializing listeners...")
 	self.addListener = make(chan CoreClosedListener)
@@ -387,6 +480,51 @@ func (r *SegmentCoreReaders) normValues(field string) (ndv NumericDocValues, err
 	return
 }
 
+func (r *SegmentCoreReaders) numericDocValues(field string) (v NumericDocValues, err error) {
+	if fi := r.fieldInfos.FieldInfoByName(field); fi.Name != "" &&
+		fi.DocValuesType() == model.DOC_VALUES_TYPE_NUMERIC {
+		assert(r.dvProducer != nil)
+		return r.dvProducer.Numeric(fi)
+	} // else field does not exist, or has no or another type of doc values
+	return nil, nil
+}
+
+func (r *SegmentCoreReaders) binaryDocValues(field string) (v BinaryDocValues, err error) {
+	if fi := r.fieldInfos.FieldInfoByName(field); fi.Name != "" &&
+		fi.DocValuesType() == model.DOC_VALUES_TYPE_BINARY {
+		assert(r.dvProducer != nil)
+		return r.dvProducer.Binary(fi)
+	} // else field does not exist, or has no or another type of doc values
+	return nil, nil
+}
+
+func (r *SegmentCoreReaders) sortedDocValues(field string) (v SortedDocValues, err error) {
+	if fi := r.fieldInfos.FieldInfoByName(field); fi.Name != "" &&
+		fi.DocValuesType() == model.DOC_VALUES_TYPE_SORTED {
+		assert(r.dvProducer != nil)
+		return r.dvProducer.Sorted(fi)
+	} // else field does not exist, or has no or another type of doc values
+	return nil, nil
+}
+
+func (r *SegmentCoreReaders) sortedSetDocValues(field string) (v SortedSetDocValues, err error) {
+	if fi := r.fieldInfos.FieldInfoByName(field); fi.Name != "" &&
+		fi.DocValuesType() == model.DOC_VALUES_TYPE_SORTED_SET {
+		assert(r.dvProducer != nil)
+		return r.dvProducer.SortedSet(fi)
+	} // else field does not exist, or has no or another type of doc values
+	return nil, nil
+}
+
+func (r *SegmentCoreReaders) incRef() {
+	for count := atomic.LoadInt32(&r.refCount); count > 0; count = atomic.LoadInt32(&r.refCount) {
+		if atomic.CompareAndSwapInt32(&r.refCount, count, count+1) {
+			return
+		}
+	}
+	panic("SegmentCoreReaders is already closed")
+}
+
 func (r *SegmentCoreReaders) decRef() {
 	if atomic.AddInt32(&r.refCount, -1) == 0 {
 		util.Close( /*self.termVectorsLocal, self.fieldsReaderLocal, docValuesLocal, r.normsLocal,*/
@@ -402,21 +540,53 @@ func (r *SegmentCoreReaders) decRef() {
 type NumericDocValues func(docID int) int64
 
 type BinaryDocValues interface {
-	value(docID int, result []byte)
+	value(docID int) []byte
 }
 type SortedDocValues interface {
 	BinaryDocValues
 	ord(docID int) int
-	lookupOrd(ord int, result []byte)
+	lookupOrd(ord int) []byte
 	valueCount() int
 }
+
+// When returned by nextOrd() it means there are no more ordinals for
+// the document.
+const NO_MORE_ORDS = -1
+
 type SortedSetDocValues interface {
 	nextOrd() int64
 	setDocument(docID int)
-	lookupOrd(ord int64, result []byte)
+	lookupOrd(ord int64) []byte
 	valueCount() int64
 }
 
+// An empty NumericDocValues which returns zero for every document
+var EMPTY_NUMERIC_DOC_VALUES = NumericDocValues(func(docID int) int64 { return 0 })
+
+// An empty BinaryDocValues which returns empty bytes for every document
+var EMPTY_BINARY_DOC_VALUES BinaryDocValues = emptyDocValues{}
+
+// An empty SortedDocValues which returns -1 for every document
+var EMPTY_SORTED_DOC_VALUES SortedDocValues = emptyDocValues{}
+
+// An empty SortedSetDocValues which returns NO_MORE_ORDS for every
+// document
+var EMPTY_SORTED_SET_DOC_VALUES SortedSetDocValues = emptySortedSetDocValues{}
+
+type emptyDocValues struct{}
+
+func (dv emptyDocValues) value(docID int) []byte   { return nil }
+func (dv emptyDocValues) ord(docID int) int        { return -1 }
+func (dv emptyDocValues) lookupOrd(ord int) []byte { panic("should not be called") }
+func (dv emptyDocValues) valueCount() int          { return 0 }
+
+type emptySortedSetDocValues struct{}
+
+func (dv emptySortedSetDocValues) nextOrd() int64             { return NO_MORE_ORDS }
+func (dv emptySortedSetDocValues) setDocument(docID int)      {}
+func (dv emptySortedSetDocValues) lookupOrd(ord int64) []byte { panic("should not be called") }
+func (dv emptySortedSetDocValues) valueCount() int64          { return 0 }
+
 type StoredFieldVisitor interface {
 	binaryField(fi model.FieldInfo, value []byte) error
 	stringField(fi model.FieldInfo, value string) error
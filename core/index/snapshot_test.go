@@ -0,0 +1,179 @@
+package index
+
+import (
+	"github.com/balzaczyy/golucene/core/store"
+	"github.com/balzaczyy/golucene/core/util"
+	"testing"
+)
+
+func TestSnapshotDeletionPolicy(t *testing.T) {
+	var srcs []store.Directory
+	for _, path := range []string{
+		"../search/testdata/belfrysample",
+		"../search/testdata/osx/belfrysample",
+	} {
+		src, err := store.OpenFSDirectory(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer src.Close()
+		srcs = append(srcs, src)
+	}
+
+	sdp := NewSnapshotDeletionPolicy(DEFAULT_DELETION_POLICY)
+	if _, err := sdp.Snapshot(); err == nil {
+		t.Error("expected error snapshotting without a writer")
+	}
+	d := store.NewRAMDirectory()
+	w, err := NewIndexWriter(d, NewIndexWriterConfig(util.VERSION_45, nil).
+		SetIndexDeletionPolicy(sdp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if w.Config().IndexDeletionPolicy() != sdp {
+		t.Error("expected the policy passed to the config")
+	}
+	if _, err = sdp.Snapshot(); err == nil {
+		t.Error("expected error snapshotting an empty index")
+	}
+
+	if err = w.AddIndexes(srcs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := sdp.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sdp.Snapshot(); err != nil { // held twice
+		t.Fatal(err)
+	}
+
+	if err = w.AddIndexes(srcs[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range snapshot.FileNames() {
+		if !d.FileExists(name) {
+			t.Errorf("%v of the snapshot was deleted", name)
+		}
+	}
+	if n := sdp.SnapshotCount(); n != 2 {
+		t.Errorf("expected 2 snapshots, got %v", n)
+	}
+	if sdp.IndexCommit(snapshot.Generation()) == nil || len(sdp.Snapshots()) != 1 {
+		t.Error("expected the snapshotted commit to be listed")
+	}
+
+	for i := 0; i < 2; i++ {
+		if err = sdp.Release(snapshot); err != nil {
+			t.Fatal(err)
+		}
+		// still held once after the first release
+		if err = w.DeleteUnusedFiles(); err != nil {
+			t.Fatal(err)
+		}
+		if exists := d.FileExists(snapshot.SegmentsFileName()); exists != (i == 0) {
+			t.Errorf("after %v releases, %v exists: %v", i+1, snapshot.SegmentsFileName(), exists)
+		}
+	}
+	if err = sdp.Release(snapshot); err == nil {
+		t.Error("expected error releasing a commit which is not snapshotted")
+	}
+}
+
+func TestPersistentSnapshotDeletionPolicy(t *testing.T) {
+	src, err := store.OpenFSDirectory("../search/testdata/belfrysample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	d := store.NewRAMDirectory()
+	if _, err = NewPersistentSnapshotDeletionPolicy(
+		DEFAULT_DELETION_POLICY, d, OPEN_MODE_APPEND); err == nil {
+		t.Error("expected error appending to missing snapshots")
+	}
+	openWriter := func() (*IndexWriter, *PersistentSnapshotDeletionPolicy) {
+		psdp, err := NewPersistentSnapshotDeletionPolicy(
+			DEFAULT_DELETION_POLICY, d, OPEN_MODE_CREATE_OR_APPEND)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := NewIndexWriter(d, NewIndexWriterConfig(util.VERSION_45, nil).
+			SetIndexDeletionPolicy(psdp))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return w, psdp
+	}
+
+	w, psdp := openWriter()
+	if err = w.AddIndexes(src); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := psdp.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if psdp.LastSaveFile() != "snapshots_0" || !d.FileExists("snapshots_0") {
+		t.Errorf("expected snapshots_0 to be written, got '%v'", psdp.LastSaveFile())
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the snapshot survives the restart, and protects its commit
+	w, psdp = openWriter()
+	if n := psdp.SnapshotCount(); n != 1 {
+		t.Fatalf("expected 1 snapshot, got %v", n)
+	}
+	if psdp.IndexCommit(snapshot.Generation()) == nil {
+		t.Fatal("expected the snapshotted commit to be resolved")
+	}
+	if err = w.AddIndexes(src); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if !d.FileExists(snapshot.SegmentsFileName()) {
+		t.Errorf("%v of the snapshot was deleted", snapshot.SegmentsFileName())
+	}
+
+	if err = psdp.ReleaseGen(snapshot.Generation()); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.DeleteUnusedFiles(); err != nil {
+		t.Fatal(err)
+	}
+	if d.FileExists(snapshot.SegmentsFileName()) {
+		t.Errorf("%v should be deleted once released", snapshot.SegmentsFileName())
+	}
+	if psdp.LastSaveFile() != "snapshots_1" || d.FileExists("snapshots_0") {
+		t.Errorf("expected only snapshots_1 to remain, got '%v'", psdp.LastSaveFile())
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	psdp, err = NewPersistentSnapshotDeletionPolicy(DEFAULT_DELETION_POLICY, d, OPEN_MODE_APPEND)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := psdp.SnapshotCount(); n != 0 {
+		t.Errorf("expected no snapshots, got %v", n)
+	}
+	if _, err = NewPersistentSnapshotDeletionPolicy(
+		DEFAULT_DELETION_POLICY, d, OPEN_MODE_CREATE); err != nil || d.FileExists("snapshots_1") {
+		t.Errorf("expected prior snapshots to be cleared: %v", err)
+	}
+}
@@ -9,7 +9,7 @@ import (
 
 type StoredFieldsConsumer interface {
 	addField(docId int, field IndexableField, fieldInfo model.FieldInfo)
-	flush(state SegmentWriteState) error
+	flush(state *SegmentWriteState) error
 	abort()
 	startDocument()
 	finishDocument() error
@@ -35,7 +35,7 @@ func (p *TwoStoredFieldsConsumers) addField(docId int, field IndexableField, fie
 	p.second.addField(docId, field, fieldInfo)
 }
 
-func (p *TwoStoredFieldsConsumers) flush(state SegmentWriteState) error {
+func (p *TwoStoredFieldsConsumers) flush(state *SegmentWriteState) error {
 	err := p.first.flush(state)
 	if err == nil {
 		err = p.second.flush(state)
@@ -49,16 +49,16 @@ func (p *TwoStoredFieldsConsumers) abort() {
 }
 
 func (p *TwoStoredFieldsConsumers) startDocument() {
-	// err := p.first.startDocument()
-	// if err == nil {
-	// 	err = p.second.startDocument()
-	// }
-	// return err
-	panic("not implemented yet")
+	p.first.startDocument()
+	p.second.startDocument()
 }
 
 func (p *TwoStoredFieldsConsumers) finishDocument() error {
-	panic("not implemented yet")
+	err := p.first.finishDocument()
+	if err == nil {
+		err = p.second.finishDocument()
+	}
+	return err
 }
 
 // index/StoredFieldsProcessor.java
@@ -99,7 +99,7 @@ func (p *StoredFieldsProcessor) startDocument() {
 	p.reset()
 }
 
-func (p *StoredFieldsProcessor) flush(state SegmentWriteState) (err error) {
+func (p *StoredFieldsProcessor) flush(state *SegmentWriteState) (err error) {
 	numDocs := state.segmentInfo.DocCount()
 	if numDocs > 0 {
 		// It's possible that all documents seen in this segment hit
@@ -171,12 +171,47 @@ func (p *StoredFieldsProcessor) fill(docId int) error {
 	return nil
 }
 
-func (p *StoredFieldsProcessor) finishDocument() error {
-	panic("not implemented yet")
+func (p *StoredFieldsProcessor) finishDocument() (err error) {
+	if err = p.initFieldsWriter(store.IO_CONTEXT_DEFAULT); err != nil {
+		return err
+	}
+	if err = p.fill(p.docState.docID); err != nil {
+		return err
+	}
+
+	if w := p.fieldsWriter; w != nil && p.numStoredFields > 0 {
+		if err = w.StartDocument(p.numStoredFields); err != nil {
+			return err
+		}
+		for i, field := range p.storedFields {
+			if err = w.WriteField(p.fieldInfos[i], storedValue(field)); err != nil {
+				return err
+			}
+		}
+		if err = w.FinishDocument(); err != nil {
+			return err
+		}
+		p.lastDocId++
+	}
+
+	p.reset()
+	return nil
+}
+
+/* Returns the value a StoredFieldsWriter should write for the field. */
+func storedValue(field IndexableField) interface{} {
+	if v := field.binaryValue(); v != nil {
+		return v
+	}
+	return field.stringValue()
 }
 
 func (p *StoredFieldsProcessor) addField(docId int, field IndexableField, fieldInfo model.FieldInfo) {
-	panic("not implemented yet")
+	if field.fieldType().Stored() {
+		p.storedFields = append(p.storedFields, field)
+		p.fieldInfos = append(p.fieldInfos, fieldInfo)
+		p.numStoredFields++
+	}
 }
 
 // index/DocValuesProcessor.java
@@ -195,11 +230,38 @@ func (p *DocValuesProcessor) startDocument() {}
 func (p *DocValuesProcessor) finishDocument() error { return nil }
 
 func (p *DocValuesProcessor) addField(docId int, field IndexableField, fieldInfo model.FieldInfo) {
-	panic("not implemented yet")
+	if field.fieldType().docValueType() != 0 {
+		panic("not implemented yet")
+	}
 }
 
-func (p *DocValuesProcessor) flush(state SegmentWriteState) error {
-	panic("not implemented yet")
+func (p *DocValuesProcessor) flush(state *SegmentWriteState) (err error) {
+	if len(p.writers) == 0 {
+		return nil
+	}
+
+	dvConsumer, err := state.segmentInfo.Codec().(Codec).DocValuesFormat().FieldsConsumer(*state)
+	if err != nil {
+		return err
+	}
+	var success = false
+	defer func() {
+		if success {
+			err = util.CloseWhileHandlingError(err, dvConsumer)
+		} else {
+			util.CloseWhileSuppressingError(dvConsumer)
+		}
+	}()
+
+	for _, writer := range p.writers {
+		writer.finish(state.segmentInfo.DocCount())
+		if err = writer.flush(state, dvConsumer); err != nil {
+			return err
+		}
+	}
+	p.writers = make(map[string]DocValuesWriter)
+	success = true
+	return nil
 }
 
 func (p *DocValuesProcessor) abort() {
@@ -1,3 +1,228 @@
 package index
 
-type TermVectorsConsumerPerField struct{}
+import (
+	"errors"
+	"fmt"
+	"github.com/balzaczyy/golucene/core/index/model"
+	"github.com/balzaczyy/golucene/core/util"
+	"sort"
+)
+
+// index/TermVectorsConsumerPerField.java
+
+/*
+Buffers the term vector of a single field for the current document:
+its terms, and for each occurrence the position, offsets and payload
+when they are enabled. The terms are written, sorted, to the
+TermVectorsWriter when the document is finished.
+*/
+type TermVectorsConsumerPerField struct {
+	termsWriter *TermVectorsConsumer
+	fieldInfo   model.FieldInfo
+
+	doVectors         bool
+	doVectorPositions bool
+	doVectorOffsets   bool
+	doVectorPayloads  bool
+
+	termIDs  map[string]int
+	postings []*tvPostings
+}
+
+/* Per-term term vector of the current document. */
+type tvPostings struct {
+	text         []byte
+	freq         int
+	positions    []int
+	startOffsets []int
+	endOffsets   []int
+	payloads     [][]byte
+}
+
+func newTermVectorsConsumerPerField(termsWriter *TermVectorsConsumer,
+	fieldInfo model.FieldInfo) *TermVectorsConsumerPerField {
+
+	ans := &TermVectorsConsumerPerField{
+		termsWriter: termsWriter,
+		fieldInfo:   fieldInfo,
+	}
+	ans.reset()
+	return ans
+}
+
+func (f *TermVectorsConsumerPerField) reset() {
+	f.termIDs = make(map[string]int)
+	f.postings = nil
+}
+
+func (f *TermVectorsConsumerPerField) numTerms() int {
+	return len(f.postings)
+}
+
+/*
+Called once per field per document, with all instances of the field
+in the document, to find out whether term vectors, and which parts of
+them, should be recorded. Returns true if the field has term vectors.
+*/
+func (f *TermVectorsConsumerPerField) start(fields []IndexableField) (bool, error) {
+	f.doVectors = false
+	f.doVectorPositions = false
+	f.doVectorOffsets = false
+	f.doVectorPayloads = false
+
+	for _, field := range fields {
+		ft := field.fieldType()
+		if !ft.Indexed() {
+			continue
+		}
+		if ft.StoreTermVectors() {
+			f.doVectors = true
+			f.doVectorPositions = f.doVectorPositions || ft.StoreTermVectorPositions()
+			f.doVectorOffsets = f.doVectorOffsets || ft.StoreTermVectorOffsets()
+			if f.doVectorPositions {
+				f.doVectorPayloads = f.doVectorPayloads || ft.StoreTermVectorPayloads()
+			} else if ft.StoreTermVectorPayloads() {
+				// TODO: move this check somewhere else, and impl the other missing ones
+				return false, errors.New(fmt.Sprintf(
+					"cannot index term vector payloads without term vector positions (field=\"%v\")",
+					field.name()))
+			}
+		} else {
+			if ft.StoreTermVectorOffsets() {
+				return false, errors.New(fmt.Sprintf(
+					"cannot index term vector offsets when term vectors are not indexed (field=\"%v\")",
+					field.name()))
+			}
+			if ft.StoreTermVectorPositions() {
+				return false, errors.New(fmt.Sprintf(
+					"cannot index term vector positions when term vectors are not indexed (field=\"%v\")",
+					field.name()))
+			}
+			if ft.StoreTermVectorPayloads() {
+				return false, errors.New(fmt.Sprintf(
+					"cannot index term vector payloads when term vectors are not indexed (field=\"%v\")",
+					field.name()))
+			}
+		}
+	}
+
+	if f.doVectors {
+		f.termsWriter.hasVectors = true
+		if len(f.postings) != 0 {
+			// Only necessary if previous doc hit a non-aborting error
+			// while writing vectors in this field:
+			f.reset()
+		}
+	}
+
+	return f.doVectors, nil
+}
+
+/*
+Records one occurrence of the term text in the current document.
+position, the offsets and payload are only kept when the matching
+term vector option is enabled; a nil or empty payload means no
+payload.
+*/
+func (f *TermVectorsConsumerPerField) addTerm(text []byte, position int,
+	payload []byte, startOffset, endOffset int) {
+
+	assert(f.doVectors)
+	termID, ok := f.termIDs[string(text)]
+	if !ok {
+		termID = len(f.postings)
+		f.termIDs[string(text)] = termID
+		f.postings = append(f.postings, &tvPostings{text: append([]byte(nil), text...)})
+	}
+	p := f.postings[termID]
+	p.freq++
+	if f.doVectorPositions {
+		p.positions = append(p.positions, position)
+	}
+	if f.doVectorOffsets {
+		p.startOffsets = append(p.startOffsets, startOffset)
+		p.endOffsets = append(p.endOffsets, endOffset)
+	}
+	if f.doVectorPayloads {
+		var copied []byte
+		if len(payload) > 0 {
+			copied = append(copied, payload...)
+		}
+		p.payloads = append(p.payloads, copied)
+	}
+}
+
+/*
+Called once per field per document if term vectors are enabled, after
+all the field instances have been inverted; queues the field to be
+written when the document is finished.
+*/
+func (f *TermVectorsConsumerPerField) finish() {
+	if !f.doVectors || len(f.postings) == 0 {
+		return
+	}
+	f.termsWriter.addFieldToFlush(f)
+}
+
+/*
+Called once per field per document if term vectors are enabled, to
+write the vectors to the TermVectorsWriter, which is already
+initialized.
+*/
+func (f *TermVectorsConsumerPerField) finishDocument() error {
+	// This is called once, after inverting all occurrences of a given
+	// field in the doc. At this point we flush our hash into the
+	// DocWriter.
+	assert(f.termsWriter.vectorFieldsInOrder(f.fieldInfo))
+
+	sort.Sort(tvPostingsByText(f.postings))
+
+	tv := f.termsWriter.writer
+	err := tv.StartField(f.fieldInfo, len(f.postings),
+		f.doVectorPositions, f.doVectorOffsets, f.doVectorPayloads)
+	if err != nil {
+		return err
+	}
+	for _, p := range f.postings {
+		if err = tv.StartTerm(p.text, p.freq); err != nil {
+			return err
+		}
+		if f.doVectorPositions || f.doVectorOffsets {
+			for i := 0; i < p.freq; i++ {
+				pos, startOffset, endOffset := -1, -1, -1
+				var payload []byte
+				if f.doVectorPositions {
+					pos = p.positions[i]
+				}
+				if f.doVectorOffsets {
+					startOffset, endOffset = p.startOffsets[i], p.endOffsets[i]
+				}
+				if f.doVectorPayloads {
+					payload = p.payloads[i]
+				}
+				if err = tv.AddPosition(pos, startOffset, endOffset, payload); err != nil {
+					return err
+				}
+			}
+		}
+		if err = tv.FinishTerm(); err != nil {
+			return err
+		}
+	}
+	if err = tv.FinishField(); err != nil {
+		return err
+	}
+
+	f.reset()
+	return nil
+}
+
+func (f *TermVectorsConsumerPerField) abort() {}
+
+type tvPostingsByText []*tvPostings
+
+func (a tvPostingsByText) Len() int      { return len(a) }
+func (a tvPostingsByText) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a tvPostingsByText) Less(i, j int) bool {
+	return util.UTF8SortedAsUnicodeLess(a[i].text, a[j].text)
+}
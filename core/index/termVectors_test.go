@@ -0,0 +1,399 @@
+package index
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/balzaczyy/golucene/core/index/model"
+	"github.com/balzaczyy/golucene/core/store"
+	"github.com/balzaczyy/golucene/core/util"
+	"sort"
+	"testing"
+)
+
+const vectorsTestNumDocs = 300
+
+// A token of the "body" or "title" field of a test document.
+type vectorsTestToken struct {
+	term                   string
+	position               int
+	startOffset, endOffset int
+	payload                []byte
+}
+
+/*
+Returns the tokens of the given field of a test document. Every 7th
+document has no term vectors. "body" has enough repeated terms to
+fill several chunks; every third of its tokens has a payload.
+*/
+func vectorsTestTokens(field string, docID int) []vectorsTestToken {
+	if docID%7 == 0 {
+		return nil
+	}
+	var terms []string
+	switch field {
+	case "body":
+		for i := 0; i < 10+docID%20; i++ {
+			terms = append(terms, fmt.Sprintf("word%02d", (docID*7+i*3)%40))
+		}
+	case "title":
+		terms = []string{"title", fmt.Sprintf("doc%v", docID)}
+	}
+	var tokens []vectorsTestToken
+	offset := 0
+	for pos, term := range terms {
+		token := vectorsTestToken{term, pos, offset, offset + len(term), nil}
+		if field == "body" && pos%3 == 0 {
+			token.payload = []byte(fmt.Sprintf("p%v", pos))
+		}
+		tokens = append(tokens, token)
+		offset += len(term) + 1
+	}
+	return tokens
+}
+
+/*
+Writes a segment of vectorsTestNumDocs documents with term vectors
+only: "body" stores positions, offsets and payloads, "title" only
+positions. Vectors are buffered and written by a TermVectorsConsumer.
+*/
+func writeVectorsTestSegment(t *testing.T, dir store.Directory, info *model.SegmentInfo) model.FieldInfos {
+	bodyInfo := model.NewFieldInfo("body", true, 0, true, false, true,
+		model.INDEX_OPT_DOCS_AND_FREQS_AND_POSITIONS_AND_OFFSETS, 0, 0, nil)
+	titleInfo := model.NewFieldInfo("title", true, 1, true, false, false,
+		model.INDEX_OPT_DOCS_AND_FREQS_AND_POSITIONS, 0, 0, nil)
+	fieldInfos := model.NewFieldInfos([]model.FieldInfo{bodyInfo, titleInfo})
+	codec := info.Codec().(Codec)
+
+	err := codec.FieldInfosFormat().FieldInfosWriter()(dir, info.Name, fieldInfos, store.IO_CONTEXT_DEFAULT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := newSegmentWriteState(util.NO_OUTPUT, dir, info, fieldInfos,
+		DEFAULT_TERM_INDEX_INTERVAL, nil, store.IO_CONTEXT_DEFAULT)
+	// no postings, and no stored fields
+	if err = new(FreqProxTermsWriter).flush(nil, &state); err != nil {
+		t.Fatal(err)
+	}
+	fieldsWriter, err := codec.StoredFieldsFormat().FieldsWriter(dir, info, store.IO_CONTEXT_DEFAULT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for docID := 0; docID < vectorsTestNumDocs; docID++ {
+		if err = fieldsWriter.StartDocument(0); err == nil {
+			err = fieldsWriter.FinishDocument()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = fieldsWriter.Finish(fieldInfos, vectorsTestNumDocs); err != nil {
+		t.Fatal(err)
+	}
+	if err = fieldsWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	vectorsWriter, err := codec.TermVectorsFormat().VectorsWriter(dir, info, store.IO_CONTEXT_DEFAULT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	consumer := &TermVectorsConsumer{docState: new(docState), writer: vectorsWriter}
+	perFields := map[string]TermsHashConsumerPerField{
+		"body":  newTermVectorsConsumerPerField(consumer, bodyInfo),
+		"title": newTermVectorsConsumerPerField(consumer, titleInfo),
+	}
+	bodyType := newFieldType()
+	bodyType.SetIndexed(true)
+	bodyType.SetStoreTermVectors(true)
+	bodyType.SetStoreTermVectorPositions(true)
+	bodyType.SetStoreTermVectorOffsets(true)
+	bodyType.SetStoreTermVectorPayloads(true)
+	titleType := newFieldType()
+	titleType.SetIndexed(true)
+	titleType.SetStoreTermVectors(true)
+	titleType.SetStoreTermVectorPositions(true)
+	fieldTypes := map[string]*FieldType{"body": bodyType, "title": titleType}
+
+	for docID := 0; docID < vectorsTestNumDocs; docID++ {
+		consumer.docState.docID = docID
+		consumer.startDocument()
+		for _, name := range []string{"title", "body"} {
+			tokens := vectorsTestTokens(name, docID)
+			if len(tokens) == 0 {
+				continue
+			}
+			perField := perFields[name]
+			ok, err := perField.start([]IndexableField{NewStringField(name, "", fieldTypes[name])})
+			if err != nil || !ok {
+				t.Fatalf("Field %v should have term vectors: %v", name, err)
+			}
+			for _, token := range tokens {
+				perField.addTerm([]byte(token.term), token.position, token.payload,
+					token.startOffset, token.endOffset)
+			}
+			perField.finish()
+		}
+		if err = consumer.finishDocument(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = consumer.flush(perFields, &state); err != nil {
+		t.Fatal(err)
+	}
+	return fieldInfos
+}
+
+// Verifies the term vectors of a test document.
+func checkTestVectors(t *testing.T, vectors Fields, docID int) {
+	if docID%7 == 0 {
+		if vectors != nil {
+			t.Errorf("Doc %v should have no term vectors", docID)
+		}
+		return
+	}
+	if vectors == nil {
+		t.Fatalf("Doc %v should have term vectors", docID)
+	}
+	if vectors.Terms("missing") != nil {
+		t.Errorf("Doc %v should have no term vectors for field 'missing'", docID)
+	}
+
+	for _, field := range []string{"body", "title"} {
+		byTerm := make(map[string][]vectorsTestToken)
+		var expectedTerms []string
+		for _, token := range vectorsTestTokens(field, docID) {
+			if _, ok := byTerm[token.term]; !ok {
+				expectedTerms = append(expectedTerms, token.term)
+			}
+			byTerm[token.term] = append(byTerm[token.term], token)
+		}
+		sort.Strings(expectedTerms)
+
+		terms := vectors.Terms(field)
+		if terms == nil {
+			t.Fatalf("Doc %v should have term vectors for field '%v'", docID, field)
+		}
+		if n := terms.Size(); n != int64(len(expectedTerms)) {
+			t.Errorf("Doc %v field '%v' should have %v terms, but found %v",
+				docID, field, len(expectedTerms), n)
+		}
+		hasOffsets := field == "body"
+		if !terms.HasPositions() || terms.HasOffsets() != hasOffsets || terms.HasPayloads() != hasOffsets {
+			t.Errorf("Doc %v field '%v' has wrong options: positions=%v, offsets=%v, payloads=%v",
+				docID, field, terms.HasPositions(), terms.HasOffsets(), terms.HasPayloads())
+		}
+
+		termsEnum := terms.Iterator(nil)
+		var docsAndPositions DocsAndPositionsEnum
+		for _, expected := range expectedTerms {
+			term, err := termsEnum.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(term) != expected {
+				t.Fatalf("Doc %v field '%v' should have term '%v', but found '%s'",
+					docID, field, expected, term)
+			}
+			tokens := byTerm[expected]
+			if freq, _ := termsEnum.TotalTermFreq(); freq != int64(len(tokens)) {
+				t.Errorf("Term '%v' of doc %v should have freq %v, but found %v",
+					expected, docID, len(tokens), freq)
+			}
+			docsAndPositions = termsEnum.DocsAndPositions(nil, docsAndPositions)
+			if doc, _ := docsAndPositions.NextDoc(); doc != 0 {
+				t.Fatalf("Term vectors should have a single doc 0, but found %v", doc)
+			}
+			for _, token := range tokens {
+				position, _ := docsAndPositions.NextPosition()
+				startOffset, _ := docsAndPositions.StartOffset()
+				endOffset, _ := docsAndPositions.EndOffset()
+				payload, _ := docsAndPositions.Payload()
+				if !hasOffsets {
+					token.startOffset, token.endOffset = -1, -1
+				}
+				if position != token.position || startOffset != token.startOffset ||
+					endOffset != token.endOffset || !bytes.Equal(payload, token.payload) {
+					t.Errorf("Term '%v' of doc %v should be at %v [%v,%v) with payload %q, but found %v [%v,%v) with payload %q",
+						expected, docID, token.position, token.startOffset, token.endOffset, token.payload,
+						position, startOffset, endOffset, payload)
+				}
+			}
+			if doc, _ := docsAndPositions.NextDoc(); doc != NO_MORE_DOCS {
+				t.Errorf("Term vectors should be exhausted, but found doc %v", doc)
+			}
+		}
+		if term, _ := termsEnum.Next(); term != nil {
+			t.Errorf("Doc %v field '%v' should have no more terms, but found '%s'", docID, field, term)
+		}
+
+		if len(expectedTerms) > 1 {
+			// seek back to the first term, and past the last one
+			if status := termsEnum.SeekCeil([]byte(expectedTerms[0])); status != SEEK_STATUS_FOUND {
+				t.Errorf("Term '%v' of doc %v should be found, but got %v", expectedTerms[0], docID, status)
+			}
+			if status := termsEnum.SeekCeil([]byte("zzz")); status != SEEK_STATUS_END {
+				t.Errorf("Term 'zzz' of doc %v should not be found, but got %v", docID, status)
+			}
+		}
+	}
+}
+
+func TestTermVectors(t *testing.T) {
+	dir := store.NewRAMDirectory()
+	codec := LoadCodec("Lucene42")
+	info := model.NewSegmentInfo(dir, util.LUCENE_MAIN_VERSION, "_0", vectorsTestNumDocs, false, codec, nil, nil)
+	fieldInfos := writeVectorsTestSegment(t, dir, info)
+
+	reader, err := codec.TermVectorsFormat().VectorsReader(dir, info, fieldInfos, store.IO_CONTEXT_READ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if r, ok := reader.(*CompressingTermVectorsReader); !ok || r.indexReader.startPointer(0) ==
+		r.indexReader.startPointer(vectorsTestNumDocs-1) {
+		t.Fatal("Term vectors should be written in several chunks")
+	}
+
+	clone := reader.clone()
+	defer clone.Close()
+	// read in reverse order, so that every doc needs a seek
+	for docID := vectorsTestNumDocs - 1; docID >= 0; docID-- {
+		vectors, err := clone.get(docID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkTestVectors(t, vectors, docID)
+	}
+}
+
+func TestMergeTermVectors(t *testing.T) {
+	dir := store.NewRAMDirectory()
+	codec := LoadCodec("Lucene42")
+	info := model.NewSegmentInfo(dir, util.LUCENE_MAIN_VERSION, "_0", vectorsTestNumDocs, false, codec, nil, nil)
+	writeVectorsTestSegment(t, dir, info)
+	source, err := NewSegmentReader(NewSegmentInfoPerCommit(info, 0, -1), 1, store.IO_CONTEXT_READ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+
+	d := store.NewRAMDirectory()
+	w, err := NewIndexWriter(d, NewIndexWriterConfig(util.VERSION_45, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Add the same segment twice, so that doc IDs are rebased
+	if err = w.AddIndexesFromReaders(source, source); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OpenDirectoryReader(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if n := r.MaxDoc(); n != 2*vectorsTestNumDocs {
+		t.Fatalf("Expected %v docs, but found %v", 2*vectorsTestNumDocs, n)
+	}
+	for docID := 0; docID < r.MaxDoc(); docID++ {
+		vectors, err := r.TermVectors(docID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkTestVectors(t, vectors, docID%vectorsTestNumDocs)
+	}
+	if terms, err := r.TermVector(vectorsTestNumDocs+1, "title"); err != nil || terms == nil ||
+		terms.Size() != 2 {
+		t.Errorf("Doc %v should have 2 title terms: %v", vectorsTestNumDocs+1, err)
+	}
+}
+
+func TestAddDocumentTermVectors(t *testing.T) {
+	vectorsType := NewFieldTypeFrom(STRING_FIELD_TYPE_NOT_STORED)
+	vectorsType.storeTermVectors = true
+	vectorsType.storeTermVectorPositions = true
+	vectorsType.storeTermVectorOffsets = true
+
+	d := store.NewRAMDirectory()
+	w, err := NewIndexWriter(d, NewIndexWriterConfig(util.VERSION_45, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	for _, doc := range [][]IndexableField{
+		{NewStringField("color", "red", vectorsType), NewStringField("color", "green", vectorsType)},
+		{NewStringField("id", "doc1", STRING_FIELD_TYPE_NOT_STORED)},
+		{NewStringField("color", "blue", vectorsType)},
+	} {
+		if err = w.AddDocument(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	checkCommitted(t, d, 3, 3)
+
+	r, err := OpenDirectoryReader(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if n := len(r.Leaves()); n != 1 {
+		t.Fatalf("Expected 1 segment, got %v", n)
+	}
+	segment := r.Leaves()[0].reader.(*SegmentReader)
+
+	if vectors, err := segment.TermVectors(1); err != nil || vectors != nil {
+		t.Errorf("Doc 1 should have no term vectors: %v", err)
+	}
+	for docID, expected := range map[int][]string{
+		0: {"green 1 [3,8)", "red 0 [0,3)"},
+		2: {"blue 0 [0,4)"},
+	} {
+		vectors, err := segment.TermVectors(docID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if vectors == nil {
+			t.Fatalf("Doc %v should have term vectors", docID)
+		}
+		if vectors.Terms("id") != nil {
+			t.Errorf("Doc %v should have no term vectors for field 'id'", docID)
+		}
+		terms := vectors.Terms("color")
+		if terms == nil {
+			t.Fatalf("Doc %v should have term vectors for field 'color'", docID)
+		}
+		if !terms.HasPositions() || !terms.HasOffsets() || terms.HasPayloads() {
+			t.Errorf("Doc %v has wrong options: positions=%v, offsets=%v, payloads=%v",
+				docID, terms.HasPositions(), terms.HasOffsets(), terms.HasPayloads())
+		}
+		var found []string
+		termsEnum := terms.Iterator(nil)
+		var docsAndPositions DocsAndPositionsEnum
+		for {
+			term, err := termsEnum.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if term == nil {
+				break
+			}
+			docsAndPositions = termsEnum.DocsAndPositions(nil, docsAndPositions)
+			if doc, _ := docsAndPositions.NextDoc(); doc != 0 {
+				t.Fatalf("Term vectors should have a single doc 0, but found %v", doc)
+			}
+			position, _ := docsAndPositions.NextPosition()
+			startOffset, _ := docsAndPositions.StartOffset()
+			endOffset, _ := docsAndPositions.EndOffset()
+			found = append(found, fmt.Sprintf("%s %v [%v,%v)", term, position, startOffset, endOffset))
+		}
+		if fmt.Sprint(found) != fmt.Sprint(expected) {
+			t.Errorf("Doc %v should have term vectors %v, but found %v", docID, expected, found)
+		}
+	}
+}
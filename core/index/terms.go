@@ -1,6 +1,7 @@
 package index
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/balzaczyy/golucene/core/util"
 	"log"
@@ -37,15 +38,28 @@ func (s TermSorter) Less(i, j int) bool {
 	return s[i].Field < s[j].Field
 }
 
+func (t *Term) equals(other *Term) bool {
+	return t.Field == other.Field && bytes.Equal(t.Bytes, other.Bytes)
+}
+
 func (t *Term) String() string {
 	return fmt.Sprintf("%v:%v", t.Field, string(t.Bytes))
 }
 
 type Terms interface {
 	Iterator(reuse TermsEnum) TermsEnum
+	// Returns the number of terms for this field, or -1 if this
+	// measure isn't stored by the codec.
+	Size() int64
 	DocCount() int
 	SumTotalTermFreq() int64
 	SumDocFreq() int64
+	// Returns true if documents in this field store offsets.
+	HasOffsets() bool
+	// Returns true if documents in this field store positions.
+	HasPositions() bool
+	// Returns true if documents in this field store payloads.
+	HasPayloads() bool
 }
 
 // TermsEnum.java
@@ -347,17 +361,89 @@ func NewMultiTerms(subs []Terms, subSlices []ReaderSlice) MultiTerms {
 }
 
 func (mt MultiTerms) Iterator(reuse TermsEnum) TermsEnum {
-	panic("not implemented yet")
+	ans, err := mt.iterator()
+	if err != nil {
+		panic(err) // Terms.Iterator() can not report errors
+	}
+	return ans
+}
+
+func (mt MultiTerms) iterator() (TermsEnum, error) {
+	var termsEnums []*termsEnumIndex
+	for i, sub := range mt.subs {
+		if termsEnum := sub.Iterator(nil); termsEnum != nil {
+			termsEnums = append(termsEnums, &termsEnumIndex{i, termsEnum})
+		}
+	}
+	if len(termsEnums) == 0 {
+		return EMPTY_TERMS_ENUM, nil
+	}
+	return NewMultiTermsEnum(mt.subSlices).reset(termsEnums)
+}
+
+func (mt MultiTerms) Size() int64 {
+	return -1
 }
 
 func (mt MultiTerms) DocCount() int {
-	panic("not implemented yet")
+	sum := 0
+	for _, terms := range mt.subs {
+		v := terms.DocCount()
+		if v == -1 {
+			return -1
+		}
+		sum += v
+	}
+	return sum
 }
 
 func (mt MultiTerms) SumTotalTermFreq() int64 {
-	panic("not implemented yet")
+	var sum int64
+	for _, terms := range mt.subs {
+		v := terms.SumTotalTermFreq()
+		if v == -1 {
+			return -1
+		}
+		sum += v
+	}
+	return sum
 }
 
 func (mt MultiTerms) SumDocFreq() int64 {
-	panic("not implemented yet")
+	var sum int64
+	for _, terms := range mt.subs {
+		v := terms.SumDocFreq()
+		if v == -1 {
+			return -1
+		}
+		sum += v
+	}
+	return sum
+}
+
+func (mt MultiTerms) HasOffsets() bool {
+	for _, terms := range mt.subs {
+		if terms.HasOffsets() {
+			return true
+		}
+	}
+	return false
+}
+
+func (mt MultiTerms) HasPositions() bool {
+	for _, terms := range mt.subs {
+		if terms.HasPositions() {
+			return true
+		}
+	}
+	return false
+}
+
+func (mt MultiTerms) HasPayloads() bool {
+	for _, terms := range mt.subs {
+		if terms.HasPayloads() {
+			return true
+		}
+	}
+	return false
 }
@@ -1,9 +1,36 @@
 package index
 
+import (
+	"github.com/balzaczyy/golucene/core/index/model"
+	"github.com/balzaczyy/golucene/core/store"
+	"github.com/balzaczyy/golucene/core/util"
+	"sort"
+)
+
 // index/TermsHashConsumer.java
 
 type TermsHashConsumer interface {
+	flush(fieldsToFlush map[string]TermsHashConsumerPerField, state *SegmentWriteState) error
+	abort()
+	startDocument()
+	finishDocument() error
+	addField(termsHashPerField *TermsHashPerField, fieldInfo model.FieldInfo) TermsHashConsumerPerField
+}
+
+// index/TermsHashConsumerPerField.java
+
+/*
+Implement this class to plug into the TermsHash processor, which
+inverts & stores Tokens into a hash table and provides an API for
+writing bytes into multiple streams for each unique Token.
+*/
+type TermsHashConsumerPerField interface {
+	start(fields []IndexableField) (bool, error)
+	finish()
 	abort()
+	// Called once per occurrence of the term text in the current
+	// document
+	addTerm(text []byte, position int, payload []byte, startOffset, endOffset int)
 }
 
 // index/TermVectorsConsumer.java
@@ -17,6 +44,8 @@ type TermVectorsConsumer struct {
 	numVectorsFields int
 	lastDocId        int
 	perFields        []*TermVectorsConsumerPerField
+
+	lastVectorFieldName string
 }
 
 func newTermVectorsConsumer(docWriter *DocumentsWriterPerThread) *TermVectorsConsumer {
@@ -26,11 +55,114 @@ func newTermVectorsConsumer(docWriter *DocumentsWriterPerThread) *TermVectorsCon
 	}
 }
 
+/*
+Fills in the documents without term vectors, finishes and closes the
+writer, if any document of the segment had term vectors, and resets
+the given fields.
+*/
+func (tvc *TermVectorsConsumer) flush(fieldsToFlush map[string]TermsHashConsumerPerField,
+	state *SegmentWriteState) (err error) {
+
+	if w := tvc.writer; w != nil {
+		numDocs := state.segmentInfo.DocCount()
+		assert(numDocs > 0)
+		// At least one doc in this run had term vectors enabled
+		var success = false
+		defer func() {
+			if success {
+				err = util.CloseWhileHandlingError(err, w)
+			} else {
+				util.CloseWhileSuppressingError(w)
+			}
+			tvc.writer = nil
+			tvc.lastDocId = 0
+			tvc.hasVectors = false
+		}()
+
+		if err = tvc.fill(numDocs); err != nil {
+			return err
+		}
+		assert2(state.segmentInfo != nil, "segment info is nil")
+		if err = w.Finish(state.fieldInfos, numDocs); err != nil {
+			return err
+		}
+		success = true
+	}
+
+	for _, field := range fieldsToFlush {
+		field.(*TermVectorsConsumerPerField).reset()
+	}
+	return nil
+}
+
+/*
+Fills in no-term-vectors for all docs we haven't seen since the last
+doc that had term vectors.
+*/
+func (tvc *TermVectorsConsumer) fill(docId int) error {
+	for tvc.lastDocId < docId {
+		if err := tvc.writer.StartDocument(0); err != nil {
+			return err
+		}
+		if err := tvc.writer.FinishDocument(); err != nil {
+			return err
+		}
+		tvc.lastDocId++
+	}
+	return nil
+}
+
+func (tvc *TermVectorsConsumer) initTermVectorsWriter() (err error) {
+	if tvc.writer == nil {
+		ctx := store.NewIOContextForFlush(&store.FlushInfo{
+			tvc.docWriter.numDocsInRAM, tvc.docWriter.bytesUsed()})
+		tvc.writer, err = tvc.docWriter.codec.TermVectorsFormat().VectorsWriter(
+			tvc.docWriter.directory, tvc.docWriter.segmentInfo, ctx)
+		tvc.lastDocId = 0
+	}
+	return err
+}
+
+func (tvc *TermVectorsConsumer) finishDocument() (err error) {
+	if !tvc.hasVectors {
+		return nil
+	}
+
+	if err = tvc.initTermVectorsWriter(); err != nil {
+		return err
+	}
+	if err = tvc.fill(tvc.docState.docID); err != nil {
+		return err
+	}
+
+	// Append term vectors to the real outputs:
+	if err = tvc.writer.StartDocument(len(tvc.perFields)); err != nil {
+		return err
+	}
+	sort.Sort(tvFieldsByName(tvc.perFields))
+	for _, field := range tvc.perFields {
+		if err = field.finishDocument(); err != nil {
+			return err
+		}
+	}
+	if err = tvc.writer.FinishDocument(); err != nil {
+		return err
+	}
+
+	assertn(tvc.lastDocId == tvc.docState.docID,
+		"lastDocID=%v docState.docID=%v", tvc.lastDocId, tvc.docState.docID)
+
+	tvc.lastDocId++
+
+	tvc.reset()
+	return nil
+}
+
 func (tvc *TermVectorsConsumer) abort() {
 	tvc.hasVectors = false
 
 	if tvc.writer != nil {
-		tvc.writer.abort()
+		tvc.writer.Abort()
 		tvc.writer = nil
 	}
 
@@ -41,11 +173,38 @@ func (tvc *TermVectorsConsumer) abort() {
 func (tvc *TermVectorsConsumer) reset() {
 	tvc.perFields = nil
 	tvc.numVectorsFields = 0
+	tvc.lastVectorFieldName = ""
+}
+
+func (tvc *TermVectorsConsumer) addField(termsHashPerField *TermsHashPerField,
+	fieldInfo model.FieldInfo) TermsHashConsumerPerField {
+	return newTermVectorsConsumerPerField(tvc, fieldInfo)
+}
+
+func (tvc *TermVectorsConsumer) addFieldToFlush(fieldToFlush *TermVectorsConsumerPerField) {
+	tvc.perFields = append(tvc.perFields, fieldToFlush)
+	tvc.numVectorsFields++
 }
 
-// index/FreqProxTermsWriter.java
+func (tvc *TermVectorsConsumer) startDocument() {
+	assert(tvc.clearLastVectorFieldName())
+	tvc.reset()
+}
 
-type FreqProxTermsWriter struct {
+// Called only by assert
+func (tvc *TermVectorsConsumer) clearLastVectorFieldName() bool {
+	tvc.lastVectorFieldName = ""
+	return true
 }
 
-func (w *FreqProxTermsWriter) abort() {}
+// Called only by assert
+func (tvc *TermVectorsConsumer) vectorFieldsInOrder(fi model.FieldInfo) bool {
+	defer func() { tvc.lastVectorFieldName = fi.Name }()
+	return tvc.lastVectorFieldName == "" || tvc.lastVectorFieldName < fi.Name
+}
+
+type tvFieldsByName []*TermVectorsConsumerPerField
+
+func (a tvFieldsByName) Len() int           { return len(a) }
+func (a tvFieldsByName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a tvFieldsByName) Less(i, j int) bool { return a[i].fieldInfo.Name < a[j].fieldInfo.Name }
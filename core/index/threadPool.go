@@ -88,6 +88,17 @@ func (tp *DocumentsWriterPerThreadPool) numActiveThreadState() int {
 	return len(tp.threadStates)
 }
 
+/*
+Returns a snapshot of all thread states created so far. The states
+are not locked; only fields guarded by DocumentsWriterFlushControl
+may be read.
+*/
+func (tp *DocumentsWriterPerThreadPool) activeThreadStates() []*ThreadState {
+	tp.Lock()
+	defer tp.Unlock()
+	return append([]*ThreadState(nil), tp.threadStates...)
+}
+
 func (tp *DocumentsWriterPerThreadPool) reset(threadState *ThreadState, closed bool) *DocumentsWriterPerThread {
 	dwpt := threadState.dwpt
 	if !closed {
@@ -107,13 +118,14 @@ func (tp *DocumentsWriterPerThreadPool) lockAny() *ThreadState {
 	if res == nil {
 		res = tp.newThreadState()
 		if res == nil {
-			// Wait for thread state released by others
+			// Wait for thread state released by others. The free list is
+			// re-checked while holding the condition's lock, so that a
+			// release in between can't be missed.
 			tp.hasMoreStates.L.Lock()
 			defer tp.hasMoreStates.L.Unlock()
 
-			for res == nil {
+			for res = tp.findNextAvailableThreadState(); res == nil; res = tp.findNextAvailableThreadState() {
 				tp.hasMoreStates.Wait()
-				res = tp.findNextAvailableThreadState()
 			}
 		}
 	}
@@ -121,39 +133,46 @@ func (tp *DocumentsWriterPerThreadPool) lockAny() *ThreadState {
 }
 
 func (tp *DocumentsWriterPerThreadPool) lock(id int, wait bool) *ThreadState {
-	tp.Lock()
-	defer tp.Unlock()
-
-	for e := tp.freeList.Front(); e != nil; e = e.Next() {
-		if tid := e.Value.(int); tid == id {
-			tp.freeList.Remove(e)
-			tp.lockedList.PushBack(id)
-			return tp.threadStates[tid]
+	ts, ch := func() (*ThreadState, chan *ThreadState) {
+		tp.Lock()
+		defer tp.Unlock()
+
+		for e := tp.freeList.Front(); e != nil; e = e.Next() {
+			if tid := e.Value.(int); tid == id {
+				tp.freeList.Remove(e)
+				tp.lockedList.PushBack(id)
+				return tp.threadStates[tid], nil
+			}
 		}
-	}
 
-	if !wait {
-		return nil
-	}
-	waitingList := tp.listeners[id]
-	if waitingList == nil {
-		waitingList = list.New()
-		tp.listeners[id] = waitingList
+		if !wait {
+			return nil, nil
+		}
+		waitingList := tp.listeners[id]
+		if waitingList == nil {
+			waitingList = list.New()
+			tp.listeners[id] = waitingList
+		}
+		ch := make(chan *ThreadState, 1)
+		waitingList.PushBack(ch)
+		return nil, ch
+	}()
+	if ch != nil {
+		// block until reserved thread state is released; the pool's
+		// lock must not be held here, or release() can't hand it over
+		ts = <-ch
 	}
-	ch := make(chan *ThreadState)
-	waitingList.PushBack(ch)
-	return <-ch // block until reserved thread state is released
+	return ts
 }
 
 func (tp *DocumentsWriterPerThreadPool) findNextAvailableThreadState() *ThreadState {
 	tp.Lock()
 	defer tp.Unlock()
 
-	if tp.freeList.Len() > 0 {
-		e := tp.lockedList.Front()
-		tp.lockedList.Remove(e)
+	if e := tp.freeList.Front(); e != nil {
+		tp.freeList.Remove(e)
 		id := e.Value.(int)
-		tp.freeList.PushBack(id)
+		tp.lockedList.PushBack(id)
 		return tp.threadStates[id]
 	}
 	return nil
@@ -200,19 +219,33 @@ Release the ThreadState back to the pool. Equals to
 ThreadState.Unlock() in Lucene Java.
 */
 func (tp *DocumentsWriterPerThreadPool) release(ts *ThreadState) {
-	tp.Lock()
-	defer tp.Unlock()
+	if handedOver := func() bool {
+		tp.Lock()
+		defer tp.Unlock()
+
+		if waitingList := tp.listeners[ts.id]; waitingList != nil && waitingList.Len() > 0 {
+			// this thread state is reserved; it stays locked and is
+			// re-allocated to the external handler
+			e := waitingList.Front()
+			waitingList.Remove(e)
+			e.Value.(chan *ThreadState) <- ts
+			return true
+		}
 
-	if waitingList := tp.listeners[ts.id]; waitingList != nil && waitingList.Len() > 0 {
-		// this thread state is reserved
-		e := waitingList.Front()
-		waitingList.Remove(e)
-		// re-allocate to external handler
-		e.Value.(chan *ThreadState) <- ts
+		// push the thread state back to the free list
+		for e := tp.lockedList.Front(); e != nil; e = e.Next() {
+			if e.Value.(int) == ts.id {
+				tp.lockedList.Remove(e)
+				break
+			}
+		}
+		tp.freeList.PushBack(ts.id)
+		return false
+	}(); handedOver {
 		return
 	}
 
-	// push the thread state back to
-	tp.freeList.PushBack(ts.id)
+	tp.hasMoreStates.L.Lock()
+	defer tp.hasMoreStates.L.Unlock()
 	tp.hasMoreStates.Signal()
 }
@@ -0,0 +1,115 @@
+package index
+
+import (
+	"github.com/balzaczyy/golucene/core/analysis"
+	"sync/atomic"
+)
+
+// index/TrackingIndexWriter.java
+
+/*
+Class that tracks changes to a delegated IndexWriter, used by
+ControlledRealTimeReopener to ensure specific changes are visible.
+Create this class (passing your IndexWriter), and then pass this
+class to ControlledRealTimeReopener. Be sure to make all changes via
+the TrackingIndexWriter, otherwise ControlledRealTimeReopener won't
+know about the changes.
+*/
+type TrackingIndexWriter struct {
+	writer      *IndexWriter
+	indexingGen int64 // atomic
+}
+
+// Create a TrackingIndexWriter wrapping the provided IndexWriter.
+func NewTrackingIndexWriter(writer *IndexWriter) *TrackingIndexWriter {
+	return &TrackingIndexWriter{writer: writer, indexingGen: 1}
+}
+
+/*
+Calls IndexWriter.UpdateDocument() and returns the generation that
+reflects this change.
+*/
+func (w *TrackingIndexWriter) UpdateDocument(term *Term, doc []IndexableField,
+	analyzer analysis.Analyzer) (int64, error) {
+	if err := w.writer.UpdateDocument(term, doc, analyzer); err != nil {
+		return 0, err
+	}
+	// Return gen as of when indexing finished:
+	return atomic.LoadInt64(&w.indexingGen), nil
+}
+
+/*
+Calls IndexWriter.AddDocument() and returns the generation that
+reflects this change.
+*/
+func (w *TrackingIndexWriter) AddDocument(doc []IndexableField) (int64, error) {
+	if err := w.writer.AddDocument(doc); err != nil {
+		return 0, err
+	}
+	// Return gen as of when indexing finished:
+	return atomic.LoadInt64(&w.indexingGen), nil
+}
+
+/*
+Calls IndexWriter.AddDocumentWithAnalyzer() and returns the generation
+that reflects this change.
+*/
+func (w *TrackingIndexWriter) AddDocumentWithAnalyzer(doc []IndexableField,
+	analyzer analysis.Analyzer) (int64, error) {
+	if err := w.writer.AddDocumentWithAnalyzer(doc, analyzer); err != nil {
+		return 0, err
+	}
+	// Return gen as of when indexing finished:
+	return atomic.LoadInt64(&w.indexingGen), nil
+}
+
+/*
+Calls IndexWriter.DeleteDocuments() and returns the generation that
+reflects this change.
+*/
+func (w *TrackingIndexWriter) DeleteDocuments(terms ...*Term) (int64, error) {
+	if err := w.writer.DeleteDocuments(terms...); err != nil {
+		return 0, err
+	}
+	// Return gen as of when indexing finished:
+	return atomic.LoadInt64(&w.indexingGen), nil
+}
+
+/*
+Calls IndexWriter.DeleteDocumentsByQuery() and returns the generation
+that reflects this change.
+*/
+func (w *TrackingIndexWriter) DeleteDocumentsByQuery(queries ...Query) (int64, error) {
+	if err := w.writer.DeleteDocumentsByQuery(queries...); err != nil {
+		return 0, err
+	}
+	// Return gen as of when indexing finished:
+	return atomic.LoadInt64(&w.indexingGen), nil
+}
+
+/*
+Calls IndexWriter.DeleteAll() and returns the generation that
+reflects this change.
+*/
+func (w *TrackingIndexWriter) DeleteAll() (int64, error) {
+	if err := w.writer.DeleteAll(); err != nil {
+		return 0, err
+	}
+	// Return gen as of when indexing finished:
+	return atomic.LoadInt64(&w.indexingGen), nil
+}
+
+// Return the current generation being indexed.
+func (w *TrackingIndexWriter) Generation() int64 {
+	return atomic.LoadInt64(&w.indexingGen)
+}
+
+// Return the wrapped IndexWriter.
+func (w *TrackingIndexWriter) IndexWriter() *IndexWriter {
+	return w.writer
+}
+
+// Return and increment current gen.
+func (w *TrackingIndexWriter) GetAndIncrementGeneration() int64 {
+	return atomic.AddInt64(&w.indexingGen, 1) - 1
+}
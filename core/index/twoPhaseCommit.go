@@ -0,0 +1,33 @@
+package index
+
+// index/TwoPhaseCommit.java
+
+/*
+An interface for implementations that support 2-phase commit, such
+as IndexWriter. You can use ExecuteTwoPhaseCommit() to execute a
+2-phase commit algorithm over several TwoPhaseCommits.
+*/
+type TwoPhaseCommit interface {
+	/*
+		The first stage of a 2-phase commit. Implementations should do as
+		much work as possible in this method, but avoid actual committing
+		changes. If the 2-phase commit fails, Rollback() is called to
+		discard all changes since last successful commit.
+	*/
+	PrepareCommit() error
+	/*
+		The second phase of a 2-phase commit. Implementations should
+		ideally do very little work in this method (following
+		PrepareCommit()), and after it returns, the caller can assume
+		that the changes were successfully committed to the underlying
+		storage.
+	*/
+	Commit() error
+	/*
+		Discards any changes that have occurred since the last commit. In
+		a 2-phase commit algorithm, where one of the objects failed to
+		Commit() or PrepareCommit(), this method is used to roll all
+		other objects back to their previous state.
+	*/
+	Rollback() error
+}
@@ -0,0 +1,99 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+)
+
+// index/TwoPhaseCommitTool.java
+
+/* The phase of a 2-phase commit in which a participant failed. */
+type TwoPhaseCommitPhase int
+
+const (
+	TWO_PHASE_PREPARE_COMMIT = TwoPhaseCommitPhase(1)
+	TWO_PHASE_COMMIT         = TwoPhaseCommitPhase(2)
+)
+
+func (phase TwoPhaseCommitPhase) String() string {
+	switch phase {
+	case TWO_PHASE_PREPARE_COMMIT:
+		return "PrepareCommit()"
+	case TWO_PHASE_COMMIT:
+		return "Commit()"
+	}
+	return fmt.Sprintf("TwoPhaseCommitPhase(%v)", int(phase))
+}
+
+/*
+Returned by ExecuteTwoPhaseCommit() when a participant failed, once
+all participants have been rolled back.
+*/
+type TwoPhaseCommitError struct {
+	Phase TwoPhaseCommitPhase
+	// Position of the participant which failed, in the arguments.
+	Index       int
+	Participant TwoPhaseCommit
+	Cause       error
+}
+
+func (err *TwoPhaseCommitError) Error() string {
+	return fmt.Sprintf("%v failed on %v: %v", err.Phase, err.Participant, err.Cause)
+}
+
+func (err *TwoPhaseCommitError) Unwrap() error {
+	return err.Cause
+}
+
+/*
+Executes a 2-phase commit algorithm by first calling PrepareCommit()
+on all participants and only if all succeed, it proceeds with
+Commit(). If any of the participants fail on either of the phases,
+all participants are rolled back, and a *TwoPhaseCommitError naming
+the participant and the phase is returned. Errors of Rollback() are
+ignored.
+
+NOTE: it may happen that a participant fails on Commit() after some
+others were already committed, which can't be undone: rolling them
+back only discards the changes made since.
+
+NOTE: nil participants are ignored.
+*/
+func ExecuteTwoPhaseCommit(participants ...TwoPhaseCommit) error {
+	for i, tpc := range participants {
+		if tpc != nil {
+			if err := callSafely(tpc.PrepareCommit); err != nil {
+				rollbackAll(participants)
+				return &TwoPhaseCommitError{TWO_PHASE_PREPARE_COMMIT, i, tpc, err}
+			}
+		}
+	}
+	for i, tpc := range participants {
+		if tpc != nil {
+			if err := callSafely(tpc.Commit); err != nil {
+				rollbackAll(participants)
+				return &TwoPhaseCommitError{TWO_PHASE_COMMIT, i, tpc, err}
+			}
+		}
+	}
+	return nil
+}
+
+/* Rolls back all participants, ignoring errors. */
+func rollbackAll(participants []TwoPhaseCommit) {
+	for _, tpc := range participants {
+		if tpc != nil {
+			callSafely(tpc.Rollback) // ignore error
+		}
+	}
+}
+
+/* Turns a panic of f, e.g. on a closed IndexWriter, into an error. */
+func callSafely(f func() error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = errors.New(fmt.Sprintf("%v", p))
+		}
+	}()
+	return f()
+}
@@ -0,0 +1,145 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"github.com/balzaczyy/golucene/core/store"
+	"github.com/balzaczyy/golucene/core/util"
+	"testing"
+)
+
+type twoPhaseCommitImpl struct {
+	name                            string
+	failOnPrepare, failOnCommit     bool
+	prepared, committed, rolledBack bool
+}
+
+func (tpc *twoPhaseCommitImpl) PrepareCommit() error {
+	if tpc.failOnPrepare {
+		return errors.New("failOnPrepare")
+	}
+	tpc.prepared = true
+	return nil
+}
+
+func (tpc *twoPhaseCommitImpl) Commit() error {
+	if !tpc.prepared {
+		panic("commit called before PrepareCommit()")
+	}
+	if tpc.failOnCommit {
+		return errors.New("failOnCommit")
+	}
+	tpc.committed = true
+	return nil
+}
+
+func (tpc *twoPhaseCommitImpl) Rollback() error {
+	tpc.rolledBack = true
+	return nil
+}
+
+func (tpc *twoPhaseCommitImpl) String() string {
+	return tpc.name
+}
+
+func TestTwoPhaseCommitTool(t *testing.T) {
+	for _, test := range []struct {
+		failOnPrepare, failOnCommit int // index of the failing participant, or -1
+	}{{-1, -1}, {0, -1}, {2, -1}, {-1, 1}} {
+		var objects []TwoPhaseCommit
+		var impls []*twoPhaseCommitImpl
+		for i := 0; i < 3; i++ {
+			impl := &twoPhaseCommitImpl{
+				name:          fmt.Sprintf("tpc%v", i),
+				failOnPrepare: i == test.failOnPrepare,
+				failOnCommit:  i == test.failOnCommit,
+			}
+			impls = append(impls, impl)
+			objects = append(objects, impl)
+		}
+		objects = append(objects, nil) // ignored
+
+		err := ExecuteTwoPhaseCommit(objects...)
+		failed := test.failOnPrepare >= 0 || test.failOnCommit >= 0
+		if !failed {
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, impl := range impls {
+				if !impl.committed || impl.rolledBack {
+					t.Errorf("%v should be committed", impl)
+				}
+			}
+			continue
+		}
+
+		tpcErr, ok := err.(*TwoPhaseCommitError)
+		if !ok {
+			t.Fatalf("expected TwoPhaseCommitError, got %v", err)
+		}
+		if test.failOnPrepare >= 0 {
+			if tpcErr.Phase != TWO_PHASE_PREPARE_COMMIT || tpcErr.Index != test.failOnPrepare {
+				t.Errorf("unexpected error: %v", tpcErr)
+			}
+		} else if tpcErr.Phase != TWO_PHASE_COMMIT || tpcErr.Index != test.failOnCommit {
+			t.Errorf("unexpected error: %v", tpcErr)
+		}
+		if tpcErr.Participant != objects[tpcErr.Index] {
+			t.Errorf("expected participant %v, got %v", objects[tpcErr.Index], tpcErr.Participant)
+		}
+		for i, impl := range impls {
+			if !impl.rolledBack {
+				t.Errorf("%v should be rolled back", impl)
+			}
+			if impl.committed != (i < test.failOnCommit) {
+				t.Errorf("%v committed: %v", impl, impl.committed)
+			}
+		}
+	}
+}
+
+func TestTwoPhaseCommitWriters(t *testing.T) {
+	var writers []*IndexWriter
+	var dirs []store.Directory
+	for i := 0; i < 2; i++ {
+		d := store.NewRAMDirectory()
+		w, err := NewIndexWriter(d, NewIndexWriterConfig(util.VERSION_45, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+		addSample(t, w, "../search/testdata/belfrysample")
+		w.SetCommitData(map[string]string{"offset": "1"})
+		writers = append(writers, w)
+		dirs = append(dirs, d)
+	}
+	if err := ExecuteTwoPhaseCommit(writers[0], writers[1]); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range dirs {
+		commits, err := ListCommits(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(commits) != 1 || commits[0].UserData()["offset"] != "1" {
+			t.Errorf("expected the commit of offset 1, got %v", commits)
+		}
+	}
+
+	// the closed writer fails to prepare: the other one is rolled back
+	writers[1].Close()
+	addSample(t, writers[0], "../search/testdata/osx/belfrysample")
+	err := ExecuteTwoPhaseCommit(writers[0], writers[1])
+	if tpcErr, ok := err.(*TwoPhaseCommitError); !ok ||
+		tpcErr.Phase != TWO_PHASE_PREPARE_COMMIT || tpcErr.Index != 1 {
+		t.Fatalf("expected PrepareCommit() to fail on the closed writer, got %v", err)
+	}
+	r, err := OpenDirectoryReader(dirs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if n := r.NumDocs(); n != 8 {
+		t.Errorf("expected 8 docs after rollback, got %v", n)
+	}
+}
@@ -0,0 +1,136 @@
+package index
+
+import (
+	"fmt"
+	"github.com/balzaczyy/golucene/core/util"
+	"sort"
+)
+
+// index/UpgradeIndexMergePolicy.java
+
+/*
+This MergePolicy is used for upgrading all existing segments of an
+index when calling IndexWriter.ForceMerge(). All other methods
+delegate to the base MergePolicy given to the constructor. This
+allows for an as-cheap-as possible upgrade of an older index by only
+upgrading segments that are created by previous Lucene versions.
+ForceMerge does no longer really merge; it is just used to "forceMerge"
+older segment versions away.
+
+In general one would use IndexUpgrader, but for a fully customizeable
+upgrade, you can use this like any other MergePolicy and call
+IndexWriter.ForceMerge():
+
+	conf := NewIndexWriterConfig(util.VERSION_45, analyzer)
+	conf.SetMergePolicy(NewUpgradeIndexMergePolicy(conf.MergePolicy()))
+	w, err := NewIndexWriter(dir, conf)
+	...
+	err = w.ForceMerge(1)
+	...
+	err = w.Close()
+
+WARNING: This merge policy may reorder documents if the index was
+partially upgraded before calling ForceMerge() (e.g., documents were
+added). If your application relies on "monotonicity" of doc IDs
+(which means that the order in which the documents were added to the
+index is preserved), do a ForceMerge(1) instead. Please note, the
+delegate MergePolicy may also reorder documents.
+*/
+type UpgradeIndexMergePolicy struct {
+	// Wrapped MergePolicy.
+	MergePolicy
+	writer *util.SetOnce
+}
+
+/* Wraps the given MergePolicy and returns it. */
+func NewUpgradeIndexMergePolicy(base MergePolicy) *UpgradeIndexMergePolicy {
+	return &UpgradeIndexMergePolicy{
+		MergePolicy: base,
+		writer:      util.NewSetOnce(),
+	}
+}
+
+/*
+Returns true if the given segment should be upgraded, i.e. if it was
+written by another Lucene version than the current one.
+*/
+func shouldUpgradeSegment(si *SegmentInfoPerCommit) bool {
+	return si.info.Version() != util.LUCENE_MAIN_VERSION
+}
+
+func (mp *UpgradeIndexMergePolicy) SetIndexWriter(writer *IndexWriter) {
+	mp.writer.Set(writer)
+	mp.MergePolicy.SetIndexWriter(writer)
+}
+
+func (mp *UpgradeIndexMergePolicy) FindForcedMerges(infos *SegmentInfos, maxSegmentCount int,
+	segmentsToMerge map[*SegmentInfoPerCommit]bool) (spec MergeSpecification, err error) {
+
+	// first find all old segments
+	oldSegments := make(map[*SegmentInfoPerCommit]bool)
+	for _, si := range infos.Segments {
+		if v, ok := segmentsToMerge[si]; ok && shouldUpgradeSegment(si) {
+			oldSegments[si] = v
+		}
+	}
+
+	if mp.verbose() {
+		mp.message("findForcedMerges: segmentsToUpgrade=%v", segmentsToString(oldSegments))
+	}
+
+	if len(oldSegments) == 0 {
+		return nil, nil
+	}
+
+	if spec, err = mp.MergePolicy.FindForcedMerges(infos, maxSegmentCount, oldSegments); err != nil {
+		return nil, err
+	}
+
+	// remove all segments that are in merge specification from
+	// oldSegments, the resulting set contains all segments that are
+	// left over and will be merged to one additional segment:
+	for _, om := range spec {
+		for _, si := range om.segments {
+			delete(oldSegments, si)
+		}
+	}
+
+	if len(oldSegments) > 0 {
+		if mp.verbose() {
+			mp.message("findForcedMerges: %T does not want to merge all old segments, "+
+				"merge remaining ones into new segment: %v", mp.MergePolicy, segmentsToString(oldSegments))
+		}
+		var newInfos []*SegmentInfoPerCommit
+		for _, si := range infos.Segments {
+			if _, ok := oldSegments[si]; ok {
+				newInfos = append(newInfos, si)
+			}
+		}
+		// add the final merge
+		spec = append(spec, NewOneMerge(newInfos))
+	}
+
+	return spec, nil
+}
+
+func (mp *UpgradeIndexMergePolicy) verbose() bool {
+	w, ok := mp.writer.Get().(*IndexWriter)
+	return ok && w != nil && w.infoStream.IsEnabled("UPGMP")
+}
+
+func (mp *UpgradeIndexMergePolicy) message(format string, args ...interface{}) {
+	mp.writer.Get().(*IndexWriter).infoStream.Message("UPGMP", format, args...)
+}
+
+func (mp *UpgradeIndexMergePolicy) String() string {
+	return fmt.Sprintf("[UpgradeIndexMergePolicy->%v]", mp.MergePolicy)
+}
+
+func segmentsToString(segments map[*SegmentInfoPerCommit]bool) string {
+	var names []string
+	for si, _ := range segments {
+		names = append(names, si.info.Name)
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("%v", names)
+}
@@ -9,9 +9,12 @@ import (
 	"github.com/balzaczyy/golucene/core/store"
 	"github.com/balzaczyy/golucene/core/util"
 	"log"
+	"math"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // index/IndexCommit.java
@@ -132,6 +135,18 @@ const UNBOUNDED_MAX_MERGE_SEGMENTS = -1
 // Name of the write lock in the index.
 const WRITE_LOCK_NAME = "write.lock"
 
+// Key for the source of a segment in the diagnostics.
+const SOURCE = "source"
+
+// Source of a segment which results from a merge of other segments.
+const SOURCE_MERGE = "merge"
+
+// Source of a segment which results from a flush.
+const SOURCE_FLUSH = "flush"
+
+// Source of a segment which results from a call to AddIndexesFromReaders().
+const SOURCE_ADDINDEXES_READERS = "addIndexes(IndexReader...)"
+
 /*
 Absolute hard maximum length for a term, in bytes once encoded as
 UTF8. If a term arrives from the analyzer longer than this length,
@@ -187,7 +202,8 @@ type IndexWriter struct {
 	deleter    *IndexFileDeleter
 
 	// used by forceMerge to note those needing merging
-	segmentsToMerge map[*SegmentInfoPerCommit]bool
+	segmentsToMerge     map[*SegmentInfoPerCommit]bool
+	mergeMaxNumSegments int
 
 	writeLock store.Lock
 
@@ -398,7 +414,24 @@ func NewIndexWriter(d store.Directory, conf *IndexWriterConfig) (w *IndexWriter,
 }
 
 func (w *IndexWriter) fieldInfos(info *model.SegmentInfo) (infos model.FieldInfos, err error) {
-	panic("not implemented yet")
+	var cfsDir store.Directory
+	if info.IsCompoundFile() {
+		var cfs *store.CompoundFileDirectory
+		cfs, err = store.NewCompoundFileDirectory(info.Dir,
+			util.SegmentFileName(info.Name, "", store.COMPOUND_FILE_EXTENSION),
+			store.IO_CONTEXT_READONCE, false)
+		if err != nil {
+			return
+		}
+		defer func() {
+			err = mergeError(err, cfs.Close())
+		}()
+		cfsDir = cfs
+	} else {
+		cfsDir = info.Dir
+	}
+	return info.Codec().(Codec).FieldInfosFormat().FieldInfosReader()(
+		cfsDir, info.Name, store.IO_CONTEXT_READONCE)
 }
 
 /*
@@ -612,11 +645,171 @@ func (w *IndexWriter) closeInternalCleanup(waitForMerges bool) error {
 	return nil
 }
 
+/*
+Expert: returns a readonly reader, covering all committed as well as
+un-committed changes to the index. This provides "near real-time"
+searching, in that changes made during an IndexWriter session can be
+quickly made available for searching without closing the writer nor
+calling Commit().
+
+Note that this is functionally equivalent to calling Commit() and
+then using OpenDirectoryReader() to open a new reader. But the
+turnaround time of this method should be faster since it avoids the
+potentially costly Commit().
+
+You must close the DirectoryReader returned by this method once you
+are done using it.
+
+It's near real-time because there is no hard guarantee on how quickly
+you can get a new reader after making changes with IndexWriter.
+You'll have to experiment in your situation to determine if it's
+fast enough. As this is a new and experimental feature, please report
+back on your findings so we can learn, improve and iterate.
+
+The resulting reader supports OpenIfChanged(), but that call will
+simply forward back to this method (though this may change in the
+future).
+
+The very first time this method is called, this writer instance will
+make every effort to pool the readers that it opens for doing merges,
+applying deletes, etc. This means additional resources (RAM, file
+descriptors, CPU time) will be consumed.
+
+NOTE: once the writer is closed, any outstanding readers may continue
+to be used. However, if you attempt to reopen any of those readers,
+you'll hit an AlreadyClosedError.
+*/
+func (w *IndexWriter) getReader(applyAllDeletes bool) (r DirectoryReader, err error) {
+	w.ensureOpen()
+
+	start := time.Now()
+
+	if w.infoStream.IsEnabled("IW") {
+		w.infoStream.Message("IW", "flush at getReader")
+	}
+	// Do this up front before flushing so that the readers obtained
+	// during this flush are pooled, the first time this method is
+	// called:
+	w.poolReaders = true
+	if err = w.doBeforeFlush(); err != nil {
+		return nil, err
+	}
+
+	// for releasing a NRT reader we must ensure that DW doesn't add
+	// any segments or deletes until we are done with creating the NRT
+	// DirectoryReader. We release the two stage full flush after we
+	// are done opening the directory reader!
+	var success2 = false
+	defer func() {
+		if !success2 && r != nil {
+			util.CloseWhileSuppressingError(r)
+		}
+	}()
+
+	anySegmentFlushed, err := func() (anySegmentFlushed bool, err error) {
+		w.fullFlushLock.Lock()
+		defer w.fullFlushLock.Unlock()
+
+		var success = false
+		defer func() {
+			if !success {
+				if w.infoStream.IsEnabled("IW") {
+					w.infoStream.Message("IW", "hit error during NRT reader")
+				}
+			}
+			// Done: finish the full flush!
+			w.docWriter.finishFullFlush(success)
+			w.docWriter.processEvents(w, false, true)
+			if err2 := w.doAfterFlush(); err2 != nil {
+				log.Printf("Error in doAfterFlush: %v", err2)
+			}
+		}()
+
+		if anySegmentFlushed, err = w.docWriter.flushAllThreads(w); err != nil {
+			return
+		}
+		if !anySegmentFlushed {
+			// prevent double increment since docWriter.doFlush increments
+			// the flushCount if we flushed anything.
+			atomic.AddInt32(&w.flushCount, 1)
+		}
+		success = true
+
+		// Prevent segmentInfos from changing while opening the reader;
+		// in theory we could do similar retry logic, just like we do
+		// when loading segments_N
+		w.Lock()
+		defer w.Unlock()
+		if err = w._maybeApplyDeletes(applyAllDeletes); err != nil {
+			return
+		}
+		if r, err = openStandardDirectoryReaderFromWriter(w, w.segmentInfos, applyAllDeletes); err != nil {
+			return
+		}
+		if w.infoStream.IsEnabled("IW") {
+			w.infoStream.Message("IW", "return reader version=%v reader=%v", r.Version(), r)
+		}
+		return
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	if anySegmentFlushed {
+		if err = w.maybeMerge(MERGE_TRIGGER_FULL_FLUSH, UNBOUNDED_MAX_MERGE_SEGMENTS); err != nil {
+			return nil, err
+		}
+	}
+	if w.infoStream.IsEnabled("IW") {
+		w.infoStream.Message("IW", "getReader took %v", time.Now().Sub(start))
+	}
+	success2 = true
+	return r, nil
+}
+
 // Retuns the Directory used by this index.
 func (w *IndexWriter) Directory() store.Directory {
 	return w.directory
 }
 
+/*
+Returns a LiveIndexWriterConfig, which can be used to query the
+IndexWriter current settings, as well as modify "live" ones.
+*/
+func (w *IndexWriter) Config() *LiveIndexWriterConfig {
+	w.ensureOpen()
+	return w.config
+}
+
+/*
+Expert: remove any index files that are no longer used.
+
+IndexWriter normally deletes unused files itself, during indexing.
+However, on Windows, which disallows deletion of open files, if there
+is a reader open on the index then those files cannot be deleted.
+This is fine, because IndexWriter will periodically retry the
+deletion.
+
+However, IndexWriter doesn't try that often: only on open, close,
+flushing a new segment, and finishing a merge. If you don't do any of
+these actions with your IndexWriter, you'll see the unused files
+linger. If that's a problem, call this method to delete them (once
+you've closed the open readers that were preventing their deletion).
+
+In addition, you can call this method to delete unreferenced index
+commits. This might be useful if you are using an
+IndexDeletionPolicy which holds onto index commits until some
+criteria are met, but those commits are no longer needed. Otherwise,
+those commits will be deleted the next time Commit() is called.
+*/
+func (w *IndexWriter) DeleteUnusedFiles() error {
+	w.ensureOpen()
+	w.Lock() // synchronized
+	defer w.Unlock()
+	w.deleter.deletePendingFiles()
+	return w.deleter.revisitPolicy()
+}
+
 // L1201
 /*
 Adds a document to this index.
@@ -699,11 +892,201 @@ func (w *IndexWriter) UpdateDocument(term *Term, doc []IndexableField, analyzer
 	return nil
 }
 
+/*
+Atomically adds a block of documents with sequentially assigned
+document IDs, such that an external reader will see all or none of
+the documents.
+
+WARNING: the index does not currently record which documents were
+added as a block. Today this is fine, because merging will preserve
+a block. The order of documents within a segment will be preserved,
+even when child documents within a block are deleted. Most search
+features (like result grouping and block joining) require you to
+mark documents; when these documents are deleted these search
+features will not work as expected. Obviously adding documents to an
+existing block will require you the reindex the entire block.
+
+However it's possible that in the future Lucene may merge more
+aggressively re-order documents (for example, perhaps to obtain
+better index compression), in which case you may need to fully
+re-index your documents at that time.
+
+See AddDocument() for details on index and IndexWriter state after
+an error, and flushing/merging temporary free space requirements.
+
+NOTE: tools that do offline splitting of an index (for example,
+IndexSplitter in contrib) or re-sorting of documents (for example,
+IndexSorter in contrib) are not aware of these atomically added
+documents and will likely break them up. Use such tools at your own
+risk!
+
+NOTE: if this method hits a memory issue, you should immediately
+close the writer. See above for details.
+*/
+func (w *IndexWriter) AddDocuments(docs [][]IndexableField) error {
+	return w.AddDocumentsWithAnalyzer(docs, w.analyzer)
+}
+
+/*
+Atomically adds a block of documents, analyzed using the provided
+analyzer, with sequentially assigned document IDs, such that an
+external reader will see all or none of the documents.
+*/
+func (w *IndexWriter) AddDocumentsWithAnalyzer(docs [][]IndexableField, analyzer analysis.Analyzer) error {
+	return w.UpdateDocuments(nil, docs, analyzer)
+}
+
+/*
+Atomically deletes documents matching the provided delTerm and adds
+a block of documents, analyzed using the provided analyzer, with
+sequentially assigned document IDs, such that an external reader
+will see all or none of the documents.
+
+See AddDocuments().
+*/
+func (w *IndexWriter) UpdateDocuments(delTerm *Term, docs [][]IndexableField, analyzer analysis.Analyzer) error {
+	w.ensureOpen()
+	var success = false
+	defer func() {
+		if !success {
+			if w.infoStream.IsEnabled("IW") {
+				w.infoStream.Message("IW", "hit error updating document")
+			}
+		}
+	}()
+
+	ok, err := w.docWriter.updateDocuments(docs, analyzer, delTerm)
+	if err != nil {
+		return err
+	}
+	if ok {
+		w.docWriter.processEvents(w, true, false)
+	}
+	success = true
+	return nil
+}
+
+/*
+Deletes the document(s) containing any of the terms. All given
+deletes are applied and flushed atomically at the same time.
+
+NOTE: if this method hits a memory issue, you should immediately
+close the writer. See above for details.
+*/
+func (w *IndexWriter) DeleteDocuments(terms ...*Term) error {
+	w.ensureOpen()
+	ok, err := w.docWriter.deleteTerms(terms...)
+	if err != nil {
+		return err
+	}
+	if ok {
+		w.docWriter.processEvents(w, true, false)
+	}
+	return nil
+}
+
+/*
+Deletes the document(s) matching any of the provided queries. All
+given deletes are applied and flushed atomically at the same time.
+
+Queries are resolved against each segment using
+QueryDocIdSetIterator, which the search package provides.
+
+NOTE: if this method hits a memory issue, you should immediately
+close the writer. See above for details.
+*/
+func (w *IndexWriter) DeleteDocumentsByQuery(queries ...Query) error {
+	w.ensureOpen()
+	ok, err := w.docWriter.deleteQueries(queries...)
+	if err != nil {
+		return err
+	}
+	if ok {
+		w.docWriter.processEvents(w, true, false)
+	}
+	return nil
+}
+
+/*
+Delete all documents in the index.
+
+This method will drop all buffered documents and will remove all
+segments from the index. This change will not be visible until a
+Commit() has been called. This method can be rolled back using
+Rollback().
+
+NOTE: this method is much faster than using DeleteDocuments(
+new MatchAllDocsQuery()). Yet, this method also has different
+semantics compared to DeleteDocumentsByQuery() since internal data-
+structures are cleared as well as all segment information is forcefully
+dropped anti-viral semantics like omitting norms are reset or doc value
+types are cleared. Essentially a call to DeleteAll() is equivalent to
+creating a new IndexWriter with OPEN_MODE_CREATE which a delete query
+only marks documents as deleted.
+
+NOTE: this method will forcefully abort all merges in progress. If
+other goroutines are running ForceMerge(), AddIndexes() or
+ForceMergeDeletes() methods, they may receive MergeAbortedErrors.
+*/
+func (w *IndexWriter) DeleteAll() error {
+	w.ensureOpen()
+
+	// Abort any running merges. This must be done before locking the
+	// writer, since a merge needs the writer's lock to finish.
+	w.abortAllMerges()
+
+	w.Lock() // synchronized
+	defer w.Unlock()
+
+	var success = false
+	defer func() {
+		if !success {
+			if w.infoStream.IsEnabled("IW") {
+				w.infoStream.Message("IW", "hit error during deleteAll")
+			}
+		}
+	}()
+
+	// Remove any buffered docs
+	w.docWriter.abort(w)
+
+	// Remove all segments
+	w.segmentInfos.Clear()
+
+	// Ask deleter to locate unreferenced files & remove them:
+	err := w.deleter.checkpoint(w.segmentInfos, false)
+	if err != nil {
+		return err
+	}
+	err = w.deleter.refresh("")
+	if err != nil {
+		return err
+	}
+
+	w.globalFieldNumberMap.Clear()
+
+	// Don't bother saving any changes in our segmentInfos
+	err = w.readerPool.dropAll(false)
+	if err != nil {
+		return err
+	}
+
+	// Mark that the index has changed
+	w.changeCount++
+	w.segmentInfos.changed()
+	success = true
+	return nil
+}
+
 func (w *IndexWriter) newSegmentName() string {
 	// Cannot synchronize on IndexWriter because that causes deadlook
 	// Ian: but why?
 	w.Lock()
 	defer w.Unlock()
+	return w._newSegmentName()
+}
+
+func (w *IndexWriter) _newSegmentName() string {
 	// Important to increment changeCount so that the segmentInfos is
 	// written on close. Otherwise we could close, re-open and
 	// re-return the same segment name that was previously returned
@@ -762,12 +1145,12 @@ NOTE: if you call CloseAndWait() with false, which aborts all running
 merges, then any routine still running this method might hit a
 MergeAbortedError.
 */
-func (w *IndexWriter) forceMerge(maxNumSegments int) error {
-	return w.forceMergeAndWait(maxNumSegments, true)
+func (w *IndexWriter) ForceMerge(maxNumSegments int) error {
+	return w.ForceMergeAndWait(maxNumSegments, true)
 }
 
 /*
-Just like forceMerge(), except you can specify whether the call
+Just like ForceMerge(), except you can specify whether the call
 should block until all merging completes. This is only meaningful
 with  a Mergecheduler that is able to run merges in background
 routines.
@@ -775,17 +1158,112 @@ routines.
 NOTE: if this method hits a memory issue, you should immediately
 close the writer.
 */
-func (w *IndexWriter) forceMergeAndWait(maxNumSegments int, doWait bool) error {
-	panic("not implemented yet")
+func (w *IndexWriter) ForceMergeAndWait(maxNumSegments int, doWait bool) error {
+	w.ensureOpen()
+	assert2(maxNumSegments >= 1, fmt.Sprintf("maxNumSegments must be >= 1; got %v", maxNumSegments))
+
+	if w.infoStream.IsEnabled("IW") {
+		w.infoStream.Message("IW", "forceMerge: index now %v", w.segString())
+		w.infoStream.Message("IW", "now flush at forceMerge")
+	}
+
+	if err := w.flush(true, true); err != nil {
+		return err
+	}
+
+	func() {
+		w.Lock() // synchronized
+		defer w.Unlock()
+		w.MergeControl.Lock()
+		defer w.MergeControl.Unlock()
+
+		w.mergeExceptions = nil
+		w.segmentsToMerge = make(map[*SegmentInfoPerCommit]bool)
+		for _, info := range w.segmentInfos.Segments {
+			w.segmentsToMerge[info] = true
+		}
+		w.mergeMaxNumSegments = maxNumSegments
+
+		// Now mark all pending & running merges for forced merge:
+		for e := w.pendingMerges.Front(); e != nil; e = e.Next() {
+			e.Value.(*OneMerge).maxNumSegments = maxNumSegments
+		}
+		for merge, _ := range w.runningMerges {
+			merge.maxNumSegments = maxNumSegments
+		}
+	}()
+
+	if err := w.maybeMerge(MERGE_TRIGGER_EXPLICIT, maxNumSegments); err != nil {
+		return err
+	}
+
+	if doWait {
+		for {
+			pending := w.waitForMaxSegmentsMerge()
+			if err := w.forcedMergeError(); err != nil {
+				return err
+			}
+			if !pending {
+				break
+			}
+		}
+		// If close is called while we are still running, fail the call.
+		w.ensureOpen()
+	}
+	return nil
+}
+
+/*
+Waits for one of the pending or running maxNumSegments merges to
+finish, if any; returns false if there were none left.
+*/
+func (w *IndexWriter) waitForMaxSegmentsMerge() bool {
+	w.MergeControl.Lock() // synchronized
+	defer w.MergeControl.Unlock()
+	if !w._maxSegmentsMergePending() {
+		return false
+	}
+	w.mergeSignal.Wait()
+	return true
+}
+
+/*
+Forwards the error hit by a maxNumSegments merge, possibly in a
+background routine, to the routine calling ForceMerge().
+*/
+func (w *IndexWriter) forcedMergeError() error {
+	w.Lock() // synchronized
+	defer w.Unlock()
+	assert2(!w.hitOOM, "this writer hit an OutOfMemoryError; cannot complete forceMerge")
+	for _, merge := range w.mergeExceptions {
+		if merge.maxNumSegments != -1 {
+			return errors.New(fmt.Sprintf("background merge hit error: %v: %v",
+				merge.segString(w.directory), merge.error()))
+		}
+	}
+	return nil
 }
 
 // Returns true if any merges in pendingMerges or runningMerges
 // are maxNumSegments merges.
 func (w *IndexWriter) maxSegmentsMergePending() bool {
-	w.Lock() // synchronized
-	defer w.Unlock()
+	w.MergeControl.Lock() // synchronized
+	defer w.MergeControl.Unlock()
+	return w._maxSegmentsMergePending()
+}
 
-	panic("not implemented yet")
+func (w *IndexWriter) _maxSegmentsMergePending() bool {
+	for e := w.pendingMerges.Front(); e != nil; e = e.Next() {
+		if e.Value.(*OneMerge).maxNumSegments != -1 {
+			return true
+		}
+	}
+	for merge, _ := range w.runningMerges {
+		if merge.maxNumSegments != -1 {
+			return true
+		}
+	}
+	return false
 }
 
 func (w *IndexWriter) maybeMerge(trigger MergeTrigger, maxNumSegments int) (err error) {
@@ -799,35 +1277,162 @@ func (w *IndexWriter) maybeMerge(trigger MergeTrigger, maxNumSegments int) (err
 func (w *IndexWriter) updatePendingMerges(trigger MergeTrigger, maxNumSegments int) error {
 	w.Lock() // synchronized
 	defer w.Unlock()
-	panic("not implemented yet")
+	_, err := w._updatePendingMerges(trigger, maxNumSegments)
+	return err
 }
 
-/*
-Experts: to be used by a MergePolicy to avoid selecting merges for
-segments already being merged. The returned collection is not cloned,
-and thus is only safe to access if you hold IndexWriter's lock (which
-you do when IndexWriter invokes the MergePolicy).
-*/
+func (w *IndexWriter) _updatePendingMerges(trigger MergeTrigger, maxNumSegments int) (bool, error) {
+	assert(maxNumSegments == -1 || maxNumSegments > 0)
 
-func (w *IndexWriter) MergingSegments() []*SegmentInfoPerCommit {
-	w.Lock() // synchronized
-	defer w.Unlock()
-	panic("not implemented yet")
-}
+	w.MergeControl.Lock() // guard mergingSegments and pendingMerges
+	defer w.MergeControl.Unlock()
 
-/*
-Expert: the MergeScheduler calls this method to retrieve the next
-merge requested by the MergePolicy.
-*/
-func (w *IndexWriter) nextMerge() *OneMerge {
-	w.Lock() // synchronized
-	defer w.Unlock()
+	if w.stopMerges {
+		return false, nil
+	}
 
-	if w.pendingMerges.Len() == 0 {
-		return nil
+	// Do not start new merges if we've hit OOME
+	if w.hitOOM {
+		return false, nil
 	}
-	// Advance the merge from pending to running
-	merge := w.pendingMerges.Front().Value.(*OneMerge)
+
+	var spec MergeSpecification
+	var err error
+	if maxNumSegments != UNBOUNDED_MAX_MERGE_SEGMENTS {
+		assertn(trigger == MERGE_TRIGGER_EXPLICIT || trigger == MERGE_TRIGGER_MERGE_FINISHED,
+			"Expected EXPLICIT or MERGE_FINISHED as trigger even with maxNumSegments set but was: %v", trigger)
+		if spec, err = w.mergePolicy.FindForcedMerges(w.segmentInfos, maxNumSegments, w.segmentsToMerge); err != nil {
+			return false, err
+		}
+		for _, merge := range spec {
+			merge.maxNumSegments = maxNumSegments
+		}
+	} else {
+		if spec, err = w.mergePolicy.FindMerges(trigger, w.segmentInfos); err != nil {
+			return false, err
+		}
+	}
+
+	for _, merge := range spec {
+		if _, err = w._registerMerge(merge); err != nil {
+			return false, err
+		}
+	}
+	return len(spec) > 0, nil
+}
+
+/*
+Checks whether this merge involves any segments already participating
+in a merge. If not, this merge is "registered", meaning we record that
+its segments are now participating in a merge, and true is returned.
+Else (the merge conflicts) false is returned.
+
+Note: it must be called with both IndexWriter and MergeControl locked.
+*/
+func (w *IndexWriter) _registerMerge(merge *OneMerge) (bool, error) {
+	if merge.registerDone {
+		return true, nil
+	}
+	assert(len(merge.segments) > 0)
+
+	if w.stopMerges {
+		merge.abort()
+		return false, MergeAbortedError(fmt.Sprintf("merge is aborted: %v",
+			w.readerPool.segmentsToString(merge.segments)))
+	}
+
+	isExternal := false
+	for _, info := range merge.segments {
+		if _, ok := w.mergingSegments[info]; ok {
+			if w.infoStream.IsEnabled("IW") {
+				w.infoStream.Message("IW", "reject merge %v: segment %v is already marked for merge",
+					w.readerPool.segmentsToString(merge.segments), w.readerPool.segmentToString(info))
+			}
+			return false, nil
+		}
+		if w.segmentInfos.indexOf(info) == -1 {
+			if w.infoStream.IsEnabled("IW") {
+				w.infoStream.Message("IW", "reject merge %v: segment %v does not exist in live infos",
+					w.readerPool.segmentsToString(merge.segments), w.readerPool.segmentToString(info))
+			}
+			return false, nil
+		}
+		if info.info.Dir != w.directory {
+			isExternal = true
+		}
+		if _, ok := w.segmentsToMerge[info]; ok {
+			merge.maxNumSegments = w.mergeMaxNumSegments
+		}
+	}
+
+	w.pendingMerges.PushBack(merge)
+
+	if w.infoStream.IsEnabled("IW") {
+		w.infoStream.Message("IW", "add merge to pendingMerges: %v [total %v pending]",
+			w.readerPool.segmentsToString(merge.segments), w.pendingMerges.Len())
+	}
+
+	merge.isExternal = isExternal
+
+	// OK it does not conflict; now record that this merge is running
+	// (while synchronized) to avoid race condition where two
+	// conflicting merges from different routines, start
+	for _, info := range merge.segments {
+		if w.infoStream.IsEnabled("IW") {
+			w.infoStream.Message("IW", "registerMerge info=%v", w.readerPool.segmentToString(info))
+		}
+		w.mergingSegments[info] = true
+	}
+
+	assert(merge.estimatedMergeBytes == 0)
+	for _, info := range merge.segments {
+		if docCount := info.info.DocCount(); docCount > 0 {
+			delCount := w.readerPool.numDeletedDocs(info)
+			assert(delCount <= docCount)
+			delRatio := float64(delCount) / float64(docCount)
+			n, err := info.SizeInBytes()
+			if err != nil {
+				return false, err
+			}
+			merge.estimatedMergeBytes += int64(float64(n) * (1 - delRatio))
+		}
+	}
+
+	// Merge is now registered
+	merge.registerDone = true
+	return true, nil
+}
+
+/*
+Experts: to be used by a MergePolicy to avoid selecting merges for
+segments already being merged. The returned collection is not cloned,
+and thus is only safe to access if you hold IndexWriter's lock (which
+you do when IndexWriter invokes the MergePolicy).
+*/
+
+func (w *IndexWriter) MergingSegments() []*SegmentInfoPerCommit {
+	w.MergeControl.Lock() // synchronized
+	defer w.MergeControl.Unlock()
+	ans := make([]*SegmentInfoPerCommit, 0, len(w.mergingSegments))
+	for info, _ := range w.mergingSegments {
+		ans = append(ans, info)
+	}
+	return ans
+}
+
+/*
+Expert: the MergeScheduler calls this method to retrieve the next
+merge requested by the MergePolicy.
+*/
+func (w *IndexWriter) nextMerge() *OneMerge {
+	w.MergeControl.Lock() // synchronized
+	defer w.MergeControl.Unlock()
+
+	if w.pendingMerges.Len() == 0 {
+		return nil
+	}
+	// Advance the merge from pending to running
+	merge := w.pendingMerges.Front().Value.(*OneMerge)
 	w.pendingMerges.Remove(w.pendingMerges.Front())
 	w.runningMerges[merge] = true
 	return merge
@@ -838,6 +1443,355 @@ func (w *IndexWriter) hasPendingMerges() bool {
 	return w.pendingMerges.Len() > 0
 }
 
+// Returns an error if any of the given directories is this writer's
+// directory, or if the same directory is passed more than once.
+func (w *IndexWriter) noDupDirs(dirs ...store.Directory) error {
+	dups := make(map[store.Directory]bool)
+	for _, dir := range dirs {
+		if _, ok := dups[dir]; ok {
+			return errors.New(fmt.Sprintf("Directory %v appears more than once", dir))
+		}
+		if dir == w.directory {
+			return errors.New("Cannot add directory to itself")
+		}
+		dups[dir] = true
+	}
+	return nil
+}
+
+/*
+Acquires write locks on all the directories; be sure to match with a
+call to releaseWriteLocks() when done.
+*/
+func (w *IndexWriter) acquireWriteLocks(dirs ...store.Directory) (locks []store.Lock, err error) {
+	for _, dir := range dirs {
+		lock := dir.MakeLock(WRITE_LOCK_NAME)
+		ok, err := lock.ObtainWithin(w.config.writeLockTimeout)
+		if err == nil && !ok {
+			err = errors.New(fmt.Sprintf("Index locked for write: %v", lock))
+		}
+		if err != nil {
+			// Release all previously acquired locks:
+			releaseWriteLocks(locks) // ignore error
+			return nil, err
+		}
+		locks = append(locks, lock)
+	}
+	return locks, nil
+}
+
+func releaseWriteLocks(locks []store.Lock) (err error) {
+	for _, lock := range locks {
+		err = mergeError(err, lock.Release())
+	}
+	return
+}
+
+/*
+Adds all segments from an array of indexes into this index.
+
+This may be used to parallelize batch indexing. A large document
+collection can be broken into sub-collections. Each sub-collection
+can be indexed in parallel, on a different goroutine, process or
+machine. The complete index can then be created by merging
+sub-collection indexes with this method.
+
+NOTE: this method acquires the write lock in each directory, to
+ensure that no IndexWriter is currently open or tries to open while
+this is running. Each lock is obtained within the configured write
+lock timeout.
+
+This method is transactional in how errors are handled: it does not
+commit a new segments_N file until all indexes are added. This means
+if an error occurs (for example disk full), then either no indexes
+will have been added or they all will have been.
+
+Note that this requires temporary free space in the Directory up to
+2X the sum of all input indexes (including the starting index). If
+readers/searchers are open against the starting index, then
+temporary free space required will be higher by the size of the
+starting index.
+
+This requires this index not be among those to be added.
+
+NOTE: the segments are copied as-is, i.e. files are renamed to the
+new segment names but otherwise left alone; compound file segments
+remain compound, and no merging is done. The merge policy may then
+merge them later.
+
+NOTE: if this method hits a memory issue, you should immediately
+close the writer.
+*/
+func (w *IndexWriter) AddIndexes(dirs ...store.Directory) error {
+	w.ensureOpen()
+
+	if err := w.noDupDirs(dirs...); err != nil {
+		return err
+	}
+
+	locks, err := w.acquireWriteLocks(dirs...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = mergeError(err, releaseWriteLocks(locks))
+	}()
+
+	if w.infoStream.IsEnabled("IW") {
+		w.infoStream.Message("IW", "flush at addIndexes(Directory...)")
+	}
+	if err = w.flush(false, true); err != nil {
+		return err
+	}
+
+	var infos []*SegmentInfoPerCommit
+	for _, dir := range dirs {
+		if w.infoStream.IsEnabled("IW") {
+			w.infoStream.Message("IW", "addIndexes: process directory %v", dir)
+		}
+		sis := &SegmentInfos{} // read infos from dir
+		if err = sis.ReadAll(dir); err != nil {
+			return err
+		}
+
+		for _, info := range sis.Segments {
+			newSegName := w.newSegmentName()
+
+			if w.infoStream.IsEnabled("IW") {
+				w.infoStream.Message("IW", "addIndexes: process segment origName=%v newName=%v info=%v",
+					info.info.Name, newSegName, info)
+			}
+
+			var sizeInBytes int64
+			if sizeInBytes, err = info.SizeInBytes(); err != nil {
+				return err
+			}
+			context := store.NewIOContextForMerge(&store.MergeInfo{
+				info.info.DocCount(), sizeInBytes, true, -1})
+
+			var fis model.FieldInfos
+			if fis, err = w.fieldInfos(info.info); err != nil {
+				return err
+			}
+			for _, fi := range fis.Values {
+				w.globalFieldNumberMap.AddOrGet(fi)
+			}
+
+			var newInfo *SegmentInfoPerCommit
+			if newInfo, err = w.copySegmentAsIs(info, newSegName, fis, context); err != nil {
+				return err
+			}
+			infos = append(infos, newInfo)
+		}
+	}
+
+	w.Lock() // synchronized
+	defer w.Unlock()
+	w.ensureOpen()
+	w.segmentInfos.Segments = append(w.segmentInfos.Segments, infos...)
+	return w._checkpoint()
+}
+
+/*
+Merges the provided indexes into this index.
+
+The provided IndexReaders are not closed.
+
+See AddIndexes() for details on transactional semantics, temporary
+free space required in the Directory, and non-CFS segments on an
+error.
+
+NOTE: this method merges all given IndexReaders in one merge. If you
+intend to merge a large number of readers, it may be better to call
+this method multiple times, each time with a small set of readers. In
+principle, if you use a merge policy with a mergeFactor or
+segmentsPerTier of some value (e.g. 10), it would be best to provide
+the same number of readers to this method as well, as the merge
+policy would do otherwise.
+
+Since the readers are merged through their public API, any reader
+(e.g. one hiding some documents or fields) can be passed in.
+
+Whether the new segment uses the compound file format is decided by
+the MergePolicy.
+
+NOTE: if this method hits a memory issue, you should immediately
+close the writer.
+*/
+func (w *IndexWriter) AddIndexesFromReaders(readers ...IndexReader) (err error) {
+	w.ensureOpen()
+	numDocs := 0
+
+	if w.infoStream.IsEnabled("IW") {
+		w.infoStream.Message("IW", "flush at addIndexes(IndexReader...)")
+	}
+	if err = w.flush(false, true); err != nil {
+		return err
+	}
+
+	mergedName := w.newSegmentName()
+	var mergeReaders []AtomicReader
+	for _, reader := range readers {
+		numDocs += reader.NumDocs()
+		for _, ctx := range reader.Leaves() {
+			mergeReaders = append(mergeReaders, ctx.reader)
+		}
+	}
+
+	context := store.NewIOContextForMerge(&store.MergeInfo{numDocs, -1, true, -1})
+
+	// TODO: somehow we should fix this merge so it's abortable so that
+	// IW.close(false) is able to stop it
+	trackingDir := store.NewTrackingDirectoryWrapper(w.directory)
+
+	info := model.NewSegmentInfo(w.directory, util.LUCENE_MAIN_VERSION,
+		mergedName, -1, false, w.codec, nil, nil)
+
+	merger := newSegmentMerger(mergeReaders, info, w.infoStream, trackingDir,
+		w.config.termIndexInterval, CHECK_ABORT_NONE, w.globalFieldNumberMap, context)
+
+	var mergeState *MergeState
+	if mergeState, err = func() (*MergeState, error) {
+		var success = false
+		defer func() {
+			if !success {
+				w.Lock() // synchronized
+				defer w.Unlock()
+				w.deleter.refresh(info.Name) // ignore error
+			}
+		}()
+		mergeState, err := merger.merge() // merge 'em
+		if err != nil {
+			return nil, err
+		}
+		success = true
+		return mergeState, nil
+	}(); err != nil {
+		return err
+	}
+
+	infoPerCommit := NewSegmentInfoPerCommit(info, 0, -1)
+
+	files := trackingDir.CreatedFiles()
+	info.SetFiles(files)
+
+	setDiagnostics(info, SOURCE_ADDINDEXES_READERS)
+
+	var useCompoundFile bool
+	if stop, err := func() (bool, error) {
+		w.Lock() // Guard segmentInfos
+		defer w.Unlock()
+		if w.stopMerges {
+			w.deleter.deleteNewFiles(infoPerCommit.Files())
+			return true, nil
+		}
+		w.ensureOpen()
+		var err error
+		useCompoundFile, err = w.mergePolicy.UseCompoundFile(w.segmentInfos, infoPerCommit)
+		return false, err
+	}(); stop || err != nil {
+		return err
+	}
+
+	// Now create the compound file if needed
+	if useCompoundFile {
+		filesToDelete := infoPerCommit.Files()
+		_, err = createCompoundFile(w.infoStream, w.directory, CHECK_ABORT_NONE, info, context)
+		// delete new non cfs files directly: they were never registered
+		// with IFD
+		func() {
+			w.Lock() // synchronized
+			defer w.Unlock()
+			w.deleter.deleteNewFiles(filesToDelete)
+		}()
+		if err != nil {
+			return err
+		}
+		info.SetUseCompoundFile(true)
+	}
+
+	// Have codec write SegmentInfo. Must do this after creating CFS so
+	// that 1) .si isn't slurped into CFS, and 2) .si reflects
+	// useCompoundFile=true change above:
+	siDir := store.NewTrackingDirectoryWrapper(w.directory)
+	if err = w.codec.SegmentInfoFormat().SegmentInfoWriter()(siDir, info, mergeState.fieldInfos, context); err != nil {
+		w.Lock() // synchronized
+		defer w.Unlock()
+		w.deleter.refresh(info.Name) // ignore error
+		return err
+	}
+
+	files = siDir.CreatedFiles()
+	info.AddFiles(files)
+
+	// Register the new segment
+	w.Lock() // synchronized
+	defer w.Unlock()
+	if w.stopMerges {
+		w.deleter.deleteNewFiles(infoPerCommit.Files())
+		return nil
+	}
+	w.ensureOpen()
+	w.segmentInfos.Segments = append(w.segmentInfos.Segments, infoPerCommit)
+	return w._checkpoint()
+}
+
+// Copies the segment files as-is into the IndexWriter's directory.
+func (w *IndexWriter) copySegmentAsIs(info *SegmentInfoPerCommit, segName string,
+	fis model.FieldInfos, context store.IOContext) (*SegmentInfoPerCommit, error) {
+
+	// Same SI as before but we change directory and name
+	newInfo := model.NewSegmentInfo(w.directory, info.info.Version(),
+		segName, info.info.DocCount(), info.info.IsCompoundFile(),
+		info.info.Codec(), info.info.Diagnostics(), info.info.Attributes())
+	newInfoPerCommit := NewSegmentInfoPerCommit(newInfo, info.delCount, info.delGen)
+
+	// Build up new segment's file names. Must do this before writing
+	// SegmentInfo:
+	segFiles := make(map[string]bool)
+	for _, file := range info.Files() {
+		segFiles[segName+util.StripSegmentName(file)] = true
+	}
+	newInfo.SetFiles(segFiles)
+
+	// We must rewrite the SI file because it references segment name
+	// (its own name, if its 3.x, and doc store segment name):
+	trackingDir := store.NewTrackingDirectoryWrapper(w.directory)
+	codec := newInfo.Codec().(Codec)
+	err := codec.SegmentInfoFormat().SegmentInfoWriter()(trackingDir, newInfo, fis, context)
+	if err != nil {
+		return nil, err
+	}
+
+	var success = false
+	defer func() {
+		if !success {
+			for file, _ := range newInfo.Files() {
+				w.directory.DeleteFile(file) // ignore error
+			}
+		}
+	}()
+
+	// Copy the segment's files
+	for _, file := range info.Files() {
+		newFileName := segName + util.StripSegmentName(file)
+		if trackingDir.ContainsFile(newFileName) {
+			// We already rewrote this above
+			continue
+		}
+
+		assertn(!w.directory.FileExists(newFileName),
+			"file '%v' already exists", newFileName)
+
+		if err = info.info.Dir.Copy(w.directory, file, newFileName, context); err != nil {
+			return nil, err
+		}
+	}
+
+	success = true
+	return newInfoPerCommit, nil
+}
+
 /*
 Close the IndexWriter without committing any changes that have
 occurred since the last commit (or since it was opened, if commit
@@ -851,425 +1805,1231 @@ func (w *IndexWriter) Rollback() error {
 	return w.close(w.rollbackInternal)
 }
 
-func (w *IndexWriter) rollbackInternal() (ok bool, err error) {
-	panic("not implemented yet")
+func (w *IndexWriter) rollbackInternal() (ok bool, err error) {
+	if w.infoStream.IsEnabled("IW") {
+		w.infoStream.Message("IW", "rollback")
+	}
+
+	if err = func() error {
+		w.abortAllMerges()
+		if w.infoStream.IsEnabled("IW") {
+			w.infoStream.Message("IW", "rollback: done finish merges")
+		}
+
+		w.bufferedDeletesStream.clear()
+		w.docWriter.close() // mark it as closed first to prevent subsequent indexing actions/flushes
+		w.docWriter.abort(w)
+
+		w.Lock()
+		defer w.Unlock()
+
+		if w.pendingCommit != nil {
+			w.pendingCommit.rollbackCommit(w.directory)
+			// Matches the incRef done in prepareCommit:
+			w.deleter.decRefFiles(w.filesToCommit)
+			w.filesToCommit = nil
+			w.pendingCommit = nil
+		}
+
+		// Don't bother saving any changes in our segmentInfos
+		if err := w.readerPool.dropAll(false); err != nil {
+			return err
+		}
+
+		// Keep the same segmentInfos instance but replace all of its
+		// SegmentInfo instances. This is so the next attempt to commit
+		// using this instance of IndexWriter will always write to a new
+		// generation ("write once").
+		w.segmentInfos.rollbackSegmentInfos(w.rollbackSegments)
+		if w.infoStream.IsEnabled("IW") {
+			w.infoStream.Message("IW", "rollback: infos=%v", w.readerPool.segmentsToString(w.segmentInfos.Segments))
+		}
+
+		w.testPoint("rollback before checkpoint")
+
+		// Ask deleter to locate unreferenced files & remove them:
+		if err := w.deleter.checkpoint(w.segmentInfos, false); err != nil {
+			return err
+		}
+		if err := w.deleter.refresh(""); err != nil {
+			return err
+		}
+
+		w.lastCommitChangeCount = w.changeCount
+		return nil
+	}(); err != nil {
+		if w.infoStream.IsEnabled("IW") {
+			w.infoStream.Message("IW", "hit error during rollback")
+		}
+		return false, err
+	}
+
+	return w.closeInternal(false, false)
+}
+
+/*
+Called whenever the SegmentInfos has been updatd and the index files
+referenced exist (correctly) in the index directory.
+*/
+func (w *IndexWriter) checkpoint() (err error) {
+	w.Lock() // synchronized
+	defer w.Unlock()
+	return w._checkpoint()
+}
+
+func (w *IndexWriter) _checkpoint() error {
+	w.changeCount++
+	w.segmentInfos.changed()
+	return w.deleter.checkpoint(w.segmentInfos, false)
+}
+
+/*
+Checkpoints with IndexFileDeleter, so it's aware of new files, and
+increments changeCount, so on close/commit we will write a new
+segments file, but does NOT bump segmentInfos.version.
+*/
+func (w *IndexWriter) checkpointNoSIS() (err error) {
+	w.Lock() // synchronized
+	defer w.Unlock()
+	return w._checkpointNoSIS()
+}
+
+func (w *IndexWriter) _checkpointNoSIS() error {
+	w.changeCount++
+	return w.deleter.checkpoint(w.segmentInfos, false)
+}
+
+/* Called internally if any index state has changed. */
+func (w *IndexWriter) changed() {
+	w.Lock()
+	defer w.Unlock()
+	w.changeCount++
+	w.segmentInfos.changed()
+}
+
+/*
+Atomically adds the segment private delete packet and publishes the
+flushed segments SegmentInfo to the index writer.
+*/
+func (w *IndexWriter) publishFlushedSegment(newSegment *SegmentInfoPerCommit,
+	packet *FrozenBufferedDeletes, globalPacket *FrozenBufferedDeletes) error {
+	defer func() {
+		atomic.AddInt32(&w.flushCount, 1)
+		if err := w.doAfterFlush(); err != nil {
+			log.Printf("Error in doAfterFlush: %v", err)
+		}
+	}()
+
+	w.Lock() // synchronized
+	defer w.Unlock()
+
+	// Lock order IW -> BDS
+	if w.infoStream.IsEnabled("IW") {
+		w.infoStream.Message("IW", "publishFlushedSegment")
+	}
+
+	if globalPacket != nil && globalPacket.any() {
+		w.bufferedDeletesStream.push(globalPacket)
+	}
+	// Publishing the segment must be synched on IW -> BDS to make sure
+	// that no merge prunes away the seg. private delete packet
+	var nextGen int64
+	if packet != nil && packet.any() {
+		nextGen = w.bufferedDeletesStream.push(packet)
+	} else {
+		// Since we don't have a delete packet to apply we can get a new
+		// generation right away
+		nextGen = w.bufferedDeletesStream.getNextGen()
+	}
+	if w.infoStream.IsEnabled("IW") {
+		w.infoStream.Message("IW", "publish sets newSegment delGen=%v seg=%v",
+			nextGen, w.readerPool.segmentToString(newSegment))
+	}
+	newSegment.setBufferedDeletesGen(nextGen)
+	w.segmentInfos.Segments = append(w.segmentInfos.Segments, newSegment)
+	return w._checkpoint()
+}
+
+/*
+Publishes the flushed global deletes so that they are applied to all
+existing segments on the next applyAllDeletes.
+*/
+func (w *IndexWriter) publishFrozenDeletes(packet *FrozenBufferedDeletes) {
+	w.Lock() // synchronized
+	defer w.Unlock()
+	assert(packet != nil && packet.any())
+	w.bufferedDeletesStream.push(packet)
+}
+
+func (w *IndexWriter) resetMergeExceptions() {
+	w.Lock() // synchronized
+	defer w.Unlock()
+	panic("not implemented yet")
+}
+
+/*
+Expert: prepare for commit. This does the first phase of 2-phase
+commit. This method does all steps necessary to commit changes since
+this writer was opened: flushes pending added and deleted docs, syncs
+the index files, writes most of next segments_N file. After calling
+this you must call either Commit() to finish the commit, or
+Rollback() to revert the commit and undo all changes done since the
+writer was opened.
+
+You can also just call Commit() directly without PrepareCommit()
+first in which case that method will internally call PrepareCommit().
+
+NOTE: if this method hits a memory issue, you should immediately
+close the writer.
+*/
+func (w *IndexWriter) PrepareCommit() error {
+	w.ensureOpen()
+	w.commitLock.Lock()
+	defer w.commitLock.Unlock()
+	return w.prepareCommitInternal()
+}
+
+/*
+Requires commitLock
+*/
+func (w *IndexWriter) prepareCommitInternal() error {
+	w.ClosingControl.ensureOpen(false)
+	if w.infoStream.IsEnabled("IW") {
+		w.infoStream.Message("IW", "prepareCommit: flush")
+		w.infoStream.Message("IW", "  index before flush %v", w.segString())
+	}
+
+	assert2(!w.hitOOM, "this writer hit an OOM; cannot commit")
+	assert2(w.pendingCommit == nil, "prepareCommit was already called with no corresponding call to commit")
+
+	err := w.doBeforeFlush()
+	if err != nil {
+		return err
+	}
+	w.testPoint("startDoFlush")
+
+	// This is copied from doFLush, except it's modified to clone &
+	// incRef the flushed SegmentInfos inside the sync block:
+
+	toCommit, anySegmentsFlushed, err := func() (toCommit *SegmentInfos, anySegmentsFlushed bool, err error) {
+		w.fullFlushLock.Lock()
+		defer w.fullFlushLock.Unlock()
+
+		var flushSuccess = false
+		var success = false
+		defer func() {
+			if !success {
+				if w.infoStream.IsEnabled("IW") {
+					w.infoStream.Message("IW", "hit error during prepareCommit")
+				}
+			}
+			// Done: finish the full flush!
+			w.docWriter.finishFullFlush(flushSuccess)
+			err2 := w.doAfterFlush()
+			if err2 != nil {
+				log.Printf("Error in doAfterFlush: %v", err2)
+			}
+		}()
+
+		anySegmentsFlushed, err = w.docWriter.flushAllThreads(w)
+		if err != nil {
+			return
+		}
+		if !anySegmentsFlushed {
+			// prevent double increment since docWriter.doFlush increments
+			// the flushCount if we flushed anything.
+			atomic.AddInt32(&w.flushCount, -1)
+		}
+		w.docWriter.processEvents(w, false, true)
+		flushSuccess = true
+
+		err = func() (err error) {
+			w.Lock()
+			defer w.Unlock()
+
+			err = w._maybeApplyDeletes(true)
+			if err != nil {
+				return
+			}
+
+			err = w.readerPool.commit(w.segmentInfos)
+			if err != nil {
+				return
+			}
+
+			// Must clone the segmentInfos while we still
+			// hold fullFlushLock and while sync'd so that
+			// no partial changes (eg a delete w/o
+			// corresponding add from an updateDocument) can
+			// sneak into the commit point:
+			toCommit = w.segmentInfos.Clone()
+
+			w.pendingCommitChangeCount = w.changeCount
+
+			// This protects the segmentInfos we are now going
+			// to commit.  This is important in case, eg, while
+			// we are trying to sync all referenced files, a
+			// merge completes which would otherwise have
+			// removed the files we are now syncing.
+			w.filesToCommit = toCommit.files(w.directory, false)
+			w.deleter.incRefFiles(w.filesToCommit)
+			return
+		}()
+		if err != nil {
+			return
+		}
+		success = true
+		return
+	}()
+
+	var success = false
+	defer func() {
+		if !success {
+			func() {
+				w.Lock()
+				defer w.Unlock()
+				w.deleter.decRefFiles(w.filesToCommit)
+				w.filesToCommit = nil
+			}()
+		}
+	}()
+	if anySegmentsFlushed {
+		err := w.maybeMerge(MERGE_TRIGGER_FULL_FLUSH, UNBOUNDED_MAX_MERGE_SEGMENTS)
+		if err != nil {
+			return err
+		}
+	}
+	success = true
+
+	return w.startCommit(toCommit)
+}
+
+/*
+Sets the commit user data map. That method is considered a
+transaction by IndexWriter and will be committed (Commit()) even if
+no other changes were made to the writer instance. Note that you must
+call this method before PrepareCommit(), or otherwise it won't be
+included in the follow-on Commit().
+
+NOTE: the map is cloned internally, therefore altering the map's
+contents after calling this method has no effect.
+*/
+func (w *IndexWriter) SetCommitData(commitUserData map[string]string) {
+	w.Lock() // synchronized
+	defer w.Unlock()
+	userData := make(map[string]string)
+	for k, v := range commitUserData {
+		userData[k] = v
+	}
+	w.segmentInfos.userData = userData
+	w.changeCount++
+}
+
+/*
+Returns the commit user data map that was last committed, or the one
+that was set on SetCommitData().
+*/
+func (w *IndexWriter) CommitData() map[string]string {
+	w.Lock() // synchronized
+	defer w.Unlock()
+	return w.segmentInfos.userData
+}
+
+/*
+Commits all pending changes (added & deleted documents, segment
+merges, added indexes, etc.) to the index, and syncs all referenced
+index files, such that a reader will see the changes and the index
+updates will survive an OS or machine crash or power loss. Note that
+this does not wait for any running background merges to finish. This
+may be a costly operation, so you should test the cost in your
+application and do it only when really necessary.
+
+Note that this operation calls Directory.sync on the index files.
+That call  should not return until the file contents & metadata are
+on stable storage. For FSDirectory, this calls the OS's fsync. But,
+beware: some hardware devices may in fact cache writes even during
+fsync, and return before the bits are actually on stable storage, to
+give the appearance of faster performance. If you have such a device,
+and it does not hav a battery backup (for example) then on power loss
+it may still lose data. Lucene cannot guarantee consistency on such
+devices.
+
+NOTE: if this method hits a memory issue, you should immediately
+close the writer.
+*/
+func (w *IndexWriter) Commit() error {
+	w.ensureOpen()
+	w.commitLock.Lock()
+	defer w.commitLock.Unlock()
+	return w.commitInternal()
+}
+
+/*
+Assume commitLock is locked.
+*/
+func (w *IndexWriter) commitInternal() error {
+	if w.infoStream.IsEnabled("IW") {
+		w.infoStream.Message("IW", "commit: start")
+	}
+
+	w.ClosingControl.ensureOpen(false)
+
+	if w.infoStream.IsEnabled("IW") {
+		w.infoStream.Message("IW", "commit: enter lock")
+	}
+
+	if w.pendingCommit == nil {
+		if w.infoStream.IsEnabled("IW") {
+			w.infoStream.Message("IW", "commit: now prepare")
+		}
+		err := w.prepareCommitInternal()
+		if err != nil {
+			return err
+		}
+	} else {
+		if w.infoStream.IsEnabled("IW") {
+			w.infoStream.Message("IW", "commit: already prepared")
+		}
+	}
+	return w.finishCommit()
+}
+
+func (w *IndexWriter) finishCommit() error {
+	w.Lock() // synchronized
+	defer w.Unlock()
+
+	if w.pendingCommit == nil {
+		if w.infoStream.IsEnabled("IW") {
+			w.infoStream.Message("IW", "commit: pendingCommit == nil; skip")
+			w.infoStream.Message("IW", "commit: done")
+		}
+		return nil
+	}
+
+	defer func() {
+		// Matches the incRef done in prepareCommit:
+		w.deleter.decRefFiles(w.filesToCommit)
+		w.filesToCommit = nil
+		w.pendingCommit = nil
+		// TODO check if any wait()
+	}()
+
+	if w.infoStream.IsEnabled("IW") {
+		w.infoStream.Message("IW", "commit: pendingCommit != nil")
+	}
+	err := w.pendingCommit.finishCommit(w.directory)
+	if err != nil {
+		return err
+	}
+	if w.infoStream.IsEnabled("IW") {
+		w.infoStream.Message("IW", "commit: wrote segments file '%v'", w.pendingCommit.SegmentsFileName())
+	}
+	w.segmentInfos.updateGeneration(w.pendingCommit)
+	w.lastCommitChangeCount = w.pendingCommitChangeCount
+	w.rollbackSegments = w.pendingCommit.createBackupSegmentInfos()
+	// NOTE: don't use this.checkpoint() here, because
+	// we do not want to increment changeCount:
+	return w.deleter.checkpoint(w.pendingCommit, true)
+}
+
+/*
+Flush all in-memory buffered updates (adds and deletes) to the
+Directory.
+*/
+func (w *IndexWriter) flush(triggerMerge bool, applyAllDeletes bool) error {
+	// NOTE: this method cannot be sync'd because
+	// maybeMerge() in turn calls mergeScheduler.merge which
+	// in turn can take a long time to run and we don't want
+	// to hold the lock for that.  In the case of
+	// ConcurrentMergeScheduler this can lead to deadlock
+	// when it stalls due to too many running merges.
+
+	// We can be called during close, when closing==true, so we must pass false to ensureOpen:
+	w.ClosingControl.ensureOpen(false)
+	ok, err := w.doFlush(applyAllDeletes)
+	if err != nil {
+		return err
+	}
+	if ok && triggerMerge {
+		return w.maybeMerge(MERGE_TRIGGER_FULL_FLUSH, UNBOUNDED_MAX_MERGE_SEGMENTS)
+	}
+	return nil
+}
+
+func (w *IndexWriter) doFlush(applyAllDeletes bool) (bool, error) {
+	assert2(!w.hitOOM, "this writer hit an OutOfMemoryError; cannot flush")
+
+	err := w.doBeforeFlush()
+	if err != nil {
+		return false, err
+	}
+	if w.infoStream.IsEnabled("TP") {
+		w.infoStream.Message("TP", "startDoFlush")
+	}
+
+	success := false
+	defer func() {
+		if !success && w.infoStream.IsEnabled("IW") {
+			w.infoStream.Message("IW", "hit error during flush")
+		}
+	}()
+
+	if w.infoStream.IsEnabled("IW") {
+		w.infoStream.Message("IW", "  start flush: applyAllDeletes=%v", applyAllDeletes)
+		w.infoStream.Message("IW", "  index before flush %v", w.segString())
+	}
+
+	anySegmentFlushed, err := func() (ok bool, err error) {
+		w.fullFlushLock.Lock()
+		defer w.fullFlushLock.Unlock()
+
+		flushSuccess := false
+		defer func() {
+			w.docWriter.finishFullFlush(flushSuccess)
+			w.docWriter.processEvents(w, false, true)
+		}()
+
+		if ok, err = w.docWriter.flushAllThreads(w); err == nil {
+			flushSuccess = true
+		}
+		return
+	}()
+	if err != nil {
+		return false, err
+	}
+
+	err = func() error {
+		w.Lock()
+		defer w.Unlock()
+		err := w._maybeApplyDeletes(applyAllDeletes)
+		if err != nil {
+			return err
+		}
+		err = w.doAfterFlush()
+		if err != nil {
+			return err
+		}
+		if !anySegmentFlushed {
+			//flushCount is incremented in flushAllThreads
+			atomic.AddInt32(&w.flushCount, 1)
+		}
+		return nil
+	}()
+	if err != nil {
+		return false, err
+	}
+
+	success = true
+	return anySegmentFlushed, nil
+}
+
+func (w *IndexWriter) _maybeApplyDeletes(applyAllDeletes bool) error {
+	if applyAllDeletes {
+		if w.infoStream.IsEnabled("IW") {
+			w.infoStream.Message("IW", "apply all deletes during flush")
+		}
+		return w._applyAllDeletes()
+	} else if w.infoStream.IsEnabled("IW") {
+		w.infoStream.Message("IW", "don't apply deletes now delTermCount=%v bytesUsed=%v",
+			atomic.LoadInt32(&w.bufferedDeletesStream.numTerms),
+			atomic.LoadInt64(&w.bufferedDeletesStream.bytesUsed))
+	}
+	return nil
+}
+
+func (w *IndexWriter) applyAllDeletes() error {
+	w.Lock() // synchronized
+	defer w.Unlock()
+	return w._applyAllDeletes()
+}
+
+func (w *IndexWriter) _applyAllDeletes() error {
+	atomic.AddInt32(&w.flushDeletesCount, 1)
+	result, err := w.bufferedDeletesStream.applyDeletes(w.readerPool, w.segmentInfos.Segments)
+	if err != nil {
+		return err
+	}
+	if result.anyDeletes {
+		err = w._checkpoint()
+		if err != nil {
+			return err
+		}
+	}
+	if !w.keepFullyDeletedSegments && result.allDeleted != nil {
+		if w.infoStream.IsEnabled("IW") {
+			w.infoStream.Message("IW", "drop 100%% deleted segments: %v",
+				w.readerPool.segmentsToString(result.allDeleted))
+		}
+		for _, info := range result.allDeleted {
+			// If a merge has already registered for this segment, we leave
+			// it in the readerPool; the merge will skip merging it and
+			// will then drop it once it's done:
+			if _, ok := w.mergingSegments[info]; !ok {
+				w.segmentInfos.remove(info)
+				err = w.readerPool.drop(info)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		err = w._checkpoint()
+		if err != nil {
+			return err
+		}
+	}
+	w.bufferedDeletesStream.prune(w.segmentInfos)
+	return nil
+}
+
+// L3440
+/*
+Merges the indicated segments, replacing them in the stack with a
+single segment.
+*/
+func (w *IndexWriter) merge(merge *OneMerge) (err error) {
+	success := false
+	t0 := time.Now()
+
+	defer func() {
+		w.Lock() // synchronized
+		defer w.Unlock()
+
+		func() {
+			w.MergeControl.Lock()
+			defer w.MergeControl.Unlock()
+			w.mergeFinish(merge)
+		}()
+
+		if !success {
+			if w.infoStream.IsEnabled("IW") {
+				w.infoStream.Message("IW", "hit error during merge")
+			}
+			if merge.info != nil && w.segmentInfos.indexOf(merge.info) == -1 {
+				w.deleter.refresh(merge.info.info.Name) // ignore error
+			}
+		}
+
+		// This merge (and, generally, any change to the segments) may now
+		// enable new merges, so we call merge policy & update pending
+		// merges.
+		if success && !merge.isAborted() &&
+			(merge.maxNumSegments != -1 || (!w.ClosingControl._closed && !w.ClosingControl._closing)) {
+			_, err2 := w._updatePendingMerges(MERGE_TRIGGER_MERGE_FINISHED, merge.maxNumSegments)
+			err = mergeError(err, err2)
+		}
+	}()
+
+	if err = func() error {
+		if err := w.mergeInit(merge); err != nil {
+			return err
+		}
+		if w.infoStream.IsEnabled("IW") {
+			w.infoStream.Message("IW", "now merge\n  merge=%v\n  index=%v",
+				w.readerPool.segmentsToString(merge.segments), w.segString())
+		}
+		_, err := w.mergeMiddle(merge)
+		return err
+	}(); err != nil {
+		return w.handleMergeError(err, merge)
+	}
+	success = true
+
+	if merge.info != nil && !merge.isAborted() {
+		if w.infoStream.IsEnabled("IW") {
+			w.infoStream.Message("IW", "merge time %v for %v docs",
+				time.Now().Sub(t0), merge.info.info.DocCount())
+		}
+	}
+	return nil
+}
+
+func (w *IndexWriter) handleMergeError(err error, merge *OneMerge) error {
+	if w.infoStream.IsEnabled("IW") {
+		w.infoStream.Message("IW", "handleMergeError: merge=%v err=%v",
+			w.readerPool.segmentsToString(merge.segments), err)
+	}
+
+	// Set the error on the merge, so if forceMerge is waiting on us it
+	// sees the root cause error:
+	merge.setError(err)
+	w.addMergeError(merge)
+
+	if _, ok := err.(MergeAbortedError); ok {
+		// We can ignore this error (it happens when close(false) or
+		// rollback is called), unless the merge involves segments from
+		// external directories, in which case we must throw it so, for
+		// example, the rollbackTransaction code in addIndexes* is
+		// executed.
+		if merge.isExternal {
+			return err
+		}
+		return nil
+	}
+	return err
 }
 
-/*
-Called whenever the SegmentInfos has been updatd and the index files
-referenced exist (correctly) in the index directory.
-*/
-func (w *IndexWriter) checkpoint() (err error) {
+func (w *IndexWriter) addMergeError(merge *OneMerge) {
 	w.Lock() // synchronized
 	defer w.Unlock()
-	w.changeCount++
-	w.segmentInfos.changed()
-	return w.deleter.checkpoint(w.segmentInfos, false)
+	for _, m := range w.mergeExceptions {
+		if m == merge {
+			return
+		}
+	}
+	w.mergeExceptions = append(w.mergeExceptions, merge)
 }
 
 /*
-Checkpoints with IndexFileDeleter, so it's aware of new files, and
-increments changeCount, so on close/commit we will write a new
-segments file, but does NOT bump segmentInfos.version.
+Does initial setup for a merge, which is fast but holds the
+synchronized lock on IndexWriter instance.
 */
-func (w *IndexWriter) checkpointNoSIS() (err error) {
+func (w *IndexWriter) mergeInit(merge *OneMerge) error {
 	w.Lock() // synchronized
 	defer w.Unlock()
-	w.changeCount++
-	return w.deleter.checkpoint(w.segmentInfos, false)
-}
 
-/* Called internally if any index state has changed. */
-func (w *IndexWriter) changed() {
-	w.Lock()
-	defer w.Unlock()
-	w.changeCount++
-	w.segmentInfos.changed()
+	success := false
+	defer func() {
+		if !success {
+			w.MergeControl.Lock()
+			defer w.MergeControl.Unlock()
+			w.mergeFinish(merge)
+		}
+	}()
+	if err := w._mergeInit(merge); err != nil {
+		return err
+	}
+	success = true
+	return nil
 }
 
-/*
-Atomically adds the segment private delete packet and publishes the
-flushed segments SegmentInfo to the index writer.
-*/
-func (w *IndexWriter) publishFlushedSegment(newSegment *SegmentInfoPerCommit,
-	packet *FrozenBufferedDeletes, globalPacket *FrozenBufferedDeletes) error {
-	panic("not implemented yet")
-}
+func (w *IndexWriter) _mergeInit(merge *OneMerge) error {
+	assert(merge.registerDone)
+	assert(merge.maxNumSegments == -1 || merge.maxNumSegments > 0)
 
-func (w *IndexWriter) resetMergeExceptions() {
-	w.Lock() // synchronized
-	defer w.Unlock()
-	panic("not implemented yet")
-}
+	assert2(!w.hitOOM, "this writer hit an OutOfMemoryError; cannot merge")
 
-/*
-Requires commitLock
-*/
-func (w *IndexWriter) prepareCommitInternal() error {
-	w.ClosingControl.ensureOpen(false)
-	if w.infoStream.IsEnabled("IW") {
-		w.infoStream.Message("IW", "prepareCommit: flush")
-		w.infoStream.Message("IW", "  index before flush %v", w.segString())
+	if merge.info != nil {
+		// mergeInit already done
+		return nil
 	}
 
-	assert2(!w.hitOOM, "this writer hit an OOM; cannot commit")
-	assert2(w.pendingCommit == nil, "prepareCommit was already called with no corresponding call to commit")
+	if merge.isAborted() {
+		return nil
+	}
 
-	err := w.doBeforeFlush()
+	// TODO: in the non-pool'd case this is somewhat wasteful, because
+	// we open these readers, close them, and then open them again for
+	// merging. Maybe we could pre-pool them somehow in that case...
+
+	// Lock order: IW -> BD
+	result, err := w.bufferedDeletesStream.applyDeletes(w.readerPool, merge.segments)
 	if err != nil {
 		return err
 	}
-	w.testPoint("startDoFlush")
-
-	// This is copied from doFLush, except it's modified to clone &
-	// incRef the flushed SegmentInfos inside the sync block:
 
-	toCommit, anySegmentsFlushed, err := func() (toCommit *SegmentInfos, anySegmentsFlushed bool, err error) {
-		w.fullFlushLock.Lock()
-		defer w.fullFlushLock.Unlock()
+	if result.anyDeletes {
+		if err = w._checkpoint(); err != nil {
+			return err
+		}
+	}
 
-		var flushSuccess = false
-		var success = false
-		defer func() {
-			if !success {
-				if w.infoStream.IsEnabled("IW") {
-					w.infoStream.Message("IW", "hit error during prepareCommit")
+	if !w.keepFullyDeletedSegments && result.allDeleted != nil {
+		if w.infoStream.IsEnabled("IW") {
+			w.infoStream.Message("IW", "drop 100%% deleted segments: %v",
+				w.readerPool.segmentsToString(result.allDeleted))
+		}
+		for _, info := range result.allDeleted {
+			w.segmentInfos.remove(info)
+			func() {
+				w.MergeControl.Lock()
+				defer w.MergeControl.Unlock()
+				for i, v := range merge.segments {
+					if v == info {
+						delete(w.mergingSegments, info)
+						merge.segments = append(merge.segments[:i], merge.segments[i+1:]...)
+						break
+					}
 				}
+			}()
+			if err = w.readerPool.drop(info); err != nil {
+				return err
 			}
-			// Done: finish the full flush!
-			w.docWriter.finishFullFlush(flushSuccess)
-			err2 := w.doAfterFlush()
-			if err2 != nil {
-				log.Printf("Error in doAfterFlush: %v", err2)
-			}
-		}()
-
-		anySegmentsFlushed, err = w.docWriter.flushAllThreads(w)
-		if err != nil {
-			return
 		}
-		if !anySegmentsFlushed {
-			// prevent double increment since docWriter.doFlush increments
-			// the flushCount if we flushed anything.
-			atomic.AddInt32(&w.flushCount, -1)
+		if err = w._checkpoint(); err != nil {
+			return err
 		}
-		w.docWriter.processEvents(w, false, true)
-		flushSuccess = true
+	}
 
-		err = func() (err error) {
-			w.Lock()
-			defer w.Unlock()
+	// Bind a new segment name here so even with
+	// ConcurrentMergePolicy we keep deterministic segment names.
+	mergeSegmentName := w._newSegmentName()
+	si := model.NewSegmentInfo(w.directory, util.LUCENE_MAIN_VERSION,
+		mergeSegmentName, -1, false, w.codec, nil, nil)
+	setDiagnosticsAndDetails(si, SOURCE_MERGE, map[string]string{
+		"mergeMaxNumSegments": strconv.Itoa(merge.maxNumSegments),
+		"mergeFactor":         strconv.Itoa(len(merge.segments)),
+	})
+	merge.info = NewSegmentInfoPerCommit(si, 0, -1)
 
-			err = w._maybeApplyDeletes(true)
-			if err != nil {
-				return
-			}
+	// Lock order: IW -> BD
+	w.bufferedDeletesStream.prune(w.segmentInfos)
 
-			err = w.readerPool.commit(w.segmentInfos)
-			if err != nil {
-				return
-			}
+	if w.infoStream.IsEnabled("IW") {
+		w.infoStream.Message("IW", "merge seg=%v %v", merge.info.info.Name,
+			w.readerPool.segmentsToString(merge.segments))
+	}
+	return nil
+}
 
-			// Must clone the segmentInfos while we still
-			// hold fullFlushLock and while sync'd so that
-			// no partial changes (eg a delete w/o
-			// corresponding add from an updateDocument) can
-			// sneak into the commit point:
-			toCommit = w.segmentInfos.Clone()
+/*
+Does the actual (time-consuming) work of the merge, but without
+holding synchronized lock on IndexWriter instance.
+*/
+func (w *IndexWriter) mergeMiddle(merge *OneMerge) (n int, err error) {
+	if err = merge.checkAborted(w.directory); err != nil {
+		return 0, err
+	}
 
-			w.pendingCommitChangeCount = w.changeCount
+	mergedName := merge.info.info.Name
+	context := store.NewIOContextForMerge(&store.MergeInfo{
+		merge.totalDocCount, merge.estimatedMergeBytes, merge.isExternal, merge.maxNumSegments})
+	checkAbort := NewCheckAbort(merge, w.directory)
+	dirWrapper := store.NewTrackingDirectoryWrapper(w.directory)
 
-			// This protects the segmentInfos we are now going
-			// to commit.  This is important in case, eg, while
-			// we are trying to sync all referenced files, a
-			// merge completes which would otherwise have
-			// removed the files we are now syncing.
-			w.filesToCommit = toCommit.files(w.directory, false)
-			w.deleter.incRefFiles(w.filesToCommit)
-			return
-		}()
-		if err != nil {
-			return
-		}
-		success = true
-		return
-	}()
+	if w.infoStream.IsEnabled("IW") {
+		w.infoStream.Message("IW", "merging %v", w.readerPool.segmentsToString(merge.segments))
+	}
 
-	var success = false
+	merge.readers = make([]*SegmentReader, 0, len(merge.segments))
+
+	// This is try/finally to make sure merger's readers are closed:
+	success := false
 	defer func() {
+		// Readers are already closed in commitMerge if we didn't hit an
+		// error:
 		if !success {
-			func() {
-				w.Lock()
-				defer w.Unlock()
-				w.deleter.decRefFiles(w.filesToCommit)
-				w.filesToCommit = nil
-			}()
+			w.closeMergeReaders(merge, true)
 		}
 	}()
-	if anySegmentsFlushed {
-		err := w.maybeMerge(MERGE_TRIGGER_FULL_FLUSH, UNBOUNDED_MAX_MERGE_SEGMENTS)
+
+	for _, info := range merge.segments {
+		// Hold onto the "live" reader; we will use this to commit
+		// merged deletes
+		rld := w.readerPool.get(info, true)
+		reader, err := rld.getMergeReader(context)
 		if err != nil {
-			return err
+			return 0, err
 		}
-	}
-	success = true
+		assert(reader != nil)
 
-	return w.startCommit(toCommit)
-}
+		// Carefully pull the most recent live docs:
+		var liveDocs util.Bits
+		var delCount int
+		func() {
+			w.Lock() // synchronized
+			defer w.Unlock()
+			// Must sync to ensure BufferedDeletesStream cannot change
+			// liveDocs while we pull a copy:
+			liveDocs = rld.liveDocs()
+			delCount = rld.pendingDeleteCount() + info.delCount
+		}()
 
-/*
-Commits all pending changes (added & deleted documents, segment
-merges, added indexes, etc.) to the index, and syncs all referenced
-index files, such that a reader will see the changes and the index
-updates will survive an OS or machine crash or power loss. Note that
-this does not wait for any running background merges to finish. This
-may be a costly operation, so you should test the cost in your
-application and do it only when really necessary.
+		// Deletes might have happened after we pulled the merge reader
+		// and before we got a read-only copy of the segment's actual live
+		// docs (taking pending deletes into account). In that case we
+		// need to make a new reader with updated live docs and del count.
+		if reader.MaxDoc()-reader.NumDocs() != delCount {
+			// fix the reader's live docs and del count
+			assert(delCount > reader.MaxDoc()-reader.NumDocs()) // beware of zombies
+
+			newReader := newSegmentReaderWithLiveDocs(info, reader.core, liveDocs,
+				info.info.DocCount()-delCount)
+			if err = rld.release(reader); err != nil {
+				newReader.decRef()
+				return 0, err
+			}
+			reader = newReader
+		}
 
-Note that this operation calls Directory.sync on the index files.
-That call  should not return until the file contents & metadata are
-on stable storage. For FSDirectory, this calls the OS's fsync. But,
-beware: some hardware devices may in fact cache writes even during
-fsync, and return before the bits are actually on stable storage, to
-give the appearance of faster performance. If you have such a device,
-and it does not hav a battery backup (for example) then on power loss
-it may still lose data. Lucene cannot guarantee consistency on such
-devices.
+		merge.readers = append(merge.readers, reader)
+		assertn(delCount <= info.info.DocCount(), "delCount=%v info.docCount=%v rld.pendingDeleteCount=%v info.delCount=%v",
+			delCount, info.info.DocCount(), rld.pendingDeleteCount(), info.delCount)
+	}
 
-NOTE: if this method hits a memory issue, you should immediately
-close the writer.
-*/
-func (w *IndexWriter) Commit() error {
-	w.ensureOpen()
-	w.commitLock.Lock()
-	defer w.commitLock.Unlock()
-	return w.commitInternal()
-}
+	mergeReaders := make([]AtomicReader, len(merge.readers))
+	for i, r := range merge.readers {
+		mergeReaders[i] = r
+	}
 
-/*
-Assume commitLock is locked.
-*/
-func (w *IndexWriter) commitInternal() error {
-	if w.infoStream.IsEnabled("IW") {
-		w.infoStream.Message("IW", "commit: start")
+	merger := newSegmentMerger(mergeReaders, merge.info.info, w.infoStream, dirWrapper,
+		w.config.termIndexInterval, checkAbort, w.globalFieldNumberMap, context)
+
+	if err = merge.checkAborted(w.directory); err != nil {
+		return 0, err
 	}
 
-	w.ClosingControl.ensureOpen(false)
+	// This is where all the work happens:
+	var mergeState *MergeState
+	if err = func() (err error) {
+		var success3 = false
+		defer func() {
+			if !success3 {
+				w.Lock() // synchronized
+				defer w.Unlock()
+				w.deleter.refresh(merge.info.info.Name) // ignore error
+			}
+		}()
+		if !merger.shouldMerge() {
+			// would result in a 0 document segment: nothing to merge!
+			mergeState = newMergeState(nil, merge.info.info, w.infoStream, checkAbort)
+		} else if mergeState, err = merger.merge(); err != nil {
+			return err
+		}
+		success3 = true
+		return nil
+	}(); err != nil {
+		return 0, err
+	}
+	assert(mergeState.segmentInfo == merge.info.info)
+
+	files := dirWrapper.CreatedFiles()
+	merge.info.info.SetFiles(files)
 
+	// Record which codec was used to write the segment
 	if w.infoStream.IsEnabled("IW") {
-		w.infoStream.Message("IW", "commit: enter lock")
+		if merge.info.info.DocCount() == 0 {
+			w.infoStream.Message("IW", "merge away fully deleted segments")
+		} else {
+			w.infoStream.Message("IW", "merge codec=%v docCount=%v; merged segment has %v",
+				w.codec, merge.info.info.DocCount(), mergedSegmentFeatures(mergeState.fieldInfos))
+		}
 	}
 
-	if w.pendingCommit == nil {
-		if w.infoStream.IsEnabled("IW") {
-			w.infoStream.Message("IW", "commit: now prepare")
+	// Very important to do this before opening the reader because
+	// codec must know if prox was written for this segment:
+	var useCompoundFile bool
+	if err = func() (err error) {
+		w.Lock() // Guard segmentInfos
+		defer w.Unlock()
+		useCompoundFile, err = w.mergePolicy.UseCompoundFile(w.segmentInfos, merge.info)
+		return
+	}(); err != nil {
+		return 0, err
+	}
+
+	if useCompoundFile {
+		filesToRemove := merge.info.Files()
+		cfsFiles := []string{
+			util.SegmentFileName(mergedName, "", store.COMPOUND_FILE_EXTENSION),
+			util.SegmentFileName(mergedName, "", store.COMPOUND_FILE_ENTRIES_EXTENSION),
 		}
-		err := w.prepareCommitInternal()
-		if err != nil {
-			return err
+
+		if _, err = createCompoundFile(w.infoStream, w.directory, checkAbort, merge.info.info, context); err != nil {
+			if w.infoStream.IsEnabled("IW") {
+				w.infoStream.Message("IW", "hit error creating compound file during merge")
+			}
+			w.Lock() // synchronized
+			defer w.Unlock()
+			w.deleter.deleteNewFiles(cfsFiles)
+			w.deleter.deleteNewFiles(merge.info.Files())
+			if merge.isAborted() {
+				// This can happen if rollback or close(false) is called --
+				// fall through to logic below to remove the partially
+				// created CFS:
+				return 0, nil
+			}
+			return 0, err
 		}
-	} else {
-		if w.infoStream.IsEnabled("IW") {
-			w.infoStream.Message("IW", "commit: already prepared")
+
+		if aborted := func() bool {
+			w.Lock() // synchronized
+			defer w.Unlock()
+
+			// delete new non cfs files directly: they were never
+			// registered with IFD
+			w.deleter.deleteNewFiles(filesToRemove)
+
+			if merge.isAborted() {
+				if w.infoStream.IsEnabled("IW") {
+					w.infoStream.Message("IW", "abort merge after building CFS")
+				}
+				w.deleter.deleteNewFiles(cfsFiles)
+				return true
+			}
+			return false
+		}(); aborted {
+			return 0, nil
 		}
+
+		merge.info.info.SetUseCompoundFile(true)
 	}
-	return w.finishCommit()
-}
 
-func (w *IndexWriter) finishCommit() error {
-	w.Lock() // synchronized
-	defer w.Unlock()
+	// Have codec write SegmentInfo. Must do this after creating CFS so
+	// that 1) .si isn't slurped into CFS, and 2) .si reflects
+	// useCompoundFile=true change above:
+	siDir := store.NewTrackingDirectoryWrapper(w.directory)
+	if err = w.codec.SegmentInfoFormat().SegmentInfoWriter()(siDir, merge.info.info, mergeState.fieldInfos, context); err != nil {
+		w.Lock() // synchronized
+		defer w.Unlock()
+		w.deleter.deleteNewFiles(merge.info.Files())
+		return 0, err
+	}
+	files = siDir.CreatedFiles()
+	merge.info.info.AddFiles(files)
 
-	if w.pendingCommit == nil {
-		if w.infoStream.IsEnabled("IW") {
-			w.infoStream.Message("IW", "commit: pendingCommit == nil; skip")
-			w.infoStream.Message("IW", "commit: done")
+	// TODO: ideally we would freeze merge.info here!! because any
+	// changes after writing the .si will be lost...
+
+	if w.infoStream.IsEnabled("IW") {
+		if size, err := merge.info.SizeInBytes(); err == nil {
+			w.infoStream.Message("IW", "merged segment size=%.3f MB vs estimate=%.3f MB",
+				float64(size)/1024/1024, float64(merge.estimatedMergeBytes)/1024/1024)
 		}
-		return nil
 	}
 
-	defer func() {
-		// Matches the incRef done in prepareCommit:
-		w.deleter.decRefFiles(w.filesToCommit)
-		w.filesToCommit = nil
-		w.pendingCommit = nil
-		// TODO check if any wait()
-	}()
+	ok, err := w.commitMerge(merge, mergeState)
+	if err != nil || !ok {
+		// commitMerge will return false if this merge was aborted
+		return 0, err
+	}
 
-	if w.infoStream.IsEnabled("IW") {
-		w.infoStream.Message("IW", "commit: pendingCommit != nil")
+	success = true
+	return merge.info.info.DocCount(), nil
+}
+
+func mergedSegmentFeatures(infos model.FieldInfos) string {
+	var parts []string
+	if infos.HasVectors {
+		parts = append(parts, "vectors")
 	}
-	err := w.pendingCommit.finishCommit(w.directory)
-	if err != nil {
-		return err
+	if infos.HasProx {
+		parts = append(parts, "positions")
 	}
-	if w.infoStream.IsEnabled("IW") {
-		w.infoStream.Message("IW", "commit: wrote segments file '%v'", w.pendingCommit.SegmentsFileName())
+	if infos.HasFreq {
+		parts = append(parts, "freqs")
 	}
-	w.segmentInfos.updateGeneration(w.pendingCommit)
-	w.lastCommitChangeCount = w.pendingCommitChangeCount
-	w.rollbackSegments = w.pendingCommit.createBackupSegmentInfos()
-	// NOTE: don't use this.checkpoint() here, because
-	// we do not want to increment changeCount:
-	return w.deleter.checkpoint(w.pendingCommit, true)
+	if infos.HasNorms {
+		parts = append(parts, "norms")
+	}
+	if infos.HasDocValues {
+		parts = append(parts, "docValues")
+	}
+	if len(parts) == 0 {
+		return "no vectors"
+	}
+	return strings.Join(parts, " ")
 }
 
 /*
-Flush all in-memory buffered updates (adds and deletes) to the
-Directory.
+Carefully merges deletes for the segments we just merged. This is
+tricky because, although merging will clear all deletes (compacts the
+documents), new deletes may have been flushed to the segments since
+the merge was started. This method "carries over" such new deletes
+onto the newly merged segment, and saves the resulting deletes file
+(incrementing the delete generation for merge.info). If no deletes
+were flushed, no new deletes file is saved.
+
+Note: it must be called with IndexWriter locked.
 */
-func (w *IndexWriter) flush(triggerMerge bool, applyAllDeletes bool) error {
-	// NOTE: this method cannot be sync'd because
-	// maybeMerge() in turn calls mergeScheduler.merge which
-	// in turn can take a long time to run and we don't want
-	// to hold the lock for that.  In the case of
-	// ConcurrentMergeScheduler this can lead to deadlock
-	// when it stalls due to too many running merges.
+func (w *IndexWriter) _commitMergedDeletes(merge *OneMerge, mergeState *MergeState) *ReadersAndLiveDocs {
+	var minGen int64 = math.MaxInt64
 
-	// We can be called during close, when closing==true, so we must pass false to ensureOpen:
-	w.ClosingControl.ensureOpen(false)
-	ok, err := w.doFlush(applyAllDeletes)
-	if err != nil {
-		return err
+	// Lazy init (only when we find a delete to carry over):
+	var mergedDeletes *ReadersAndLiveDocs
+
+	for i, info := range merge.segments {
+		if info.bufferedDeletesGen < minGen {
+			minGen = info.bufferedDeletesGen
+		}
+		docCount := info.info.DocCount()
+		prevLiveDocs := merge.readers[i].LiveDocs()
+		rld := w.readerPool.get(info, false)
+		// We hold a ref so it should still be in the pool:
+		assertn(rld != nil, "seg=%v", info.info.Name)
+		currentLiveDocs := rld.liveDocs()
+		docMap, docBase := mergeState.docMaps[i], mergeState.docBase[i]
+
+		if currentLiveDocs == nil {
+			// No deletes before or after
+			assert(prevLiveDocs == nil)
+			continue
+		}
+		assert(currentLiveDocs.Length() == docCount)
+		assert(prevLiveDocs == nil || prevLiveDocs.Length() == docCount)
+
+		// There may have been deletes on this segment when the merge
+		// started. The merge has collapsed away those deletes, but, if
+		// new deletes were flushed since the merge started, we must now
+		// carefully keep any newly flushed deletes but mapping them to
+		// the new docIDs.
+		for j := 0; j < docCount; j++ {
+			if prevLiveDocs != nil && !prevLiveDocs.At(j) {
+				assert(!currentLiveDocs.At(j))
+				continue
+			}
+			if !currentLiveDocs.At(j) {
+				if mergedDeletes == nil {
+					mergedDeletes = w.readerPool.get(merge.info, true)
+					mergedDeletes.initWritableLiveDocs()
+				}
+				mergedDeletes.delete(docBase + docMap.get(j))
+			}
+		}
 	}
-	if ok && triggerMerge {
-		return w.maybeMerge(MERGE_TRIGGER_FULL_FLUSH, UNBOUNDED_MAX_MERGE_SEGMENTS)
+
+	if w.infoStream.IsEnabled("IW") {
+		if mergedDeletes == nil {
+			w.infoStream.Message("IW", "no new deletes since merge started")
+		} else {
+			w.infoStream.Message("IW", "%v new deletes since merge started",
+				mergedDeletes.pendingDeleteCount())
+		}
 	}
-	return nil
+
+	// If new deletes were applied while we were merging (which happens
+	// if eg commit() or getReader() is called during our merge), then
+	// it better be the case that the delGen has increased for all our
+	// merged segments:
+	merge.info.setBufferedDeletesGen(minGen)
+
+	return mergedDeletes
 }
 
-func (w *IndexWriter) doFlush(applyAllDeletes bool) (bool, error) {
-	assert2(!w.hitOOM, "this writer hit an OutOfMemoryError; cannot flush")
+func (w *IndexWriter) commitMerge(merge *OneMerge, mergeState *MergeState) (bool, error) {
+	w.Lock() // synchronized
+	defer w.Unlock()
 
-	err := w.doBeforeFlush()
-	if err != nil {
-		return false, err
-	}
-	if w.infoStream.IsEnabled("TP") {
-		w.infoStream.Message("TP", "startDoFlush")
+	assert2(!w.hitOOM, "this writer hit an OutOfMemoryError; cannot complete merge")
+
+	if w.infoStream.IsEnabled("IW") {
+		w.infoStream.Message("IW", "commitMerge: %v index=%v",
+			w.readerPool.segmentsToString(merge.segments), w.segString())
 	}
 
-	success := false
-	defer func() {
-		if !success && w.infoStream.IsEnabled("IW") {
-			w.infoStream.Message("IW", "hit error during flush")
+	assert(merge.registerDone)
+
+	// If merge was explicitly aborted, or, if rollback() or
+	// rollbackTransaction() had been called since our merge started
+	// (which results in an unqualified deleter.refresh() call that will
+	// remove any index file that current segments does not reference),
+	// we abort this merge
+	if merge.isAborted() {
+		if w.infoStream.IsEnabled("IW") {
+			w.infoStream.Message("IW", "commitMerge: skip: it was aborted")
 		}
-	}()
+		// In case we opened and pooled a reader for this segment, drop it
+		// now. This ensures that we close the reader before trying to
+		// delete any of its files.
+		err := w.readerPool.drop(merge.info)
+		w.deleter.deleteNewFiles(merge.info.Files())
+		return false, err
+	}
 
-	if w.infoStream.IsEnabled("IW") {
-		w.infoStream.Message("IW", "  start flush: applyAllDeletes=%v", applyAllDeletes)
-		w.infoStream.Message("IW", "  index before flush %v", w.segString())
+	var mergedDeletes *ReadersAndLiveDocs
+	if merge.info.info.DocCount() != 0 {
+		mergedDeletes = w._commitMergedDeletes(merge, mergeState)
 	}
+	assert(mergedDeletes == nil || mergedDeletes.pendingDeleteCount() != 0)
 
-	anySegmentFlushed, err := func() (ok bool, err error) {
-		w.fullFlushLock.Lock()
-		defer w.fullFlushLock.Unlock()
+	// If the doc store we are using has been closed and is in now
+	// compound format (but wasn't when we started), then we will switch
+	// to the compound format as well:
 
-		flushSuccess := false
-		defer func() {
-			w.docWriter.finishFullFlush(flushSuccess)
-			w.docWriter.processEvents(w, false, true)
-		}()
+	assert(w.segmentInfos.indexOf(merge.info) == -1)
 
-		if ok, err = w.docWriter.flushAllThreads(w); err == nil {
-			flushSuccess = true
+	allDeleted := len(merge.segments) == 0 ||
+		merge.info.info.DocCount() == 0 ||
+		(mergedDeletes != nil && mergedDeletes.pendingDeleteCount() == merge.info.info.DocCount())
+
+	if w.infoStream.IsEnabled("IW") && allDeleted {
+		var extra string
+		if !w.keepFullyDeletedSegments {
+			extra = "; skipping insert"
 		}
-		return
-	}()
-	if err != nil {
-		return false, err
+		w.infoStream.Message("IW", "merged segment %v is 100%% deleted%v", merge.info, extra)
 	}
 
-	err = func() error {
-		w.Lock()
-		defer w.Unlock()
-		err := w._maybeApplyDeletes(applyAllDeletes)
-		if err != nil {
-			return err
-		}
-		err = w.doAfterFlush()
-		if err != nil {
-			return err
-		}
-		if !anySegmentFlushed {
-			//flushCount is incremented in flushAllThreads
-			atomic.AddInt32(&w.flushCount, 1)
+	dropSegment := allDeleted && !w.keepFullyDeletedSegments
+
+	// If we merged no segments then we better be dropping the new
+	// segment:
+	assert(len(merge.segments) > 0 || dropSegment)
+
+	assert(merge.info.info.DocCount() != 0 || w.keepFullyDeletedSegments || dropSegment)
+
+	w.segmentInfos.applyMergeChanges(merge, dropSegment)
+
+	var err error
+	if mergedDeletes != nil {
+		if dropSegment {
+			mergedDeletes.dropChanges()
 		}
-		return nil
-	}()
+		err = w.readerPool.release(mergedDeletes)
+	}
+
+	if dropSegment {
+		assert(w.segmentInfos.indexOf(merge.info) == -1)
+		err = mergeError(err, w.readerPool.drop(merge.info))
+		w.deleter.deleteNewFiles(merge.info.Files())
+	}
+
+	// Must close before checkpoint, otherwise IFD won't be able to
+	// delete the held-open files from the merge readers:
+	err = mergeError(err, w._closeMergeReaders(merge, false))
+
+	// Must note the change to segmentInfos so any commits in-flight
+	// don't lose it (IFD will incRef/protect the new files we created):
+	err = mergeError(err, w._checkpoint())
 	if err != nil {
 		return false, err
 	}
 
-	success = true
-	return anySegmentFlushed, nil
-}
+	w.deleter.deletePendingFiles()
 
-func (w *IndexWriter) _maybeApplyDeletes(applyAllDeletes bool) error {
-	if applyAllDeletes {
-		if w.infoStream.IsEnabled("IW") {
-			w.infoStream.Message("IW", "apply all deletes during flush")
+	if w.infoStream.IsEnabled("IW") {
+		w.infoStream.Message("IW", "after commitMerge: %v", w.segString())
+	}
+
+	if merge.maxNumSegments != -1 && !dropSegment {
+		// cascade the forceMerge:
+		if _, ok := w.segmentsToMerge[merge.info]; !ok {
+			w.segmentsToMerge[merge.info] = false
 		}
-		return w._applyAllDeletes()
-	} else if w.infoStream.IsEnabled("IW") {
-		w.infoStream.Message("IW", "don't apply deletes now delTermCount=%v bytesUsed=%v",
-			atomic.LoadInt32(&w.bufferedDeletesStream.numTerms),
-			atomic.LoadInt64(&w.bufferedDeletesStream.bytesUsed))
 	}
-	return nil
+
+	return true, nil
 }
 
-func (w *IndexWriter) applyAllDeletes() error {
+func (w *IndexWriter) closeMergeReaders(merge *OneMerge, suppressErrors bool) error {
 	w.Lock() // synchronized
 	defer w.Unlock()
-	return w._applyAllDeletes()
+	return w._closeMergeReaders(merge, suppressErrors)
 }
 
-func (w *IndexWriter) _applyAllDeletes() error {
-	atomic.AddInt32(&w.flushDeletesCount, 1)
-	result, err := w.bufferedDeletesStream.applyDeletes(w.readerPool, w.segmentInfos.Segments)
-	if err != nil {
-		return err
-	}
-	if result.anyDeletes {
-		err = w.checkpoint()
-		if err != nil {
-			return err
-		}
-	}
-	if !w.keepFullyDeletedSegments && result.allDeleted != nil {
-		if w.infoStream.IsEnabled("IW") {
-			w.infoStream.Message("IW", "drop 100%% deleted segments: %v",
-				w.readerPool.segmentsToString(result.allDeleted))
+func (w *IndexWriter) _closeMergeReaders(merge *OneMerge, suppressErrors bool) (err error) {
+	drop := !suppressErrors
+	for i, sr := range merge.readers {
+		if sr == nil {
+			continue
 		}
-		for _, info := range result.allDeleted {
-			// If a merge has already registered for this segment, we leave
-			// it in the readerPool; the merge will skip merging it and
-			// will then drop it once it's done:
-			if _, ok := w.mergingSegments[info]; !ok {
-				w.segmentInfos.remove(info)
-				err = w.readerPool.drop(info)
-				if err != nil {
-					return err
-				}
-			}
+		rld := w.readerPool.get(sr.si, false)
+		// We still hold a ref so it should not have been removed:
+		assert(rld != nil)
+		if drop {
+			rld.dropChanges()
 		}
-		err = w.checkpoint()
-		if err != nil {
-			return err
+		err = mergeError(err, rld.release(sr))
+		err = mergeError(err, w.readerPool.release(rld))
+		if drop {
+			err = mergeError(err, w.readerPool.drop(rld.info))
 		}
+		merge.readers[i] = nil
 	}
-	w.bufferedDeletesStream.prune(w.segmentInfos)
-	return nil
-}
 
-// L3440
-/*
-Merges the indicated segments, replacing them in the stack with a
-single segment.
-*/
-func (w *IndexWriter) merge(merge *OneMerge) error {
-	panic("not implemented yet")
+	if suppressErrors {
+		return nil
+	}
+	return err
 }
 
 func setDiagnostics(info *model.SegmentInfo, source string) {
@@ -1277,7 +3037,18 @@ func setDiagnostics(info *model.SegmentInfo, source string) {
 }
 
 func setDiagnosticsAndDetails(info *model.SegmentInfo, source string, details map[string]string) {
-	panic("not implemented yet")
+	diagnostics := map[string]string{
+		SOURCE:           source,
+		"lucene.version": util.LUCENE_VERSION,
+		"os":             util.OS_NAME,
+		"os.arch":        util.OS_ARCH,
+		"go.version":     util.GO_VERSION,
+		"timestamp":      strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10),
+	}
+	for k, v := range details {
+		diagnostics[k] = v
+	}
+	info.SetDiagnostics(diagnostics)
 }
 
 // Returns a string description of all segments, for debugging.
@@ -1335,7 +3106,7 @@ func (w *IndexWriter) startCommit(toSync *SegmentInfos) error {
 		w.infoStream.Message("IW", "startCommit(): start")
 	}
 
-	func() {
+	if skip := func() bool {
 		w.Lock()
 		defer w.Unlock()
 
@@ -1347,7 +3118,7 @@ func (w *IndexWriter) startCommit(toSync *SegmentInfos) error {
 			}
 			w.deleter.decRefFiles(w.filesToCommit)
 			w.filesToCommit = nil
-			return
+			return true
 		}
 
 		if w.infoStream.IsEnabled("IW") {
@@ -1356,7 +3127,10 @@ func (w *IndexWriter) startCommit(toSync *SegmentInfos) error {
 		}
 
 		w.assertFilesExist(toSync)
-	}()
+		return false
+	}(); skip {
+		return nil
+	}
 
 	w.testPoint("midStartCommit")
 
@@ -1464,14 +3238,59 @@ func createCompoundFile(infoStream util.InfoStream,
 	checkAbort *CheckAbort,
 	info *model.SegmentInfo,
 	context store.IOContext) (names []string, err error) {
-	panic("not implemented yet")
+
+	fileName := util.SegmentFileName(info.Name, "", store.COMPOUND_FILE_EXTENSION)
+	if infoStream.IsEnabled("IW") {
+		infoStream.Message("IW", "create compound file %v", fileName)
+	}
+	// Now merge all added files
+	files := info.Files()
+	cfsDir, err := store.NewCompoundFileDirectory(directory, fileName, context, true)
+	if err != nil {
+		return nil, err
+	}
+	func() {
+		defer func() {
+			if err = util.CloseWhileHandlingError(err, cfsDir); err != nil {
+				directory.DeleteFile(fileName) // ignore error
+				directory.DeleteFile(util.SegmentFileName(info.Name, "", store.COMPOUND_FILE_ENTRIES_EXTENSION))
+			}
+		}()
+		for file, _ := range files {
+			if err = directory.Copy(cfsDir, file, file, context); err != nil {
+				return
+			}
+			var length int64
+			if length, err = directory.FileLength(file); err != nil {
+				return
+			}
+			if err = checkAbort.work(float64(length)); err != nil {
+				return
+			}
+		}
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	for file, _ := range files {
+		names = append(names, file)
+	}
+
+	// Replace all previous files with the CFS/CFE files:
+	info.SetFiles(map[string]bool{
+		fileName: true,
+		util.SegmentFileName(info.Name, "", store.COMPOUND_FILE_ENTRIES_EXTENSION): true,
+	})
+	return names, nil
 }
 
 // Tries to delete the given files if unreferenced.
 func (w *IndexWriter) deleteNewFiles(files []string) error {
 	w.Lock() // synchronized
 	defer w.Unlock()
-	panic("not implemented yet")
+	w.deleter.deleteNewFiles(files)
+	return nil
 }
 
 /* Cleans up residuals from a segment that could not be entirely flushed due to an error */
@@ -1481,12 +3300,56 @@ func (w *IndexWriter) flushFailed(info *model.SegmentInfo) error {
 	return w.deleter.refresh(info.Name)
 }
 
-func (w *IndexWriter) purge(forced bool) (n int, err error) {
-	panic("not implemented yet")
+func (w *IndexWriter) nrtIsCurrent(infos *SegmentInfos) bool {
+	w.Lock() // synchronized
+	defer w.Unlock()
+	w.ensureOpen()
+	if w.infoStream.IsEnabled("IW") {
+		w.infoStream.Message("IW", "nrtIsCurrent: infoVersion matches: %v; DW changes: %v; BD changes: %v",
+			infos.version == w.segmentInfos.version, w.docWriter.anyChanges(), w.bufferedDeletesStream.any())
+	}
+	return infos.version == w.segmentInfos.version &&
+		!w.docWriter.anyChanges() && !w.bufferedDeletesStream.any()
+}
+
+func (w *IndexWriter) isClosed() bool {
+	return w.ClosingControl._closed
+}
+
+/* Returns true if this IndexWriter is neither closed nor closing. */
+func (w *IndexWriter) IsOpen() bool {
+	return !w.ClosingControl._closed && !w.ClosingControl._closing
+}
+
+// Must be called with the IndexWriter locked.
+func (w *IndexWriter) _incRefDeleter(segmentInfos *SegmentInfos) {
+	w.ensureOpen()
+	w.deleter.incRef(segmentInfos, false)
+}
+
+func (w *IndexWriter) decRefDeleter(segmentInfos *SegmentInfos) {
+	w.Lock() // synchronized
+	defer w.Unlock()
+	w.ensureOpen()
+	w.deleter.decRefInfos(segmentInfos)
+}
+
+func (w *IndexWriter) applyDeletesAndPurge(forcePurge bool) error {
+	defer atomic.AddInt32(&w.flushCount, 1)
+	_, err := w.purge(forcePurge)
+	return mergeError(err, w.applyAllDeletes())
 }
 
 func (w *IndexWriter) doAfterSegmentFlushed(triggerMerge bool, forcePurge bool) error {
-	panic("not implemented yet")
+	_, err := w.purge(forcePurge)
+	if triggerMerge {
+		err = mergeError(err, w.maybeMerge(MERGE_TRIGGER_SEGMENT_FLUSH, UNBOUNDED_MAX_MERGE_SEGMENTS))
+	}
+	return err
+}
+
+func (w *IndexWriter) purge(forced bool) (n int, err error) {
+	return w.docWriter.purgeBuffer(w, forced)
 }
 
 /*
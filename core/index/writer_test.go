@@ -0,0 +1,847 @@
+package index
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/balzaczyy/golucene/core/index/model"
+	"github.com/balzaczyy/golucene/core/store"
+	"github.com/balzaczyy/golucene/core/util"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Norm values don't matter to these tests, and search.DefaultSimilarity
+// can't be imported here.
+type noopSimilarity struct{}
+
+func (s noopSimilarity) ComputeNorm(fs *FieldInvertState) int64 { return 0 }
+
+func init() {
+	if DefaultSimilarity == nil {
+		DefaultSimilarity = func() Similarity { return noopSimilarity{} }
+	}
+}
+
+func TestAddIndexes(t *testing.T) {
+	for _, path := range []string{
+		"../search/testdata/belfrysample",     // plain segment
+		"../search/testdata/osx/belfrysample", // compound file segment
+	} {
+		src, err := store.OpenFSDirectory(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := OpenDirectoryReader(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		numDocs := r.NumDocs()
+		r.Close()
+
+		d := store.NewRAMDirectory()
+		w, err := NewIndexWriter(d, NewIndexWriterConfig(util.VERSION_45, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = w.AddIndexes(d); err == nil {
+			t.Error("Should not add directory to itself.")
+		}
+		if err = w.AddIndexes(src, src); err == nil {
+			t.Error("Should not add the same directory twice.")
+		}
+		if err = w.AddIndexes(src); err != nil {
+			t.Fatal(err)
+		}
+		if src.FileExists(WRITE_LOCK_NAME) {
+			t.Errorf("Write lock of %v should have been released.", path)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err = OpenDirectoryReader(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := r.NumDocs(); n != numDocs {
+			t.Errorf("Expected %v docs after AddIndexes(%v), got %v", numDocs, path, n)
+		}
+		r.Close()
+	}
+}
+
+func TestAddIndexesFileSwitch(t *testing.T) {
+	src, err := store.OpenFSDirectory("../search/testdata/belfrysample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	// postings and term dictionary on one side, the rest on the other
+	primary, secondary := store.NewRAMDirectory(), store.NewRAMDirectory()
+	d := store.NewFileSwitchDirectory(map[string]bool{
+		"tim": true, "tip": true, "doc": true, "pos": true, "pay": true,
+	}, primary, secondary, true)
+	defer d.Close()
+	conf := NewIndexWriterConfig(util.VERSION_45, nil)
+	conf.SetUseCompoundFile(false)
+	w, err := NewIndexWriter(d, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.AddIndexes(src); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := primary.ListAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if ext := store.FileExtension(name); ext != "tim" && ext != "tip" && ext != "doc" && ext != "pos" && ext != "pay" {
+			t.Errorf("%v should not be stored in the primary directory", name)
+		}
+	}
+	if len(names) == 0 {
+		t.Error("postings should be stored in the primary directory")
+	}
+
+	r, err := OpenDirectoryReader(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if r.NumDocs() == 0 {
+		t.Error("expected documents in the index")
+	}
+}
+
+func TestAddIndexesEncrypted(t *testing.T) {
+	for _, path := range []string{
+		"../search/testdata/belfrysample",
+		"../search/testdata/osx/belfrysample",
+	} {
+		src, err := store.OpenFSDirectory(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw := store.NewRAMDirectory()
+		d := store.NewEncryptedDirectory(raw,
+			store.NewStaticKeyProvider([]byte("0123456789abcdef")))
+		w, err := NewIndexWriter(d, NewIndexWriterConfig(util.VERSION_45, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = w.AddIndexes(src); err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		src.Close()
+
+		var buf bytes.Buffer
+		if status := NewCheckIndex(d, true, &buf).CheckIndex(nil); !status.Clean {
+			t.Fatalf("%v: index is not clean:\n%v", path, buf.String())
+		}
+		// without the key, the index can't even be listed as one
+		if _, err = OpenDirectoryReader(raw); err == nil {
+			t.Errorf("%v: encrypted index should not be readable without the key", path)
+		}
+	}
+}
+
+func TestAddIndexesObjectStore(t *testing.T) {
+	path, err := ioutil.TempDir("", "golucene")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+	blobs, err := store.NewFSBlobStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := store.OpenFSDirectory("../search/testdata/osx/belfrysample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	d := store.NewObjectStoreDirectory(blobs, "")
+	w, err := NewIndexWriter(d, NewIndexWriterConfig(util.VERSION_45, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.AddIndexes(src); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// searches read through a block cache
+	cached := store.NewBlockCacheDirectory(store.NewObjectStoreDirectory(blobs, ""),
+		store.BLOCK_CACHE_DEFAULT_BLOCK_SIZE, 1)
+	var buf bytes.Buffer
+	if status := NewCheckIndex(cached, true, &buf).CheckIndex(nil); !status.Clean {
+		t.Fatalf("index is not clean:\n%v", buf.String())
+	}
+}
+
+func TestCreateCompoundFile(t *testing.T) {
+	dir := store.NewRAMDirectory()
+	trackingDir := store.NewTrackingDirectoryWrapper(dir)
+	codec := LoadCodec("Lucene42")
+	info := model.NewSegmentInfo(dir, util.LUCENE_MAIN_VERSION, "_0", flushTestNumDocs, false, codec, nil, nil)
+	fieldInfos := flushTestPostings(t, trackingDir, info)
+
+	files := trackingDir.CreatedFiles()
+	info.SetFiles(files)
+
+	names, err := createCompoundFile(util.NO_OUTPUT, dir, CHECK_ABORT_NONE, info, store.IO_CONTEXT_DEFAULT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != len(files) {
+		t.Errorf("Expected %v files to be packed, but found %v", len(files), names)
+	}
+	if n := len(info.Files()); n != 2 || !info.Files()["_0.cfs"] || !info.Files()["_0.cfe"] {
+		t.Errorf("Segment should only reference the compound files, but found %v", info.Files())
+	}
+
+	cfsDir, err := store.NewCompoundFileDirectory(dir, "_0.cfs", store.IO_CONTEXT_READ, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfsDir.Close()
+	fields, err := codec.PostingsFormat().FieldsProducer(newSegmentReadState(
+		cfsDir, info, fieldInfos, store.IO_CONTEXT_READ, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fields.Close()
+
+	termsEnum := fields.Terms("body").Iterator(nil)
+	if ok, err := termsEnum.SeekExact([]byte("t042")); err != nil || !ok {
+		t.Fatalf("Term 't042' should be found: %v", err)
+	}
+	if df, _ := termsEnum.DocFreq(); df != 3 {
+		t.Errorf("Term 't042' should have docFreq 3, but found %v", df)
+	}
+}
+
+func addSample(t *testing.T, w *IndexWriter, path string) {
+	src, err := store.OpenFSDirectory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if err = w.AddIndexes(src); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCommitData(t *testing.T) {
+	d := store.NewRAMDirectory()
+	w, err := NewIndexWriter(d, NewIndexWriterConfig(util.VERSION_45, nil).
+		SetIndexDeletionPolicy(NO_DELETION_POLICY))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var _ TwoPhaseCommit = w
+
+	for i, path := range []string{
+		"../search/testdata/belfrysample",
+		"../search/testdata/osx/belfrysample",
+	} {
+		addSample(t, w, path)
+		data := map[string]string{"offset": fmt.Sprintf("%v", i)}
+		w.SetCommitData(data)
+		data["offset"] = "changed" // cloned
+		if err = w.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// commit data alone is a change
+	w.SetCommitData(map[string]string{"offset": "2"})
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	commits, err := ListCommits(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 3 {
+		t.Fatalf("expected 3 commits, got %v", commits)
+	}
+	for i, commit := range commits {
+		if offset := commit.UserData()["offset"]; offset != fmt.Sprintf("%v", i) {
+			t.Errorf("expected offset %v in %v, got '%v'", i, commit, offset)
+		}
+		r, err := OpenDirectoryReaderAtCommit(commit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := r.NumDocs(); n != 8*(1+i%2+i/2) {
+			t.Errorf("expected %v docs at %v, got %v", 8*(1+i%2+i/2), commit, n)
+		}
+		r.Close()
+	}
+
+	// the data of the last commit is loaded by new writers
+	w, err = NewIndexWriter(d, NewIndexWriterConfig(util.VERSION_45, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if offset := w.CommitData()["offset"]; offset != "2" {
+		t.Errorf("expected offset 2, got '%v'", offset)
+	}
+}
+
+func TestPrepareCommitRollback(t *testing.T) {
+	d := store.NewRAMDirectory()
+	w, err := NewIndexWriter(d, NewIndexWriterConfig(util.VERSION_45, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addSample(t, w, "../search/testdata/belfrysample")
+	w.SetCommitData(map[string]string{"offset": "1"})
+	if err = w.PrepareCommit(); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	addSample(t, w, "../search/testdata/osx/belfrysample")
+	w.SetCommitData(map[string]string{"offset": "2"})
+	if err = w.PrepareCommit(); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	commits, err := ListCommits(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 1 || commits[0].UserData()["offset"] != "1" {
+		t.Errorf("expected only the first commit, got %v", commits)
+	}
+	r, err := OpenDirectoryReader(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if n := r.NumDocs(); n != 8 {
+		t.Errorf("expected 8 docs after rollback, got %v", n)
+	}
+	files, err := d.ListAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range files {
+		if strings.HasPrefix(name, "_1") {
+			t.Errorf("%v of the rolled back segment was not deleted", name)
+		}
+	}
+	if d.FileExists(WRITE_LOCK_NAME) {
+		t.Error("write lock should be released by rollback")
+	}
+}
+
+// Checks the committed index in d holds numDocs of maxDoc docs, and is clean.
+func checkCommitted(t *testing.T, d store.Directory, numDocs, maxDoc int) {
+	r, err := OpenDirectoryReader(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if r.NumDocs() != numDocs || r.MaxDoc() != maxDoc {
+		t.Errorf("expected %v of %v docs, got %v of %v", numDocs, maxDoc, r.NumDocs(), r.MaxDoc())
+	}
+	var buf bytes.Buffer
+	if status := NewCheckIndex(d, true, &buf).CheckIndex(nil); !status.Clean {
+		t.Errorf("index is not clean:\n%v", buf.String())
+	}
+}
+
+func TestDeleteDocuments(t *testing.T) {
+	d := store.NewRAMDirectory()
+	w, err := NewIndexWriter(d, NewIndexWriterConfig(util.VERSION_45, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	addSample(t, w, "../search/testdata/belfrysample")
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	your := NewTerm("title", "your")
+	if err = w.DeleteDocuments(&your); err != nil {
+		t.Fatal(err)
+	}
+	checkCommitted(t, d, 8, 8) // not visible before commit
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	checkCommitted(t, d, 5, 8)
+	if !d.FileExists("_0_1.del") {
+		t.Error("expected deletes written to _0_1.del")
+	}
+
+	// deleting again changes nothing
+	if err = w.DeleteDocuments(&your); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	checkCommitted(t, d, 5, 8)
+
+	// a fully deleted segment is dropped
+	bat := NewTerm("title", "bat")
+	if err = w.DeleteDocuments(&bat); err != nil {
+		t.Fatal(err)
+	}
+	addSample(t, w, "../search/testdata/osx/belfrysample")
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	checkCommitted(t, d, 8, 8)
+	infos := &SegmentInfos{}
+	if err = infos.ReadAll(d); err != nil {
+		t.Fatal(err)
+	}
+	if len(infos.Segments) != 1 || infos.Segments[0].info.Name != "_1" {
+		t.Fatalf("expected only _1 left, got %v", infos.Segments)
+	}
+	files, err := d.ListAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range files {
+		if strings.HasPrefix(name, "_0") {
+			t.Errorf("%v of the dropped segment was not deleted", name)
+		}
+	}
+}
+
+// Stands in for search.TermQuery, which this package can't import.
+type testTermQuery struct {
+	term Term
+}
+
+func testQueryDocIdSetIterator(q Query, ctx *AtomicReaderContext,
+	acceptDocs util.Bits) (DocIdSetIterator, error) {
+	term := q.(*testTermQuery).term
+	terms := ctx.reader.Fields().Terms(term.Field)
+	if terms == nil {
+		return nil, nil
+	}
+	termsEnum := terms.Iterator(nil)
+	if ok, err := termsEnum.SeekExact(term.Bytes); err != nil || !ok {
+		return nil, err
+	}
+	return termsEnum.Docs(acceptDocs, nil)
+}
+
+func TestDeleteDocumentsByQuery(t *testing.T) {
+	if QueryDocIdSetIterator == nil {
+		QueryDocIdSetIterator = testQueryDocIdSetIterator
+		defer func() { QueryDocIdSetIterator = nil }()
+	}
+
+	d := store.NewRAMDirectory()
+	w, err := NewIndexWriter(d, NewIndexWriterConfig(util.VERSION_45, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	addSample(t, w, "../search/testdata/belfrysample")
+	addSample(t, w, "../search/testdata/osx/belfrysample")
+	if err = w.DeleteDocumentsByQuery(
+		&testTermQuery{NewTerm("title", "your")},
+		&testTermQuery{NewTerm("title", "sonar")},
+		&testTermQuery{NewTerm("title", "absent")}); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	checkCommitted(t, d, 8, 16)
+}
+
+func TestDeleteAll(t *testing.T) {
+	d := store.NewRAMDirectory()
+	w, err := NewIndexWriter(d, NewIndexWriterConfig(util.VERSION_45, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	addSample(t, w, "../search/testdata/belfrysample")
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	addSample(t, w, "../search/testdata/osx/belfrysample")
+	if err = w.DeleteAll(); err != nil {
+		t.Fatal(err)
+	}
+	checkCommitted(t, d, 8, 8) // not visible before commit
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	checkCommitted(t, d, 0, 0)
+	files, err := d.ListAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range files {
+		if strings.HasPrefix(name, "_") {
+			t.Errorf("%v was not deleted", name)
+		}
+	}
+
+	// the writer can be used afterwards
+	addSample(t, w, "../search/testdata/win8/belfrysample")
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	checkCommitted(t, d, 8, 8)
+}
+
+/* Returns the global docIDs the query matches in r. */
+func testSearch(t *testing.T, r IndexReader, q Query) []int {
+	var hits []int
+	for _, ctx := range r.Leaves() {
+		it, err := testQueryDocIdSetIterator(q, &ctx, ctx.reader.LiveDocs())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if it == nil {
+			continue
+		}
+		for {
+			docID, err := it.NextDoc()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if docID == NO_MORE_DOCS {
+				break
+			}
+			hits = append(hits, ctx.DocBase+docID)
+		}
+	}
+	return hits
+}
+
+func TestAddDocument(t *testing.T) {
+	// indexed as a single token, with norms and positions
+	titleType := NewFieldTypeFrom(STRING_FIELD_TYPE_STORED)
+	titleType._tokenized = false
+	titleType._omitNorms = false
+	titleType._indexOptions = model.INDEX_OPT_DOCS_AND_FREQS_AND_POSITIONS
+
+	d := store.NewRAMDirectory()
+	w, err := NewIndexWriter(d, NewIndexWriterConfig(util.VERSION_45, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	for i, title := range []string{"red", "green", "blue", "green"} {
+		if err = w.AddDocument([]IndexableField{
+			NewStringField("id", fmt.Sprintf("doc%v", i), STRING_FIELD_TYPE_STORED),
+			NewStringField("title", title, titleType),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a block, one field of which is only stored
+	storedOnly := NewFieldTypeFrom(STRING_FIELD_TYPE_STORED)
+	storedOnly.indexed = false
+	if err = w.AddDocuments([][]IndexableField{
+		{NewStringField("id", "doc4", STRING_FIELD_TYPE_STORED), NewStringField("note", "n4", storedOnly)},
+		{NewStringField("id", "doc5", STRING_FIELD_TYPE_NOT_STORED)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	checkCommitted(t, d, 6, 6)
+
+	r, err := OpenDirectoryReader(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if hits := testSearch(t, r, &testTermQuery{NewTerm("title", "green")}); fmt.Sprint(hits) != "[1 3]" {
+		t.Errorf("title:green should match docs [1 3], but found %v", hits)
+	}
+	if hits := testSearch(t, r, &testTermQuery{NewTerm("id", "doc5")}); fmt.Sprint(hits) != "[5]" {
+		t.Errorf("id:doc5 should match doc 5, but found %v", hits)
+	}
+	if hits := testSearch(t, r, &testTermQuery{NewTerm("title", "yellow")}); len(hits) != 0 {
+		t.Errorf("title:yellow should match nothing, but found %v", hits)
+	}
+	if hits := testSearch(t, r, &testTermQuery{NewTerm("note", "n4")}); len(hits) != 0 {
+		t.Errorf("stored-only field should not be indexed, but found %v", hits)
+	}
+
+	for docID, expected := range []string{"doc0", "doc1", "doc2", "doc3", "doc4", ""} {
+		doc, err := r.Document(docID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id := doc.Get("id"); id != expected {
+			t.Errorf("doc %v should have stored id %q, but found %q", docID, expected, id)
+		}
+	}
+	doc, err := r.Document(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title := doc.Get("title"); title != "blue" {
+		t.Errorf("doc 2 should have stored title 'blue', but found %q", title)
+	}
+	if doc, err = r.Document(4); err != nil {
+		t.Fatal(err)
+	}
+	if note := doc.Get("note"); note != "n4" {
+		t.Errorf("doc 4 should have stored note 'n4', but found %q", note)
+	}
+}
+
+func TestFlushCompoundFile(t *testing.T) {
+	d := store.NewRAMDirectory()
+	w, err := NewIndexWriter(d, NewIndexWriterConfig(util.VERSION_45, nil).SetUseCompoundFile(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	for i := 0; i < 3; i++ {
+		if err = w.AddDocument([]IndexableField{
+			NewStringField("id", fmt.Sprintf("doc%v", i), STRING_FIELD_TYPE_STORED),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	checkCommitted(t, d, 3, 3)
+
+	var sis SegmentInfos
+	if err = sis.ReadAll(d); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(sis.Segments); n != 1 {
+		t.Fatalf("Expected 1 segment, got %v", n)
+	}
+	info := sis.Segments[0].info
+	if !info.IsCompoundFile() {
+		t.Fatalf("Flushed segment %v should use a compound file", info.Name)
+	}
+	// only the .si is left beside the compound files
+	names, err := d.ListAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if strings.HasPrefix(name, info.Name+".") || strings.HasPrefix(name, info.Name+"_") {
+			switch name[len(info.Name)+1:] {
+			case "si", "cfs", "cfe":
+			default:
+				t.Errorf("%v should be packed into the compound file", name)
+			}
+		}
+	}
+
+	cfsDir, err := store.NewCompoundFileDirectory(d, info.Name+".cfs", store.IO_CONTEXT_READ, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfsDir.Close()
+	for _, name := range []string{info.Name + ".fdt", info.Name + ".fdx", info.Name + ".fnm"} {
+		if !cfsDir.FileExists(name) {
+			t.Errorf("%v should be in the compound file", name)
+		}
+	}
+
+	r, err := OpenDirectoryReader(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if hits := testSearch(t, r, &testTermQuery{NewTerm("id", "doc1")}); fmt.Sprint(hits) != "[1]" {
+		t.Errorf("id:doc1 should match doc 1, but found %v", hits)
+	}
+	doc, err := r.Document(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := doc.Get("id"); id != "doc2" {
+		t.Errorf("doc 2 should have stored id 'doc2', but found %q", id)
+	}
+}
+
+/*
+Runs merges in a background routine, each only after a delay, so
+that they are still running when the test goes on.
+*/
+type delayedMergeScheduler struct {
+	started chan bool
+}
+
+func (ms *delayedMergeScheduler) Merge(w *IndexWriter) error {
+	go func() {
+		for merge := w.nextMerge(); merge != nil; merge = w.nextMerge() {
+			select {
+			case ms.started <- true:
+			default:
+			}
+			time.Sleep(50 * time.Millisecond)
+			w.merge(merge) // aborted by the test
+		}
+	}()
+	return nil
+}
+
+func (ms *delayedMergeScheduler) Clone() MergeScheduler {
+	return &delayedMergeScheduler{make(chan bool, 1)}
+}
+
+func (ms *delayedMergeScheduler) Close() error { return nil }
+
+func TestDeleteAllWhileMerging(t *testing.T) {
+	d := store.NewRAMDirectory()
+	ms := &delayedMergeScheduler{make(chan bool, 1)}
+	w, err := NewIndexWriter(d, NewIndexWriterConfig(util.VERSION_45, nil).SetMergeScheduler(ms))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	addSample(t, w, "../search/testdata/belfrysample")
+	addSample(t, w, "../search/testdata/osx/belfrysample")
+	if err = w.ForceMergeAndWait(1, false); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ms.started:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the merge was not started")
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- w.DeleteAll() }()
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("DeleteAll should not deadlock with a running merge")
+	}
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	checkCommitted(t, d, 0, 0)
+}
+
+func lastGeneration(t *testing.T, d store.Directory) int64 {
+	infos := &SegmentInfos{}
+	if err := infos.ReadAll(d); err != nil {
+		t.Fatal(err)
+	}
+	return infos.generation
+}
+
+func TestCommitNoChanges(t *testing.T) {
+	d := store.NewRAMDirectory()
+	w, err := NewIndexWriter(d, NewIndexWriterConfig(util.VERSION_45, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := store.OpenFSDirectory("../search/testdata/belfrysample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if err = w.AddIndexes(src); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	gen := lastGeneration(t, d)
+
+	// nothing changed: no new commit is written
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.PrepareCommit(); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if g := lastGeneration(t, d); g != gen {
+		t.Errorf("expected generation %v without changes, got %v", gen, g)
+	}
+
+	// changes are still committed afterwards
+	osx, err := store.OpenFSDirectory("../search/testdata/osx/belfrysample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer osx.Close()
+	if err = w.AddIndexes(osx); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if gen++; lastGeneration(t, d) != gen {
+		t.Errorf("expected generation %v after changes, got %v", gen, lastGeneration(t, d))
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if g := lastGeneration(t, d); g != gen {
+		t.Errorf("expected generation %v after close without changes, got %v", gen, g)
+	}
+	if commits, err := ListCommits(d); err != nil || len(commits) != 1 {
+		t.Errorf("expected only the last commit kept, got %v (%v)", commits, err)
+	}
+
+	// OPEN_MODE_CREATE replaces the index
+	if w, err = NewIndexWriter(d, NewIndexWriterConfig(util.VERSION_45, nil).
+		SetOpenMode(OPEN_MODE_CREATE)); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := OpenDirectoryReader(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if r.NumDocs() != 0 || r.MaxDoc() != 0 {
+		t.Errorf("expected an empty index, got %v of %v docs", r.NumDocs(), r.MaxDoc())
+	}
+}
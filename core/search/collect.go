@@ -290,6 +290,7 @@ func (c *InOrderTopScoreDocCollector) Collect(doc int) (err error) {
 	c.pqTop.Score = float32(score)
 	heap.Pop(c.pq)
 	heap.Push(c.pq, c.pqTop)
+	c.pqTop = c.pq.items[0].(ScoreDoc) // the new least competitive hit
 	return
 }
 
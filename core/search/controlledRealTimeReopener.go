@@ -0,0 +1,230 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/balzaczyy/golucene/core/index"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// search/ControlledRealTimeReopenThread.java
+
+/*
+Utility goroutine to periodically reopen a ReferenceManager, with
+methods to wait for a specific index changes to become visible. To
+use this class you must first wrap your IndexWriter with a
+TrackingIndexWriter and always use it to make changes to the index,
+saving the returned generation. Then, when a given search request
+needs to see a specific index change, call the WaitForGeneration() to
+wait for that change to be visible. Note that this will only scale
+well if most searches do not need to wait for a specific index
+generation.
+*/
+type ControlledRealTimeReopener struct {
+	sync.Locker // synchronized
+
+	manager          *ReferenceManager
+	targetMaxStale   time.Duration
+	targetMinStale   time.Duration
+	writer           *index.TrackingIndexWriter
+	waitingGen       int64
+	searchingGen     int64
+	refreshStartGen  int64
+	finish           bool
+	searchingChanged chan struct{} // closed and replaced on refresh
+
+	reopenCond chan struct{} // wakes up the reopen goroutine
+	done       chan struct{}
+}
+
+/*
+Create ControlledRealTimeReopener, to periodically reopen the a
+ReferenceManager.
+
+targetMaxStale is the maximum time until a new reader must be opened;
+this sets the upper bound on how slowly reopens may occur, when no
+caller is waiting for a specific generation to become visible.
+
+targetMinStale is the mininum time until a new reader can be opened;
+this sets the lower bound on how quickly reopens may occur, when a
+caller is waiting for a specific generation to become visible.
+
+The reopen goroutine is started right away; call Close() to stop it.
+*/
+func NewControlledRealTimeReopener(writer *index.TrackingIndexWriter,
+	manager *ReferenceManager, targetMaxStale, targetMinStale time.Duration) (*ControlledRealTimeReopener, error) {
+	if targetMaxStale < targetMinStale {
+		return nil, errors.New(fmt.Sprintf(
+			"targetMaxStale (= %v) must be >= targetMinStale (=%v)",
+			targetMaxStale, targetMinStale))
+	}
+	ans := &ControlledRealTimeReopener{
+		Locker:           &sync.Mutex{},
+		manager:          manager,
+		targetMaxStale:   targetMaxStale,
+		targetMinStale:   targetMinStale,
+		writer:           writer,
+		searchingChanged: make(chan struct{}),
+		reopenCond:       make(chan struct{}, 1),
+		done:             make(chan struct{}),
+	}
+	manager.AddListener(ans)
+	go ans.run()
+	return ans, nil
+}
+
+func (r *ControlledRealTimeReopener) BeforeRefresh() error { return nil }
+
+func (r *ControlledRealTimeReopener) AfterRefresh(didRefresh bool) error {
+	r.refreshDone()
+	return nil
+}
+
+func (r *ControlledRealTimeReopener) refreshDone() {
+	r.Lock() // synchronized
+	defer r.Unlock()
+	r.searchingGen = r.refreshStartGen
+	r._notifyAll()
+}
+
+// Wakes up all goroutines waiting in WaitForGeneration()
+func (r *ControlledRealTimeReopener) _notifyAll() {
+	close(r.searchingChanged)
+	r.searchingChanged = make(chan struct{})
+}
+
+// Signals the reopen goroutine, without blocking.
+func (r *ControlledRealTimeReopener) signalReopen() {
+	select {
+	case r.reopenCond <- struct{}{}:
+	default: // already signaled
+	}
+}
+
+// Stops the reopen goroutine and releases all waiting callers.
+func (r *ControlledRealTimeReopener) Close() error {
+	r.Lock()
+	if r.finish {
+		r.Unlock()
+		return nil
+	}
+	r.finish = true
+	r.Unlock()
+
+	r.signalReopen()
+	<-r.done
+
+	r.Lock() // synchronized
+	defer r.Unlock()
+	r.manager.RemoveListener(r)
+	// Max it out so any waiting search goroutines will return:
+	r.searchingGen = math.MaxInt64
+	r._notifyAll()
+	return nil
+}
+
+/*
+Waits for the target generation to become visible in the searcher.
+If the current searcher is older than the target generation, this
+method will block until the searcher is reopened, by another
+goroutine via MaybeRefresh() or until the ReferenceManager is closed,
+or the provided context is done, in which case the context's error
+is returned.
+
+targetGen is the generation to wait for, as returned by the
+TrackingIndexWriter.
+*/
+func (r *ControlledRealTimeReopener) WaitForGeneration(ctx context.Context, targetGen int64) error {
+	curGen := r.writer.Generation()
+	if targetGen > curGen {
+		return errors.New(fmt.Sprintf(
+			"targetGen=%v was never returned by the ReferenceManager instance (current gen=%v)",
+			targetGen, curGen))
+	}
+
+	r.Lock()
+	if targetGen > r.searchingGen {
+		// Notify the reopen goroutine that the waitingGen has changed,
+		// so it may wake up and realize it should not sleep for much or
+		// any longer before reopening:
+		if targetGen > r.waitingGen {
+			r.waitingGen = targetGen
+		}
+		r.signalReopen()
+	}
+	for targetGen > r.searchingGen {
+		changed := r.searchingChanged
+		r.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		r.Lock()
+	}
+	r.Unlock()
+	return nil
+}
+
+func (r *ControlledRealTimeReopener) run() {
+	defer close(r.done)
+
+	// TODO: maybe use private goroutine ticktock timer, in case clock
+	// shift messes up time.Now()?
+	lastReopenStart := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		// TODO: try to guestimate how long reopen might take based on
+		// past data?
+
+		// Loop until we've waiting long enough before the next reopen:
+		for {
+			r.Lock()
+			if r.finish {
+				r.Unlock()
+				return
+			}
+			// True if we have someone waiting for reopened searcher:
+			hasWaiting := r.waitingGen > r.searchingGen
+			stale := r.targetMaxStale
+			if hasWaiting {
+				stale = r.targetMinStale
+			}
+			r.Unlock()
+
+			sleep := lastReopenStart.Add(stale).Sub(time.Now())
+			if sleep <= 0 {
+				break
+			}
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(sleep)
+			select {
+			case <-r.reopenCond:
+			case <-timer.C:
+			}
+		}
+
+		lastReopenStart = time.Now()
+		// Save the gen as of when we started the reopen; the listener
+		// (AfterRefresh above) copies this to searchingGen once the
+		// reopen completes:
+		gen := r.writer.GetAndIncrementGeneration()
+		r.Lock()
+		r.refreshStartGen = gen
+		r.Unlock()
+		if err := r.manager.MaybeRefreshBlocking(); err != nil {
+			log.Printf("ControlledRealTimeReopener: reopen failed: %v", err)
+		}
+	}
+}
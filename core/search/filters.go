@@ -1,4 +1,36 @@
 package search
 
+import (
+	"github.com/balzaczyy/golucene/core/index"
+	"github.com/balzaczyy/golucene/core/util"
+)
+
 type Filter interface {
 }
+
+// search/QueryWrapperFilter.java
+
+/*
+Resolves the docs matching a query in a single segment, the way
+QueryWrapperFilter does. IndexWriter uses it to apply deletes by
+query.
+*/
+func queryDocIdSetIterator(q index.Query, ctx *index.AtomicReaderContext,
+	acceptDocs util.Bits) (index.DocIdSetIterator, error) {
+	// get a private context that is used to rewrite, createWeight and
+	// score eventually
+	privateContext := ctx.Reader().Context().(*index.AtomicReaderContext)
+	w, err := NewIndexSearcherFromContext(privateContext).createNormalizedWeight(q.(Query))
+	if err != nil {
+		return nil, err
+	}
+	scorer, err := w.Scorer(*privateContext, true, false, acceptDocs)
+	if err != nil || scorer == nil {
+		return nil, err
+	}
+	return scorer, nil
+}
+
+func init() {
+	index.QueryDocIdSetIterator = queryDocIdSetIterator
+}
@@ -0,0 +1,302 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// search/ReferenceManager.java
+
+const REFERENCE_MANAGER_IS_CLOSED_MSG = "this ReferenceManager is closed"
+
+/*
+The reference-specific operations a ReferenceManager delegates to its
+concrete implementation, e.g. SearcherManager.
+*/
+type ReferenceManagerSpi interface {
+	// Decrement reference counting on the given reference.
+	decRef(reference interface{}) error
+	/*
+		Refresh the given reference if needed. Returns nil if no refresh
+		was needed, otherwise a new refreshed reference.
+	*/
+	refreshIfNeeded(referenceToRefresh interface{}) (interface{}, error)
+	/*
+		Try to increment reference counting on the given reference.
+		Return true if the operation was successful.
+	*/
+	tryIncRef(reference interface{}) bool
+	// Returns the current reference count of the given reference.
+	refCount(reference interface{}) int
+}
+
+/*
+Use to receive notification when a refresh has finished. See
+ReferenceManager.AddListener().
+*/
+type RefreshListener interface {
+	// Called right before a refresh attempt starts.
+	BeforeRefresh() error
+	/*
+		Called after the attempted refresh; if the refresh did open a new
+		reference then didRefresh will be true and Acquire() is
+		guaranteed to return the new reference.
+	*/
+	AfterRefresh(didRefresh bool) error
+}
+
+/*
+Utility class to safely share instances of a certain type across
+multiple goroutines, while periodically refreshing them. This class
+ensures each reference is closed only once all goroutines have
+finished using it. It is recommended to consult the documentation of
+ReferenceManager implementations for their MaybeRefresh() semantics.
+*/
+type ReferenceManager struct {
+	spi ReferenceManagerSpi
+
+	current     interface{} // volatile
+	currentLock sync.RWMutex
+
+	sync.Locker // synchronized swapReference() and Close()
+
+	refreshLock *sync.Mutex
+
+	refreshListeners     []RefreshListener
+	refreshListenersLock sync.RWMutex
+}
+
+func newReferenceManager(spi ReferenceManagerSpi) *ReferenceManager {
+	return &ReferenceManager{
+		spi:         spi,
+		Locker:      &sync.Mutex{},
+		refreshLock: &sync.Mutex{},
+	}
+}
+
+func (m *ReferenceManager) ensureOpen() error {
+	if m.currentRef() == nil {
+		return errors.New(REFERENCE_MANAGER_IS_CLOSED_MSG)
+	}
+	return nil
+}
+
+func (m *ReferenceManager) currentRef() interface{} {
+	m.currentLock.RLock()
+	defer m.currentLock.RUnlock()
+	return m.current
+}
+
+func (m *ReferenceManager) setCurrent(ref interface{}) {
+	m.currentLock.Lock()
+	defer m.currentLock.Unlock()
+	m.current = ref
+}
+
+func (m *ReferenceManager) swapReference(newReference interface{}) error {
+	m.Lock() // synchronized
+	defer m.Unlock()
+	return m._swapReference(newReference)
+}
+
+func (m *ReferenceManager) _swapReference(newReference interface{}) error {
+	if err := m.ensureOpen(); err != nil {
+		return err
+	}
+	oldReference := m.currentRef()
+	m.setCurrent(newReference)
+	return m.release(oldReference)
+}
+
+/*
+Obtain the current reference. You must match every call to Acquire()
+with one call to Release(); it's best to do so in a defer clause, and
+set the reference to nil to prevent accidental usage after it has
+been released.
+*/
+func (m *ReferenceManager) acquire() (interface{}, error) {
+	for {
+		ref := m.currentRef()
+		if ref == nil {
+			return nil, errors.New(REFERENCE_MANAGER_IS_CLOSED_MSG)
+		}
+		if m.spi.tryIncRef(ref) {
+			return ref, nil
+		}
+		if m.spi.refCount(ref) == 0 && m.currentRef() == ref {
+			return nil, errors.New("The managed reference has already closed - this is likely a bug when the reference count is modified outside of the ReferenceManager")
+		}
+	}
+}
+
+/*
+Closes this ReferenceManager to prevent future acquiring. A reference
+manager should be closed if the reference to the managed resource
+should be disposed or the application using the ReferenceManager is
+shutting down. The managed resource might not be released
+immediately, if the ReferenceManager user is holding on to a
+previously acquired reference. The resource will be released once
+when the last reference is released. Those references can still be
+used as if the manager was still active.
+
+Applications should not acquire new references from this manager once
+this method has been called. Acquiring a resource on a closed
+ReferenceManager will return an error.
+*/
+func (m *ReferenceManager) Close() error {
+	m.Lock() // synchronized
+	defer m.Unlock()
+	if m.currentRef() != nil {
+		// make sure we can call this more than once
+		// closeable javadoc says:
+		// if this is already closed then invoking this method has no effect.
+		return m._swapReference(nil)
+	}
+	return nil
+}
+
+// Requires refreshLock
+func (m *ReferenceManager) doMaybeRefresh() (err error) {
+	// Per ReferenceManager's doc: maybeRefresh returns immediately if
+	// other goroutines are refreshing.
+	reference, err := m.acquire()
+	if err != nil {
+		return err
+	}
+	var refreshed = false
+	defer func() {
+		err = mergeError(err, m.release(reference))
+		err = mergeError(err, m.notifyRefreshListenersRefreshed(refreshed))
+	}()
+
+	if err = m.notifyRefreshListenersBefore(); err != nil {
+		return err
+	}
+	newReference, err := m.spi.refreshIfNeeded(reference)
+	if err != nil {
+		return err
+	}
+	if newReference != nil {
+		assert2(newReference != reference, "refreshIfNeeded should return nil if refresh wasn't needed")
+		if err = m.swapReference(newReference); err != nil {
+			return mergeError(err, m.release(newReference))
+		}
+		refreshed = true
+	}
+	return nil
+}
+
+/*
+You must call this (or MaybeRefreshBlocking()), periodically, if you
+want that Acquire() will return refreshed instances.
+
+Goroutines: it's fine for more than one goroutine to call this at
+once. Only the first goroutine will attempt the refresh; subsequent
+goroutines will see that another goroutine is already handling
+refresh and will return immediately. Note that this means if another
+goroutine is already refreshing then subsequent goroutines will
+return right away without waiting for the refresh to complete.
+
+If this method returns true it means the calling goroutine either
+refreshed or that there were no changes to refresh. If it returns
+false it means another goroutine is currently refreshing.
+*/
+func (m *ReferenceManager) MaybeRefresh() (bool, error) {
+	if err := m.ensureOpen(); err != nil {
+		return false, err
+	}
+
+	// Ensure only 1 goroutine does refresh at once; other goroutines
+	// just return immediately:
+	if m.refreshLock.TryLock() {
+		defer m.refreshLock.Unlock()
+		return true, m.doMaybeRefresh()
+	}
+	return false, nil
+}
+
+/*
+You must call this (or MaybeRefresh()), periodically, if you want
+that Acquire() will return refreshed instances.
+
+Goroutines: unlike MaybeRefresh(), if another goroutine is currently
+refreshing, this method blocks until that goroutine completes. It is
+useful if you want to guarantee that the next call to Acquire() will
+return a refreshed instance. Otherwise, consider using the
+non-blocking MaybeRefresh().
+*/
+func (m *ReferenceManager) MaybeRefreshBlocking() error {
+	if err := m.ensureOpen(); err != nil {
+		return err
+	}
+
+	// Ensure only 1 goroutine does refresh at once
+	m.refreshLock.Lock()
+	defer m.refreshLock.Unlock()
+	return m.doMaybeRefresh()
+}
+
+/*
+Release the reference previously obtained via Acquire().
+
+NOTE: it's safe to call this after Close().
+*/
+func (m *ReferenceManager) release(reference interface{}) error {
+	assert(reference != nil)
+	return m.spi.decRef(reference)
+}
+
+func (m *ReferenceManager) notifyRefreshListenersBefore() (err error) {
+	m.refreshListenersLock.RLock()
+	defer m.refreshListenersLock.RUnlock()
+	for _, listener := range m.refreshListeners {
+		err = mergeError(err, listener.BeforeRefresh())
+	}
+	return
+}
+
+func (m *ReferenceManager) notifyRefreshListenersRefreshed(didRefresh bool) (err error) {
+	m.refreshListenersLock.RLock()
+	defer m.refreshListenersLock.RUnlock()
+	for _, listener := range m.refreshListeners {
+		err = mergeError(err, listener.AfterRefresh(didRefresh))
+	}
+	return
+}
+
+// Adds a listener, to be notified when a reference is refreshed/swapped.
+func (m *ReferenceManager) AddListener(listener RefreshListener) {
+	assert2(listener != nil, "Listener cannot be nil")
+	m.refreshListenersLock.Lock()
+	defer m.refreshListenersLock.Unlock()
+	m.refreshListeners = append(m.refreshListeners, listener)
+}
+
+// Remove a listener added with AddListener().
+func (m *ReferenceManager) RemoveListener(listener RefreshListener) {
+	assert2(listener != nil, "Listener cannot be nil")
+	m.refreshListenersLock.Lock()
+	defer m.refreshListenersLock.Unlock()
+	for i, v := range m.refreshListeners {
+		if v == listener {
+			m.refreshListeners = append(m.refreshListeners[:i], m.refreshListeners[i+1:]...)
+			return
+		}
+	}
+}
+
+func assert2(ok bool, msg string, args ...interface{}) {
+	if !ok {
+		panic(fmt.Sprintf(msg, args...))
+	}
+}
+
+func mergeError(err, err2 error) error {
+	if err == nil {
+		return err2
+	} else if err2 == nil {
+		return err
+	}
+	return errors.New(fmt.Sprintf("%v\n  %v", err, err2))
+}
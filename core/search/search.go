@@ -156,6 +156,11 @@ func rewrite(q Query, r index.IndexReader) Query {
 	return q
 }
 
+// Return the IndexReader this searches.
+func (ss IndexSearcher) IndexReader() index.IndexReader {
+	return ss.reader
+}
+
 // Returns this searhcers the top-level IndexReaderContext
 func (ss IndexSearcher) TopReaderContext() index.IndexReaderContext {
 	return ss.readerContext
@@ -261,6 +266,15 @@ type ITFIDFSimilarity interface {
 	 * @see #encodeNormValue(float)
 	 */
 	decodeNormValue(norm int64) float32
+	/**
+	 * Compute an index-time normalization value for this field instance.
+	 *
+	 * @param state statistics of the current field (such as length, boost, etc)
+	 * @return an index-time normalization value
+	 */
+	lengthNorm(state *index.FieldInvertState) float32
+	/** Encodes a normalization factor for storage in an index. */
+	encodeNormValue(f float32) int64
 }
 
 type TFIDFSimilarity struct {
@@ -284,7 +298,7 @@ func (ts *TFIDFSimilarity) idfExplainPhrase(collectionStats CollectionStatistics
 }
 
 func (ts *TFIDFSimilarity) ComputeNorm(state *index.FieldInvertState) int64 {
-	panic("not implemented yet")
+	return ts.encodeNormValue(ts.lengthNorm(state))
 }
 
 func (ts *TFIDFSimilarity) computeWeight(queryBoost float32, collectionStats CollectionStatistics, termStats ...TermStatistics) SimWeight {
@@ -447,10 +461,38 @@ func (ds *DefaultSimilarity) QueryNorm(sumOfSquaredWeights float32) float32 {
 	return 1.0 / float32(math.Sqrt(float64(sumOfSquaredWeights)))
 }
 
+/*
+Encodes a normalization factor for storage in an index.
+
+The encoding uses a three-bit mantissa, a five-bit exponent, and the
+zero-exponent point at 15, thus representing values from around
+7x10^9 to 2x10^-9 with about one significant decimal digit of
+accuracy. Zero is also represented. Negative numbers are rounded up
+to zero. Values too large to represent are rounded down to the
+largest representable value. Positive values too small to represent
+are rounded up to the smallest positive representable value.
+*/
+func (ds *DefaultSimilarity) encodeNormValue(f float32) int64 {
+	return int64(int8(util.FloatToByte315(f)))
+}
+
 func (ds *DefaultSimilarity) decodeNormValue(norm int64) float32 {
 	return NORM_TABLE[int(norm&0xff)] // & 0xFF maps negative bytes to positive above 127
 }
 
+/*
+Implemented as state.Boost() * lengthNorm(numTerms), where numTerms
+is FieldInvertState.Length() if discountOverlaps is false, else it's
+FieldInvertState.Length() - FieldInvertState.NumOverlap().
+*/
+func (ds *DefaultSimilarity) lengthNorm(state *index.FieldInvertState) float32 {
+	numTerms := state.Length()
+	if ds.discountOverlaps {
+		numTerms -= state.NumOverlap()
+	}
+	return state.Boost() * float32(1.0/math.Sqrt(float64(numTerms)))
+}
+
 func (ds *DefaultSimilarity) tf(freq float32) float32 {
 	return float32(math.Sqrt(float64(freq)))
 }
@@ -3,9 +3,16 @@ package search
 import (
 	"github.com/balzaczyy/golucene/core/index"
 	"github.com/balzaczyy/golucene/core/store"
+	"github.com/balzaczyy/golucene/core/util"
 	"testing"
 )
 
+func init() {
+	index.DefaultSimilarity = func() index.Similarity {
+		return NewDefaultSimilarity()
+	}
+}
+
 func TestLastCommitGeneration(t *testing.T) {
 	d, err := store.OpenFSDirectory("testdata/belfrysample")
 	if err != nil {
@@ -52,6 +59,54 @@ func TestKeywordSearch(t *testing.T) {
 	assertEquals(t, "Bat recycling", doc.Get("title"))
 }
 
+func TestSearchAddedDocuments(t *testing.T) {
+	d := store.NewRAMDirectory()
+	w, err := index.NewIndexWriter(d, index.NewIndexWriterConfig(util.VERSION_45, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	for _, v := range [][2]string{
+		{"Bat recycling", "bat"}, {"Belfry", "bell"}, {"Bat houses", "bat"},
+	} {
+		if err = w.AddDocument([]index.IndexableField{
+			index.NewStringField("title", v[0], index.STRING_FIELD_TYPE_STORED),
+			index.NewStringField("content", v[1], index.STRING_FIELD_TYPE_NOT_STORED),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := index.OpenDirectoryReader(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	ss := NewIndexSearcher(r)
+	docs, err := ss.SearchTop(NewTermQuery(index.NewTerm("content", "bat")), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(t, 2, docs.TotalHits)
+	for i, title := range []string{"Bat recycling", "Bat houses"} {
+		doc, err := r.Document(docs.ScoreDocs[i].Doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEquals(t, title, doc.Get("title"))
+	}
+
+	docs, err = ss.SearchTop(NewTermQuery(index.NewTerm("title", "Belfry")), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(t, 1, docs.TotalHits)
+	assertEquals(t, 1, docs.ScoreDocs[0].Doc)
+}
+
 // func TestSingleSearch(t *testing.T) {
 // 	ss := NewSearcher()
 // 	ss.IncludeIndex("testdata/belfrysample")
@@ -0,0 +1,205 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"github.com/balzaczyy/golucene/core/index"
+	"github.com/balzaczyy/golucene/core/store"
+)
+
+// search/SearcherFactory.java
+
+/*
+Factory class used by SearcherManager to create new IndexSearchers.
+The default implementation just creates an IndexSearcher with no
+custom behavior.
+
+You can pass your own factory instead if you want custom behavior,
+such as:
+
+- Setting a custom scoring model
+- Run queries to warm your IndexSearcher before it is used, e.g.
+
+	func (f *WarmingFactory) NewSearcher(r index.IndexReader) (*IndexSearcher, error) {
+		searcher := NewIndexSearcher(r)
+		if _, err := searcher.SearchTop(warmQuery, 10); err != nil {
+			return nil, err
+		}
+		return &searcher, nil
+	}
+*/
+type SearcherFactory interface {
+	/*
+		Returns a new IndexSearcher over the given reader. The searcher
+		must wrap exactly the provided reader.
+	*/
+	NewSearcher(reader index.IndexReader) (*IndexSearcher, error)
+}
+
+type defaultSearcherFactory struct{}
+
+func (f defaultSearcherFactory) NewSearcher(reader index.IndexReader) (*IndexSearcher, error) {
+	searcher := NewIndexSearcher(reader)
+	return &searcher, nil
+}
+
+// The factory used when nil is passed to SearcherManager.
+var DEFAULT_SEARCHER_FACTORY SearcherFactory = defaultSearcherFactory{}
+
+// search/SearcherManager.java
+
+/*
+Utility class to safely share IndexSearcher instances across multiple
+goroutines, while periodically reopening. This class ensures each
+searcher is closed only once all goroutines have finished using it.
+
+Use Acquire() to obtain the current searcher, and Release() to
+release it, like this:
+
+	s, err := mgr.Acquire()
+	if err != nil {
+		return err
+	}
+	defer mgr.Release(s)
+	// Do searching, doc retrieval, etc. with s
+
+In addition you should periodically call MaybeRefresh(). While it's
+possible to call this just before running each query, this is
+discouraged since it penalizes the unlucky queries that do the
+reopen. It's better to use a separate background goroutine, that
+periodically calls MaybeRefresh(). Finally, be sure to call Close()
+once you are done.
+*/
+type SearcherManager struct {
+	*ReferenceManager
+	searcherFactory SearcherFactory
+}
+
+/*
+Creates and returns a new SearcherManager from the given IndexWriter.
+
+If applyAllDeletes is true, all buffered deletes will be applied
+(made visible) in the IndexSearcher/DirectoryReader. If false, the
+deletes may or may not be applied, but remain buffered (in
+IndexWriter) so that they will be applied in the future. Applying
+deletes can be costly, so if your app can tolerate deleted documents
+being returned you might gain some performance by passing false.
+
+If searcherFactory is nil, DEFAULT_SEARCHER_FACTORY is used.
+*/
+func NewSearcherManagerFromWriter(writer *index.IndexWriter, applyAllDeletes bool,
+	searcherFactory SearcherFactory) (*SearcherManager, error) {
+	r, err := index.OpenDirectoryReaderFromWriter(writer, applyAllDeletes)
+	if err != nil {
+		return nil, err
+	}
+	return newSearcherManager(r, searcherFactory)
+}
+
+/*
+Creates and returns a new SearcherManager from the given Directory.
+
+If searcherFactory is nil, DEFAULT_SEARCHER_FACTORY is used.
+*/
+func NewSearcherManager(dir store.Directory, searcherFactory SearcherFactory) (*SearcherManager, error) {
+	r, err := index.OpenDirectoryReader(dir)
+	if err != nil {
+		return nil, err
+	}
+	return newSearcherManager(r, searcherFactory)
+}
+
+func newSearcherManager(r index.IndexReader, searcherFactory SearcherFactory) (*SearcherManager, error) {
+	if searcherFactory == nil {
+		searcherFactory = DEFAULT_SEARCHER_FACTORY
+	}
+	sm := &SearcherManager{searcherFactory: searcherFactory}
+	sm.ReferenceManager = newReferenceManager(sm)
+	searcher, err := Searcher(searcherFactory, r)
+	if err != nil {
+		return nil, err
+	}
+	sm.setCurrent(searcher)
+	return sm, nil
+}
+
+/*
+Obtain the current IndexSearcher. You must match every call to
+Acquire() with one call to Release().
+*/
+func (sm *SearcherManager) Acquire() (*IndexSearcher, error) {
+	ref, err := sm.acquire()
+	if err != nil {
+		return nil, err
+	}
+	return ref.(*IndexSearcher), nil
+}
+
+/*
+Release the IndexSearcher previously obtained via Acquire().
+
+NOTE: it's safe to call this after Close().
+*/
+func (sm *SearcherManager) Release(searcher *IndexSearcher) error {
+	return sm.release(searcher)
+}
+
+func (sm *SearcherManager) decRef(reference interface{}) error {
+	return reference.(*IndexSearcher).IndexReader().DecRef()
+}
+
+func (sm *SearcherManager) refreshIfNeeded(referenceToRefresh interface{}) (interface{}, error) {
+	r := referenceToRefresh.(*IndexSearcher).IndexReader()
+	dr, ok := r.(index.DirectoryReader)
+	assert2(ok, "searcher's IndexReader should be a DirectoryReader, but got %v", r)
+	newReader, err := index.OpenIfChanged(dr)
+	if err != nil || newReader == nil {
+		return nil, err
+	}
+	return Searcher(sm.searcherFactory, newReader)
+}
+
+func (sm *SearcherManager) tryIncRef(reference interface{}) bool {
+	return reference.(*IndexSearcher).IndexReader().TryIncRef()
+}
+
+func (sm *SearcherManager) refCount(reference interface{}) int {
+	return reference.(*IndexSearcher).IndexReader().RefCount()
+}
+
+/*
+Returns true if no changes have occurred since this searcher ie.
+reader was opened, otherwise false.
+*/
+func (sm *SearcherManager) IsSearcherCurrent() (bool, error) {
+	searcher, err := sm.Acquire()
+	if err != nil {
+		return false, err
+	}
+	defer sm.Release(searcher)
+	return searcher.IndexReader().(index.DirectoryReader).IsCurrent(), nil
+}
+
+/*
+Expert: creates a searcher from the provided IndexReader using the
+provided SearcherFactory. NOTE: this decRefs incoming reader on
+error.
+*/
+func Searcher(searcherFactory SearcherFactory, reader index.IndexReader) (searcher *IndexSearcher, err error) {
+	var success = false
+	defer func() {
+		if !success {
+			reader.DecRef()
+		}
+	}()
+	if searcher, err = searcherFactory.NewSearcher(reader); err != nil {
+		return nil, err
+	}
+	if searcher.IndexReader() != reader {
+		return nil, errors.New(fmt.Sprintf(
+			"SearcherFactory must wrap exactly the provided reader (got %v but expected %v)",
+			searcher.IndexReader(), reader))
+	}
+	success = true
+	return searcher, nil
+}
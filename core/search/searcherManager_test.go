@@ -0,0 +1,149 @@
+package search
+
+import (
+	"context"
+	"github.com/balzaczyy/golucene/core/index"
+	"github.com/balzaczyy/golucene/core/store"
+	"github.com/balzaczyy/golucene/core/util"
+	"testing"
+	"time"
+)
+
+func TestSearcherManager(t *testing.T) {
+	d, err := store.OpenFSDirectory("testdata/belfrysample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr, err := NewSearcherManager(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := mgr.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(t, 2, s.IndexReader().RefCount())
+	docs, err := s.SearchTop(NewTermQuery(index.NewTerm("content", "bat")), 10)
+	if err != nil {
+		t.Error(err)
+	}
+	assertEquals(t, 8, docs.TotalHits)
+
+	ok, err := mgr.MaybeRefresh()
+	if err != nil || !ok {
+		t.Errorf("MaybeRefresh should succeed (ok=%v, err=%v)", ok, err)
+	}
+	s2, err := mgr.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s2 != s {
+		t.Error("Searcher should be unchanged since the index is unchanged.")
+	}
+	if err = mgr.Release(s2); err != nil {
+		t.Error(err)
+	}
+
+	if err = mgr.Close(); err != nil {
+		t.Error(err)
+	}
+	if _, err = mgr.Acquire(); err == nil {
+		t.Error("Acquire should fail after Close.")
+	}
+	// searcher acquired before Close is still usable
+	assertEquals(t, 1, s.IndexReader().RefCount())
+	if err = mgr.Release(s); err != nil {
+		t.Error(err)
+	}
+	assertEquals(t, 0, s.IndexReader().RefCount())
+}
+
+func TestControlledRealTimeReopener(t *testing.T) {
+	d, err := store.OpenFSDirectory("testdata/belfrysample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr, err := NewSearcherManager(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mgr.Close()
+
+	// Only generations are tracked here, no changes are made.
+	writer := index.NewTrackingIndexWriter(nil)
+	reopener, err := NewControlledRealTimeReopener(writer, mgr.ReferenceManager,
+		time.Hour, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = reopener.WaitForGeneration(ctx, writer.Generation()); err != nil {
+		t.Error(err)
+	}
+	if err = reopener.WaitForGeneration(ctx, writer.Generation()+1); err == nil {
+		t.Error("Should fail on a generation never returned.")
+	}
+	if err = reopener.Close(); err != nil {
+		t.Error(err)
+	}
+
+	// no reopen would ever happen within the deadline
+	writer = index.NewTrackingIndexWriter(nil)
+	reopener, err = NewControlledRealTimeReopener(writer, mgr.ReferenceManager,
+		time.Hour, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopener.Close()
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err = reopener.WaitForGeneration(ctx, writer.Generation()); err != context.DeadlineExceeded {
+		t.Errorf("Should time out, but got %v", err)
+	}
+}
+
+func TestControlledRealTimeReopenerAddDocument(t *testing.T) {
+	w, err := index.NewIndexWriter(store.NewRAMDirectory(), index.NewIndexWriterConfig(util.VERSION_45, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	mgr, err := NewSearcherManagerFromWriter(w, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mgr.Close()
+	writer := index.NewTrackingIndexWriter(w)
+	reopener, err := NewControlledRealTimeReopener(writer, mgr.ReferenceManager,
+		time.Hour, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopener.Close()
+
+	gen, err := writer.AddDocument([]index.IndexableField{
+		index.NewStringField("content", "bat", index.STRING_FIELD_TYPE_NOT_STORED),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = reopener.WaitForGeneration(ctx, gen); err != nil {
+		t.Fatal(err)
+	}
+
+	// the added document is visible once its generation is reached
+	s, err := mgr.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mgr.Release(s)
+	docs, err := s.SearchTop(NewTermQuery(index.NewTerm("content", "bat")), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(t, 1, docs.TotalHits)
+}
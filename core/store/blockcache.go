@@ -0,0 +1,316 @@
+package store
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+)
+
+/* Default size of the blocks cached by BlockCacheDirectory. */
+const BLOCK_CACHE_DEFAULT_BLOCK_SIZE = 8192
+
+/* Number of independently locked shards of a BlockCache. */
+const BLOCK_CACHE_SHARDS = 16
+
+/* Snapshot of the metrics of a BlockCache. */
+type BlockCacheStats struct {
+	Hits, Misses, Evictions int64
+	// Blocks currently cached, and their total size.
+	Blocks, SizeInBytes int64
+}
+
+func (s BlockCacheStats) String() string {
+	return fmt.Sprintf("hits=%v misses=%v evictions=%v blocks=%v sizeInBytes=%v",
+		s.Hits, s.Misses, s.Evictions, s.Blocks, s.SizeInBytes)
+}
+
+type blockKey struct {
+	name  string
+	block int64
+}
+
+type blockEntry struct {
+	key  blockKey
+	data []byte
+}
+
+/*
+One LRU list, holding the blocks of the files hashed to it. Each shard
+is bounded to its part of the total cache size.
+*/
+type blockCacheShard struct {
+	sync.Locker
+	maxSize int64
+	size    int64
+	lru     *list.List // of *blockEntry, most recently used first
+	blocks  map[blockKey]*list.Element
+	files   map[string]map[int64]bool // blocks cached per file
+}
+
+/*
+A bounded cache of file blocks, split into shards each holding its own
+LRU list, so concurrent readers seldom contend on the same lock. All
+blocks of a file live in the same shard, so a file can be invalidated
+with a single lock.
+*/
+type BlockCache struct {
+	hits, misses, evictions int64 // atomic; first for 64-bit alignment
+	shards                  []*blockCacheShard
+}
+
+/* Creates a cache holding at most maxSizeInBytes bytes of blocks. */
+func NewBlockCache(maxSizeInBytes int64) *BlockCache {
+	ans := &BlockCache{shards: make([]*blockCacheShard, BLOCK_CACHE_SHARDS)}
+	for i := range ans.shards {
+		ans.shards[i] = &blockCacheShard{
+			Locker:  &sync.Mutex{},
+			maxSize: maxSizeInBytes / BLOCK_CACHE_SHARDS,
+			lru:     list.New(),
+			blocks:  make(map[blockKey]*list.Element),
+			files:   make(map[string]map[int64]bool),
+		}
+	}
+	return ans
+}
+
+func (c *BlockCache) shard(name string) *blockCacheShard {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return c.shards[h.Sum32()%BLOCK_CACHE_SHARDS]
+}
+
+/* Returns the cached block, or nil; the returned slice must not be modified. */
+func (c *BlockCache) get(name string, block int64) []byte {
+	s := c.shard(name)
+	s.Lock()
+	defer s.Unlock()
+	if e, ok := s.blocks[blockKey{name, block}]; ok {
+		s.lru.MoveToFront(e)
+		atomic.AddInt64(&c.hits, 1)
+		return e.Value.(*blockEntry).data
+	}
+	atomic.AddInt64(&c.misses, 1)
+	return nil
+}
+
+func (c *BlockCache) put(name string, block int64, data []byte) {
+	s := c.shard(name)
+	if int64(len(data)) > s.maxSize {
+		return // would evict everything else
+	}
+	s.Lock()
+	defer s.Unlock()
+	key := blockKey{name, block}
+	if _, ok := s.blocks[key]; ok {
+		return // loaded concurrently
+	}
+	s.blocks[key] = s.lru.PushFront(&blockEntry{key, data})
+	if s.files[name] == nil {
+		s.files[name] = make(map[int64]bool)
+	}
+	s.files[name][block] = true
+	s.size += int64(len(data))
+	for s.size > s.maxSize {
+		s.remove(s.lru.Back())
+		atomic.AddInt64(&c.evictions, 1)
+	}
+}
+
+func (s *blockCacheShard) remove(e *list.Element) {
+	entry := s.lru.Remove(e).(*blockEntry)
+	delete(s.blocks, entry.key)
+	if blocks := s.files[entry.key.name]; blocks != nil {
+		delete(blocks, entry.key.block)
+		if len(blocks) == 0 {
+			delete(s.files, entry.key.name)
+		}
+	}
+	s.size -= int64(len(entry.data))
+}
+
+/* Drops all cached blocks of the given file. */
+func (c *BlockCache) Invalidate(name string) {
+	s := c.shard(name)
+	s.Lock()
+	defer s.Unlock()
+	for block, _ := range s.files[name] {
+		s.remove(s.blocks[blockKey{name, block}])
+	}
+}
+
+func (c *BlockCache) Stats() BlockCacheStats {
+	ans := BlockCacheStats{
+		Hits:      atomic.LoadInt64(&c.hits),
+		Misses:    atomic.LoadInt64(&c.misses),
+		Evictions: atomic.LoadInt64(&c.evictions),
+	}
+	for _, s := range c.shards {
+		s.Lock()
+		ans.Blocks += int64(len(s.blocks))
+		ans.SizeInBytes += s.size
+		s.Unlock()
+	}
+	return ans
+}
+
+/*
+A Directory wrapper caching fixed-size blocks of the files read
+through it in a BlockCache, for indexes on slow (e.g. network)
+storage serving read-heavy workloads.
+
+Inputs opened with a MERGE or read-once IOContext bypass the cache,
+as they read whole files sequentially once and would only evict the
+blocks searches need. Deleting or overwriting a file through this
+directory invalidates its cached blocks; files must not be modified
+behind its back.
+*/
+type BlockCacheDirectory struct {
+	Directory
+	cache     *BlockCache
+	blockSize int
+}
+
+/*
+Wraps delegate with a cache of at most maxCachedMB of blocks of
+blockSize bytes.
+*/
+func NewBlockCacheDirectory(delegate Directory, blockSize int, maxCachedMB float64) *BlockCacheDirectory {
+	assert2(blockSize > 0, "blockSize must be greater than 0 (got %v)", blockSize)
+	return &BlockCacheDirectory{
+		Directory: delegate,
+		cache:     NewBlockCache(int64(maxCachedMB * 1024 * 1024)),
+		blockSize: blockSize,
+	}
+}
+
+/* Returns the metrics of the underlying cache. */
+func (d *BlockCacheDirectory) Stats() BlockCacheStats {
+	return d.cache.Stats()
+}
+
+func (d *BlockCacheDirectory) OpenInput(name string, context IOContext) (IndexInput, error) {
+	in, err := d.Directory.OpenInput(name, context)
+	if err != nil || context.context == IO_CONTEXT_TYPE_MERGE || context.readOnce {
+		return in, err
+	}
+	return newBlockCacheIndexInput(fmt.Sprintf("BlockCacheIndexInput(%v)", in),
+		in, d.cache, name, d.blockSize, context), nil
+}
+
+/* Compound files are read through OpenInput(), so their slices are cached. */
+func (d *BlockCacheDirectory) CreateSlicer(name string, context IOContext) (IndexInputSlicer, error) {
+	d.EnsureOpen()
+	base, err := d.OpenInput(name, context)
+	if err != nil {
+		return nil, err
+	}
+	return simpleIndexInputSlicer{base}, nil
+}
+
+func (d *BlockCacheDirectory) CreateOutput(name string, context IOContext) (IndexOutput, error) {
+	d.cache.Invalidate(name)
+	return d.Directory.CreateOutput(name, context)
+}
+
+func (d *BlockCacheDirectory) DeleteFile(name string) error {
+	err := d.Directory.DeleteFile(name)
+	d.cache.Invalidate(name)
+	return err
+}
+
+func (d *BlockCacheDirectory) String() string {
+	return fmt.Sprintf("BlockCacheDirectory(%v; %v)", d.Directory, d.cache.Stats())
+}
+
+type blockCacheIndexInput struct {
+	*BufferedIndexInput
+	delegate  IndexInput
+	cache     *BlockCache
+	name      string
+	blockSize int64
+	isClone   bool
+}
+
+func newBlockCacheIndexInput(desc string, delegate IndexInput, cache *BlockCache,
+	name string, blockSize int, context IOContext) *blockCacheIndexInput {
+
+	ans := &blockCacheIndexInput{
+		delegate:  delegate,
+		cache:     cache,
+		name:      name,
+		blockSize: int64(blockSize),
+	}
+	ans.BufferedIndexInput = newBufferedIndexInput(ans, desc, context)
+	return ans
+}
+
+func (in *blockCacheIndexInput) readInternal(buf []byte) error {
+	pos := in.FilePointer()
+	if pos+int64(len(buf)) > in.Length() {
+		return errors.New(fmt.Sprintf("read past EOF: %v", in))
+	}
+	for len(buf) > 0 {
+		block := pos / in.blockSize
+		data, err := in.loadBlock(block)
+		if err != nil {
+			return err
+		}
+		n := copy(buf, data[pos-block*in.blockSize:])
+		buf = buf[n:]
+		pos += int64(n)
+	}
+	return nil
+}
+
+// Returns the given block, from the cache or loaded into it.
+func (in *blockCacheIndexInput) loadBlock(block int64) ([]byte, error) {
+	if data := in.cache.get(in.name, block); data != nil {
+		return data, nil
+	}
+	start := block * in.blockSize
+	size := in.blockSize
+	if n := in.Length() - start; n < size {
+		size = n
+	}
+	data := make([]byte, size)
+	if err := in.delegate.Seek(start); err != nil {
+		return nil, err
+	}
+	if err := in.delegate.ReadBytes(data); err != nil {
+		return nil, err
+	}
+	in.cache.put(in.name, block, data)
+	return data, nil
+}
+
+func (in *blockCacheIndexInput) seekInternal(pos int64) error {
+	return nil // blocks are located on each read
+}
+
+func (in *blockCacheIndexInput) Length() int64 {
+	return in.delegate.Length()
+}
+
+func (in *blockCacheIndexInput) Clone() IndexInput {
+	ans := &blockCacheIndexInput{
+		BufferedIndexInput: in.BufferedIndexInput.Clone(),
+		delegate:           in.delegate.Clone(),
+		cache:              in.cache,
+		name:               in.name,
+		blockSize:          in.blockSize,
+		isClone:            true,
+	}
+	ans.SeekReader = ans
+	return ans
+}
+
+func (in *blockCacheIndexInput) Close() error {
+	// only close the delegate if this is not a clone
+	if !in.isClone {
+		return in.delegate.Close()
+	}
+	return nil
+}
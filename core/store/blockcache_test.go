@@ -0,0 +1,153 @@
+package store
+
+import (
+	"bytes"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// Counts the bytes read from the wrapped directory, standing for slow
+// network storage.
+type countingDirectory struct {
+	Directory
+	bytesRead int64 // atomic
+}
+
+func (d *countingDirectory) OpenInput(name string, context IOContext) (IndexInput, error) {
+	in, err := d.Directory.OpenInput(name, context)
+	if err != nil {
+		return nil, err
+	}
+	return &countingIndexInput{in, &d.bytesRead}, nil
+}
+
+type countingIndexInput struct {
+	IndexInput
+	bytesRead *int64
+}
+
+func (in *countingIndexInput) ReadBytes(buf []byte) error {
+	atomic.AddInt64(in.bytesRead, int64(len(buf)))
+	return in.IndexInput.ReadBytes(buf)
+}
+
+func (in *countingIndexInput) Clone() IndexInput {
+	return &countingIndexInput{in.IndexInput.Clone(), in.bytesRead}
+}
+
+func TestBlockCacheDirectory(t *testing.T) {
+	raw := &countingDirectory{Directory: NewRAMDirectory()}
+	dir := NewBlockCacheDirectory(raw, 512, 1)
+
+	data := make([]byte, 10000)
+	rnd := rand.New(rand.NewSource(1))
+	rnd.Read(data)
+	writeTestFile(t, dir, "a.bin", data)
+
+	read := func(context IOContext) {
+		in, err := dir.OpenInput("a.bin", context)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer in.Close()
+		buf := make([]byte, 100)
+		for _, pos := range []int64{0, 500, 9000, 4242, 0} {
+			if err = in.Seek(pos); err != nil {
+				t.Fatal(err)
+			}
+			if err = in.ReadBytes(buf); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf, data[pos:pos+100]) {
+				t.Fatalf("content mismatch at %v", pos)
+			}
+		}
+	}
+
+	read(IO_CONTEXT_READ)
+	missed := atomic.LoadInt64(&raw.bytesRead)
+	if missed == 0 || missed == int64(len(data)) {
+		t.Errorf("expected only the blocks read to be loaded, but %v bytes were", missed)
+	}
+	// all blocks are cached now
+	read(IO_CONTEXT_READ)
+	if n := atomic.LoadInt64(&raw.bytesRead); n != missed {
+		t.Errorf("expected cached blocks to be reused, but read %v more bytes", n-missed)
+	}
+	if stats := dir.Stats(); stats.Hits == 0 || stats.Misses == 0 || stats.Blocks == 0 {
+		t.Errorf("unexpected stats: %v", stats)
+	}
+
+	// merges bypass the cache
+	before := dir.Stats()
+	read(NewIOContextForMerge(&MergeInfo{}))
+	if n := atomic.LoadInt64(&raw.bytesRead); n == missed {
+		t.Error("merge should read from the wrapped directory")
+	}
+	if stats := dir.Stats(); stats.Hits != before.Hits || stats.Misses != before.Misses {
+		t.Errorf("merge should not use the cache: %v", stats)
+	}
+
+	// deleting the file drops its blocks, so new content is read
+	if err := dir.DeleteFile("a.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if stats := dir.Stats(); stats.Blocks != 0 || stats.SizeInBytes != 0 {
+		t.Errorf("blocks should be invalidated: %v", stats)
+	}
+	rnd.Read(data)
+	writeTestFile(t, dir, "a.bin", data)
+	read(IO_CONTEXT_READ)
+}
+
+func TestBlockCacheEviction(t *testing.T) {
+	cache := NewBlockCache(BLOCK_CACHE_SHARDS * 1000)
+	for i := int64(0); i < 10; i++ {
+		cache.put("a", i, make([]byte, 300))
+	}
+	stats := cache.Stats()
+	if stats.Blocks != 3 || stats.SizeInBytes != 900 || stats.Evictions != 7 {
+		t.Errorf("unexpected stats after eviction: %v", stats)
+	}
+	// least recently used first
+	if cache.get("a", 6) != nil || cache.get("a", 7) == nil {
+		t.Error("expected the oldest blocks to be evicted")
+	}
+	cache.put("a", 10, make([]byte, 300))
+	if cache.get("a", 7) == nil || cache.get("a", 8) != nil {
+		t.Error("expected the least recently used block to be evicted")
+	}
+}
+
+func TestBlockCacheConcurrentClones(t *testing.T) {
+	dir := NewBlockCacheDirectory(NewRAMDirectory(), 128, 0.01)
+	data := make([]byte, 20000)
+	rand.New(rand.NewSource(2)).Read(data)
+	writeTestFile(t, dir, "a.bin", data)
+	in, err := dir.OpenInput("a.bin", IO_CONTEXT_READ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(in IndexInput, seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			buf := make([]byte, 50)
+			for i := 0; i < 500; i++ {
+				pos := rnd.Int63n(int64(len(data) - len(buf)))
+				in.Seek(pos)
+				if err := in.ReadBytes(buf); err != nil || !bytes.Equal(buf, data[pos:pos+50]) {
+					t.Errorf("content mismatch at %v: %v", pos, err)
+					return
+				}
+			}
+		}(in.Clone(), int64(g))
+	}
+	wg.Wait()
+}
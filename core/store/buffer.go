@@ -3,6 +3,7 @@ package store
 import (
 	"errors"
 	"fmt"
+	"hash/crc32"
 )
 
 type SeekReader interface {
@@ -40,7 +41,9 @@ func (in *BufferedIndexInput) newBuffer(newBuffer []byte) {
 
 func (in *BufferedIndexInput) ReadByte() (b byte, err error) {
 	if in.bufferPosition >= in.bufferLength {
-		in.refill()
+		if err = in.refill(); err != nil {
+			return 0, err
+		}
 	}
 	in.bufferPosition++
 	return in.buffer[in.bufferPosition-1], nil
@@ -257,7 +260,9 @@ func (in *BufferedIndexInput) refill() error {
 		in.newBuffer(make([]byte, in.bufferSize)) // allocate buffer lazily
 		in.seekInternal(int64(in.bufferStart))
 	}
-	in.readInternal(in.buffer[0:newLength])
+	if err := in.readInternal(in.buffer[0:newLength]); err != nil {
+		return err
+	}
 	in.bufferLength = newLength
 	in.bufferStart = start
 	in.bufferPosition = 0
@@ -306,6 +311,7 @@ type BufferedIndexOutput struct {
 	buffer   []byte
 	start    int64 // position in file of buffer
 	position int   // position in buffer
+	crc      uint32
 }
 
 /*
@@ -319,7 +325,14 @@ func NewBufferedIndexOutput(size int, part flushBufferAndLength) *BufferedIndexO
 }
 
 func (out *BufferedIndexOutput) WriteByte(b byte) error {
-	panic("not implemented yet")
+	if out.position >= len(out.buffer) {
+		if err := out.flush(); err != nil {
+			return err
+		}
+	}
+	out.buffer[out.position] = b
+	out.position++
+	return nil
 }
 
 func (out *BufferedIndexOutput) WriteBytes(buf []byte) error {
@@ -350,6 +363,7 @@ func (out *BufferedIndexOutput) WriteBytes(buf []byte) error {
 		if err != nil {
 			return err
 		}
+		out.crc = crc32.Update(out.crc, crc32.IEEETable, buf)
 		out.start += int64(len(buf))
 		return nil
 	}
@@ -381,6 +395,7 @@ func (out *BufferedIndexOutput) WriteBytes(buf []byte) error {
 func (out *BufferedIndexOutput) flush() error {
 	err := out.spi.FlushBuffer(out.buffer[:out.position])
 	if err == nil {
+		out.crc = crc32.Update(out.crc, crc32.IEEETable, out.buffer[:out.position])
 		out.start += int64(out.position)
 		out.position = 0
 	}
@@ -391,6 +406,11 @@ func (out *BufferedIndexOutput) Close() error {
 	return out.flush()
 }
 
+func (out *BufferedIndexOutput) Checksum() int64 {
+	// include bytes still pending in the buffer
+	return int64(crc32.Update(out.crc, crc32.IEEETable, out.buffer[:out.position]))
+}
+
 func (out *BufferedIndexOutput) FilePointer() int64 {
 	return out.start + int64(out.position)
 }
@@ -5,9 +5,10 @@ import (
 	"fmt"
 	"github.com/balzaczyy/golucene/core/codec"
 	"github.com/balzaczyy/golucene/core/util"
-	"io"
+	"hash/crc32"
 	"log"
 	"sync"
+	"sync/atomic"
 )
 
 type FileEntry struct {
@@ -16,8 +17,9 @@ type FileEntry struct {
 
 const (
 	CFD_DATA_CODEC      = "CompoundFileWriterData"
-	CFD_VERSION_START   = 0
-	CFD_VERSION_CURRENT = CFD_VERSION_START
+	CFD_VERSION_START    = 0
+	CFD_VERSION_CHECKSUM = 1
+	CFD_VERSION_CURRENT  = CFD_VERSION_CHECKSUM
 
 	CFD_ENTRY_CODEC = "CompoundFileWriterEntries"
 
@@ -67,7 +69,12 @@ func NewCompoundFileDirectory(directory Directory, fileName string, context IOCo
 		self.DirectoryImpl.IsOpen = true
 		return self, err
 	} else {
-		panic("not supported yet")
+		_, isCFS := directory.(*CompoundFileDirectory)
+		assert2(!isCFS, "compound file inside of compound file: %v", fileName)
+		self.entries = make(map[string]FileEntry)
+		self.writer = newCompoundFileWriter(directory, fileName)
+		self.DirectoryImpl.IsOpen = true
+		return self, nil
 	}
 }
 
@@ -110,9 +117,9 @@ func (d *CompoundFileDirectory) OpenInput(name string, context IOContext) (in In
 
 func (d *CompoundFileDirectory) ListAll() (paths []string, err error) {
 	d.EnsureOpen()
-	// if self.writer != nil {
-	// 	return self.writer.ListAll()
-	// }
+	if d.writer != nil {
+		return d.writer.listAll(), nil
+	}
 	// Add the segment name
 	seg := util.ParseSegmentName(d.fileName)
 	keys := make([]string, 0, len(d.entries))
@@ -124,9 +131,9 @@ func (d *CompoundFileDirectory) ListAll() (paths []string, err error) {
 
 func (d *CompoundFileDirectory) FileExists(name string) bool {
 	d.EnsureOpen()
-	// if d.writer != nil {
-	// 	return d.writer.FileExists(name)
-	// }
+	if d.writer != nil {
+		return d.writer.fileExists(name)
+	}
 	_, ok := d.entries[util.StripSegmentName(name)]
 	return ok
 }
@@ -137,12 +144,20 @@ func (d *CompoundFileDirectory) DeleteFile(name string) error {
 
 // Returns the length of a file in the directory.
 func (d *CompoundFileDirectory) FileLength(name string) (n int64, err error) {
-	panic("not implemented yet")
+	d.EnsureOpen()
+	if d.writer != nil {
+		return d.writer.fileLength(name)
+	}
+	e, ok := d.entries[util.StripSegmentName(name)]
+	if !ok {
+		return 0, errors.New(fmt.Sprintf("file not found: %v", name))
+	}
+	return e.length, nil
 }
 
 func (d *CompoundFileDirectory) CreateOutput(name string, context IOContext) (out IndexOutput, err error) {
 	d.EnsureOpen()
-	panic("not implemented yet")
+	return d.writer.createOutput(name, context)
 }
 
 func (d *CompoundFileDirectory) Sync(names []string) error {
@@ -169,9 +184,14 @@ const (
 )
 
 func readEntries(handle IndexInputSlicer, dir Directory, name string) (mapping map[string]FileEntry, err error) {
-	var stream, entriesStream IndexInput = nil, nil
+	var stream IndexInput
+	var entriesStream *ChecksumIndexInput
 	defer func() {
-		err = util.CloseWhileHandlingError(err, stream, entriesStream)
+		if entriesStream != nil {
+			err = util.CloseWhileHandlingError(err, stream, entriesStream)
+		} else {
+			err = util.CloseWhileHandlingError(err, stream)
+		}
 	}()
 	// read the first VInt. If it is negative, it's the version number
 	// otherwise it's the count (pre-3.1 indexes)
@@ -191,7 +211,7 @@ func readEntries(handle IndexInputSlicer, dir Directory, name string) (mapping m
 					if secondByte != CODEC_MAGIC_BYTE2 ||
 						thirdByte != CODEC_MAGIC_BYTE3 ||
 						fourthByte != CODEC_MAGIC_BYTE4 {
-						return mapping, errors.New(fmt.Sprintf(
+						return mapping, codec.NewCorruptIndexErrorAt(stream, fmt.Sprintf(
 							"Illegal/impossible header for CFS file: %v,%v,%v",
 							secondByte, thirdByte, fourthByte))
 					}
@@ -202,16 +222,24 @@ func readEntries(handle IndexInputSlicer, dir Directory, name string) (mapping m
 			return mapping, err
 		}
 
-		_, err = codec.CheckHeaderNoMagic(stream, CFD_DATA_CODEC, CFD_VERSION_START, CFD_VERSION_START)
+		version, err := codec.CheckHeaderNoMagic(stream, CFD_DATA_CODEC, CFD_VERSION_START, CFD_VERSION_CURRENT)
 		if err != nil {
 			return mapping, err
 		}
+		// the data file is too large to verify here; only make sure
+		// its footer is structurally intact
+		if version >= CFD_VERSION_CHECKSUM {
+			if _, err = codec.RetrieveChecksum(stream); err != nil {
+				return mapping, err
+			}
+		}
 		entriesFileName := util.SegmentFileName(util.StripExtension(name), "", COMPOUND_FILE_ENTRIES_EXTENSION)
-		entriesStream, err = dir.OpenInput(entriesFileName, IO_CONTEXT_READONCE)
+		in, err := dir.OpenInput(entriesFileName, IO_CONTEXT_READONCE)
 		if err != nil {
 			return mapping, err
 		}
-		_, err = codec.CheckHeader(entriesStream, CFD_ENTRY_CODEC, CFD_VERSION_START, CFD_VERSION_START)
+		entriesStream = NewChecksumIndexInput(in)
+		_, err = codec.CheckHeader(entriesStream, CFD_ENTRY_CODEC, version, version)
 		if err != nil {
 			return mapping, err
 		}
@@ -226,8 +254,8 @@ func readEntries(handle IndexInputSlicer, dir Directory, name string) (mapping m
 				return mapping, err
 			}
 			if _, ok := mapping[id]; ok {
-				return mapping, errors.New(fmt.Sprintf(
-					"Duplicate cfs entry id=%v in CFS: %v", id, entriesStream))
+				return mapping, codec.NewCorruptIndexErrorAt(entriesStream, fmt.Sprintf(
+					"Duplicate cfs entry id=%v in CFS", id))
 			}
 			log.Printf("Found entry: %v", id)
 			offset, err := entriesStream.ReadLong()
@@ -240,6 +268,11 @@ func readEntries(handle IndexInputSlicer, dir Directory, name string) (mapping m
 			}
 			mapping[id] = FileEntry{offset, length}
 		}
+		if version >= CFD_VERSION_CHECKSUM {
+			if _, err = codec.CheckFooter(entriesStream); err != nil {
+				return mapping, err
+			}
+		}
 	} else {
 		// TODO remove once 3.x is not supported anymore
 		panic("not supported yet; will also be obsolete soon")
@@ -249,7 +282,367 @@ func readEntries(handle IndexInputSlicer, dir Directory, name string) (mapping m
 
 // store/CompoundFileWriter
 
-// Combines multiple files into a single compound file
+type cfwFileEntry struct {
+	// source file
+	file   string
+	length int64
+	// temporary holder for the start of this file's data section
+	offset int64
+	// which Directory this file is in, if written separately
+	dir Directory
+}
+
+/*
+Combines multiple files into a single compound file.
+
+An output can be written straight into the compound data file as long
+as no other output is doing so; outputs created concurrently are
+written to separate files, which are copied into the compound file
+(and deleted) as soon as the data file is free again.
+*/
 type CompoundFileWriter struct {
-	io.Closer
+	sync.Locker
+
+	directory Directory
+	entries   map[string]*cfwFileEntry
+	seenIDs   map[string]bool
+	// all entries that are written to a sep. file but not yet moved
+	// into CFS
+	pendingEntries []*cfwFileEntry
+	closed         bool
+	dataOut        IndexOutput
+	outputTaken    int32 // atomic
+
+	entryTableName string
+	dataFileName   string
+}
+
+/*
+Create the compound stream in the specified file. The file name is
+the entire name (no extensions are added).
+*/
+func newCompoundFileWriter(dir Directory, name string) *CompoundFileWriter {
+	assert2(dir != nil, "directory cannot be nil")
+	assert2(name != "", "name cannot be empty")
+	return &CompoundFileWriter{
+		Locker:    &sync.Mutex{},
+		directory: dir,
+		entries:   make(map[string]*cfwFileEntry),
+		seenIDs:   make(map[string]bool),
+		entryTableName: util.SegmentFileName(util.StripExtension(name), "",
+			COMPOUND_FILE_ENTRIES_EXTENSION),
+		dataFileName: name,
+	}
+}
+
+func (w *CompoundFileWriter) output() (IndexOutput, error) {
+	w.Lock() // synchronized
+	defer w.Unlock()
+	return w._output()
+}
+
+func (w *CompoundFileWriter) _output() (IndexOutput, error) {
+	if w.dataOut == nil {
+		out, err := w.directory.CreateOutput(w.dataFileName, IO_CONTEXT_DEFAULT)
+		if err != nil {
+			return nil, err
+		}
+		if err = codec.WriteHeader(out, CFD_DATA_CODEC, CFD_VERSION_CURRENT); err != nil {
+			util.CloseWhileSuppressingError(out)
+			return nil, err
+		}
+		w.dataOut = out
+	}
+	return w.dataOut, nil
+}
+
+/* Closes all resources and writes the entry table */
+func (w *CompoundFileWriter) Close() (err error) {
+	if w.closed {
+		return nil
+	}
+
+	// TODO this code should clean up after itself (remove partial .cfs/.cfe)
+	func() {
+		defer func() {
+			err = util.CloseWhileHandlingError(err, w.dataOut)
+		}()
+		w.Lock()
+		pending := len(w.pendingEntries) > 0
+		w.Unlock()
+		if pending || atomic.LoadInt32(&w.outputTaken) != 0 {
+			err = errors.New("CFS has pending open files")
+			return
+		}
+		w.closed = true
+		// open the compound stream
+		if _, err = w.output(); err != nil {
+			return
+		}
+		err = codec.WriteFooter(w.dataOut)
+	}()
+	if err != nil {
+		return err
+	}
+
+	entryTableOut, err := w.directory.CreateOutput(w.entryTableName, IO_CONTEXT_DEFAULT)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = util.CloseWhileHandlingError(err, entryTableOut)
+	}()
+	return w.writeEntryTable(entryTableOut)
+}
+
+func (w *CompoundFileWriter) ensureOpen() {
+	assert2(!w.closed, "CFS Directory is already closed")
+}
+
+/*
+Copy the contents of the file with specified extension into the
+provided output stream.
+*/
+func (w *CompoundFileWriter) copyFileEntry(dataOut IndexOutput, fileEntry *cfwFileEntry) (n int64, err error) {
+	is, err := fileEntry.dir.OpenInput(fileEntry.file, IO_CONTEXT_READONCE)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err == nil {
+			if err = util.Close(is); err == nil {
+				// copy successful - delete file
+				err = fileEntry.dir.DeleteFile(fileEntry.file)
+			}
+		} else {
+			util.CloseWhileSuppressingError(is)
+		}
+	}()
+
+	startPtr := dataOut.FilePointer()
+	length := fileEntry.length
+	if err = dataOut.CopyBytes(is, length); err != nil {
+		return 0, err
+	}
+	// Verify that the output length diff is equal to original file
+	endPtr := dataOut.FilePointer()
+	if diff := endPtr - startPtr; diff != length {
+		return 0, errors.New(fmt.Sprintf(
+			"Difference in the output file offsets %v does not match the original file length %v",
+			diff, length))
+	}
+	fileEntry.offset = startPtr
+	return length, nil
+}
+
+func (w *CompoundFileWriter) writeEntryTable(entryOut IndexOutput) error {
+	w.Lock() // synchronized
+	defer w.Unlock()
+
+	err := codec.WriteHeader(entryOut, CFD_ENTRY_CODEC, CFD_VERSION_CURRENT)
+	if err == nil {
+		err = entryOut.WriteVInt(int32(len(w.entries)))
+	}
+	for _, fe := range w.entries {
+		if err == nil {
+			err = entryOut.WriteString(util.StripSegmentName(fe.file))
+		}
+		if err == nil {
+			err = entryOut.WriteLong(fe.offset)
+		}
+		if err == nil {
+			err = entryOut.WriteLong(fe.length)
+		}
+	}
+	if err == nil {
+		err = codec.WriteFooter(entryOut)
+	}
+	return err
+}
+
+func (w *CompoundFileWriter) createOutput(name string, context IOContext) (out IndexOutput, err error) {
+	w.ensureOpen()
+
+	w.Lock()
+	if _, ok := w.entries[name]; ok {
+		w.Unlock()
+		return nil, errors.New(fmt.Sprintf("File %v already exists", name))
+	}
+	entry := &cfwFileEntry{file: name}
+	w.entries[name] = entry
+	id := util.StripSegmentName(name)
+	assert2(!w.seenIDs[id], "file='%v' maps to id='%v', which was already written", name, id)
+	w.seenIDs[id] = true
+	w.Unlock()
+
+	outputLocked := false
+	defer func() {
+		if err != nil {
+			w.Lock()
+			delete(w.entries, name)
+			w.Unlock()
+			if outputLocked { // release the output lock if not successful
+				w.releaseOutputLock()
+			}
+		}
+	}()
+
+	if outputLocked = atomic.CompareAndSwapInt32(&w.outputTaken, 0, 1); outputLocked {
+		dataOut, err := w.output()
+		if err != nil {
+			return nil, err
+		}
+		return newDirectCFSIndexOutput(w, dataOut, entry, false), nil
+	}
+
+	entry.dir = w.directory
+	if w.directory.FileExists(name) {
+		return nil, errors.New(fmt.Sprintf("File %v already exists", name))
+	}
+	delegate, err := w.directory.CreateOutput(name, context)
+	if err != nil {
+		return nil, err
+	}
+	return newDirectCFSIndexOutput(w, delegate, entry, true), nil
+}
+
+func (w *CompoundFileWriter) releaseOutputLock() {
+	atomic.CompareAndSwapInt32(&w.outputTaken, 1, 0)
+}
+
+func (w *CompoundFileWriter) prunePendingEntries() error {
+	// claim the output and copy all pending files in
+	if atomic.CompareAndSwapInt32(&w.outputTaken, 0, 1) {
+		defer func() {
+			ok := atomic.CompareAndSwapInt32(&w.outputTaken, 1, 0)
+			assert(ok)
+		}()
+		for {
+			w.Lock()
+			if len(w.pendingEntries) == 0 {
+				w.Unlock()
+				return nil
+			}
+			entry := w.pendingEntries[0]
+			w.pendingEntries = w.pendingEntries[1:]
+			w.Unlock()
+
+			dataOut, err := w.output()
+			if err != nil {
+				return err
+			}
+			if _, err = w.copyFileEntry(dataOut, entry); err != nil {
+				return err
+			}
+			w.Lock()
+			w.entries[entry.file] = entry
+			w.Unlock()
+		}
+	}
+	return nil
+}
+
+func (w *CompoundFileWriter) fileLength(name string) (int64, error) {
+	w.Lock() // synchronized
+	defer w.Unlock()
+	fileEntry, ok := w.entries[name]
+	if !ok {
+		return 0, errors.New(fmt.Sprintf("%v does not exist", name))
+	}
+	return fileEntry.length, nil
+}
+
+func (w *CompoundFileWriter) fileExists(name string) bool {
+	w.Lock() // synchronized
+	defer w.Unlock()
+	_, ok := w.entries[name]
+	return ok
+}
+
+func (w *CompoundFileWriter) listAll() []string {
+	w.Lock() // synchronized
+	defer w.Unlock()
+	names := make([]string, 0, len(w.entries))
+	for name, _ := range w.entries {
+		names = append(names, name)
+	}
+	return names
+}
+
+type directCFSIndexOutput struct {
+	*IndexOutputImpl
+	owner        *CompoundFileWriter
+	delegate     IndexOutput
+	offset       int64
+	closed       bool
+	entry        *cfwFileEntry
+	writtenBytes int64
+	isSeparate   bool
+	crc          uint32
+}
+
+func newDirectCFSIndexOutput(owner *CompoundFileWriter, delegate IndexOutput,
+	entry *cfwFileEntry, isSeparate bool) *directCFSIndexOutput {
+
+	ans := &directCFSIndexOutput{
+		owner:      owner,
+		delegate:   delegate,
+		entry:      entry,
+		offset:     delegate.FilePointer(),
+		isSeparate: isSeparate,
+	}
+	entry.offset = ans.offset
+	ans.IndexOutputImpl = NewIndexOutput(ans)
+	return ans
+}
+
+func (out *directCFSIndexOutput) Close() error {
+	if out.closed {
+		return nil
+	}
+	out.closed = true
+	out.entry.length = out.writtenBytes
+	if out.isSeparate {
+		if err := out.delegate.Close(); err != nil {
+			return err
+		}
+		// we are a separate file - push into the pending entries
+		out.owner.Lock()
+		out.owner.pendingEntries = append(out.owner.pendingEntries, out.entry)
+		out.owner.Unlock()
+	} else {
+		// we have been written into the CFS directly - release the lock
+		out.owner.releaseOutputLock()
+	}
+	// now prune all pending entries and push them into the CFS
+	return out.owner.prunePendingEntries()
+}
+
+func (out *directCFSIndexOutput) FilePointer() int64 {
+	return out.delegate.FilePointer() - out.offset
+}
+
+func (out *directCFSIndexOutput) Length() (int64, error) {
+	assert(!out.closed)
+	n, err := out.delegate.Length()
+	return n - out.offset, err
+}
+
+func (out *directCFSIndexOutput) WriteByte(b byte) error {
+	assert(!out.closed)
+	out.writtenBytes++
+	out.crc = crc32.Update(out.crc, crc32.IEEETable, []byte{b})
+	return out.delegate.WriteByte(b)
+}
+
+func (out *directCFSIndexOutput) WriteBytes(buf []byte) error {
+	assert(!out.closed)
+	out.writtenBytes += int64(len(buf))
+	out.crc = crc32.Update(out.crc, crc32.IEEETable, buf)
+	return out.delegate.WriteBytes(buf)
+}
+
+/* Unlike the delegate's, covers only the bytes of this entry. */
+func (out *directCFSIndexOutput) Checksum() int64 {
+	return int64(out.crc)
 }
@@ -53,3 +53,81 @@ func TestCheckHeaderWin8(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestCompoundFileWriter(t *testing.T) {
+	dir := NewRAMDirectory()
+	cfs, err := NewCompoundFileDirectory(dir, "_1.cfs", IO_CONTEXT_DEFAULT, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(out IndexOutput, n int) {
+		for i := 0; i < n; i++ {
+			if err := out.WriteVInt(int32(i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// The first output goes straight into the data file, while the
+	// second, opened concurrently, is spilled to a separate file:
+	direct, err := cfs.CreateOutput("_1.fdt", IO_CONTEXT_DEFAULT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	separate, err := cfs.CreateOutput("_1_Lucene41_0.doc", IO_CONTEXT_DEFAULT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(direct, 1000)
+	write(separate, 300)
+	if err = separate.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = direct.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if dir.FileExists("_1_Lucene41_0.doc") {
+		t.Error("Separate file should be deleted once copied into the CFS.")
+	}
+
+	// Copying existing files, as createCompoundFile does:
+	out, err := dir.CreateOutput("_1.fnm", IO_CONTEXT_DEFAULT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(out, 10)
+	if err = out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = dir.Copy(cfs, "_1.fnm", "_1.fnm", IO_CONTEXT_DEFAULT); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := cfs.ListAll(); len(names) != 3 {
+		t.Errorf("Expected 3 entries, but found %v", names)
+	}
+	if err = cfs.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cfs, err = NewCompoundFileDirectory(dir, "_1.cfs", IO_CONTEXT_DEFAULT, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cfs.Close()
+	for name, n := range map[string]int{"_1.fdt": 1000, "_1_Lucene41_0.doc": 300, "_1.fnm": 10} {
+		in, err := cfs.OpenInput(name, IO_CONTEXT_DEFAULT)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < n; i++ {
+			if v, err := in.ReadVInt(); err != nil || int(v) != i {
+				t.Fatalf("%v: expected %v at #%v, but found %v (%v)", name, i, i, v, err)
+			}
+		}
+		if in.FilePointer() != in.Length() {
+			t.Errorf("%v: expected EOF at %v, but found %v", name, in.Length(), in.FilePointer())
+		}
+		in.Close()
+	}
+}
@@ -358,7 +358,6 @@ func (d *DirectoryImpl) Copy(to Directory, src, dest string, ctx IOContext) (err
 }
 
 func (d *DirectoryImpl) CreateSlicer(name string, context IOContext) (is IndexInputSlicer, err error) {
-	panic("Should be overrided, I guess")
 	d.EnsureOpen()
 	base, err := d.OpenInput(name, context)
 	if err != nil {
@@ -394,7 +393,7 @@ func (is simpleIndexInputSlicer) Close() error {
 }
 
 func (is simpleIndexInputSlicer) openFullSlice() IndexInput {
-	return is.base
+	return is.base.Clone()
 }
 
 type SlicedIndexInput struct {
@@ -409,7 +408,8 @@ func newSlicedIndexInput(desc string, base IndexInput, fileOffset, length int64)
 }
 
 func newSlicedIndexInputBySize(desc string, base IndexInput, fileOffset, length int64, bufferSize int) *SlicedIndexInput {
-	ans := &SlicedIndexInput{base: base, fileOffset: fileOffset, length: length}
+	// slices must not share the file position, nor close the base
+	ans := &SlicedIndexInput{base: base.Clone(), fileOffset: fileOffset, length: length}
 	ans.BufferedIndexInput = newBufferedIndexInputBySize(ans, fmt.Sprintf(
 		"SlicedIndexInput(%v in %v slice=%v:%v)",
 		desc, base, fileOffset, fileOffset+length), bufferSize)
@@ -438,10 +438,12 @@ func (in *SlicedIndexInput) Length() int64 {
 }
 
 func (in *SlicedIndexInput) Clone() IndexInput {
-	return &SlicedIndexInput{
+	ans := &SlicedIndexInput{
 		in.BufferedIndexInput.Clone(),
 		in.base.Clone(),
 		in.fileOffset,
 		in.length,
 	}
+	ans.SeekReader = ans
+	return ans
 }
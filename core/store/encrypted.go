@@ -0,0 +1,352 @@
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/balzaczyy/golucene/core/util"
+	"io"
+)
+
+/*
+Provides the keys EncryptedDirectory encrypts files with. Each key is
+identified by an id, which is recorded in the header of every file,
+so keys can be rotated: new files are encrypted with the current key,
+while existing ones are still decrypted with the key they were
+written with.
+
+Keys must be 16, 24 or 32 bytes long, to select AES-128, AES-192 or
+AES-256 respectively.
+*/
+type KeyProvider interface {
+	// Returns the key new files should be encrypted with, and its id.
+	CurrentKey() (id int32, key []byte, err error)
+	// Returns the key with the given id.
+	Key(id int32) (key []byte, err error)
+}
+
+/* A KeyProvider serving a single key, with id 0. */
+type StaticKeyProvider struct {
+	key []byte
+}
+
+func NewStaticKeyProvider(key []byte) *StaticKeyProvider {
+	return &StaticKeyProvider{key}
+}
+
+func (kp *StaticKeyProvider) CurrentKey() (int32, []byte, error) {
+	return 0, kp.key, nil
+}
+
+func (kp *StaticKeyProvider) Key(id int32) ([]byte, error) {
+	if id != 0 {
+		return nil, errors.New(fmt.Sprintf("Unknown key id: %v", id))
+	}
+	return kp.key, nil
+}
+
+const (
+	ENCRYPTED_MAGIC         = 0x474c4543 // "GLEC"
+	ENCRYPTED_VERSION_START = 0
+
+	// magic, version, key id, then the IV
+	ENCRYPTED_HEADER_LENGTH = 4 + 4 + 4 + aes.BlockSize
+)
+
+/*
+A Directory wrapper encrypting every file at rest with AES in CTR
+mode. Each file starts with a fixed-size plain text header holding
+the id of the key used (see KeyProvider) and a random IV, unique to
+the file. As CTR is a stream cipher, the encrypted file has the same
+length as the plain one, and any position can be decrypted on its
+own, so inputs support random access Seek(), cloning and slicing as
+usual.
+
+The wrapped directory only sees encrypted bytes; everything stacked
+on top of this wrapper, e.g. CompoundFileDirectory or
+RateLimitedDirectoryWrapper, sees plain bytes. Note that an
+NRTCachingDirectory on top of this wrapper keeps its cached files in
+plain text in memory, which is usually fine; wrap the
+NRTCachingDirectory instead to keep them encrypted too.
+
+NOTE: CTR mode provides confidentiality, not integrity; tampering is
+detected by the checksum footers of the index files, not by this
+wrapper.
+*/
+type EncryptedDirectory struct {
+	Directory
+	keys KeyProvider
+}
+
+func NewEncryptedDirectory(delegate Directory, keys KeyProvider) *EncryptedDirectory {
+	return &EncryptedDirectory{delegate, keys}
+}
+
+/* Returns the plain text length of the file. */
+func (d *EncryptedDirectory) FileLength(name string) (int64, error) {
+	length, err := d.Directory.FileLength(name)
+	if err != nil {
+		return 0, err
+	}
+	if length < ENCRYPTED_HEADER_LENGTH {
+		return 0, errors.New(fmt.Sprintf(
+			"file '%v' is too short (%v bytes) to be encrypted", name, length))
+	}
+	return length - ENCRYPTED_HEADER_LENGTH, nil
+}
+
+func (d *EncryptedDirectory) CreateOutput(name string, context IOContext) (IndexOutput, error) {
+	d.EnsureOpen()
+	id, key, err := d.keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err = io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+
+	out, err := d.Directory.CreateOutput(name, context)
+	if err != nil {
+		return nil, err
+	}
+	if err = writeEncryptedHeader(out, id, iv); err != nil {
+		util.CloseWhileSuppressingError(out)
+		return nil, err
+	}
+	return newEncryptedIndexOutput(out, cipher.NewCTR(block, iv)), nil
+}
+
+func writeEncryptedHeader(out IndexOutput, id int32, iv []byte) (err error) {
+	if err = out.WriteInt(ENCRYPTED_MAGIC); err == nil {
+		if err = out.WriteInt(ENCRYPTED_VERSION_START); err == nil {
+			if err = out.WriteInt(id); err == nil {
+				err = out.WriteBytes(iv)
+			}
+		}
+	}
+	return
+}
+
+func (d *EncryptedDirectory) OpenInput(name string, context IOContext) (IndexInput, error) {
+	d.EnsureOpen()
+	in, err := d.Directory.OpenInput(name, context)
+	if err != nil {
+		return nil, err
+	}
+	block, iv, err := d.readEncryptedHeader(in)
+	if err != nil {
+		util.CloseWhileSuppressingError(in)
+		return nil, err
+	}
+	return newEncryptedIndexInput(fmt.Sprintf("EncryptedIndexInput(%v)", in),
+		in, block, iv, context), nil
+}
+
+func (d *EncryptedDirectory) readEncryptedHeader(in IndexInput) (block cipher.Block, iv []byte, err error) {
+	if in.Length() < ENCRYPTED_HEADER_LENGTH {
+		return nil, nil, errors.New(fmt.Sprintf(
+			"file is too short (%v bytes) to be encrypted (resource=%v)", in.Length(), in))
+	}
+	magic, err := in.ReadInt()
+	if err != nil {
+		return nil, nil, err
+	}
+	if magic != ENCRYPTED_MAGIC {
+		return nil, nil, errors.New(fmt.Sprintf(
+			"file is not encrypted: expected header=%v, got %v (resource=%v)",
+			ENCRYPTED_MAGIC, magic, in))
+	}
+	version, err := in.ReadInt()
+	if err != nil {
+		return nil, nil, err
+	}
+	if version != ENCRYPTED_VERSION_START {
+		return nil, nil, errors.New(fmt.Sprintf(
+			"Unsupported encryption version: %v (resource=%v)", version, in))
+	}
+	id, err := in.ReadInt()
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := d.keys.Key(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if block, err = aes.NewCipher(key); err != nil {
+		return nil, nil, err
+	}
+	iv = make([]byte, aes.BlockSize)
+	if err = in.ReadBytes(iv); err != nil {
+		return nil, nil, err
+	}
+	return block, iv, nil
+}
+
+/*
+Compound files and other slicers must read through OpenInput(), so
+the slices are decrypted.
+*/
+func (d *EncryptedDirectory) CreateSlicer(name string, context IOContext) (IndexInputSlicer, error) {
+	d.EnsureOpen()
+	base, err := d.OpenInput(name, context)
+	if err != nil {
+		return nil, err
+	}
+	return simpleIndexInputSlicer{base}, nil
+}
+
+/* Copies the plain text of src, re-encrypting it if to is encrypted as well. */
+func (d *EncryptedDirectory) Copy(to Directory, src, dest string, context IOContext) (err error) {
+	var out IndexOutput
+	var in IndexInput
+	defer func() {
+		if err = util.CloseWhileHandlingError(err, out, in); err != nil && out != nil {
+			to.DeleteFile(dest) // ignore error
+		}
+	}()
+
+	if out, err = to.CreateOutput(dest, context); err != nil {
+		return err
+	}
+	if in, err = d.OpenInput(src, context); err != nil {
+		return err
+	}
+	return out.CopyBytes(in, in.Length())
+}
+
+func (d *EncryptedDirectory) String() string {
+	return fmt.Sprintf("EncryptedDirectory(%v)", d.Directory)
+}
+
+/*
+Returns a CTR stream positioned at the given offset of the plain text,
+i.e. with the counter advanced by the number of whole blocks, and the
+key stream of the partial block skipped.
+*/
+func newCTRAt(block cipher.Block, iv []byte, pos int64) cipher.Stream {
+	counter := make([]byte, len(iv))
+	copy(counter, iv)
+	// add the block index to the big-endian counter, with carry
+	carry := uint64(pos / int64(block.BlockSize()))
+	for i := len(counter) - 1; i >= 0 && carry > 0; i-- {
+		sum := uint64(counter[i]) + carry&0xFF
+		counter[i] = byte(sum)
+		carry = carry>>8 + sum>>8
+	}
+	stream := cipher.NewCTR(block, counter)
+	if skip := int(pos % int64(block.BlockSize())); skip > 0 {
+		var scratch [aes.BlockSize]byte
+		stream.XORKeyStream(scratch[:skip], scratch[:skip])
+	}
+	return stream
+}
+
+/* Encrypts the bytes written, in the order they're written. */
+type encryptedIndexOutput struct {
+	*BufferedIndexOutput
+	delegate IndexOutput
+	stream   cipher.Stream
+	scratch  []byte
+	written  int64 // plain text bytes encrypted so far
+}
+
+func newEncryptedIndexOutput(delegate IndexOutput, stream cipher.Stream) *encryptedIndexOutput {
+	ans := &encryptedIndexOutput{delegate: delegate, stream: stream}
+	ans.BufferedIndexOutput = NewBufferedIndexOutput(DEFAULT_BUFFER_SIZE, ans)
+	return ans
+}
+
+func (out *encryptedIndexOutput) FlushBuffer(buf []byte) error {
+	// the caller may still use buf, e.g. to update its checksum
+	if cap(out.scratch) < len(buf) {
+		out.scratch = make([]byte, len(buf))
+	}
+	scratch := out.scratch[:len(buf)]
+	out.stream.XORKeyStream(scratch, buf)
+	out.written += int64(len(buf))
+	return out.delegate.WriteBytes(scratch)
+}
+
+func (out *encryptedIndexOutput) Length() (int64, error) {
+	return out.written, nil
+}
+
+func (out *encryptedIndexOutput) Close() error {
+	defer out.delegate.Close()
+	return out.BufferedIndexOutput.Close()
+}
+
+func (out *encryptedIndexOutput) String() string {
+	return fmt.Sprintf("EncryptedIndexOutput(%v)", out.delegate)
+}
+
+/*
+Decrypts the bytes read from the delegate. Each refill of the buffer
+derives the CTR counter from the position being read, so seeking
+costs no more than with any other buffered input.
+*/
+type encryptedIndexInput struct {
+	*BufferedIndexInput
+	delegate IndexInput
+	block    cipher.Block
+	iv       []byte
+	isClone  bool
+}
+
+func newEncryptedIndexInput(desc string, delegate IndexInput,
+	block cipher.Block, iv []byte, context IOContext) *encryptedIndexInput {
+
+	ans := &encryptedIndexInput{delegate: delegate, block: block, iv: iv}
+	ans.BufferedIndexInput = newBufferedIndexInput(ans, desc, context)
+	return ans
+}
+
+func (in *encryptedIndexInput) readInternal(buf []byte) error {
+	pos := in.FilePointer()
+	if pos+int64(len(buf)) > in.Length() {
+		return errors.New(fmt.Sprintf("read past EOF: %v", in))
+	}
+	if err := in.delegate.Seek(ENCRYPTED_HEADER_LENGTH + pos); err != nil {
+		return err
+	}
+	if err := in.delegate.ReadBytes(buf); err != nil {
+		return err
+	}
+	newCTRAt(in.block, in.iv, pos).XORKeyStream(buf, buf)
+	return nil
+}
+
+func (in *encryptedIndexInput) seekInternal(pos int64) error {
+	return nil // the counter is derived from the position on each read
+}
+
+func (in *encryptedIndexInput) Length() int64 {
+	return in.delegate.Length() - ENCRYPTED_HEADER_LENGTH
+}
+
+func (in *encryptedIndexInput) Clone() IndexInput {
+	ans := &encryptedIndexInput{
+		BufferedIndexInput: in.BufferedIndexInput.Clone(),
+		delegate:           in.delegate.Clone(),
+		block:              in.block,
+		iv:                 in.iv,
+		isClone:            true,
+	}
+	ans.SeekReader = ans
+	return ans
+}
+
+func (in *encryptedIndexInput) Close() error {
+	// only close the delegate if this is not a clone
+	if !in.isClone {
+		return in.delegate.Close()
+	}
+	return nil
+}
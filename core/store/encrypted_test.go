@@ -0,0 +1,183 @@
+package store
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+// Rotates between two keys, to check that files remember theirs.
+type rotatingKeyProvider struct {
+	current int32
+}
+
+func (kp *rotatingKeyProvider) CurrentKey() (int32, []byte, error) {
+	key, err := kp.Key(kp.current)
+	return kp.current, key, err
+}
+
+func (kp *rotatingKeyProvider) Key(id int32) ([]byte, error) {
+	key := make([]byte, 16)
+	copy(key, testKey)
+	key[0] = byte(id)
+	return key, nil
+}
+
+func TestEncryptedDirectory(t *testing.T) {
+	raw := NewRAMDirectory()
+	keys := &rotatingKeyProvider{}
+	dir := NewEncryptedDirectory(raw, keys)
+
+	data := make([]byte, 3*DEFAULT_BUFFER_SIZE+123)
+	rnd := rand.New(rand.NewSource(42))
+	rnd.Read(data)
+	writeTestFile(t, dir, "a.bin", data)
+	keys.current = 1
+	writeTestFile(t, dir, "b.bin", data[:100])
+
+	// the raw file is the header followed by the cipher text
+	if n, _ := raw.FileLength("a.bin"); n != int64(len(data))+ENCRYPTED_HEADER_LENGTH {
+		t.Errorf("unexpected raw length %v", n)
+	}
+	if n, _ := dir.FileLength("a.bin"); n != int64(len(data)) {
+		t.Errorf("unexpected length %v", n)
+	}
+	rawIn, err := raw.OpenInput("a.bin", IO_CONTEXT_DEFAULT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawBytes := make([]byte, rawIn.Length())
+	rawIn.ReadBytes(rawBytes)
+	rawIn.Close()
+	if bytes.Contains(rawBytes, data[:64]) {
+		t.Error("file content is stored in plain text")
+	}
+
+	// the IV is random, so the same content encrypts differently
+	writeTestFile(t, dir, "c.bin", data[:100])
+	b, _ := raw.OpenInput("b.bin", IO_CONTEXT_DEFAULT)
+	c, _ := raw.OpenInput("c.bin", IO_CONTEXT_DEFAULT)
+	bb, cb := make([]byte, b.Length()), make([]byte, c.Length())
+	b.ReadBytes(bb)
+	c.ReadBytes(cb)
+	b.Close()
+	c.Close()
+	if bytes.Equal(bb[ENCRYPTED_HEADER_LENGTH:], cb[ENCRYPTED_HEADER_LENGTH:]) {
+		t.Error("two files share the same key stream")
+	}
+
+	in, err := dir.OpenInput("a.bin", IO_CONTEXT_DEFAULT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	buf := make([]byte, len(data))
+	if err = in.ReadBytes(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, data) {
+		t.Fatal("content mismatch")
+	}
+	// random access, in and across cipher blocks
+	clone := in.Clone()
+	for i := 0; i < 200; i++ {
+		pos := rnd.Int63n(int64(len(data) - 40))
+		n := rnd.Intn(40) + 1
+		if err = clone.Seek(pos); err != nil {
+			t.Fatal(err)
+		}
+		if err = clone.ReadBytes(buf[:n]); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf[:n], data[pos:pos+int64(n)]) {
+			t.Fatalf("content mismatch at %v", pos)
+		}
+	}
+
+	in2, err := dir.OpenInput("b.bin", IO_CONTEXT_DEFAULT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = in2.ReadBytes(buf[:100]); err != nil || !bytes.Equal(buf[:100], data[:100]) {
+		t.Errorf("file encrypted with the second key mismatch: %v", err)
+	}
+	in2.Close()
+
+	if _, err = NewEncryptedDirectory(raw, NewStaticKeyProvider(testKey)).OpenInput("b.bin", IO_CONTEXT_DEFAULT); err == nil {
+		t.Error("expected error opening a file encrypted with an unknown key")
+	}
+	writeTestFile(t, raw, "plain.bin", data[:100])
+	if _, err = dir.OpenInput("plain.bin", IO_CONTEXT_DEFAULT); err == nil {
+		t.Error("expected error opening a file which is not encrypted")
+	}
+}
+
+func TestEncryptedDirectoryComposition(t *testing.T) {
+	data := make([]byte, 5000)
+	rand.New(rand.NewSource(7)).Read(data)
+
+	for _, newDir := range []func() Directory{
+		func() Directory { // rate limited writes of encrypted files
+			d := NewRateLimitedDirectoryWrapper(NewEncryptedDirectory(NewRAMDirectory(), NewStaticKeyProvider(testKey)))
+			d.SetMaxWriteMBPerSec(1000, int(IO_CONTEXT_TYPE_DEFAULT))
+			return d
+		},
+		func() Directory { // encrypting rate limited writes
+			d := NewRateLimitedDirectoryWrapper(NewRAMDirectory())
+			d.SetMaxWriteMBPerSec(1000, int(IO_CONTEXT_TYPE_DEFAULT))
+			return NewEncryptedDirectory(d, NewStaticKeyProvider(testKey))
+		},
+		func() Directory { // cached files are flushed encrypted
+			return NewNRTCachingDirectory(NewEncryptedDirectory(NewRAMDirectory(), NewStaticKeyProvider(testKey)), 5, 60)
+		},
+		func() Directory {
+			return NewEncryptedDirectory(NewNRTCachingDirectory(NewRAMDirectory(), 5, 60), NewStaticKeyProvider(testKey))
+		},
+	} {
+		dir := newDir()
+		cfs, err := NewCompoundFileDirectory(dir, "_0.cfs", IO_CONTEXT_DEFAULT, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// one entry written straight into the data file, one copied in
+		direct, err := cfs.CreateOutput("_0.fdt", IO_CONTEXT_DEFAULT)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeTestFile(t, cfs, "_0.tim", data[1000:])
+		if err = direct.WriteBytes(data[:1000]); err != nil {
+			t.Fatal(err)
+		}
+		if err = direct.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err = cfs.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err = dir.Sync([]string{"_0.cfs", "_0.cfe"}); err != nil {
+			t.Fatal(err)
+		}
+
+		cfs, err = NewCompoundFileDirectory(dir, "_0.cfs", IO_CONTEXT_DEFAULT, false)
+		if err != nil {
+			t.Fatalf("%v: %v", dir, err)
+		}
+		for name, expected := range map[string][]byte{"_0.fdt": data[:1000], "_0.tim": data[1000:]} {
+			in, err := cfs.OpenInput(name, IO_CONTEXT_DEFAULT)
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, in.Length())
+			if err = in.ReadBytes(buf); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf, expected) {
+				t.Errorf("%v: %v content mismatch", dir, name)
+			}
+			in.Close()
+		}
+		cfs.Close()
+	}
+}
@@ -0,0 +1,161 @@
+package store
+
+import (
+	"fmt"
+	"github.com/balzaczyy/golucene/core/util"
+	"strings"
+)
+
+// store/FileSwitchDirectory.java
+
+/*
+Expert: A Directory instance that switches files between two other
+Directory instances.
+
+Files with the specified extensions are placed in the primary
+directory; others are placed in the secondary directory. The provided
+map must not change once passed to this class, as it's read without
+synchronization.
+
+For example, to keep the postings and term dictionaries on SSD and
+the rest (e.g. stored fields) on spinning disk:
+
+	primaryExtensions := map[string]bool{"tim": true, "tip": true,
+		"doc": true, "pos": true, "pay": true}
+	dir := NewFileSwitchDirectory(primaryExtensions, ssdDir, diskDir, true)
+
+Locking is done through the primary directory.
+*/
+type FileSwitchDirectory struct {
+	*DirectoryImpl
+	primaryExtensions        map[string]bool
+	primaryDir, secondaryDir Directory
+	doClose                  bool
+}
+
+func NewFileSwitchDirectory(primaryExtensions map[string]bool,
+	primaryDir, secondaryDir Directory, doClose bool) *FileSwitchDirectory {
+
+	ans := &FileSwitchDirectory{
+		primaryExtensions: primaryExtensions,
+		primaryDir:        primaryDir,
+		secondaryDir:      secondaryDir,
+		doClose:           doClose,
+	}
+	ans.DirectoryImpl = NewDirectoryImpl(ans)
+	// share the primary's lock factory as is; its lock prefix is
+	// already set up for the primary directory
+	ans.lockFactory = primaryDir.LockFactory()
+	return ans
+}
+
+/* Return the primary directory */
+func (d *FileSwitchDirectory) PrimaryDir() Directory {
+	return d.primaryDir
+}
+
+/* Return the secondary directory */
+func (d *FileSwitchDirectory) SecondaryDir() Directory {
+	return d.secondaryDir
+}
+
+func (d *FileSwitchDirectory) Close() error {
+	if d.doClose {
+		d.doClose = false
+		d.IsOpen = false
+		return util.Close(d.primaryDir, d.secondaryDir)
+	}
+	return nil
+}
+
+func (d *FileSwitchDirectory) ListAll() (all []string, err error) {
+	files := make(map[string]bool)
+	// LUCENE-3380: either or both of our dirs could be FSDirs, but if
+	// one underlying delegate is an FSDir and mkdirs() has not yet been
+	// called, because so far everything is written to the other, in
+	// this case, we don't want to return a NoSuchDirectoryError
+	var exc error
+	failed := 0
+	for _, dir := range []Directory{d.primaryDir, d.secondaryDir} {
+		names, err := dir.ListAll()
+		if err != nil {
+			if _, ok := err.(*NoSuchDirectoryError); !ok {
+				return nil, err
+			}
+			exc = err
+			failed++
+			continue
+		}
+		for _, f := range names {
+			files[f] = true
+		}
+	}
+	// only fail if both dirs don't exist
+	if failed == 2 {
+		return nil, exc
+	}
+	all = make([]string, 0, len(files))
+	for f, _ := range files {
+		all = append(all, f)
+	}
+	return all, nil
+}
+
+/* Utility method to return a file's extension. */
+func FileExtension(name string) string {
+	if i := strings.LastIndex(name, "."); i != -1 {
+		return name[i+1:]
+	}
+	return ""
+}
+
+/* Return the directory the given file is, or would be, stored in. */
+func (d *FileSwitchDirectory) Directory(name string) Directory {
+	if d.primaryExtensions[FileExtension(name)] {
+		return d.primaryDir
+	}
+	return d.secondaryDir
+}
+
+func (d *FileSwitchDirectory) FileExists(name string) bool {
+	return d.Directory(name).FileExists(name)
+}
+
+func (d *FileSwitchDirectory) DeleteFile(name string) error {
+	return d.Directory(name).DeleteFile(name)
+}
+
+func (d *FileSwitchDirectory) FileLength(name string) (int64, error) {
+	return d.Directory(name).FileLength(name)
+}
+
+func (d *FileSwitchDirectory) CreateOutput(name string, context IOContext) (IndexOutput, error) {
+	return d.Directory(name).CreateOutput(name, context)
+}
+
+func (d *FileSwitchDirectory) Sync(names []string) error {
+	var primaryNames, secondaryNames []string
+	for _, name := range names {
+		if d.primaryExtensions[FileExtension(name)] {
+			primaryNames = append(primaryNames, name)
+		} else {
+			secondaryNames = append(secondaryNames, name)
+		}
+	}
+	if err := d.primaryDir.Sync(primaryNames); err != nil {
+		return err
+	}
+	return d.secondaryDir.Sync(secondaryNames)
+}
+
+func (d *FileSwitchDirectory) OpenInput(name string, context IOContext) (IndexInput, error) {
+	return d.Directory(name).OpenInput(name, context)
+}
+
+func (d *FileSwitchDirectory) CreateSlicer(name string, context IOContext) (IndexInputSlicer, error) {
+	return d.Directory(name).CreateSlicer(name, context)
+}
+
+func (d *FileSwitchDirectory) String() string {
+	return fmt.Sprintf("FileSwitchDirectory(primary=%v, secondary=%v)", d.primaryDir, d.secondaryDir)
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestFileSwitchDirectory(t *testing.T) {
+	primary, secondary := NewRAMDirectory(), NewRAMDirectory()
+	d := NewFileSwitchDirectory(map[string]bool{"tim": true, "doc": true},
+		primary, secondary, true)
+	tracking := NewTrackingDirectoryWrapper(d)
+
+	for _, name := range []string{"_0.tim", "_0.doc", "_0.fdt", "segments_1"} {
+		writeTestFile(t, tracking, name, []byte(name))
+	}
+	for name, dir := range map[string]*RAMDirectory{
+		"_0.tim": primary, "_0.doc": primary, "_0.fdt": secondary, "segments_1": secondary,
+	} {
+		if !dir.FileExists(name) {
+			t.Errorf("%v should be stored in %v", name, dir)
+		}
+		if d.Directory(name) != Directory(dir) {
+			t.Errorf("%v should be routed to %v", name, dir)
+		}
+		if n, err := d.FileLength(name); err != nil || n != int64(len(name)) {
+			t.Errorf("%v: unexpected length %v (%v)", name, n, err)
+		}
+	}
+
+	all, err := d.ListAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(all)
+	if len(all) != 4 || all[0] != "_0.doc" || all[3] != "segments_1" {
+		t.Errorf("unexpected files: %v", all)
+	}
+
+	if err = tracking.DeleteFile("_0.doc"); err != nil {
+		t.Fatal(err)
+	}
+	created := tracking.CreatedFiles()
+	if len(created) != 3 || !created["_0.tim"] || !created["_0.fdt"] || !created["segments_1"] {
+		t.Errorf("unexpected created files: %v", created)
+	}
+	if primary.FileExists("_0.doc") {
+		t.Error("_0.doc should have been deleted")
+	}
+
+	// locking goes through the primary directory
+	lock := d.MakeLock("write.lock")
+	if ok, err := lock.Obtain(); !ok || err != nil {
+		t.Fatalf("failed to obtain lock: %v", err)
+	}
+	if !primary.MakeLock("write.lock").IsLocked() {
+		t.Error("lock should be held in the primary directory")
+	}
+	lock.Release()
+
+	if err = d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if primary.IsOpen || secondary.IsOpen {
+		t.Error("sub directories should be closed")
+	}
+}
+
+func TestFileSwitchDirectoryListAllMissingDir(t *testing.T) {
+	path, err := ioutil.TempDir("", "golucene")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+	primary, err := NewSimpleFSDirectory(filepath.Join(path, "primary"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondary, err := NewSimpleFSDirectory(filepath.Join(path, "secondary"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewFileSwitchDirectory(map[string]bool{"tim": true}, primary, secondary, true)
+	defer d.Close()
+
+	if _, err = d.ListAll(); err == nil {
+		t.Error("expected error when neither directory exists")
+	}
+	// only the secondary is created so far
+	writeTestFile(t, d, "_0.fdt", nil)
+	all, err := d.ListAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0] != "_0.fdt" {
+		t.Errorf("unexpected files: %v", all)
+	}
+}
@@ -4,11 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"github.com/balzaczyy/golucene/core/util"
-	"log"
+	"io/ioutil"
 	"math"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 )
 
@@ -48,18 +49,95 @@ func newFSDirectory(self Directory, path string) (d *FSDirectory, err error) {
 		return d, newNoSuchDirectoryError(fmt.Sprintf("file '%v' exists but is not a directory", path))
 	}
 
-	// TODO default to native lock factory
-	d.SetLockFactory(NewSimpleFSLockFactory(path))
+	if NATIVE_LOCKS_SUPPORTED {
+		d.SetLockFactory(NewNativeFSLockFactory(path))
+	} else {
+		d.SetLockFactory(NewSimpleFSLockFactory(path))
+	}
 	return d, nil
 }
 
+/* The FSDirectory implementations OpenFSDirectoryOfType() can open. */
+type FSDirectoryType int
+
+const (
+	// Let OpenFSDirectory() choose, based on platform and index size.
+	FS_DIRECTORY_AUTO = FSDirectoryType(iota)
+	FS_DIRECTORY_MMAP
+	FS_DIRECTORY_NIO
+	FS_DIRECTORY_SIMPLE
+)
+
+/* Parses the names accepted by the command line tools. */
+func ParseFSDirectoryType(name string) (FSDirectoryType, error) {
+	switch strings.ToLower(name) {
+	case "", "auto":
+		return FS_DIRECTORY_AUTO, nil
+	case "mmap", "mmapdirectory":
+		return FS_DIRECTORY_MMAP, nil
+	case "nio", "niofs", "niofsdirectory":
+		return FS_DIRECTORY_NIO, nil
+	case "simple", "simplefs", "simplefsdirectory":
+		return FS_DIRECTORY_SIMPLE, nil
+	}
+	return FS_DIRECTORY_AUTO, errors.New(fmt.Sprintf("unknown FSDirectory type: %v", name))
+}
+
+/*
+On 32 bit platforms, indexes up to this size are still memory mapped
+by OpenFSDirectory(); larger ones would risk exhausting the address
+space.
+*/
+const MMAP_MAX_INDEX_SIZE_32BIT = 256 << 20
+
+const is64Bit = ^uint(0)>>63 == 1
+
+/*
+Creates an FSDirectory instance, trying to pick the best
+implementation given the current environment:
+
+- MMapDirectory on 64 bit platforms supporting mmap, or on 32 bit
+ones if the index is small enough to be mapped safely;
+- NIOFSDirectory otherwise.
+
+Use OpenFSDirectoryOfType() to override the choice.
+*/
 func OpenFSDirectory(path string) (d Directory, err error) {
-	// TODO support native implementations
-	super, err := NewSimpleFSDirectory(path)
+	return OpenFSDirectoryOfType(path, FS_DIRECTORY_AUTO)
+}
+
+/* Creates an FSDirectory instance of the given type. */
+func OpenFSDirectoryOfType(path string, typ FSDirectoryType) (d Directory, err error) {
+	if typ == FS_DIRECTORY_AUTO {
+		typ = FS_DIRECTORY_NIO
+		if MMAP_SUPPORTED && (is64Bit || indexSize(path) <= MMAP_MAX_INDEX_SIZE_32BIT) {
+			typ = FS_DIRECTORY_MMAP
+		}
+	}
+	switch typ {
+	case FS_DIRECTORY_MMAP:
+		return NewMMapDirectory(path)
+	case FS_DIRECTORY_NIO:
+		return NewNIOFSDirectory(path)
+	case FS_DIRECTORY_SIMPLE:
+		return NewSimpleFSDirectory(path)
+	}
+	return nil, errors.New(fmt.Sprintf("unknown FSDirectory type: %v", typ))
+}
+
+// Returns the total size of the files in path; a missing directory
+// counts as an empty index.
+func indexSize(path string) (size int64) {
+	fis, err := ioutil.ReadDir(path)
 	if err != nil {
-		return nil, err
+		return 0
 	}
-	return super, nil
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			size += fi.Size()
+		}
+	}
+	return size
 }
 
 func (d *FSDirectory) SetLockFactory(lockFactory LockFactory) {
@@ -68,7 +146,14 @@ func (d *FSDirectory) SetLockFactory(lockFactory LockFactory) {
 	// for filesystem based LockFactory, delete the lockPrefix, if the locks are placed
 	// in index dir. If no index dir is given, set ourselves
 	// TODO change FSDirectory to interface
-	if lf, ok := lockFactory.(*SimpleFSLockFactory); ok {
+	var lf *FSLockFactory
+	switch f := lockFactory.(type) {
+	case *SimpleFSLockFactory:
+		lf = f.FSLockFactory
+	case *NativeFSLockFactory:
+		lf = f.FSLockFactory
+	}
+	if lf != nil {
 		if lf.lockDir == "" {
 			lf.lockDir = d.path
 			lf.lockPrefix = ""
@@ -102,9 +187,8 @@ func (d *FSDirectory) ListAll() (paths []string, err error) {
 
 func (d *FSDirectory) FileExists(name string) bool {
 	d.EnsureOpen()
-	_, err := os.Stat(name)
-	log.Println("DEBUG2 ")
-	return err != nil
+	_, err := os.Stat(filepath.Join(d.path, name))
+	return err == nil
 }
 
 // Returns the length in bytes of a file in the directory.
@@ -147,7 +231,7 @@ func (d *FSDirectory) ensureCanWrite(name string) error {
 	}
 
 	err = os.Remove(filepath.Join(d.path, name))
-	if err != nil {
+	if err != nil && !os.IsNotExist(err) {
 		return errors.New(fmt.Sprintf("Cannot overwrite %v/%v: %v", d.path, name, err))
 	}
 
@@ -163,13 +247,13 @@ func (d *FSDirectory) onIndexOutputClosed(io *FSIndexOutput) {
 func (d *FSDirectory) Sync(names []string) (err error) {
 	d.EnsureOpen()
 
+	// only files written since their last sync need it
 	toSync := make(map[string]bool)
 	d.staleFilesLock.RLock()
 	for _, name := range names {
 		if _, ok := d.staleFiles[name]; ok {
-			continue
+			toSync[name] = true
 		}
-		toSync[name] = true
 	}
 	d.staleFilesLock.RUnlock()
 
@@ -180,6 +264,8 @@ func (d *FSDirectory) Sync(names []string) (err error) {
 		}
 	}
 
+	d.staleFilesLock.Lock()
+	defer d.staleFilesLock.Unlock()
 	for name, _ := range toSync {
 		delete(d.staleFiles, name)
 	}
@@ -203,7 +289,18 @@ func (d *FSDirectory) Close() error {
 }
 
 func (d *FSDirectory) fsync(name string) error {
-	panic("not implemented yet")
+	// write access is required to flush a file on Windows
+	f, err := os.OpenFile(filepath.Join(d.path, name), os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+/* Returns the path of the file system directory. */
+func (d *FSDirectory) Path() string {
+	return d.path
 }
 
 func (d *FSDirectory) String() string {
@@ -248,13 +345,15 @@ func (in *FSIndexInput) Close() error {
 }
 
 func (in *FSIndexInput) Clone() IndexInput {
-	return &FSIndexInput{
+	ans := &FSIndexInput{
 		in.BufferedIndexInput.Clone(),
 		in.file,
 		true,
 		in.chunkSize,
 		in.off,
 		in.end}
+	ans.SeekReader = ans
+	return ans
 }
 
 func (in *FSIndexInput) Length() int64 {
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+A BlobStore keeping each blob as a file of a local directory, e.g. for
+tests, or a mounted network file system. Blobs are written to a
+hidden temp file first, then renamed, so they only become visible
+once complete.
+*/
+type FSBlobStore struct {
+	path string
+}
+
+/* Creates a store over the given directory, creating it if needed. */
+func NewFSBlobStore(path string) (*FSBlobStore, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+	return &FSBlobStore{path}, nil
+}
+
+func (s *FSBlobStore) Put(name string, r io.Reader, size int64) (err error) {
+	tmp, err := ioutil.TempFile(s.path, ".upload-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name()) // ignore error
+		}
+	}()
+	n, err := io.Copy(tmp, r)
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return errors.New(fmt.Sprintf(
+			"blob '%v': expected %v bytes but got %v", name, size, n))
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.path, name))
+}
+
+func (s *FSBlobStore) RangeGet(name string, offset int64, buf []byte) error {
+	file, err := os.Open(filepath.Join(s.path, name))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.ReadAt(buf, offset)
+	return err
+}
+
+func (s *FSBlobStore) List(prefix string) ([]BlobInfo, error) {
+	infos, err := ioutil.ReadDir(s.path)
+	if err != nil {
+		return nil, err
+	}
+	var ans []BlobInfo
+	for _, info := range infos {
+		// skip uploads in progress
+		if name := info.Name(); info.Mode().IsRegular() &&
+			!strings.HasPrefix(name, ".") && strings.HasPrefix(name, prefix) {
+			ans = append(ans, BlobInfo{name, info.Size()})
+		}
+	}
+	return ans, nil
+}
+
+func (s *FSBlobStore) Delete(name string) error {
+	return os.Remove(filepath.Join(s.path, name))
+}
+
+func (s *FSBlobStore) String() string {
+	return fmt.Sprintf("FSBlobStore(%v)", s.path)
+}
@@ -9,7 +9,7 @@ import (
 func TestClone(t *testing.T) {
 	fmt.Println("Testing Loading FST...")
 	path := "../search/testdata/belfrysample"
-	d, err := OpenFSDirectory(path)
+	d, err := NewSimpleFSDirectory(path)
 	if err != nil {
 		t.Error(err)
 	}
@@ -177,7 +177,7 @@ func (in *ByteArrayDataInput) ReadInt() (n int32, err error) {
 func (in *ByteArrayDataInput) ReadLong() (n int64, err error) {
 	i1, _ := in.ReadInt()
 	i2, _ := in.ReadInt()
-	return (int64(i1) << 32) | int64(i2), nil
+	return (int64(i1) << 32) | int64(uint32(i2)), nil
 }
 
 func (in *ByteArrayDataInput) ReadVInt() (n int32, err error) {
@@ -0,0 +1,24 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package store
+
+import (
+	"errors"
+	"os"
+)
+
+// Whether NativeFSLockFactory can lock files on this platform.
+const NATIVE_LOCKS_SUPPORTED = false
+
+var errLockHeld = errors.New("lock is held by another process")
+
+var errNativeLocksUnsupported = errors.New("native file locks are not supported on this platform")
+
+func lockFile(f *os.File) error {
+	return errNativeLocksUnsupported
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
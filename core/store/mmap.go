@@ -0,0 +1,410 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// store/MMapDirectory.java
+
+/*
+Default max chunk size: 1 GB on 64 bit platforms, 256 MB on 32 bit
+platforms, where the address space is much more limited.
+*/
+const MMAP_DEFAULT_MAX_CHUNK_SIZE = 1 << (28 + 2*(^uint(0)>>63))
+
+/*
+File-based Directory implementation that uses mmap for reading, and
+FSIndexOutput for writing.
+
+NOTE: memory mapping uses up a portion of the virtual memory address
+space in your process equal to the size of the file being mapped.
+Before using this class, be sure you have plenty of virtual address
+space, e.g. by using a 64 bit platform, or a 32 bit one with indexes
+that are guaranteed to fit within the address space. On 32 bit
+platforms also consult NewMMapDirectoryWithChunkSize() if you have
+problems with mmap failing because of fragmented address space.
+
+If mmap fails because the address space is exhausted, or because it
+is not supported on the platform, the file is read through the same
+code path as SimpleFSDirectory instead, and a message is logged.
+
+The mapping of a file is released when the IndexInput returned by
+OpenInput() (or the slicer returned by CreateSlicer()) is closed.
+Clones and slices share the mapping; once it is released, reading
+from them returns an error instead of accessing unmapped memory.
+Closing an input while other goroutines are still reading from its
+clones is not supported, just like in Lucene Java.
+*/
+type MMapDirectory struct {
+	*FSDirectory
+	chunkSizePower uint
+}
+
+/* Create a new MMapDirectory for the named location. */
+func NewMMapDirectory(path string) (d *MMapDirectory, err error) {
+	return NewMMapDirectoryWithChunkSize(path, MMAP_DEFAULT_MAX_CHUNK_SIZE)
+}
+
+/*
+Create a new MMapDirectory for the named location, mapping files in
+chunks of at most maxChunkSize bytes. The chunk size is rounded down
+to a power of 2.
+
+Especially on 32 bit platforms, the address space can be very
+fragmented, so large index files cannot be mapped. Using a lower
+chunk size makes the directory implementation a little bit slower
+(as the correct chunk may be resolved on lots of seeks) but the
+chance is higher that mmap does not fail. On 64 bit platforms, this
+parameter should always be 1<<30, as the address space is big
+enough.
+*/
+func NewMMapDirectoryWithChunkSize(path string, maxChunkSize int) (d *MMapDirectory, err error) {
+	if maxChunkSize <= 0 {
+		return nil, errors.New("Maximum chunk size for mmap must be >0")
+	}
+	d = &MMapDirectory{}
+	for maxChunkSize > 1 {
+		maxChunkSize >>= 1
+		d.chunkSizePower++
+	}
+	if d.FSDirectory, err = newFSDirectory(d, path); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+/* Returns the current mmap chunk size. */
+func (d *MMapDirectory) MaxChunkSize() int {
+	return 1 << d.chunkSizePower
+}
+
+/* Creates an IndexInput for the file with the given name. */
+func (d *MMapDirectory) OpenInput(name string, context IOContext) (in IndexInput, err error) {
+	d.EnsureOpen()
+	fpath := filepath.Join(d.path, name)
+	buffers, err := d.mapFile(fpath)
+	if err == errMmapFallback {
+		return newSimpleFSIndexInput(fmt.Sprintf("SimpleFSIndexInput(path='%v')", fpath),
+			fpath, context, d.chunkSize)
+	} else if err != nil {
+		return nil, err
+	}
+	return newMMapIndexInput(fmt.Sprintf("MMapIndexInput(path='%v')", fpath),
+		buffers, d.chunkSizePower), nil
+}
+
+func (d *MMapDirectory) CreateSlicer(name string, context IOContext) (slicer IndexInputSlicer, err error) {
+	d.EnsureOpen()
+	fpath := filepath.Join(d.path, name)
+	buffers, err := d.mapFile(fpath)
+	if err == errMmapFallback {
+		f, err := os.Open(fpath)
+		if err != nil {
+			return nil, err
+		}
+		return &fileIndexInputSlicer{f, context, d.chunkSize}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &mmapIndexInputSlicer{newMMapIndexInput(
+		fmt.Sprintf("MMapIndexInput(path='%v')", fpath), buffers, d.chunkSizePower)}, nil
+}
+
+func (d *MMapDirectory) String() string {
+	return fmt.Sprintf("MMapDirectory@%v", d.DirectoryImpl.String())
+}
+
+var errMmapFallback = errors.New("mmap failed; fall back to regular reads")
+
+/*
+Maps the whole file in chunks of 1<<chunkSizePower bytes. The file
+itself can be closed right away, as the mapping stays valid until it
+is unmapped.
+
+Returns errMmapFallback if the file can't be mapped because the
+address space is exhausted, or mmap isn't supported.
+*/
+func (d *MMapDirectory) mapFile(path string) (buffers *mmapBuffers, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	length := fi.Size()
+	if length>>d.chunkSizePower >= 1<<31-1 {
+		return nil, errors.New(fmt.Sprintf(
+			"RandomAccessFile too big for chunk size: %v", path))
+	}
+
+	chunkSize := int64(1) << d.chunkSizePower
+	pageSize := int64(os.Getpagesize())
+	// we always allocate one more buffer, the last one may be a 0 byte one
+	nrBuffers := int(length>>d.chunkSizePower) + 1
+	buffers = &mmapBuffers{buffers: make([][]byte, nrBuffers)}
+	for i := range buffers.buffers {
+		start := int64(i) << d.chunkSizePower
+		size := chunkSize
+		if length-start < size {
+			size = length - start
+		}
+		if size == 0 {
+			buffers.buffers[i] = []byte{}
+			continue
+		}
+		// mmap offsets must be aligned to the page size
+		mapStart := start - start%pageSize
+		m, err := mmap(f, mapStart, int(start-mapStart+size))
+		if err != nil {
+			buffers.unmap() // ignore error
+			if mmapExhausted(err) {
+				log.Printf("Cannot mmap %v (%v): the virtual address space is "+
+					"exhausted or mmap is not supported. Please review 'ulimit -v', "+
+					"'ulimit -m' (both should return 'unlimited'), and "+
+					"'sysctl vm.max_map_count'; falling back to regular reads.", path, err)
+				return nil, errMmapFallback
+			}
+			return nil, errors.New(fmt.Sprintf("Cannot mmap %v: %v", path, err))
+		}
+		buffers.mappings = append(buffers.mappings, m)
+		buffers.buffers[i] = m[start-mapStart:]
+	}
+	return buffers, nil
+}
+
+/* The mapped chunks of a file, shared by an input and its clones. */
+type mmapBuffers struct {
+	buffers  [][]byte
+	mappings [][]byte // the regions to unmap
+	closed   int32    // atomic
+}
+
+func (b *mmapBuffers) isClosed() bool {
+	return atomic.LoadInt32(&b.closed) != 0
+}
+
+func (b *mmapBuffers) unmap() (err error) {
+	if !atomic.CompareAndSwapInt32(&b.closed, 0, 1) {
+		return nil // already unmapped
+	}
+	for _, m := range b.mappings {
+		if err2 := munmap(m); err == nil {
+			err = err2
+		}
+	}
+	b.mappings = nil
+	return err
+}
+
+type mmapIndexInputSlicer struct {
+	full *MMapIndexInput
+}
+
+func (s *mmapIndexInputSlicer) Close() error {
+	return s.full.Close()
+}
+
+func (s *mmapIndexInputSlicer) openSlice(desc string, offset, length int64) IndexInput {
+	return s.full.slice(desc, offset, length)
+}
+
+func (s *mmapIndexInputSlicer) openFullSlice() IndexInput {
+	return s.full.Clone()
+}
+
+// store/ByteBufferIndexInput.java
+
+/*
+IndexInput implementation reading directly from the mapped chunks of
+a file, without any copying or buffering. Each position is resolved
+to a chunk and an offset in it, hence the power-of-2 chunk size.
+*/
+type MMapIndexInput struct {
+	*IndexInputImpl
+	shared  *mmapBuffers
+	isClone bool
+
+	buffers        [][]byte
+	offset         int64 // of this slice, within the first buffer
+	length         int64
+	chunkSizePower uint
+	chunkSizeMask  int64
+
+	curBufIndex int
+	curBuf      []byte
+	curPos      int // position in curBuf
+}
+
+func newMMapIndexInput(desc string, shared *mmapBuffers, chunkSizePower uint) *MMapIndexInput {
+	var length int64
+	for _, b := range shared.buffers {
+		length += int64(len(b))
+	}
+	ans := &MMapIndexInput{
+		shared:         shared,
+		buffers:        shared.buffers,
+		length:         length,
+		chunkSizePower: chunkSizePower,
+		chunkSizeMask:  int64(1)<<chunkSizePower - 1,
+	}
+	ans.IndexInputImpl = newIndexInputImpl(desc, ans)
+	ans.curBuf = ans.buffers[0]
+	return ans
+}
+
+func (in *MMapIndexInput) ensureOpen() error {
+	if in.shared.isClosed() {
+		return errors.New(fmt.Sprintf("Already closed: %v", in))
+	}
+	return nil
+}
+
+func (in *MMapIndexInput) ReadByte() (b byte, err error) {
+	if err = in.ensureOpen(); err != nil {
+		return 0, err
+	}
+	for in.curPos >= len(in.curBuf) {
+		if in.curBufIndex+1 >= len(in.buffers) {
+			return 0, errors.New(fmt.Sprintf("read past EOF: %v", in))
+		}
+		in.curBufIndex++
+		in.curBuf, in.curPos = in.buffers[in.curBufIndex], 0
+	}
+	b = in.curBuf[in.curPos]
+	in.curPos++
+	return b, nil
+}
+
+func (in *MMapIndexInput) ReadBytes(buf []byte) error {
+	if err := in.ensureOpen(); err != nil {
+		return err
+	}
+	for len(buf) > 0 {
+		if in.curPos >= len(in.curBuf) {
+			if in.curBufIndex+1 >= len(in.buffers) {
+				return errors.New(fmt.Sprintf("read past EOF: %v", in))
+			}
+			in.curBufIndex++
+			in.curBuf, in.curPos = in.buffers[in.curBufIndex], 0
+			continue
+		}
+		n := copy(buf, in.curBuf[in.curPos:])
+		in.curPos += n
+		buf = buf[n:]
+	}
+	return nil
+}
+
+func (in *MMapIndexInput) ReadBytesBuffered(buf []byte, useBuffer bool) error {
+	return in.ReadBytes(buf)
+}
+
+func (in *MMapIndexInput) ReadShort() (n int16, err error) {
+	if in.curPos+2 <= len(in.curBuf) && !in.shared.isClosed() {
+		n = int16(binary.BigEndian.Uint16(in.curBuf[in.curPos:]))
+		in.curPos += 2
+		return n, nil
+	}
+	return in.IndexInputImpl.ReadShort()
+}
+
+func (in *MMapIndexInput) ReadInt() (n int32, err error) {
+	if in.curPos+4 <= len(in.curBuf) && !in.shared.isClosed() {
+		n = int32(binary.BigEndian.Uint32(in.curBuf[in.curPos:]))
+		in.curPos += 4
+		return n, nil
+	}
+	return in.IndexInputImpl.ReadInt()
+}
+
+func (in *MMapIndexInput) ReadLong() (n int64, err error) {
+	if in.curPos+8 <= len(in.curBuf) && !in.shared.isClosed() {
+		n = int64(binary.BigEndian.Uint64(in.curBuf[in.curPos:]))
+		in.curPos += 8
+		return n, nil
+	}
+	return in.IndexInputImpl.ReadLong()
+}
+
+func (in *MMapIndexInput) FilePointer() int64 {
+	return int64(in.curBufIndex)<<in.chunkSizePower + int64(in.curPos) - in.offset
+}
+
+func (in *MMapIndexInput) Seek(pos int64) error {
+	if err := in.ensureOpen(); err != nil {
+		return err
+	}
+	if pos < 0 || pos > in.length {
+		return errors.New(fmt.Sprintf("seek past EOF: %v (pos=%v)", in, pos))
+	}
+	// the buffer index resolved here is always valid, as the last
+	// buffer ends exactly at the end of this input
+	pos += in.offset
+	in.curBufIndex = int(pos >> in.chunkSizePower)
+	in.curBuf, in.curPos = in.buffers[in.curBufIndex], int(pos&in.chunkSizeMask)
+	return nil
+}
+
+func (in *MMapIndexInput) Length() int64 {
+	return in.length
+}
+
+func (in *MMapIndexInput) Clone() IndexInput {
+	ans := *in
+	ans.isClone = true
+	ans.IndexInputImpl = newIndexInputImpl(in.desc, &ans)
+	return &ans
+}
+
+/*
+Creates a slice of this input, with the given offset and length. The
+slice shares the mapping with this input, without copying any data.
+*/
+func (in *MMapIndexInput) slice(desc string, offset, length int64) *MMapIndexInput {
+	assert2(offset >= 0 && length >= 0 && offset+length <= in.length,
+		"slice() %v out of bounds: offset=%v,length=%v,fileLength=%v", desc, offset, length, in.length)
+	offset += in.offset
+	end := offset + length
+	startIndex := int(offset >> in.chunkSizePower)
+	endIndex := int(end >> in.chunkSizePower)
+
+	// the first buffer starts at the chunk boundary, hence the offset
+	// kept below; the last one is cut at the end of the slice
+	buffers := make([][]byte, endIndex-startIndex+1)
+	copy(buffers, in.buffers[startIndex:endIndex+1])
+	last := len(buffers) - 1
+	buffers[last] = buffers[last][:end&in.chunkSizeMask]
+
+	ans := &MMapIndexInput{
+		shared:         in.shared,
+		isClone:        true,
+		buffers:        buffers,
+		offset:         offset & in.chunkSizeMask,
+		length:         length,
+		chunkSizePower: in.chunkSizePower,
+		chunkSizeMask:  in.chunkSizeMask,
+	}
+	ans.IndexInputImpl = newIndexInputImpl(fmt.Sprintf("%v [slice=%v]", in.desc, desc), ans)
+	ans.Seek(0)
+	return ans
+}
+
+/*
+Closing the original input releases the mapping, invalidating all
+clones and slices. Closing a clone has no effect.
+*/
+func (in *MMapIndexInput) Close() error {
+	if in.isClone {
+		return nil
+	}
+	return in.shared.unmap()
+}
@@ -0,0 +1,27 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package store
+
+import (
+	"errors"
+	"os"
+)
+
+var errMmapUnsupported = errors.New("mmap is not supported on this platform")
+
+// Whether MMapDirectory can map files on this platform.
+const MMAP_SUPPORTED = false
+
+func mmap(f *os.File, offset int64, length int) ([]byte, error) {
+	return nil, errMmapUnsupported
+}
+
+func munmap(b []byte) error {
+	return nil
+}
+
+// MMapDirectory always falls back to regular reads on this platform.
+func mmapExhausted(err error) bool {
+	return err == errMmapUnsupported
+}
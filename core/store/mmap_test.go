@@ -0,0 +1,172 @@
+package store
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, dir Directory, name string, data []byte) {
+	out, err := dir.CreateOutput(name, IO_CONTEXT_DEFAULT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = out.WriteBytes(data); err != nil {
+		t.Fatal(err)
+	}
+	if err = out.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMMapDirectory(t *testing.T) {
+	path, err := ioutil.TempDir("", "golucene")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+	// tiny chunks, so reads and seeks cross chunk boundaries
+	dir, err := NewMMapDirectoryWithChunkSize(path, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dir.Close()
+	if n := dir.MaxChunkSize(); n != 64 {
+		t.Fatalf("expected chunk size rounded down to 64, but was %v", n)
+	}
+
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byten(int64(i * 7))
+	}
+	writeTestFile(t, dir, "a.bin", data)
+	writeTestFile(t, dir, "empty.bin", nil)
+
+	in, err := dir.OpenInput("a.bin", IO_CONTEXT_DEFAULT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in.Length() != int64(len(data)) {
+		t.Fatalf("expected length %v, but was %v", len(data), in.Length())
+	}
+	buf := make([]byte, len(data))
+	if err = in.ReadBytes(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, data) {
+		t.Fatal("content mismatch")
+	}
+	if _, err = in.ReadByte(); err == nil {
+		t.Error("expected error reading past EOF")
+	}
+
+	// primitives spanning a chunk boundary
+	for _, pos := range []int64{0, 60, 62, 63, 127, 990} {
+		if err = in.Seek(pos); err != nil {
+			t.Fatal(err)
+		}
+		n, err := in.ReadLong()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var expected int64
+		for _, b := range data[pos : pos+8] {
+			expected = expected<<8 | int64(b)
+		}
+		if n != expected {
+			t.Errorf("ReadLong at %v: expected %v, but was %v", pos, expected, n)
+		}
+		if fp := in.FilePointer(); fp != pos+8 {
+			t.Errorf("expected file pointer %v, but was %v", pos+8, fp)
+		}
+	}
+	if err = in.Seek(int64(len(data)) + 1); err == nil {
+		t.Error("expected error seeking past EOF")
+	}
+
+	clone := in.Clone()
+	if err = clone.Seek(500); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := clone.ReadByte(); err != nil || b != data[500] {
+		t.Errorf("clone: expected %v, but was %v (%v)", data[500], b, err)
+	}
+	if err = in.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = clone.ReadByte(); err == nil {
+		t.Error("expected error reading a clone after close")
+	}
+
+	in, err = dir.OpenInput("empty.bin", IO_CONTEXT_DEFAULT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in.Length() != 0 {
+		t.Errorf("expected empty file, but length was %v", in.Length())
+	}
+	if _, err = in.ReadByte(); err == nil {
+		t.Error("expected error reading past EOF")
+	}
+	in.Close()
+}
+
+func TestMMapSlicer(t *testing.T) {
+	path, err := ioutil.TempDir("", "golucene")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+	dir, err := NewMMapDirectoryWithChunkSize(path, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dir.Close()
+
+	data := make([]byte, 500)
+	for i := range data {
+		data[i] = byten(int64(i))
+	}
+	writeTestFile(t, dir, "a.bin", data)
+
+	slicer, err := dir.CreateSlicer("a.bin", IO_CONTEXT_DEFAULT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range [][2]int64{{0, 500}, {10, 20}, {60, 200}, {64, 64}, {128, 0}, {499, 1}} {
+		in := slicer.openSlice("slice", r[0], r[1])
+		if in.Length() != r[1] {
+			t.Errorf("%v: expected length %v, but was %v", r, r[1], in.Length())
+		}
+		buf := make([]byte, r[1])
+		if err = in.ReadBytes(buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, data[r[0]:r[0]+r[1]]) {
+			t.Errorf("%v: content mismatch", r)
+		}
+		if _, err = in.ReadByte(); err == nil {
+			t.Errorf("%v: expected error reading past the end of slice", r)
+		}
+		if r[1] > 0 {
+			if err = in.Seek(r[1] - 1); err != nil {
+				t.Fatal(err)
+			}
+			if b, _ := in.ReadByte(); b != data[r[0]+r[1]-1] {
+				t.Errorf("%v: last byte mismatch", r)
+			}
+		}
+		in.Close()
+	}
+	full := slicer.openFullSlice()
+	if full.Length() != int64(len(data)) {
+		t.Errorf("expected full length %v, but was %v", len(data), full.Length())
+	}
+	if err = slicer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = full.ReadByte(); err == nil {
+		t.Error("expected error reading a slice after the slicer is closed")
+	}
+}
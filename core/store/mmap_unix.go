@@ -0,0 +1,25 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package store
+
+import (
+	"os"
+	"syscall"
+)
+
+// Whether MMapDirectory can map files on this platform.
+const MMAP_SUPPORTED = true
+
+func mmap(f *os.File, offset int64, length int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), offset, length, syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func munmap(b []byte) error {
+	return syscall.Munmap(b)
+}
+
+// Returns true if mmap failed for lack of (contiguous) address space.
+func mmapExhausted(err error) bool {
+	return err == syscall.ENOMEM
+}
@@ -0,0 +1,211 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// store/NativeFSLockFactory.java
+
+/*
+Implements LockFactory using native OS file locks (flock(2) on Unix
+platforms). Unlike SimpleFSLockFactory, the lock is tied to the open
+file rather than the existence of the lock file, so the OS releases it
+automatically when the process exits, even abnormally. A stale
+write.lock left behind after a crash does not block a new writer.
+
+The lock file is removed when the lock is released, but its existence
+means nothing by itself.
+
+NOTE: native locks are advisory only, and may not work correctly on
+shared file systems such as NFS. If you suspect this or any other
+LockFactory is not working properly in your environment, you can
+easily test it by using VerifyingLockFactory, LockVerifyServer and
+LockStressTest.
+
+On platforms without native lock support, obtaining a lock returns an
+error; see NATIVE_LOCKS_SUPPORTED.
+*/
+type NativeFSLockFactory struct {
+	*FSLockFactory
+}
+
+/* Create a NativeFSLockFactory instance, storing lock files into the specified directory. */
+func NewNativeFSLockFactory(path string) *NativeFSLockFactory {
+	ans := &NativeFSLockFactory{}
+	ans.FSLockFactory = newFSLockFactory()
+	ans.setLockDir(path)
+	return ans
+}
+
+func (f *NativeFSLockFactory) Make(name string) Lock {
+	if f.lockPrefix != "" {
+		name = fmt.Sprintf("%v-%v", f.lockPrefix, name)
+	}
+	return newNativeFSLock(f.lockDir, name)
+}
+
+func (f *NativeFSLockFactory) Clear(name string) error {
+	// Note that this isn't strictly required anymore because the lock
+	// is tied to the process; but it's fine to remove the lock file
+	// when it isn't held, and this is what Lucene Java does as well.
+	lock := f.Make(name)
+	if !lock.IsLocked() {
+		if err := os.Remove(lock.(*NativeFSLock).path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *NativeFSLockFactory) String() string {
+	return fmt.Sprintf("NativeFSLockFactory@%v", f.lockDir)
+}
+
+/*
+Paths of the locks held by this process. flock(2) locks are held per
+open file, so two NativeFSLock instances in the same process would
+exclude each other anyway; this keeps the in-process case cheap and
+independent from the platform semantics.
+*/
+var nativeLocksHeld = struct {
+	sync.Mutex
+	paths map[string]bool
+}{paths: make(map[string]bool)}
+
+type NativeFSLock struct {
+	*LockImpl
+	sync.Locker
+	lockDir, path string
+	file          *os.File // non-nil while the lock is held
+}
+
+func newNativeFSLock(lockDir, lockFileName string) *NativeFSLock {
+	ans := &NativeFSLock{
+		Locker:  &sync.Mutex{},
+		lockDir: lockDir,
+		path:    filepath.Join(lockDir, lockFileName),
+	}
+	ans.LockImpl = NewLockImpl(ans)
+	return ans
+}
+
+func (lock *NativeFSLock) Obtain() (ok bool, err error) {
+	lock.Lock() // synchronized
+	defer lock.Unlock()
+
+	if lock.file != nil {
+		// Our instance is already locked:
+		return false, nil
+	}
+
+	// Ensure that lockDir exists and is a directory.
+	if err = os.MkdirAll(lock.lockDir, 0755); err != nil {
+		return false, errors.New(fmt.Sprintf(
+			"Cannot create directory: %v: %v", lock.lockDir, err))
+	}
+	// Use the absolute path, so different relative paths to the same
+	// file are recognized as the same lock in this process.
+	canonicalPath, err := filepath.Abs(lock.path)
+	if err != nil {
+		return false, err
+	}
+
+	nativeLocksHeld.Lock()
+	defer nativeLocksHeld.Unlock()
+	if nativeLocksHeld.paths[canonicalPath] {
+		// Someone else in this process has the lock
+		return false, nil
+	}
+
+	f, err := os.OpenFile(lock.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return false, err
+	}
+	if err = lockFile(f); err != nil {
+		f.Close()
+		if err == errLockHeld {
+			// Another process has the lock
+			return false, nil
+		} else if !NATIVE_LOCKS_SUPPORTED {
+			return false, err
+		}
+		// At least on OS X, we will sometimes get an intermittent
+		// "Permission Denied" error. Record the root cause, and let
+		// ObtainWithin() report it if it times out.
+		lock.failureReason = err
+		return false, nil
+	}
+	// The holder removes the file on release, while still holding the
+	// lock. If that happened since we opened it, we locked a deleted
+	// file, and another process may lock the new one at the same time.
+	if !isSameFile(f, lock.path) {
+		unlockFile(f) // ignore error
+		f.Close()
+		return false, nil
+	}
+	lock.file = f
+	nativeLocksHeld.paths[canonicalPath] = true
+	return true, nil
+}
+
+func isSameFile(f *os.File, path string) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	fi2, err := os.Stat(path)
+	return err == nil && os.SameFile(fi, fi2)
+}
+
+func (lock *NativeFSLock) Release() error {
+	lock.Lock() // synchronized
+	defer lock.Unlock()
+
+	if lock.file == nil {
+		return nil
+	}
+	canonicalPath, _ := filepath.Abs(lock.path)
+	nativeLocksHeld.Lock()
+	delete(nativeLocksHeld.paths, canonicalPath)
+	nativeLocksHeld.Unlock()
+
+	// Remove the file before unlocking, see Obtain(); failing to do so
+	// (e.g. held open by an anti-virus) is harmless.
+	os.Remove(lock.path)
+	// closing the file releases the OS lock as well
+	err := unlockFile(lock.file)
+	if err2 := lock.file.Close(); err == nil {
+		err = err2
+	}
+	lock.file = nil
+	return err
+}
+
+func (lock *NativeFSLock) IsLocked() bool {
+	lock.Lock() // synchronized
+	held := lock.file != nil
+	lock.Unlock()
+	if held {
+		return true
+	}
+
+	// Look if the lock file exists; if not, nobody can hold it
+	if _, err := os.Stat(lock.path); err != nil {
+		return false
+	}
+	// Try to obtain and release (if was locked) the lock
+	ok, err := lock.Obtain()
+	if err != nil || !ok {
+		return true
+	}
+	lock.Release() // ignore error
+	return false
+}
+
+func (lock *NativeFSLock) String() string {
+	return fmt.Sprintf("NativeFSLock@%v", lock.path)
+}
@@ -0,0 +1,154 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNativeFSLock(t *testing.T) {
+	if !NATIVE_LOCKS_SUPPORTED {
+		t.Skip("native locks are not supported on this platform")
+	}
+	path, err := ioutil.TempDir("", "golucene")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	// a stale lock file left by a crashed process doesn't matter
+	if err = ioutil.WriteFile(filepath.Join(path, "write.lock"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l := NewNativeFSLockFactory(path).Make("write.lock")
+	l2 := NewNativeFSLockFactory(path).Make("write.lock")
+	if l.IsLocked() {
+		t.Error("stale lock file should not be locked")
+	}
+	if ok, err := l.Obtain(); !ok || err != nil {
+		t.Fatalf("failed to obtain lock: %v", err)
+	}
+	if ok, _ := l.Obtain(); ok {
+		t.Error("obtained the same lock twice")
+	}
+	if ok, _ := l2.Obtain(); ok {
+		t.Error("two locks obtained the same file")
+	}
+	if !l2.IsLocked() {
+		t.Error("lock should be reported as locked")
+	}
+	if err = l.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if l2.IsLocked() {
+		t.Error("lock should be released")
+	}
+	if ok, err := l2.Obtain(); !ok || err != nil {
+		t.Fatalf("failed to obtain released lock: %v", err)
+	}
+	l2.Release()
+}
+
+// Always grants the lock; the verify server must catch it.
+type brokenLockFactory struct {
+	*LockFactoryImpl
+}
+
+func (f *brokenLockFactory) Make(name string) Lock {
+	ans := &brokenLock{}
+	ans.LockImpl = NewLockImpl(ans)
+	return ans
+}
+
+func (f *brokenLockFactory) Clear(name string) error { return nil }
+
+type brokenLock struct {
+	*LockImpl
+}
+
+func (l *brokenLock) Obtain() (bool, error) { return true, nil }
+func (l *brokenLock) Release() error        { return nil }
+func (l *brokenLock) IsLocked() bool        { return false }
+
+func TestLockVerifyServerDetectsBrokenLock(t *testing.T) {
+	server, err := NewLockVerifyServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() { done <- server.Serve() }()
+
+	errs := make(chan error, 2)
+	for id := byte(0); id < 2; id++ {
+		go func(id byte) {
+			errs <- LockStressTest(id, server.Addr(),
+				&brokenLockFactory{&LockFactoryImpl{}}, time.Millisecond, 1000)
+		}(id)
+	}
+	for i := 0; i < 2; i++ {
+		<-errs
+	}
+	server.Close()
+	if err = <-done; err == nil {
+		t.Error("server should have detected two clients holding the lock")
+	}
+}
+
+// Runs the stress test in separate processes, re-executing the test
+// binary as LockStressTest clients.
+func TestNativeFSLockStress(t *testing.T) {
+	if id := os.Getenv("GOLUCENE_LOCK_STRESS_ID"); id != "" {
+		n, _ := strconv.Atoi(id)
+		err := LockStressTest(byte(n), os.Getenv("GOLUCENE_LOCK_STRESS_SERVER"),
+			NewNativeFSLockFactory(os.Getenv("GOLUCENE_LOCK_STRESS_DIR")), time.Millisecond, 200)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	if !NATIVE_LOCKS_SUPPORTED {
+		t.Skip("native locks are not supported on this platform")
+	}
+	if testing.Short() {
+		t.Skip("skipping multi-process test in short mode")
+	}
+
+	path, err := ioutil.TempDir("", "golucene")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+	server, err := NewLockVerifyServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() { done <- server.Serve() }()
+
+	var cmds []*exec.Cmd
+	for id := 0; id < 3; id++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestNativeFSLockStress$")
+		cmd.Env = append(os.Environ(),
+			"GOLUCENE_LOCK_STRESS_ID="+strconv.Itoa(id),
+			"GOLUCENE_LOCK_STRESS_SERVER="+server.Addr(),
+			"GOLUCENE_LOCK_STRESS_DIR="+path)
+		if err = cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		cmds = append(cmds, cmd)
+	}
+	for _, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Errorf("stress test client failed: %v", err)
+		}
+	}
+	server.Close()
+	if err = <-done; err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,132 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// store/NIOFSDirectory.java
+
+/*
+An FSDirectory implementation that uses positional reads (pread(2),
+via File.ReadAt()) when reading from files. Unlike SimpleFSDirectory,
+no file position is shared between an input and its clones, so many
+goroutines can read from the same file concurrently without locking.
+
+NOTE: as in Lucene Java, the file position isn't used at all, hence
+it's safe to hand clones out to concurrent searches.
+*/
+type NIOFSDirectory struct {
+	*FSDirectory
+}
+
+/* Create a new NIOFSDirectory for the named location. */
+func NewNIOFSDirectory(path string) (d *NIOFSDirectory, err error) {
+	d = &NIOFSDirectory{}
+	if d.FSDirectory, err = newFSDirectory(d, path); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+/* Creates an IndexInput for the file with the given name. */
+func (d *NIOFSDirectory) OpenInput(name string, context IOContext) (in IndexInput, err error) {
+	d.EnsureOpen()
+	fpath := filepath.Join(d.path, name)
+	return newNIOFSIndexInput(fmt.Sprintf("NIOFSIndexInput(path='%v')", fpath),
+		fpath, context, d.chunkSize)
+}
+
+func (d *NIOFSDirectory) CreateSlicer(name string, context IOContext) (slicer IndexInputSlicer, err error) {
+	d.EnsureOpen()
+	f, err := os.Open(filepath.Join(d.path, name))
+	if err != nil {
+		return nil, err
+	}
+	return &niofsIndexInputSlicer{f, context, d.chunkSize}, nil
+}
+
+func (d *NIOFSDirectory) String() string {
+	return fmt.Sprintf("NIOFSDirectory@%v", d.DirectoryImpl.String())
+}
+
+type niofsIndexInputSlicer struct {
+	file      *os.File
+	ctx       IOContext
+	chunkSize int
+}
+
+func (s *niofsIndexInputSlicer) Close() error {
+	return s.file.Close()
+}
+
+func (s *niofsIndexInputSlicer) openSlice(desc string, offset, length int64) IndexInput {
+	return newNIOFSIndexInputFromFileSlice(fmt.Sprintf("NIOFSIndexInput(%v in path='%v' slice=%v:%v)",
+		desc, s.file.Name(), offset, offset+length),
+		s.file, offset, length, bufferSize(s.ctx), s.chunkSize)
+}
+
+func (s *niofsIndexInputSlicer) openFullSlice() IndexInput {
+	fi, err := s.file.Stat()
+	if err != nil {
+		panic(err)
+	}
+	return s.openSlice("full-slice", 0, fi.Size())
+}
+
+/* Reads bytes with File.ReadAt(), leaving the file position alone. */
+type NIOFSIndexInput struct {
+	*FSIndexInput
+}
+
+func newNIOFSIndexInput(desc, path string, context IOContext, chunkSize int) (in *NIOFSIndexInput, err error) {
+	super, err := newFSIndexInput(desc, path, context, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	in = &NIOFSIndexInput{super}
+	in.SeekReader = in
+	return in, nil
+}
+
+func newNIOFSIndexInputFromFileSlice(desc string, file *os.File, off, length int64, bufferSize, chunkSize int) *NIOFSIndexInput {
+	ans := &NIOFSIndexInput{newFSIndexInputFromFileSlice(desc, file, off, length, bufferSize, chunkSize)}
+	ans.SeekReader = ans
+	return ans
+}
+
+func (in *NIOFSIndexInput) readInternal(buf []byte) error {
+	length := len(buf)
+	position := in.off + in.FilePointer()
+	if position+int64(length) > in.end {
+		return errors.New(fmt.Sprintf("read past EOF: %v", in))
+	}
+
+	for total := 0; total < length; {
+		readLength := length - total
+		if in.chunkSize < readLength {
+			readLength = in.chunkSize
+		}
+		i, err := in.file.ReadAt(buf[total:total+readLength], position+int64(total))
+		total += i
+		if err == io.EOF && total < length {
+			return errors.New(fmt.Sprintf("read past EOF: %v", in))
+		} else if err != nil && err != io.EOF {
+			return errors.New(fmt.Sprintf("%v: %v", err, in))
+		}
+	}
+	return nil
+}
+
+func (in *NIOFSIndexInput) seekInternal(pos int64) error {
+	return nil // nothing
+}
+
+func (in *NIOFSIndexInput) Clone() IndexInput {
+	ans := &NIOFSIndexInput{in.FSIndexInput.Clone().(*FSIndexInput)}
+	ans.SeekReader = ans
+	return ans
+}
@@ -0,0 +1,153 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestNIOFSConcurrentClones(t *testing.T) {
+	path, err := ioutil.TempDir("", "golucene")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+	dir, err := NewNIOFSDirectory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dir.Close()
+
+	data := make([]byte, 10*BUFFER_SIZE+3)
+	for i := range data {
+		data[i] = byten(int64(i * 31))
+	}
+	writeTestFile(t, dir, "a.bin", data)
+
+	in, err := dir.OpenInput("a.bin", IO_CONTEXT_DEFAULT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+
+	// clones share the file, but no position, so no locking is needed
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(clone IndexInput, start int64) {
+			defer wg.Done()
+			defer clone.Close()
+			for pos := start; pos < int64(len(data)); pos += 997 {
+				if err := clone.Seek(pos); err != nil {
+					errs <- err
+					return
+				}
+				b, err := clone.ReadByte()
+				if err != nil {
+					errs <- err
+					return
+				}
+				if b != data[pos] {
+					errs <- errors.New(fmt.Sprintf("byte %v: expected %v, but was %v", pos, data[pos], b))
+					return
+				}
+			}
+		}(in.Clone(), int64(g*13))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	slicer, err := dir.CreateSlicer("a.bin", IO_CONTEXT_DEFAULT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slicer.Close()
+	slice := slicer.openSlice("slice", 100, 2000)
+	buf := make([]byte, 2000)
+	if err = slice.ReadBytes(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, data[100:2100]) {
+		t.Error("slice content mismatch")
+	}
+	if _, err = slice.ReadByte(); err == nil {
+		t.Error("expected error reading past the end of slice")
+	}
+}
+
+func TestOpenFSDirectoryOfType(t *testing.T) {
+	path, err := ioutil.TempDir("", "golucene")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	for _, name := range []string{"mmap", "niofs", "simple", "auto"} {
+		typ, err := ParseFSDirectoryType(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := OpenFSDirectoryOfType(path, typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ok bool
+		switch name {
+		case "mmap":
+			_, ok = d.(*MMapDirectory)
+		case "niofs":
+			_, ok = d.(*NIOFSDirectory)
+		case "simple":
+			_, ok = d.(*SimpleFSDirectory)
+		case "auto":
+			if MMAP_SUPPORTED && is64Bit {
+				_, ok = d.(*MMapDirectory)
+			} else {
+				ok = d != nil
+			}
+		}
+		if !ok {
+			t.Errorf("%v: unexpected directory %v", name, d)
+		}
+		d.Close()
+	}
+	if _, err = ParseFSDirectoryType("bogus"); err == nil {
+		t.Error("expected error parsing an unknown type")
+	}
+}
+
+func TestFSDirectorySync(t *testing.T) {
+	path, err := ioutil.TempDir("", "golucene")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+	dir, err := NewNIOFSDirectory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dir.Close()
+
+	writeTestFile(t, dir, "a.bin", []byte("written"))
+	if !dir.staleFiles["a.bin"] {
+		t.Fatal("expected a.bin to need a sync")
+	}
+	// files not written since their last sync are skipped
+	if err = dir.Sync([]string{"a.bin", "synced.bin"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(dir.staleFiles) != 0 {
+		t.Errorf("expected no file left to sync, got %v", dir.staleFiles)
+	}
+	if err = dir.Sync([]string{"a.bin"}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,259 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"github.com/balzaczyy/golucene/core/util"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+/* Name and size of a blob, as returned by BlobStore.List(). */
+type BlobInfo struct {
+	Name string
+	Size int64
+}
+
+/*
+The minimal set of operations ObjectStoreDirectory needs from an
+object store. Blobs are immutable: they're written whole by Put() and
+only become visible once fully written.
+
+Missing blobs are reported with an error for which os.IsNotExist()
+returns true. Deleting a missing blob may or may not be an error,
+depending on the store.
+*/
+type BlobStore interface {
+	// Stores size bytes read from r as the named blob, replacing any
+	// existing one.
+	Put(name string, r io.Reader, size int64) error
+	// Reads len(buf) bytes of the named blob, starting at offset.
+	RangeGet(name string, offset int64, buf []byte) error
+	// Lists the blobs whose names start with prefix.
+	List(prefix string) ([]BlobInfo, error)
+	// Removes the named blob.
+	Delete(name string) error
+}
+
+/*
+A Directory storing its files as blobs of an object store, e.g. an
+S3-compatible one (see S3BlobStore), so committed segments can be
+kept off the local disks.
+
+As blobs can't be appended to, outputs buffer the file in a local
+temp file, which is uploaded when the output is closed; the file
+doesn't exist in this directory until then. As uploads are durable,
+Sync() is a no-op. Inputs read the file with one range request per
+refill of their buffer, so searches should usually go through a
+BlockCacheDirectory wrapping this one:
+
+	dir := NewBlockCacheDirectory(NewObjectStoreDirectory(blobs, ""),
+		BLOCK_CACHE_DEFAULT_BLOCK_SIZE, 256)
+
+Locking is done with a SingleInstanceLockFactory by default, as object
+stores offer no locks: only one process should write to the index at
+a time.
+*/
+type ObjectStoreDirectory struct {
+	*DirectoryImpl
+	store   BlobStore
+	tempDir string
+}
+
+/*
+Creates a directory over the given store, buffering outputs in
+tempDir, or in the default temp directory if empty.
+*/
+func NewObjectStoreDirectory(store BlobStore, tempDir string) *ObjectStoreDirectory {
+	ans := &ObjectStoreDirectory{store: store, tempDir: tempDir}
+	ans.DirectoryImpl = NewDirectoryImpl(ans)
+	ans.SetLockFactory(newSingleInstanceLockFactory())
+	return ans
+}
+
+/* Returns the underlying store. */
+func (d *ObjectStoreDirectory) Store() BlobStore {
+	return d.store
+}
+
+func (d *ObjectStoreDirectory) ListAll() ([]string, error) {
+	d.EnsureOpen()
+	blobs, err := d.store.List("")
+	if err != nil {
+		return nil, err
+	}
+	ans := make([]string, len(blobs))
+	for i, blob := range blobs {
+		ans[i] = blob.Name
+	}
+	return ans, nil
+}
+
+// Returns the info of the named blob, listing those prefixed by its
+// name, as BlobStore has no dedicated call.
+func (d *ObjectStoreDirectory) stat(name string) (BlobInfo, error) {
+	blobs, err := d.store.List(name)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	for _, blob := range blobs {
+		if blob.Name == name {
+			return blob, nil
+		}
+	}
+	return BlobInfo{}, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+}
+
+func (d *ObjectStoreDirectory) FileExists(name string) bool {
+	d.EnsureOpen()
+	_, err := d.stat(name)
+	return err == nil
+}
+
+func (d *ObjectStoreDirectory) FileLength(name string) (int64, error) {
+	d.EnsureOpen()
+	blob, err := d.stat(name)
+	return blob.Size, err
+}
+
+func (d *ObjectStoreDirectory) DeleteFile(name string) error {
+	d.EnsureOpen()
+	return d.store.Delete(name)
+}
+
+func (d *ObjectStoreDirectory) CreateOutput(name string, context IOContext) (IndexOutput, error) {
+	d.EnsureOpen()
+	file, err := ioutil.TempFile(d.tempDir, "golucene-upload-")
+	if err != nil {
+		return nil, err
+	}
+	return newObjectStoreIndexOutput(d.store, name, file), nil
+}
+
+/* Files are durable once uploaded, i.e. once their output is closed. */
+func (d *ObjectStoreDirectory) Sync(names []string) error {
+	d.EnsureOpen()
+	return nil
+}
+
+func (d *ObjectStoreDirectory) OpenInput(name string, context IOContext) (IndexInput, error) {
+	d.EnsureOpen()
+	blob, err := d.stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return newObjectStoreIndexInput(fmt.Sprintf("ObjectStoreIndexInput(name=%v)", name),
+		d.store, name, blob.Size, context), nil
+}
+
+func (d *ObjectStoreDirectory) Close() error {
+	d.IsOpen = false
+	return nil
+}
+
+func (d *ObjectStoreDirectory) String() string {
+	return fmt.Sprintf("ObjectStoreDirectory@%v lockFactory=%v", d.store, d.lockFactory)
+}
+
+/* Writes to a local temp file, uploaded on Close(). */
+type objectStoreIndexOutput struct {
+	*BufferedIndexOutput
+	store  BlobStore
+	name   string
+	file   *os.File
+	closed bool
+}
+
+func newObjectStoreIndexOutput(store BlobStore, name string, file *os.File) *objectStoreIndexOutput {
+	ans := &objectStoreIndexOutput{store: store, name: name, file: file}
+	ans.BufferedIndexOutput = NewBufferedIndexOutput(CHUNK_SIZE, ans)
+	return ans
+}
+
+func (out *objectStoreIndexOutput) FlushBuffer(buf []byte) error {
+	_, err := out.file.Write(buf)
+	return err
+}
+
+func (out *objectStoreIndexOutput) Length() (int64, error) {
+	info, err := out.file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (out *objectStoreIndexOutput) Close() (err error) {
+	if out.closed {
+		return nil
+	}
+	out.closed = true
+	defer func() {
+		err = util.CloseWhileHandlingError(err, out.file)
+		os.Remove(out.file.Name()) // ignore error
+	}()
+
+	if err = out.BufferedIndexOutput.Close(); err != nil {
+		return err
+	}
+	size, err := out.Length()
+	if err != nil {
+		return err
+	}
+	if _, err = out.file.Seek(0, 0); err != nil {
+		return err
+	}
+	return out.store.Put(out.name, out.file, size)
+}
+
+func (out *objectStoreIndexOutput) String() string {
+	return fmt.Sprintf("ObjectStoreIndexOutput(name=%v)", out.name)
+}
+
+/* Reads the blob with a range request per refill. */
+type objectStoreIndexInput struct {
+	*BufferedIndexInput
+	store  BlobStore
+	name   string
+	length int64
+}
+
+func newObjectStoreIndexInput(desc string, store BlobStore, name string,
+	length int64, context IOContext) *objectStoreIndexInput {
+
+	ans := &objectStoreIndexInput{store: store, name: name, length: length}
+	ans.BufferedIndexInput = newBufferedIndexInput(ans, desc, context)
+	return ans
+}
+
+func (in *objectStoreIndexInput) readInternal(buf []byte) error {
+	pos := in.FilePointer()
+	if pos+int64(len(buf)) > in.length {
+		return errors.New(fmt.Sprintf("read past EOF: %v", in))
+	}
+	return in.store.RangeGet(in.name, pos, buf)
+}
+
+func (in *objectStoreIndexInput) seekInternal(pos int64) error {
+	return nil // each read requests its own range
+}
+
+func (in *objectStoreIndexInput) Length() int64 {
+	return in.length
+}
+
+func (in *objectStoreIndexInput) Clone() IndexInput {
+	ans := &objectStoreIndexInput{
+		BufferedIndexInput: in.BufferedIndexInput.Clone(),
+		store:              in.store,
+		name:               in.name,
+		length:             in.length,
+	}
+	ans.SeekReader = ans
+	return ans
+}
+
+func (in *objectStoreIndexInput) Close() error {
+	return nil // nothing held open between requests
+}
@@ -0,0 +1,103 @@
+package store
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestObjectStoreDirectory(t *testing.T) {
+	path, err := ioutil.TempDir("", "golucene")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+	blobs, err := NewFSBlobStore(filepath.Join(path, "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tempDir := filepath.Join(path, "tmp")
+	if err = os.Mkdir(tempDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	dir := NewObjectStoreDirectory(blobs, tempDir)
+
+	data := make([]byte, 3*CHUNK_SIZE+123)
+	rnd := rand.New(rand.NewSource(1))
+	rnd.Read(data)
+
+	out, err := dir.CreateOutput("a.bin", IO_CONTEXT_DEFAULT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = out.WriteBytes(data); err != nil {
+		t.Fatal(err)
+	}
+	// only uploaded on close
+	if dir.FileExists("a.bin") {
+		t.Error("file should not exist before its output is closed")
+	}
+	if err = out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := ioutil.ReadDir(tempDir); len(names) != 0 {
+		t.Errorf("temp files left behind: %v", names)
+	}
+	writeTestFile(t, dir, "ab.bin", data[:10])
+	writeTestFile(t, dir, "empty.bin", nil)
+
+	all, err := dir.ListAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 {
+		t.Errorf("unexpected files: %v", all)
+	}
+	if n, err := dir.FileLength("a.bin"); err != nil || n != int64(len(data)) {
+		t.Errorf("unexpected length %v (%v)", n, err)
+	}
+	if _, err = dir.FileLength("b.bin"); !os.IsNotExist(err) {
+		t.Errorf("expected a missing file, got %v", err)
+	}
+
+	in, err := dir.OpenInput("a.bin", IO_CONTEXT_DEFAULT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	buf := make([]byte, len(data))
+	if err = in.ReadBytes(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, data) {
+		t.Fatal("content mismatch")
+	}
+	clone := in.Clone()
+	for i := 0; i < 100; i++ {
+		pos := rnd.Int63n(int64(len(data) - 100))
+		if err = clone.Seek(pos); err != nil {
+			t.Fatal(err)
+		}
+		if err = clone.ReadBytes(buf[:100]); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf[:100], data[pos:pos+100]) {
+			t.Fatalf("content mismatch at %v", pos)
+		}
+	}
+	if err = clone.Seek(int64(len(data))); err == nil {
+		if _, err = clone.ReadByte(); err == nil {
+			t.Error("expected error reading past EOF")
+		}
+	}
+
+	if err = dir.DeleteFile("a.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if dir.FileExists("a.bin") || !dir.FileExists("ab.bin") {
+		t.Error("only a.bin should have been deleted")
+	}
+}
@@ -24,6 +24,8 @@ type IndexOutput interface {
 	// file length, the bytes added to the file are undefined.
 	// Otherwise the file is truncated.
 	SetLength(length int64) error
+	// Returns the current checksum of bytes written so far
+	Checksum() int64
 }
 
 type IndexOutputImpl struct {
@@ -51,11 +53,12 @@ type ChecksumIndexOutput struct {
 }
 
 func NewChecksumIndexOutput(main IndexOutput) *ChecksumIndexOutput {
-	return &ChecksumIndexOutput{
-		IndexOutputImpl: NewIndexOutput(main),
-		main:            main,
-		digest:          crc32.NewIEEE(),
+	ans := &ChecksumIndexOutput{
+		main:   main,
+		digest: crc32.NewIEEE(),
 	}
+	ans.IndexOutputImpl = NewIndexOutput(ans)
+	return ans
 }
 
 func (out *ChecksumIndexOutput) WriteByte(b byte) error {
@@ -68,6 +71,10 @@ func (out *ChecksumIndexOutput) WriteBytes(buf []byte) error {
 	return out.main.WriteBytes(buf)
 }
 
+func (out *ChecksumIndexOutput) Checksum() int64 {
+	return int64(out.digest.Sum32())
+}
+
 func (out *ChecksumIndexOutput) Close() error {
 	return out.main.Close()
 }
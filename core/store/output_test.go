@@ -0,0 +1,64 @@
+package store
+
+import (
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestOutputChecksum(t *testing.T) {
+	path, err := ioutil.TempDir("", "golucene")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+	fsDir, err := NewSimpleFSDirectory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsDir.Close()
+
+	// large enough to cross both RAM buffer and output buffer boundaries
+	data := make([]byte, 3*BUFFER_SIZE+17)
+	for i := range data {
+		data[i] = byten(int64(i))
+	}
+	expected := int64(crc32.ChecksumIEEE(data))
+
+	for _, dir := range []Directory{NewRAMDirectory(), fsDir} {
+		out, err := dir.CreateOutput("a.bin", IO_CONTEXT_DEFAULT)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// mix single byte and bulk writes
+		for _, b := range data[:100] {
+			if err = out.WriteByte(b); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = out.WriteBytes(data[100:]); err != nil {
+			t.Fatal(err)
+		}
+		if sum := out.Checksum(); sum != expected {
+			t.Errorf("%v: expected checksum %v, but found %v", dir, expected, sum)
+		}
+		if err = out.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		in, err := dir.OpenInput("a.bin", IO_CONTEXT_DEFAULT)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cin := NewChecksumIndexInput(in)
+		buf := make([]byte, len(data))
+		if err = cin.ReadBytes(buf); err != nil {
+			t.Fatal(err)
+		}
+		if sum := cin.Checksum(); sum != expected {
+			t.Errorf("%v: expected input checksum %v, but found %v", dir, expected, sum)
+		}
+		cin.Close()
+	}
+}
@@ -3,6 +3,8 @@ package store
 import (
 	"errors"
 	"fmt"
+	"github.com/balzaczyy/golucene/core/util"
+	"hash/crc32"
 	"math"
 	"os"
 	"sync"
@@ -90,9 +92,10 @@ func (rd *RAMDirectory) SizeInBytes() int64 {
 /* Removes an existing file in the directory */
 func (rd *RAMDirectory) DeleteFile(name string) error {
 	rd.EnsureOpen()
-	rd.fileMapLock.RLock()
-	defer rd.fileMapLock.RUnlock()
+	rd.fileMapLock.Lock()
+	defer rd.fileMapLock.Unlock()
 	if file, ok := rd.fileMap[name]; ok {
+		delete(rd.fileMap, name)
 		file.directory = nil
 		atomic.AddInt64(&rd.sizeInBytes, -file.sizeInBytes)
 		return nil
@@ -130,7 +133,7 @@ func (rd *RAMDirectory) Sync(names []string) error {
 func (rd *RAMDirectory) OpenInput(name string, context IOContext) (in IndexInput, err error) {
 	rd.EnsureOpen()
 	if file, ok := rd.fileMap[name]; ok {
-		return newRAMInputStream(name, file)
+		return NewRAMInputStream(name, file)
 	}
 	return nil, errors.New(name)
 }
@@ -346,7 +349,7 @@ type RAMInputStream struct {
 	bufferLength   int
 }
 
-func newRAMInputStream(name string, f *RAMFile) (in *RAMInputStream, err error) {
+func NewRAMInputStream(name string, f *RAMFile) (in *RAMInputStream, err error) {
 	if !(f.length/BUFFER_SIZE < math.MaxInt32) {
 		return nil, errors.New(fmt.Sprintf("RAMInputStream too large length=%v: %v", f.length, name))
 	}
@@ -444,7 +447,17 @@ func (in *RAMInputStream) Seek(pos int64) error {
 }
 
 func (in *RAMInputStream) Clone() IndexInput {
-	panic("not supported yet")
+	ans := &RAMInputStream{
+		file:               in.file,
+		length:             in.length,
+		currentBuffer:      in.currentBuffer,
+		currentBufferIndex: in.currentBufferIndex,
+		bufferPosition:     in.bufferPosition,
+		bufferStart:        in.bufferStart,
+		bufferLength:       in.bufferLength,
+	}
+	ans.IndexInputImpl = newIndexInputImpl(in.desc, ans)
+	return ans
 }
 
 // store/RamOutputStream.java
@@ -463,6 +476,9 @@ type RAMOutputStream struct {
 	bufferPosition int
 	bufferStart    int64
 	bufferLength   int
+
+	crc     uint32
+	crcUpto int64 // number of bytes covered by crc
 }
 
 func NewRAMOutputStream(f *RAMFile) *RAMOutputStream {
@@ -472,6 +488,67 @@ func NewRAMOutputStream(f *RAMFile) *RAMOutputStream {
 	return out
 }
 
+/* Construct an empty output buffer. */
+func NewRAMOutputStreamBuffer() *RAMOutputStream {
+	return NewRAMOutputStream(NewRAMFileBuffer())
+}
+
+/* Copy the current contents of this buffer to the named output. */
+func (out *RAMOutputStream) WriteTo(output util.DataOutput) error {
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	end := out.file.length
+	pos, buffer := int64(0), 0
+	for pos < end {
+		length := BUFFER_SIZE
+		nextPos := pos + int64(length)
+		if nextPos > end { // at the last buffer
+			length = int(end - pos)
+		}
+		if err := output.WriteBytes(out.file.Buffer(buffer)[:length]); err != nil {
+			return err
+		}
+		buffer++
+		pos = nextPos
+	}
+	return nil
+}
+
+/*
+Copy the current contents of this buffer to output byte slice, which
+must be large enough to hold them.
+*/
+func (out *RAMOutputStream) WriteToBytes(bytes []byte) error {
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	end := out.file.length
+	pos, buffer := int64(0), 0
+	for pos < end {
+		length := BUFFER_SIZE
+		nextPos := pos + int64(length)
+		if nextPos > end { // at the last buffer
+			length = int(end - pos)
+		}
+		copy(bytes[pos:], out.file.Buffer(buffer)[:length])
+		buffer++
+		pos = nextPos
+	}
+	return nil
+}
+
+/* Resets this to an empty file. */
+func (out *RAMOutputStream) Reset() {
+	out.currentBuffer = nil
+	out.currentBufferIndex = -1
+	out.bufferPosition = 0
+	out.bufferStart = 0
+	out.bufferLength = 0
+	out.file.SetLength(0)
+	out.crc, out.crcUpto = 0, 0
+}
+
 func (out *RAMOutputStream) Close() error {
 	return out.Flush()
 }
@@ -532,6 +609,20 @@ func (out *RAMOutputStream) Flush() error {
 	return nil
 }
 
+func (out *RAMOutputStream) Checksum() int64 {
+	// all written bytes are still at hand, so catch up lazily
+	for end := out.FilePointer(); out.crcUpto < end; {
+		buf := out.file.Buffer(int(out.crcUpto / BUFFER_SIZE))
+		from, to := int(out.crcUpto%BUFFER_SIZE), len(buf)
+		if n := end - out.crcUpto + int64(from); n < int64(to) {
+			to = int(n)
+		}
+		out.crc = crc32.Update(out.crc, crc32.IEEETable, buf[from:to])
+		out.crcUpto += int64(to - from)
+	}
+	return int64(out.crc)
+}
+
 func (out *RAMOutputStream) FilePointer() int64 {
 	if out.currentBufferIndex < 0 {
 		return 0
@@ -210,7 +210,6 @@ func (out *RateLimitedIndexOutput) FlushBuffer(buf []byte) error {
 	if v, ok := out.delegate.(flushBuffer); ok {
 		return v.FlushBuffer(buf)
 	}
-	panic("double check if flushBuffer interface is satisfied")
 	return out.delegate.WriteBytes(buf)
 }
 
@@ -0,0 +1,343 @@
+package store
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+/* Connection settings of an S3BlobStore. */
+type S3Config struct {
+	// Base URL of the service, e.g. "https://s3.eu-west-1.amazonaws.com",
+	// or "http://localhost:9000" for a local MinIO.
+	Endpoint string
+	// Region the requests are signed for; defaults to "us-east-1",
+	// which MinIO accepts unless configured otherwise.
+	Region string
+	Bucket string
+	// Prepended to the blob names to form the object keys, e.g.
+	// "indexes/products/", so several indexes can share a bucket.
+	Prefix string
+	// Credentials; requests are sent unsigned if AccessKey is empty.
+	AccessKey, SecretKey string
+	// Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+/*
+A BlobStore over an S3-compatible API, using path-style URLs
+(endpoint/bucket/key) and AWS signature version 4, so it works with
+AWS S3 as well as stand-ins such as MinIO.
+
+Blobs are uploaded with a single PUT each, so they're limited to the
+5GB S3 allows per request. Payloads are sent unsigned, relying on
+the transport for their integrity; use an https endpoint outside of
+tests.
+*/
+type S3BlobStore struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+func NewS3BlobStore(config S3Config) (*S3BlobStore, error) {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, errors.New(fmt.Sprintf("invalid S3 endpoint: '%v'", config.Endpoint))
+	}
+	if config.Bucket == "" {
+		return nil, errors.New("S3 bucket must be set")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	client := config.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &S3BlobStore{config, endpoint, client}, nil
+}
+
+/* Error returned by the S3 service. */
+type S3Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+	Resource   string
+}
+
+func (err *S3Error) Error() string {
+	return fmt.Sprintf("S3 error %v %v: %v (resource=%v)",
+		err.StatusCode, err.Code, err.Message, err.Resource)
+}
+
+func (s *S3BlobStore) objectURL(name string, query url.Values) *url.URL {
+	u := *s.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.config.Bucket
+	if name != "" || query == nil {
+		u.Path += "/" + s.config.Prefix + name
+	} else {
+		u.Path += "/"
+	}
+	// send the path encoded as it's signed
+	u.RawPath = s3EscapePath(u.Path)
+	if query != nil {
+		u.RawQuery = query.Encode()
+	}
+	return &u
+}
+
+func (s *S3BlobStore) do(method string, u *url.URL, body io.Reader,
+	size int64, header http.Header) (*http.Response, error) {
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	payloadHash := EMPTY_PAYLOAD_SHA256
+	if body != nil {
+		payloadHash = "UNSIGNED-PAYLOAD"
+	}
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	if s.config.AccessKey != "" {
+		signS3Request(req, s.config.AccessKey, s.config.SecretKey,
+			s.config.Region, time.Now())
+	}
+	return s.client.Do(req)
+}
+
+// Turns a failed response into an error, closing its body.
+func s3ResponseError(resp *http.Response, name string) error {
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		io.Copy(ioutil.Discard, resp.Body)
+		return &os.PathError{Op: "get", Path: name, Err: os.ErrNotExist}
+	}
+	ans := &S3Error{StatusCode: resp.StatusCode, Message: resp.Status, Resource: name}
+	if data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024)); err == nil {
+		xml.Unmarshal(data, ans) // best effort
+	}
+	return ans
+}
+
+func (s *S3BlobStore) Put(name string, r io.Reader, size int64) error {
+	resp, err := s.do("PUT", s.objectURL(name, nil), r, size, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return s3ResponseError(resp, name)
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+func (s *S3BlobStore) RangeGet(name string, offset int64, buf []byte) error {
+	if len(buf) == 0 {
+		return nil
+	}
+	header := http.Header{}
+	header.Set("Range", fmt.Sprintf("bytes=%v-%v", offset, offset+int64(len(buf))-1))
+	resp, err := s.do("GET", s.objectURL(name, nil), nil, 0, header)
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK: // range ignored, skip to the offset
+		if _, err = io.CopyN(ioutil.Discard, resp.Body, offset); err != nil {
+			resp.Body.Close()
+			return err
+		}
+	default:
+		return s3ResponseError(resp, name)
+	}
+	defer resp.Body.Close()
+	_, err = io.ReadFull(resp.Body, buf)
+	return err
+}
+
+type s3ListResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []struct {
+		Key  string
+		Size int64
+	}
+}
+
+/*
+Lists the objects directly under the configured prefix; keys nested
+deeper, i.e. holding a further '/', are skipped.
+*/
+func (s *S3BlobStore) List(prefix string) ([]BlobInfo, error) {
+	var ans []BlobInfo
+	query := url.Values{}
+	query.Set("list-type", "2")
+	query.Set("prefix", s.config.Prefix+prefix)
+	query.Set("delimiter", "/")
+	for {
+		resp, err := s.do("GET", s.objectURL("", query), nil, 0, nil)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, s3ResponseError(resp, s.config.Prefix+prefix)
+		}
+		var result s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range result.Contents {
+			ans = append(ans, BlobInfo{strings.TrimPrefix(obj.Key, s.config.Prefix), obj.Size})
+		}
+		if !result.IsTruncated {
+			return ans, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+/* S3 doesn't report missing objects on delete, so neither does this. */
+func (s *S3BlobStore) Delete(name string) error {
+	resp, err := s.do("DELETE", s.objectURL(name, nil), nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return s3ResponseError(resp, name)
+	}
+	return resp.Body.Close()
+}
+
+func (s *S3BlobStore) String() string {
+	return fmt.Sprintf("S3BlobStore(%v/%v/%v)", s.endpoint, s.config.Bucket, s.config.Prefix)
+}
+
+// AWS signature version 4, restricted to what S3BlobStore needs
+
+/* Hex encoded SHA256 of an empty payload. */
+const EMPTY_PAYLOAD_SHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+/*
+Signs the request in place, adding the X-Amz-Date and Authorization
+headers. The host, Range, Content-Type, Content-MD5 and all x-amz-*
+headers are signed; x-amz-content-sha256 must already be set.
+*/
+func signS3Request(req *http.Request, accessKey, secretKey, region string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		k = strings.ToLower(k)
+		if k == "range" || k == "content-type" || k == "content-md5" ||
+			strings.HasPrefix(k, "x-amz-") {
+			headers[k] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k, _ := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders string
+	for _, k := range names {
+		canonicalHeaders += k + ":" + headers[k] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		req.Header.Get("x-amz-content-sha256"),
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// URI encodes everything but the unreserved characters, as AWS expects.
+func s3Escape(s string, keepSlash bool) string {
+	var ans []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || keepSlash && c == '/' {
+			ans = append(ans, c)
+		} else {
+			ans = append(ans, fmt.Sprintf("%%%02X", c)...)
+		}
+	}
+	return string(ans)
+}
+
+func s3EscapePath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return s3Escape(path, true)
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k, _ := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := query[k]
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, s3Escape(k, false)+"="+s3Escape(v, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
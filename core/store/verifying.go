@@ -0,0 +1,304 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// store/VerifyingLockFactory.java
+
+/*
+A LockFactory that wraps another LockFactory and verifies that each
+lock obtain/release is "correct" (never results in two processes
+holding the lock at the same time). It does this by contacting an
+external server (LockVerifyServer) to assert that at most one process
+holds the lock at a time. To use this, you should also run
+LockVerifyServer on the host and port matching what you pass to the
+LockStressTest.
+
+The connection must already be set up: LockStressTest dials the
+server and sends the client's id before wrapping its factory.
+*/
+type VerifyingLockFactory struct {
+	*LockFactoryImpl
+	lf   LockFactory
+	conn io.ReadWriter
+	lock sync.Locker // one message at a time on conn
+}
+
+func NewVerifyingLockFactory(lf LockFactory, conn io.ReadWriter) *VerifyingLockFactory {
+	return &VerifyingLockFactory{&LockFactoryImpl{}, lf, conn, &sync.Mutex{}}
+}
+
+func (f *VerifyingLockFactory) Make(name string) Lock {
+	ans := &checkedLock{f: f, lock: f.lf.Make(name)}
+	ans.LockImpl = NewLockImpl(ans)
+	return ans
+}
+
+func (f *VerifyingLockFactory) Clear(name string) error {
+	return f.lf.Clear(name)
+}
+
+func (f *VerifyingLockFactory) String() string {
+	return fmt.Sprintf("VerifyingLockFactory(%v)", f.lf)
+}
+
+/*
+Sends the message to the server, and waits for the acknowledgement.
+The server closes the connection if it detects a locking error.
+*/
+func (f *VerifyingLockFactory) verify(message byte) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if _, err := f.conn.Write([]byte{message}); err != nil {
+		return err
+	}
+	var buf [1]byte
+	if _, err := io.ReadFull(f.conn, buf[:]); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errors.New("Lock server died because of locking error.")
+	} else if err != nil {
+		return err
+	}
+	if buf[0] != message {
+		return errors.New("Protocol violation.")
+	}
+	return nil
+}
+
+type checkedLock struct {
+	*LockImpl
+	f    *VerifyingLockFactory
+	lock Lock
+	held bool
+}
+
+func (l *checkedLock) Obtain() (ok bool, err error) {
+	if ok, err = l.lock.Obtain(); ok && err == nil {
+		l.held = true
+		err = l.f.verify(LOCK_VERIFY_OBTAINED)
+	}
+	return
+}
+
+func (l *checkedLock) Release() error {
+	if l.held {
+		// tell the server first, before anyone else may get the lock
+		if err := l.f.verify(LOCK_VERIFY_RELEASED); err != nil {
+			return err
+		}
+		l.held = false
+	}
+	return l.lock.Release()
+}
+
+func (l *checkedLock) IsLocked() bool {
+	return l.lock.IsLocked()
+}
+
+func (l *checkedLock) String() string {
+	return fmt.Sprintf("%v", l.lock)
+}
+
+// store/LockVerifyServer.java
+
+// Messages sent by VerifyingLockFactory to LockVerifyServer.
+const (
+	LOCK_VERIFY_RELEASED = byte(0)
+	LOCK_VERIFY_OBTAINED = byte(1)
+)
+
+/*
+Simple server to which clients (LockStressTest) connect to verify
+that the lock they obtained is really exclusive. Each client first
+sends its id, then a message each time it obtains or releases the
+lock. As soon as two clients hold the lock at the same time, the
+server records the error and drops all connections, which makes the
+clients fail as well.
+*/
+type LockVerifyServer struct {
+	listener net.Listener
+	lock     sync.Locker
+	lockedID int // -1 if nobody holds the lock
+	conns    map[net.Conn]bool
+	err      error // first locking error detected
+	wg       sync.WaitGroup
+}
+
+/* Starts listening on the given address, e.g. "127.0.0.1:0". */
+func NewLockVerifyServer(addr string) (*LockVerifyServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &LockVerifyServer{
+		listener: listener,
+		lock:     &sync.Mutex{},
+		lockedID: -1,
+		conns:    make(map[net.Conn]bool),
+	}, nil
+}
+
+/* Returns the address the server listens on. */
+func (s *LockVerifyServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+/*
+Accepts and serves clients until Close() is called, or a locking
+error is detected. Returns the locking error, if any.
+*/
+func (s *LockVerifyServer) Serve() error {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			break // closed
+		}
+		s.lock.Lock()
+		if s.err != nil {
+			s.lock.Unlock()
+			conn.Close()
+			break
+		}
+		s.conns[conn] = true
+		s.lock.Unlock()
+		s.wg.Add(1)
+		go s.serve(conn)
+	}
+	s.wg.Wait()
+	return s.Err()
+}
+
+/* Returns the first locking error detected, or nil. */
+func (s *LockVerifyServer) Err() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.err
+}
+
+/* Stops accepting clients, and drops the connected ones. */
+func (s *LockVerifyServer) Close() error {
+	err := s.listener.Close()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	return err
+}
+
+func (s *LockVerifyServer) serve(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.lock.Lock()
+		delete(s.conns, conn)
+		s.lock.Unlock()
+		conn.Close()
+	}()
+
+	var buf [1]byte
+	if _, err := io.ReadFull(conn, buf[:]); err != nil {
+		return
+	}
+	id := int(buf[0])
+	for {
+		if _, err := io.ReadFull(conn, buf[:]); err != nil {
+			return // client is done
+		}
+		if err := s.check(id, buf[0]); err != nil {
+			log.Print(err)
+			s.fail(err)
+			return
+		}
+		if _, err := conn.Write(buf[:]); err != nil {
+			return
+		}
+	}
+}
+
+func (s *LockVerifyServer) check(id int, command byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	switch command {
+	case LOCK_VERIFY_OBTAINED:
+		if s.lockedID != -1 {
+			return errors.New(fmt.Sprintf(
+				"id %v got lock, but %v already holds the lock", id, s.lockedID))
+		}
+		s.lockedID = id
+	case LOCK_VERIFY_RELEASED:
+		if s.lockedID != id {
+			return errors.New(fmt.Sprintf(
+				"id %v released the lock, but %v is the one holding the lock", id, s.lockedID))
+		}
+		s.lockedID = -1
+	default:
+		return errors.New(fmt.Sprintf("Unrecognized message: %v", command))
+	}
+	return nil
+}
+
+// Records the error, and drops everybody.
+func (s *LockVerifyServer) fail(err error) {
+	s.lock.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.lock.Unlock()
+	s.Close()
+}
+
+// store/LockStressTest.java
+
+/*
+Simple standalone tool that repeatedly acquires and releases a lock
+using a specific LockFactory. Run this in multiple processes
+simultaneously, each pointing to the same lock directory and to the
+same LockVerifyServer, to verify that the LockFactory really gives
+mutual exclusion.
+
+id must be unique across the processes; each process tries count
+times to obtain the lock, holding it briefly when it succeeds, and
+sleeps up to sleepTime in between.
+*/
+func LockStressTest(id byte, verifierAddr string, lf LockFactory,
+	sleepTime time.Duration, count int) error {
+
+	conn, err := net.Dial("tcp", verifierAddr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err = conn.Write([]byte{id}); err != nil {
+		return err
+	}
+
+	lf.SetLockPrefix("test")
+	verifyLF := NewVerifyingLockFactory(lf, conn)
+	lock := verifyLF.Make("test.lock")
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))
+	for i := 0; i < count; i++ {
+		obtained, err := lock.Obtain()
+		if err != nil {
+			return err
+		}
+		if obtained {
+			if sleepTime > 0 {
+				time.Sleep(time.Duration(rnd.Int63n(int64(sleepTime))))
+			}
+			if err = lock.Release(); err != nil {
+				return err
+			}
+		}
+		if sleepTime > 0 {
+			time.Sleep(time.Duration(rnd.Int63n(int64(sleepTime))))
+		}
+	}
+	return nil
+}
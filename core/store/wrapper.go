@@ -55,6 +55,20 @@ func (w *TrackingDirectoryWrapper) Copy(to Directory, src, dest string, ctx IOCo
 	return w.Directory.Copy(to, src, dest, ctx)
 }
 
+/*
+Returns a copy of the names of the files created through this wrapper,
+and not deleted since; e.g. the files of a newly flushed segment.
+*/
+func (w *TrackingDirectoryWrapper) CreatedFiles() map[string]bool {
+	w.Lock()
+	defer w.Unlock()
+	ans := make(map[string]bool)
+	for name, _ := range w.createdFilenames {
+		ans[name] = true
+	}
+	return ans
+}
+
 func (w *TrackingDirectoryWrapper) EachCreatedFiles(f func(name string)) {
 	w.Lock()
 	defer w.Unlock()
@@ -9,8 +9,8 @@ func UTF8SortedAsUnicodeLess(aBytes, bBytes []byte) bool {
 		if i >= bLen {
 			break
 		}
-		if diff := aBytes[i] - bBytes[i]; diff != 0 {
-			return diff < 0
+		if aBytes[i] != bBytes[i] {
+			return aBytes[i] < bBytes[i]
 		}
 	}
 
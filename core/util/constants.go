@@ -1,6 +1,7 @@
 package util
 
 import (
+	"runtime"
 	"strings"
 )
 
@@ -21,3 +22,12 @@ var LUCENE_VERSION = func() string {
 		return LUCENE_MAIN_VERSION + "-SNAPSHOT"
 	}
 }()
+
+// The value of runtime.GOOS.
+const OS_NAME = runtime.GOOS
+
+// The value of runtime.GOARCH.
+const OS_ARCH = runtime.GOARCH
+
+// The Go version the program is built with.
+var GO_VERSION = runtime.Version()
@@ -19,3 +19,19 @@ func Byte315ToFloat(b byte) float32 {
 	bits += (63 - 15) << 24
 	return math.Float32frombits(bits)
 }
+
+/** floatToByte(b, mantissaBits=3, zeroExponent=15) */
+func FloatToByte315(f float32) byte {
+	bits := int32(math.Float32bits(f))
+	smallfloat := bits >> (24 - 3)
+	if smallfloat <= ((63 - 15) << 3) {
+		if bits <= 0 {
+			return 0
+		}
+		return 1
+	}
+	if smallfloat >= ((63-15)<<3)+0x100 {
+		return 0xff
+	}
+	return byte(smallfloat - ((63 - 15) << 3))
+}
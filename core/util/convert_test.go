@@ -13,3 +13,22 @@ func TestByte315ToFloat(t *testing.T) {
 		}
 	}
 }
+
+func TestFloatToByte315(t *testing.T) {
+	// every encoded value decodes and re-encodes to itself
+	for i := 0; i < 256; i++ {
+		if b := FloatToByte315(Byte315ToFloat(byte(i))); b != byte(i) {
+			t.Errorf("Byte %v should round-trip, but got %v", i, b)
+		}
+	}
+	for _, c := range []struct {
+		f float32
+		b byte
+	}{
+		{0, 0}, {-1, 0}, {1e-20, 1}, {1e20, 255}, {1, 124}, {0.5, 120},
+	} {
+		if b := FloatToByte315(c.f); b != c.b {
+			t.Errorf("%v should be encoded as %v, but got %v", c.f, c.b, b)
+		}
+	}
+}
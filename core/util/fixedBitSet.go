@@ -0,0 +1,71 @@
+package util
+
+import (
+	"math/bits"
+)
+
+// util/FixedBitSet.java
+
+/*
+BitSet of fixed length (numBits), backed by accessible []int64,
+accessed with an int index, implementing Bits.
+*/
+type FixedBitSet struct {
+	bits    []int64
+	numBits int
+	// The number of words (longs) used in the array
+	numWords int
+}
+
+// Returns the number of 64 bit words it would take to hold numBits.
+func bits2words(numBits int) int {
+	numLong := int(uint(numBits) >> 6)
+	if (numBits & 63) != 0 {
+		numLong++
+	}
+	return numLong
+}
+
+func NewFixedBitSet(numBits int) *FixedBitSet {
+	numWords := bits2words(numBits)
+	return &FixedBitSet{
+		bits:     make([]int64, numWords),
+		numBits:  numBits,
+		numWords: numWords,
+	}
+}
+
+func (b *FixedBitSet) Length() int {
+	return b.numBits
+}
+
+// Returns number of set bits. NOTE: this visits every int64 in the
+// backing bits array, and the result is not internally cached!
+func (b *FixedBitSet) Cardinality() int {
+	sum := 0
+	for _, w := range b.bits[:b.numWords] {
+		sum += bits.OnesCount64(uint64(w))
+	}
+	return sum
+}
+
+func (b *FixedBitSet) At(index int) bool {
+	assert2(index >= 0 && index < b.numBits, "index=%v", index)
+	i := index >> 6 // div 64
+	mask := int64(1) << uint(index&63)
+	return (b.bits[i] & mask) != 0
+}
+
+func (b *FixedBitSet) Set(index int) {
+	assert2(index >= 0 && index < b.numBits, "index=%v numBits=%v", index, b.numBits)
+	wordNum := index >> 6 // div 64
+	mask := int64(1) << uint(index&63)
+	b.bits[wordNum] |= mask
+}
+
+func (b *FixedBitSet) Clear(index int) {
+	assert2(index >= 0 && index < b.numBits, "index=%v numBits=%v", index, b.numBits)
+	wordNum := index >> 6
+	mask := int64(1) << uint(index&63)
+	b.bits[wordNum] &= ^mask
+}
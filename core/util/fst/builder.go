@@ -0,0 +1,563 @@
+package fst
+
+import (
+	"fmt"
+	"math"
+)
+
+// util/fst/Builder.java
+
+/*
+Builds a minimal FST (maps an []int term to an arbitrary output) from
+pre-sorted terms with outputs. The FST becomes an FSA if you use
+NoOutputs. The FST is written on-the-fly into a compact serialized
+format byte array, which can be saved to / loaded from a Directory or
+used directly for traversal. The FST is always finite (no cycles).
+
+NOTE: The algorithm is described at
+http://citeseerx.ist.psu.edu/viewdoc/summary?doi=10.1.1.24.3698
+
+The parameterized type T is the output type. See the subclasses of
+Outputs.
+
+FSTs larger than 2.1GB are now possible (as of Lucene 4.2). FSTs
+containing more than 2.1B nodes are also now possible, however they
+cannot be packed.
+*/
+type Builder struct {
+	dedupHash *NodeHash
+	fst       *FST
+	NO_OUTPUT interface{}
+
+	// simplistic pruning: we prune node (and all following nodes) if
+	// less than this number of terms go through it:
+	minSuffixCount1 int
+
+	// better pruning: we prune node (and all following nodes) if the
+	// prior node has less than this number of terms go through it:
+	minSuffixCount2 int
+
+	doShareNonSingletonNodes bool
+	shareMaxTailLength       int
+
+	lastInput []int
+
+	// current frontier
+	frontier []*UnCompiledNode
+}
+
+/*
+Instantiates an FST/FSA builder without any pruning. A shortcut to
+NewBuilder(inputType, 0, 0, true, true, math.MaxInt32, outputs, true, 15).
+*/
+func NewBuilderWithOutputs(inputType InputType, outputs Outputs) *Builder {
+	return NewBuilder(inputType, 0, 0, true, true, math.MaxInt32, outputs, true, 15)
+}
+
+/*
+Instantiates an FST/FSA builder with all the possible tuning and
+construction tweaks. Read parameter documentation carefully.
+
+inputType: The input type (transition labels). Can be anything from
+INPUT_TYPE_BYTE1 (8 bit labels), INPUT_TYPE_BYTE2 (16 bit labels) or
+INPUT_TYPE_BYTE4 (utf32 labels).
+
+minSuffixCount1: If pruning the input graph during construction, this
+threshold is used for telling if a node is kept or pruned. If
+transition_count(node) >= minSuffixCount1, the node is kept.
+
+minSuffixCount2: (Note: only Mike McCandless knows what this one is
+really doing...)
+
+doShareSuffix: If true, the shared suffixes will be compacted into
+unique paths. This requires an additional RAM-intensive hash map for
+lookups in memory. Setting this parameter to false creates a single
+suffix path for all input sequences. This will result in a larger
+FST, but requires substantially less memory and CPU during building.
+
+doShareNonSingletonNodes: Only used if doShareSuffix is true. Set
+this to true to ensure FST is fully minimal, at cost of more CPU and
+more RAM during building.
+
+shareMaxTailLength: Only used if doShareSuffix is true. Set this to
+math.MaxInt32 to ensure FST is fully minimal, at cost of more CPU and
+more RAM during building.
+
+outputs: The output type for each input sequence. Applies only if
+building an FST. For FSA, use NoOutputs and NoOutputs.NoOutput() as
+the singleton output object.
+
+allowArrayArcs: Pass false to disable the array arc optimization
+while building the FST; this will make the resulting FST smaller but
+slower to traverse.
+
+bytesPageBits: How many bits wide to make each []byte page in the
+BytesStore; if you know the FST will be large then make this larger.
+For example 15 bits = 32768 byte pages.
+*/
+func NewBuilder(inputType InputType, minSuffixCount1, minSuffixCount2 int,
+	doShareSuffix, doShareNonSingletonNodes bool, shareMaxTailLength int,
+	outputs Outputs, allowArrayArcs bool, bytesPageBits uint32) *Builder {
+
+	b := &Builder{
+		minSuffixCount1:          minSuffixCount1,
+		minSuffixCount2:          minSuffixCount2,
+		doShareNonSingletonNodes: doShareNonSingletonNodes,
+		shareMaxTailLength:       shareMaxTailLength,
+		fst:                      newFSTForBuilding(inputType, outputs, allowArrayArcs, bytesPageBits),
+		NO_OUTPUT:                outputs.NoOutput(),
+	}
+	if doShareSuffix {
+		b.dedupHash = newNodeHash(b.fst, b.fst.bytes.reverseReaderAllowSingle(false))
+	}
+	b.frontier = make([]*UnCompiledNode, 10)
+	for idx, _ := range b.frontier {
+		b.frontier[idx] = newUnCompiledNode(b, idx)
+	}
+	return b
+}
+
+func (b *Builder) TotStateCount() int64 {
+	return b.fst.nodeCount
+}
+
+func (b *Builder) TermCount() int64 {
+	return b.frontier[0].inputCount
+}
+
+func (b *Builder) MappedStateCount() int64 {
+	if b.dedupHash == nil {
+		return 0
+	}
+	return b.fst.nodeCount
+}
+
+func (b *Builder) compileNode(nodeIn *UnCompiledNode, tailLength int) (*CompiledNode, error) {
+	var node int64
+	var err error
+	if b.dedupHash != nil &&
+		(b.doShareNonSingletonNodes || nodeIn.numArcs <= 1) &&
+		tailLength <= b.shareMaxTailLength {
+		if nodeIn.numArcs == 0 {
+			node, err = b.fst.addNode(nodeIn)
+		} else {
+			node, err = b.dedupHash.add(nodeIn)
+		}
+	} else {
+		node, err = b.fst.addNode(nodeIn)
+	}
+	if err != nil {
+		return nil, err
+	}
+	assert(node != -2)
+
+	nodeIn.clear()
+
+	return &CompiledNode{node}, nil
+}
+
+func (b *Builder) freezeTail(prefixLenPlus1 int) error {
+	downTo := prefixLenPlus1
+	if downTo < 1 {
+		downTo = 1
+	}
+	for idx := len(b.lastInput); idx >= downTo; idx-- {
+		doPrune := false
+		doCompile := false
+
+		node := b.frontier[idx]
+		parent := b.frontier[idx-1]
+
+		if node.inputCount < int64(b.minSuffixCount1) {
+			doPrune = true
+			doCompile = true
+		} else if idx > prefixLenPlus1 {
+			// prune if parent's inputCount is less than suffixMinCount2
+			if parent.inputCount < int64(b.minSuffixCount2) ||
+				(b.minSuffixCount2 == 1 && parent.inputCount == 1 && idx > 1) {
+				// my parent, about to be compiled, doesn't make the cut, so
+				// I'm definitely pruned
+
+				// if minSuffixCount2 is 1, we keep only up
+				// until the 'distinguished edge', ie we keep only the
+				// 'divergent' part of the FST. if my parent, about to be
+				// compiled, has inputCount 1 then we are already past the
+				// distinguished edge.  NOTE: this only works if
+				// the FST outputs are not "compressible" (simple
+				// ords ARE compressible).
+				doPrune = true
+			} else {
+				// my parent, about to be compiled, does make the cut, so
+				// I'm definitely not pruned
+				doPrune = false
+			}
+			doCompile = true
+		} else {
+			// if pruning is disabled (count is 0) we can always
+			// compile current node
+			doCompile = b.minSuffixCount2 == 0
+		}
+
+		if node.inputCount < int64(b.minSuffixCount2) ||
+			(b.minSuffixCount2 == 1 && node.inputCount == 1 && idx > 1) {
+			// drop all arcs
+			for arcIdx := 0; arcIdx < node.numArcs; arcIdx++ {
+				node.arcs[arcIdx].target.(*UnCompiledNode).clear()
+			}
+			node.numArcs = 0
+		}
+
+		if doPrune {
+			// this node doesn't make it -- deref it
+			node.clear()
+			parent.deleteLast(b.lastInput[idx-1], node)
+		} else {
+			if b.minSuffixCount2 != 0 {
+				if err := b.compileAllTargets(node, len(b.lastInput)-idx); err != nil {
+					return err
+				}
+			}
+			nextFinalOutput := node.output
+
+			// We "fake" the node as being final if it has no outgoing
+			// arcs; in theory we could leave it as non-final (the FST
+			// can represent this), but FSTEnum, Util, etc., have trouble
+			// w/ non-final dead-end states:
+			isFinal := node.isFinal || node.numArcs == 0
+
+			if doCompile {
+				// this node makes it and we now compile it. first, compile
+				// any targets that were previously undecided:
+				compiled, err := b.compileNode(node, 1+len(b.lastInput)-idx)
+				if err != nil {
+					return err
+				}
+				parent.replaceLast(b.lastInput[idx-1], compiled, nextFinalOutput, isFinal)
+			} else {
+				// replaceLast just to install nextFinalOutput/isFinal onto
+				// the arc
+				parent.replaceLast(b.lastInput[idx-1], node, nextFinalOutput, isFinal)
+				// this node will stay in play for now, since we are
+				// undecided on whether to prune it. later, it will be
+				// either compiled or pruned, so we must allocate a new node:
+				b.frontier[idx] = newUnCompiledNode(b, idx)
+			}
+		}
+	}
+	return nil
+}
+
+/*
+It's OK to add the same input twice in a row with different outputs,
+as long as outputs impls the merge method. Note that input is fully
+consumed after this method is returned (so caller is free to reuse),
+but output is not. So if your outputs are changeable (eg
+ByteSequenceOutputs or IntSequenceOutputs) then you cannot reuse
+across calls.
+*/
+func (b *Builder) Add(input []int, output interface{}) error {
+	// De-dup NO_OUTPUT since it must be a singleton:
+	if equals(output, b.NO_OUTPUT) {
+		output = b.NO_OUTPUT
+	}
+
+	assertn(len(b.lastInput) == 0 || compareInts(input, b.lastInput) >= 0,
+		"inputs are added out of order lastInput=%v vs input=%v", b.lastInput, input)
+
+	if len(input) == 0 {
+		// empty input: only allowed as first input. we have to special
+		// case this because the packed FST format cannot represent the
+		// empty input since 'finalness' is stored on the incoming arc,
+		// not on the node
+		b.frontier[0].inputCount++
+		b.frontier[0].isFinal = true
+		b.fst.setEmptyOutput(output)
+		return nil
+	}
+
+	// compare shared prefix length
+	pos1 := 0
+	pos1Stop := len(b.lastInput)
+	if len(input) < pos1Stop {
+		pos1Stop = len(input)
+	}
+	for {
+		b.frontier[pos1].inputCount++
+		if pos1 >= pos1Stop || b.lastInput[pos1] != input[pos1] {
+			break
+		}
+		pos1++
+	}
+	prefixLenPlus1 := pos1 + 1
+
+	if len(b.frontier) < len(input)+1 {
+		next := make([]*UnCompiledNode, oversize(len(input)+1))
+		copy(next, b.frontier)
+		for idx := len(b.frontier); idx < len(next); idx++ {
+			next[idx] = newUnCompiledNode(b, idx)
+		}
+		b.frontier = next
+	}
+
+	// minimize/compile states from previous input's orphan'd suffix
+	if err := b.freezeTail(prefixLenPlus1); err != nil {
+		return err
+	}
+
+	// init tail states for current input
+	for idx := prefixLenPlus1; idx <= len(input); idx++ {
+		b.frontier[idx-1].addArc(input[idx-1], b.frontier[idx])
+		b.frontier[idx].inputCount++
+	}
+
+	lastNode := b.frontier[len(input)]
+	if len(b.lastInput) != len(input) || prefixLenPlus1 != len(input)+1 {
+		lastNode.isFinal = true
+		lastNode.output = b.NO_OUTPUT
+	}
+
+	// push conflicting outputs forward, only as far as needed
+	outputs := b.fst.outputs
+	for idx := 1; idx < prefixLenPlus1; idx++ {
+		node := b.frontier[idx]
+		parentNode := b.frontier[idx-1]
+
+		lastOutput := parentNode.lastOutput(input[idx-1])
+
+		var commonOutputPrefix interface{}
+		if !equals(lastOutput, b.NO_OUTPUT) {
+			commonOutputPrefix = outputs.Common(output, lastOutput)
+			wordSuffix := outputs.Subtract(lastOutput, commonOutputPrefix)
+			parentNode.setLastOutput(input[idx-1], commonOutputPrefix)
+			node.prependOutput(wordSuffix)
+		} else {
+			commonOutputPrefix = b.NO_OUTPUT
+		}
+
+		output = outputs.Subtract(output, commonOutputPrefix)
+	}
+
+	if len(b.lastInput) == len(input) && prefixLenPlus1 == 1+len(input) {
+		// same input more than 1 time in a row, mapping to multiple
+		// outputs
+		lastNode.output = outputs.Merge(lastNode.output, output)
+	} else {
+		// this new arc is private to this new input; set its arc
+		// output to the leftover output:
+		b.frontier[prefixLenPlus1-1].setLastOutput(input[prefixLenPlus1-1], output)
+	}
+
+	// save last input
+	b.lastInput = append(b.lastInput[:0], input...)
+	return nil
+}
+
+/*
+Returns final FST. NOTE: this will return nil if nothing is accepted
+by the FST.
+*/
+func (b *Builder) Finish() (*FST, error) {
+	root := b.frontier[0]
+
+	// minimize nodes in the last word's suffix
+	if err := b.freezeTail(0); err != nil {
+		return nil, err
+	}
+	if root.inputCount < int64(b.minSuffixCount1) ||
+		root.inputCount < int64(b.minSuffixCount2) || root.numArcs == 0 {
+		if b.fst.emptyOutput == nil {
+			return nil, nil
+		} else if b.minSuffixCount1 > 0 || b.minSuffixCount2 > 0 {
+			// empty string got pruned
+			return nil, nil
+		}
+	} else {
+		if b.minSuffixCount2 != 0 {
+			if err := b.compileAllTargets(root, len(b.lastInput)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	compiled, err := b.compileNode(root, len(b.lastInput))
+	if err != nil {
+		return nil, err
+	}
+	if err = b.fst.finish(compiled.node); err != nil {
+		return nil, err
+	}
+	return b.fst, nil
+}
+
+func (b *Builder) compileAllTargets(node *UnCompiledNode, tailLength int) error {
+	for arcIdx := 0; arcIdx < node.numArcs; arcIdx++ {
+		arc := node.arcs[arcIdx]
+		if n, ok := arc.target.(*UnCompiledNode); ok {
+			// not yet compiled
+			if n.numArcs == 0 {
+				n.isFinal = true
+				arc.isFinal = true
+			}
+			compiled, err := b.compileNode(n, tailLength-1)
+			if err != nil {
+				return err
+			}
+			arc.target = compiled
+		}
+	}
+	return nil
+}
+
+func compareInts(a, b []int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] - b[i]
+		}
+	}
+	return len(a) - len(b)
+}
+
+func oversize(minSize int) int {
+	return minSize + minSize>>3 + 3
+}
+
+func assert(ok bool) {
+	if !ok {
+		panic("assert fail")
+	}
+}
+
+func assertn(ok bool, msg string, args ...interface{}) {
+	if !ok {
+		panic(fmt.Sprintf(msg, args...))
+	}
+}
+
+/* Expert: holds a pending (seen but not yet serialized) arc. */
+type BuilderArc struct {
+	label           int
+	target          Node
+	isFinal         bool
+	output          interface{}
+	nextFinalOutput interface{}
+}
+
+// NOTE: not many instances of Node or CompiledNode are in memory
+// while the FST is being built; it's only the current "frontier":
+
+type Node interface {
+	isCompiled() bool
+}
+
+type CompiledNode struct {
+	node int64
+}
+
+func (n *CompiledNode) isCompiled() bool { return true }
+
+/* Expert: holds a pending (seen but not yet serialized) Node. */
+type UnCompiledNode struct {
+	owner   *Builder
+	numArcs int
+	arcs    []*BuilderArc
+	// TODO: instead of recording isFinal/output on the node, maybe we
+	// should use -1 arc to mean "end" (like we do when reading the
+	// FST). Would simplify much code here...
+	output     interface{}
+	isFinal    bool
+	inputCount int64
+
+	// This node's depth, starting from the automaton root.
+	depth int
+}
+
+/*
+depth: The node's depth starting from the automaton root. Needed for
+LUCENE-2934 (node expansion based on conditions other than the
+fanout size).
+*/
+func newUnCompiledNode(owner *Builder, depth int) *UnCompiledNode {
+	return &UnCompiledNode{
+		owner:  owner,
+		arcs:   []*BuilderArc{new(BuilderArc)},
+		output: owner.NO_OUTPUT,
+		depth:  depth,
+	}
+}
+
+func (n *UnCompiledNode) isCompiled() bool { return false }
+
+func (n *UnCompiledNode) clear() {
+	n.numArcs = 0
+	n.isFinal = false
+	n.output = n.owner.NO_OUTPUT
+	n.inputCount = 0
+
+	// We don't clear the depth here because it never changes for
+	// nodes on the frontier (even when reused).
+}
+
+func (n *UnCompiledNode) lastOutput(labelToMatch int) interface{} {
+	assert(n.numArcs > 0)
+	assert(n.arcs[n.numArcs-1].label == labelToMatch)
+	return n.arcs[n.numArcs-1].output
+}
+
+func (n *UnCompiledNode) addArc(label int, target Node) {
+	assert(label >= 0)
+	if n.numArcs > 0 {
+		assertn(label > n.arcs[n.numArcs-1].label,
+			"arc[-1].label=%v new label=%v numArcs=%v",
+			n.arcs[n.numArcs-1].label, label, n.numArcs)
+	}
+	if n.numArcs == len(n.arcs) {
+		next := make([]*BuilderArc, oversize(n.numArcs+1))
+		copy(next, n.arcs)
+		for idx := n.numArcs; idx < len(next); idx++ {
+			next[idx] = new(BuilderArc)
+		}
+		n.arcs = next
+	}
+	arc := n.arcs[n.numArcs]
+	n.numArcs++
+	arc.label = label
+	arc.target = target
+	arc.output = n.owner.NO_OUTPUT
+	arc.nextFinalOutput = n.owner.NO_OUTPUT
+	arc.isFinal = false
+}
+
+func (n *UnCompiledNode) replaceLast(labelToMatch int, target Node,
+	nextFinalOutput interface{}, isFinal bool) {
+	assert(n.numArcs > 0)
+	arc := n.arcs[n.numArcs-1]
+	assertn(arc.label == labelToMatch, "arc.label=%v vs %v", arc.label, labelToMatch)
+	arc.target = target
+	arc.nextFinalOutput = nextFinalOutput
+	arc.isFinal = isFinal
+}
+
+func (n *UnCompiledNode) deleteLast(label int, target Node) {
+	assert(n.numArcs > 0)
+	assert(label == n.arcs[n.numArcs-1].label)
+	assert(target == n.arcs[n.numArcs-1].target)
+	n.numArcs--
+}
+
+func (n *UnCompiledNode) setLastOutput(labelToMatch int, newOutput interface{}) {
+	assert(n.numArcs > 0)
+	arc := n.arcs[n.numArcs-1]
+	assert(arc.label == labelToMatch)
+	arc.output = newOutput
+}
+
+// pushes an output prefix forward onto all arcs
+func (n *UnCompiledNode) prependOutput(outputPrefix interface{}) {
+	outputs := n.owner.fst.outputs
+	for arcIdx := 0; arcIdx < n.numArcs; arcIdx++ {
+		n.arcs[arcIdx].output = outputs.Add(outputPrefix, n.arcs[arcIdx].output)
+	}
+
+	if n.isFinal {
+		n.output = outputs.Add(outputPrefix, n.output)
+	}
+}
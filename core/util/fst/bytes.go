@@ -95,6 +95,91 @@ func (bs *BytesStore) WriteBytes(buf []byte) error {
 	return nil
 }
 
+/* Absolute write byte; you must ensure dest is < max position written so far. */
+func (bs *BytesStore) writeByteAt(dest int64, b byte) {
+	bs.blocks[dest>>bs.blockBits][uint32(dest)&bs.blockMask] = b
+}
+
+func (bs *BytesStore) byteAt(src int64) byte {
+	return bs.blocks[src>>bs.blockBits][uint32(src)&bs.blockMask]
+}
+
+/*
+Absolute writeBytes without changing the current position. Note: this
+cannot "grow" the bytes, so you must only call it on already written
+parts.
+*/
+func (bs *BytesStore) writeBytesAt(dest int64, b []byte) {
+	assert(dest+int64(len(b)) <= bs.getPosition())
+	for i, v := range b {
+		bs.writeByteAt(dest+int64(i), v)
+	}
+}
+
+/*
+Absolute copy bytes self to self, without changing the position.
+Note: this cannot "grow" the bytes, so must only call it on already
+written parts. Bytes are copied from the end, so dest may overlap src
+as long as dest > src.
+*/
+func (bs *BytesStore) copyBytes(src, dest int64, length int) {
+	assert(src < dest)
+	assert(dest+int64(length) <= bs.getPosition())
+	for i := int64(length) - 1; i >= 0; i-- {
+		bs.writeByteAt(dest+i, bs.byteAt(src+i))
+	}
+}
+
+/* Reverse from srcPos, inclusive, to destPos, inclusive. */
+func (bs *BytesStore) reverse(srcPos, destPos int64) {
+	assert(srcPos < destPos)
+	assert(destPos < bs.getPosition())
+	for srcPos < destPos {
+		b := bs.byteAt(srcPos)
+		bs.writeByteAt(srcPos, bs.byteAt(destPos))
+		bs.writeByteAt(destPos, b)
+		srcPos++
+		destPos--
+	}
+}
+
+func (bs *BytesStore) skipBytes(length int) {
+	for length > 0 {
+		chunk := int(bs.blockSize - bs.nextWrite)
+		if length <= chunk {
+			bs.nextWrite += uint32(length)
+			break
+		}
+		length -= chunk
+		bs.current = make([]byte, bs.blockSize)
+		bs.blocks = append(bs.blocks, bs.current)
+		bs.nextWrite = 0
+	}
+}
+
+func (bs *BytesStore) getPosition() int64 {
+	return int64(len(bs.blocks)-1)*int64(bs.blockSize) + int64(bs.nextWrite)
+}
+
+func (bs *BytesStore) finish() {
+	if bs.current != nil {
+		lastBuffer := make([]byte, bs.nextWrite)
+		copy(lastBuffer, bs.current[:bs.nextWrite])
+		bs.blocks[len(bs.blocks)-1] = lastBuffer
+		bs.current = nil
+	}
+}
+
+/* Writes all of our bytes to the target DataOutput. */
+func (bs *BytesStore) writeTo(out util.DataOutput) error {
+	for _, block := range bs.blocks {
+		if err := out.WriteBytes(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *BytesStore) String() string {
 	return fmt.Sprintf("%v-bits x%v bytes store", s.blockBits, len(s.blocks))
 }
@@ -216,7 +301,7 @@ func (r *BytesStoreReverseReader) setPosition(pos int64) {
 	// setPosition(0), the next byte you read is
 	// bytes[0] ... but I would expect bytes[-1] (ie,
 	// EOF)...?
-	bufferIndex := int32(pos >> r.owner.blockSize)
+	bufferIndex := int32(pos >> r.owner.blockBits)
 	r.nextBuffer = bufferIndex - 1
 	r.current = r.owner.blocks[bufferIndex]
 	r.nextRead = int32(uint32(pos) & r.owner.blockMask)
@@ -235,7 +320,7 @@ func (bs *BytesStore) reverseReaderAllowSingle(allowSingle bool) BytesReader {
 	if len(bs.blocks) > 0 {
 		current = bs.blocks[0]
 	}
-	ans := &BytesStoreReverseReader{current: current, nextBuffer: -1, nextRead: 0}
+	ans := &BytesStoreReverseReader{owner: bs, current: current, nextBuffer: -1, nextRead: 0}
 	ans.DataInputImpl = &util.DataInputImpl{ans}
 	return ans
 }
@@ -38,6 +38,24 @@ const (
 	FST_END_LABEL = -1
 
 	FST_DEFAULT_MAX_BLOCK_BITS = 28 // 30 for 64 bit int
+
+	// Changed numBytesPerArc for array'd case from byte to int.
+	FST_VERSION_CURRENT = FST_VERSION_VINT_TARGET
+
+	/*
+		@see #shouldExpand(UnCompiledNode)
+	*/
+	FST_FIXED_ARRAY_SHALLOW_DISTANCE = 3 // 0 => only root node.
+
+	/*
+		@see #shouldExpand(UnCompiledNode)
+	*/
+	FST_FIXED_ARRAY_NUM_ARCS_SHALLOW = 5
+
+	/*
+		@see #shouldExpand(UnCompiledNode)
+	*/
+	FST_FIXED_ARRAY_NUM_ARCS_DEEP = 10
 )
 
 // Represents a single arc
@@ -139,6 +157,30 @@ type FST struct {
 	version int32
 
 	nodeAddress *packed.GrowableWriter
+
+	// Used during building, to remember the last frozen node so
+	// the next arc pointing to it can use BIT_TARGET_NEXT:
+	lastFrozenNode int64
+	allowArrayArcs bool
+	bytesPerArc    []int
+}
+
+/* Make a new empty FST, for building; Builder invokes this. */
+func newFSTForBuilding(inputType InputType, outputs Outputs,
+	allowArrayArcs bool, bytesPageBits uint32) *FST {
+	fst := &FST{
+		inputType:      inputType,
+		outputs:        outputs,
+		allowArrayArcs: allowArrayArcs,
+		version:        FST_VERSION_CURRENT,
+		bytes:          newBytesStoreFromBits(bytesPageBits),
+		NO_OUTPUT:      outputs.NoOutput(),
+		startNode:      -1,
+	}
+	// pad: ensure no node gets address 0 which is reserved to mean
+	// the stop state w/ no arcs
+	fst.bytes.WriteByte(0)
+	return fst
 }
 
 func LoadFST(in util.DataInput, outputs Outputs) (fst *FST, err error) {
@@ -251,6 +293,259 @@ func loadFST3(in util.DataInput, outputs Outputs, maxBlockBits uint32) (fst *FST
 	return fst, err
 }
 
+func (t *FST) finish(newStartNode int64) error {
+	assertn(t.startNode == -1, "already finished")
+	if newStartNode == FST_FINAL_END_NODE && t.emptyOutput != nil {
+		newStartNode = 0
+	}
+	t.startNode = newStartNode
+	t.bytes.finish()
+	return t.cacheRootArcs()
+}
+
+func (t *FST) setEmptyOutput(v interface{}) {
+	if t.emptyOutput != nil {
+		t.emptyOutput = t.outputs.Merge(t.emptyOutput, v)
+	} else {
+		t.emptyOutput = v
+	}
+}
+
+func (t *FST) Save(out util.DataOutput) error {
+	assertn(t.startNode != -1, "call finish first")
+	assertn(t.nodeAddress == nil, "cannot save an FST pre-packed FST; it must first be packed")
+	assertn(!t.packed, "cannot save a packed FST")
+	err := codec.WriteHeader(out, FST_FILE_FORMAT_NAME, FST_VERSION_CURRENT)
+	if err == nil {
+		err = out.WriteByte(0) // not packed
+	}
+	if err != nil {
+		return err
+	}
+	// TODO: really we should encode this as an arc, arriving
+	// to the root node, instead of special casing here:
+	if t.emptyOutput != nil {
+		// Accepts empty string
+		if err = out.WriteByte(1); err != nil {
+			return err
+		}
+
+		// Serialize empty-string output:
+		ros := newBytesWriter()
+		if err = t.outputs.WriteFinalOutput(t.emptyOutput, ros); err != nil {
+			return err
+		}
+		emptyOutputBytes := ros.Bytes()
+
+		// reverse
+		for i, j := 0, len(emptyOutputBytes)-1; i < j; i, j = i+1, j-1 {
+			emptyOutputBytes[i], emptyOutputBytes[j] = emptyOutputBytes[j], emptyOutputBytes[i]
+		}
+		err = out.WriteVInt(int32(len(emptyOutputBytes)))
+		if err == nil {
+			err = out.WriteBytes(emptyOutputBytes)
+		}
+	} else {
+		err = out.WriteByte(0)
+	}
+	if err != nil {
+		return err
+	}
+	var t2 byte
+	switch t.inputType {
+	case INPUT_TYPE_BYTE1:
+		t2 = 0
+	case INPUT_TYPE_BYTE2:
+		t2 = 1
+	default:
+		t2 = 2
+	}
+	if err = out.WriteByte(t2); err != nil {
+		return err
+	}
+	for _, v := range []int64{t.startNode, t.nodeCount, t.arcCount,
+		t.arcWithOutputCount, t.bytes.getPosition()} {
+		if err = out.WriteVLong(v); err != nil {
+			return err
+		}
+	}
+	return t.bytes.writeTo(out)
+}
+
+func (t *FST) writeLabel(out util.DataOutput, v int) error {
+	assertn(v >= 0, "v=%v", v)
+	switch t.inputType {
+	case INPUT_TYPE_BYTE1:
+		assertn(v <= 255, "v=%v", v)
+		return out.WriteByte(byte(v))
+	case INPUT_TYPE_BYTE2:
+		assertn(v <= 65535, "v=%v", v)
+		if err := out.WriteByte(byte(v >> 8)); err != nil {
+			return err
+		}
+		return out.WriteByte(byte(v))
+	default:
+		return out.WriteVInt(int32(v))
+	}
+}
+
+/*
+Serializes new node by appending its bytes to the end of the current
+[]byte.
+*/
+func (t *FST) addNode(nodeIn *UnCompiledNode) (int64, error) {
+	if nodeIn.numArcs == 0 {
+		if nodeIn.isFinal {
+			return FST_FINAL_END_NODE, nil
+		}
+		return FST_NON_FINAL_END_NODE, nil
+	}
+
+	startAddress := t.bytes.getPosition()
+
+	doFixedArray := t.shouldExpand(nodeIn)
+	if doFixedArray {
+		if len(t.bytesPerArc) < nodeIn.numArcs {
+			t.bytesPerArc = make([]int, oversize(nodeIn.numArcs))
+		}
+	}
+
+	t.arcCount += int64(nodeIn.numArcs)
+
+	lastArc := nodeIn.numArcs - 1
+
+	lastArcStart := t.bytes.getPosition()
+	maxBytesPerArc := 0
+	for arcIdx := 0; arcIdx < nodeIn.numArcs; arcIdx++ {
+		arc := nodeIn.arcs[arcIdx]
+		target := arc.target.(*CompiledNode)
+		var flags byte = 0
+
+		if arcIdx == lastArc {
+			flags += FST_BIT_LAST_ARC
+		}
+
+		if t.lastFrozenNode == target.node && !doFixedArray {
+			// TODO: for better perf (but more RAM used) we could avoid
+			// this except when arc is "near" the last arc:
+			flags += FST_BIT_TARGET_NEXT
+		}
+
+		if arc.isFinal {
+			flags += FST_BIT_FINAL_ARC
+			if !equals(arc.nextFinalOutput, t.NO_OUTPUT) {
+				flags += FST_BIT_ARC_HAS_FINAL_OUTPUT
+			}
+		} else {
+			assert(equals(arc.nextFinalOutput, t.NO_OUTPUT))
+		}
+
+		targetHasArcs := target.node > 0
+
+		if !targetHasArcs {
+			flags += FST_BIT_STOP_NODE
+		}
+
+		hasOutput := !equals(arc.output, t.NO_OUTPUT)
+		if hasOutput {
+			flags += FST_BIT_ARC_HAS_OUTPUT
+		}
+
+		err := t.bytes.WriteByte(flags)
+		if err == nil {
+			err = t.writeLabel(t.bytes, arc.label)
+		}
+		if err == nil && hasOutput {
+			err = t.outputs.Write(arc.output, t.bytes)
+			t.arcWithOutputCount++
+		}
+		if err == nil && !equals(arc.nextFinalOutput, t.NO_OUTPUT) {
+			err = t.outputs.WriteFinalOutput(arc.nextFinalOutput, t.bytes)
+		}
+		if err == nil && targetHasArcs && (flags&FST_BIT_TARGET_NEXT) == 0 {
+			assert(target.node > 0)
+			err = t.bytes.WriteVLong(target.node)
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		// just write the arcs "like normal" on first pass, but record
+		// how many bytes each one took, and max byte size:
+		if doFixedArray {
+			t.bytesPerArc[arcIdx] = int(t.bytes.getPosition() - lastArcStart)
+			lastArcStart = t.bytes.getPosition()
+			if t.bytesPerArc[arcIdx] > maxBytesPerArc {
+				maxBytesPerArc = t.bytesPerArc[arcIdx]
+			}
+		}
+	}
+
+	// TODO: try to avoid wasteful cases: disable doFixedArray in that
+	// case
+
+	// TODO: clean this up: or just rewind+reuse and deal with it
+	if doFixedArray {
+		assert(maxBytesPerArc > 0)
+		// 2nd pass just "expands" all arcs to take up a fixed byte size
+
+		// create the header
+		header := newBytesWriter()
+		// write a "false" first arc:
+		header.WriteByte(FST_ARCS_AS_FIXED_ARRAY)
+		header.WriteVInt(int32(nodeIn.numArcs))
+		header.WriteVInt(int32(maxBytesPerArc))
+		headerLen := int64(header.Len())
+
+		fixedArrayStart := startAddress + headerLen
+
+		// expand the arcs in place, backwards
+		srcPos := t.bytes.getPosition()
+		destPos := fixedArrayStart + int64(nodeIn.numArcs*maxBytesPerArc)
+		assert(destPos >= srcPos)
+		if destPos > srcPos {
+			t.bytes.skipBytes(int(destPos - srcPos))
+			for arcIdx := nodeIn.numArcs - 1; arcIdx >= 0; arcIdx-- {
+				destPos -= int64(maxBytesPerArc)
+				srcPos -= int64(t.bytesPerArc[arcIdx])
+				if srcPos != destPos {
+					assertn(destPos > srcPos,
+						"destPos=%v srcPos=%v arcIdx=%v maxBytesPerArc=%v bytesPerArc[arcIdx]=%v nodeIn.numArcs=%v",
+						destPos, srcPos, arcIdx, maxBytesPerArc, t.bytesPerArc[arcIdx], nodeIn.numArcs)
+					t.bytes.copyBytes(srcPos, destPos, t.bytesPerArc[arcIdx])
+				}
+			}
+		}
+
+		// now write the header
+		t.bytes.writeBytesAt(startAddress, header.Bytes())
+	}
+
+	thisNodeAddress := t.bytes.getPosition() - 1
+
+	t.bytes.reverse(startAddress, thisNodeAddress)
+
+	t.nodeCount++
+	node := thisNodeAddress
+	t.lastFrozenNode = node
+	return node, nil
+}
+
+/*
+Nodes will be expanded if their depth (distance from the root node) is
+<= this value and their number of arcs is >=
+FST_FIXED_ARRAY_NUM_ARCS_SHALLOW.
+
+Fixed array consumes more RAM but enables binary search on the arcs
+(instead of a linear scan) on lookup by arc label.
+*/
+func (t *FST) shouldExpand(node *UnCompiledNode) bool {
+	return t.allowArrayArcs &&
+		((node.depth <= FST_FIXED_ARRAY_SHALLOW_DISTANCE &&
+			node.numArcs >= FST_FIXED_ARRAY_NUM_ARCS_SHALLOW) ||
+			node.numArcs >= FST_FIXED_ARRAY_NUM_ARCS_DEEP)
+}
+
 func (t *FST) getNodeAddress(node int64) int64 {
 	if t.nodeAddress != nil { // Deref
 		return t.nodeAddress.Get(int(node))
@@ -382,12 +677,14 @@ func CompareFSTValue(a, b interface{}) bool {
 func (t *FST) readLabel(in util.DataInput) (v int, err error) {
 	switch t.inputType {
 	case INPUT_TYPE_BYTE1: // Unsigned byte
-		if b, err := in.ReadByte(); err == nil {
+		var b byte
+		if b, err = in.ReadByte(); err == nil {
 			v = int(b)
 		}
 	case INPUT_TYPE_BYTE2: // Unsigned short
-		if s, err := in.ReadShort(); err == nil {
-			v = int(s)
+		var s int16
+		if s, err = in.ReadShort(); err == nil {
+			v = int(uint16(s))
 		}
 	default:
 		v, err = AsInt(in.ReadVInt())
@@ -599,8 +896,6 @@ func (t *FST) FindTargetArc(labelToMatch int, follow *Arc, arc *Arc, in BytesRea
 
 	arc.node = follow.target
 
-	log.Printf("fta label=%v", labelToMatch)
-
 	b, err := in.ReadByte()
 	if err != nil {
 		return nil, err
@@ -623,8 +918,7 @@ func (t *FST) FindTargetArc(labelToMatch int, follow *Arc, arc *Arc, in BytesRea
 			}
 		}
 		arc.posArcsStart = in.getPosition()
-		for low, high := 0, arc.numArcs-1; low < high; {
-			log.Println("    cycle")
+		for low, high := 0, arc.numArcs-1; low <= high; {
 			mid := int(uint(low+high) / 2)
 			in.setPosition(arc.posArcsStart)
 			in.skipBytes(arc.bytesPerArc*mid + 1)
@@ -639,7 +933,6 @@ func (t *FST) FindTargetArc(labelToMatch int, follow *Arc, arc *Arc, in BytesRea
 				high = mid - 1
 			} else {
 				arc.arcIdx = mid - 1
-				log.Println("    found!")
 				return t.readNextRealArc(arc, in)
 			}
 		}
@@ -647,27 +940,25 @@ func (t *FST) FindTargetArc(labelToMatch int, follow *Arc, arc *Arc, in BytesRea
 		return nil, nil
 	}
 
-	panic("not implemented yet")
-
 	// Linear scan
-	// readFirstRealTargetArc(follow.target, arc, in);
-
-	// while(true) {
-	//   //System.out.println("  non-bs cycle");
-	//   // TODO: we should fix this code to not have to create
-	//   // object for the output of every arc we scan... only
-	//   // for the matching arc, if found
-	//   if (arc.label == labelToMatch) {
-	//     //System.out.println("    found!");
-	//     return arc;
-	//   } else if (arc.label > labelToMatch) {
-	//     return null;
-	//   } else if (arc.isLast()) {
-	//     return null;
-	//   } else {
-	//     readNextRealArc(arc, in);
-	//   }
-	// }
+	if _, err = t.readFirstRealTargetArc(follow.target, arc, in); err != nil {
+		return nil, err
+	}
+
+	for {
+		// TODO: we should fix this code to not have to create
+		// object for the output of every arc we scan... only
+		// for the matching arc, if found
+		if arc.Label == labelToMatch {
+			return arc, nil
+		} else if arc.Label > labelToMatch {
+			return nil, nil
+		} else if arc.isLast() {
+			return nil, nil
+		} else if _, err = t.readNextRealArc(arc, in); err != nil {
+			return nil, err
+		}
+	}
 }
 
 func (t *FST) seekToNextNode(in BytesReader) error {
@@ -688,6 +979,13 @@ func (t *FST) seekToNextNode(in BytesReader) error {
 			}
 		}
 
+		if hasFlag(flags, FST_BIT_ARC_HAS_FINAL_OUTPUT) {
+			_, err = t.outputs.ReadFinalOutput(in)
+			if err != nil {
+				return err
+			}
+		}
+
 		if !hasFlag(flags, FST_BIT_STOP_NODE) && !hasFlag(flags, FST_BIT_TARGET_NEXT) {
 			if t.packed {
 				_, err = in.ReadVLong()
@@ -736,8 +1034,18 @@ type BytesReader interface {
  * #getNoOutput}.</p>
  */
 type Outputs interface {
+	/** Eg common("foobar", "food") -> "foo" */
+	Common(output1, output2 interface{}) interface{}
+	/** Eg subtract("foobar", "foo") -> "bar" */
+	Subtract(output, inc interface{}) interface{}
 	/** Eg add("foo", "bar") -> "foobar" */
 	Add(prefix interface{}, output interface{}) interface{}
+	/** Encode an output value into a {@link DataOutput}. */
+	Write(output interface{}, out util.DataOutput) error
+	/** Encode an final node output value into a {@link
+	 *  DataOutput}.  By default this just calls {@link #write(Object,
+	 *  DataOutput)}. */
+	WriteFinalOutput(output interface{}, out util.DataOutput) error
 	/** Decode an output value previously written with {@link
 	 *  #write(Object, DataOutput)}. */
 	Read(in util.DataInput) (e interface{}, err error)
@@ -749,10 +1057,14 @@ type Outputs interface {
 	 *  ensure that all methods return the single object if
 	 *  it's really no output */
 	NoOutput() interface{}
+	/** Merges two outputs added for the same input; only supported
+	 *  by outputs that allow duplicate inputs. */
+	Merge(first, second interface{}) interface{}
 }
 
 type iOutputsReader interface {
 	Read(in util.DataInput) (e interface{}, err error)
+	Write(output interface{}, out util.DataOutput) error
 }
 
 type abstractOutputs struct {
@@ -764,6 +1076,14 @@ func (out *abstractOutputs) ReadFinalOutput(in util.DataInput) (e interface{}, e
 	return out.iOutputsReader.Read(in)
 }
 
+func (out *abstractOutputs) WriteFinalOutput(output interface{}, o util.DataOutput) error {
+	return out.iOutputsReader.Write(output, o)
+}
+
+func (out *abstractOutputs) Merge(first, second interface{}) interface{} {
+	panic("not supported")
+}
+
 //ByteSequenceOutputs.java
 
 /**
@@ -785,6 +1105,39 @@ func ByteSequenceOutputsSingleton() *ByteSequenceOutputs {
 	return oneByteSequenceOutputs
 }
 
+func (out *ByteSequenceOutputs) Common(_output1, _output2 interface{}) interface{} {
+	output1, output2 := _output1.([]byte), _output2.([]byte)
+	pos := 0
+	for pos < len(output1) && pos < len(output2) && output1[pos] == output2[pos] {
+		pos++
+	}
+	if pos == 0 {
+		// no common prefix
+		return noOutputs
+	} else if pos == len(output1) {
+		// output1 is a prefix of output2
+		return output1
+	} else if pos == len(output2) {
+		// output2 is a prefix of output1
+		return output2
+	}
+	return output1[:pos]
+}
+
+func (out *ByteSequenceOutputs) Subtract(_output, _inc interface{}) interface{} {
+	output, inc := _output.([]byte), _inc.([]byte)
+	if len(inc) == 0 {
+		// no prefix removed
+		return output
+	} else if len(inc) == len(output) {
+		// entire output removed
+		return noOutputs
+	}
+	assertn(len(inc) < len(output), "inc.length=%v vs output.length=%v", len(inc), len(output))
+	assert(len(inc) > 0)
+	return output[len(inc):]
+}
+
 func (out *ByteSequenceOutputs) Add(_prefix interface{}, _output interface{}) interface{} {
 	if _prefix == nil || _output == nil {
 		panic("assert fail")
@@ -807,9 +1160,19 @@ func (out *ByteSequenceOutputs) Add(_prefix interface{}, _output interface{}) in
 	}
 }
 
+func (out *ByteSequenceOutputs) Write(_prefix interface{}, o util.DataOutput) error {
+	prefix := _prefix.([]byte)
+	err := o.WriteVInt(int32(len(prefix)))
+	if err == nil {
+		err = o.WriteBytes(prefix)
+	}
+	return err
+}
+
 func (out *ByteSequenceOutputs) Read(in util.DataInput) (e interface{}, err error) {
 	log.Printf("Reading from %v...", in)
-	if length, err := in.ReadVInt(); err == nil {
+	var length int32
+	if length, err = in.ReadVInt(); err == nil {
 		log.Printf("Length: %v", length)
 		if length == 0 {
 			e = out.NoOutput()
@@ -849,7 +1212,7 @@ func GetFSTOutput(fst *FST, input []byte) (output interface{}, err error) {
 	for _, v := range input {
 		ret, err := fst.FindTargetArc(int(v), arc, arc, fstReader)
 		if ret == nil || err != nil {
-			return ret, err
+			return nil, err
 		}
 		output = fst.outputs.Add(output, arc.Output)
 	}
@@ -860,3 +1223,34 @@ func GetFSTOutput(fst *FST, input []byte) (output interface{}, err error) {
 		return nil, nil
 	}
 }
+
+// A growable in-memory DataOutput, used to serialize small pieces
+// (e.g. node headers and the empty output) before copying them into
+// the BytesStore or the final output.
+type bytesWriter struct {
+	*util.DataOutputImpl
+	buf bytes.Buffer
+}
+
+func newBytesWriter() *bytesWriter {
+	w := new(bytesWriter)
+	w.DataOutputImpl = util.NewDataOutput(w)
+	return w
+}
+
+func (w *bytesWriter) WriteByte(b byte) error {
+	return w.buf.WriteByte(b)
+}
+
+func (w *bytesWriter) WriteBytes(buf []byte) error {
+	_, err := w.buf.Write(buf)
+	return err
+}
+
+func (w *bytesWriter) Bytes() []byte {
+	return w.buf.Bytes()
+}
+
+func (w *bytesWriter) Len() int {
+	return w.buf.Len()
+}
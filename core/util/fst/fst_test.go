@@ -0,0 +1,105 @@
+package fst
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/balzaczyy/golucene/core/store"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+func toInts(b []byte) []int {
+	ans := make([]int, len(b))
+	for i, v := range b {
+		ans[i] = int(v)
+	}
+	return ans
+}
+
+func TestBuildSaveLoadByteSequenceFST(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+	seen := make(map[string][]byte)
+	seen[""] = []byte("empty")
+	for len(seen) < 500 {
+		term := make([]byte, 1+r.Intn(6))
+		for i := range term {
+			term[i] = byte('a' + r.Intn(16))
+		}
+		var output []byte
+		if r.Intn(4) != 0 {
+			output = []byte(fmt.Sprintf("o%v", r.Intn(1000)))
+		}
+		seen[string(term)] = output
+	}
+	var terms []string
+	for k, _ := range seen {
+		terms = append(terms, k)
+	}
+	sort.Strings(terms)
+
+	outputs := ByteSequenceOutputsSingleton()
+	b := NewBuilderWithOutputs(INPUT_TYPE_BYTE1, outputs)
+	for _, term := range terms {
+		output := seen[term]
+		if output == nil {
+			output = outputs.NoOutput().([]byte)
+		}
+		if err := b.Add(toInts([]byte(term)), output); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fst, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := store.NewRAMDirectory()
+	out, err := dir.CreateOutput("fst", store.IO_CONTEXT_DEFAULT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = fst.Save(out); err != nil {
+		t.Fatal(err)
+	}
+	if err = out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	in, err := dir.OpenInput("fst", store.IO_CONTEXT_DEFAULT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	loaded, err := LoadFST(in, outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []*FST{fst, loaded} {
+		for _, term := range terms {
+			output, err := GetFSTOutput(f, []byte(term))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output == nil {
+				t.Fatalf("term %q not found", term)
+			}
+			if !bytes.Equal(output.([]byte), seen[term]) {
+				t.Errorf("term %q: expected output %q, got %q", term, seen[term], output)
+			}
+		}
+		for _, term := range []string{"zz", "aaaaaaaaa", "q"} {
+			if output, err := GetFSTOutput(f, []byte(term)); err != nil || output != nil {
+				t.Errorf("term %q should not be accepted, got %v (%v)", term, output, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package fst
+
+// util/fst/NodeHash.java
+
+// Used to dedup states (lookup already-frozen states)
+type NodeHash struct {
+	// hash code -> addresses of frozen nodes sharing that hash code
+	table      map[int64][]int64
+	fst        *FST
+	scratchArc *Arc
+	in         BytesReader
+}
+
+func newNodeHash(fst *FST, in BytesReader) *NodeHash {
+	return &NodeHash{
+		table:      make(map[int64][]int64),
+		fst:        fst,
+		scratchArc: new(Arc),
+		in:         in,
+	}
+}
+
+func (h *NodeHash) nodesEqual(node *UnCompiledNode, address int64) (bool, error) {
+	if _, err := h.fst.readFirstRealTargetArc(address, h.scratchArc, h.in); err != nil {
+		return false, err
+	}
+	if h.scratchArc.bytesPerArc != 0 && node.numArcs != h.scratchArc.numArcs {
+		return false, nil
+	}
+	for arcUpto := 0; arcUpto < node.numArcs; arcUpto++ {
+		arc := node.arcs[arcUpto]
+		if arc.label != h.scratchArc.Label ||
+			!equals(arc.output, h.scratchArc.Output) ||
+			arc.target.(*CompiledNode).node != h.scratchArc.target ||
+			!equals(arc.nextFinalOutput, h.scratchArc.NextFinalOutput) ||
+			arc.isFinal != h.scratchArc.IsFinal() {
+			return false, nil
+		}
+
+		if h.scratchArc.isLast() {
+			return arcUpto == node.numArcs-1, nil
+		}
+		if _, err := h.fst.readNextRealArc(h.scratchArc, h.in); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// hash code for an unfrozen node.  This must be identical to the
+// frozen case (below)!!
+func (h *NodeHash) hash(node *UnCompiledNode) int64 {
+	const PRIME = 31
+	var hash int64 = 0
+	// TODO: maybe if number of arcs is high we can safely subsample?
+	for arcIdx := 0; arcIdx < node.numArcs; arcIdx++ {
+		arc := node.arcs[arcIdx]
+		hash = PRIME*hash + int64(arc.label)
+		n := arc.target.(*CompiledNode).node
+		hash = PRIME*hash + int64(int32(n^(n>>32)))
+		hash = PRIME*hash + outputHashCode(arc.output)
+		hash = PRIME*hash + outputHashCode(arc.nextFinalOutput)
+		if arc.isFinal {
+			hash += 17
+		}
+	}
+	return hash
+}
+
+func (h *NodeHash) add(nodeIn *UnCompiledNode) (int64, error) {
+	hash := h.hash(nodeIn)
+	for _, v := range h.table[hash] {
+		ok, err := h.nodesEqual(nodeIn, v)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return v, nil
+		}
+	}
+	// freeze & add
+	node, err := h.fst.addNode(nodeIn)
+	if err != nil {
+		return 0, err
+	}
+	h.table[hash] = append(h.table[hash], node)
+	return node, nil
+}
+
+func outputHashCode(output interface{}) int64 {
+	switch v := output.(type) {
+	case []byte:
+		var hash int64 = 0
+		for _, b := range v {
+			hash = 31*hash + int64(int8(b))
+		}
+		return hash
+	case int64:
+		return int64(int32(v ^ (v >> 32)))
+	}
+	return 0
+}
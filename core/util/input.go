@@ -74,7 +74,8 @@ func (in *DataInputImpl) ReadInt() (n int32, err error) {
 }
 
 func (in *DataInputImpl) ReadVInt() (n int32, err error) {
-	if b, err := in.Reader.ReadByte(); err == nil {
+	var b byte
+	if b, err = in.Reader.ReadByte(); err == nil {
 		n = int32(b) & 0x7F
 		if b < 128 {
 			return n, nil
@@ -97,7 +98,7 @@ func (in *DataInputImpl) ReadVInt() (n int32, err error) {
 					if b, err = in.Reader.ReadByte(); err == nil {
 						// Warning: the next ands use 0x0F / 0xF0 - beware copy/paste errors:
 						n |= (int32(b) & 0x0F) << 28
-						if int32(b)&0x0F == 0 {
+						if b&0xF0 == 0 {
 							return n, nil
 						}
 						return 0, errors.New("Invalid vInt detected (too many bits)")
@@ -118,11 +119,12 @@ func (in *DataInputImpl) ReadLong() (n int64, err error) {
 	if err != nil {
 		return 0, err
 	}
-	return (int64(d1) << 32) | int64(d2), nil
+	return (int64(d1) << 32) | int64(uint32(d2)), nil
 }
 
 func (in *DataInputImpl) ReadVLong() (n int64, err error) {
-	if b, err := in.Reader.ReadByte(); err == nil {
+	var b byte
+	if b, err = in.Reader.ReadByte(); err == nil {
 		n = int64(b & 0x7F)
 		if b < 128 {
 			return n, nil
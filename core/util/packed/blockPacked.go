@@ -0,0 +1,451 @@
+package packed
+
+import (
+	"errors"
+	"fmt"
+)
+
+// util/packed/AbstractBlockPackedWriter.java
+
+const (
+	BLOCK_PACKED_MIN_BLOCK_SIZE = 64
+	BLOCK_PACKED_MAX_BLOCK_SIZE = 1 << (30 - 3)
+
+	bp_MIN_VALUE_EQUALS_0 = 1 << 0
+	bp_BPV_SHIFT          = 1
+)
+
+func checkBlockSize(blockSize, minBlockSize, maxBlockSize int) {
+	assert2(blockSize >= minBlockSize && blockSize <= maxBlockSize,
+		"blockSize must be >= %v and <= %v, got %v", minBlockSize, maxBlockSize, blockSize)
+	assert2(blockSize&(blockSize-1) == 0,
+		"blockSize must be a power of two, got %v", blockSize)
+}
+
+func zigZagEncode(n int64) int64 {
+	return (n >> 63) ^ (n << 1)
+}
+
+func zigZagDecode(n int64) int64 {
+	return int64(uint64(n)>>1) ^ -(n & 1)
+}
+
+// same as DataOutput.WriteVLong but accepts negative values
+func writeVLong(out DataOutput, i int64) error {
+	buf := make([]byte, 0, 9)
+	for k := 0; (i & ^0x7F) != 0 && k < 8; k++ {
+		buf = append(buf, byte((i&0x7F)|0x80))
+		i = int64(uint64(i) >> 7)
+	}
+	buf = append(buf, byte(i))
+	return out.WriteBytes(buf)
+}
+
+// util/packed/BlockPackedWriter.java
+
+/*
+A writer for large sequences of int64s.
+
+The sequence is divided into fixed-size blocks and for each block,
+the difference between each value and the minimum value of the block
+is encoded using as few bits as possible. Memory usage of this class
+is proportional to the block size. Each block has an overhead between
+1 and 10 bytes to store the minimum value and the number of bits per
+value of the block.
+
+Format:
+
+  - <BLock>^(BlockCount)
+  - BlockCount: ceil(ValueCount / BlockSize)
+  - Block: <Header, (Ints)>
+  - Header: <Token, (MinValue)>
+  - Token: a byte, first 7 bits are the number of bits per value
+    (bitsPerValue). If the 8th bit is 1, then MinValue (see next) is 0,
+    otherwise MinValue and needs to be decoded
+  - MinValue: a zigzag-encoded variable-length int64 whose value should
+    be added to every int from the block to restore the original values
+  - Ints: if the number of bits per value is 0, then there is nothing to
+    decode and all ints are equal to MinValue. Otherwise: BlockSize
+    packed ints encoded on exactly bitsPerValue bits per value. They are
+    the subtraction of the original values and MinValue
+*/
+type BlockPackedWriter struct {
+	out      DataOutput
+	values   []int64
+	blocks   []byte
+	off      int
+	ord      int64
+	finished bool
+}
+
+// Sole constructor. blockSize is the number of values of a single
+// block, must be a power of 2.
+func NewBlockPackedWriter(out DataOutput, blockSize int) *BlockPackedWriter {
+	checkBlockSize(blockSize, BLOCK_PACKED_MIN_BLOCK_SIZE, BLOCK_PACKED_MAX_BLOCK_SIZE)
+	w := &BlockPackedWriter{values: make([]int64, blockSize)}
+	w.Reset(out)
+	return w
+}
+
+// Reset this writer to wrap out. The block size remains unchanged.
+func (w *BlockPackedWriter) Reset(out DataOutput) {
+	assert(out != nil)
+	w.out = out
+	w.off = 0
+	w.ord = 0
+	w.finished = false
+}
+
+// Append a new int64.
+func (w *BlockPackedWriter) Add(l int64) error {
+	assert2(!w.finished, "Already finished")
+	if w.off == len(w.values) {
+		if err := w.flush(); err != nil {
+			return err
+		}
+	}
+	w.values[w.off] = l
+	w.off++
+	w.ord++
+	return nil
+}
+
+/*
+Flush all buffered data to disk. This instance is not usable anymore
+after this method has been called until Reset() has been called.
+*/
+func (w *BlockPackedWriter) Finish() error {
+	assert2(!w.finished, "Already finished")
+	if w.off > 0 {
+		if err := w.flush(); err != nil {
+			return err
+		}
+	}
+	w.finished = true
+	return nil
+}
+
+// Return the number of values which have been added.
+func (w *BlockPackedWriter) Ord() int64 {
+	return w.ord
+}
+
+func (w *BlockPackedWriter) flush() error {
+	assert(w.off > 0)
+	min, max := w.values[0], w.values[0]
+	for _, v := range w.values[1:w.off] {
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+
+	delta := max - min
+	var bitsRequired int
+	switch {
+	case delta < 0:
+		bitsRequired = 64
+	case delta == 0:
+		bitsRequired = 0
+	default:
+		bitsRequired = BitsRequired(delta)
+	}
+	if bitsRequired == 64 {
+		// no need to delta-encode
+		min = 0
+	} else if min > 0 {
+		// make min as small as possible so that writeVLong requires fewer bytes
+		if min = max - MaxValue(bitsRequired); min < 0 {
+			min = 0
+		}
+	}
+
+	token := bitsRequired << bp_BPV_SHIFT
+	if min == 0 {
+		token |= bp_MIN_VALUE_EQUALS_0
+	}
+	if err := w.out.WriteBytes([]byte{byte(token)}); err != nil {
+		return err
+	}
+
+	if min != 0 {
+		if err := writeVLong(w.out, zigZagEncode(min)-1); err != nil {
+			return err
+		}
+	}
+
+	if bitsRequired > 0 {
+		if min != 0 {
+			for i := 0; i < w.off; i++ {
+				w.values[i] -= min
+			}
+		}
+		if err := w.writeValues(bitsRequired); err != nil {
+			return err
+		}
+	}
+
+	w.off = 0
+	return nil
+}
+
+func (w *BlockPackedWriter) writeValues(bitsRequired int) error {
+	encoder := newBulkOperation(PackedFormat(PACKED), uint32(bitsRequired))
+	iterations := len(w.values) / encoder.ByteValueCount()
+	blockSize := encoder.ByteBlockCount() * iterations
+	if len(w.blocks) < blockSize {
+		w.blocks = make([]byte, blockSize)
+	}
+	for i := w.off; i < len(w.values); i++ {
+		w.values[i] = 0
+	}
+	encoder.encodeLongToByte(w.values, w.blocks, iterations)
+	blockCount := PackedFormat(PACKED).ByteCount(VERSION_CURRENT, int32(w.off), uint32(bitsRequired))
+	return w.out.WriteBytes(w.blocks[:blockCount])
+}
+
+// util/packed/BlockPackedReaderIterator.java
+
+/*
+Reader for sequences of int64s written with BlockPackedWriter.
+*/
+type BlockPackedReaderIterator struct {
+	in                DataInput
+	packedIntsVersion int
+	valueCount        int64
+	blockSize         int
+	values            []int64
+	blocks            []byte
+	off               int
+	ord               int64
+}
+
+/*
+Sole constructor. blockSize must be the same value that was passed
+to BlockPackedWriter's constructor.
+*/
+func NewBlockPackedReaderIterator(in DataInput, packedIntsVersion,
+	blockSize int, valueCount int64) *BlockPackedReaderIterator {
+
+	checkBlockSize(blockSize, BLOCK_PACKED_MIN_BLOCK_SIZE, BLOCK_PACKED_MAX_BLOCK_SIZE)
+	it := &BlockPackedReaderIterator{
+		packedIntsVersion: packedIntsVersion,
+		blockSize:         blockSize,
+		values:            make([]int64, blockSize),
+	}
+	it.Reset(in, valueCount)
+	return it
+}
+
+// Reset the current reader to wrap a stream of valueCount values
+// contained in in. The block size remains unchanged.
+func (it *BlockPackedReaderIterator) Reset(in DataInput, valueCount int64) {
+	it.in = in
+	assert(valueCount >= 0)
+	it.valueCount = valueCount
+	it.off = it.blockSize
+	it.ord = 0
+}
+
+// Skip exactly count values.
+func (it *BlockPackedReaderIterator) Skip(count int64) error {
+	assert(count >= 0)
+	if it.ord+count > it.valueCount || it.ord+count < 0 {
+		return errors.New("EOF")
+	}
+
+	// 1. skip buffered values
+	skipBuffer := int64(it.blockSize - it.off)
+	if count < skipBuffer {
+		skipBuffer = count
+	}
+	it.off += int(skipBuffer)
+	it.ord += skipBuffer
+	count -= skipBuffer
+	if count == 0 {
+		return nil
+	}
+
+	// 2. skip as many blocks as necessary
+	assert(it.off == it.blockSize)
+	for count >= int64(it.blockSize) {
+		token, err := it.in.ReadByte()
+		if err != nil {
+			return err
+		}
+		bitsPerValue := int(token) >> bp_BPV_SHIFT
+		if bitsPerValue > 64 {
+			return errors.New(fmt.Sprintf("Corrupted: bitsPerValue=%v", bitsPerValue))
+		}
+		if int(token)&bp_MIN_VALUE_EQUALS_0 == 0 {
+			if _, err = readVLong(it.in); err != nil {
+				return err
+			}
+		}
+		blockBytes := PackedFormat(PACKED).ByteCount(int32(it.packedIntsVersion),
+			int32(it.blockSize), uint32(bitsPerValue))
+		if err = it.skipBytes(blockBytes); err != nil {
+			return err
+		}
+		it.ord += int64(it.blockSize)
+		count -= int64(it.blockSize)
+	}
+	if count == 0 {
+		return nil
+	}
+
+	// 3. skip last values
+	assert(count < int64(it.blockSize))
+	if err := it.refill(); err != nil {
+		return err
+	}
+	it.ord += count
+	it.off += int(count)
+	return nil
+}
+
+func (it *BlockPackedReaderIterator) skipBytes(count int64) error {
+	if len(it.blocks) < 1 {
+		it.blocks = make([]byte, it.blockSize)
+	}
+	for count > 0 {
+		toSkip := int64(len(it.blocks))
+		if count < toSkip {
+			toSkip = count
+		}
+		if err := it.in.ReadBytes(it.blocks[:toSkip]); err != nil {
+			return err
+		}
+		count -= toSkip
+	}
+	return nil
+}
+
+// Read the next value.
+func (it *BlockPackedReaderIterator) Next() (int64, error) {
+	if it.ord == it.valueCount {
+		return 0, errors.New("EOF")
+	}
+	if it.off == it.blockSize {
+		if err := it.refill(); err != nil {
+			return 0, err
+		}
+	}
+	value := it.values[it.off]
+	it.off++
+	it.ord++
+	return value, nil
+}
+
+/*
+Read between 1 and count values. The returned slice is only valid
+until the next call to this iterator and must not be modified.
+*/
+func (it *BlockPackedReaderIterator) NextN(count int) ([]int64, error) {
+	assert(count > 0)
+	if it.ord == it.valueCount {
+		return nil, errors.New("EOF")
+	}
+	if it.off == it.blockSize {
+		if err := it.refill(); err != nil {
+			return nil, err
+		}
+	}
+
+	if n := it.blockSize - it.off; n < count {
+		count = n
+	}
+	if n := it.valueCount - it.ord; n < int64(count) {
+		count = int(n)
+	}
+
+	values := it.values[it.off : it.off+count]
+	it.off += count
+	it.ord += int64(count)
+	return values, nil
+}
+
+func (it *BlockPackedReaderIterator) refill() error {
+	b, err := it.in.ReadByte()
+	if err != nil {
+		return err
+	}
+	token := int(b)
+	minEquals0 := (token & bp_MIN_VALUE_EQUALS_0) != 0
+	bitsPerValue := token >> bp_BPV_SHIFT
+	if bitsPerValue > 64 {
+		return errors.New(fmt.Sprintf("Corrupted: bitsPerValue=%v", bitsPerValue))
+	}
+	var minValue int64
+	if !minEquals0 {
+		n, err := readVLong(it.in)
+		if err != nil {
+			return err
+		}
+		minValue = zigZagDecode(1 + n)
+	}
+	assert(minEquals0 || minValue != 0)
+
+	if bitsPerValue == 0 {
+		for i, _ := range it.values {
+			it.values[i] = minValue
+		}
+	} else {
+		decoder := newBulkOperation(PackedFormat(PACKED), uint32(bitsPerValue))
+		iterations := it.blockSize / decoder.ByteValueCount()
+		blocksSize := iterations * decoder.ByteBlockCount()
+		if len(it.blocks) < blocksSize {
+			it.blocks = make([]byte, blocksSize)
+		}
+
+		valueCount := int64(it.blockSize)
+		if n := it.valueCount - it.ord; n < valueCount {
+			valueCount = n
+		}
+		blocksCount := PackedFormat(PACKED).ByteCount(int32(it.packedIntsVersion),
+			int32(valueCount), uint32(bitsPerValue))
+		if err = it.in.ReadBytes(it.blocks[:blocksCount]); err != nil {
+			return err
+		}
+		for i := int(blocksCount); i < blocksSize; i++ {
+			it.blocks[i] = 0
+		}
+
+		decoder.decodeByteToint64(it.blocks, it.values, iterations)
+
+		if minValue != 0 {
+			for i := int64(0); i < valueCount; i++ {
+				it.values[i] += minValue
+			}
+		}
+	}
+	it.off = 0
+	return nil
+}
+
+// Return the offset of the next value to read.
+func (it *BlockPackedReaderIterator) Ord() int64 {
+	return it.ord
+}
+
+// same as DataInput.ReadVLong but supports negative values
+func readVLong(in DataInput) (int64, error) {
+	var i int64
+	for shift := uint(0); shift < 56; shift += 7 {
+		b, err := in.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		i |= int64(b&0x7F) << shift
+		if b&0x80 == 0 {
+			return i, nil
+		}
+	}
+	b, err := in.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	return i | int64(b)<<56, nil
+}
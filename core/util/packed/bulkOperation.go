@@ -2,6 +2,7 @@ package packed
 
 import (
 	"fmt"
+	"math"
 )
 
 // util/packed/BulkOperation.java
@@ -200,11 +201,11 @@ var (
 						bitStart, bitEnd := (i*bpv)%8, ((i+1)*bpv-1)%8
 						shift := func(b int) int { return 8*(byteEnd-b-1) + 1 + bitEnd }
 						if bitStart == 0 {
-							fmt.Fprintf(f, "		byte%d := blocks[blocksOffset]\n", byteStart)
+							fmt.Fprintf(f, "		byte%d := %s(blocks[blocksOffset])\n", byteStart, typ)
 							fmt.Fprintln(f, "		blocksOffset++")
 						}
 						for b, until := byteStart+1, byteEnd+1; b < until; b++ {
-							fmt.Fprintf(f, "		byte%d := blocks[blocksOffset]\n", b)
+							fmt.Fprintf(f, "		byte%d := %s(blocks[blocksOffset])\n", b, typ)
 							fmt.Fprintln(f, "		blocksOffset++")
 						}
 						fmt.Fprintf(f, "		values[valuesOffset] = %s(", typ)
@@ -213,13 +214,13 @@ var (
 								if bitEnd == 7 {
 									fmt.Fprintf(f, " byte%d", byteStart)
 								} else {
-									fmt.Fprintf(f, " byte(uint8(byte%d) >> %d)", byteStart, 7-bitEnd)
+									fmt.Fprintf(f, " byte%d >> %d", byteStart, 7-bitEnd)
 								}
 							} else {
 								if bitEnd == 7 {
 									fmt.Fprintf(f, " byte%d & %d", byteStart, 1<<uint(8-bitStart)-1)
 								} else {
-									fmt.Fprintf(f, " byte(uint8(byte%d >> %d)) & %d", byteStart, 7-bitEnd, 1<<uint(bitEnd-bitStart+1)-1)
+									fmt.Fprintf(f, " (byte%d >> %d) & %d", byteStart, 7-bitEnd, 1<<uint(bitEnd-bitStart+1)-1)
 								}
 							}
 						} else {
@@ -234,7 +235,7 @@ var (
 							if bitEnd == 7 {
 								fmt.Fprintf(f, " | byte%d", byteEnd)
 							} else {
-								fmt.Fprintf(f, " | byte(uint8(byte%d) >> %d)", byteEnd, 7-bitEnd)
+								fmt.Fprintf(f, " | (byte%d >> %d)", byteEnd, 7-bitEnd)
 							}
 						}
 						fmt.Fprintf(f, ")")
@@ -421,7 +422,7 @@ func (op *BulkOperationImpl) computeIterations(valueCount, ramBudget int) int {
 		return 1
 	} else if (iterations-1)*op.ByteValueCount() >= valueCount {
 		// don't allocate for more than the size of the reader
-		panic("not implemented yet")
+		return int(math.Ceil(float64(valueCount) / float64(op.ByteValueCount())))
 	} else {
 		return iterations
 	}
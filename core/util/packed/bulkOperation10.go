@@ -57,21 +57,21 @@ func (op *BulkOperationPacked10) decode(blocks []int64, values []int64, iteratio
 func (op *BulkOperationPacked10) decodeByteToint64(blocks []byte, values []int64, iterations int) {
 	blocksOffset, valuesOffset := 0, 0
 	for i := 0; i < iterations; i ++ {
-		byte0 := blocks[blocksOffset]
+		byte0 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte1 := blocks[blocksOffset]
+		byte1 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64((byte0 << 2) | byte(uint8(byte1) >> 6))
+		values[valuesOffset] = int64((byte0 << 2) | (byte1 >> 6))
 		valuesOffset++
-		byte2 := blocks[blocksOffset]
+		byte2 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte1 & 63) << 4) | byte(uint8(byte2) >> 4))
+		values[valuesOffset] = int64(((byte1 & 63) << 4) | (byte2 >> 4))
 		valuesOffset++
-		byte3 := blocks[blocksOffset]
+		byte3 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte2 & 15) << 6) | byte(uint8(byte3) >> 2))
+		values[valuesOffset] = int64(((byte2 & 15) << 6) | (byte3 >> 2))
 		valuesOffset++
-		byte4 := blocks[blocksOffset]
+		byte4 := int64(blocks[blocksOffset])
 		blocksOffset++
 		values[valuesOffset] = int64(((byte3 & 3) << 8) | byte4)
 		valuesOffset++
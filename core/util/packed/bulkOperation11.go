@@ -95,41 +95,41 @@ func (op *BulkOperationPacked11) decode(blocks []int64, values []int64, iteratio
 func (op *BulkOperationPacked11) decodeByteToint64(blocks []byte, values []int64, iterations int) {
 	blocksOffset, valuesOffset := 0, 0
 	for i := 0; i < iterations; i ++ {
-		byte0 := blocks[blocksOffset]
+		byte0 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte1 := blocks[blocksOffset]
+		byte1 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64((byte0 << 3) | byte(uint8(byte1) >> 5))
+		values[valuesOffset] = int64((byte0 << 3) | (byte1 >> 5))
 		valuesOffset++
-		byte2 := blocks[blocksOffset]
+		byte2 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte1 & 31) << 6) | byte(uint8(byte2) >> 2))
+		values[valuesOffset] = int64(((byte1 & 31) << 6) | (byte2 >> 2))
 		valuesOffset++
-		byte3 := blocks[blocksOffset]
+		byte3 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte4 := blocks[blocksOffset]
+		byte4 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte2 & 3) << 9) | (byte3 << 1) | byte(uint8(byte4) >> 7))
+		values[valuesOffset] = int64(((byte2 & 3) << 9) | (byte3 << 1) | (byte4 >> 7))
 		valuesOffset++
-		byte5 := blocks[blocksOffset]
+		byte5 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte4 & 127) << 4) | byte(uint8(byte5) >> 4))
+		values[valuesOffset] = int64(((byte4 & 127) << 4) | (byte5 >> 4))
 		valuesOffset++
-		byte6 := blocks[blocksOffset]
+		byte6 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte5 & 15) << 7) | byte(uint8(byte6) >> 1))
+		values[valuesOffset] = int64(((byte5 & 15) << 7) | (byte6 >> 1))
 		valuesOffset++
-		byte7 := blocks[blocksOffset]
+		byte7 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte8 := blocks[blocksOffset]
+		byte8 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte6 & 1) << 10) | (byte7 << 2) | byte(uint8(byte8) >> 6))
+		values[valuesOffset] = int64(((byte6 & 1) << 10) | (byte7 << 2) | (byte8 >> 6))
 		valuesOffset++
-		byte9 := blocks[blocksOffset]
+		byte9 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte8 & 63) << 5) | byte(uint8(byte9) >> 3))
+		values[valuesOffset] = int64(((byte8 & 63) << 5) | (byte9 >> 3))
 		valuesOffset++
-		byte10 := blocks[blocksOffset]
+		byte10 := int64(blocks[blocksOffset])
 		blocksOffset++
 		values[valuesOffset] = int64(((byte9 & 7) << 8) | byte10)
 		valuesOffset++
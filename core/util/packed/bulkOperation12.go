@@ -39,13 +39,13 @@ func (op *BulkOperationPacked12) decode(blocks []int64, values []int64, iteratio
 func (op *BulkOperationPacked12) decodeByteToint64(blocks []byte, values []int64, iterations int) {
 	blocksOffset, valuesOffset := 0, 0
 	for i := 0; i < iterations; i ++ {
-		byte0 := blocks[blocksOffset]
+		byte0 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte1 := blocks[blocksOffset]
+		byte1 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64((byte0 << 4) | byte(uint8(byte1) >> 4))
+		values[valuesOffset] = int64((byte0 << 4) | (byte1 >> 4))
 		valuesOffset++
-		byte2 := blocks[blocksOffset]
+		byte2 := int64(blocks[blocksOffset])
 		blocksOffset++
 		values[valuesOffset] = int64(((byte1 & 15) << 8) | byte2)
 		valuesOffset++
@@ -97,45 +97,45 @@ func (op *BulkOperationPacked13) decode(blocks []int64, values []int64, iteratio
 func (op *BulkOperationPacked13) decodeByteToint64(blocks []byte, values []int64, iterations int) {
 	blocksOffset, valuesOffset := 0, 0
 	for i := 0; i < iterations; i ++ {
-		byte0 := blocks[blocksOffset]
+		byte0 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte1 := blocks[blocksOffset]
+		byte1 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64((byte0 << 5) | byte(uint8(byte1) >> 3))
+		values[valuesOffset] = int64((byte0 << 5) | (byte1 >> 3))
 		valuesOffset++
-		byte2 := blocks[blocksOffset]
+		byte2 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte3 := blocks[blocksOffset]
+		byte3 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte1 & 7) << 10) | (byte2 << 2) | byte(uint8(byte3) >> 6))
+		values[valuesOffset] = int64(((byte1 & 7) << 10) | (byte2 << 2) | (byte3 >> 6))
 		valuesOffset++
-		byte4 := blocks[blocksOffset]
+		byte4 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte3 & 63) << 7) | byte(uint8(byte4) >> 1))
+		values[valuesOffset] = int64(((byte3 & 63) << 7) | (byte4 >> 1))
 		valuesOffset++
-		byte5 := blocks[blocksOffset]
+		byte5 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte6 := blocks[blocksOffset]
+		byte6 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte4 & 1) << 12) | (byte5 << 4) | byte(uint8(byte6) >> 4))
+		values[valuesOffset] = int64(((byte4 & 1) << 12) | (byte5 << 4) | (byte6 >> 4))
 		valuesOffset++
-		byte7 := blocks[blocksOffset]
+		byte7 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte8 := blocks[blocksOffset]
+		byte8 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte6 & 15) << 9) | (byte7 << 1) | byte(uint8(byte8) >> 7))
+		values[valuesOffset] = int64(((byte6 & 15) << 9) | (byte7 << 1) | (byte8 >> 7))
 		valuesOffset++
-		byte9 := blocks[blocksOffset]
+		byte9 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte8 & 127) << 6) | byte(uint8(byte9) >> 2))
+		values[valuesOffset] = int64(((byte8 & 127) << 6) | (byte9 >> 2))
 		valuesOffset++
-		byte10 := blocks[blocksOffset]
+		byte10 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte11 := blocks[blocksOffset]
+		byte11 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte9 & 3) << 11) | (byte10 << 3) | byte(uint8(byte11) >> 5))
+		values[valuesOffset] = int64(((byte9 & 3) << 11) | (byte10 << 3) | (byte11 >> 5))
 		valuesOffset++
-		byte12 := blocks[blocksOffset]
+		byte12 := int64(blocks[blocksOffset])
 		blocksOffset++
 		values[valuesOffset] = int64(((byte11 & 31) << 8) | byte12)
 		valuesOffset++
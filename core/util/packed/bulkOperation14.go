@@ -59,25 +59,25 @@ func (op *BulkOperationPacked14) decode(blocks []int64, values []int64, iteratio
 func (op *BulkOperationPacked14) decodeByteToint64(blocks []byte, values []int64, iterations int) {
 	blocksOffset, valuesOffset := 0, 0
 	for i := 0; i < iterations; i ++ {
-		byte0 := blocks[blocksOffset]
+		byte0 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte1 := blocks[blocksOffset]
+		byte1 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64((byte0 << 6) | byte(uint8(byte1) >> 2))
+		values[valuesOffset] = int64((byte0 << 6) | (byte1 >> 2))
 		valuesOffset++
-		byte2 := blocks[blocksOffset]
+		byte2 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte3 := blocks[blocksOffset]
+		byte3 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte1 & 3) << 12) | (byte2 << 4) | byte(uint8(byte3) >> 4))
+		values[valuesOffset] = int64(((byte1 & 3) << 12) | (byte2 << 4) | (byte3 >> 4))
 		valuesOffset++
-		byte4 := blocks[blocksOffset]
+		byte4 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte5 := blocks[blocksOffset]
+		byte5 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte3 & 15) << 10) | (byte4 << 2) | byte(uint8(byte5) >> 6))
+		values[valuesOffset] = int64(((byte3 & 15) << 10) | (byte4 << 2) | (byte5 >> 6))
 		valuesOffset++
-		byte6 := blocks[blocksOffset]
+		byte6 := int64(blocks[blocksOffset])
 		blocksOffset++
 		values[valuesOffset] = int64(((byte5 & 63) << 8) | byte6)
 		valuesOffset++
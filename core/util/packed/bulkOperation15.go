@@ -99,49 +99,49 @@ func (op *BulkOperationPacked15) decode(blocks []int64, values []int64, iteratio
 func (op *BulkOperationPacked15) decodeByteToint64(blocks []byte, values []int64, iterations int) {
 	blocksOffset, valuesOffset := 0, 0
 	for i := 0; i < iterations; i ++ {
-		byte0 := blocks[blocksOffset]
+		byte0 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte1 := blocks[blocksOffset]
+		byte1 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64((byte0 << 7) | byte(uint8(byte1) >> 1))
+		values[valuesOffset] = int64((byte0 << 7) | (byte1 >> 1))
 		valuesOffset++
-		byte2 := blocks[blocksOffset]
+		byte2 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte3 := blocks[blocksOffset]
+		byte3 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte1 & 1) << 14) | (byte2 << 6) | byte(uint8(byte3) >> 2))
+		values[valuesOffset] = int64(((byte1 & 1) << 14) | (byte2 << 6) | (byte3 >> 2))
 		valuesOffset++
-		byte4 := blocks[blocksOffset]
+		byte4 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte5 := blocks[blocksOffset]
+		byte5 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte3 & 3) << 13) | (byte4 << 5) | byte(uint8(byte5) >> 3))
+		values[valuesOffset] = int64(((byte3 & 3) << 13) | (byte4 << 5) | (byte5 >> 3))
 		valuesOffset++
-		byte6 := blocks[blocksOffset]
+		byte6 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte7 := blocks[blocksOffset]
+		byte7 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte5 & 7) << 12) | (byte6 << 4) | byte(uint8(byte7) >> 4))
+		values[valuesOffset] = int64(((byte5 & 7) << 12) | (byte6 << 4) | (byte7 >> 4))
 		valuesOffset++
-		byte8 := blocks[blocksOffset]
+		byte8 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte9 := blocks[blocksOffset]
+		byte9 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte7 & 15) << 11) | (byte8 << 3) | byte(uint8(byte9) >> 5))
+		values[valuesOffset] = int64(((byte7 & 15) << 11) | (byte8 << 3) | (byte9 >> 5))
 		valuesOffset++
-		byte10 := blocks[blocksOffset]
+		byte10 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte11 := blocks[blocksOffset]
+		byte11 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte9 & 31) << 10) | (byte10 << 2) | byte(uint8(byte11) >> 6))
+		values[valuesOffset] = int64(((byte9 & 31) << 10) | (byte10 << 2) | (byte11 >> 6))
 		valuesOffset++
-		byte12 := blocks[blocksOffset]
+		byte12 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte13 := blocks[blocksOffset]
+		byte13 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte11 & 63) << 9) | (byte12 << 1) | byte(uint8(byte13) >> 7))
+		values[valuesOffset] = int64(((byte11 & 63) << 9) | (byte12 << 1) | (byte13 >> 7))
 		valuesOffset++
-		byte14 := blocks[blocksOffset]
+		byte14 := int64(blocks[blocksOffset])
 		blocksOffset++
 		values[valuesOffset] = int64(((byte13 & 127) << 8) | byte14)
 		valuesOffset++
@@ -101,53 +101,53 @@ func (op *BulkOperationPacked17) decode(blocks []int64, values []int64, iteratio
 func (op *BulkOperationPacked17) decodeByteToint64(blocks []byte, values []int64, iterations int) {
 	blocksOffset, valuesOffset := 0, 0
 	for i := 0; i < iterations; i ++ {
-		byte0 := blocks[blocksOffset]
+		byte0 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte1 := blocks[blocksOffset]
+		byte1 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte2 := blocks[blocksOffset]
+		byte2 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64((byte0 << 9) | (byte1 << 1) | byte(uint8(byte2) >> 7))
+		values[valuesOffset] = int64((byte0 << 9) | (byte1 << 1) | (byte2 >> 7))
 		valuesOffset++
-		byte3 := blocks[blocksOffset]
+		byte3 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte4 := blocks[blocksOffset]
+		byte4 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte2 & 127) << 10) | (byte3 << 2) | byte(uint8(byte4) >> 6))
+		values[valuesOffset] = int64(((byte2 & 127) << 10) | (byte3 << 2) | (byte4 >> 6))
 		valuesOffset++
-		byte5 := blocks[blocksOffset]
+		byte5 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte6 := blocks[blocksOffset]
+		byte6 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte4 & 63) << 11) | (byte5 << 3) | byte(uint8(byte6) >> 5))
+		values[valuesOffset] = int64(((byte4 & 63) << 11) | (byte5 << 3) | (byte6 >> 5))
 		valuesOffset++
-		byte7 := blocks[blocksOffset]
+		byte7 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte8 := blocks[blocksOffset]
+		byte8 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte6 & 31) << 12) | (byte7 << 4) | byte(uint8(byte8) >> 4))
+		values[valuesOffset] = int64(((byte6 & 31) << 12) | (byte7 << 4) | (byte8 >> 4))
 		valuesOffset++
-		byte9 := blocks[blocksOffset]
+		byte9 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte10 := blocks[blocksOffset]
+		byte10 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte8 & 15) << 13) | (byte9 << 5) | byte(uint8(byte10) >> 3))
+		values[valuesOffset] = int64(((byte8 & 15) << 13) | (byte9 << 5) | (byte10 >> 3))
 		valuesOffset++
-		byte11 := blocks[blocksOffset]
+		byte11 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte12 := blocks[blocksOffset]
+		byte12 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte10 & 7) << 14) | (byte11 << 6) | byte(uint8(byte12) >> 2))
+		values[valuesOffset] = int64(((byte10 & 7) << 14) | (byte11 << 6) | (byte12 >> 2))
 		valuesOffset++
-		byte13 := blocks[blocksOffset]
+		byte13 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte14 := blocks[blocksOffset]
+		byte14 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte12 & 3) << 15) | (byte13 << 7) | byte(uint8(byte14) >> 1))
+		values[valuesOffset] = int64(((byte12 & 3) << 15) | (byte13 << 7) | (byte14 >> 1))
 		valuesOffset++
-		byte15 := blocks[blocksOffset]
+		byte15 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte16 := blocks[blocksOffset]
+		byte16 := int64(blocks[blocksOffset])
 		blocksOffset++
 		values[valuesOffset] = int64(((byte14 & 1) << 16) | (byte15 << 8) | byte16)
 		valuesOffset++
@@ -61,29 +61,29 @@ func (op *BulkOperationPacked18) decode(blocks []int64, values []int64, iteratio
 func (op *BulkOperationPacked18) decodeByteToint64(blocks []byte, values []int64, iterations int) {
 	blocksOffset, valuesOffset := 0, 0
 	for i := 0; i < iterations; i ++ {
-		byte0 := blocks[blocksOffset]
+		byte0 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte1 := blocks[blocksOffset]
+		byte1 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte2 := blocks[blocksOffset]
+		byte2 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64((byte0 << 10) | (byte1 << 2) | byte(uint8(byte2) >> 6))
+		values[valuesOffset] = int64((byte0 << 10) | (byte1 << 2) | (byte2 >> 6))
 		valuesOffset++
-		byte3 := blocks[blocksOffset]
+		byte3 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte4 := blocks[blocksOffset]
+		byte4 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte2 & 63) << 12) | (byte3 << 4) | byte(uint8(byte4) >> 4))
+		values[valuesOffset] = int64(((byte2 & 63) << 12) | (byte3 << 4) | (byte4 >> 4))
 		valuesOffset++
-		byte5 := blocks[blocksOffset]
+		byte5 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte6 := blocks[blocksOffset]
+		byte6 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte4 & 15) << 14) | (byte5 << 6) | byte(uint8(byte6) >> 2))
+		values[valuesOffset] = int64(((byte4 & 15) << 14) | (byte5 << 6) | (byte6 >> 2))
 		valuesOffset++
-		byte7 := blocks[blocksOffset]
+		byte7 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte8 := blocks[blocksOffset]
+		byte8 := int64(blocks[blocksOffset])
 		blocksOffset++
 		values[valuesOffset] = int64(((byte6 & 3) << 16) | (byte7 << 8) | byte8)
 		valuesOffset++
@@ -103,57 +103,57 @@ func (op *BulkOperationPacked19) decode(blocks []int64, values []int64, iteratio
 func (op *BulkOperationPacked19) decodeByteToint64(blocks []byte, values []int64, iterations int) {
 	blocksOffset, valuesOffset := 0, 0
 	for i := 0; i < iterations; i ++ {
-		byte0 := blocks[blocksOffset]
+		byte0 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte1 := blocks[blocksOffset]
+		byte1 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte2 := blocks[blocksOffset]
+		byte2 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64((byte0 << 11) | (byte1 << 3) | byte(uint8(byte2) >> 5))
+		values[valuesOffset] = int64((byte0 << 11) | (byte1 << 3) | (byte2 >> 5))
 		valuesOffset++
-		byte3 := blocks[blocksOffset]
+		byte3 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte4 := blocks[blocksOffset]
+		byte4 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte2 & 31) << 14) | (byte3 << 6) | byte(uint8(byte4) >> 2))
+		values[valuesOffset] = int64(((byte2 & 31) << 14) | (byte3 << 6) | (byte4 >> 2))
 		valuesOffset++
-		byte5 := blocks[blocksOffset]
+		byte5 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte6 := blocks[blocksOffset]
+		byte6 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte7 := blocks[blocksOffset]
+		byte7 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte4 & 3) << 17) | (byte5 << 9) | (byte6 << 1) | byte(uint8(byte7) >> 7))
+		values[valuesOffset] = int64(((byte4 & 3) << 17) | (byte5 << 9) | (byte6 << 1) | (byte7 >> 7))
 		valuesOffset++
-		byte8 := blocks[blocksOffset]
+		byte8 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte9 := blocks[blocksOffset]
+		byte9 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte7 & 127) << 12) | (byte8 << 4) | byte(uint8(byte9) >> 4))
+		values[valuesOffset] = int64(((byte7 & 127) << 12) | (byte8 << 4) | (byte9 >> 4))
 		valuesOffset++
-		byte10 := blocks[blocksOffset]
+		byte10 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte11 := blocks[blocksOffset]
+		byte11 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte9 & 15) << 15) | (byte10 << 7) | byte(uint8(byte11) >> 1))
+		values[valuesOffset] = int64(((byte9 & 15) << 15) | (byte10 << 7) | (byte11 >> 1))
 		valuesOffset++
-		byte12 := blocks[blocksOffset]
+		byte12 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte13 := blocks[blocksOffset]
+		byte13 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte14 := blocks[blocksOffset]
+		byte14 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte11 & 1) << 18) | (byte12 << 10) | (byte13 << 2) | byte(uint8(byte14) >> 6))
+		values[valuesOffset] = int64(((byte11 & 1) << 18) | (byte12 << 10) | (byte13 << 2) | (byte14 >> 6))
 		valuesOffset++
-		byte15 := blocks[blocksOffset]
+		byte15 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte16 := blocks[blocksOffset]
+		byte16 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte14 & 63) << 13) | (byte15 << 5) | byte(uint8(byte16) >> 3))
+		values[valuesOffset] = int64(((byte14 & 63) << 13) | (byte15 << 5) | (byte16 >> 3))
 		valuesOffset++
-		byte17 := blocks[blocksOffset]
+		byte17 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte18 := blocks[blocksOffset]
+		byte18 := int64(blocks[blocksOffset])
 		blocksOffset++
 		values[valuesOffset] = int64(((byte16 & 7) << 16) | (byte17 << 8) | byte18)
 		valuesOffset++
@@ -105,61 +105,61 @@ func (op *BulkOperationPacked21) decode(blocks []int64, values []int64, iteratio
 func (op *BulkOperationPacked21) decodeByteToint64(blocks []byte, values []int64, iterations int) {
 	blocksOffset, valuesOffset := 0, 0
 	for i := 0; i < iterations; i ++ {
-		byte0 := blocks[blocksOffset]
+		byte0 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte1 := blocks[blocksOffset]
+		byte1 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte2 := blocks[blocksOffset]
+		byte2 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64((byte0 << 13) | (byte1 << 5) | byte(uint8(byte2) >> 3))
+		values[valuesOffset] = int64((byte0 << 13) | (byte1 << 5) | (byte2 >> 3))
 		valuesOffset++
-		byte3 := blocks[blocksOffset]
+		byte3 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte4 := blocks[blocksOffset]
+		byte4 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte5 := blocks[blocksOffset]
+		byte5 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte2 & 7) << 18) | (byte3 << 10) | (byte4 << 2) | byte(uint8(byte5) >> 6))
+		values[valuesOffset] = int64(((byte2 & 7) << 18) | (byte3 << 10) | (byte4 << 2) | (byte5 >> 6))
 		valuesOffset++
-		byte6 := blocks[blocksOffset]
+		byte6 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte7 := blocks[blocksOffset]
+		byte7 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte5 & 63) << 15) | (byte6 << 7) | byte(uint8(byte7) >> 1))
+		values[valuesOffset] = int64(((byte5 & 63) << 15) | (byte6 << 7) | (byte7 >> 1))
 		valuesOffset++
-		byte8 := blocks[blocksOffset]
+		byte8 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte9 := blocks[blocksOffset]
+		byte9 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte10 := blocks[blocksOffset]
+		byte10 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte7 & 1) << 20) | (byte8 << 12) | (byte9 << 4) | byte(uint8(byte10) >> 4))
+		values[valuesOffset] = int64(((byte7 & 1) << 20) | (byte8 << 12) | (byte9 << 4) | (byte10 >> 4))
 		valuesOffset++
-		byte11 := blocks[blocksOffset]
+		byte11 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte12 := blocks[blocksOffset]
+		byte12 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte13 := blocks[blocksOffset]
+		byte13 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte10 & 15) << 17) | (byte11 << 9) | (byte12 << 1) | byte(uint8(byte13) >> 7))
+		values[valuesOffset] = int64(((byte10 & 15) << 17) | (byte11 << 9) | (byte12 << 1) | (byte13 >> 7))
 		valuesOffset++
-		byte14 := blocks[blocksOffset]
+		byte14 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte15 := blocks[blocksOffset]
+		byte15 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte13 & 127) << 14) | (byte14 << 6) | byte(uint8(byte15) >> 2))
+		values[valuesOffset] = int64(((byte13 & 127) << 14) | (byte14 << 6) | (byte15 >> 2))
 		valuesOffset++
-		byte16 := blocks[blocksOffset]
+		byte16 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte17 := blocks[blocksOffset]
+		byte17 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte18 := blocks[blocksOffset]
+		byte18 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte15 & 3) << 19) | (byte16 << 11) | (byte17 << 3) | byte(uint8(byte18) >> 5))
+		values[valuesOffset] = int64(((byte15 & 3) << 19) | (byte16 << 11) | (byte17 << 3) | (byte18 >> 5))
 		valuesOffset++
-		byte19 := blocks[blocksOffset]
+		byte19 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte20 := blocks[blocksOffset]
+		byte20 := int64(blocks[blocksOffset])
 		blocksOffset++
 		values[valuesOffset] = int64(((byte18 & 31) << 16) | (byte19 << 8) | byte20)
 		valuesOffset++
@@ -63,33 +63,33 @@ func (op *BulkOperationPacked22) decode(blocks []int64, values []int64, iteratio
 func (op *BulkOperationPacked22) decodeByteToint64(blocks []byte, values []int64, iterations int) {
 	blocksOffset, valuesOffset := 0, 0
 	for i := 0; i < iterations; i ++ {
-		byte0 := blocks[blocksOffset]
+		byte0 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte1 := blocks[blocksOffset]
+		byte1 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte2 := blocks[blocksOffset]
+		byte2 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64((byte0 << 14) | (byte1 << 6) | byte(uint8(byte2) >> 2))
+		values[valuesOffset] = int64((byte0 << 14) | (byte1 << 6) | (byte2 >> 2))
 		valuesOffset++
-		byte3 := blocks[blocksOffset]
+		byte3 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte4 := blocks[blocksOffset]
+		byte4 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte5 := blocks[blocksOffset]
+		byte5 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte2 & 3) << 20) | (byte3 << 12) | (byte4 << 4) | byte(uint8(byte5) >> 4))
+		values[valuesOffset] = int64(((byte2 & 3) << 20) | (byte3 << 12) | (byte4 << 4) | (byte5 >> 4))
 		valuesOffset++
-		byte6 := blocks[blocksOffset]
+		byte6 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte7 := blocks[blocksOffset]
+		byte7 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte8 := blocks[blocksOffset]
+		byte8 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte5 & 15) << 18) | (byte6 << 10) | (byte7 << 2) | byte(uint8(byte8) >> 6))
+		values[valuesOffset] = int64(((byte5 & 15) << 18) | (byte6 << 10) | (byte7 << 2) | (byte8 >> 6))
 		valuesOffset++
-		byte9 := blocks[blocksOffset]
+		byte9 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte10 := blocks[blocksOffset]
+		byte10 := int64(blocks[blocksOffset])
 		blocksOffset++
 		values[valuesOffset] = int64(((byte8 & 63) << 16) | (byte9 << 8) | byte10)
 		valuesOffset++
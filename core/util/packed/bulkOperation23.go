@@ -107,65 +107,65 @@ func (op *BulkOperationPacked23) decode(blocks []int64, values []int64, iteratio
 func (op *BulkOperationPacked23) decodeByteToint64(blocks []byte, values []int64, iterations int) {
 	blocksOffset, valuesOffset := 0, 0
 	for i := 0; i < iterations; i ++ {
-		byte0 := blocks[blocksOffset]
+		byte0 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte1 := blocks[blocksOffset]
+		byte1 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte2 := blocks[blocksOffset]
+		byte2 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64((byte0 << 15) | (byte1 << 7) | byte(uint8(byte2) >> 1))
+		values[valuesOffset] = int64((byte0 << 15) | (byte1 << 7) | (byte2 >> 1))
 		valuesOffset++
-		byte3 := blocks[blocksOffset]
+		byte3 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte4 := blocks[blocksOffset]
+		byte4 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte5 := blocks[blocksOffset]
+		byte5 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte2 & 1) << 22) | (byte3 << 14) | (byte4 << 6) | byte(uint8(byte5) >> 2))
+		values[valuesOffset] = int64(((byte2 & 1) << 22) | (byte3 << 14) | (byte4 << 6) | (byte5 >> 2))
 		valuesOffset++
-		byte6 := blocks[blocksOffset]
+		byte6 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte7 := blocks[blocksOffset]
+		byte7 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte8 := blocks[blocksOffset]
+		byte8 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte5 & 3) << 21) | (byte6 << 13) | (byte7 << 5) | byte(uint8(byte8) >> 3))
+		values[valuesOffset] = int64(((byte5 & 3) << 21) | (byte6 << 13) | (byte7 << 5) | (byte8 >> 3))
 		valuesOffset++
-		byte9 := blocks[blocksOffset]
+		byte9 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte10 := blocks[blocksOffset]
+		byte10 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte11 := blocks[blocksOffset]
+		byte11 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte8 & 7) << 20) | (byte9 << 12) | (byte10 << 4) | byte(uint8(byte11) >> 4))
+		values[valuesOffset] = int64(((byte8 & 7) << 20) | (byte9 << 12) | (byte10 << 4) | (byte11 >> 4))
 		valuesOffset++
-		byte12 := blocks[blocksOffset]
+		byte12 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte13 := blocks[blocksOffset]
+		byte13 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte14 := blocks[blocksOffset]
+		byte14 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte11 & 15) << 19) | (byte12 << 11) | (byte13 << 3) | byte(uint8(byte14) >> 5))
+		values[valuesOffset] = int64(((byte11 & 15) << 19) | (byte12 << 11) | (byte13 << 3) | (byte14 >> 5))
 		valuesOffset++
-		byte15 := blocks[blocksOffset]
+		byte15 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte16 := blocks[blocksOffset]
+		byte16 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte17 := blocks[blocksOffset]
+		byte17 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte14 & 31) << 18) | (byte15 << 10) | (byte16 << 2) | byte(uint8(byte17) >> 6))
+		values[valuesOffset] = int64(((byte14 & 31) << 18) | (byte15 << 10) | (byte16 << 2) | (byte17 >> 6))
 		valuesOffset++
-		byte18 := blocks[blocksOffset]
+		byte18 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte19 := blocks[blocksOffset]
+		byte19 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte20 := blocks[blocksOffset]
+		byte20 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte17 & 63) << 17) | (byte18 << 9) | (byte19 << 1) | byte(uint8(byte20) >> 7))
+		values[valuesOffset] = int64(((byte17 & 63) << 17) | (byte18 << 9) | (byte19 << 1) | (byte20 >> 7))
 		valuesOffset++
-		byte21 := blocks[blocksOffset]
+		byte21 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte22 := blocks[blocksOffset]
+		byte22 := int64(blocks[blocksOffset])
 		blocksOffset++
 		values[valuesOffset] = int64(((byte20 & 127) << 16) | (byte21 << 8) | byte22)
 		valuesOffset++
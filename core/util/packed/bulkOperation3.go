@@ -87,25 +87,25 @@ func (op *BulkOperationPacked3) decode(blocks []int64, values []int64, iteration
 func (op *BulkOperationPacked3) decodeByteToint64(blocks []byte, values []int64, iterations int) {
 	blocksOffset, valuesOffset := 0, 0
 	for i := 0; i < iterations; i ++ {
-		byte0 := blocks[blocksOffset]
+		byte0 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64( byte(uint8(byte0) >> 5))
+		values[valuesOffset] = int64( byte0 >> 5)
 		valuesOffset++
-		values[valuesOffset] = int64( byte(uint8(byte0 >> 2)) & 7)
+		values[valuesOffset] = int64( (byte0 >> 2) & 7)
 		valuesOffset++
-		byte1 := blocks[blocksOffset]
+		byte1 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte0 & 3) << 1) | byte(uint8(byte1) >> 7))
+		values[valuesOffset] = int64(((byte0 & 3) << 1) | (byte1 >> 7))
 		valuesOffset++
-		values[valuesOffset] = int64( byte(uint8(byte1 >> 4)) & 7)
+		values[valuesOffset] = int64( (byte1 >> 4) & 7)
 		valuesOffset++
-		values[valuesOffset] = int64( byte(uint8(byte1 >> 1)) & 7)
+		values[valuesOffset] = int64( (byte1 >> 1) & 7)
 		valuesOffset++
-		byte2 := blocks[blocksOffset]
+		byte2 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte1 & 1) << 2) | byte(uint8(byte2) >> 6))
+		values[valuesOffset] = int64(((byte1 & 1) << 2) | (byte2 >> 6))
 		valuesOffset++
-		values[valuesOffset] = int64( byte(uint8(byte2 >> 3)) & 7)
+		values[valuesOffset] = int64( (byte2 >> 3) & 7)
 		valuesOffset++
 		values[valuesOffset] = int64( byte2 & 7)
 		valuesOffset++
@@ -89,29 +89,29 @@ func (op *BulkOperationPacked5) decode(blocks []int64, values []int64, iteration
 func (op *BulkOperationPacked5) decodeByteToint64(blocks []byte, values []int64, iterations int) {
 	blocksOffset, valuesOffset := 0, 0
 	for i := 0; i < iterations; i ++ {
-		byte0 := blocks[blocksOffset]
+		byte0 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64( byte(uint8(byte0) >> 3))
+		values[valuesOffset] = int64( byte0 >> 3)
 		valuesOffset++
-		byte1 := blocks[blocksOffset]
+		byte1 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte0 & 7) << 2) | byte(uint8(byte1) >> 6))
+		values[valuesOffset] = int64(((byte0 & 7) << 2) | (byte1 >> 6))
 		valuesOffset++
-		values[valuesOffset] = int64( byte(uint8(byte1 >> 1)) & 31)
+		values[valuesOffset] = int64( (byte1 >> 1) & 31)
 		valuesOffset++
-		byte2 := blocks[blocksOffset]
+		byte2 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte1 & 1) << 4) | byte(uint8(byte2) >> 4))
+		values[valuesOffset] = int64(((byte1 & 1) << 4) | (byte2 >> 4))
 		valuesOffset++
-		byte3 := blocks[blocksOffset]
+		byte3 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte2 & 15) << 1) | byte(uint8(byte3) >> 7))
+		values[valuesOffset] = int64(((byte2 & 15) << 1) | (byte3 >> 7))
 		valuesOffset++
-		values[valuesOffset] = int64( byte(uint8(byte3 >> 2)) & 31)
+		values[valuesOffset] = int64( (byte3 >> 2) & 31)
 		valuesOffset++
-		byte4 := blocks[blocksOffset]
+		byte4 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte3 & 3) << 3) | byte(uint8(byte4) >> 5))
+		values[valuesOffset] = int64(((byte3 & 3) << 3) | (byte4 >> 5))
 		valuesOffset++
 		values[valuesOffset] = int64( byte4 & 31)
 		valuesOffset++
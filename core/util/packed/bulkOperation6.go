@@ -55,17 +55,17 @@ func (op *BulkOperationPacked6) decode(blocks []int64, values []int64, iteration
 func (op *BulkOperationPacked6) decodeByteToint64(blocks []byte, values []int64, iterations int) {
 	blocksOffset, valuesOffset := 0, 0
 	for i := 0; i < iterations; i ++ {
-		byte0 := blocks[blocksOffset]
+		byte0 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64( byte(uint8(byte0) >> 2))
+		values[valuesOffset] = int64( byte0 >> 2)
 		valuesOffset++
-		byte1 := blocks[blocksOffset]
+		byte1 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte0 & 3) << 4) | byte(uint8(byte1) >> 4))
+		values[valuesOffset] = int64(((byte0 & 3) << 4) | (byte1 >> 4))
 		valuesOffset++
-		byte2 := blocks[blocksOffset]
+		byte2 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte1 & 15) << 2) | byte(uint8(byte2) >> 6))
+		values[valuesOffset] = int64(((byte1 & 15) << 2) | (byte2 >> 6))
 		valuesOffset++
 		values[valuesOffset] = int64( byte2 & 63)
 		valuesOffset++
@@ -91,33 +91,33 @@ func (op *BulkOperationPacked7) decode(blocks []int64, values []int64, iteration
 func (op *BulkOperationPacked7) decodeByteToint64(blocks []byte, values []int64, iterations int) {
 	blocksOffset, valuesOffset := 0, 0
 	for i := 0; i < iterations; i ++ {
-		byte0 := blocks[blocksOffset]
+		byte0 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64( byte(uint8(byte0) >> 1))
+		values[valuesOffset] = int64( byte0 >> 1)
 		valuesOffset++
-		byte1 := blocks[blocksOffset]
+		byte1 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte0 & 1) << 6) | byte(uint8(byte1) >> 2))
+		values[valuesOffset] = int64(((byte0 & 1) << 6) | (byte1 >> 2))
 		valuesOffset++
-		byte2 := blocks[blocksOffset]
+		byte2 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte1 & 3) << 5) | byte(uint8(byte2) >> 3))
+		values[valuesOffset] = int64(((byte1 & 3) << 5) | (byte2 >> 3))
 		valuesOffset++
-		byte3 := blocks[blocksOffset]
+		byte3 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte2 & 7) << 4) | byte(uint8(byte3) >> 4))
+		values[valuesOffset] = int64(((byte2 & 7) << 4) | (byte3 >> 4))
 		valuesOffset++
-		byte4 := blocks[blocksOffset]
+		byte4 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte3 & 15) << 3) | byte(uint8(byte4) >> 5))
+		values[valuesOffset] = int64(((byte3 & 15) << 3) | (byte4 >> 5))
 		valuesOffset++
-		byte5 := blocks[blocksOffset]
+		byte5 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte4 & 31) << 2) | byte(uint8(byte5) >> 6))
+		values[valuesOffset] = int64(((byte4 & 31) << 2) | (byte5 >> 6))
 		valuesOffset++
-		byte6 := blocks[blocksOffset]
+		byte6 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte5 & 63) << 1) | byte(uint8(byte6) >> 7))
+		values[valuesOffset] = int64(((byte5 & 63) << 1) | (byte6 >> 7))
 		valuesOffset++
 		values[valuesOffset] = int64( byte6 & 127)
 		valuesOffset++
@@ -93,37 +93,37 @@ func (op *BulkOperationPacked9) decode(blocks []int64, values []int64, iteration
 func (op *BulkOperationPacked9) decodeByteToint64(blocks []byte, values []int64, iterations int) {
 	blocksOffset, valuesOffset := 0, 0
 	for i := 0; i < iterations; i ++ {
-		byte0 := blocks[blocksOffset]
+		byte0 := int64(blocks[blocksOffset])
 		blocksOffset++
-		byte1 := blocks[blocksOffset]
+		byte1 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64((byte0 << 1) | byte(uint8(byte1) >> 7))
+		values[valuesOffset] = int64((byte0 << 1) | (byte1 >> 7))
 		valuesOffset++
-		byte2 := blocks[blocksOffset]
+		byte2 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte1 & 127) << 2) | byte(uint8(byte2) >> 6))
+		values[valuesOffset] = int64(((byte1 & 127) << 2) | (byte2 >> 6))
 		valuesOffset++
-		byte3 := blocks[blocksOffset]
+		byte3 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte2 & 63) << 3) | byte(uint8(byte3) >> 5))
+		values[valuesOffset] = int64(((byte2 & 63) << 3) | (byte3 >> 5))
 		valuesOffset++
-		byte4 := blocks[blocksOffset]
+		byte4 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte3 & 31) << 4) | byte(uint8(byte4) >> 4))
+		values[valuesOffset] = int64(((byte3 & 31) << 4) | (byte4 >> 4))
 		valuesOffset++
-		byte5 := blocks[blocksOffset]
+		byte5 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte4 & 15) << 5) | byte(uint8(byte5) >> 3))
+		values[valuesOffset] = int64(((byte4 & 15) << 5) | (byte5 >> 3))
 		valuesOffset++
-		byte6 := blocks[blocksOffset]
+		byte6 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte5 & 7) << 6) | byte(uint8(byte6) >> 2))
+		values[valuesOffset] = int64(((byte5 & 7) << 6) | (byte6 >> 2))
 		valuesOffset++
-		byte7 := blocks[blocksOffset]
+		byte7 := int64(blocks[blocksOffset])
 		blocksOffset++
-		values[valuesOffset] = int64(((byte6 & 3) << 7) | byte(uint8(byte7) >> 1))
+		values[valuesOffset] = int64(((byte6 & 3) << 7) | (byte7 >> 1))
 		valuesOffset++
-		byte8 := blocks[blocksOffset]
+		byte8 := int64(blocks[blocksOffset])
 		blocksOffset++
 		values[valuesOffset] = int64(((byte7 & 1) << 8) | byte8)
 		valuesOffset++
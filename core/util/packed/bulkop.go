@@ -1,5 +1,9 @@
 package packed
 
+import (
+	"fmt"
+)
+
 // util/packed/BulkOperationPacked.java
 
 // Non-specialized BulkOperation for Packed format
@@ -80,7 +84,7 @@ func (p *BulkOperationPacked) encodeLongToLong(values, blocks []int64, iteration
 
 func (p *BulkOperationPacked) encodeLongToByte(values []int64, blocks []byte, iterations int) {
 	var nextBlock int = 0
-	var bitsLeft int = 0
+	var bitsLeft int = 8
 	valuesOffset, blocksOffset := 0, 0
 	for i, limit := 0, p.byteValueCount*iterations; i < limit; i++ {
 		v := values[valuesOffset]
@@ -106,6 +110,92 @@ func (p *BulkOperationPacked) encodeLongToByte(values []int64, blocks []byte, it
 	assert(bitsLeft == 8)
 }
 
+func (p *BulkOperationPacked) decodeByteToint64(blocks []byte, values []int64, iterations int) {
+	var nextValue int64 = 0
+	bitsLeft := p.bitsPerValue
+	blocksOffset, valuesOffset := 0, 0
+	for i, limit := 0, iterations*p.byteBlockCount; i < limit; i++ {
+		bytes := int64(blocks[blocksOffset])
+		blocksOffset++
+		if bitsLeft > 8 {
+			// just buffer
+			bitsLeft -= 8
+			nextValue |= (bytes << uint(bitsLeft))
+		} else {
+			// flush
+			bits := uint(8 - bitsLeft)
+			values[valuesOffset] = nextValue | (bytes >> bits)
+			valuesOffset++
+			for bits >= uint(p.bitsPerValue) {
+				bits -= uint(p.bitsPerValue)
+				values[valuesOffset] = (bytes >> bits) & p.mask
+				valuesOffset++
+			}
+			// then buffer
+			bitsLeft = p.bitsPerValue - int(bits)
+			nextValue = (bytes & ((1 << bits) - 1)) << uint(bitsLeft)
+		}
+	}
+	assert(bitsLeft == p.bitsPerValue)
+}
+
+func (p *BulkOperationPacked) DecodeByteToInt(blocks []byte, values []int, iterations int) {
+	nextValue := 0
+	bitsLeft := p.bitsPerValue
+	blocksOffset, valuesOffset := 0, 0
+	for i, limit := 0, iterations*p.byteBlockCount; i < limit; i++ {
+		bytes := int(blocks[blocksOffset])
+		blocksOffset++
+		if bitsLeft > 8 {
+			// just buffer
+			bitsLeft -= 8
+			nextValue |= (bytes << uint(bitsLeft))
+		} else {
+			// flush
+			bits := uint(8 - bitsLeft)
+			values[valuesOffset] = nextValue | (bytes >> bits)
+			valuesOffset++
+			for bits >= uint(p.bitsPerValue) {
+				bits -= uint(p.bitsPerValue)
+				values[valuesOffset] = (bytes >> bits) & p.intMask
+				valuesOffset++
+			}
+			// then buffer
+			bitsLeft = p.bitsPerValue - int(bits)
+			nextValue = (bytes & ((1 << bits) - 1)) << uint(bitsLeft)
+		}
+	}
+	assert(bitsLeft == p.bitsPerValue)
+}
+
+func (p *BulkOperationPacked) EncodeIntToByte(values []int, blocks []byte, iterations int) {
+	nextBlock := 0
+	bitsLeft := 8
+	valuesOffset, blocksOffset := 0, 0
+	for i, limit := 0, p.byteValueCount*iterations; i < limit; i++ {
+		v := values[valuesOffset]
+		valuesOffset++
+		assert(p.bitsPerValue == 32 || BitsRequired(int64(uint32(v))) <= p.bitsPerValue)
+		if p.bitsPerValue < bitsLeft { // just buffer
+			nextBlock |= (v << uint(bitsLeft-p.bitsPerValue))
+			bitsLeft -= p.bitsPerValue
+		} else { // flush as many blocks as possible
+			bits := uint(p.bitsPerValue - bitsLeft)
+			blocks[blocksOffset] = byte(nextBlock | int(uint32(v)>>bits))
+			blocksOffset++
+			for bits >= 8 {
+				bits -= 8
+				blocks[blocksOffset] = byte(uint32(v) >> bits)
+				blocksOffset++
+			}
+			// then buffer
+			bitsLeft = int(8 - bits)
+			nextBlock = (v & ((1 << bits) - 1)) << uint(bitsLeft)
+		}
+	}
+	assert(bitsLeft == 8)
+}
+
 // util/packed/BulkOperationPackedSingleBlock.java
 
 // Non-specialized BulkOperation for PACKED_SINGLE_BLOCK format
@@ -129,10 +219,67 @@ func newBulkOperationPackedSingleBlock(bitsPerValue uint32) BulkOperation {
 	return self
 }
 
+func (p *BulkOperationPackedSingleBlock) ByteBlockCount() int {
+	return BLOCK_COUNT * 8
+}
+
 func (p *BulkOperationPackedSingleBlock) ByteValueCount() int {
 	return p.valueCount
 }
 
+func readLong(blocks []byte) int64 {
+	return int64(blocks[0])<<56 | int64(blocks[1])<<48 |
+		int64(blocks[2])<<40 | int64(blocks[3])<<32 |
+		int64(blocks[4])<<24 | int64(blocks[5])<<16 |
+		int64(blocks[6])<<8 | int64(blocks[7])
+}
+
+func writeLong(block int64, blocks []byte) {
+	for j := uint(1); j <= 8; j++ {
+		blocks[j-1] = byte(uint64(block) >> (64 - (j << 3)))
+	}
+}
+
+func (p *BulkOperationPackedSingleBlock) decodeLong(block int64, values []int64) {
+	values[0] = block & p.mask
+	for j := 1; j < p.valueCount; j++ {
+		block = int64(uint64(block) >> uint(p.bitsPerValue))
+		values[j] = block & p.mask
+	}
+}
+
+func (p *BulkOperationPackedSingleBlock) decodeInt(block int64, values []int) {
+	values[0] = int(block & p.mask)
+	for j := 1; j < p.valueCount; j++ {
+		block = int64(uint64(block) >> uint(p.bitsPerValue))
+		values[j] = int(block & p.mask)
+	}
+}
+
+func (p *BulkOperationPackedSingleBlock) decodeByteToint64(blocks []byte,
+	values []int64, iterations int) {
+	blocksOffset, valuesOffset := 0, 0
+	for i := 0; i < iterations; i++ {
+		block := readLong(blocks[blocksOffset:])
+		blocksOffset += 8
+		p.decodeLong(block, values[valuesOffset:])
+		valuesOffset += p.valueCount
+	}
+}
+
+func (p *BulkOperationPackedSingleBlock) DecodeByteToInt(blocks []byte,
+	values []int, iterations int) {
+	assert2(p.bitsPerValue <= 32, fmt.Sprintf(
+		"Cannot decode %v-bits values into an []int", p.bitsPerValue))
+	blocksOffset, valuesOffset := 0, 0
+	for i := 0; i < iterations; i++ {
+		block := readLong(blocks[blocksOffset:])
+		blocksOffset += 8
+		p.decodeInt(block, values[valuesOffset:])
+		valuesOffset += p.valueCount
+	}
+}
+
 func (p *BulkOperationPackedSingleBlock) longToLong(values []int64) int64 {
 	off := 0
 	block := values[off]
@@ -154,7 +301,30 @@ func (p *BulkOperationPackedSingleBlock) encodeLongToLong(values,
 	}
 }
 
+func (p *BulkOperationPackedSingleBlock) intToLong(values []int) int64 {
+	block := int64(values[0])
+	for j := 1; j < p.valueCount; j++ {
+		block |= int64(values[j]) << uint(j*p.bitsPerValue)
+	}
+	return block
+}
+
 func (p *BulkOperationPackedSingleBlock) encodeLongToByte(values []int64,
 	blocks []byte, iterations int) {
-	panic("not implemented yet")
+	valuesOffset, blocksOffset := 0, 0
+	for i := 0; i < iterations; i++ {
+		writeLong(p.longToLong(values[valuesOffset:]), blocks[blocksOffset:])
+		valuesOffset += p.valueCount
+		blocksOffset += 8
+	}
+}
+
+func (p *BulkOperationPackedSingleBlock) EncodeIntToByte(values []int,
+	blocks []byte, iterations int) {
+	valuesOffset, blocksOffset := 0, 0
+	for i := 0; i < iterations; i++ {
+		writeLong(p.intToLong(values[valuesOffset:]), blocks[blocksOffset:])
+		valuesOffset += p.valueCount
+		blocksOffset += 8
+	}
 }
@@ -113,13 +113,107 @@ func (f PackedFormat) IsSupported(bitsPerValue uint32) bool {
 	return bitsPerValue >= 1 && bitsPerValue <= 64
 }
 
+/*
+Returns the overhead per value, in bits.
+*/
+func (f PackedFormat) OverheadPerValue(bitsPerValue uint32) float32 {
+	switch int(f) {
+	case PACKED_SINGLE_BLOCK:
+		assert(f.IsSupported(bitsPerValue))
+		valuesPerBlock := 64 / bitsPerValue
+		overhead := 64 % bitsPerValue
+		return float32(overhead) / float32(valuesPerBlock)
+	}
+	return 0
+}
+
+/* Simple class that holds a format and a number of bits per value. */
+type FormatAndBits struct {
+	Format       PackedFormat
+	BitsPerValue uint32
+}
+
+func (v FormatAndBits) String() string {
+	return fmt.Sprintf("FormatAndBits(format=%v bitsPerValue=%v)", v.Format, v.BitsPerValue)
+}
+
+/*
+Try to find the Format and number of bits per value that would
+restore from disk the fastest reader whose overhead is less than
+acceptableOverheadRatio.
+
+The acceptableOverheadRatio parameter makes sense for random-access
+Readers. In case you only plan to perform sequential access on this
+stream later on, you should probably use COMPACT.
+
+If you don't know how many values you are going to write, use
+valueCount = -1.
+*/
+func FastestFormatAndBits(valueCount, bitsPerValue int,
+	acceptableOverheadRatio float32) FormatAndBits {
+	if valueCount == -1 {
+		valueCount = math.MaxInt32
+	}
+
+	if acceptableOverheadRatio < PackedInts.COMPACT {
+		acceptableOverheadRatio = PackedInts.COMPACT
+	}
+	if acceptableOverheadRatio > PackedInts.FASTEST {
+		acceptableOverheadRatio = PackedInts.FASTEST
+	}
+	acceptableOverheadPerValue := acceptableOverheadRatio * float32(bitsPerValue) // in bits
+
+	maxBitsPerValue := bitsPerValue + int(acceptableOverheadPerValue)
+
+	actualBitsPerValue := -1
+	format := PackedFormat(PACKED)
+
+	if bitsPerValue <= 8 && maxBitsPerValue >= 8 {
+		actualBitsPerValue = 8
+	} else if bitsPerValue <= 16 && maxBitsPerValue >= 16 {
+		actualBitsPerValue = 16
+	} else if bitsPerValue <= 32 && maxBitsPerValue >= 32 {
+		actualBitsPerValue = 32
+	} else if bitsPerValue <= 64 && maxBitsPerValue >= 64 {
+		actualBitsPerValue = 64
+	} else if valueCount <= int(PACKED8_THREE_BLOCKS_MAX_SIZE) && bitsPerValue <= 24 && maxBitsPerValue >= 24 {
+		actualBitsPerValue = 24
+	} else if valueCount <= int(PACKED16_THREE_BLOCKS_MAX_SIZE) && bitsPerValue <= 48 && maxBitsPerValue >= 48 {
+		actualBitsPerValue = 48
+	} else {
+		for bpv := bitsPerValue; bpv <= maxBitsPerValue; bpv++ {
+			if PackedFormat(PACKED_SINGLE_BLOCK).IsSupported(uint32(bpv)) {
+				overhead := PackedFormat(PACKED_SINGLE_BLOCK).OverheadPerValue(uint32(bpv))
+				acceptableOverhead := acceptableOverheadPerValue + float32(bitsPerValue-bpv)
+				if overhead <= acceptableOverhead {
+					actualBitsPerValue = bpv
+					format = PackedFormat(PACKED_SINGLE_BLOCK)
+					break
+				}
+			}
+		}
+		if actualBitsPerValue < 0 {
+			actualBitsPerValue = bitsPerValue
+		}
+	}
+
+	return FormatAndBits{format, uint32(actualBitsPerValue)}
+}
+
 type PackedIntsEncoder interface {
+	// The minum numer of byte blocks to encode in a single iteration, when using byte encoding
+	ByteBlockCount() int
+	// The number of values that can be stored in byteBlockCount() byte blocks
+	ByteValueCount() int
 	// Read iterations * valueCount() values from values, encode them
 	// and write iterations * blockCount() blocks into blocks.
 	// encodeLongToLong(values, blocks []int64, iterations int)
 	// Read iterations * valueCount() values from values, encode them
 	// and write 8 * iterations * blockCount() blocks into blocks.
 	encodeLongToByte(values []int64, blocks []byte, iterations int)
+	// Read iterations * ByteValueCount() values from values, encode
+	// them and write iterations * ByteBlockCount() blocks into blocks.
+	EncodeIntToByte(values []int, blocks []byte, iterations int)
 }
 
 type PackedIntsDecoder interface {
@@ -132,6 +226,11 @@ type PackedIntsDecoder interface {
 		iterations * valueCount() values inot values.
 	*/
 	decodeByteToint64(blocks []byte, values []int64, iterations int)
+	/*
+		Read iterations * ByteBlockCount() blocks from blocks, decode them
+		and write iterations * ByteValueCount() values into values.
+	*/
+	DecodeByteToInt(blocks []byte, values []int, iterations int)
 }
 
 func GetPackedIntsEncoder(format PackedFormat, version int32, bitsPerValue uint32) PackedIntsEncoder {
@@ -595,7 +694,8 @@ func newPacked16ThreeBlocksFromInput(version int32, in DataInput, valueCount int
 
 func (p *Packed16ThreeBlocks) Get(index int) int64 {
 	o := index * 3
-	return int64(p.blocks[o])<<32 | int64(p.blocks[o+1])<<16 | int64(p.blocks[o])
+	return int64(uint16(p.blocks[o]))<<32 | int64(uint16(p.blocks[o+1]))<<16 |
+		int64(uint16(p.blocks[o+2]))
 }
 
 const (
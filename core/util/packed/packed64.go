@@ -6,7 +6,8 @@ import (
 
 func is64Supported(bitsPerValue uint32) bool {
 	// Lucene use binary-search which is unnecessary
-	return packedSingleBlockBulkOps[bitsPerValue-1] != nil
+	return bitsPerValue >= 1 && int(bitsPerValue) <= len(packedSingleBlockBulkOps) &&
+		packedSingleBlockBulkOps[bitsPerValue-1] != nil
 }
 
 type Packed64SingleBlock struct {
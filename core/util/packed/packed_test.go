@@ -2,6 +2,7 @@ package packed
 
 import (
 	"fmt"
+	"github.com/balzaczyy/golucene/core/store"
 	"math"
 	"math/rand"
 	"testing"
@@ -53,3 +54,165 @@ func TestGetPackedIntsDecoder(t *testing.T) {
 		t.Errorf("ByteValueCount() should be 8, instead of %v", n)
 	}
 }
+
+func TestEncodeDecodeInts(t *testing.T) {
+	for j := 0; j <= 1; j++ {
+		format := PackedFormat(j)
+		for bpv := uint32(1); bpv <= 32; bpv++ {
+			if !format.IsSupported(bpv) {
+				continue
+			}
+			encoder := GetPackedIntsEncoder(format, PACKED_VERSION_CURRENT, bpv)
+			decoder := GetPackedIntsDecoder(format, PACKED_VERSION_CURRENT, bpv)
+			iterations := 3
+			values := make([]int, iterations*encoder.(BulkOperation).ByteValueCount())
+			for i := range values {
+				values[i] = int(rand.Int63n(MaxValue(int(bpv)) + 1))
+			}
+			blocks := make([]byte, iterations*decoder.ByteBlockCount())
+			encoder.EncodeIntToByte(values, blocks, iterations)
+			restored := make([]int, len(values))
+			decoder.DecodeByteToInt(blocks, restored, iterations)
+			if fmt.Sprint(values) != fmt.Sprint(restored) {
+				t.Errorf("format=%v bpv=%v: %v != %v", format, bpv, restored, values)
+			}
+		}
+	}
+}
+
+func TestEncodeDecodeLongs(t *testing.T) {
+	for bpv := uint32(1); bpv <= 64; bpv++ {
+		op := newBulkOperation(PackedFormat(PACKED), bpv)
+		iterations := 3
+		values := make([]int64, iterations*op.ByteValueCount())
+		for i := range values {
+			values[i] = rand.Int63() & MaxValue(int(bpv))
+		}
+		blocks := make([]byte, iterations*op.ByteBlockCount())
+		op.encodeLongToByte(values, blocks, iterations)
+		restored := make([]int64, len(values))
+		op.decodeByteToint64(blocks, restored, iterations)
+		if fmt.Sprint(values) != fmt.Sprint(restored) {
+			t.Errorf("bpv=%v: %v != %v", bpv, restored, values)
+		}
+	}
+}
+
+func TestFastestFormatAndBits(t *testing.T) {
+	for bpv, expected := range map[int]FormatAndBits{
+		1:  FormatAndBits{PACKED_SINGLE_BLOCK, 1},
+		3:  FormatAndBits{PACKED, 3},
+		8:  FormatAndBits{PACKED, 8},
+		4:  FormatAndBits{PACKED_SINGLE_BLOCK, 4},
+		21: FormatAndBits{PACKED, 21},
+	} {
+		if v := FastestFormatAndBits(128, bpv, PackedInts.COMPACT); v != expected {
+			t.Errorf("bpv=%v: expected %v, but found %v", bpv, expected, v)
+		}
+	}
+}
+
+func TestBlockPackedReaderIterator(t *testing.T) {
+	const blockSize = 64
+	values := make([]int64, 1000)
+	for i := range values {
+		switch {
+		case i < 64: // all equal
+			values[i] = 42
+		case i < 128: // all equal to zero
+			values[i] = 0
+		case i < 192: // negative values
+			values[i] = -rand.Int63n(1000)
+		case i < 256: // full 64 bits
+			values[i] = int64(rand.Uint32())<<32 | int64(rand.Uint32())
+		default:
+			values[i] = 1000 + rand.Int63n(int64(i))
+		}
+	}
+
+	out := store.NewRAMOutputStreamBuffer()
+	w := NewBlockPackedWriter(out, blockSize)
+	for _, v := range values {
+		if err := w.Add(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	if n := w.Ord(); n != int64(len(values)) {
+		t.Fatalf("Expected ord %v, but found %v", len(values), n)
+	}
+	bytes := make([]byte, out.FilePointer())
+	if err := out.WriteToBytes(bytes); err != nil {
+		t.Fatal(err)
+	}
+
+	it := NewBlockPackedReaderIterator(store.NewByteArrayDataInput(bytes),
+		VERSION_CURRENT, blockSize, int64(len(values)))
+	for i := 0; i < 300; i++ {
+		v, err := it.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != values[i] {
+			t.Fatalf("Value %v should be %v, but found %v", i, values[i], v)
+		}
+	}
+	if err := it.Skip(450); err != nil {
+		t.Fatal(err)
+	}
+	for i := 750; i < len(values); {
+		vs, err := it.NextN(100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range vs {
+			if v != values[i] {
+				t.Fatalf("Value %v should be %v, but found %v", i, values[i], v)
+			}
+			i++
+		}
+	}
+	if _, err := it.Next(); err == nil {
+		t.Error("Iterator should be exhausted.")
+	}
+}
+
+func TestWriterNoHeader(t *testing.T) {
+	for bpv := 1; bpv <= 64; bpv++ {
+		const valueCount = 78
+		out := store.NewRAMOutputStreamBuffer()
+		w := WriterNoHeader(out, PackedFormat(PACKED), valueCount, bpv, 1)
+		values := make([]int64, valueCount)
+		for i := range values {
+			values[i] = rand.Int63() & MaxValue(bpv)
+			if err := w.Add(values[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Finish(); err != nil {
+			t.Fatal(err)
+		}
+		bytes := make([]byte, out.FilePointer())
+		if err := out.WriteToBytes(bytes); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := NewPackedReaderNoHeader(store.NewByteArrayDataInput(bytes),
+			PackedFormat(PACKED), VERSION_CURRENT, valueCount, uint32(bpv))
+		if err != nil {
+			t.Fatal(err)
+		}
+		it := ReaderIteratorNoHeader(store.NewByteArrayDataInput(bytes),
+			PackedFormat(PACKED), VERSION_CURRENT, valueCount, bpv, 1)
+		for i, v := range values {
+			if got := r.Get(i); got != v {
+				t.Fatalf("bpv=%v: value %v should be %v, but found %v", bpv, i, v, got)
+			}
+			if got, err := it.Next(); err != nil || got != v {
+				t.Fatalf("bpv=%v: value %v should be %v, but iterated %v (%v)", bpv, i, v, got, err)
+			}
+		}
+	}
+}
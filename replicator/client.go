@@ -0,0 +1,322 @@
+package replicator
+
+import (
+	"errors"
+	"fmt"
+	"github.com/balzaczyy/golucene/core/index"
+	"github.com/balzaczyy/golucene/core/index/model"
+	"github.com/balzaczyy/golucene/core/store"
+	"hash/crc32"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// replicator/ReplicationClient.java (ReplicationHandler)
+
+/* Applies the revisions copied by a ReplicationClient to a replica. */
+type ReplicationHandler interface {
+	// Returns the version of the replica's revision, or "" if none.
+	CurrentVersion() string
+	// Returns the directory the files of new revisions are copied into.
+	Directory() store.Directory
+	/*
+		Called once all files of the revision are in Directory(); copied
+		lists the ones copied, the others being present already.
+	*/
+	RevisionReady(version string, files []RevisionFile, copied []string) error
+}
+
+// replicator/IndexReplicationHandler.java
+
+/*
+A ReplicationHandler for replicas of an IndexRevision. Once a revision
+is copied, it makes the new commit durable, opens a DirectoryReader on
+it and swaps it with the previous one, then deletes the files which
+no longer belong to the index.
+
+The callback, if any, is called with each new reader, e.g. to update
+the searcher of the application.
+*/
+type IndexReplicationHandler struct {
+	sync.Locker
+	dir      store.Directory
+	callback func(reader index.DirectoryReader) error
+	reader   index.DirectoryReader
+	version  string
+}
+
+/* Creates a handler, opening the index already in dir if any. */
+func NewIndexReplicationHandler(dir store.Directory,
+	callback func(reader index.DirectoryReader) error) (*IndexReplicationHandler, error) {
+
+	ans := &IndexReplicationHandler{Locker: &sync.Mutex{}, dir: dir, callback: callback}
+	ok, err := index.IsIndexExists(dir)
+	if err != nil || !ok {
+		return ans, err
+	}
+	files, err := dir.ListAll()
+	if err != nil {
+		return nil, err
+	}
+	if ans.reader, err = index.OpenDirectoryReader(dir); err != nil {
+		return nil, err
+	}
+	ans.version = strconv.FormatInt(index.LastCommitGeneration(files), 16)
+	return ans, nil
+}
+
+func (h *IndexReplicationHandler) CurrentVersion() string {
+	h.Lock()
+	defer h.Unlock()
+	return h.version
+}
+
+func (h *IndexReplicationHandler) Directory() store.Directory {
+	return h.dir
+}
+
+/*
+Returns the reader of the current revision, or nil if none, with its
+ref count incremented; call DecRef() on it once done.
+*/
+func (h *IndexReplicationHandler) Reader() index.DirectoryReader {
+	h.Lock()
+	defer h.Unlock()
+	if h.reader != nil {
+		h.reader.IncRef()
+	}
+	return h.reader
+}
+
+func (h *IndexReplicationHandler) RevisionReady(version string,
+	files []RevisionFile, copied []string) error {
+
+	if len(files) == 0 {
+		return errors.New(fmt.Sprintf("revision %v has no files", version))
+	}
+	segmentsFile := files[len(files)-1].FileName
+	if !strings.HasPrefix(segmentsFile, index.INDEX_FILENAME_SEGMENTS) {
+		return errors.New(fmt.Sprintf(
+			"last file of revision %v should be segments_N, found %v", version, segmentsFile))
+	}
+
+	// make the commit durable, then point segments.gen to it
+	if err := h.dir.Sync(copied); err != nil {
+		return err
+	}
+	index.WriteSegmentsGen(h.dir, index.GenerationFromSegmentsFileName(segmentsFile))
+
+	reader, err := index.OpenDirectoryReader(h.dir)
+	if err != nil {
+		return err
+	}
+	h.Lock()
+	old := h.reader
+	h.reader, h.version = reader, version
+	h.Unlock()
+
+	if h.callback != nil {
+		if err = h.callback(reader); err != nil {
+			log.Printf("IndexReplicationHandler: callback failed: %v", err)
+		}
+	}
+	if old != nil {
+		// in-flight searches keep the old reader open
+		if err2 := old.DecRef(); err == nil {
+			err = err2
+		}
+	}
+	h.cleanupOldIndexFiles(files)
+	return err
+}
+
+/*
+Deletes the index files not referenced by the current revision, e.g.
+left by previous revisions or a failed copy. Errors are ignored, e.g.
+on Windows for files still open; the next revision retries.
+*/
+func (h *IndexReplicationHandler) cleanupOldIndexFiles(files []RevisionFile) {
+	current := make(map[string]bool)
+	for _, file := range files {
+		current[file.FileName] = true
+	}
+	names, err := h.dir.ListAll()
+	if err != nil {
+		return
+	}
+	for _, name := range names {
+		if !current[name] && name != index.INDEX_FILENAME_SEGMENTS_GEN &&
+			(model.CODEC_FILE_PATTERN.MatchString(name) ||
+				strings.HasPrefix(name, index.INDEX_FILENAME_SEGMENTS)) {
+			h.dir.DeleteFile(name) // ignore error
+		}
+	}
+}
+
+/* Releases the current reader. */
+func (h *IndexReplicationHandler) Close() error {
+	h.Lock()
+	defer h.Unlock()
+	if h.reader != nil {
+		defer func() { h.reader = nil }()
+		return h.reader.DecRef()
+	}
+	return nil
+}
+
+// replicator/ReplicationClient.java
+
+/*
+Keeps a replica up to date with a Replicator: checks for newer
+revisions, copies the files the replica misses into the handler's
+directory, verifying their length and checksum, then hands the
+revision to the handler. Files of the replica with the same name and
+length as the revision's are not copied again, as index files are
+never modified once written.
+
+Updates are run on demand with UpdateNow(), or periodically with
+StartUpdateLoop().
+*/
+type ReplicationClient struct {
+	sync.Locker // one update at a time
+	replicator  Replicator
+	handler     ReplicationHandler
+	stop, done  chan bool
+}
+
+func NewReplicationClient(replicator Replicator, handler ReplicationHandler) *ReplicationClient {
+	return &ReplicationClient{
+		Locker:     &sync.Mutex{},
+		replicator: replicator,
+		handler:    handler,
+	}
+}
+
+/*
+Checks for an update and applies it, if any; returns whether the
+replica was updated.
+*/
+func (c *ReplicationClient) UpdateNow() (updated bool, err error) {
+	c.Lock()
+	defer c.Unlock()
+	token, err := c.replicator.CheckForUpdate(c.handler.CurrentVersion())
+	if err != nil || token == nil {
+		return false, err
+	}
+	defer func() {
+		if err2 := c.replicator.Release(token.ID); err == nil {
+			err = err2
+		}
+	}()
+
+	dir := c.handler.Directory()
+	var copied []string
+	for _, file := range token.Files {
+		if n, err := dir.FileLength(file.FileName); err == nil && n == file.Length {
+			continue // already there
+		}
+		if err = c.copyFile(token.ID, file, dir); err != nil {
+			return false, err
+		}
+		copied = append(copied, file.FileName)
+	}
+	if err = c.handler.RevisionReady(token.Version, token.Files, copied); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (c *ReplicationClient) copyFile(sessionID string, file RevisionFile,
+	dir store.Directory) (err error) {
+
+	in, err := c.replicator.ObtainFile(sessionID, file.FileName)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := dir.CreateOutput(file.FileName, store.IO_CONTEXT_DEFAULT)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err = mergeError(err, out.Close()); err != nil {
+			dir.DeleteFile(file.FileName) // ignore error
+		}
+	}()
+
+	h := crc32.NewIEEE()
+	buf := make([]byte, 16*1024)
+	var length int64
+	for {
+		n, err := in.Read(buf)
+		if n > 0 {
+			h.Write(buf[:n])
+			if err := out.WriteBytes(buf[:n]); err != nil {
+				return err
+			}
+			length += int64(n)
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	if length != file.Length || int64(h.Sum32()) != file.Checksum {
+		return errors.New(fmt.Sprintf(
+			"file '%v' is corrupted: expected length=%v checksum=%v, got length=%v checksum=%v",
+			file.FileName, file.Length, file.Checksum, length, h.Sum32()))
+	}
+	return nil
+}
+
+func mergeError(err, err2 error) error {
+	if err == nil {
+		return err2
+	}
+	return err
+}
+
+/*
+Starts updating the replica every interval, in the background. Errors
+are logged, and the update retried on the next tick.
+*/
+func (c *ReplicationClient) StartUpdateLoop(interval time.Duration) {
+	c.StopUpdateLoop()
+	stop, done := make(chan bool), make(chan bool)
+	c.stop, c.done = stop, done
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := c.UpdateNow(); err != nil {
+				log.Printf("ReplicationClient: update failed: %v", err)
+			}
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+/* Stops the update loop, waiting for a running update to finish. */
+func (c *ReplicationClient) StopUpdateLoop() {
+	if c.stop != nil {
+		close(c.stop)
+		<-c.done
+		c.stop, c.done = nil, nil
+	}
+}
+
+/* Stops the update loop; the replicator and handler are left open. */
+func (c *ReplicationClient) Close() error {
+	c.StopUpdateLoop()
+	return nil
+}
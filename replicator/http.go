@@ -0,0 +1,188 @@
+package replicator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// replicator/http/ReplicationService.java
+
+const (
+	// Actions of the ReplicationService, the last element of the path
+	// requested.
+	REPLICATION_ACTION_UPDATE  = "update"
+	REPLICATION_ACTION_OBTAIN  = "obtain"
+	REPLICATION_ACTION_RELEASE = "release"
+
+	// Query parameters
+	REPLICATION_PARAM_VERSION   = "version"
+	REPLICATION_PARAM_SESSION   = "session"
+	REPLICATION_PARAM_FILE_NAME = "file"
+)
+
+/*
+An http.Handler exposing a Replicator to HTTPReplicator clients, e.g.
+
+	http.Handle("/replicate/", NewReplicationService(replicator))
+
+Paths ending with /update?version=V answer the SessionToken as JSON,
+or 204 No Content if the client is up to date, or 400 Bad Request if
+the version is invalid; /obtain?session=S&file=F
+streams the file; /release?session=S releases the session. Expired
+sessions are answered with 410 Gone.
+*/
+type ReplicationService struct {
+	replicator Replicator
+}
+
+func NewReplicationService(replicator Replicator) *ReplicationService {
+	return &ReplicationService{replicator}
+}
+
+func (s *ReplicationService) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	params := req.URL.Query()
+	action := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+	switch action {
+	case REPLICATION_ACTION_UPDATE:
+		token, err := s.replicator.CheckForUpdate(params.Get(REPLICATION_PARAM_VERSION))
+		if err != nil {
+			replicationError(w, err)
+		} else if token == nil {
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(token)
+		}
+	case REPLICATION_ACTION_OBTAIN:
+		in, err := s.replicator.ObtainFile(params.Get(REPLICATION_PARAM_SESSION),
+			params.Get(REPLICATION_PARAM_FILE_NAME))
+		if err != nil {
+			replicationError(w, err)
+			return
+		}
+		defer in.Close()
+		w.Header().Set("Content-Type", "application/octet-stream")
+		io.Copy(w, in) // the client verifies the length and checksum
+	case REPLICATION_ACTION_RELEASE:
+		if req.Method != "POST" {
+			http.Error(w, "release must be POSTed", http.StatusMethodNotAllowed)
+		} else if err := s.replicator.Release(params.Get(REPLICATION_PARAM_SESSION)); err != nil {
+			replicationError(w, err)
+		}
+	default:
+		http.Error(w, fmt.Sprintf("unsupported action: '%v'", action), http.StatusBadRequest)
+	}
+}
+
+func replicationError(w http.ResponseWriter, err error) {
+	switch err.(type) {
+	case *SessionExpiredError:
+		http.Error(w, err.Error(), http.StatusGone)
+	case *InvalidVersionError:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// replicator/http/HttpReplicator.java
+
+/*
+A Replicator talking to a ReplicationService over HTTP, for use by
+the clients of remote replicas. Revisions can't be published through
+it.
+*/
+type HTTPReplicator struct {
+	url    string
+	client *http.Client
+}
+
+/*
+Creates a replicator for the service at the given URL, e.g.
+"http://primary:8080/replicate". A nil client stands for
+http.DefaultClient.
+*/
+func NewHTTPReplicator(url string, client *http.Client) *HTTPReplicator {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPReplicator{strings.TrimSuffix(url, "/"), client}
+}
+
+func (r *HTTPReplicator) do(method, action string, params url.Values) (*http.Response, error) {
+	req, err := http.NewRequest(method,
+		fmt.Sprintf("%v/%v?%v", r.url, action, params.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	// turn the response back into an error
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusGone {
+		return nil, &SessionExpiredError{params.Get(REPLICATION_PARAM_SESSION)}
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	return nil, errors.New(fmt.Sprintf("%v failed: %v %v",
+		action, resp.Status, strings.TrimSpace(string(msg))))
+}
+
+func (r *HTTPReplicator) Publish(rev Revision) error {
+	return errors.New("Revisions can't be published through HTTP")
+}
+
+func (r *HTTPReplicator) CheckForUpdate(currentVersion string) (*SessionToken, error) {
+	resp, err := r.do("GET", REPLICATION_ACTION_UPDATE,
+		url.Values{REPLICATION_PARAM_VERSION: {currentVersion}})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+	token := new(SessionToken)
+	if err = json.NewDecoder(resp.Body).Decode(token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (r *HTTPReplicator) Release(sessionID string) error {
+	resp, err := r.do("POST", REPLICATION_ACTION_RELEASE,
+		url.Values{REPLICATION_PARAM_SESSION: {sessionID}})
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (r *HTTPReplicator) ObtainFile(sessionID, fileName string) (io.ReadCloser, error) {
+	resp, err := r.do("GET", REPLICATION_ACTION_OBTAIN, url.Values{
+		REPLICATION_PARAM_SESSION:   {sessionID},
+		REPLICATION_PARAM_FILE_NAME: {fileName},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (r *HTTPReplicator) Close() error {
+	return nil
+}
+
+func (r *HTTPReplicator) String() string {
+	return fmt.Sprintf("HTTPReplicator(%v)", r.url)
+}
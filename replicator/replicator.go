@@ -0,0 +1,279 @@
+package replicator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// replicator/SessionToken.java
+
+/*
+Token for a replication session, guaranteeing that the files of its
+revision remain available until the session is released or expires.
+*/
+type SessionToken struct {
+	// Id of the session, passed to ObtainFile() and Release().
+	ID string
+	// Version of the revision to copy.
+	Version string
+	Files   []RevisionFile
+}
+
+func (t *SessionToken) String() string {
+	return fmt.Sprintf("id=%v version=%v files=%v", t.ID, t.Version, t.Files)
+}
+
+// replicator/SessionExpiredException.java
+
+/*
+Returned when a replication session is used after it was released,
+or expired. The client should simply start a new session.
+*/
+type SessionExpiredError struct {
+	SessionID string
+}
+
+func (err *SessionExpiredError) Error() string {
+	return fmt.Sprintf("session (id=%v) expired or does not exist", err.SessionID)
+}
+
+// replicator/Replicator.java
+
+/*
+Serves revisions to replication clients. The primary publishes new
+revisions, while clients check for updates, and copy the files of a
+revision within a session which holds it until released.
+*/
+type Replicator interface {
+	io.Closer
+	/*
+		Publishes a new Revision, making it available for replication.
+		The replicator releases the previously published revision once
+		no session uses it anymore.
+	*/
+	Publish(rev Revision) error
+	/*
+		Checks if the client needs to be updated from the given version
+		(empty if the client has no revision yet). Returns nil if it's
+		up to date, or a new session to copy the latest revision with.
+	*/
+	CheckForUpdate(currentVersion string) (*SessionToken, error)
+	// Notifies the replicator that the client is done with the session.
+	Release(sessionID string) error
+	// Opens a file of the revision of the given session.
+	ObtainFile(sessionID, fileName string) (io.ReadCloser, error)
+}
+
+/* Sessions not accessed for that long are released. */
+const DEFAULT_SESSION_EXPIRATION_THRESHOLD = 30 * time.Minute
+
+// replicator/LocalReplicator.java
+
+/*
+A Replicator running in the same process as the publisher, which can
+be exposed to remote clients with a ReplicationService.
+*/
+type LocalReplicator struct {
+	sync.Locker
+	current             *refCountedRevision
+	sessions            map[string]*replicationSession
+	lastSessionID       int64
+	expirationThreshold time.Duration
+	closed              bool
+}
+
+/* A revision released once no session, nor the replicator, holds it. */
+type refCountedRevision struct {
+	Revision
+	refCount int
+}
+
+func (r *refCountedRevision) decRef() error {
+	if r.refCount--; r.refCount == 0 {
+		return r.Release()
+	}
+	return nil
+}
+
+type replicationSession struct {
+	token      *SessionToken
+	revision   *refCountedRevision
+	files      map[string]bool
+	lastAccess time.Time
+}
+
+func NewLocalReplicator() *LocalReplicator {
+	return &LocalReplicator{
+		Locker:              &sync.Mutex{},
+		sessions:            make(map[string]*replicationSession),
+		expirationThreshold: DEFAULT_SESSION_EXPIRATION_THRESHOLD,
+	}
+}
+
+/*
+Sets how long a session may be idle before it's released, so a
+client which died doesn't hold revisions forever.
+*/
+func (r *LocalReplicator) SetExpirationThreshold(threshold time.Duration) {
+	r.Lock()
+	defer r.Unlock()
+	r.expirationThreshold = threshold
+	r.checkExpiredSessions()
+}
+
+func (r *LocalReplicator) ensureOpen() error {
+	if r.closed {
+		return errors.New("This replicator has already been closed")
+	}
+	return nil
+}
+
+func (r *LocalReplicator) checkExpiredSessions() {
+	now := time.Now()
+	for id, session := range r.sessions {
+		if now.Sub(session.lastAccess) > r.expirationThreshold {
+			r.releaseSession(id) // ignore error
+		}
+	}
+}
+
+func (r *LocalReplicator) releaseSession(sessionID string) error {
+	session, ok := r.sessions[sessionID]
+	if !ok {
+		return nil // already released, or expired
+	}
+	delete(r.sessions, sessionID)
+	return session.revision.decRef()
+}
+
+/*
+Publishes the revision; publishing the current revision again is a
+no-op, while publishing an older one is an error. Either way, the
+revision passed in is released.
+*/
+func (r *LocalReplicator) Publish(rev Revision) error {
+	r.Lock()
+	defer r.Unlock()
+	if err := r.ensureOpen(); err != nil {
+		rev.Release()
+		return err
+	}
+	if r.current != nil {
+		cmp, err := rev.CompareTo(r.current.Version())
+		if err != nil {
+			rev.Release()
+			return err
+		}
+		if cmp == 0 {
+			// same revision published again, ignore but release it
+			return rev.Release()
+		} else if cmp < 0 {
+			rev.Release()
+			return errors.New(fmt.Sprintf(
+				"Cannot publish an older revision: rev=%v current=%v",
+				rev.Version(), r.current.Version()))
+		}
+	}
+
+	// swap the current revision, releasing the old one unless in use
+	old := r.current
+	r.current = &refCountedRevision{rev, 1}
+	if old != nil {
+		return old.decRef()
+	}
+	return nil
+}
+
+func (r *LocalReplicator) CheckForUpdate(currentVersion string) (*SessionToken, error) {
+	r.Lock()
+	defer r.Unlock()
+	if err := r.ensureOpen(); err != nil {
+		return nil, err
+	}
+	if r.current == nil {
+		return nil, nil // no published revisions yet
+	}
+	if currentVersion != "" {
+		cmp, err := r.current.CompareTo(currentVersion)
+		if err != nil {
+			return nil, err
+		}
+		if cmp <= 0 {
+			return nil, nil // client is up to date
+		}
+	}
+
+	// the client is outdated, or has no revision at all
+	r.current.refCount++
+	r.lastSessionID++
+	token := &SessionToken{
+		ID:      strconv.FormatInt(r.lastSessionID, 10),
+		Version: r.current.Version(),
+		Files:   r.current.Files(),
+	}
+	files := make(map[string]bool)
+	for _, file := range token.Files {
+		files[file.FileName] = true
+	}
+	r.sessions[token.ID] = &replicationSession{token, r.current, files, time.Now()}
+	r.checkExpiredSessions()
+	return token, nil
+}
+
+func (r *LocalReplicator) Release(sessionID string) error {
+	r.Lock()
+	defer r.Unlock()
+	if err := r.ensureOpen(); err != nil {
+		return err
+	}
+	return r.releaseSession(sessionID)
+}
+
+func (r *LocalReplicator) ObtainFile(sessionID, fileName string) (io.ReadCloser, error) {
+	r.Lock()
+	defer r.Unlock()
+	if err := r.ensureOpen(); err != nil {
+		return nil, err
+	}
+	session, ok := r.sessions[sessionID]
+	if ok && time.Now().Sub(session.lastAccess) > r.expirationThreshold {
+		r.releaseSession(sessionID) // ignore error
+		ok = false
+	}
+	if !ok {
+		return nil, &SessionExpiredError{sessionID}
+	}
+	// only serve the files of the revision
+	if !session.files[fileName] {
+		return nil, errors.New(fmt.Sprintf(
+			"file '%v' does not belong to revision %v", fileName, session.token.Version))
+	}
+	session.lastAccess = time.Now()
+	return session.revision.Open(fileName)
+}
+
+/* Releases all sessions, and the current revision. */
+func (r *LocalReplicator) Close() (err error) {
+	r.Lock()
+	defer r.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	for id, _ := range r.sessions {
+		if err2 := r.releaseSession(id); err == nil {
+			err = err2
+		}
+	}
+	if r.current != nil {
+		if err2 := r.current.decRef(); err == nil {
+			err = err2
+		}
+		r.current = nil
+	}
+	return err
+}
@@ -0,0 +1,287 @@
+package replicator
+
+import (
+	"bytes"
+	"github.com/balzaczyy/golucene/core/index"
+	"github.com/balzaczyy/golucene/core/search"
+	"github.com/balzaczyy/golucene/core/store"
+	"github.com/balzaczyy/golucene/core/util"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func init() {
+	index.DefaultSimilarity = func() index.Similarity {
+		return search.NewDefaultSimilarity()
+	}
+}
+
+var samples = []string{
+	"../core/search/testdata/belfrysample",
+	"../core/search/testdata/osx/belfrysample",
+}
+
+// Counts the files obtained from the wrapped replicator.
+type countingReplicator struct {
+	Replicator
+	obtained []string
+}
+
+func (r *countingReplicator) ObtainFile(sessionID, fileName string) (io.ReadCloser, error) {
+	r.obtained = append(r.obtained, fileName)
+	return r.Replicator.ObtainFile(sessionID, fileName)
+}
+
+func newPrimary(t *testing.T) (store.Directory, *index.IndexWriter) {
+	dir := store.NewRAMDirectory()
+	w, err := index.NewIndexWriter(dir, index.NewIndexWriterConfig(util.VERSION_45, nil).
+		SetIndexDeletionPolicy(index.NewSnapshotDeletionPolicy(index.DEFAULT_DELETION_POLICY)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, w
+}
+
+// Adds a sample index to the primary, commits and publishes it.
+func addAndPublish(t *testing.T, w *index.IndexWriter, path string, r Replicator) *IndexRevision {
+	src, err := store.OpenFSDirectory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if err = w.AddIndexes(src); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	rev, err := NewIndexRevision(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Publish(rev); err != nil {
+		t.Fatal(err)
+	}
+	return rev
+}
+
+func checkReplica(t *testing.T, h *IndexReplicationHandler, numDocs int) {
+	reader := h.Reader()
+	if reader == nil {
+		t.Fatal("replica has no reader")
+	}
+	defer reader.DecRef()
+	if reader.NumDocs() != numDocs {
+		t.Errorf("expected %v docs, got %v", numDocs, reader.NumDocs())
+	}
+	var buf bytes.Buffer
+	if status := index.NewCheckIndex(h.Directory(), true, &buf).CheckIndex(nil); !status.Clean {
+		t.Fatalf("replica is not clean:\n%v", buf.String())
+	}
+}
+
+func testReplication(t *testing.T, newReplicator func(*LocalReplicator) Replicator) {
+	primaryDir, w := newPrimary(t)
+	defer w.Close()
+	local := NewLocalReplicator()
+	defer local.Close()
+	replicator := &countingReplicator{Replicator: newReplicator(local)}
+
+	replicaDir := store.NewRAMDirectory()
+	readers := 0
+	handler, err := NewIndexReplicationHandler(replicaDir, func(index.DirectoryReader) error {
+		readers++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handler.Close()
+	client := NewReplicationClient(replicator, handler)
+	defer client.Close()
+
+	if updated, err := client.UpdateNow(); err != nil || updated {
+		t.Fatalf("nothing should be replicated yet: %v", err)
+	}
+
+	rev1 := addAndPublish(t, w, samples[0], local)
+	if updated, err := client.UpdateNow(); err != nil || !updated {
+		t.Fatalf("expected an update: %v", err)
+	}
+	if handler.CurrentVersion() != rev1.Version() || readers != 1 {
+		t.Errorf("unexpected version %v after %v readers", handler.CurrentVersion(), readers)
+	}
+	checkReplica(t, handler, 8)
+	if len(replicator.obtained) != len(rev1.Files()) {
+		t.Errorf("expected all files to be copied: %v", replicator.obtained)
+	}
+	if updated, err := client.UpdateNow(); err != nil || updated {
+		t.Fatalf("replica should be up to date: %v", err)
+	}
+
+	// only the new segment is copied
+	replicator.obtained = nil
+	rev2 := addAndPublish(t, w, samples[1], local)
+	if updated, err := client.UpdateNow(); err != nil || !updated {
+		t.Fatalf("expected an update: %v", err)
+	}
+	checkReplica(t, handler, 16)
+	for _, name := range replicator.obtained {
+		for _, file := range rev1.Files() {
+			if name == file.FileName {
+				t.Errorf("%v was copied again", name)
+			}
+		}
+	}
+	// the previous commit is gone from both sides
+	if replicaDir.FileExists(rev1.Commit().SegmentsFileName()) {
+		t.Error("stale segments file should have been deleted from the replica")
+	}
+	if primaryDir.FileExists(rev1.Commit().SegmentsFileName()) {
+		t.Error("the primary should delete the previous revision once released")
+	}
+
+	// a new replica over an existing index resumes from its version
+	handler2, err := NewIndexReplicationHandler(replicaDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handler2.Close()
+	if handler2.CurrentVersion() != rev2.Version() {
+		t.Errorf("expected version %v, got %v", rev2.Version(), handler2.CurrentVersion())
+	}
+}
+
+func TestLocalReplication(t *testing.T) {
+	testReplication(t, func(r *LocalReplicator) Replicator { return r })
+}
+
+func TestHTTPReplication(t *testing.T) {
+	var server *httptest.Server
+	defer func() { server.Close() }()
+	testReplication(t, func(r *LocalReplicator) Replicator {
+		server = httptest.NewServer(NewReplicationService(r))
+		return NewHTTPReplicator(server.URL+"/replicate", nil)
+	})
+}
+
+func TestReplicatorSessions(t *testing.T) {
+	_, w := newPrimary(t)
+	defer w.Close()
+	local := NewLocalReplicator()
+	defer local.Close()
+	server := httptest.NewServer(NewReplicationService(local))
+	defer server.Close()
+	remote := NewHTTPReplicator(server.URL, nil)
+
+	rev := addAndPublish(t, w, samples[0], local)
+	// a second snapshot of the same commit is simply released
+	same, err := NewIndexRevision(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = local.Publish(same); err != nil {
+		t.Errorf("publishing the same revision again should be a no-op: %v", err)
+	}
+	token, err := remote.CheckForUpdate("")
+	if err != nil || token == nil {
+		t.Fatalf("expected a session: %v", err)
+	}
+	if token.Version != rev.Version() || len(token.Files) != len(rev.Files()) {
+		t.Errorf("unexpected session: %v", token)
+	}
+	if token, err := remote.CheckForUpdate(rev.Version()); err != nil || token != nil {
+		t.Errorf("expected to be up to date: %v %v", token, err)
+	}
+	if _, err = remote.ObtainFile(token.ID, "write.lock"); err == nil {
+		t.Error("only files of the revision should be served")
+	}
+
+	// the session holds the revision, even once a new one is published
+	addAndPublish(t, w, samples[1], local)
+	in, err := remote.ObtainFile(token.ID, rev.Commit().SegmentsFileName())
+	if err != nil {
+		t.Fatal(err)
+	}
+	in.Close()
+	if err = remote.Release(token.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = remote.ObtainFile(token.ID, rev.Commit().SegmentsFileName()); err == nil {
+		t.Error("expected error using a released session")
+	} else if _, ok := err.(*SessionExpiredError); !ok {
+		t.Errorf("expected SessionExpiredError, got %v", err)
+	}
+
+	token, err = local.CheckForUpdate(rev.Version())
+	if err != nil || token == nil {
+		t.Fatalf("expected a session: %v", err)
+	}
+	local.SetExpirationThreshold(time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if _, err = local.ObtainFile(token.ID, token.Files[0].FileName); err == nil {
+		t.Error("expected the session to expire")
+	}
+}
+
+func TestInvalidVersion(t *testing.T) {
+	_, w := newPrimary(t)
+	defer w.Close()
+	local := NewLocalReplicator()
+	defer local.Close()
+	server := httptest.NewServer(NewReplicationService(local))
+	defer server.Close()
+
+	addAndPublish(t, w, samples[0], local)
+	if _, err := local.CheckForUpdate("zz"); err == nil {
+		t.Error("expected error checking for update from an invalid version")
+	} else if _, ok := err.(*InvalidVersionError); !ok {
+		t.Errorf("expected InvalidVersionError, got %v", err)
+	}
+
+	resp, err := http.Get(server.URL + "/update?version=zz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected %v, got %v", http.StatusBadRequest, resp.Status)
+	}
+	if _, err = NewHTTPReplicator(server.URL, nil).CheckForUpdate("zz"); err == nil {
+		t.Error("expected error checking for update from an invalid version")
+	}
+
+	// the replicator is still serving
+	if token, err := local.CheckForUpdate(""); err != nil || token == nil {
+		t.Fatalf("expected a session: %v", err)
+	} else if err = local.Release(token.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCloseAfterWriter(t *testing.T) {
+	dir, w := newPrimary(t)
+	local := NewLocalReplicator()
+	rev := addAndPublish(t, w, samples[0], local)
+	token, err := local.CheckForUpdate("")
+	if err != nil || token == nil {
+		t.Fatalf("expected a session: %v", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if w.IsOpen() {
+		t.Fatal("expected the writer to be closed")
+	}
+
+	// releasing the revision no longer touches the closed writer
+	if err = local.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !dir.FileExists(rev.Commit().SegmentsFileName()) {
+		t.Errorf("expected %v kept", rev.Commit().SegmentsFileName())
+	}
+}
@@ -0,0 +1,247 @@
+/*
+Package replicator copies the commits of an index from a primary to
+read-only replicas.
+
+The primary publishes a Revision, a snapshot of a commit along with
+the list of its files, to a Replicator. Replicas run a
+ReplicationClient, which asks the Replicator for revisions newer than
+their own, copies the files they miss into their Directory, and hands
+the new commit over to a ReplicationHandler, e.g. one opening a new
+DirectoryReader on it.
+
+Replicators can be reached in-process (LocalReplicator), or over
+HTTP (ReplicationService on the primary, HTTPReplicator on replicas).
+*/
+package replicator
+
+import (
+	"errors"
+	"fmt"
+	"github.com/balzaczyy/golucene/core/index"
+	"github.com/balzaczyy/golucene/core/store"
+	"hash/crc32"
+	"io"
+	"strconv"
+)
+
+// replicator/RevisionFile.java
+
+/* Describes a file of a Revision. */
+type RevisionFile struct {
+	FileName string
+	Length   int64
+	// CRC32 of the whole file, verified by the client after copying.
+	Checksum int64
+}
+
+// replicator/Revision.java
+
+/*
+A revision comprises the files of a snapshot of an index, which are
+protected from deletion until the revision is released. Revisions are
+published to a Replicator and released by it once no replica copies
+them anymore.
+*/
+/*
+Returned when a version, e.g. sent by a client, is not a valid
+version of the revisions it is compared to.
+*/
+type InvalidVersionError struct {
+	Version string
+	Cause   error
+}
+
+func (err *InvalidVersionError) Error() string {
+	return fmt.Sprintf("invalid revision version: '%v': %v", err.Version, err.Cause)
+}
+
+type Revision interface {
+	// Returns a string representation of the version of this revision.
+	// Versions must be comparable through CompareTo().
+	Version() string
+	// Compares this revision's version to the given version; returns a
+	// negative number, zero or a positive number if this revision is
+	// older, equal or newer, or an *InvalidVersionError if version
+	// can't be parsed.
+	CompareTo(version string) (int, error)
+	// Returns the files of this revision.
+	Files() []RevisionFile
+	// Opens the named file of this revision for reading.
+	Open(fileName string) (io.ReadCloser, error)
+	// Called when this revision can be released, e.g. to release the
+	// snapshot it holds.
+	Release() error
+}
+
+// replicator/IndexRevision.java
+
+/*
+A Revision of a single index, holding a snapshot of the last commit
+of an IndexWriter. The writer must be configured with a
+SnapshotDeletionPolicy, or a PersistentSnapshotDeletionPolicy, so the
+files of the commit aren't deleted while replicas copy them.
+
+The version of the revision is the generation of the commit, in
+hexadecimal. Its files are listed with the segments_N file last, so
+replicas copying them in order only see the commit once complete.
+*/
+type IndexRevision struct {
+	writer  *index.IndexWriter
+	sdp     index.Snapshotter
+	commit  index.IndexCommit
+	version string
+	files   []RevisionFile
+}
+
+/*
+Snapshots the last commit of the writer, and computes the checksums
+of its files.
+*/
+func NewIndexRevision(w *index.IndexWriter) (rev *IndexRevision, err error) {
+	sdp, ok := w.Config().IndexDeletionPolicy().(index.Snapshotter)
+	if !ok {
+		return nil, errors.New(
+			"IndexWriter must be created with a SnapshotDeletionPolicy")
+	}
+	commit, err := sdp.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			sdp.Release(commit) // ignore error
+		}
+	}()
+
+	files, err := revisionFiles(commit)
+	if err != nil {
+		return nil, err
+	}
+	return &IndexRevision{
+		writer:  w,
+		sdp:     sdp,
+		commit:  commit,
+		version: RevisionVersion(commit),
+		files:   files,
+	}, nil
+}
+
+/* Returns the version of the revision of the given commit. */
+func RevisionVersion(commit index.IndexCommit) string {
+	return strconv.FormatInt(commit.Generation(), 16)
+}
+
+func revisionFiles(commit index.IndexCommit) ([]RevisionFile, error) {
+	segmentsFile := commit.SegmentsFileName()
+	var files []RevisionFile
+	for _, name := range commit.FileNames() {
+		if name != segmentsFile {
+			file, err := newRevisionFile(commit.Directory(), name)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, file)
+		}
+	}
+	// segments_N must be copied last
+	file, err := newRevisionFile(commit.Directory(), segmentsFile)
+	if err != nil {
+		return nil, err
+	}
+	return append(files, file), nil
+}
+
+func newRevisionFile(dir store.Directory, name string) (file RevisionFile, err error) {
+	in, err := dir.OpenInput(name, store.IO_CONTEXT_READONCE)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+	h := crc32.NewIEEE()
+	if _, err = io.Copy(h, newIndexInputReader(in)); err != nil {
+		return
+	}
+	return RevisionFile{name, in.Length(), int64(h.Sum32())}, nil
+}
+
+/* Returns the snapshotted commit. */
+func (r *IndexRevision) Commit() index.IndexCommit {
+	return r.commit
+}
+
+func (r *IndexRevision) Version() string {
+	return r.version
+}
+
+func (r *IndexRevision) CompareTo(version string) (int, error) {
+	gen, err := strconv.ParseInt(version, 16, 64)
+	if err != nil {
+		return 0, &InvalidVersionError{version, err}
+	}
+	switch commitGen := r.commit.Generation(); {
+	case commitGen < gen:
+		return -1, nil
+	case commitGen > gen:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (r *IndexRevision) Files() []RevisionFile {
+	return r.files
+}
+
+func (r *IndexRevision) Open(fileName string) (io.ReadCloser, error) {
+	in, err := r.commit.Directory().OpenInput(fileName, store.IO_CONTEXT_READONCE)
+	if err != nil {
+		return nil, err
+	}
+	return newIndexInputReader(in), nil
+}
+
+/*
+Releases the snapshot, deleting its files unless still in use. If the
+writer is already closed, the files are left for the next writer
+opened on the index to delete.
+*/
+func (r *IndexRevision) Release() error {
+	if err := r.sdp.Release(r.commit); err != nil {
+		return err
+	}
+	if !r.writer.IsOpen() {
+		return nil
+	}
+	return r.writer.DeleteUnusedFiles()
+}
+
+func (r *IndexRevision) String() string {
+	return fmt.Sprintf("IndexRevision version=%v files=%v", r.version, r.files)
+}
+
+/* Adapts an IndexInput to io.ReadCloser, reading to its end. */
+type indexInputReader struct {
+	in        store.IndexInput
+	remaining int64
+}
+
+func newIndexInputReader(in store.IndexInput) *indexInputReader {
+	return &indexInputReader{in, in.Length() - in.FilePointer()}
+}
+
+func (r *indexInputReader) Read(buf []byte) (int, error) {
+	if r.remaining == 0 {
+		return 0, io.EOF
+	}
+	if int64(len(buf)) > r.remaining {
+		buf = buf[:r.remaining]
+	}
+	if err := r.in.ReadBytes(buf); err != nil {
+		return 0, err
+	}
+	r.remaining -= int64(len(buf))
+	return len(buf), nil
+}
+
+func (r *indexInputReader) Close() error {
+	return r.in.Close()
+}
@@ -9,4 +9,6 @@ go test github.com/balzaczyy/golucene/core/util/packed
 go test github.com/balzaczyy/golucene/core/store
 go test github.com/balzaczyy/golucene/core/index
 go test github.com/balzaczyy/golucene/core/search
+go test github.com/balzaczyy/golucene/replicator
+go test github.com/balzaczyy/golucene/backup
 go test github.com/balzaczyy/golucene/core_test
@@ -1139,6 +1139,10 @@ func newMockIndexOutputWrapper(dir *MockDirectoryWrapper, name string, delegate
 	return ans
 }
 
+func (w *MockIndexOutputWrapper) Checksum() int64 {
+	return w.delegate.Checksum()
+}
+
 func (w *MockIndexOutputWrapper) checkCrashed() error {
 	// If MockRAMDir crashed since we were opened, then don't write anything
 	if w.dir.crashed {
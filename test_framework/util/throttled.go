@@ -67,6 +67,10 @@ func (out *ThrottledIndexOutput) FilePointer() int64 {
 	return out.delegate.FilePointer()
 }
 
+func (out *ThrottledIndexOutput) Checksum() int64 {
+	return out.delegate.Checksum()
+}
+
 func (out *ThrottledIndexOutput) Length() (int64, error) {
 	return out.delegate.Length()
 }